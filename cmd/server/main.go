@@ -25,9 +25,15 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/nabilulilalbab/rclonestorage/docs"
@@ -47,34 +53,56 @@ func main() {
 	}
 
 	// Initialize authentication system
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		jwtSecret = "your-super-secret-jwt-key-change-in-production"
-		log.Println("Warning: Using default JWT secret. Set JWT_SECRET environment variable in production.")
+	if cfg.Auth.GeneratedSecret {
+		log.Println("Warning: JWT_SECRET not set, using a random secret. Tokens will not survive a restart.")
 	}
 
-	authManager, err := auth.NewAuthManager("./data/auth.db", jwtSecret)
+	authManager, err := auth.NewAuthManager("./data/auth.db", cfg.Auth.JWTSecret, cfg.Auth.AdminEmail, cfg.Auth.AdminPassword)
 	if err != nil {
 		log.Fatalf("Failed to initialize authentication: %v", err)
 	}
 	defer authManager.Close()
+	authManager.Middleware.SetTrustClaims(cfg.Auth.TrustClaims)
+	authManager.Middleware.SetStrictOptionalAuth(cfg.Auth.StrictOptionalAuth)
+	authManager.Middleware.SetRateLimits(cfg.Auth.RateLimitRoles)
+	authManager.DatabaseManager.SetLoginLockout(cfg.Auth.LoginMaxAttempts, cfg.Auth.LoginLockout)
+	authManager.DatabaseManager.SetPasswordPolicy(auth.PasswordPolicy{
+		MinLength:  cfg.Auth.PasswordMinLength,
+		MaxLength:  cfg.Auth.PasswordMaxLength,
+		Require:    cfg.Auth.PasswordRequire,
+		MinEntropy: float64(cfg.Auth.PasswordMinEntropy),
+	})
+	if err := authManager.DatabaseManager.SetPasswordHashing(cfg.Auth.PasswordHash, cfg.Auth.BcryptCost); err != nil {
+		log.Fatalf("Invalid password hashing settings: %v", err)
+	}
+	permissions, err := auth.NewPermissions(cfg.Auth.RolePermissions)
+	if err != nil {
+		log.Fatalf("Invalid ROLE_PERMISSIONS: %v", err)
+	}
+	authManager.SetPermissions(permissions)
 
-	// Setup Gin router
-	r := gin.Default()
-
-	// Add CORS middleware
-	r.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(http.StatusOK)
-			return
+	if cfg.IsProduction() {
+		// An admin created by an earlier run may still have the default password
+		if authManager.DatabaseManager.PasswordMatches(cfg.Auth.AdminEmail, config.DefaultAdminPassword) {
+			log.Fatalf("Admin account %s still uses the default password, change it before running with APP_ENV=production", cfg.Auth.AdminEmail)
+		}
+	} else if authManager.DatabaseManager.AdminCreated() {
+		// A configured password is already known to whoever set it, only a random one is shown
+		if cfg.Auth.GeneratedAdminPassword {
+			log.Printf("Admin account created: %s / %s (generated password, change it after logging in)", cfg.Auth.AdminEmail, cfg.Auth.AdminPassword)
+		} else {
+			log.Printf("Admin account created: %s", cfg.Auth.AdminEmail)
 		}
+	}
 
-		c.Next()
-	})
+	// Setup Gin router
+	r := gin.New()
+	r.Use(gin.Recovery(), api.RequestLogger())
+
+	r.Use(api.CORS(cfg.Server))
+	if cfg.Server.SecurityHeaders {
+		r.Use(api.SecurityHeaders(cfg.Server))
+	}
 
 	// Setup static file serving for web interface
 	r.Static("/static", "./web/static")
@@ -93,11 +121,15 @@ func main() {
 	authManager.SetupAuthRoutes(r)
 
 	// Setup API routes with authentication
-	api.SetupRoutes(r, cfg, authManager)
+	apiHandler, err := api.SetupRoutes(r, cfg, authManager)
+	if err != nil {
+		log.Fatalf("Failed to setup API routes: %v", err)
+	}
 
 	// Setup monitoring dashboard
-	monitoringDashboard := monitoring.NewMonitoringDashboard(cfg, authManager)
+	monitoringDashboard := monitoring.NewMonitoringDashboard(cfg, authManager, apiHandler.Storage(), apiHandler.Rclone(), apiHandler.Cache())
 	monitoringDashboard.SetupRoutes(r)
+	apiHandler.OnFileChange(monitoringDashboard.FileChanged)
 
 	// Setup Swagger documentation
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
@@ -105,22 +137,9 @@ func main() {
 		c.Redirect(http.StatusMovedPermanently, "/swagger/index.html")
 	})
 
-	// Health check endpoint (public)
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status":  "ok",
-			"service": "rclonestorage",
-			"version": "1.0.0",
-			"features": []string{
-				"multi-provider storage",
-				"video streaming",
-				"authentication",
-				"api keys",
-				"monitoring dashboard",
-				"swagger documentation",
-			},
-		})
-	})
+	// Health checks (public): readiness of the dependencies and liveness of the process
+	r.GET("/health", apiHandler.HandleHealth)
+	r.GET("/health/live", apiHandler.HandleLive)
 
 	// Create data directory if not exists
 	if err := os.MkdirAll("./data", 0755); err != nil {
@@ -133,9 +152,38 @@ func main() {
 		port = "5601"
 	}
 
-	log.Printf("Starting RcloneStorage server on port %s", port)
-	log.Printf("Default admin credentials: admin@rclonestorage.local / Admin123!")
-	if err := r.Run(":" + port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: r,
+		TLSConfig: &tls.Config{
+			MinVersion: cfg.Server.TLSMinVersion,
+		},
+	}
+
+	go func() {
+		var err error
+		if cfg.Server.TLSEnabled() {
+			log.Printf("Starting RcloneStorage server on port %s (HTTPS)", port)
+			err = srv.ListenAndServeTLS(cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile)
+		} else {
+			log.Printf("Starting RcloneStorage server on port %s", port)
+			err = srv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	// Wait for an interrupt, then let in-flight requests finish before exiting
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	log.Println("Shutting down server...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server forced to shutdown: %v", err)
 	}
+	apiHandler.Close()
 }
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/rclonestorage/internal/logging"
+)
+
+// trackAccess counts a served download or stream in the file's access stats once the
+// handler has finished. Requests for a range past the first byte continue an earlier
+// download or playback and only add their bytes.
+func (a *API) trackAccess(kind string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		switch c.Writer.Status() {
+		case http.StatusOK, http.StatusPartialContent, http.StatusFound:
+		default:
+			return
+		}
+
+		rangeHeader := c.GetHeader("Range")
+		started := !strings.HasPrefix(rangeHeader, "bytes=") || strings.HasPrefix(rangeHeader, "bytes=0-")
+
+		var bytes int64
+		if size := c.Writer.Size(); size > 0 {
+			bytes = int64(size)
+		}
+
+		if err := a.authManager.DatabaseManager.RecordFileAccess(c.Param("id"), kind, started, bytes); err != nil {
+			logging.FromContext(c.Request.Context()).WithField("file_id", c.Param("id")).Warnf("Failed to record %s: %v", kind, err)
+		}
+	}
+}
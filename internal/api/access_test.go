@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+)
+
+func TestFileRoutesRequireReadAccess(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	owner := ta.newUser(t, "owner@example.com")
+	other := ta.newUser(t, "other@example.com")
+	ta.addFile(t, owner, "file1", "clip.mp4", []byte("private clip"))
+
+	for _, path := range []string{"/api/v1/files/file1", "/api/v1/download/file1", "/api/v1/stream/file1"} {
+		if w := ta.do(t, http.MethodGet, path, nil, nil); w.Code != http.StatusUnauthorized {
+			t.Errorf("anonymous GET %s: got %d, want 401", path, w.Code)
+		}
+		if w := ta.do(t, http.MethodGet, path, other, nil); w.Code != http.StatusForbidden {
+			t.Errorf("GET %s by another user: got %d, want 403", path, w.Code)
+		}
+		if w := ta.do(t, http.MethodGet, path, owner, nil); w.Code != http.StatusOK {
+			t.Errorf("GET %s by the owner: got %d, want 200: %s", path, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestPublicFileReadableByAnyone(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	owner := ta.newUser(t, "owner@example.com")
+	other := ta.newUser(t, "other@example.com")
+	ta.addFile(t, owner, "file1", "poster.txt", []byte("public notes"))
+	if err := ta.db.SetFilePublic("file1", true); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/api/v1/files/file1", "/api/v1/download/file1"} {
+		if w := ta.do(t, http.MethodGet, path, other, nil); w.Code != http.StatusOK {
+			t.Errorf("GET %s of a public file: got %d, want 200", path, w.Code)
+		}
+	}
+}
+
+func TestDownloadsCountedInAccessStats(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	owner := ta.newUser(t, "owner@example.com")
+	other := ta.newUser(t, "other@example.com")
+	ta.addFile(t, owner, "file1", "notes.txt", []byte("twelve bytes"))
+
+	ta.do(t, http.MethodGet, "/api/v1/download/file1", owner, nil)
+	// Resuming isn't a new download, refused requests aren't counted at all
+	ta.doWithHeader(t, http.MethodGet, "/api/v1/download/file1", owner, http.Header{"Range": {"bytes=6-"}})
+	ta.do(t, http.MethodGet, "/api/v1/download/file1", other, nil)
+
+	files, err := ta.db.TopFiles(auth.MetricDownloads, time.Now().Add(-time.Hour), 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Downloads != 1 || files[0].Bytes < 12 {
+		t.Errorf("got %+v, want one download of at least 12 bytes", files)
+	}
+}
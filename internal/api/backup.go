@@ -0,0 +1,118 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+	"github.com/nabilulilalbab/rclonestorage/internal/storage"
+)
+
+// backupBundle is the database backup plus the provider set and the non-secret
+// settings of the instance it was taken from
+type backupBundle struct {
+	*auth.Backup
+	Providers []storage.ProviderSpec `json:"providers"`
+	Settings  gin.H                  `json:"settings"`
+}
+
+// handleExportBackup exports the service state for backup
+// @Summary Export backup
+// @Description Export users (with password hashes), file ownership, API key metadata, notification preferences, providers and non-secret settings as a JSON bundle. Media stays in cloud storage and API key values, the JWT secret and the admin password are never exported (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{} "Backup bundle"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - Admin access required"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /../admin/backup [get]
+func (a *API) handleExportBackup(c *gin.Context) {
+	backup, err := a.authManager.DatabaseManager.ExportBackup()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to export backup",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	bundle := backupBundle{
+		Backup:    backup,
+		Providers: a.providers.Specs(),
+		Settings: gin.H{
+			"cache":   a.config.Cache,
+			"storage": a.config.Storage,
+			"listing": a.config.Listing,
+			"share":   a.config.Share,
+		},
+	}
+
+	filename := fmt.Sprintf("rclonestorage-backup-%s.json", backup.CreatedAt.UTC().Format("20060102-150405"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.JSON(http.StatusOK, bundle)
+}
+
+// handleImportBackup restores a backup bundle
+// @Summary Import backup
+// @Description Restore a bundle from GET /admin/backup into a fresh instance, one without files or users besides the initial admin, which the bundle's users replace. Every user must log in again and API keys have to be reissued. Providers are not added, those missing from this instance are listed (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param backup body map[string]interface{} true "Backup bundle"
+// @Success 200 {object} map[string]interface{} "Backup restored"
+// @Failure 400 {object} map[string]interface{} "Invalid or incompatible bundle, or one without an active admin"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - Admin access required"
+// @Failure 409 {object} map[string]interface{} "Instance already holds data"
+// @Router /../admin/backup/restore [post]
+func (a *API) handleImportBackup(c *gin.Context) {
+	bundle := backupBundle{Backup: &auth.Backup{}}
+	if err := c.ShouldBindJSON(&bundle); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid backup bundle",
+			"details": err.Error(),
+		})
+		return
+	}
+	if err := a.authManager.DatabaseManager.CheckBackup(bundle.Backup); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Incompatible backup bundle",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	summary, err := a.authManager.DatabaseManager.ImportBackup(bundle.Backup)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, auth.ErrNotFresh) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"error":   "Failed to restore backup",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	missing := make([]string, 0)
+	for _, spec := range bundle.Providers {
+		if a.storage.GetProvider(spec.Name) == nil {
+			missing = append(missing, spec.Name)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":           "Backup restored, log in again with a restored account",
+		"restored":          summary,
+		"backup_created_at": bundle.CreatedAt.Format(time.RFC3339),
+		"missing_providers": missing,
+	})
+}
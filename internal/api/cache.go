@@ -2,17 +2,15 @@ package api
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strings"
-	"time"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"github.com/nabilulilalbab/rclonestorage/internal/cache"
+	"github.com/nabilulilalbab/rclonestorage/internal/jobs"
+	"github.com/nabilulilalbab/rclonestorage/internal/logging"
 )
 
 // handleClearCache handles clearing cache
@@ -30,7 +28,7 @@ import (
 // @Router /cache/clear [post]
 func (a *API) handleClearCache(c *gin.Context) {
 	// Clear temp cache
-	tempDir := "./cache/temp"
+	tempDir := filepath.Join(a.config.Cache.Dir, "temp")
 	
 	files, err := filepath.Glob(filepath.Join(tempDir, "*"))
 	if err != nil {
@@ -60,9 +58,119 @@ func (a *API) handleClearCache(c *gin.Context) {
 	})
 }
 
+// handlePurgeExpiredCache runs the cache expiry sweep immediately
+// @Summary Purge expired cache entries
+// @Description Remove expired cache entries now instead of waiting for the cleanup interval (admin only)
+// @Tags system
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{} "Number of entries and bytes freed"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - Admin access required"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /cache/purge-expired [post]
+func (a *API) handlePurgeExpiredCache(c *gin.Context) {
+	purged, freed := a.cache.PurgeExpired()
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":           "Expired cache entries purged",
+		"purged_entries":    purged,
+		"freed_bytes":       freed,
+		"freed_bytes_human": formatBytes(freed),
+	})
+}
+
+// handleRecalculateCache rebuilds the cache size accounting from disk
+// @Summary Recalculate cache size
+// @Description Recompute the cache size from the files on disk, correcting drift after crashes, failed writes or files changed outside the service (admin only)
+// @Tags system
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{} "Cache size before and after"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - Admin access required"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /cache/recalculate [post]
+func (a *API) handleRecalculateCache(c *gin.Context) {
+	previous, current, err := a.cache.Recalculate()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to recalculate cache size",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":            "Cache size recalculated",
+		"previous_size":      previous,
+		"current_size":       current,
+		"drift_bytes":        previous - current,
+		"current_size_human": formatBytes(current),
+	})
+}
+
+// handleListCacheEntries lists the cached files
+// @Summary List cache entries
+// @Description List cached files with their key, size, creation and last access time and access count, most recently accessed first (admin only)
+// @Tags system
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Success 200 {object} map[string]interface{} "Cache entries"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - Admin access required"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /cache/entries [get]
+func (a *API) handleListCacheEntries(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+
+	all := a.cache.Entries()
+	start := (page - 1) * limit
+	if start > len(all) {
+		start = len(all)
+	}
+	end := start + limit
+	if end > len(all) {
+		end = len(all)
+	}
+
+	entries := make([]gin.H, 0, end-start)
+	for _, entry := range all[start:end] {
+		entries = append(entries, gin.H{
+			"key":          entry.OriginalKey,
+			"size":         entry.Size,
+			"size_human":   formatBytes(entry.Size),
+			"created_at":   entry.CreatedAt,
+			"accessed_at":  entry.AccessedAt,
+			"access_count": entry.AccessCount,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries": entries,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": len(all),
+		},
+	})
+}
+
 // handleDeleteFile handles real file deletion from cloud storage
 // @Summary Delete file
-// @Description Delete a file from cloud storage (requires ownership or admin)
+// @Description Delete a file from cloud storage together with its ownership record, releasing the owner's quota (requires ownership or admin)
 // @Tags files
 // @Accept json
 // @Produce json
@@ -78,42 +186,27 @@ func (a *API) handleClearCache(c *gin.Context) {
 func (a *API) handleDeleteFile(c *gin.Context) {
 	fileID := c.Param("id")
 	
-	// First, find the file in cloud storage
-	cmd := exec.Command("rclone", "lsjson", "union:uploads/")
-	if a.config.Rclone.ConfigPath != "" {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("RCLONE_CONFIG=%s", a.config.Rclone.ConfigPath))
-	}
-	
-	output, err := cmd.Output()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to access cloud storage",
-			"details": err.Error(),
+	// The ownership record is what quota accounting is based on
+	ownership, ownershipErr := a.authManager.DatabaseManager.GetFileOwnership(fileID)
+	if ownershipErr != nil && a.config.Storage.DeleteRequireOwnership {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "File ownership record not found",
+			"file_id": fileID,
 		})
 		return
 	}
 	
-	// Parse JSON output to find our file
-	var files []map[string]interface{}
-	if err := json.Unmarshal(output, &files); err != nil {
+	// First, find the file in cloud storage
+	targetFile, err := a.findObject(c.Request.Context(), fileID, ownership)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to parse file list",
+			"error": "Failed to access cloud storage",
 			"details": err.Error(),
 		})
 		return
 	}
 	
-	var targetFile map[string]interface{}
-	for _, file := range files {
-		if name, ok := file["Name"].(string); ok {
-			if strings.HasPrefix(name, fileID+"_") {
-				targetFile = file
-				break
-			}
-		}
-	}
-	
-	if targetFile == nil {
+	if targetFile == nil && ownership == nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": "File not found in cloud storage",
 			"file_id": fileID,
@@ -121,41 +214,79 @@ func (a *API) handleDeleteFile(c *gin.Context) {
 		return
 	}
 	
-	filename := targetFile["Name"].(string)
-	size := int64(targetFile["Size"].(float64))
+	// An ownership record whose object is already gone is still removed, so a
+	// delete always brings the database back in line with storage
+	var filename string
+	var size int64
+	if targetFile != nil {
+		filename = targetFile.Name
+		size = targetFile.Size
+	} else {
+		filename = ownership.Object()
+		size = ownership.Size
+	}
+	remotePath := a.unionPath(filename)
 	
-	// Delete from cloud storage
-	remotePath := fmt.Sprintf("union:uploads/%s", filename)
-	deleteCmd := exec.Command("rclone", "delete", remotePath)
-	if a.config.Rclone.ConfigPath != "" {
-		deleteCmd.Env = append(deleteCmd.Env, fmt.Sprintf("RCLONE_CONFIG=%s", a.config.Rclone.ConfigPath))
+	// The record and quota are committed first, the object is removed after so no
+	// transaction is held open across the remote call
+	shared := false
+	var replicas []string
+	if ownership != nil {
+		deleted, err := a.authManager.DatabaseManager.DeleteFileRecord(fileID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to delete file record",
+				"details": err.Error(),
+				"file_id": fileID,
+			})
+			return
+		}
+		shared, replicas = deleted.Shared, deleted.Replicas
+	} else if records, err := a.authManager.DatabaseManager.FileReplicas(fileID); err == nil {
+		for _, record := range records {
+			replicas = append(replicas, record.Provider)
+		}
 	}
 	
-	if err := deleteCmd.Run(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to delete file from cloud storage",
-			"details": err.Error(),
-			"file_id": fileID,
-			"filename": filename,
-		})
-		return
+	// The object stays while other files share it. Once the record is gone a failed
+	// removal can't be reported back to the client, it is retried in the background.
+	var removal *jobs.Job
+	if !shared {
+		if err := a.removeObject(c.Request.Context(), filename, replicas); err != nil {
+			if ownership == nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": "Failed to delete file from cloud storage",
+					"details": err.Error(),
+					"file_id": fileID,
+					"filename": filename,
+				})
+				return
+			}
+			logging.FromContext(c.Request.Context()).WithField("file_id", fileID).Warnf("Failed to delete %s, retrying in the background: %v", remotePath, err)
+			job := a.queueRemoval(ownership.UserID, filename, replicas)
+			removal = &job
+		}
+	}
+	
+	var ownerID uint
+	if ownership != nil {
+		ownerID = ownership.UserID
 	}
+	a.fileChanged(FileDeleted, fileID, ownerID)
 	
 	// Also clear from cache if exists
-	cacheManager, _ := cache.NewManager("./cache", 24*time.Hour, 10*1024*1024*1024)
-	if cacheManager != nil {
-		cacheKeys := []string{
-			fmt.Sprintf("download_%s", fileID),
-			fmt.Sprintf("stream_%s", fileID),
-		}
-		
-		for _, key := range cacheKeys {
-			cacheManager.Delete(context.Background(), key)
-		}
+	cacheKeys := []string{
+		fmt.Sprintf("download_%s", fileID),
+		fmt.Sprintf("stream_%s", fileID),
+	}
+	
+	for _, key := range cacheKeys {
+		a.cache.Delete(context.Background(), key)
+		a.cache.DeleteChunks(context.Background(), key)
 	}
 	
 	// Also clean temp cache
-	tempDir := "./cache/temp"
+	tempDir := filepath.Join(a.config.Cache.Dir, "temp")
 	pattern := filepath.Join(tempDir, fileID+"_*")
 	tempFiles, _ := filepath.Glob(pattern)
 	var deletedTempFiles []string
@@ -165,7 +296,7 @@ func (a *API) handleDeleteFile(c *gin.Context) {
 		}
 	}
 	
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"message": "File deleted successfully from cloud storage",
 		"file_id": fileID,
 		"deleted_file": gin.H{
@@ -173,12 +304,25 @@ func (a *API) handleDeleteFile(c *gin.Context) {
 			"size":        size,
 			"size_human":  formatBytes(size),
 			"remote_path": remotePath,
+			"shared":      shared, // the object stays for the other files with this content
 		},
 		"cache_cleared": gin.H{
 			"download_cache": fmt.Sprintf("download_%s", fileID),
 			"stream_cache":   fmt.Sprintf("stream_%s", fileID),
 			"temp_files":     deletedTempFiles,
 		},
+		"ownership_removed": ownership != nil,
 		"status": "deleted_from_cloud",
-	})
-}
\ No newline at end of file
+	}
+	if removal != nil {
+		response["status"] = "removal_pending"
+		response["removal_job_id"] = removal.ID
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// cacheValidator identifies the content of a cloud object for cache entries, a
+// replaced file changes size or modification time
+func cacheValidator(size int64, modTime string) string {
+	return fmt.Sprintf("%d@%s", size, modTime)
+}
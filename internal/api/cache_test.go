@@ -0,0 +1,129 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListCacheEntries(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	admin := ta.admin(t)
+	for _, key := range []string{"stream_a", "stream_b", "stream_c"} {
+		if _, err := ta.cache.Put(context.Background(), key, strings.NewReader("data"), 4); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := ta.do(t, http.MethodGet, "/api/v1/cache/entries?limit=2", admin, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	var listing struct {
+		Entries []struct {
+			Key  string `json:"key"`
+			Size int64  `json:"size"`
+		} `json:"entries"`
+		Pagination struct {
+			Total int `json:"total"`
+		} `json:"pagination"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &listing); err != nil {
+		t.Fatal(err)
+	}
+	if len(listing.Entries) != 2 || listing.Pagination.Total != 3 || listing.Entries[0].Size != 4 {
+		t.Errorf("got %+v, want 2 of 3 entries of 4 bytes", listing)
+	}
+
+	if w := ta.do(t, http.MethodGet, "/api/v1/cache/entries", ta.newUser(t, "user@example.com"), nil); w.Code != http.StatusForbidden {
+		t.Errorf("non-admin: got %d, want 403", w.Code)
+	}
+}
+
+func TestPurgeExpiredCacheEndpoint(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	if _, err := ta.cache.Put(context.Background(), "stream_a", strings.NewReader("data"), 4); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing has expired within the hour-long TTL
+	w := ta.do(t, http.MethodPost, "/api/v1/cache/purge-expired", ta.admin(t), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	if len(ta.cache.Entries()) != 1 {
+		t.Error("purge removed an entry that hasn't expired")
+	}
+}
+
+func TestClearCacheUsesConfiguredDir(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	temp := filepath.Join(ta.config.Cache.Dir, "temp")
+	if err := os.MkdirAll(temp, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(temp, "file1_upload"), []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w := ta.do(t, http.MethodPost, "/api/v1/cache/clear", ta.admin(t), nil)
+	var cleared struct {
+		RemovedCount int    `json:"removed_count"`
+		CacheDir     string `json:"cache_dir"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &cleared); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	if cleared.RemovedCount != 1 || cleared.CacheDir != temp {
+		t.Errorf("removed %d files from %s, want 1 from %s", cleared.RemovedCount, cleared.CacheDir, temp)
+	}
+}
+
+func TestStatsReportConfiguredCache(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	ta.config.Cache.TTL = 6 * time.Hour
+	ta.config.Cache.MaxSize = 5 << 30
+
+	w := ta.do(t, http.MethodGet, "/api/v1/stats", ta.admin(t), nil)
+	var stats struct {
+		Stats struct {
+			System struct {
+				CacheTTL     string `json:"cache_ttl"`
+				MaxCacheSize string `json:"max_cache_size"`
+			} `json:"system"`
+		} `json:"stats"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	if got := stats.Stats.System; got.CacheTTL != "6h0m0s" || got.MaxCacheSize != "5.0 GB" {
+		t.Errorf("got TTL %q and size %q, want 6h0m0s and 5.0 GB", got.CacheTTL, got.MaxCacheSize)
+	}
+}
+
+func TestRecalculateCacheEndpoint(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	if _, err := ta.cache.Put(context.Background(), "stream_a", strings.NewReader("data"), 4); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := ta.do(t, http.MethodPost, "/api/v1/cache/recalculate", ta.newUser(t, "user@example.com"), nil); w.Code != http.StatusForbidden {
+		t.Errorf("user: got %d, want 403", w.Code)
+	}
+	w := ta.do(t, http.MethodPost, "/api/v1/cache/recalculate", ta.admin(t), nil)
+	var result struct {
+		CurrentSize int64 `json:"current_size"`
+		Drift       int64 `json:"drift_bytes"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	if result.CurrentSize != 4 || result.Drift != 0 {
+		t.Errorf("got %+v, want 4 bytes without drift", result)
+	}
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/rclonestorage/internal/logging"
+	"github.com/nabilulilalbab/rclonestorage/internal/storage"
+)
+
+// Where a SHA-256 returned by GET /files/:id/checksum came from
+const (
+	checksumStored = "stored" // computed before and kept with the file
+	checksumCache  = "cache"  // hashed from the local cache
+	checksumCloud  = "cloud"  // hashed from a download of the object
+)
+
+// handleFileChecksum returns the SHA-256 of a file's content
+// @Summary Get file checksum
+// @Description Get the SHA-256 of a file's content. It is computed once, from the cache when it holds the file and from cloud storage otherwise, then kept with the file; source says which. provider=true adds the hash the provider keeps of the stored object (md5 or sha1, whichever it supports), which for encrypted files covers the ciphertext (owner or admin only)
+// @Tags files
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "File ID"
+// @Param provider query bool false "Include the provider's hash of the stored object"
+// @Success 200 {object} map[string]interface{} "File checksum"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - not file owner"
+// @Failure 404 {object} map[string]interface{} "File not found"
+// @Failure 500 {object} map[string]interface{} "Hashing failed"
+// @Router /files/{id}/checksum [get]
+func (a *API) handleFileChecksum(c *gin.Context) {
+	fileID := c.Param("id")
+	ctx := c.Request.Context()
+
+	record := a.fileRecord(fileID)
+	if record == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "File not found",
+			"file_id": fileID,
+		})
+		return
+	}
+
+	sha256, source := record.ContentHash, checksumStored
+	if sha256 == "" {
+		var err error
+		sha256, source, err = a.hashContent(ctx, fileID)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, storage.ErrObjectNotFound) {
+				status = http.StatusNotFound
+			}
+			c.JSON(status, gin.H{
+				"error":   "Failed to compute checksum",
+				"details": err.Error(),
+				"file_id": fileID,
+			})
+			return
+		}
+		if err := a.authManager.DatabaseManager.SetFileContentHash(fileID, sha256); err != nil {
+			logging.FromContext(ctx).WithField("file_id", fileID).Warnf("Failed to store content hash: %v", err)
+		}
+	}
+
+	response := gin.H{
+		"file_id":   fileID,
+		"name":      record.Filename,
+		"size":      record.Size,
+		"algorithm": storage.HashSHA256,
+		"sha256":    sha256,
+		"source":    source,
+	}
+	if c.Query("provider") == "true" {
+		response["provider_hash"] = a.providerHash(ctx, a.unionPath(record.Object()))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// hashContent computes the SHA-256 of a file from the cache when it holds the current
+// version, otherwise from a download of the object
+func (a *API) hashContent(ctx context.Context, fileID string) (string, string, error) {
+	fileInfo, err := a.getFileInfo(fileID)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", storage.ErrObjectNotFound, err)
+	}
+
+	for _, key := range []string{"download_" + fileID, "stream_" + fileID} {
+		reader, _, err := a.cache.GetValidated(ctx, key, fileInfo.cacheValidator())
+		if err != nil {
+			continue
+		}
+		sum, err := hashAll(reader, fileInfo.Size)
+		reader.Close()
+		if err == nil {
+			return sum, checksumCache, nil
+		}
+	}
+
+	reader, err := a.catPlain(ctx, fileInfo.Filename, fileInfo.sealing)
+	if err != nil {
+		return "", "", err
+	}
+	sum, err := hashAll(reader, fileInfo.Size)
+	if closeErr := reader.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to read file: %w", closeErr)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return sum, checksumCloud, nil
+}
+
+// hashAll returns the SHA-256 of r, which must yield exactly size bytes
+func hashAll(r io.Reader, size int64) (string, error) {
+	digest, err := storage.NewDigest(storage.HashSHA256)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(digest, r); err != nil {
+		return "", err
+	}
+	if digest.Size != size {
+		return "", fmt.Errorf("read %d of %d bytes", digest.Size, size)
+	}
+	return digest.Sum(storage.HashSHA256), nil
+}
+
+// providerHash returns the first of verifyAlgorithms the provider keeps for an
+// object, nil when it keeps none or can't be asked
+func (a *API) providerHash(ctx context.Context, remotePath string) gin.H {
+	for _, algorithm := range verifyAlgorithms {
+		value, err := storage.RemoteHash(ctx, a.rclone, remotePath, algorithm, false)
+		if err != nil {
+			return nil
+		}
+		if value != "" {
+			return gin.H{"algorithm": algorithm, "value": value}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// helloSHA256 is the SHA-256 of "hello"
+const helloSHA256 = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+// fileChecksum is the body of GET /files/:id/checksum
+type fileChecksum struct {
+	SHA256       string            `json:"sha256"`
+	Source       string            `json:"source"`
+	ProviderHash map[string]string `json:"provider_hash"`
+}
+
+// getChecksum asks for the checksum of fileID as owner@example.com, failing the test
+// unless it is returned
+func (ta *testAPI) getChecksum(t *testing.T, fileID, query string) fileChecksum {
+	t.Helper()
+	owner, _ := ta.db.GetUserByEmail("owner@example.com")
+	w := ta.do(t, http.MethodGet, "/api/v1/files/"+fileID+"/checksum"+query, owner, nil)
+	var checksum fileChecksum
+	if err := json.Unmarshal(w.Body.Bytes(), &checksum); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	return checksum
+}
+
+func TestFileChecksum(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	ta.rclone.hashes = true
+	owner := ta.newUser(t, "owner@example.com")
+	ta.addFile(t, owner, "file1", "hello.txt", []byte("hello"))
+
+	// Hashed from cloud storage once, then kept with the file
+	if got := ta.getChecksum(t, "file1", ""); got.SHA256 != helloSHA256 || got.Source != checksumCloud {
+		t.Errorf("first request: got %+v, want the sha256 of the cloud copy", got)
+	}
+	if record, _ := ta.db.GetFileOwnership("file1"); record.ContentHash != helloSHA256 {
+		t.Errorf("stored content hash %q, want %q", record.ContentHash, helloSHA256)
+	}
+	got := ta.getChecksum(t, "file1", "?provider=true")
+	if got.SHA256 != helloSHA256 || got.Source != checksumStored {
+		t.Errorf("second request: got %+v, want the stored sha256", got)
+	}
+	if want := "5d41402abc4b2a76b9719d911017c592"; got.ProviderHash["algorithm"] != "md5" || got.ProviderHash["value"] != want {
+		t.Errorf("provider hash: got %v, want md5 %s", got.ProviderHash, want)
+	}
+
+	other := ta.newUser(t, "other@example.com")
+	if w := ta.do(t, http.MethodGet, "/api/v1/files/file1/checksum", other, nil); w.Code != http.StatusForbidden {
+		t.Errorf("other user: got %d, want 403", w.Code)
+	}
+}
+
+func TestFileChecksumFromCache(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	owner := ta.newUser(t, "owner@example.com")
+	ta.addFile(t, owner, "file1", "hello.txt", []byte("hello"))
+
+	if w := ta.do(t, http.MethodGet, "/api/v1/download/file1", owner, nil); w.Code != http.StatusOK {
+		t.Fatalf("download: got %d", w.Code)
+	}
+	if got := ta.getChecksum(t, "file1", ""); got.SHA256 != helloSHA256 || got.Source != checksumCache {
+		t.Errorf("got %+v, want the sha256 of the cached copy", got)
+	}
+}
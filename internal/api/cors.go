@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/rclonestorage/internal/config"
+)
+
+// corsExposeHeaders are the response headers browser clients need to read, for tus
+// uploads and to correlate requests with the logs
+const corsExposeHeaders = "Location, Tus-Resumable, Tus-Version, Upload-Offset, Upload-Length, X-File-ID, X-Request-ID"
+
+// CORS answers cross-origin requests from the origins allowed in cfg. With "*" any
+// origin is allowed without credentials; otherwise a listed origin is echoed back and
+// others get no CORS headers, so browsers block them. Preflight requests end here.
+func CORS(cfg config.ServerConfig) gin.HandlerFunc {
+	allowAny := false
+	allowed := make(map[string]bool, len(cfg.CORSAllowedOrigins))
+	for _, origin := range cfg.CORSAllowedOrigins {
+		if origin == "*" {
+			allowAny = true
+		}
+		allowed[strings.ToLower(origin)] = true
+	}
+	methods := strings.Join(cfg.CORSAllowedMethods, ", ")
+	headers := strings.Join(cfg.CORSAllowedHeaders, ", ")
+	maxAge := strconv.FormatInt(int64(cfg.CORSMaxAge.Seconds()), 10)
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		permitted := true
+		switch {
+		case allowAny && !cfg.CORSAllowCredentials:
+			c.Header("Access-Control-Allow-Origin", "*")
+		case origin != "" && (allowAny || allowed[strings.ToLower(origin)]):
+			c.Header("Access-Control-Allow-Origin", origin)
+			if cfg.CORSAllowCredentials {
+				c.Header("Access-Control-Allow-Credentials", "true")
+			}
+			c.Writer.Header().Add("Vary", "Origin")
+		default:
+			c.Writer.Header().Add("Vary", "Origin")
+			permitted = false
+		}
+
+		if permitted {
+			c.Header("Access-Control-Allow-Methods", methods)
+			c.Header("Access-Control-Allow-Headers", headers)
+			c.Header("Access-Control-Expose-Headers", corsExposeHeaders)
+			if c.Request.Method == http.MethodOptions && cfg.CORSMaxAge > 0 {
+				c.Header("Access-Control-Max-Age", maxAge)
+			}
+		}
+
+		if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusOK)
+			return
+		}
+		c.Next()
+	}
+}
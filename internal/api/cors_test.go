@@ -0,0 +1,98 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/rclonestorage/internal/config"
+)
+
+// corsRequest sends a request from origin through the CORS middleware configured
+// with cfg, in front of a handler answering 204
+func corsRequest(cfg config.ServerConfig, method, origin string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/api/v1/files", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	return serve(func(r *gin.Engine) {
+		r.Use(CORS(cfg))
+		r.Any("/api/v1/files", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	}, req)
+}
+
+func TestCORS(t *testing.T) {
+	allowlist := config.ServerConfig{
+		CORSAllowedOrigins:   []string{"https://app.example.com"},
+		CORSAllowCredentials: true,
+		CORSAllowedMethods:   []string{"GET", "POST"},
+		CORSAllowedHeaders:   []string{"Authorization"},
+		CORSMaxAge:           time.Hour,
+	}
+	wildcard := config.ServerConfig{CORSAllowedOrigins: []string{"*"}, CORSAllowedMethods: []string{"GET"}}
+
+	for _, tt := range []struct {
+		name        string
+		cfg         config.ServerConfig
+		origin      string
+		allowOrigin string
+		credentials string
+	}{
+		{"wildcard", wildcard, "https://anywhere.example.com", "*", ""},
+		{"listed origin", allowlist, "https://app.example.com", "https://app.example.com", "true"},
+		{"listed origin, other case", allowlist, "https://APP.example.com", "https://APP.example.com", "true"},
+		{"unlisted origin", allowlist, "https://evil.example.com", "", ""},
+		{"no origin", allowlist, "", "", ""},
+	} {
+		w := corsRequest(tt.cfg, http.MethodGet, tt.origin)
+		if w.Code != http.StatusNoContent {
+			t.Errorf("%s: got %d, want the request served", tt.name, w.Code)
+		}
+		header := w.Header()
+		if got := header.Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+			t.Errorf("%s: got Allow-Origin %q, want %q", tt.name, got, tt.allowOrigin)
+		}
+		if got := header.Get("Access-Control-Allow-Credentials"); got != tt.credentials {
+			t.Errorf("%s: got Allow-Credentials %q, want %q", tt.name, got, tt.credentials)
+		}
+		if allowed := tt.allowOrigin != ""; (header.Get("Access-Control-Allow-Methods") != "") != allowed {
+			t.Errorf("%s: got Allow-Methods %q", tt.name, header.Get("Access-Control-Allow-Methods"))
+		}
+		// Responses that depend on the origin must not be shared across origins by caches
+		if varies := header.Get("Vary") == "Origin"; varies != (tt.allowOrigin != "*") {
+			t.Errorf("%s: got Vary %q", tt.name, header.Get("Vary"))
+		}
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	cfg := config.ServerConfig{
+		CORSAllowedOrigins: []string{"https://app.example.com"},
+		CORSAllowedMethods: []string{"GET", "POST"},
+		CORSAllowedHeaders: []string{"Authorization", "Tus-Resumable"},
+		CORSMaxAge:         time.Hour,
+	}
+
+	w := corsRequest(cfg, http.MethodOptions, "https://app.example.com")
+	if w.Code != http.StatusOK {
+		t.Errorf("got %d, want the preflight answered with 200", w.Code)
+	}
+	for header, want := range map[string]string{
+		"Access-Control-Allow-Origin":  "https://app.example.com",
+		"Access-Control-Allow-Methods": "GET, POST",
+		"Access-Control-Allow-Headers": "Authorization, Tus-Resumable",
+		"Access-Control-Max-Age":       "3600",
+	} {
+		if got := w.Header().Get(header); got != want {
+			t.Errorf("%s: got %q, want %q", header, got, want)
+		}
+	}
+
+	// Disallowed origins get an answer without CORS headers, so the browser blocks them
+	w = corsRequest(cfg, http.MethodOptions, "https://evil.example.com")
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "" || w.Header().Get("Access-Control-Max-Age") != "" {
+		t.Errorf("disallowed origin: got %d with %v", w.Code, w.Header())
+	}
+}
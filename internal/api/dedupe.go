@@ -0,0 +1,62 @@
+package api
+
+import (
+	"context"
+	"io"
+
+	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+	"github.com/nabilulilalbab/rclonestorage/internal/logging"
+	"github.com/nabilulilalbab/rclonestorage/internal/storage"
+)
+
+// UPLOAD_DEDUPLICATE modes
+const (
+	dedupeOff  = "off"
+	dedupeUser = "user"
+	dedupeAll  = "all"
+)
+
+// findDuplicate hashes an upload and looks for a stored file with the same content,
+// among the uploader's files or everyone's per UPLOAD_DEDUPLICATE. The duplicate is
+// nil when there is none or its object has gone missing from cloud storage.
+func (a *API) findDuplicate(ctx context.Context, user *auth.User, content io.Reader, size int64) *auth.FileOwnership {
+	mode := a.config.Storage.Deduplicate
+	if mode == dedupeOff {
+		return nil
+	}
+
+	contentHash, err := storage.HashReader(content, "sha256")
+	if err != nil {
+		logging.FromContext(ctx).Warnf("Failed to hash upload: %v", err)
+		return nil
+	}
+	userID := user.ID
+	if mode == dedupeAll {
+		userID = 0
+	}
+	original, err := a.authManager.DatabaseManager.FindDuplicate(contentHash, size, userID)
+	if err != nil {
+		return nil
+	}
+	// Only share an object stored the way this upload would be, encrypted with the
+	// current key or in the clear
+	if original.EncryptionKeyID != a.currentKeyID() {
+		return nil
+	}
+
+	// Don't point a new file at an object the database only thinks exists
+	object, err := a.statObject(ctx, original.Provider, original.Object())
+	if err != nil || object.Size != storedSize(original) {
+		return nil
+	}
+	return original
+}
+
+// recordDuplicate records fileID as a new file sharing the object of original
+func (a *API) recordDuplicate(user *auth.User, fileID, filename string, original *auth.FileOwnership) error {
+	if err := a.authManager.DatabaseManager.CreateSharedFileOwnership(user.ID, fileID, filename, original); err != nil {
+		return err
+	}
+	a.uploadRecorded(user, fileID, original.Size)
+	return nil
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// uploadedFile uploads content as the user with email, created on first use, and
+// returns the file ID and whether the upload was deduplicated
+func uploadedFile(t *testing.T, ta *testAPI, email, filename, content string) (string, bool) {
+	t.Helper()
+	user, err := ta.db.GetUserByEmail(email)
+	if err != nil {
+		user = ta.newUser(t, email)
+	}
+	w := ta.upload(t, user, filename, []byte(content), "")
+	var uploaded struct {
+		FileID       string `json:"file_id"`
+		Deduplicated bool   `json:"deduplicated"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &uploaded); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("upload of %s: got %d: %s", filename, w.Code, w.Body.String())
+	}
+	return uploaded.FileID, uploaded.Deduplicated
+}
+
+func TestUploadDeduplicates(t *testing.T) {
+	for _, tt := range []struct {
+		mode        string
+		wantShared  []bool // for each upload: by the owner, again by the owner, by another user
+		wantObjects int
+	}{
+		{dedupeOff, []bool{false, false, false}, 3},
+		{dedupeUser, []bool{false, true, false}, 2},
+		{dedupeAll, []bool{false, true, true}, 1},
+	} {
+		ta := newTestAPI(t, nil)
+		ta.config.Storage.Deduplicate = tt.mode
+
+		var got []bool
+		for _, upload := range []struct{ email, filename string }{
+			{"owner@example.com", "a.txt"},
+			{"owner@example.com", "copy of a.txt"},
+			{"other@example.com", "b.txt"},
+		} {
+			_, shared := uploadedFile(t, ta, upload.email, upload.filename, "the same content")
+			got = append(got, shared)
+		}
+		for i := range got {
+			if got[i] != tt.wantShared[i] {
+				t.Errorf("%s: got deduplicated %v, want %v", tt.mode, got, tt.wantShared)
+				break
+			}
+		}
+		if objects, err := ta.listObjects(context.Background()); err != nil || len(objects) != tt.wantObjects {
+			t.Errorf("%s: %d objects stored (%v), want %d", tt.mode, len(objects), err, tt.wantObjects)
+		}
+
+		// The owner is charged once for both files sharing an object
+		owner, _ := ta.db.GetUserByEmail("owner@example.com")
+		wantUsed := int64(len("the same content"))
+		if tt.mode == dedupeOff {
+			wantUsed *= 2
+		}
+		if owner.StorageUsed != wantUsed {
+			t.Errorf("%s: owner uses %d bytes, want %d", tt.mode, owner.StorageUsed, wantUsed)
+		}
+	}
+}
+
+func TestDeleteDeduplicatedFiles(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	ta.config.Storage.Deduplicate = dedupeAll
+	first, _ := uploadedFile(t, ta, "owner@example.com", "a.txt", "shared content")
+	second, _ := uploadedFile(t, ta, "other@example.com", "b.txt", "shared content")
+	owner, _ := ta.db.GetUserByEmail("owner@example.com")
+	other, _ := ta.db.GetUserByEmail("other@example.com")
+
+	if w := ta.do(t, http.MethodDelete, "/api/v1/files/"+first, owner, nil); w.Code != http.StatusOK {
+		t.Fatalf("delete of the original: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := ta.do(t, http.MethodGet, "/api/v1/download/"+second, other, nil); w.Code != http.StatusOK || w.Body.String() != "shared content" {
+		t.Errorf("download of the duplicate: got %d %q", w.Code, w.Body.String())
+	}
+	if owner, _ := ta.db.GetUserByID(owner.ID); owner.StorageUsed != 0 {
+		t.Errorf("owner uses %d bytes after the delete, want 0", owner.StorageUsed)
+	}
+
+	if w := ta.do(t, http.MethodDelete, "/api/v1/files/"+second, other, nil); w.Code != http.StatusOK {
+		t.Fatalf("delete of the duplicate: got %d: %s", w.Code, w.Body.String())
+	}
+	if objects, err := ta.listObjects(context.Background()); err != nil || len(objects) != 0 {
+		t.Errorf("%d objects left (%v), want the shared one removed with its last file", len(objects), err)
+	}
+}
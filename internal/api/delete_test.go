@@ -0,0 +1,163 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nabilulilalbab/rclonestorage/internal/jobs"
+)
+
+func TestDeleteFileReleasesQuota(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	mem := useMemProvider(t, ta)
+	user := ta.newUser(t, "owner@example.com")
+	if err := ta.db.CreateFileOwnership(user.ID, "file1", "a.txt", mem.Name(), 5, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	key := ta.objectKey("file1_a.txt")
+	mem.put(key, []byte("hello"))
+
+	w := ta.do(t, http.MethodDelete, "/api/v1/files/file1", user, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	if _, ok := mem.object(key); ok {
+		t.Error("object still stored")
+	}
+	if _, err := ta.db.GetFileOwnership("file1"); err == nil {
+		t.Error("ownership record still exists")
+	}
+	if user, _ := ta.db.GetUserByID(user.ID); user.StorageUsed != 0 {
+		t.Errorf("storage used %d, want 0", user.StorageUsed)
+	}
+}
+
+func TestDeleteFileRetriesFailedRemoval(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	mem := useMemProvider(t, ta)
+	ta.jobs.SetRetryPolicy(jobs.TypeDelete, jobs.RetryPolicy{MaxAttempts: 5, Backoff: 50 * time.Millisecond})
+	user := ta.newUser(t, "owner@example.com")
+	if err := ta.db.CreateFileOwnership(user.ID, "file1", "a.txt", mem.Name(), 5, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	key := ta.objectKey("file1_a.txt")
+	mem.put(key, []byte("hello"))
+	mem.failDeletes(errors.New("remote unreachable"))
+
+	// The record and quota go at once, the object once the remote is back
+	w := ta.do(t, http.MethodDelete, "/api/v1/files/file1", user, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		Status       string `json:"status"`
+		RemovalJobID string `json:"removal_job_id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != "removal_pending" || response.RemovalJobID == "" {
+		t.Fatalf("got status %q, job %q, want a pending removal", response.Status, response.RemovalJobID)
+	}
+	if _, err := ta.db.GetFileOwnership("file1"); err == nil {
+		t.Error("ownership record still exists")
+	}
+	if user, _ := ta.db.GetUserByID(user.ID); user.StorageUsed != 0 {
+		t.Errorf("storage used %d, want 0", user.StorageUsed)
+	}
+
+	mem.failDeletes(nil)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := ta.jobs.Get(response.RemovalJobID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status == jobs.StatusCompleted {
+			break
+		}
+		if job.Status == jobs.StatusFailed || time.Now().After(deadline) {
+			t.Fatalf("removal job %s: %s", job.Status, job.Error)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, ok := mem.object(key); ok {
+		t.Error("object still stored after the retried removal")
+	}
+}
+
+func TestDeleteSharedFileKeepsObject(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	mem := useMemProvider(t, ta)
+	owner := ta.newUser(t, "owner@example.com")
+	other := ta.newUser(t, "other@example.com")
+	if err := ta.db.CreateFileOwnership(owner.ID, "file1", "a.txt", mem.Name(), 5, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	original, _ := ta.db.GetFileOwnership("file1")
+	if err := ta.db.CreateSharedFileOwnership(other.ID, "file2", "b.txt", original); err != nil {
+		t.Fatal(err)
+	}
+	key := ta.objectKey("file1_a.txt")
+	mem.put(key, []byte("hello"))
+
+	if w := ta.do(t, http.MethodDelete, "/api/v1/files/file1", owner, nil); w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	if _, ok := mem.object(key); !ok {
+		t.Error("object removed while file2 still uses it")
+	}
+	if w := ta.do(t, http.MethodGet, "/api/v1/download/file2", other, nil); w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Errorf("download of file2: got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestDeleteOrphanObjectNeedsOwnershipRecord(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	ta.config.Storage.DeleteRequireOwnership = true
+	mem := useMemProvider(t, ta)
+	admin := ta.admin(t)
+	key := ta.objectKey("orphan_a.txt")
+	mem.put(key, []byte("out of band"))
+
+	if w := ta.do(t, http.MethodDelete, "/api/v1/files/orphan", admin, nil); w.Code != http.StatusNotFound {
+		t.Errorf("got %d, want 404 for an object without a record", w.Code)
+	}
+	if _, ok := mem.object(key); !ok {
+		t.Fatal("object without a record was deleted")
+	}
+
+	ta.config.Storage.DeleteRequireOwnership = false
+	if w := ta.do(t, http.MethodDelete, "/api/v1/files/orphan", admin, nil); w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	if _, ok := mem.object(key); ok {
+		t.Error("object still stored with the requirement off")
+	}
+}
+
+func TestFailedUploadLeavesNoQuota(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	mem := useMemProvider(t, ta)
+	user := ta.newUser(t, "owner@example.com")
+
+	// The record was created before the upload failed
+	if err := ta.db.CreateFileOwnership(user.ID, "file1", "a.txt", mem.Name(), 5, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The staged file is gone, so every attempt to store it fails
+	job := ta.queueUpload(user, "file1", "a.txt", 5, filepath.Join(t.TempDir(), "missing"), mem.Name(), "memory:uploads/file1_a.txt")
+	ta.waitForJob(t, job.ID, jobs.StatusFailed)
+
+	if _, err := ta.db.GetFileOwnership("file1"); err == nil {
+		t.Error("failed upload left its ownership record")
+	}
+	if user, _ := ta.db.GetUserByID(user.ID); user.StorageUsed != 0 {
+		t.Errorf("storage used %d after a failed upload, want 0", user.StorageUsed)
+	}
+}
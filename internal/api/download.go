@@ -2,27 +2,40 @@ package api
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/rclonestorage/internal/auth"
 	"github.com/nabilulilalbab/rclonestorage/internal/cache"
+	"github.com/nabilulilalbab/rclonestorage/internal/logging"
 )
 
 // handleDownload handles file download with caching
 // @Summary Download file
-// @Description Download a file from storage with caching support
+// @Description Download a file from storage with caching support (requires ownership or admin). Range requests are honored for cached files, letting clients resume interrupted downloads. Cached copies are checked against the size and modification time of the cloud object, so a replaced file is fetched again
 // @Tags files
 // @Produce application/octet-stream
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param id path string true "File ID"
+// @Param redirect query bool false "Redirect to a direct provider URL when supported"
+// @Param download query bool false "Serve as an attachment, overriding DOWNLOAD_DISPOSITION"
+// @Param inline query bool false "Serve inline, overriding DOWNLOAD_DISPOSITION. Active content such as HTML or SVG is always an attachment"
+// @Param disposition query string false "inline or attachment, overriding download, inline and DOWNLOAD_DISPOSITION"
+// @Param Range header string false "Range header for partial content, honored on cache hits"
 // @Success 200 {file} file "File content"
+// @Success 206 {file} file "Partial content"
+// @Success 302 {string} string "Redirect to direct provider URL"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - not file owner"
 // @Failure 404 {object} map[string]interface{} "File not found"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /download/{id} [get]
@@ -30,67 +43,163 @@ func (a *API) handleDownload(c *gin.Context) {
 	fileID := c.Param("id")
 	
 	// Try to get from cache first
-	cacheManager, err := cache.NewManager("./cache", 24*time.Hour, 10*1024*1024*1024) // 10GB
-	if err != nil {
+	cacheManager := a.cache
+	
+	cacheKey := fmt.Sprintf("download_%s", fileID)
+	record := a.fileRecord(fileID)
+	
+	// List files to find the actual filename, and what's cached is checked against
+	// the listed object so a replaced file isn't served stale
+	targetFile, listErr := a.findObject(c.Request.Context(), fileID, record)
+	
+	// Encrypted objects are larger than their content, size is the content's
+	sealed := fileSealing(record)
+	var size int64
+	if targetFile != nil {
+		size = targetFile.Size
+		if sealed != nil {
+			size = sealed.size
+		}
+	}
+	
+	// Check cache first, when the cloud can't be listed the cached copy is served as is
+	validator := ""
+	if targetFile != nil {
+		validator = cacheValidator(size, targetFile.ModTime.Format(time.RFC3339Nano))
+	}
+	if listErr != nil || targetFile != nil {
+		if reader, entry, err := cacheManager.GetValidated(context.Background(), cacheKey, validator); err == nil {
+			defer reader.Close()
+			
+			// Serve from cache, named like a miss even without an ownership record
+			objectName := ""
+			if record != nil {
+				objectName = fmt.Sprintf("%s_%s", fileID, record.Filename)
+			} else if targetFile != nil {
+				objectName = targetFile.Name
+			}
+			a.setDownloadHeaders(c, objectName, record)
+			c.Header("X-Cache", "HIT")
+			
+			// Cached files are local, so resumed downloads seek straight to the range
+			http.ServeContent(c.Writer, c.Request, objectName, entry.CreatedAt, reader.(io.ReadSeeker))
+			return
+		}
+	}
+	
+	// Cache miss - download from cloud
+	c.Header("X-Cache", "MISS")
+	
+	if listErr != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to initialize cache",
+			"error": "Failed to list files from cloud",
+			"details": listErr.Error(),
 		})
 		return
 	}
 	
-	cacheKey := fmt.Sprintf("download_%s", fileID)
-	
-	// Check cache first
-	if reader, entry, err := cacheManager.Get(context.Background(), cacheKey); err == nil {
-		defer reader.Close()
-		
-		// Serve from cache
-		c.Header("Content-Type", "application/octet-stream")
-		c.Header("Content-Length", strconv.FormatInt(entry.Size, 10))
-		c.Header("X-Cache", "HIT")
-		
-		io.Copy(c.Writer, reader)
+	if targetFile == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "File not found",
+			"file_id": fileID,
+		})
 		return
 	}
 	
-	// Cache miss - download from cloud
-	c.Header("X-Cache", "MISS")
+	filename := targetFile.Name
 	
-	// List files to find the actual filename
-	cmd := exec.Command("rclone", "lsjson", "union:uploads/")
-	if a.config.Rclone.ConfigPath != "" {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("RCLONE_CONFIG=%s", a.config.Rclone.ConfigPath))
+	// Let link-capable providers serve the bytes when the caller opts in, encrypted
+	// objects are only readable through the server
+	if sealed == nil && a.wantsRedirect(c) {
+		if url, err := a.directURL(c.Request.Context(), filename); err == nil {
+			c.Header("X-Cache", "REDIRECT")
+			c.Redirect(http.StatusFound, url)
+			return
+		}
 	}
 	
-	output, err := cmd.Output()
+	// Download from cloud storage
+	body, err := a.openObject(c.Request.Context(), filename, nil)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to list files from cloud",
+			"error": "Failed to download file from cloud",
 			"details": err.Error(),
 		})
 		return
 	}
+	defer body.Close()
 	
-	// Parse JSON output to find our file
-	var files []map[string]interface{}
-	if err := json.Unmarshal(output, &files); err != nil {
+	// Files over the per-entry limit are streamed straight through without caching
+	if !cacheManager.CanCache(size) {
+		a.downloadBypassCache(c, body, filename, size, record)
+		return
+	}
+	
+	content, err := a.unseal(body, sealed)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to parse file list",
+			"error": "Failed to decrypt file",
+			"details": err.Error(),
 		})
 		return
 	}
 	
-	var targetFile map[string]interface{}
-	for _, file := range files {
-		if name, ok := file["Name"].(string); ok {
-			if strings.HasPrefix(name, fileID+"_") {
-				targetFile = file
-				break
+	// Serve the file
+	a.setDownloadHeaders(c, filename, record)
+	c.Header("Content-Length", strconv.FormatInt(size, 10))
+	c.Header("X-Cache", "MISS")
+	c.Status(http.StatusOK)
+	
+	// Stage the file into the cache while it is sent instead of holding it in memory,
+	// the cached copy is only kept if the whole file came through
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pending, err := cacheManager.Stage(context.Background(), cacheKey, pr, size)
+		if err != nil {
+			// Keep draining so the download isn't held up by the cache
+			if errors.Is(err, cache.ErrWriteFailed) {
+				logging.FromContext(c.Request.Context()).WithField("file_id", fileID).Warnf("Failed to cache file: %v", err)
 			}
+			io.Copy(io.Discard, pr)
+			return
 		}
-	}
+		if pending.Size() != size {
+			cacheManager.Discard(pending)
+			return
+		}
+		pending.SetValidator(validator)
+		if _, err := cacheManager.Commit(pending); err != nil {
+			logging.FromContext(c.Request.Context()).WithField("file_id", fileID).Warnf("Failed to cache file: %v", err)
+		}
+	}()
 	
-	if targetFile == nil {
+	_, err = io.Copy(c.Writer, io.TeeReader(content, pw))
+	pw.CloseWithError(err)
+	<-done
+}
+
+// handleDownloadHead answers the probe download managers send before downloading
+// @Summary Probe download
+// @Description Return the headers of GET /download/{id} (Content-Type, Content-Disposition, Content-Length, Accept-Ranges) without a body. Ranges are advertised when the file is cached, as only cached downloads honor them
+// @Tags files
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "File ID"
+// @Param download query bool false "Serve as an attachment, overriding DOWNLOAD_DISPOSITION"
+// @Param inline query bool false "Serve inline, overriding DOWNLOAD_DISPOSITION"
+// @Param disposition query string false "inline or attachment, overriding download, inline and DOWNLOAD_DISPOSITION"
+// @Success 200 "Download headers"
+// @Failure 401 "Unauthorized"
+// @Failure 403 "Forbidden - not file owner"
+// @Failure 404 "File not found"
+// @Router /download/{id} [head]
+func (a *API) handleDownloadHead(c *gin.Context) {
+	fileID := c.Param("id")
+	
+	fileInfo, err := a.getFileInfo(fileID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": "File not found",
 			"file_id": fileID,
@@ -98,141 +207,333 @@ func (a *API) handleDownload(c *gin.Context) {
 		return
 	}
 	
-	filename := targetFile["Name"].(string)
-	// size := int64(targetFile["Size"].(float64)) // Not needed anymore
-	
-	// Download from cloud using rclone cat
-	cmd = exec.Command("rclone", "cat", fmt.Sprintf("union:uploads/%s", filename))
-	if a.config.Rclone.ConfigPath != "" {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("RCLONE_CONFIG=%s", a.config.Rclone.ConfigPath))
+	acceptRanges := "none"
+	if a.cache.Has(fmt.Sprintf("download_%s", fileID), fileInfo.cacheValidator()) {
+		acceptRanges = "bytes"
 	}
 	
-	// Get the file content
-	fileContent, err := cmd.Output()
+	a.setDownloadHeaders(c, fileInfo.Filename, a.fileRecord(fileID))
+	c.Header("Content-Length", strconv.FormatInt(fileInfo.Size, 10))
+	c.Header("Accept-Ranges", acceptRanges)
+	c.Status(http.StatusOK)
+}
+
+// Content-Disposition types
+const (
+	dispositionAttachment = "attachment"
+	dispositionInline     = "inline"
+)
+
+// activeContentTypes can run script when rendered by a browser, so they are never
+// served inline from the API's origin
+var activeContentTypes = map[string]bool{
+	"text/html":              true,
+	"application/xhtml+xml":  true,
+	"image/svg+xml":          true,
+	"text/xml":               true,
+	"application/xml":        true,
+	"text/javascript":        true,
+	"application/javascript": true,
+}
+
+// downloadMimeType returns the content type of a stored object, preferring the
+// ownership record and falling back to the file extension
+func downloadMimeType(objectName string, record *auth.FileOwnership) string {
+	if record != nil && record.MimeType != "" {
+		return record.MimeType
+	}
+	if mimeType := extensionType(objectName); mimeType != "" {
+		return mimeType
+	}
+	return "application/octet-stream"
+}
+
+// queryFlag returns the value of a boolean query flag and whether it was given,
+// treating a bare ?name as true
+func queryFlag(c *gin.Context, name string) (bool, bool) {
+	value, ok := c.GetQuery(name)
+	if !ok {
+		return false, false
+	}
+	if value == "" {
+		return true, true
+	}
+	set, err := strconv.ParseBool(value)
+	return set, err == nil
+}
+
+// dispositionType picks the Content-Disposition type of a download:
+// ?disposition=inline|attachment, ?download or ?inline override DOWNLOAD_DISPOSITION,
+// in that order of precedence. Active content is always an attachment.
+func (a *API) dispositionType(c *gin.Context, mimeType string) string {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil || activeContentTypes[mediaType] {
+		return dispositionAttachment
+	}
+
+	switch disposition := strings.ToLower(c.Query("disposition")); disposition {
+	case dispositionAttachment, dispositionInline:
+		return disposition
+	}
+
+	if download, ok := queryFlag(c, "download"); ok {
+		if download {
+			return dispositionAttachment
+		}
+		return dispositionInline
+	}
+	if inline, ok := queryFlag(c, "inline"); ok {
+		if inline {
+			return dispositionInline
+		}
+		return dispositionAttachment
+	}
+
+	if a.config.Storage.DownloadDisposition == dispositionInline {
+		return dispositionInline
+	}
+	return dispositionAttachment
+}
+
+// setDownloadHeaders sets the content type and disposition of a download and returns
+// the content type. objectName may be empty when the stored name is unknown.
+func (a *API) setDownloadHeaders(c *gin.Context, objectName string, record *auth.FileOwnership) string {
+	mimeType := downloadMimeType(objectName, record)
+	disposition := a.dispositionType(c, mimeType)
+	if objectName != "" {
+		disposition = contentDisposition(disposition, uploadedName(objectName, record))
+	}
+
+	c.Header("Content-Type", mimeType)
+	c.Header("Content-Disposition", disposition)
+	// Stop browsers from sniffing an inline file into an active type
+	c.Header("X-Content-Type-Options", "nosniff")
+	return mimeType
+}
+
+// contentDisposition formats a Content-Disposition header saving the file as name.
+// Non-ASCII names are sent RFC 5987 encoded in filename*, with an ASCII filename for
+// clients that don't read it.
+func contentDisposition(dispositionType, name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	header := mime.FormatMediaType(dispositionType, map[string]string{"filename": name})
+	if header == "" {
+		return dispositionType
+	}
+	if !strings.HasPrefix(header, dispositionType+"; filename*=") {
+		return header
+	}
+
+	fallback := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, name)
+	return fmt.Sprintf("%s; filename=%q; %s", dispositionType, fallback, strings.TrimPrefix(header, dispositionType+"; "))
+}
+
+// noRedirectKey marks a request that must be proxied whatever it asks for
+const noRedirectKey = "no_redirect"
+
+// wantsRedirect reports whether the caller opted into a redirect to a direct provider URL
+func (a *API) wantsRedirect(c *gin.Context) bool {
+	if !a.config.Storage.DirectURLs || c.GetBool(noRedirectKey) {
+		return false
+	}
+	redirect, _ := strconv.ParseBool(c.Query("redirect"))
+	return redirect
+}
+
+// directURL asks the providers for a time-limited direct URL to a stored file.
+// It fails for providers without link support (e.g. Mega), letting callers fall back to proxying.
+func (a *API) directURL(ctx context.Context, filename string) (string, error) {
+	url, err := a.storage.GetURL(ctx, a.objectKey(filename), a.config.Storage.DirectURLExpiry)
+	if err != nil {
+		return "", fmt.Errorf("direct URL not available: %w", err)
+	}
+
+	if url == "" {
+		return "", fmt.Errorf("direct URL not available")
+	}
+	return url, nil
+}
+
+// downloadBypassCache streams a file from cloud directly to the client without caching it
+func (a *API) downloadBypassCache(c *gin.Context, body io.ReadCloser, filename string, size int64, record *auth.FileOwnership) {
+	content, err := a.unseal(body, fileSealing(record))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to download file from cloud",
+			"error":   "Failed to decrypt file",
 			"details": err.Error(),
 		})
 		return
 	}
-	
-	// Cache the file content
-	go func() {
-		// Create a reader from the content for caching
-		contentReader := strings.NewReader(string(fileContent))
-		if _, err := cacheManager.Put(context.Background(), cacheKey, contentReader, int64(len(fileContent))); err != nil {
-			// Log error but don't fail the request
-			fmt.Printf("Failed to cache file %s: %v\n", fileID, err)
-		}
-	}()
-	
-	// Serve the file
-	c.Header("Content-Type", "application/octet-stream")
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
-	c.Header("Content-Length", strconv.Itoa(len(fileContent)))
-	c.Header("X-Cache", "MISS")
-	
-	c.Data(http.StatusOK, "application/octet-stream", fileContent)
+
+	a.setDownloadHeaders(c, filename, record)
+	c.Header("Content-Length", strconv.FormatInt(size, 10))
+	c.Header("X-Cache", "BYPASS")
+	c.Status(http.StatusOK)
+
+	io.Copy(c.Writer, content)
 }
 
-// handleListFiles handles listing files from cloud storage
+// handleListFiles handles listing files from the configured listing source
 // @Summary List files
-// @Description Get list of files with optional filtering and pagination
+// @Description Get a page of files from the ownership database (default) or cloud storage, falling back to the other source on failure. Admins see every file, other users only their own. search matches the original filename case-insensitively, total and total_size cover every matching file. reconcile=true adds the differences between the two sources (admin only)
 // @Tags files
 // @Accept json
 // @Produce json
 // @Param page query int false "Page number" default(1)
 // @Param limit query int false "Items per page" default(20)
-// @Param search query string false "Search term"
+// @Param search query string false "Case-insensitive substring of the filename"
+// @Param sort query string false "Sort field (name, size, date or modified, type)"
+// @Param order query string false "Sort order (asc, desc)"
+// @Param source query string false "Listing source (db, cloud), defaults to LIST_SOURCE"
+// @Param reconcile query bool false "Include discrepancies between the database and cloud storage (admin only)"
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Success 200 {object} map[string]interface{} "List of files"
+// @Failure 400 {object} map[string]interface{} "Invalid sort parameters"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
 // @Router /files [get]
 func (a *API) handleListFiles(c *gin.Context) {
-	// List files from union storage using rclone
-	cmd := exec.Command("rclone", "lsjson", "union:uploads/")
-	if a.config.Rclone.ConfigPath != "" {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("RCLONE_CONFIG=%s", a.config.Rclone.ConfigPath))
-	}
-	
-	output, err := cmd.Output()
+	sortField, sortOrder, err := a.listSort(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to list files from cloud storage",
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid sort parameters",
 			"details": err.Error(),
 		})
 		return
 	}
-	
-	// Parse JSON output
-	var rcloneFiles []map[string]interface{}
-	if err := json.Unmarshal(output, &rcloneFiles); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to parse file list",
-			"details": err.Error(),
+
+	source := c.DefaultQuery("source", a.config.Listing.Source)
+	if source != listSourceDB && source != listSourceCloud {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid listing source",
+			"details": "source must be db or cloud",
 		})
 		return
 	}
-	
-	// Convert to our format
-	var files []gin.H
-	var totalSize int64
-	
-	for _, file := range rcloneFiles {
-		name := file["Name"].(string)
-		size := int64(file["Size"].(float64))
-		modTime := file["ModTime"].(string)
-		
-		// Extract file ID from filename (format: fileID_originalname)
-		parts := strings.SplitN(name, "_", 2)
-		fileID := parts[0]
-		originalName := name
-		if len(parts) > 1 {
-			originalName = parts[1]
+
+	// Only admins see every file, other users get their own
+	admin := auth.IsAdmin(c)
+	var filter auth.FileFilter
+	if !admin {
+		userID, exists := auth.GetCurrentUserID(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Authentication required",
+			})
+			return
 		}
-		
-		files = append(files, gin.H{
-			"id":           fileID,
-			"name":         originalName,
-			"filename":     name,
-			"size":         size,
-			"modified":     modTime,
-			"provider":     "union",
-			"downloadable": true,
+		filter.UserID = userID
+	}
+	reconcile := admin && c.Query("reconcile") == "true"
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+
+	dbFiles, dbErr := a.dbEntries(filter)
+	var cloudFiles []gin.H
+	var cloudErr error
+	if source == listSourceCloud || dbErr != nil || reconcile {
+		cloudFiles, cloudErr = a.cloudEntries()
+	}
+
+	// Use the requested source, falling back to the other one when it fails
+	var files []gin.H
+	servedFrom := source
+	switch {
+	case source == listSourceDB && dbErr == nil:
+		files = dbFiles
+	case source == listSourceCloud && cloudErr == nil && (admin || dbErr == nil):
+		files = enrichEntries(cloudFiles, dbFiles)
+	case dbErr == nil:
+		files, servedFrom = dbFiles, listSourceDB
+	case cloudErr == nil && admin:
+		// Without the database the owners of cloud files are unknown
+		files, servedFrom = cloudFiles, listSourceCloud
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to list files",
+			"details": fmt.Sprintf("database: %v; cloud storage: %v", dbErr, cloudErr),
 		})
-		
-		totalSize += size
+		return
 	}
-	
-	c.JSON(http.StatusOK, gin.H{
+
+	if !admin {
+		files = ownedEntries(files, filter.UserID)
+	}
+	if search := c.Query("search"); search != "" {
+		files = matchingEntries(files, search)
+	}
+
+	var totalSize int64
+	for _, file := range files {
+		totalSize += file["size"].(int64)
+	}
+
+	sortFiles(files, sortField, sortOrder)
+
+	total := len(files)
+	start := min((page-1)*limit, total)
+	end := min(start+limit, total)
+
+	response := gin.H{
 		"message":    "Files listed successfully",
-		"files":      files,
-		"total":      len(files),
+		"files":      files[start:end],
+		"total":      total,
 		"total_size": totalSize,
-		"provider":   "union (mega1 + mega2 + mega3 + gdrive)",
-		"source":     "cloud_storage",
-	})
+		"pagination": gin.H{
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+			"total_pages": (total + limit - 1) / limit,
+		},
+		"provider":   fmt.Sprintf("union (%s)", strings.Join(a.providerNames(), " + ")),
+		"source":     servedFrom,
+		"fallback":   servedFrom != source,
+		"sort":       sortField,
+		"order":      sortOrder,
+	}
+	if reconcile {
+		if dbErr != nil || cloudErr != nil {
+			response["reconcile_error"] = "both sources are required to reconcile"
+		} else {
+			response["reconcile"] = reconcileEntries(dbFiles, cloudFiles)
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
 // handleGetFile handles getting file info from cloud storage
 // @Summary Get file info
-// @Description Get detailed information about a specific file
+// @Description Get detailed information about a specific file (owner or admin only, anyone for public files)
 // @Tags files
 // @Accept json
 // @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param id path string true "File ID"
 // @Success 200 {object} map[string]interface{} "File information"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - not file owner"
 // @Failure 404 {object} map[string]interface{} "File not found"
 // @Router /files/{id} [get]
 func (a *API) handleGetFile(c *gin.Context) {
 	fileID := c.Param("id")
 	
-	// List files from union storage to find our file
-	cmd := exec.Command("rclone", "lsjson", "union:uploads/")
-	if a.config.Rclone.ConfigPath != "" {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("RCLONE_CONFIG=%s", a.config.Rclone.ConfigPath))
-	}
-	
-	output, err := cmd.Output()
+	// Find our file in cloud storage
+	record := a.fileRecord(fileID)
+	targetFile, err := a.findObject(c.Request.Context(), fileID, record)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to access cloud storage",
@@ -241,27 +542,6 @@ func (a *API) handleGetFile(c *gin.Context) {
 		return
 	}
 	
-	// Parse JSON output
-	var rcloneFiles []map[string]interface{}
-	if err := json.Unmarshal(output, &rcloneFiles); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to parse file list",
-			"details": err.Error(),
-		})
-		return
-	}
-	
-	// Find our file
-	var targetFile map[string]interface{}
-	for _, file := range rcloneFiles {
-		if name, ok := file["Name"].(string); ok {
-			if strings.HasPrefix(name, fileID+"_") {
-				targetFile = file
-				break
-			}
-		}
-	}
-	
 	if targetFile == nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": "File not found",
@@ -271,39 +551,39 @@ func (a *API) handleGetFile(c *gin.Context) {
 	}
 	
 	// Extract file information
-	filename := targetFile["Name"].(string)
-	size := int64(targetFile["Size"].(float64))
-	modTime := targetFile["ModTime"].(string)
-	isDir := targetFile["IsDir"].(bool)
-	
-	// Extract original name
-	parts := strings.SplitN(filename, "_", 2)
-	originalName := filename
-	if len(parts) > 1 {
-		originalName = parts[1]
+	filename := targetFile.Name
+	size := targetFile.Size
+	sealed := fileSealing(record)
+	if sealed != nil {
+		size = sealed.size
 	}
+	modTime := targetFile.ModTime.Format(time.RFC3339Nano)
+	isDir := targetFile.IsDir
 	
-	// Determine file type
+	originalName := uploadedName(filename, record)
+	
+	// Determine file type from the detected content type, streaming goes by extension
 	ext := strings.ToLower(filepath.Ext(originalName))
-	fileType := "unknown"
-	streamable := false
+	mimeType := downloadMimeType(originalName, record)
+	streamable := isStreamableFormat(ext)
 	
-	switch ext {
-	case ".mp4", ".mkv", ".avi", ".mov", ".wmv", ".flv", ".webm":
+	var fileType string
+	switch mediaType, _, _ := mime.ParseMediaType(mimeType); {
+	case strings.HasPrefix(mediaType, "video/"):
 		fileType = "video"
-		streamable = true
-	case ".mp3", ".wav", ".flac", ".aac", ".ogg":
+	case strings.HasPrefix(mediaType, "audio/"):
 		fileType = "audio"
-		streamable = true
-	case ".jpg", ".jpeg", ".png", ".gif", ".bmp", ".webp":
+	case strings.HasPrefix(mediaType, "image/"):
 		fileType = "image"
-	case ".pdf":
+	case mediaType == "application/pdf":
 		fileType = "document"
-	case ".txt", ".md", ".log":
+	case strings.HasPrefix(mediaType, "text/"):
 		fileType = "text"
 	default:
 		fileType = "file"
 	}
+
+	checksumAlgorithm, checksum := a.fileChecksum(c.Request.Context(), fileID, filename)
 	
 	c.JSON(http.StatusOK, gin.H{
 		"message": "File info retrieved successfully",
@@ -317,10 +597,16 @@ func (a *API) handleGetFile(c *gin.Context) {
 			"modified":     modTime,
 			"is_dir":       isDir,
 			"type":         fileType,
+			"mime_type":    mimeType,
 			"extension":    ext,
 			"provider":     "union",
 			"streamable":   streamable,
 			"downloadable": true,
+			"encrypted":    sealed != nil,
+			"checksum": gin.H{
+				"algorithm": checksumAlgorithm,
+				"value":     checksum,
+			},
 		},
 		"actions": gin.H{
 			"download": fmt.Sprintf("/api/v1/download/%s", fileID),
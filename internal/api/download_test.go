@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+)
+
+// addTypedFile stores data as fileID owned by user, recorded with mimeType
+func (ta *testAPI) addTypedFile(t *testing.T, user *auth.User, fileID, filename, mimeType string, data []byte) {
+	t.Helper()
+	ta.rclone.put(t, ta.unionPath(fileID+"_"+filename), data)
+	if err := ta.db.CreateFileOwnership(user.ID, fileID, filename, "union", int64(len(data)), mimeType); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDownloadDisposition(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	user := ta.newUser(t, "owner@example.com")
+	ta.addTypedFile(t, user, "image", "photo.png", "image/png", []byte("png"))
+	ta.addTypedFile(t, user, "page", "page.html", "text/html", []byte("<script></script>"))
+
+	tests := []struct {
+		configured, path, want string
+	}{
+		{dispositionAttachment, "/api/v1/download/image", dispositionAttachment},
+		{dispositionInline, "/api/v1/download/image", dispositionInline},
+		{dispositionAttachment, "/api/v1/download/image?inline", dispositionInline},
+		{dispositionInline, "/api/v1/download/image?download=true", dispositionAttachment},
+		{dispositionInline, "/api/v1/download/image?inline=false", dispositionAttachment},
+		{dispositionAttachment, "/api/v1/download/image?download&disposition=inline", dispositionInline},
+		// Active content never renders on the API's origin
+		{dispositionInline, "/api/v1/download/page", dispositionAttachment},
+		{dispositionAttachment, "/api/v1/download/page?disposition=inline", dispositionAttachment},
+	}
+	for _, tt := range tests {
+		ta.config.Storage.DownloadDisposition = tt.configured
+		w := ta.do(t, http.MethodGet, tt.path, user, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got %d: %s", tt.path, w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("Content-Disposition"); !strings.HasPrefix(got, tt.want+";") {
+			t.Errorf("%s with %s configured: Content-Disposition %q, want %s", tt.path, tt.configured, got, tt.want)
+		}
+		if got := w.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+			t.Errorf("%s: X-Content-Type-Options %q, want nosniff", tt.path, got)
+		}
+	}
+}
+
+func TestDownloadMissFillsCache(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	user := ta.newUser(t, "owner@example.com")
+	ta.addFile(t, user, "file1", "data.bin", []byte("0123456789"))
+
+	for _, want := range []string{"MISS", "HIT"} {
+		w := ta.do(t, http.MethodGet, "/api/v1/download/file1", user, nil)
+		if w.Code != http.StatusOK || w.Body.String() != "0123456789" {
+			t.Fatalf("%s: got %d %q", want, w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("X-Cache"); got != want {
+			t.Errorf("X-Cache %q, want %s", got, want)
+		}
+		if got := w.Header().Get("Content-Length"); got != "10" {
+			t.Errorf("%s: Content-Length %q, want 10", want, got)
+		}
+	}
+}
+
+func TestDownloadUntrackedHeadersOnHit(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	admin := ta.admin(t)
+	ta.rclone.put(t, ta.unionPath("stray_notes.txt"), []byte("untracked"))
+
+	var headers []http.Header
+	for _, want := range []string{"MISS", "HIT"} {
+		w := ta.do(t, http.MethodGet, "/api/v1/download/stray", admin, nil)
+		if w.Code != http.StatusOK || w.Header().Get("X-Cache") != want {
+			t.Fatalf("got %d, X-Cache %q, want %s", w.Code, w.Header().Get("X-Cache"), want)
+		}
+		headers = append(headers, w.Header())
+	}
+	head := ta.do(t, http.MethodHead, "/api/v1/download/stray", admin, nil)
+	if head.Code != http.StatusOK {
+		t.Fatalf("head: got %d", head.Code)
+	}
+	headers = append(headers, head.Header())
+
+	// Without an ownership record the name and type come from the object
+	for _, header := range []string{"Content-Type", "Content-Disposition"} {
+		for _, got := range headers[1:] {
+			if got.Get(header) != headers[0].Get(header) {
+				t.Errorf("%s %q, want %q as on a miss", header, got.Get(header), headers[0].Get(header))
+			}
+		}
+	}
+	if got := headers[0].Get("Content-Disposition"); !strings.Contains(got, "notes.txt") {
+		t.Errorf("Content-Disposition %q, want the filename", got)
+	}
+}
+
+func TestDownloadRangeFromCache(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	user := ta.newUser(t, "owner@example.com")
+	ta.addFile(t, user, "file1", "data.bin", []byte("0123456789"))
+	if _, err := ta.cache.Put(context.Background(), "download_file1", strings.NewReader("0123456789"), 10); err != nil {
+		t.Fatal(err)
+	}
+
+	w := ta.doWithHeader(t, http.MethodGet, "/api/v1/download/file1", user, http.Header{"Range": {"bytes=4-"}})
+	if w.Code != http.StatusPartialContent || w.Body.String() != "456789" {
+		t.Fatalf("got %d %q, want the rest from byte 4", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Range"); got != "bytes 4-9/10" || w.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("Content-Range %q, X-Cache %q", got, w.Header().Get("X-Cache"))
+	}
+}
+
+func TestDownloadRefetchesReplacedFile(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	user := ta.newUser(t, "owner@example.com")
+	ta.addFile(t, user, "file1", "data.txt", []byte("old"))
+
+	if w := ta.do(t, http.MethodGet, "/api/v1/download/file1", user, nil); w.Body.String() != "old" {
+		t.Fatalf("got %d %q", w.Code, w.Body.String())
+	}
+	for deadline := time.Now().Add(5 * time.Second); len(ta.cache.Entries()) == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("first download wasn't cached")
+		}
+	}
+	if w := ta.do(t, http.MethodGet, "/api/v1/download/file1", user, nil); w.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("second download X-Cache %q, want HIT", w.Header().Get("X-Cache"))
+	}
+
+	ta.rclone.put(t, ta.unionPath("file1_data.txt"), []byte("replaced"))
+	w := ta.do(t, http.MethodGet, "/api/v1/download/file1", user, nil)
+	if w.Body.String() != "replaced" || w.Header().Get("X-Cache") == "HIT" {
+		t.Errorf("got %q with X-Cache %q after the file was replaced", w.Body.String(), w.Header().Get("X-Cache"))
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	tests := map[string]string{
+		"report.pdf":      `attachment; filename=report.pdf`,
+		"my report.pdf":   `attachment; filename="my report.pdf"`,
+		"résumé.pdf":      `attachment; filename="r_sum_.pdf"; filename*=utf-8''r%C3%A9sum%C3%A9.pdf`,
+		`C:\docs\a.txt`:   `attachment; filename=a.txt`,
+		"../../notes.txt": `attachment; filename=notes.txt`,
+	}
+	for name, want := range tests {
+		if got := contentDisposition(dispositionAttachment, name); got != want {
+			t.Errorf("%q: got %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestDownloadSavedUnderOriginalName(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	user := ta.newUser(t, "owner@example.com")
+	ta.addTypedFile(t, user, "file1", "résumé.pdf", "application/pdf", []byte("pdf"))
+
+	w := ta.do(t, http.MethodGet, "/api/v1/download/file1", user, nil)
+	if got, want := w.Header().Get("Content-Disposition"), contentDisposition(dispositionAttachment, "résumé.pdf"); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
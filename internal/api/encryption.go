@@ -0,0 +1,165 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+
+	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+	"github.com/nabilulilalbab/rclonestorage/internal/crypt"
+	"github.com/nabilulilalbab/rclonestorage/internal/logging"
+	"github.com/nabilulilalbab/rclonestorage/internal/storage"
+)
+
+// sealing is how a file's object is encrypted, see package crypt
+type sealing struct {
+	keyID string
+	nonce []byte
+	size  int64 // of the plaintext
+}
+
+// fileSealing returns how a file's object is encrypted, nil when it is stored in the clear
+func fileSealing(record *auth.FileOwnership) *sealing {
+	if record == nil || record.EncryptionKeyID == "" {
+		return nil
+	}
+	// A nonce that doesn't decode is rejected when the file is decrypted
+	nonce, _ := base64.StdEncoding.DecodeString(record.EncryptionNonce)
+	return &sealing{keyID: record.EncryptionKeyID, nonce: nonce, size: record.Size}
+}
+
+// storedSize returns the size of a file's object in cloud storage
+func storedSize(record *auth.FileOwnership) int64 {
+	if record.EncryptionKeyID != "" {
+		return crypt.SealedSize(record.Size)
+	}
+	return record.Size
+}
+
+// encrypting reports whether new uploads are encrypted
+func (a *API) encrypting() bool {
+	return a.currentKeyID() != ""
+}
+
+// currentKeyID returns the ID of the key new uploads are encrypted with, empty when
+// they aren't
+func (a *API) currentKeyID() string {
+	if a.keyring == nil {
+		return ""
+	}
+	return a.keyring.Current()
+}
+
+// newSealing picks the key and a fresh nonce for a new upload of size bytes, nil
+// when uploads aren't encrypted
+func (a *API) newSealing(size int64) (*sealing, error) {
+	if !a.encrypting() {
+		return nil, nil
+	}
+	nonce, err := crypt.NewNonce()
+	if err != nil {
+		return nil, err
+	}
+	return &sealing{keyID: a.keyring.Current(), nonce: nonce, size: size}, nil
+}
+
+// seal returns r encrypted as s describes, r itself when s is nil
+func (a *API) seal(r io.Reader, s *sealing) (io.Reader, error) {
+	if s == nil {
+		return r, nil
+	}
+	return a.keyring.Encrypt(r, s.keyID, s.nonce)
+}
+
+// unseal returns the plaintext of an object read from its start, body itself when
+// the object isn't encrypted. Closing the result closes body.
+func (a *API) unseal(body io.ReadCloser, s *sealing) (io.ReadCloser, error) {
+	if s == nil {
+		return body, nil
+	}
+	if a.keyring == nil {
+		return nil, fmt.Errorf("key %s: %w", s.keyID, crypt.ErrUnknownKey)
+	}
+	plain, err := a.keyring.Decrypt(body, s.keyID, s.nonce, 0, s.size)
+	if err != nil {
+		return nil, err
+	}
+	return &rangeBody{Reader: plain, Closer: body}, nil
+}
+
+// catPlain reads a file's object from cloud storage, decrypted
+func (a *API) catPlain(ctx context.Context, object string, s *sealing) (io.ReadCloser, error) {
+	body, err := a.openObject(ctx, object, nil)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := a.unseal(body, s)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	return plain, nil
+}
+
+// recordSealing stores how a new file's object is encrypted
+func (a *API) recordSealing(ctx context.Context, fileID string, s *sealing) {
+	if s == nil {
+		return
+	}
+	if err := a.authManager.DatabaseManager.SetFileEncryption(fileID, s.keyID, base64.StdEncoding.EncodeToString(s.nonce)); err != nil {
+		logging.FromContext(ctx).WithField("file_id", fileID).Warnf("Failed to store encryption: %v", err)
+	}
+}
+
+// loadKeyring sets up the keys of ENCRYPTION_KEY and ENCRYPTION_OLD_KEYS
+func (a *API) loadKeyring() error {
+	keys, err := a.config.Encryption.Keys()
+	if err != nil || len(keys) == 0 {
+		return err
+	}
+	current := ""
+	if a.config.Encryption.Enabled() {
+		current = a.config.Encryption.KeyID
+	}
+	a.keyring, err = crypt.NewKeyring(current, keys)
+	return err
+}
+
+// openSealedRange reads bytes start-end of an encrypted file. Chunks can only be
+// authenticated whole, so the chunks covering the range are fetched and decrypted and
+// the bytes around the range dropped.
+func (a *API) openSealedRange(ctx context.Context, fileInfo *FileInfo, start, end int64) (io.ReadCloser, error) {
+	s := fileInfo.sealing
+	if a.keyring == nil {
+		return nil, fmt.Errorf("key %s: %w", s.keyID, crypt.ErrUnknownKey)
+	}
+
+	first, offset, length, skip := crypt.Range(start, end, s.size)
+	body, err := a.catRange(ctx, fileInfo, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := a.keyring.Decrypt(body, s.keyID, s.nonce, first, s.size)
+	if err == nil {
+		_, err = io.CopyN(io.Discard, plain, skip)
+	}
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	return &rangeBody{Reader: io.LimitReader(plain, end-start+1), Closer: body}, nil
+}
+
+// hashSealed downloads an encrypted file and hashes its content
+func (a *API) hashSealed(ctx context.Context, object, algorithm string, s *sealing) (string, error) {
+	body, err := a.catPlain(ctx, object, s)
+	if err != nil {
+		return "", err
+	}
+	hash, err := storage.HashReader(body, algorithm)
+	if closeErr := body.Close(); storage.IsNotFound(closeErr) {
+		return "", storage.ErrObjectNotFound
+	}
+	return hash, err
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+	"github.com/nabilulilalbab/rclonestorage/internal/crypt"
+)
+
+// useKey makes ta encrypt new uploads with a random key named keyID, keeping the
+// keys used before readable
+func useKey(t *testing.T, ta *testAPI, keyID string) {
+	t.Helper()
+	key := make([]byte, crypt.KeySize)
+	rand.Read(key)
+	if previous := ta.config.Encryption; previous.Enabled() {
+		if ta.config.Encryption.OldKeys == nil {
+			ta.config.Encryption.OldKeys = make(map[string]string)
+		}
+		ta.config.Encryption.OldKeys[previous.KeyID] = previous.Key
+	}
+	ta.config.Encryption.Key = base64.StdEncoding.EncodeToString(key)
+	ta.config.Encryption.KeyID = keyID
+	if err := ta.loadKeyring(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// uploadRecord uploads content as user and returns its ownership record
+func uploadRecord(t *testing.T, ta *testAPI, user *auth.User, filename string, content []byte) *auth.FileOwnership {
+	t.Helper()
+	w := ta.upload(t, user, filename, content, "")
+	var uploaded struct {
+		FileID string `json:"file_id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &uploaded); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("upload: got %d: %s", w.Code, w.Body.String())
+	}
+	record, err := ta.db.GetFileOwnership(uploaded.FileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+func TestEncryptedRoundTrip(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	useKey(t, ta, "1")
+	user := ta.newUser(t, "owner@example.com")
+	content := make([]byte, 2*crypt.ChunkSize+100)
+	rand.Read(content)
+
+	record := uploadRecord(t, ta, user, "secret.mp4", content)
+	if record.EncryptionKeyID != "1" || record.EncryptionNonce == "" {
+		t.Errorf("recorded key %q, nonce %q, want key 1 with a nonce", record.EncryptionKeyID, record.EncryptionNonce)
+	}
+	stored, err := os.ReadFile(ta.rclone.path(ta.config.Storage.ObjectPath(ta.config.Storage.UnionName, record.Object())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(stored)) != crypt.SealedSize(int64(len(content))) || bytes.Contains(stored, content[:64]) {
+		t.Errorf("stored %d bytes, want the %d of the sealed upload", len(stored), crypt.SealedSize(int64(len(content))))
+	}
+
+	w := ta.do(t, http.MethodGet, "/api/v1/download/"+record.FileID, user, nil)
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), content) {
+		t.Errorf("download: got %d with %d bytes, want the plaintext", w.Code, w.Body.Len())
+	}
+
+	// Ranges across chunk boundaries only fetch and decrypt the chunks they span
+	start, end := int64(crypt.ChunkSize-10), int64(2*crypt.ChunkSize+10)
+	w = ta.doWithHeader(t, http.MethodGet, "/api/v1/stream/"+record.FileID, user, http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", start, end)}})
+	if w.Code != http.StatusPartialContent || !bytes.Equal(w.Body.Bytes(), content[start:end+1]) {
+		t.Errorf("range: got %d with %d bytes, want bytes %d-%d of the plaintext", w.Code, w.Body.Len(), start, end)
+	}
+	if want := fmt.Sprintf("bytes %d-%d/%d", start, end, len(content)); w.Header().Get("Content-Range") != want {
+		t.Errorf("range: got Content-Range %q, want %q", w.Header().Get("Content-Range"), want)
+	}
+}
+
+func TestEncryptionKeyRotation(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	user := ta.newUser(t, "owner@example.com")
+	plain := uploadRecord(t, ta, user, "plain.txt", []byte("stored in the clear"))
+	useKey(t, ta, "1")
+	before := uploadRecord(t, ta, user, "before.txt", []byte("sealed with key 1"))
+	useKey(t, ta, "2")
+	after := uploadRecord(t, ta, user, "after.txt", []byte("sealed with key 2"))
+
+	if plain.EncryptionKeyID != "" || before.EncryptionKeyID != "1" || after.EncryptionKeyID != "2" {
+		t.Errorf("got keys %q, %q, %q, want none, 1 and 2", plain.EncryptionKeyID, before.EncryptionKeyID, after.EncryptionKeyID)
+	}
+	for record, want := range map[*auth.FileOwnership]string{plain: "stored in the clear", before: "sealed with key 1", after: "sealed with key 2"} {
+		if w := ta.do(t, http.MethodGet, "/api/v1/download/"+record.FileID, user, nil); w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("%s: got %d %q, want %q", record.Filename, w.Code, w.Body.String(), want)
+		}
+	}
+
+	// Files sealed with a key no longer configured can't be read, once the
+	// plaintext cached by the downloads above is gone
+	delete(ta.config.Encryption.OldKeys, "1")
+	if err := ta.loadKeyring(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ta.cache.Clear(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if w := ta.do(t, http.MethodGet, "/api/v1/download/"+before.FileID, user, nil); w.Code == http.StatusOK {
+		t.Errorf("download without its key: got 200 %q", w.Body.String())
+	}
+}
@@ -0,0 +1,317 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+	"github.com/nabilulilalbab/rclonestorage/internal/storage"
+)
+
+// maxPageLimit caps the page size of ownership-backed listings
+const maxPageLimit = 100
+
+// checksumTimeout bounds asking a provider for a stored hash
+const checksumTimeout = 30 * time.Second
+
+// handleListMyFiles lists the files owned by the current user
+// @Summary List my files
+// @Description List files owned by the current user from the ownership database. Pass cursor (empty for the first page) for stable keyset pagination over large sets, or page for offset pagination
+// @Tags user
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param page query int false "Page number (offset pagination)" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Param cursor query string false "Opaque cursor from the previous page (keyset pagination)"
+// @Param sort query string false "Sort field for offset pagination (name, size, date, type)"
+// @Param order query string false "Sort order for offset pagination (asc, desc)"
+// @Success 200 {object} map[string]interface{} "List of files"
+// @Failure 400 {object} map[string]interface{} "Invalid pagination parameters"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Router /../user/files [get]
+// @Router /my-files [get]
+func (a *API) handleListMyFiles(c *gin.Context) {
+	userID, exists := auth.GetCurrentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Authentication required",
+		})
+		return
+	}
+
+	a.listOwnedFiles(c, auth.FileFilter{UserID: userID})
+}
+
+// handleGetFileByName resolves a file of the current user by folder and name
+// @Summary Get file by name
+// @Description Look up one of the current user's files by its original name within a folder. Uploads with the same name are kept side by side, so a name matching several files is ambiguous and returns them all with 409
+// @Tags files
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param path query string false "Folder, empty or / for the root"
+// @Param name query string true "Original file name"
+// @Success 200 {object} map[string]interface{} "File information"
+// @Failure 400 {object} map[string]interface{} "Missing name"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 404 {object} map[string]interface{} "File not found"
+// @Failure 409 {object} map[string]interface{} "Several files have this name"
+// @Router /files/by-name [get]
+func (a *API) handleGetFileByName(c *gin.Context) {
+	userID, exists := auth.GetCurrentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Authentication required",
+		})
+		return
+	}
+
+	name := c.Query("name")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "name is required",
+		})
+		return
+	}
+	filename := strings.TrimPrefix(path.Join("/", c.Query("path"), name), "/")
+
+	files, err := a.authManager.DatabaseManager.FilesByName(userID, filename)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to look up file",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	switch len(files) {
+	case 0:
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "File not found",
+			"name":  filename,
+		})
+	case 1:
+		file := files[0]
+		c.JSON(http.StatusOK, gin.H{
+			"message": "File info retrieved successfully",
+			"file_id": file.FileID,
+			"file":    ownedFileEntries(files)[0],
+			"actions": gin.H{
+				"info":     fmt.Sprintf("/api/v1/files/%s", file.FileID),
+				"download": fmt.Sprintf("/api/v1/download/%s", file.FileID),
+				"stream":   fmt.Sprintf("/api/v1/stream/%s", file.FileID),
+			},
+		})
+	default:
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Several files have this name",
+			"name":    filename,
+			"matches": ownedFileEntries(files),
+		})
+	}
+}
+
+// handleSearchFiles searches files across all users
+// @Summary Search files
+// @Description Search the ownership database across all users by filename and owner (admin only). Supports the same cursor and offset pagination as /user/files
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param q query string false "Filename substring"
+// @Param user_id query int false "Owner user ID"
+// @Param page query int false "Page number (offset pagination)" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Param cursor query string false "Opaque cursor from the previous page (keyset pagination)"
+// @Param sort query string false "Sort field for offset pagination (name, size, date, type)"
+// @Param order query string false "Sort order for offset pagination (asc, desc)"
+// @Success 200 {object} map[string]interface{} "Matching files"
+// @Failure 400 {object} map[string]interface{} "Invalid parameters"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - Admin access required"
+// @Router /../admin/files [get]
+func (a *API) handleSearchFiles(c *gin.Context) {
+	filter := auth.FileFilter{Query: c.Query("q")}
+	if raw := c.Query("user_id"); raw != "" {
+		userID, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid user ID",
+			})
+			return
+		}
+		filter.UserID = uint(userID)
+	}
+
+	a.listOwnedFiles(c, filter)
+}
+
+// handleSetFileVisibility makes a file public or private
+// @Summary Set file visibility
+// @Description Make a file public, so anyone can download and stream it without authentication, or private again (owner or admin only)
+// @Tags files
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "File ID"
+// @Param visibility body map[string]interface{} true "Visibility, e.g. {\"is_public\": true}"
+// @Success 200 {object} map[string]interface{} "Visibility updated"
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "File not found or access denied"
+// @Failure 404 {object} map[string]interface{} "File not found"
+// @Router /files/{id}/visibility [put]
+func (a *API) handleSetFileVisibility(c *gin.Context) {
+	var req struct {
+		IsPublic *bool `json:"is_public" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	fileID := c.Param("id")
+	if err := a.authManager.DatabaseManager.SetFilePublic(fileID, *req.IsPublic); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, auth.ErrFileNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{
+			"error":   "Failed to update file visibility",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":        fileID,
+		"is_public": *req.IsPublic,
+	})
+}
+
+// listOwnedFiles writes a page of ownership records, using keyset pagination when
+// a cursor param is present and offset pagination otherwise
+func (a *API) listOwnedFiles(c *gin.Context, filter auth.FileFilter) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		files, next, err := a.authManager.DatabaseManager.SearchFilesAfter(filter, cursor, limit)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Failed to list files",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"files": ownedFileEntries(files),
+			"pagination": gin.H{
+				"limit":       limit,
+				"next_cursor": next,
+				"has_more":    next != "",
+			},
+		})
+		return
+	}
+
+	sortField, sortOrder, err := a.listSort(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid sort parameters",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+
+	files, total, err := a.authManager.DatabaseManager.SearchFiles(filter, (page-1)*limit, limit, sortField, sortOrder)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to list files",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"files": ownedFileEntries(files),
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+			"sort":  sortField,
+			"order": sortOrder,
+		},
+	})
+}
+
+// ownedFileEntries converts ownership records to response entries
+func ownedFileEntries(files []auth.FileOwnership) []gin.H {
+	entries := make([]gin.H, 0, len(files))
+	for _, file := range files {
+		entries = append(entries, gin.H{
+			"id":                 file.FileID,
+			"name":               file.Filename,
+			"size":               file.Size,
+			"mime_type":          file.MimeType,
+			"provider":           file.Provider,
+			"owner_id":           file.UserID,
+			"checksum":           file.Checksum,
+			"checksum_algorithm": file.ChecksumAlgorithm,
+			"is_public":          file.IsPublic,
+			"encrypted":          file.EncryptionKeyID != "",
+			"created_at":         file.CreatedAt,
+		})
+	}
+	return entries
+}
+
+// fileChecksum returns the checksum for a file in the configured algorithm. A stored
+// checksum is used when it matches, otherwise the provider is asked for the hash it
+// already keeps (rclone hashsum) and the result is stored. The checksum is empty when
+// neither is available.
+func (a *API) fileChecksum(ctx context.Context, fileID, filename string) (string, string) {
+	algorithm := a.config.Storage.ChecksumAlgo
+
+	ownership, err := a.authManager.DatabaseManager.GetFileOwnership(fileID)
+	if err != nil {
+		return algorithm, ""
+	}
+	if ownership.Checksum != "" && ownership.ChecksumAlgorithm == algorithm {
+		return algorithm, ownership.Checksum
+	}
+	// The provider only knows the hash of the encrypted object
+	if ownership.EncryptionKeyID != "" {
+		return algorithm, ""
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, checksumTimeout)
+	defer cancel()
+	checksum, err := storage.RemoteHash(ctx, a.rclone, a.unionPath(filename), algorithm, false)
+	if err != nil || checksum == "" {
+		return algorithm, ""
+	}
+	a.authManager.DatabaseManager.SetFileChecksum(fileID, algorithm, checksum)
+
+	return algorithm, checksum
+}
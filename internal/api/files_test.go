@@ -0,0 +1,82 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+)
+
+func TestGetFileByName(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	owner := ta.newUser(t, "owner@example.com")
+	other := ta.newUser(t, "other@example.com")
+	ta.addFile(t, owner, "file1", "docs/report.pdf", []byte("report"))
+	ta.addFile(t, owner, "file2", "notes.txt", []byte("first"))
+	ta.addFile(t, owner, "file3", "notes.txt", []byte("second"))
+	ta.addFile(t, other, "file4", "docs/secret.pdf", []byte("secret"))
+
+	w := ta.do(t, http.MethodGet, "/api/v1/files/by-name?path=/docs/&name=report.pdf", owner, nil)
+	var found struct {
+		FileID string `json:"file_id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &found); err != nil || w.Code != http.StatusOK || found.FileID != "file1" {
+		t.Errorf("in a folder: got %d %s, want file1", w.Code, w.Body.String())
+	}
+
+	w = ta.do(t, http.MethodGet, "/api/v1/files/by-name?name=notes.txt", owner, nil)
+	var ambiguous struct {
+		Matches []map[string]interface{} `json:"matches"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &ambiguous); err != nil || w.Code != http.StatusConflict || len(ambiguous.Matches) != 2 {
+		t.Errorf("ambiguous: got %d %s, want 409 with both files", w.Code, w.Body.String())
+	}
+
+	// Other users' files aren't found by name
+	if w := ta.do(t, http.MethodGet, "/api/v1/files/by-name?path=docs&name=secret.pdf", owner, nil); w.Code != http.StatusNotFound {
+		t.Errorf("another user's file: got %d, want 404", w.Code)
+	}
+	if w := ta.do(t, http.MethodGet, "/api/v1/files/by-name?path=docs", owner, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("no name: got %d, want 400", w.Code)
+	}
+	if w := ta.do(t, http.MethodGet, "/api/v1/files/by-name?name=notes.txt", nil, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous: got %d, want 401", w.Code)
+	}
+}
+
+func TestSetFileVisibility(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	owner := ta.newUser(t, "owner@example.com")
+	other := ta.newUser(t, "other@example.com")
+	ta.addFile(t, owner, "file1", "clip.mp4", []byte("a public clip"))
+	public := func(user *auth.User, isPublic bool) int {
+		body := fmt.Sprintf(`{"is_public": %v}`, isPublic)
+		return ta.do(t, http.MethodPut, "/api/v1/files/file1/visibility", user, strings.NewReader(body)).Code
+	}
+
+	if code := public(other, true); code != http.StatusForbidden {
+		t.Errorf("another user: got %d, want 403", code)
+	}
+	if w := ta.do(t, http.MethodPut, "/api/v1/files/file1/visibility", owner, strings.NewReader(`{}`)); w.Code != http.StatusBadRequest {
+		t.Errorf("no is_public: got %d, want 400", w.Code)
+	}
+
+	if code := public(owner, true); code != http.StatusOK {
+		t.Fatalf("owner: got %d", code)
+	}
+	for _, path := range []string{"/api/v1/download/file1", "/api/v1/stream/file1"} {
+		if w := ta.do(t, http.MethodGet, path, nil, nil); w.Code != http.StatusOK || w.Body.String() != "a public clip" {
+			t.Errorf("anonymous GET %s of a public file: got %d %q", path, w.Code, w.Body.String())
+		}
+	}
+
+	if code := public(owner, false); code != http.StatusOK {
+		t.Fatalf("owner making it private: got %d", code)
+	}
+	if w := ta.do(t, http.MethodGet, "/api/v1/download/file1", nil, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous download of a private file: got %d, want 401", w.Code)
+	}
+}
@@ -1,16 +1,18 @@
 package api
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
-	"os/exec"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/nabilulilalbab/rclonestorage/internal/auth"
 	"github.com/nabilulilalbab/rclonestorage/internal/cache"
 	"github.com/nabilulilalbab/rclonestorage/internal/config"
+	"github.com/nabilulilalbab/rclonestorage/internal/crypt"
+	"github.com/nabilulilalbab/rclonestorage/internal/jobs"
 	"github.com/nabilulilalbab/rclonestorage/internal/storage"
 )
 
@@ -20,57 +22,272 @@ var startTime = time.Now()
 type API struct {
 	config      *config.Config
 	storage     storage.UnionStorage
+	rclone      storage.RcloneClient
+	providers   *storage.ProviderRegistry
 	authManager *auth.AuthManager
+	jobs        *jobs.Manager
+	cache       *cache.Manager
+	uploads     *tusStore
+	progress    *progressTracker
+	shares      *shareResumes
+	keyring     *crypt.Keyring // nil when no encryption key is configured
+	rcloneCheck storage.RcloneStatus // found at startup, see RcloneStatus
+	done        chan struct{}
+
+	// Running HLS generations by file ID, see ensureHLS
+	hlsJobs map[string]*hlsJob
+	hlsMu   sync.Mutex
+
+	// ffprobe results by file ID, see probeMedia
+	probes sync.Map
+
+	onFileChange func(event, fileID string, ownerID uint) // see OnFileChange
 }
 
+// File change events passed to the OnFileChange callback
+const (
+	FileUploaded = "upload"
+	FileDeleted  = "delete"
+)
+
 // NewAPI creates a new API instance
-func NewAPI(cfg *config.Config, unionStorage storage.UnionStorage, authManager *auth.AuthManager) *API {
-	return &API{
+func NewAPI(cfg *config.Config, unionStorage storage.UnionStorage, rclone storage.RcloneClient, authManager *auth.AuthManager) *API {
+	api := &API{
 		config:      cfg,
 		storage:     unionStorage,
+		rclone:      rclone,
 		authManager: authManager,
+		jobs:        jobs.NewManager(),
+		uploads:     newTusStore(filepath.Join(cfg.Cache.Dir, "uploads")),
+		progress:    newProgressTracker(),
+		shares:      newShareResumes(),
+		done:        make(chan struct{}),
+		hlsJobs:     make(map[string]*hlsJob),
+	}
+
+	uploadRetry := jobs.RetryPolicy{
+		MaxAttempts: cfg.Storage.UploadRetryAttempts,
+		Backoff:     cfg.Storage.UploadRetryBackoff,
+		MaxBackoff:  cfg.Storage.UploadRetryMaxBackoff,
+	}
+	api.jobs.SetRetryPolicy(jobs.TypeUpload, uploadRetry)
+	api.jobs.SetRetryPolicy(jobs.TypeReplicate, uploadRetry)
+	api.jobs.SetRetryPolicy(jobs.TypeDelete, uploadRetry)
+	api.jobs.OnFailure(api.notifyJobFailure)
+
+	return api
+}
+
+// OnFileChange registers fn to be called after a file was uploaded or deleted, with
+// FileUploaded or FileDeleted, the file ID and its owner (0 for an untracked object).
+// Register it before serving requests.
+func (a *API) OnFileChange(fn func(event, fileID string, ownerID uint)) {
+	a.onFileChange = fn
+}
+
+// fileChanged reports a file change to the OnFileChange callback
+func (a *API) fileChanged(event, fileID string, ownerID uint) {
+	if a.onFileChange != nil {
+		a.onFileChange(event, fileID, ownerID)
+	}
+}
+
+// Close stops the API's background workers
+func (a *API) Close() {
+	close(a.done)
+	if a.cache != nil {
+		a.cache.Close()
 	}
 }
 
 // SetupRoutes sets up all API routes with authentication
-func SetupRoutes(r *gin.Engine, cfg *config.Config, authManager *auth.AuthManager) {
-	// Initialize storage providers
-	// TODO: Initialize actual storage providers
+func SetupRoutes(r *gin.Engine, cfg *config.Config, authManager *auth.AuthManager) (*API, error) {
+	if len(cfg.Rclone.AllowedRemotes) > 0 {
+		storage.SetAllowedRemotes(append([]string{cfg.Storage.UnionName}, cfg.Rclone.AllowedRemotes...))
+	}
+
+	// Initialize storage providers from the persisted registry, seeded from config
+	var defaults []storage.ProviderSpec
+	for _, name := range cfg.Storage.Providers {
+		defaults = append(defaults, storage.ProviderSpec{Name: name, Remote: name, Type: storage.ProviderTypeFor(name)})
+	}
+	registry, err := storage.NewProviderRegistry(cfg.Storage.ProvidersFile, defaults)
+	if err != nil {
+		return nil, err
+	}
+
+	rclone := storage.NewRcloneClient(cfg.Rclone.BinPath, cfg.Rclone.ConfigPath)
+	rcloneCheck, err := checkRclone(rclone, cfg.Storage.UnionName, registry.Specs())
+	if err != nil {
+		return nil, err
+	}
+	unionStorage := storage.NewUnionStorage()
+	unionStorage.SetCircuitBreaker(cfg.Storage.CircuitThreshold, cfg.Storage.CircuitCooldown, cfg.Storage.CircuitMaxCooldown)
+	unionStorage.SetReadPolicy(cfg.Storage.ReadTimeout, cfg.Storage.HedgedReads)
+	unionStorage.SetProviderWeights(cfg.Storage.ProviderWeights)
+	unionStorage.SetReplicas(cfg.Storage.Replicas)
+	for _, spec := range registry.Specs() {
+		provider, err := storage.NewProviderFromSpec(spec, rclone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid provider %s: %w", spec.Name, err)
+		}
+		if err := unionStorage.AddProvider(provider); err != nil {
+			return nil, err
+		}
+	}
 	
-	api := NewAPI(cfg, nil, authManager) // Pass auth manager
+	api := NewAPI(cfg, unionStorage, rclone, authManager) // Pass auth manager
+	api.providers = registry
+	api.rcloneCheck = rcloneCheck
+	if err := api.loadKeyring(); err != nil {
+		return nil, fmt.Errorf("invalid encryption keys: %w", err)
+	}
+	unionStorage.StartHealthChecks(cfg.Storage.HealthInterval, providerCheckTimeout, api.done)
+
+	// One cache manager shared by all handlers, so its in-memory view is complete
+	cacheManager, err := cache.NewManager(cfg.Cache.Dir, cfg.Cache.TTL, cfg.Cache.MaxSize, cfg.Cache.CleanupInterval)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize cache: %w", err)
+	}
+	cacheManager.SetMaxEntrySize(cfg.Cache.MaxEntrySize)
+	cacheManager.SetDegradedThreshold(cfg.Cache.DegradedThreshold)
+	cacheManager.PurgeStaleTemp(cfg.Cache.TempMaxAge)
+	api.uploads.purgeStale(cfg.Storage.UploadResumeMaxAge)
+	if err := cacheManager.SetEvictionPolicy(cfg.Cache.EvictionPolicy); err != nil {
+		return nil, err
+	}
+	api.cache = cacheManager
+
+	if cfg.Listing.ReconcileInterval > 0 {
+		api.startReconciler(cfg.Listing.ReconcileInterval)
+	}
+	
+	api.registerRoutes(r)
+	return api, nil
+}
+
+// registerRoutes sets up the API routes on r
+func (a *API) registerRoutes(r *gin.Engine) {
+	cfg, authManager := a.config, a.authManager
 	
 	// Public API group (no authentication required)
 	public := r.Group("/api/v1/public")
 	{
-		public.GET("/stats", api.handlePublicStats)
+		public.GET("/stats", a.handlePublicStats)
 	}
 	
 	// Protected API group (authentication required)
 	v1 := r.Group("/api/v1")
 	v1.Use(authManager.Middleware.OptionalAuth()) // Allow both authenticated and API key access
+	v1.Use(authManager.Middleware.RateLimit(cfg.Auth.RateLimit))
 	{
 		// File management (requires authentication for upload/delete)
-		v1.POST("/upload", authManager.Middleware.OptionalAuth(), authManager.Middleware.RequireAuth(), authManager.Middleware.AuditLog("upload"), api.handleUpload)
-		v1.GET("/files", api.handleListFiles) // Can be public or user-specific
-		v1.GET("/files/:id", api.handleGetFile)
-		v1.DELETE("/files/:id", authManager.Middleware.OptionalAuth(), authManager.Middleware.RequireAuth(), authManager.Middleware.RequireFileOwnership(), authManager.Middleware.AuditLog("delete"), api.handleDeleteFile)
+		v1.POST("/upload", authManager.Middleware.OptionalAuth(), authManager.Middleware.RequireAuth(), authManager.Middleware.AuditLog("upload"), a.handleUpload)
+		v1.POST("/uploads", authManager.Middleware.RequireAuth(), authManager.Middleware.AuditLog("upload"), a.handleCreateUpload)
+		v1.HEAD("/uploads/:id", authManager.Middleware.RequireAuth(), a.handleUploadOffset)
+		v1.PATCH("/uploads/:id", authManager.Middleware.RequireAuth(), a.handleUploadChunk)
+		v1.GET("/uploads/:id/progress", authManager.Middleware.RequireAuth(), a.handleUploadProgress)
+		v1.GET("/files", authManager.Middleware.RequireAuth(), a.handleListFiles) // Admins see every file, users their own
+		v1.GET("/my-files", authManager.Middleware.RequireAuth(), a.handleListMyFiles)
+		v1.GET("/files/by-name", authManager.Middleware.RequireAuth(), a.handleGetFileByName)
+		v1.GET("/search", authManager.Middleware.RequireAuth(), a.handleSearch) // Admins search every file, users their own
+		v1.POST("/files/:id/share", authManager.Middleware.RequireAuth(), authManager.Middleware.RequirePermission(auth.ActionShare), authManager.Middleware.RequireFileOwnership(), authManager.Middleware.AuditLog("share_create"), a.handleCreateShare)
+		v1.GET("/shares", authManager.Middleware.RequireAuth(), a.handleListShares)
+		v1.DELETE("/shares/:id", authManager.Middleware.RequireAuth(), authManager.Middleware.AuditLog("share_revoke"), a.handleRevokeShare)
+		v1.GET("/shared/:token", a.trackAccess(auth.AccessDownload), a.handleSharedDownload) // Anyone holding a valid link
+		v1.GET("/files/:id", authManager.Middleware.RequireFileReadAccess(), a.handleGetFile)
+		v1.POST("/files/verify-all", authManager.Middleware.RequireAuth(), a.handleVerifyAll)
+		v1.GET("/files/:id/checksum", authManager.Middleware.RequireAuth(), authManager.Middleware.RequireFileOwnership(), a.handleFileChecksum)
+		v1.DELETE("/files/:id", authManager.Middleware.OptionalAuth(), authManager.Middleware.RequireAuth(), authManager.Middleware.RequirePermission(auth.ActionDelete), authManager.Middleware.RequireFileOwnership(), authManager.Middleware.AuditLog("delete"), a.handleDeleteFile)
+		
+		v1.PUT("/files/:id/visibility", authManager.Middleware.RequireAuth(), authManager.Middleware.RequirePermission(auth.ActionShare), authManager.Middleware.RequireFileOwnership(), authManager.Middleware.AuditLog("visibility"), a.handleSetFileVisibility)
+		
+		// Download and streaming (owner or admin only, anyone for public files)
+		v1.GET("/download/:id", authManager.Middleware.AuditLog("download"), authManager.Middleware.RequireFileReadAccess(), a.trackAccess(auth.AccessDownload), a.handleDownload)
+		v1.GET("/stream/:id", authManager.Middleware.AuditLog("stream"), authManager.Middleware.RequireFileReadAccess(), a.trackAccess(auth.AccessStream), a.handleStream)
+		v1.POST("/download/zip", authManager.Middleware.RequireAuth(), authManager.Middleware.AuditLog("download_zip"), a.handleDownloadZip)
+		v1.HEAD("/download/:id", authManager.Middleware.RequireFileReadAccess(), a.handleDownloadHead)
+		v1.GET("/files/:id/thumbnail", authManager.Middleware.RequireFileReadAccess(), a.handleThumbnail)
+		v1.HEAD("/stream/:id", authManager.Middleware.RequireFileReadAccess(), a.handleStreamHead)
+		v1.GET("/stream/:id/hls/:name", authManager.Middleware.RequireFileReadAccess(), a.handleHLS)
+		v1.GET("/stream/:id/info", authManager.Middleware.RequireFileReadAccess(), a.handleStreamInfo)
 		
-		// Download and streaming (can be public or authenticated)
-		v1.GET("/download/:id", authManager.Middleware.AuditLog("download"), api.handleDownload)
-		v1.GET("/stream/:id", authManager.Middleware.AuditLog("stream"), api.handleStream)
-		v1.GET("/stream/:id/info", api.handleStreamInfo)
+		// Background jobs (owner or admin only)
+		v1.GET("/jobs/:id", authManager.Middleware.RequireAuth(), a.handleGetJob)
+		v1.DELETE("/jobs/:id", authManager.Middleware.RequireAuth(), authManager.Middleware.AuditLog("job_cancel"), a.handleCancelJob)
 		
 		// System endpoints (admin only) - Support both JWT and API key
-		v1.GET("/stats", authManager.Middleware.OptionalAuth(), authManager.Middleware.RequireRole(auth.RoleAdmin), api.handleStats)
-		v1.POST("/cache/clear", authManager.Middleware.OptionalAuth(), authManager.Middleware.RequireRole(auth.RoleAdmin), api.handleClearCache)
+		v1.GET("/stats", authManager.Middleware.OptionalAuth(), authManager.Middleware.RequireRole(auth.RoleAdmin), a.handleStats)
+		v1.POST("/cache/clear", authManager.Middleware.OptionalAuth(), authManager.Middleware.RequireRole(auth.RoleAdmin), a.handleClearCache)
+		v1.POST("/cache/purge-expired", authManager.Middleware.OptionalAuth(), authManager.Middleware.RequireRole(auth.RoleAdmin), a.handlePurgeExpiredCache)
+		v1.GET("/cache/entries", authManager.Middleware.OptionalAuth(), authManager.Middleware.RequireRole(auth.RoleAdmin), a.handleListCacheEntries)
+		v1.POST("/cache/recalculate", authManager.Middleware.OptionalAuth(), authManager.Middleware.RequireRole(auth.RoleAdmin), a.handleRecalculateCache)
 	}
+
+	// User file listing from the ownership database
+	user := r.Group("/api/user")
+	user.Use(authManager.Middleware.OptionalAuth())
+	user.Use(authManager.Middleware.RequireAuth())
+	{
+		user.GET("/files", a.handleListMyFiles)
+	}
+
+	// Admin storage management - Support both JWT and API key
+	admin := r.Group("/api/admin")
+	admin.Use(authManager.Middleware.OptionalAuth())
+	admin.Use(authManager.Middleware.RequireAuth())
+	admin.Use(authManager.Middleware.RequireRole(auth.RoleAdmin))
+	{
+		admin.GET("/files", a.handleSearchFiles)
+		admin.GET("/providers", a.handleListProviders)
+		admin.POST("/providers", authManager.Middleware.AuditLog("provider_add"), a.handleAddProvider)
+		admin.DELETE("/providers/:name", authManager.Middleware.AuditLog("provider_remove"), a.handleRemoveProvider)
+		admin.POST("/providers/:name/rename", authManager.Middleware.AuditLog("provider_rename"), a.handleRenameProvider)
+		admin.GET("/storage/distribution", a.handleStorageDistribution)
+		admin.GET("/backup", authManager.Middleware.AuditLog("backup_export"), a.handleExportBackup)
+		admin.POST("/backup/restore", authManager.Middleware.AuditLog("backup_restore"), a.handleImportBackup)
+	}
+}
+
+// Storage returns the union storage backing the API
+func (a *API) Storage() storage.UnionStorage {
+	return a.storage
+}
+
+// Rclone returns the rclone client shared by the API handlers and providers
+func (a *API) Rclone() storage.RcloneClient {
+	return a.rclone
+}
+
+// Cache returns the cache manager shared by the API handlers
+func (a *API) Cache() *cache.Manager {
+	return a.cache
+}
+
+// RcloneStatus returns what the startup check found out about rclone
+func (a *API) RcloneStatus() storage.RcloneStatus {
+	return a.rcloneCheck
 }
 
 // All handlers are now implemented in separate files:
 // - handleUpload: upload.go
-// - handleListFiles, handleGetFile, handleDownload: download.go  
-// - handleStream, handleStreamInfo: stream.go
-// - handleDeleteFile, handleClearCache: cache.go
+// - handleListFiles, handleGetFile, handleDownload, handleDownloadHead: download.go  
+// - handleStream, handleStreamHead, handleStreamInfo: stream.go
+// - handleHLS: hls.go, ffprobe metadata for handleStreamInfo: probe.go
+// - handleDeleteFile, handleClearCache, handlePurgeExpiredCache, handleRecalculateCache, handleListCacheEntries: cache.go
+// - handleGetJob, handleCancelJob: jobs.go
+// - handleListMyFiles, handleSearchFiles, handleGetFileByName, handleSetFileVisibility: files.go
+// - handleVerifyAll: verify.go
+// - handleFileChecksum: checksum.go
+// - handleSearch: search.go
+// - handleCreateShare, handleListShares, handleRevokeShare, handleSharedDownload: share.go
+// - handleDownloadZip: zip.go
+// - handleThumbnail: thumbnail.go
+// - handleExportBackup, handleImportBackup: backup.go
+// - handleCreateUpload, handleUploadOffset, handleUploadChunk: tus.go
+// - handleUploadProgress: progress.go
+// - trackAccess: access.go
+// - HandleHealth, HandleLive: health.go
 
 // handleStats handles getting real system statistics
 // @Summary Get system statistics
@@ -86,36 +303,19 @@ func SetupRoutes(r *gin.Engine, cfg *config.Config, authManager *auth.AuthManage
 // @Router /stats [get]
 func (a *API) handleStats(c *gin.Context) {
 	// Get real file count and size from cloud
-	cmd := exec.Command("rclone", "lsjson", "union:uploads/")
-	if a.config.Rclone.ConfigPath != "" {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("RCLONE_CONFIG=%s", a.config.Rclone.ConfigPath))
-	}
-	
 	var totalFiles int
 	var totalSize int64
 	
-	if output, err := cmd.Output(); err == nil {
-		var files []map[string]interface{}
-		if json.Unmarshal(output, &files) == nil {
-			totalFiles = len(files)
-			for _, file := range files {
-				if size, ok := file["Size"].(float64); ok {
-					totalSize += int64(size)
-				}
-			}
+	if files, err := a.listObjects(c.Request.Context()); err == nil {
+		totalFiles = len(files)
+		for _, file := range files {
+			totalSize += file.Size
 		}
 	}
 	
 	// Get cache statistics
-	cacheManager, _ := cache.NewManager("./cache", 24*time.Hour, 10*1024*1024*1024)
-	var cacheStats map[string]interface{}
-	if cacheManager != nil {
-		cacheStats = cacheManager.GetStats()
-	} else {
-		cacheStats = map[string]interface{}{
-			"error": "Cache manager not available",
-		}
-	}
+	cacheStats := a.cache.GetStats()
+	providers := a.providerNames()
 	
 	c.JSON(http.StatusOK, gin.H{
 		"status": "ok",
@@ -124,16 +324,16 @@ func (a *API) handleStats(c *gin.Context) {
 				"total_files":    totalFiles,
 				"total_size":     totalSize,
 				"size_human":     formatBytes(totalSize),
-				"providers":      []string{"mega1", "mega2", "mega3", "gdrive"},
+				"providers":      providers,
 				"union_storage":  "active",
-				"provider_count": 4,
+				"provider_count": len(providers),
 			},
 			"cache": cacheStats,
 			"system": gin.H{
 				"uptime":         time.Since(startTime),
 				"cache_enabled":  true,
-				"cache_ttl":      "24h",
-				"max_cache_size": "10GB",
+				"cache_ttl":      a.config.Cache.TTL.String(),
+				"max_cache_size": formatBytes(a.config.Cache.MaxSize),
 			},
 		},
 		"timestamp": time.Now(),
@@ -151,34 +351,26 @@ func (a *API) handleStats(c *gin.Context) {
 // @Router /public/stats [get]
 func (a *API) handlePublicStats(c *gin.Context) {
 	// Get real file count and size from cloud
-	cmd := exec.Command("rclone", "lsjson", "union:uploads/")
-	if a.config.Rclone.ConfigPath != "" {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("RCLONE_CONFIG=%s", a.config.Rclone.ConfigPath))
-	}
-	
 	var totalFiles int
 	var totalSize int64
 	
-	if output, err := cmd.Output(); err == nil {
-		var files []map[string]interface{}
-		if json.Unmarshal(output, &files) == nil {
-			totalFiles = len(files)
-			for _, file := range files {
-				if size, ok := file["Size"].(float64); ok {
-					totalSize += int64(size)
-				}
-			}
+	if files, err := a.listObjects(c.Request.Context()); err == nil {
+		totalFiles = len(files)
+		for _, file := range files {
+			totalSize += file.Size
 		}
 	}
 	
+	providers := a.providerNames()
+	
 	c.JSON(http.StatusOK, gin.H{
 		"status": "ok",
 		"public_stats": gin.H{
 			"total_files":    totalFiles,
 			"total_size":     totalSize,
 			"size_human":     formatBytes(totalSize),
-			"providers":      []string{"mega1", "mega2", "mega3", "gdrive"},
-			"provider_count": 4,
+			"providers":      providers,
+			"provider_count": len(providers),
 			"features": []string{
 				"multi-provider storage",
 				"video streaming",
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDownloadHead(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	user := ta.newUser(t, "owner@example.com")
+	ta.addFile(t, user, "file1", "data.bin", []byte("0123456789"))
+
+	w := ta.do(t, http.MethodHead, "/api/v1/download/file1", user, nil)
+	if w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Fatalf("got %d with %d body bytes, want 200 without a body", w.Code, w.Body.Len())
+	}
+	if got := w.Header().Get("Content-Length"); got != "10" {
+		t.Errorf("Content-Length %q, want 10", got)
+	}
+	if got := w.Header().Get("Content-Disposition"); !strings.Contains(got, "data.bin") {
+		t.Errorf("Content-Disposition %q, want the filename", got)
+	}
+
+	if _, err := ta.cache.Put(context.Background(), "download_file1", strings.NewReader("0123456789"), 10); err != nil {
+		t.Fatal(err)
+	}
+	if w := ta.do(t, http.MethodHead, "/api/v1/download/file1", user, nil); w.Header().Get("Accept-Ranges") != "bytes" {
+		t.Errorf("cached: Accept-Ranges %q, want bytes", w.Header().Get("Accept-Ranges"))
+	}
+
+	other := ta.newUser(t, "other@example.com")
+	if w := ta.do(t, http.MethodHead, "/api/v1/download/file1", other, nil); w.Code != http.StatusForbidden {
+		t.Errorf("another user: got %d, want 403", w.Code)
+	}
+}
+
+func TestStreamHead(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	user := ta.newUser(t, "owner@example.com")
+	ta.addFile(t, user, "video", "clip.mp4", []byte("not really a video"))
+	ta.addFile(t, user, "text", "notes.txt", []byte("text"))
+
+	w := ta.do(t, http.MethodHead, "/api/v1/stream/video", user, nil)
+	if w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Fatalf("got %d with %d body bytes, want 200 without a body", w.Code, w.Body.Len())
+	}
+	for header, want := range map[string]string{
+		"Content-Type":   "video/mp4",
+		"Content-Length": "18",
+		"Accept-Ranges":  "bytes",
+		"X-Stream-Type":  "video",
+	} {
+		if got := w.Header().Get(header); got != want {
+			t.Errorf("%s %q, want %q", header, got, want)
+		}
+	}
+
+	if w := ta.do(t, http.MethodHead, "/api/v1/stream/text", user, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("not streamable: got %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// healthCheckTimeout bounds each dependency check of GET /health
+const healthCheckTimeout = 5 * time.Second
+
+// Dependency states reported by GET /health. A dependency that is down makes the
+// service unable to serve requests; degraded ones only lose it some features or
+// redundancy.
+const (
+	healthOK       = "ok"
+	healthDegraded = "degraded"
+	healthDown     = "down"
+)
+
+// HandleHealth reports whether the service is ready to serve requests
+// @Summary Readiness check
+// @Description Check the dependencies: the database is pinged, rclone is run, and the providers are summarized from their last background probe. Returns 503 with status down when the database or rclone fails or no provider is available; status is degraded when the cache is, when some providers are unavailable or when remotes are missing from the rclone config
+// @Tags health
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Ready, status ok or degraded"
+// @Failure 503 {object} map[string]interface{} "A critical dependency is down"
+// @Router /../health [get]
+func (a *API) HandleHealth(c *gin.Context) {
+	ctx := c.Request.Context()
+	database := a.databaseHealth(ctx)
+	rclone := a.rcloneHealth(ctx)
+	providers := a.providersHealth()
+
+	// A degraded cache doesn't stop the service, downloads and streams bypass it
+	cacheStatus := healthOK
+	if a.cache.Degraded() {
+		cacheStatus = healthDegraded
+	}
+
+	status := healthOK
+	for _, check := range []string{cacheStatus, database["status"].(string), rclone["status"].(string), providers["status"].(string)} {
+		if check == healthDown {
+			status = healthDown
+			break
+		}
+		if check == healthDegraded {
+			status = healthDegraded
+		}
+	}
+
+	code := http.StatusOK
+	if status == healthDown {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{
+		"status":    status,
+		"cache":     cacheStatus,
+		"database":  database,
+		"rclone":    rclone,
+		"providers": providers,
+		"service":   "rclonestorage",
+		"version":   "1.0.0",
+		"features": []string{
+			"multi-provider storage",
+			"video streaming",
+			"authentication",
+			"api keys",
+			"monitoring dashboard",
+			"swagger documentation",
+		},
+	})
+}
+
+// HandleLive reports that the process is up, without checking any dependency
+// @Summary Liveness check
+// @Description Confirm the process is up and serving HTTP. Dependencies are not checked, see /health for readiness
+// @Tags health
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Process is up"
+// @Router /../health/live [get]
+func (a *API) HandleLive(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": healthOK})
+}
+
+// databaseHealth pings the database
+func (a *API) databaseHealth(ctx context.Context) gin.H {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	sqlDB, err := a.authManager.DatabaseManager.GetDatabase().DB()
+	if err == nil {
+		err = sqlDB.PingContext(ctx)
+	}
+	if err != nil {
+		return gin.H{"status": healthDown, "error": err.Error()}
+	}
+	return gin.H{"status": healthOK}
+}
+
+// rcloneHealth runs rclone and adds what the startup check found about its config.
+// Remotes missing from the config only degrade the service, the others still work.
+func (a *API) rcloneHealth(ctx context.Context) gin.H {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	check := a.RcloneStatus()
+	result := gin.H{"status": healthOK}
+	if check.Version != "" {
+		result["version"] = check.Version
+	}
+	if !check.OK() {
+		result["status"] = healthDegraded
+		result["missing_remotes"] = check.MissingRemotes
+	}
+	if err := a.rclone.Command(ctx, "version").Run(); err != nil {
+		result["status"] = healthDown
+		result["error"] = err.Error()
+	}
+	return result
+}
+
+// providersHealth summarizes the last background probe of every provider. A provider
+// not probed yet is assumed available.
+func (a *API) providersHealth() gin.H {
+	providers := a.storage.GetProviders()
+	health := a.storage.Health()
+	unavailable := []string{}
+	for _, provider := range providers {
+		if checked, found := health[provider.Name()]; found && !checked.Available {
+			unavailable = append(unavailable, provider.Name())
+		}
+	}
+	sort.Strings(unavailable)
+
+	status := healthOK
+	switch {
+	case len(providers) == 0 || len(unavailable) == len(providers):
+		status = healthDown
+	case len(unavailable) > 0:
+		status = healthDegraded
+	}
+	return gin.H{
+		"status":      status,
+		"total":       len(providers),
+		"available":   len(providers) - len(unavailable),
+		"unavailable": unavailable,
+	}
+}
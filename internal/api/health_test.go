@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/rclonestorage/internal/storage"
+)
+
+// health is the body of GET /health
+type health struct {
+	Status    string `json:"status"`
+	Cache     string `json:"cache"`
+	Database  gin.H  `json:"database"`
+	Rclone    gin.H  `json:"rclone"`
+	Providers struct {
+		Status      string   `json:"status"`
+		Unavailable []string `json:"unavailable"`
+	} `json:"providers"`
+}
+
+// getHealth asks ta for its readiness
+func (ta *testAPI) getHealth(t *testing.T) (int, health) {
+	t.Helper()
+	w := serve(func(r *gin.Engine) {
+		r.GET("/health", ta.HandleHealth)
+	}, httptest.NewRequest(http.MethodGet, "/health", nil))
+	var body health
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	return w.Code, body
+}
+
+// brokenRclone is a fakeRclone whose binary can't be run
+type brokenRclone struct {
+	*fakeRclone
+}
+
+func (b brokenRclone) Command(ctx context.Context, operation string, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, "sh", "-c", "echo 'rclone: not found' >&2; exit 127")
+}
+
+func TestHealthOK(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	code, body := ta.getHealth(t)
+	if code != http.StatusOK || body.Status != healthOK || body.Cache != healthOK || body.Database["status"] != healthOK || body.Rclone["status"] != healthOK || body.Providers.Status != healthOK {
+		t.Errorf("got %d %+v, want everything ok", code, body)
+	}
+
+	w := serve(func(r *gin.Engine) {
+		r.GET("/health/live", ta.HandleLive)
+	}, httptest.NewRequest(http.MethodGet, "/health/live", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"ok"`) {
+		t.Errorf("live: got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHealthDegradedByProvider(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	// remote1 is reachable once its directory exists, remote2's never does
+	if err := os.MkdirAll(ta.rclone.path("union:"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ta.storage.AddProvider(storage.NewRcloneProvider("remote2", "missing", "local", ta.rclone)); err != nil {
+		t.Fatal(err)
+	}
+	ta.storage.(*storage.UnionStorageImpl).CheckHealth(context.Background(), time.Second)
+
+	code, body := ta.getHealth(t)
+	if code != http.StatusOK || body.Status != healthDegraded || body.Providers.Status != healthDegraded || len(body.Providers.Unavailable) != 1 || body.Providers.Unavailable[0] != "remote2" {
+		t.Errorf("got %d %+v, want degraded by remote2", code, body)
+	}
+}
+
+func TestHealthDegradedByMissingRemotes(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	ta.rcloneCheck = storage.RcloneStatus{Version: "rclone v1.66.0", MissingRemotes: []string{"box"}}
+
+	code, body := ta.getHealth(t)
+	if code != http.StatusOK || body.Status != healthDegraded || body.Rclone["status"] != healthDegraded || body.Rclone["version"] != "rclone v1.66.0" {
+		t.Errorf("got %d %+v, want degraded by the missing remote", code, body)
+	}
+}
+
+func TestHealthDegradedByCache(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	ta.cache.SetDegradedThreshold(1)
+	// A file in place of the temp directory makes staging fail even as root
+	temp := filepath.Join(ta.config.Cache.Dir, "temp")
+	if err := os.RemoveAll(temp); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(temp, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ta.cache.Put(context.Background(), "stream_a", strings.NewReader("data"), 4); err == nil {
+		t.Fatal("cache write succeeded")
+	}
+
+	code, body := ta.getHealth(t)
+	if code != http.StatusOK || body.Status != healthDegraded || body.Cache != healthDegraded {
+		t.Errorf("got %d %+v, want degraded by the cache", code, body)
+	}
+}
+
+func TestHealthDownWithoutRclone(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	ta.API.rclone = brokenRclone{ta.rclone}
+	if code, body := ta.getHealth(t); code != http.StatusServiceUnavailable || body.Status != healthDown || body.Rclone["status"] != healthDown {
+		t.Errorf("got %d %+v, want down", code, body)
+	}
+}
+
+func TestHealthDownWithoutProviders(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	if err := ta.storage.RemoveProvider(testProvider); err != nil {
+		t.Fatal(err)
+	}
+	if code, body := ta.getHealth(t); code != http.StatusServiceUnavailable || body.Status != healthDown || body.Providers.Status != healthDown {
+		t.Errorf("got %d %+v, want down", code, body)
+	}
+}
+
+func TestHealthDownWithoutDatabase(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	sqlDB, err := ta.db.GetDatabase().DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.Close()
+	if code, body := ta.getHealth(t); code != http.StatusServiceUnavailable || body.Status != healthDown || body.Database["status"] != healthDown {
+		t.Errorf("got %d %+v, want down", code, body)
+	}
+}
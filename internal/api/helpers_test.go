@@ -0,0 +1,537 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+	"github.com/nabilulilalbab/rclonestorage/internal/cache"
+	"github.com/nabilulilalbab/rclonestorage/internal/config"
+	"github.com/nabilulilalbab/rclonestorage/internal/jobs"
+	"github.com/nabilulilalbab/rclonestorage/internal/storage"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// fakeRclone keeps every remote as a directory under dir, "remote:path" being
+// dir/remote/path, and records the remote paths it was asked for
+type fakeRclone struct {
+	dir      string
+	hashes   bool // answer hashsum with the md5 of the object, like Drive
+	truncate bool // store one byte less than copied, like a broken upload
+
+	mu      sync.Mutex
+	remotes []string
+}
+
+func (f *fakeRclone) path(remote string) string {
+	name, p, _ := strings.Cut(remote, ":")
+	return filepath.Join(f.dir, name, p)
+}
+
+func (f *fakeRclone) record(remote string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.remotes = append(f.remotes, remote)
+}
+
+// used returns the remote paths rclone was run on
+func (f *fakeRclone) used() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.remotes...)
+}
+
+// put stores an object at remote
+func (f *fakeRclone) put(t *testing.T, remote string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(f.path(remote)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(f.path(remote), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (f *fakeRclone) Command(ctx context.Context, operation string, args ...string) *exec.Cmd {
+	for _, arg := range args {
+		if strings.Contains(arg, ":") && !strings.HasPrefix(arg, "-") {
+			f.record(arg)
+		}
+	}
+	switch operation {
+	case "cat":
+		offset, count := "0", ""
+		for i := 1; i+1 < len(args); i++ {
+			switch args[i] {
+			case "--offset":
+				offset = args[i+1]
+			case "--count":
+				count = args[i+1]
+			}
+		}
+		if count == "" {
+			return exec.CommandContext(ctx, "sh", "-c", `tail -c +$(($1 + 1)) "$0"`, f.path(args[0]), offset)
+		}
+		return exec.CommandContext(ctx, "sh", "-c", `tail -c +$(($1 + 1)) "$0" | head -c "$2"`, f.path(args[0]), offset, count)
+	case "rcat":
+		os.MkdirAll(filepath.Dir(f.path(args[0])), 0755)
+		if f.truncate {
+			return exec.CommandContext(ctx, "sh", "-c", `head -c -1 > "$0"`, f.path(args[0]))
+		}
+		return exec.CommandContext(ctx, "sh", "-c", `cat > "$0"`, f.path(args[0]))
+	case "lsjson":
+		listing, err := f.lsjson(args[0])
+		if err != nil {
+			// rclone exits with 3 for a missing directory or file
+			return exec.CommandContext(ctx, "sh", "-c", "exit 3")
+		}
+		return exec.CommandContext(ctx, "printf", "%s", string(listing))
+	case "deletefile":
+		// rclone exits with 4 for a missing file
+		return exec.CommandContext(ctx, "sh", "-c", `test -f "$0" || exit 4; rm "$0"`, f.path(args[0]))
+	case "hashsum":
+		if !f.hashes {
+			return exec.CommandContext(ctx, "echo", "UNSUPPORTED")
+		}
+		// rclone exits with 4 for a missing file
+		return exec.CommandContext(ctx, "sh", "-c", `test -f "$0" || exit 4; md5sum "$0" | sed 's|  .*|  object|'`, f.path(args[1]))
+	case "version":
+		return exec.CommandContext(ctx, "echo", "rclone v1.66.0")
+	case "lsd":
+		// A remote is reachable once its directory exists
+		return exec.CommandContext(ctx, "test", "-d", f.path(args[0]))
+	}
+	return exec.CommandContext(ctx, "false")
+}
+
+// lsjson lists remote like rclone lsjson: the entries of a directory, or the file itself
+func (f *fakeRclone) lsjson(remote string) ([]byte, error) {
+	info, err := os.Stat(f.path(remote))
+	if err != nil {
+		return nil, err
+	}
+	infos := []os.FileInfo{info}
+	if info.IsDir() {
+		entries, err := os.ReadDir(f.path(remote))
+		if err != nil {
+			return nil, err
+		}
+		infos = infos[:0]
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil {
+				return nil, err
+			}
+			infos = append(infos, info)
+		}
+	}
+
+	type entry struct {
+		Path, Name, ModTime string
+		Size                int64
+		IsDir               bool
+	}
+	listing := []entry{}
+	for _, info := range infos {
+		listing = append(listing, entry{Path: info.Name(), Name: info.Name(), ModTime: info.ModTime().Format(time.RFC3339Nano), Size: info.Size(), IsDir: info.IsDir()})
+	}
+	return json.Marshal(listing)
+}
+
+func (f *fakeRclone) LsJSON(ctx context.Context, remote string, args ...string) ([]*storage.FileInfo, error) {
+	f.record(remote)
+	if strings.HasSuffix(remote, "/") {
+		entries, err := os.ReadDir(f.path(remote))
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var files []*storage.FileInfo
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, &storage.FileInfo{Name: info.Name(), Size: info.Size(), ModTime: info.ModTime(), IsDir: info.IsDir()})
+		}
+		return files, nil
+	}
+	info, err := os.Stat(f.path(remote))
+	if err != nil {
+		return nil, nil
+	}
+	return []*storage.FileInfo{{Name: info.Name(), Size: info.Size(), ModTime: info.ModTime()}}, nil
+}
+
+func (f *fakeRclone) Cat(ctx context.Context, remote string, args ...string) (io.ReadCloser, error) {
+	f.record(remote)
+	file, err := os.Open(f.path(remote))
+	if err != nil {
+		return nil, err
+	}
+	var offset, count int64 = 0, -1
+	for i := 0; i+1 < len(args); i++ {
+		switch args[i] {
+		case "--offset":
+			offset, _ = strconv.ParseInt(args[i+1], 10, 64)
+		case "--count":
+			count, _ = strconv.ParseInt(args[i+1], 10, 64)
+		}
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if count < 0 {
+		return file, nil
+	}
+	return &rangeBody{Reader: io.LimitReader(file, count), Closer: file}, nil
+}
+
+func (f *fakeRclone) Copy(ctx context.Context, src, dst string) error {
+	f.record(dst)
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if f.truncate && len(data) > 0 {
+		data = data[:len(data)-1]
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path(dst)), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(f.path(dst), data, 0644)
+}
+
+func (f *fakeRclone) Delete(ctx context.Context, remote string) error {
+	f.record(remote)
+	return os.Remove(f.path(remote))
+}
+
+// testConfig returns the defaults the API relies on, with the cache in dir
+func testConfig(dir string) *config.Config {
+	return &config.Config{
+		Auth:  config.AuthConfig{JWTSecret: "test-secret"},
+		Cache: config.CacheConfig{Dir: filepath.Join(dir, "cache"), TTL: time.Hour, MaxSize: 1 << 30},
+		Storage: config.StorageConfig{
+			UnionName:           "union",
+			UploadsPath:         "uploads",
+			ProvidersFile:       filepath.Join(dir, "providers.json"),
+			DownloadDisposition: "attachment",
+			ChecksumAlgo:        "sha256",
+			StreamMode:          "proxy",
+		},
+		Listing: config.ListingConfig{DefaultSort: "name", DefaultOrder: "asc", Source: "db"},
+		Share:   config.ShareConfig{Enabled: true},
+	}
+}
+
+// testProvider names the storage provider of a testAPI
+const testProvider = "remote1"
+
+// testAPI is an API backed by a fake rclone, a real database and a real cache
+type testAPI struct {
+	*API
+	rclone *fakeRclone
+	db     *auth.DatabaseManager
+}
+
+// newTestAPI builds an API around cfg, testConfig when nil
+func newTestAPI(t *testing.T, cfg *config.Config) *testAPI {
+	t.Helper()
+	dir := t.TempDir()
+	if cfg == nil {
+		cfg = testConfig(dir)
+	}
+
+	authManager, err := auth.NewAuthManager(filepath.Join(dir, "auth.db"), cfg.Auth.JWTSecret, "admin@example.com", "Admin-Passw0rd!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cacheManager, err := cache.NewManager(cfg.Cache.Dir, cfg.Cache.TTL, cfg.Cache.MaxSize, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The single provider is backed by the union remote, so objects put there are
+	// found through either
+	rclone := &fakeRclone{dir: filepath.Join(dir, "remotes")}
+	unionStorage := storage.NewUnionStorage()
+	if err := unionStorage.AddProvider(storage.NewRcloneProvider(testProvider, cfg.Storage.UnionName, "local", rclone)); err != nil {
+		t.Fatal(err)
+	}
+	registry, err := storage.NewProviderRegistry(cfg.Storage.ProvidersFile, []storage.ProviderSpec{
+		{Name: testProvider, Remote: cfg.Storage.UnionName, Type: storage.ProviderTypeRclone},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAPI(cfg, unionStorage, rclone, authManager)
+	a.cache = cacheManager
+	a.providers = registry
+	t.Cleanup(func() {
+		a.Close()
+		authManager.Close()
+	})
+	return &testAPI{API: a, rclone: rclone, db: authManager.DatabaseManager}
+}
+
+// addFile stores data as fileID owned by user, the way an upload to the union does
+func (ta *testAPI) addFile(t *testing.T, user *auth.User, fileID, filename string, data []byte) {
+	t.Helper()
+	ta.rclone.put(t, ta.unionPath(fileID+"_"+filename), data)
+	if err := ta.db.CreateFileOwnership(user.ID, fileID, filename, "union", int64(len(data)), "application/octet-stream"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// addMemFile stores data on mem as fileID owned by user
+func (ta *testAPI) addMemFile(t *testing.T, mem *memProvider, user *auth.User, fileID, filename string, data []byte) {
+	t.Helper()
+	mem.put(ta.objectKey(fileID+"_"+filename), data)
+	if err := ta.db.CreateFileOwnership(user.ID, fileID, filename, mem.Name(), int64(len(data)), "application/octet-stream"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitForJob polls job id until it reaches status
+func (ta *testAPI) waitForJob(t *testing.T, id, status string) jobs.Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := ta.jobs.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status == status {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job is %s (%s), want %s", job.Status, job.Error, status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// newUser creates a user with the user role
+func (ta *testAPI) newUser(t *testing.T, email string) *auth.User {
+	t.Helper()
+	user, err := ta.db.CreateUser(email, "User-Passw0rd!", auth.RoleUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// serve runs a request through a router set up by routes
+func serve(routes func(r *gin.Engine), req *http.Request) *httptest.ResponseRecorder {
+	r := gin.New()
+	routes(r)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// do sends a request through the API's routes, authenticated as user when not nil
+func (ta *testAPI) do(t *testing.T, method, path string, user *auth.User, body io.Reader) *httptest.ResponseRecorder {
+	t.Helper()
+	return serve(ta.registerRoutes, ta.request(t, method, path, user, body))
+}
+
+// doWithHeader sends a request without a body like do, with header added to it
+func (ta *testAPI) doWithHeader(t *testing.T, method, path string, user *auth.User, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	req := ta.request(t, method, path, user, nil)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	return serve(ta.registerRoutes, req)
+}
+
+// upload posts content as a multipart upload named filename to /api/v1/upload with query
+func (ta *testAPI) upload(t *testing.T, user *auth.User, filename string, content []byte, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	form.Close()
+
+	path := "/api/v1/upload"
+	if query != "" {
+		path += "?" + query
+	}
+	req := ta.request(t, http.MethodPost, path, user, &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return serve(ta.registerRoutes, req)
+}
+
+// request builds a request to the API, authenticated as user when not nil
+func (ta *testAPI) request(t *testing.T, method, path string, user *auth.User, body io.Reader) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest(method, path, body)
+	if user != nil {
+		token, err := ta.authManager.JWTManager.GenerateToken(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req
+}
+
+// memProvider is an in-memory StorageProvider, not backed by any rclone remote
+type memProvider struct {
+	name    string
+	linkURL string // base of the direct URLs GetURL hands out, none when empty
+
+	mu        sync.Mutex
+	objects   map[string][]byte
+	deleteErr error               // returned by Delete when set
+	rangeErr  error               // returned by ranged downloads when set
+	ranges    []storage.RangeSpec // ranges downloads were asked for
+}
+
+func newMemProvider(name string) *memProvider {
+	return &memProvider{name: name, objects: make(map[string][]byte)}
+}
+
+func (m *memProvider) Upload(ctx context.Context, reader io.Reader, path string, opts storage.UploadOptions) (*storage.FileInfo, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[path] = data
+	return &storage.FileInfo{Name: filepath.Base(path), Size: int64(len(data)), Provider: m.name, Path: path}, nil
+}
+
+func (m *memProvider) Download(ctx context.Context, path string, opts storage.DownloadOptions) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[path]
+	if !ok {
+		return nil, storage.ErrObjectNotFound
+	}
+	if rng := opts.Range; rng != nil {
+		m.ranges = append(m.ranges, *rng)
+		if m.rangeErr != nil {
+			return nil, m.rangeErr
+		}
+		end := rng.End + 1
+		if rng.End < 0 || end > int64(len(data)) {
+			end = int64(len(data))
+		}
+		data = data[rng.Start:end]
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *memProvider) List(ctx context.Context, path string) ([]*storage.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var files []*storage.FileInfo
+	for name, data := range m.objects {
+		if strings.HasPrefix(name, path) {
+			files = append(files, &storage.FileInfo{Name: filepath.Base(name), Size: int64(len(data)), Provider: m.name, Path: name})
+		}
+	}
+	return files, nil
+}
+
+func (m *memProvider) Delete(ctx context.Context, path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.deleteErr != nil {
+		return m.deleteErr
+	}
+	if _, ok := m.objects[path]; !ok {
+		return storage.ErrObjectNotFound
+	}
+	delete(m.objects, path)
+	return nil
+}
+
+func (m *memProvider) Stat(ctx context.Context, path string) (*storage.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[path]
+	if !ok {
+		return nil, storage.ErrObjectNotFound
+	}
+	return &storage.FileInfo{Name: filepath.Base(path), Size: int64(len(data)), Provider: m.name, Path: path}, nil
+}
+
+func (m *memProvider) GetURL(ctx context.Context, path string, expires time.Duration) (string, error) {
+	if m.linkURL == "" {
+		return "", fmt.Errorf("direct URLs not supported")
+	}
+	return m.linkURL + "/" + path, nil
+}
+
+func (m *memProvider) Name() string { return m.name }
+
+func (m *memProvider) IsAvailable(ctx context.Context) bool { return true }
+
+// put stores data at path
+func (m *memProvider) put(path string, data []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[path] = data
+}
+
+// object returns the stored content of path, false when there is none
+func (m *memProvider) object(path string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[path]
+	return data, ok
+}
+
+// failDeletes makes Delete return err, or work again when err is nil
+func (m *memProvider) failDeletes(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleteErr = err
+}
+
+// requested returns the ranges downloads were asked for
+func (m *memProvider) requested() []storage.RangeSpec {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]storage.RangeSpec(nil), m.ranges...)
+}
+
+// failRanges makes ranged downloads return err, or work again when err is nil
+func (m *memProvider) failRanges(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rangeErr = err
+}
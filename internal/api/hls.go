@@ -0,0 +1,261 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/rclonestorage/internal/logging"
+)
+
+// HLS output layout, see cache.Manager.HLSDir
+const (
+	hlsPlaylist   = "playlist.m3u8"
+	hlsSourceFile = "source" // validator of the file version the output was made from
+	hlsSegments   = "segment%05d.ts"
+)
+
+// hlsReadyTimeout bounds waiting for ffmpeg to finish the first segment
+const hlsReadyTimeout = time.Minute
+
+// hlsSegmentName matches the segment files ffmpeg writes for hlsSegments
+var hlsSegmentName = regexp.MustCompile(`^segment\d{5}\.ts$`)
+
+// hlsJob is an ffmpeg run writing the HLS output of a file
+type hlsJob struct {
+	validator string
+	done      chan struct{}
+	err       error
+}
+
+// handleHLS serves the HLS playlist and segments of a file
+// @Summary Stream over HLS
+// @Description Serve a file as HLS, transcoded to H.264/AAC by ffmpeg. The first playlist request starts generating the segments and returns once the first one is ready, the playlist grows until generation finishes. Output is reused until the file changes and expires with CACHE_TTL (requires ownership or admin)
+// @Tags streaming
+// @Produce application/vnd.apple.mpegurl
+// @Produce video/mp2t
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "File ID"
+// @Param name path string true "playlist.m3u8 or a segment listed in it"
+// @Success 200 {file} file "Playlist or segment"
+// @Failure 400 {object} map[string]interface{} "File format not streamable"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - not file owner"
+// @Failure 404 {object} map[string]interface{} "File or segment not found"
+// @Failure 500 {object} map[string]interface{} "HLS generation failed"
+// @Failure 501 {object} map[string]interface{} "ffmpeg is not installed"
+// @Router /stream/{id}/hls/{name} [get]
+func (a *API) handleHLS(c *gin.Context) {
+	if _, err := exec.LookPath(a.config.Storage.FFmpegPath); err != nil {
+		c.JSON(http.StatusNotImplemented, gin.H{
+			"error":   "HLS streaming is not available",
+			"details": "ffmpeg not found at " + a.config.Storage.FFmpegPath,
+		})
+		return
+	}
+
+	fileID := c.Param("id")
+	name := c.Param("name")
+	dir := a.cache.HLSDir(fileID)
+
+	// Segments are only requested from a playlist, which already checked the file
+	if name != hlsPlaylist {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err != nil || !hlsSegmentName.MatchString(name) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "Segment not found",
+				"file_id": fileID,
+			})
+			return
+		}
+		c.Header("Content-Type", "video/mp2t")
+		c.File(path)
+		return
+	}
+
+	fileInfo, err := a.getFileInfo(fileID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "File not found",
+			"file_id": fileID,
+		})
+		return
+	}
+
+	ext := strings.ToLower(filepath.Ext(fileInfo.Name))
+	if !isStreamableFormat(ext) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "File format not streamable",
+			"format":  ext,
+			"file_id": fileID,
+		})
+		return
+	}
+
+	if err := a.ensureHLS(c.Request.Context(), fileInfo, dir); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to generate HLS playlist",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	// The playlist grows while segments are generated, players must reload it
+	c.Header("Content-Type", "application/vnd.apple.mpegurl")
+	c.Header("Cache-Control", "no-cache")
+	c.File(filepath.Join(dir, hlsPlaylist))
+}
+
+// ensureHLS starts generating HLS output for the current version of a file unless it
+// exists or is being generated, and waits until the playlist lists a segment
+func (a *API) ensureHLS(ctx context.Context, fileInfo *FileInfo, dir string) error {
+	validator := fileInfo.cacheValidator()
+
+	a.hlsMu.Lock()
+	job, running := a.hlsJobs[fileInfo.ID]
+	if running && job.validator != validator {
+		// The file changed while an older version was being generated
+		a.hlsMu.Unlock()
+		select {
+		case <-job.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return a.ensureHLS(ctx, fileInfo, dir)
+	}
+	if !running {
+		source, _ := os.ReadFile(filepath.Join(dir, hlsSourceFile))
+		if string(source) == validator && hlsComplete(dir) {
+			a.hlsMu.Unlock()
+			return nil
+		}
+
+		// Output of an older version or of an interrupted run
+		os.RemoveAll(dir)
+		err := os.MkdirAll(dir, 0755)
+		if err == nil {
+			err = os.WriteFile(filepath.Join(dir, hlsSourceFile), []byte(validator), 0644)
+		}
+		if err != nil {
+			a.hlsMu.Unlock()
+			return fmt.Errorf("failed to create HLS directory: %w", err)
+		}
+
+		job = &hlsJob{validator: validator, done: make(chan struct{})}
+		a.hlsJobs[fileInfo.ID] = job
+		go a.generateHLS(fileInfo, dir, job)
+	}
+	a.hlsMu.Unlock()
+
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(hlsReadyTimeout)
+
+	playlist := filepath.Join(dir, hlsPlaylist)
+	for {
+		if _, err := os.Stat(playlist); err == nil {
+			return nil
+		}
+
+		select {
+		case <-job.done:
+			if _, err := os.Stat(playlist); err == nil {
+				return nil
+			}
+			if job.err != nil {
+				return job.err
+			}
+			return errors.New("ffmpeg wrote no playlist")
+		case <-ticker.C:
+		case <-timeout:
+			return errors.New("timed out waiting for the first HLS segment")
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// generateHLS pipes a file through ffmpeg into HLS segments in dir, removing the
+// output when it fails. It stops when the API is closed.
+func (a *API) generateHLS(fileInfo *FileInfo, dir string, job *hlsJob) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-a.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	defer func() {
+		if job.err != nil {
+			logging.Logger.WithField("file_id", fileInfo.ID).Warnf("HLS generation failed: %v", job.err)
+			os.RemoveAll(dir)
+		}
+		a.hlsMu.Lock()
+		delete(a.hlsJobs, fileInfo.ID)
+		a.hlsMu.Unlock()
+		close(job.done)
+	}()
+
+	source, err := a.openObject(ctx, fileInfo.Filename, nil)
+	if err != nil {
+		job.err = fmt.Errorf("failed to read file: %w", err)
+		return
+	}
+
+	transcode := exec.CommandContext(ctx, a.config.Storage.FFmpegPath,
+		"-loglevel", "error",
+		"-i", "pipe:0",
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-c:a", "aac",
+		"-f", "hls",
+		"-hls_time", "6",
+		"-hls_playlist_type", "event",
+		"-hls_segment_filename", filepath.Join(dir, hlsSegments),
+		filepath.Join(dir, hlsPlaylist),
+	)
+
+	transcode.Stdin, err = a.unseal(source, fileInfo.sealing)
+	if err != nil {
+		source.Close()
+		job.err = err
+		return
+	}
+	var stderr bytes.Buffer
+	transcode.Stderr = &stderr
+
+	if err := transcode.Start(); err != nil {
+		source.Close()
+		job.err = fmt.Errorf("failed to start ffmpeg: %w", err)
+		return
+	}
+
+	transcodeErr := transcode.Wait()
+	sourceErr := source.Close()
+
+	switch {
+	case transcodeErr != nil:
+		job.err = fmt.Errorf("ffmpeg failed: %w: %s", transcodeErr, strings.TrimSpace(stderr.String()))
+	case sourceErr != nil:
+		job.err = fmt.Errorf("failed to read file: %w", sourceErr)
+	}
+}
+
+// hlsComplete reports whether ffmpeg finished the playlist in dir
+func hlsComplete(dir string) bool {
+	playlist, err := os.ReadFile(filepath.Join(dir, hlsPlaylist))
+	return err == nil && bytes.Contains(playlist, []byte("#EXT-X-ENDLIST"))
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeBin writes an executable shell script called name
+func fakeBin(t *testing.T, name, script string) string {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return bin
+}
+
+// fakeFFmpeg writes one segment and a finished playlist next to the playlist path
+// it's given, counting its runs in runs
+func fakeFFmpeg(t *testing.T, runs string) string {
+	return fakeBin(t, "ffmpeg", `for arg; do playlist="$arg"; done
+dir=$(dirname "$playlist")
+cat > "$dir/segment00000.ts"
+echo run >> `+runs+`
+printf '#EXTM3U\n#EXTINF:6.0,\nsegment00000.ts\n#EXT-X-ENDLIST\n' > "$playlist"`)
+}
+
+func TestHLS(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	runs := filepath.Join(t.TempDir(), "runs")
+	ta.config.Storage.FFmpegPath = fakeFFmpeg(t, runs)
+	user := ta.newUser(t, "owner@example.com")
+	ta.addFile(t, user, "file1", "clip.mp4", []byte("not really a video"))
+
+	for i := 0; i < 2; i++ {
+		w := ta.do(t, http.MethodGet, "/api/v1/stream/file1/hls/playlist.m3u8", user, nil)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "segment00000.ts") {
+			t.Fatalf("playlist: got %d %q", w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("Content-Type"); got != "application/vnd.apple.mpegurl" {
+			t.Errorf("playlist Content-Type %q", got)
+		}
+	}
+	if data, _ := os.ReadFile(runs); strings.Count(string(data), "run") != 1 {
+		t.Errorf("ffmpeg ran %d times, want the finished output reused", strings.Count(string(data), "run"))
+	}
+
+	w := ta.do(t, http.MethodGet, "/api/v1/stream/file1/hls/segment00000.ts", user, nil)
+	if w.Code != http.StatusOK || w.Body.String() != "not really a video" || w.Header().Get("Content-Type") != "video/mp2t" {
+		t.Errorf("segment: got %d %q as %q", w.Code, w.Body.String(), w.Header().Get("Content-Type"))
+	}
+	for _, name := range []string{"segment00001.ts", "source"} {
+		if w := ta.do(t, http.MethodGet, "/api/v1/stream/file1/hls/"+name, user, nil); w.Code != http.StatusNotFound {
+			t.Errorf("%s: got %d, want 404", name, w.Code)
+		}
+	}
+}
+
+func TestHLSWithoutFFmpeg(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	ta.config.Storage.FFmpegPath = filepath.Join(t.TempDir(), "ffmpeg")
+	user := ta.newUser(t, "owner@example.com")
+	ta.addFile(t, user, "file1", "clip.mp4", []byte("video"))
+
+	if w := ta.do(t, http.MethodGet, "/api/v1/stream/file1/hls/playlist.m3u8", user, nil); w.Code != http.StatusNotImplemented {
+		t.Errorf("got %d, want 501", w.Code)
+	}
+}
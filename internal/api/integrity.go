@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/nabilulilalbab/rclonestorage/internal/storage"
+)
+
+// verifyAlgorithms are the hashes a stored upload is checked with, in the order the
+// provider is asked for them. Drive keeps md5, OneDrive sha1, Mega neither, in
+// which case only the size is compared.
+var verifyAlgorithms = []string{storage.HashMD5, storage.HashSHA1}
+
+// errUploadMismatch is returned when the stored copy of an upload differs from the
+// bytes that were sent
+var errUploadMismatch = errors.New("stored copy doesn't match the upload")
+
+// newUploadDigest returns a digest of the bytes sent to cloud storage
+func newUploadDigest() *storage.Digest {
+	digest, err := storage.NewDigest(verifyAlgorithms...)
+	if err != nil {
+		panic(err) // verifyAlgorithms are all supported
+	}
+	return digest
+}
+
+// verifyStored checks object as stored on provider against the bytes sent, using the
+// first of verifyAlgorithms the provider keeps and the size when it keeps none or
+// isn't an rclone remote
+func (a *API) verifyStored(ctx context.Context, provider, object string, sent *storage.Digest) error {
+	if remotePath, ok := a.objectPath(provider, object); ok {
+		for _, algorithm := range verifyAlgorithms {
+			stored, err := storage.RemoteHash(ctx, a.rclone, remotePath, algorithm, false)
+			if err != nil {
+				return fmt.Errorf("failed to verify upload: %w", err)
+			}
+			if stored == "" {
+				continue
+			}
+			if expected := sent.Sum(algorithm); stored != expected {
+				return fmt.Errorf("%w: %s is %s, expected %s", errUploadMismatch, algorithm, stored, expected)
+			}
+			return nil
+		}
+	}
+
+	stored, err := a.statObject(ctx, provider, object)
+	if storage.IsNotFound(err) {
+		return fmt.Errorf("%w: object not found", errUploadMismatch)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to verify upload: %w", err)
+	}
+	if stored.Size != sent.Size {
+		return fmt.Errorf("%w: %d bytes stored, expected %d", errUploadMismatch, stored.Size, sent.Size)
+	}
+	return nil
+}
+
+// storeObject uploads the local file at localPath as object on provider, encrypted
+// when uploads are, checks the stored copy and returns how it was encrypted. A copy
+// that can't be confirmed is removed.
+func (a *API) storeObject(ctx context.Context, localPath, provider, object string) (*sealing, error) {
+	s, sent, err := a.sendObject(ctx, localPath, provider, object)
+	if err == nil {
+		err = a.verifyStored(ctx, provider, object, sent)
+		if err != nil {
+			a.deleteRemote(provider, object)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// sendObject uploads a local file as object on provider and returns a digest of the
+// bytes sent
+func (a *API) sendObject(ctx context.Context, localPath, provider, object string) (*sealing, *storage.Digest, error) {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s, err := a.newSealing(info.Size())
+	if err != nil {
+		return nil, nil, err
+	}
+	sealed, err := a.seal(file, s)
+	if err != nil {
+		return nil, nil, err
+	}
+	sent := newUploadDigest()
+	if _, err := a.putObject(ctx, provider, object, io.TeeReader(sealed, sent)); err != nil {
+		return nil, nil, fmt.Errorf("failed to upload %s: %w", object, err)
+	}
+	return s, sent, nil
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStoreObjectVerifiesCopy(t *testing.T) {
+	for _, tt := range []struct {
+		hashes bool
+		detail string // how the mismatch is found
+	}{
+		{true, "md5"},
+		{false, "bytes stored"},
+	} {
+		ta := newTestAPI(t, nil)
+		ta.rclone.hashes = tt.hashes
+		localPath := filepath.Join(t.TempDir(), "upload")
+		if err := os.WriteFile(localPath, []byte("the bytes that were sent"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		ctx := context.Background()
+
+		if _, err := ta.storeObject(ctx, localPath, testProvider, "good.txt"); err != nil {
+			t.Errorf("hashes %v: intact copy rejected: %v", tt.hashes, err)
+		}
+
+		ta.rclone.truncate = true
+		_, err := ta.storeObject(ctx, localPath, testProvider, "cut.txt")
+		if !errors.Is(err, errUploadMismatch) || !strings.Contains(err.Error(), tt.detail) {
+			t.Errorf("hashes %v: got %v, want errUploadMismatch by %s", tt.hashes, err, tt.detail)
+		}
+		if _, err := ta.statObject(ctx, testProvider, "cut.txt"); err == nil {
+			t.Errorf("hashes %v: mismatched copy kept", tt.hashes)
+		}
+	}
+}
+
+func TestUploadRecordsVerifiedChecksum(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	ta.rclone.hashes = true
+	user := ta.newUser(t, "owner@example.com")
+
+	record := uploadRecord(t, ta, user, "hello.txt", []byte("hello"))
+	if record.ChecksumAlgorithm != "sha256" || record.Checksum != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Errorf("recorded %s %q, want the sha256 of the upload", record.ChecksumAlgorithm, record.Checksum)
+	}
+
+	ta.rclone.truncate = true
+	if w := ta.upload(t, user, "cut.txt", []byte("cut short"), ""); w.Code != http.StatusInternalServerError {
+		t.Errorf("mismatched upload: got %d, want 500", w.Code)
+	}
+	if _, total, err := ta.db.ListUserFiles(user.ID, 0, 10, "name", "asc"); err != nil || total != 1 {
+		t.Errorf("recorded %d files (%v), want only the verified one", total, err)
+	}
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+	"github.com/nabilulilalbab/rclonestorage/internal/jobs"
+)
+
+// ownedJob looks up a job and checks the current user may act on it, writing the error response if not
+func (a *API) ownedJob(c *gin.Context) (jobs.Job, bool) {
+	user, exists := auth.GetCurrentUser(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Authentication required",
+		})
+		return jobs.Job{}, false
+	}
+
+	job, err := a.jobs.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Job not found",
+		})
+		return jobs.Job{}, false
+	}
+
+	if job.UserID != user.ID && !user.IsAdmin() {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Access denied - not job owner",
+		})
+		return jobs.Job{}, false
+	}
+
+	return job, true
+}
+
+// handleGetJob returns the status of a background job
+// @Summary Get job status
+// @Description Get the status of a background upload job. Failed uploads are retried with backoff, a job waiting for its next attempt has status "retrying" with attempts, max_attempts, next_retry_at and the last error (owner or admin only)
+// @Tags jobs
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Job ID"
+// @Success 200 {object} map[string]interface{} "Job status"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - not job owner"
+// @Failure 404 {object} map[string]interface{} "Job not found"
+// @Router /jobs/{id} [get]
+func (a *API) handleGetJob(c *gin.Context) {
+	job, ok := a.ownedJob(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"job": job,
+	})
+}
+
+// handleCancelJob cancels a running background job
+// @Summary Cancel job
+// @Description Cancel a running background job, stopping the rclone process and removing partial uploads (owner or admin only)
+// @Tags jobs
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Job ID"
+// @Success 200 {object} map[string]interface{} "Job cancelled"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - not job owner"
+// @Failure 404 {object} map[string]interface{} "Job not found"
+// @Failure 409 {object} map[string]interface{} "Job already finished"
+// @Router /jobs/{id} [delete]
+func (a *API) handleCancelJob(c *gin.Context) {
+	job, ok := a.ownedJob(c)
+	if !ok {
+		return
+	}
+
+	job, err := a.jobs.Cancel(job.ID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, jobs.ErrNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, jobs.ErrFinished):
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"error":   "Failed to cancel job",
+			"details": err.Error(),
+			"job":     job,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Job cancelled",
+		"job":     job,
+	})
+}
+
+// notifyJobFailure tells the owner of an upload job that it failed for good
+func (a *API) notifyJobFailure(job jobs.Job) {
+	if job.Type != jobs.TypeUpload {
+		return
+	}
+
+	name := uploadedName(path.Base(job.Target), nil)
+	a.authManager.Notifier.Notify(job.UserID, auth.NotifyUploadFailed, "Upload failed",
+		fmt.Sprintf("Your upload of %s failed after %d attempts and was discarded: %s", name, job.Attempts, job.Error))
+}
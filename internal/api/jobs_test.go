@@ -0,0 +1,35 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/nabilulilalbab/rclonestorage/internal/jobs"
+)
+
+func TestCancelJobEndpoint(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	owner := ta.newUser(t, "owner@example.com")
+	other := ta.newUser(t, "other@example.com")
+	job := ta.jobs.Start(owner.ID, jobs.TypeUpload, "union:uploads/f1", func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, nil)
+
+	if w := ta.do(t, http.MethodDelete, "/api/v1/jobs/"+job.ID, other, nil); w.Code != http.StatusForbidden {
+		t.Errorf("other user: got %d, want 403", w.Code)
+	}
+	if w := ta.do(t, http.MethodDelete, "/api/v1/jobs/"+job.ID, owner, nil); w.Code != http.StatusOK {
+		t.Fatalf("owner: got %d: %s", w.Code, w.Body.String())
+	}
+	if got, _ := ta.jobs.Get(job.ID); got.Status != jobs.StatusCancelled {
+		t.Errorf("job %s, want cancelled", got.Status)
+	}
+	if w := ta.do(t, http.MethodDelete, "/api/v1/jobs/"+job.ID, owner, nil); w.Code != http.StatusConflict {
+		t.Errorf("cancelled job: got %d, want 409", w.Code)
+	}
+	if w := ta.do(t, http.MethodDelete, "/api/v1/jobs/missing", owner, nil); w.Code != http.StatusNotFound {
+		t.Errorf("unknown job: got %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,250 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+	"github.com/nabilulilalbab/rclonestorage/internal/crypt"
+	"github.com/nabilulilalbab/rclonestorage/internal/logging"
+)
+
+// Listing sources
+const (
+	listSourceDB    = "db"
+	listSourceCloud = "cloud"
+)
+
+// dbEntries lists the files matching filter from the ownership database
+func (a *API) dbEntries(filter auth.FileFilter) ([]gin.H, error) {
+	var entries []gin.H
+	cursor := ""
+	for {
+		files, next, err := a.authManager.DatabaseManager.SearchFilesAfter(filter, cursor, maxPageLimit)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			entries = append(entries, gin.H{
+				"id":                 file.FileID,
+				"name":               file.Filename,
+				"filename":           file.Object(),
+				"size":               file.Size,
+				"modified":           file.CreatedAt.Format(time.RFC3339Nano),
+				"mime_type":          file.MimeType,
+				"provider":           file.Provider,
+				"owner_id":           file.UserID,
+				"checksum":           file.Checksum,
+				"checksum_algorithm": file.ChecksumAlgorithm,
+				"encrypted":          file.EncryptionKeyID != "",
+				"downloadable":       true,
+			})
+		}
+		if next == "" {
+			return entries, nil
+		}
+		cursor = next
+	}
+}
+
+// cloudEntries lists every file stored on the providers
+func (a *API) cloudEntries() ([]gin.H, error) {
+	rcloneFiles, err := a.listObjects(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files from cloud storage: %w", err)
+	}
+
+	entries := make([]gin.H, 0, len(rcloneFiles))
+	for _, file := range rcloneFiles {
+		if file.IsDir {
+			continue
+		}
+
+		// Extract file ID from filename (format: fileID_originalname), enrichEntries
+		// replaces the name with the recorded one for tracked files
+		fileID := strings.SplitN(file.Name, "_", 2)[0]
+
+		entries = append(entries, gin.H{
+			"id":           fileID,
+			"name":         uploadedName(file.Name, nil),
+			"filename":     file.Name,
+			"size":         file.Size,
+			"modified":     file.ModTime.Format(time.RFC3339Nano),
+			"mime_type":    file.MimeType,
+			"provider":     "union",
+			"downloadable": true,
+		})
+	}
+
+	return entries, nil
+}
+
+// fileRecord returns the ownership record of fileID, or nil when it has none
+func (a *API) fileRecord(fileID string) *auth.FileOwnership {
+	record, err := a.authManager.DatabaseManager.GetFileOwnership(fileID)
+	if err != nil {
+		return nil
+	}
+	return record
+}
+
+// matchesFileID reports whether a stored object belongs to fileID. With an ownership
+// record only the object it names matches, so an unrelated object that happens to
+// start with "<id>_" is never mistaken for the file.
+func matchesFileID(objectName, fileID string, record *auth.FileOwnership) bool {
+	if record != nil {
+		return objectName == record.Object()
+	}
+	return strings.HasPrefix(objectName, fileID+"_")
+}
+
+// uploadedName returns the name a stored object was uploaded under, preferring the
+// ownership record. Otherwise the "<id>_" prefix is stripped, and names without an
+// underscore (objects added out of band) are returned unchanged.
+func uploadedName(objectName string, record *auth.FileOwnership) string {
+	if record != nil && record.Filename != "" {
+		return record.Filename
+	}
+	if parts := strings.SplitN(objectName, "_", 2); len(parts) == 2 {
+		return parts[1]
+	}
+	return objectName
+}
+
+// enrichEntries adds ownership data from dbFiles to cloud entries. An object shared by
+// several files shows the first of them.
+func enrichEntries(cloudFiles, dbFiles []gin.H) []gin.H {
+	byObject := make(map[string]gin.H, len(dbFiles))
+	for _, file := range dbFiles {
+		if _, ok := byObject[file["filename"].(string)]; !ok {
+			byObject[file["filename"].(string)] = file
+		}
+	}
+
+	for _, file := range cloudFiles {
+		record, ok := byObject[file["filename"].(string)]
+		if !ok {
+			file["tracked"] = false
+			continue
+		}
+		file["tracked"] = true
+		file["id"] = record["id"]
+		file["name"] = record["name"]
+		file["owner_id"] = record["owner_id"]
+		file["checksum"] = record["checksum"]
+		file["checksum_algorithm"] = record["checksum_algorithm"]
+		file["encrypted"] = record["encrypted"]
+		// Encrypted objects are larger than their content
+		file["size"] = record["size"]
+	}
+
+	return cloudFiles
+}
+
+// matchingEntries keeps the entries whose name contains search, ignoring case
+func matchingEntries(files []gin.H, search string) []gin.H {
+	search = strings.ToLower(search)
+	matching := make([]gin.H, 0, len(files))
+	for _, file := range files {
+		if strings.Contains(strings.ToLower(file["name"].(string)), search) {
+			matching = append(matching, file)
+		}
+	}
+	return matching
+}
+
+// ownedEntries keeps the entries recorded as owned by userID. Cloud entries missing
+// from the ownership database have no owner and are dropped.
+func ownedEntries(files []gin.H, userID uint) []gin.H {
+	owned := make([]gin.H, 0, len(files))
+	for _, file := range files {
+		if owner, ok := file["owner_id"].(uint); ok && owner == userID {
+			owned = append(owned, file)
+		}
+	}
+	return owned
+}
+
+// reconcileEntries reports where the ownership database and cloud storage disagree.
+// Records are matched to objects by name, as files with the same content share one.
+func reconcileEntries(dbFiles, cloudFiles []gin.H) gin.H {
+	cloudByName := make(map[string]gin.H, len(cloudFiles))
+	for _, file := range cloudFiles {
+		cloudByName[file["filename"].(string)] = file
+	}
+
+	missing := []gin.H{}
+	mismatched := []gin.H{}
+	referenced := make(map[string]bool, len(dbFiles))
+	for _, record := range dbFiles {
+		id := record["id"].(string)
+		object, ok := cloudByName[record["filename"].(string)]
+		if !ok {
+			missing = append(missing, gin.H{"id": id, "name": record["name"], "owner_id": record["owner_id"]})
+			continue
+		}
+		referenced[record["filename"].(string)] = true
+		size := record["size"].(int64)
+		if record["encrypted"] == true {
+			size = crypt.SealedSize(size)
+		}
+		if size != object["size"].(int64) {
+			mismatched = append(mismatched, gin.H{
+				"id":         id,
+				"name":       record["name"],
+				"db_size":    size,
+				"cloud_size": object["size"],
+			})
+		}
+	}
+
+	untracked := []gin.H{}
+	for name, object := range cloudByName {
+		if !referenced[name] {
+			untracked = append(untracked, gin.H{"id": object["id"], "filename": name, "size": object["size"]})
+		}
+	}
+
+	return gin.H{
+		"in_sync":          len(missing) == 0 && len(untracked) == 0 && len(mismatched) == 0,
+		"missing_in_cloud": missing,
+		"untracked":        untracked,
+		"size_mismatch":    mismatched,
+	}
+}
+
+// startReconciler periodically compares the ownership database with cloud storage
+// and logs any drift until Close is called
+func (a *API) startReconciler(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-a.done:
+				return
+			case <-ticker.C:
+				dbFiles, err := a.dbEntries(auth.FileFilter{})
+				if err != nil {
+					logging.Logger.Warnf("Reconcile failed to read database: %v", err)
+					continue
+				}
+				cloudFiles, err := a.cloudEntries()
+				if err != nil {
+					logging.Logger.Warnf("Reconcile failed to list cloud storage: %v", err)
+					continue
+				}
+
+				report := reconcileEntries(dbFiles, cloudFiles)
+				if !report["in_sync"].(bool) {
+					logging.Logger.Warnf("Storage drift detected: %d missing in cloud, %d untracked, %d size mismatches",
+						len(report["missing_in_cloud"].([]gin.H)), len(report["untracked"].([]gin.H)), len(report["size_mismatch"].([]gin.H)))
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+)
+
+func TestListingSources(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	admin := ta.admin(t)
+	user := ta.newUser(t, "owner@example.com")
+	ta.addFile(t, user, "file1", "a.txt", []byte("in both"))
+	// A record whose object is gone, and an object uploaded out of band
+	if err := ta.db.CreateFileOwnership(user.ID, "ghost", "ghost.txt", "union", 5, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	ta.rclone.put(t, ta.unionPath("stray_x.txt"), []byte("untracked"))
+
+	sorted := func(names []string) []string {
+		sort.Strings(names)
+		return names
+	}
+	if got, want := sorted(listedNames(t, ta, admin, "/api/v1/files?source=db")), []string{"a.txt", "ghost.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("db source %v, want %v", got, want)
+	}
+	if got, want := sorted(listedNames(t, ta, admin, "/api/v1/files?source=cloud")), []string{"a.txt", "x.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("cloud source %v, want %v", got, want)
+	}
+	// Users only see their own files, which untracked objects aren't
+	if got, want := listedNames(t, ta, user, "/api/v1/files?source=cloud"), []string{"a.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("cloud source for the owner %v, want %v", got, want)
+	}
+	if w := ta.do(t, http.MethodGet, "/api/v1/files?source=s3", admin, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown source: got %d, want 400", w.Code)
+	}
+}
+
+func TestListingReconcile(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	admin := ta.admin(t)
+	user := ta.newUser(t, "owner@example.com")
+	ta.addFile(t, user, "file1", "a.txt", []byte("in both"))
+	ta.addFile(t, user, "file2", "b.txt", []byte("resized"))
+	ta.rclone.put(t, ta.unionPath("file2_b.txt"), []byte("resized later"))
+	if err := ta.db.CreateFileOwnership(user.ID, "ghost", "ghost.txt", "union", 5, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	ta.rclone.put(t, ta.unionPath("stray_x.txt"), []byte("untracked"))
+
+	w := ta.do(t, http.MethodGet, "/api/v1/files?reconcile=true", admin, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		Reconcile struct {
+			InSync  bool `json:"in_sync"`
+			Missing []struct {
+				ID string `json:"id"`
+			} `json:"missing_in_cloud"`
+			Untracked []struct {
+				Filename string `json:"filename"`
+			} `json:"untracked"`
+			SizeMismatch []struct {
+				ID        string `json:"id"`
+				DBSize    int64  `json:"db_size"`
+				CloudSize int64  `json:"cloud_size"`
+			} `json:"size_mismatch"`
+		} `json:"reconcile"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	report := response.Reconcile
+	if report.InSync {
+		t.Error("reported in sync")
+	}
+	if len(report.Missing) != 1 || report.Missing[0].ID != "ghost" {
+		t.Errorf("missing in cloud %+v, want ghost", report.Missing)
+	}
+	if len(report.Untracked) != 1 || report.Untracked[0].Filename != "stray_x.txt" {
+		t.Errorf("untracked %+v, want stray_x.txt", report.Untracked)
+	}
+	if len(report.SizeMismatch) != 1 || report.SizeMismatch[0].ID != "file2" || report.SizeMismatch[0].DBSize != 7 || report.SizeMismatch[0].CloudSize != 13 {
+		t.Errorf("size mismatches %+v, want file2 at 7 and 13 bytes", report.SizeMismatch)
+	}
+
+	// Only admins get the report
+	w = ta.do(t, http.MethodGet, "/api/v1/files?reconcile=true", user, nil)
+	var owner map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &owner); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("owner: got %d: %s", w.Code, w.Body.String())
+	}
+	if _, ok := owner["reconcile"]; ok {
+		t.Error("non-admin got a reconcile report")
+	}
+}
+
+func TestUploadedName(t *testing.T) {
+	record := &auth.FileOwnership{FileID: "abc", Filename: "my_report.txt"}
+	tests := []struct {
+		object string
+		record *auth.FileOwnership
+		want   string
+	}{
+		{"abc_my_report.txt", record, "my_report.txt"},
+		{"abc_my_report.txt", nil, "my_report.txt"},
+		{"id1_hello world.txt", nil, "hello world.txt"},
+		{"outofband.txt", nil, "outofband.txt"},
+		{"outofband.txt", &auth.FileOwnership{FileID: "x"}, "outofband.txt"},
+	}
+	for _, tt := range tests {
+		if got := uploadedName(tt.object, tt.record); got != tt.want {
+			t.Errorf("uploadedName(%q) = %q, want %q", tt.object, got, tt.want)
+		}
+	}
+}
+
+func TestGetFileInfoIgnoresAmbiguousPrefix(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	user := ta.newUser(t, "owner@example.com")
+	// An out-of-band object sorts before the file and starts with its id
+	ta.rclone.put(t, ta.unionPath("abc_a.txt"), []byte("impostor"))
+	ta.addFile(t, user, "abc", "report.txt", []byte("the real file"))
+
+	info, err := ta.getFileInfo("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Filename != "abc_report.txt" || info.Name != "report.txt" || info.Size != int64(len("the real file")) {
+		t.Errorf("got %+v, want the recorded abc_report.txt", info)
+	}
+
+	// Without a record the prefix is all there is to go by
+	info, err = ta.getFileInfo("stray")
+	if err == nil {
+		t.Errorf("got %+v for an unknown id, want an error", info)
+	}
+	ta.rclone.put(t, ta.unionPath("stray_b.txt"), []byte("out of band"))
+	if info, err := ta.getFileInfo("stray"); err != nil || info.Name != "b.txt" {
+		t.Errorf("got %+v, %v, want b.txt", info, err)
+	}
+}
+
+func TestListingScopedToCaller(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	owner := ta.newUser(t, "owner@example.com")
+	other := ta.newUser(t, "other@example.com")
+	ta.addFile(t, owner, "file1", "mine.txt", []byte("mine"))
+	ta.addFile(t, other, "file2", "theirs.txt", []byte("theirs"))
+	// Objects without an owner only show up for admins
+	ta.rclone.put(t, ta.unionPath("stray_object.txt"), []byte("stray"))
+
+	if got := listedNames(t, ta, owner, "/api/v1/files"); !reflect.DeepEqual(got, []string{"mine.txt"}) {
+		t.Errorf("owner: got %v, want only their file", got)
+	}
+	if got := listedNames(t, ta, owner, "/api/v1/files?source=cloud"); !reflect.DeepEqual(got, []string{"mine.txt"}) {
+		t.Errorf("owner from the cloud: got %v, want only their file", got)
+	}
+	if got := listedNames(t, ta, ta.admin(t), "/api/v1/files"); len(got) != 2 {
+		t.Errorf("admin: got %v, want every recorded file", got)
+	}
+	if w := ta.do(t, http.MethodGet, "/api/v1/files", nil, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous: got %d, want 401", w.Code)
+	}
+
+	w := ta.do(t, http.MethodGet, "/api/v1/files?reconcile=true", owner, nil)
+	var listing map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &listing); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := listing["reconcile"]; ok {
+		t.Error("reconciled the listing for a user who isn't an admin")
+	}
+
+	w = ta.do(t, http.MethodGet, "/api/v1/my-files", owner, nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "mine.txt") || strings.Contains(w.Body.String(), "theirs.txt") {
+		t.Errorf("my-files: got %d: %s", w.Code, w.Body.String())
+	}
+}
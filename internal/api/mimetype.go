@@ -0,0 +1,145 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// extensionTypes covers common formats missing from Go's built-in table, which
+// otherwise depends on the system's mime.types
+var extensionTypes = map[string]string{
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".mkv":  "video/x-matroska",
+	".avi":  "video/x-msvideo",
+	".mov":  "video/quicktime",
+	".wmv":  "video/x-ms-wmv",
+	".flv":  "video/x-flv",
+	".webm": "video/webm",
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".aac":  "audio/aac",
+	".flac": "audio/flac",
+	".wav":  "audio/wav",
+	".ogg":  "audio/ogg",
+	".txt":  "text/plain; charset=utf-8",
+	".md":   "text/markdown; charset=utf-8",
+	".csv":  "text/csv; charset=utf-8",
+	".log":  "text/plain; charset=utf-8",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".epub": "application/epub+zip",
+}
+
+// extensionType returns the MIME type the extension of filename suggests, empty when
+// it is unknown
+func extensionType(filename string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if mimeType, ok := extensionTypes[ext]; ok {
+		return mimeType
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// detectMimeType determines the MIME type of the file at path, see sniffMimeType
+func detectMimeType(path, filename string) string {
+	var head []byte
+	if file, err := os.Open(path); err == nil {
+		head = readHead(file)
+		file.Close()
+	}
+	return sniffMimeType(head, filename)
+}
+
+// readHead returns the first 512 bytes of r, all that content sniffing looks at
+func readHead(r io.Reader) []byte {
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(r, head)
+	return head[:n]
+}
+
+// sniffMimeType determines a MIME type from the first bytes of a file, so a renamed
+// file keeps its real type. The extension of filename only refines what the content
+// can't tell apart: a text format, a ZIP-based document or a media container, and
+// names the type when the content isn't recognized.
+func sniffMimeType(head []byte, filename string) string {
+	byExtension := extensionType(filename)
+	sniffed := "application/octet-stream"
+	if len(head) > 0 {
+		sniffed = http.DetectContentType(head)
+	}
+
+	sniffedMajor, _, _ := strings.Cut(sniffed, "/")
+	extensionMajor, _, _ := strings.Cut(byExtension, "/")
+	switch {
+	case byExtension == "":
+		return sniffed
+	case sniffed == "application/octet-stream":
+		return byExtension
+	case strings.HasPrefix(sniffed, "text/") && isTextType(byExtension):
+		return byExtension
+	case sniffed == "application/zip" && extensionMajor == "application":
+		return byExtension
+	case (sniffedMajor == "video" || sniffedMajor == "audio") && (extensionMajor == "video" || extensionMajor == "audio"):
+		return byExtension
+	}
+	return sniffed
+}
+
+// isTextType reports whether a MIME type is a textual format
+func isTextType(mimeType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(mimeType)
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+xml"), strings.HasSuffix(mediaType, "+json"):
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/xml", "application/javascript", "application/x-yaml", "application/yaml":
+		return true
+	}
+	return false
+}
+
+// errUploadTypeRejected is returned for uploads BLOCKED_EXTENSIONS or
+// ALLOWED_MIME_TYPES turn away
+var errUploadTypeRejected = errors.New("file type not allowed")
+
+// checkUploadName rejects a filename with one of BLOCKED_EXTENSIONS
+func (a *API) checkUploadName(filename string) error {
+	ext := strings.ToLower(filepath.Ext(filename))
+	for _, blocked := range a.config.Storage.BlockedExtensions {
+		if ext == blocked {
+			return fmt.Errorf("%w: %s files are blocked", errUploadTypeRejected, ext)
+		}
+	}
+	return nil
+}
+
+// checkUploadType rejects content whose detected MIME type isn't one of
+// ALLOWED_MIME_TYPES, any type passes when none are configured
+func (a *API) checkUploadType(mimeType string) error {
+	allowed := a.config.Storage.AllowedMimeTypes
+	if len(allowed) == 0 {
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		mediaType = mimeType
+	}
+	major, _, _ := strings.Cut(mediaType, "/")
+	for _, pattern := range allowed {
+		if pattern == mediaType || pattern == major+"/*" {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s content is not accepted", errUploadTypeRejected, mediaType)
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"net/http"
+	"testing"
+)
+
+func TestSniffMimeType(t *testing.T) {
+	var pngData bytes.Buffer
+	if err := png.Encode(&pngData, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	pdf := []byte("%PDF-1.7\n")
+	zipData := []byte("PK\x03\x04\x14\x00\x00\x00")
+
+	for _, tt := range []struct {
+		head     []byte
+		filename string
+		want     string
+	}{
+		{pngData.Bytes(), "photo.png", "image/png"},
+		{pngData.Bytes(), "renamed.txt", "image/png"},
+		{pdf, "invoice.jpg", "application/pdf"},
+		{[]byte("# Notes\n"), "notes.md", "text/markdown; charset=utf-8"},
+		{[]byte(`{"a": 1}`), "data.json", "application/json"},
+		{zipData, "report.docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{zipData, "archive.txt", "application/zip"},
+		{nil, "clip.mkv", "video/x-matroska"},
+		{[]byte{0x00, 0x01, 0x02}, "blob.unknownext", "application/octet-stream"},
+	} {
+		if got := sniffMimeType(tt.head, tt.filename); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestUploadDetectsContentType(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	user := ta.newUser(t, "owner@example.com")
+	var pngData bytes.Buffer
+	if err := png.Encode(&pngData, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+
+	w := ta.upload(t, user, "photo.txt", pngData.Bytes(), "")
+	var uploaded struct {
+		FileID   string `json:"file_id"`
+		MimeType string `json:"mime_type"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &uploaded); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("upload: got %d: %s", w.Code, w.Body.String())
+	}
+	if uploaded.MimeType != "image/png" {
+		t.Errorf("upload: got %q, want image/png", uploaded.MimeType)
+	}
+	if record, err := ta.db.GetFileOwnership(uploaded.FileID); err != nil || record.MimeType != "image/png" {
+		t.Errorf("recorded %+v (%v), want image/png", record, err)
+	}
+
+	w = ta.do(t, http.MethodGet, "/api/v1/files/"+uploaded.FileID, user, nil)
+	var info struct {
+		File struct {
+			MimeType string `json:"mime_type"`
+		} `json:"file"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("file info: got %d: %s", w.Code, w.Body.String())
+	}
+	if info.File.MimeType != "image/png" {
+		t.Errorf("file info: got %q, want image/png", info.File.MimeType)
+	}
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"io"
+	"path"
+
+	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+	"github.com/nabilulilalbab/rclonestorage/internal/storage"
+)
+
+// Uploaded objects are read and written through the injected storage. Reads go to the
+// union, which finds the object on whichever provider holds a copy; writes go to the
+// provider the upload was placed on, or to the union when none was picked.
+
+// objectKey returns the path of an uploaded object within a provider, of the uploads
+// directory when object is empty
+func (a *API) objectKey(object string) string {
+	return path.Join(a.config.Storage.UploadsPath, object)
+}
+
+// objectStore returns the provider an object recorded on provider lives on. Files
+// recorded on the union, or on a provider since removed, are looked up on all of them.
+func (a *API) objectStore(provider string) storage.StorageProvider {
+	if store := a.storage.GetProvider(provider); store != nil {
+		return store
+	}
+	return a.storage
+}
+
+// listObjects lists the uploaded objects of every provider
+func (a *API) listObjects(ctx context.Context) ([]*storage.FileInfo, error) {
+	return a.storage.List(ctx, a.objectKey(""))
+}
+
+// findObject returns the stored object of a file, nil when no provider has it
+func (a *API) findObject(ctx context.Context, fileID string, record *auth.FileOwnership) (*storage.FileInfo, error) {
+	files, err := a.listObjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if matchesFileID(file.Name, fileID, record) {
+			return file, nil
+		}
+	}
+	return nil, nil
+}
+
+// statObject returns the stored object on provider
+func (a *API) statObject(ctx context.Context, provider, object string) (*storage.FileInfo, error) {
+	return a.objectStore(provider).Stat(ctx, a.objectKey(object))
+}
+
+// openObject streams an object, only bytes rng.Start-rng.End when rng is set
+func (a *API) openObject(ctx context.Context, object string, rng *storage.RangeSpec) (io.ReadCloser, error) {
+	return a.storage.Download(ctx, a.objectKey(object), storage.DownloadOptions{Range: rng})
+}
+
+// putObject stores the content of reader as object on provider
+func (a *API) putObject(ctx context.Context, provider, object string, reader io.Reader) (*storage.FileInfo, error) {
+	return a.objectStore(provider).Upload(ctx, reader, a.objectKey(object), storage.UploadOptions{Filename: object})
+}
+
+// deleteObject removes object from provider, from every provider holding a copy when
+// it was recorded on the union
+func (a *API) deleteObject(ctx context.Context, provider, object string) error {
+	return a.objectStore(provider).Delete(ctx, a.objectKey(object))
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// useMemProvider swaps the provider of ta for an in-memory one, so any object the
+// handlers reach without going through the injected storage is missing
+func useMemProvider(t *testing.T, ta *testAPI) *memProvider {
+	t.Helper()
+	mem := newMemProvider("memory")
+	if err := ta.storage.RemoveProvider(testProvider); err != nil {
+		t.Fatal(err)
+	}
+	if err := ta.storage.AddProvider(mem); err != nil {
+		t.Fatal(err)
+	}
+	return mem
+}
+
+func TestHandlersUseInjectedStorage(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	mem := useMemProvider(t, ta)
+	user := ta.newUser(t, "owner@example.com")
+	content := []byte("stored through the injected storage\n")
+
+	w := ta.upload(t, user, "notes.txt", content, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload: got %d: %s", w.Code, w.Body.String())
+	}
+	var uploaded struct {
+		FileID   string `json:"file_id"`
+		Provider string `json:"provider"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &uploaded); err != nil {
+		t.Fatal(err)
+	}
+	if uploaded.Provider != mem.Name() {
+		t.Errorf("upload went to %q, want %q", uploaded.Provider, mem.Name())
+	}
+	key := ta.objectKey(uploaded.FileID + "_notes.txt")
+	if stored, ok := mem.object(key); !ok || !bytes.Equal(stored, content) {
+		t.Fatalf("provider holds %q at %s, want %q", stored, key, content)
+	}
+
+	if w := ta.do(t, http.MethodGet, "/api/v1/files/"+uploaded.FileID, user, nil); w.Code != http.StatusOK {
+		t.Errorf("get file: got %d: %s", w.Code, w.Body.String())
+	}
+	w = ta.do(t, http.MethodGet, "/api/v1/download/"+uploaded.FileID, user, nil)
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), content) {
+		t.Errorf("download: got %d %q, want %q", w.Code, w.Body.String(), content)
+	}
+
+	if w := ta.do(t, http.MethodDelete, "/api/v1/files/"+uploaded.FileID, user, nil); w.Code != http.StatusOK {
+		t.Fatalf("delete: got %d: %s", w.Code, w.Body.String())
+	}
+	if _, ok := mem.object(key); ok {
+		t.Errorf("%s is still stored after the delete", key)
+	}
+	if len(ta.rclone.used()) != 0 {
+		t.Errorf("handlers ran rclone on %v", ta.rclone.used())
+	}
+}
+
+func TestCustomUnionName(t *testing.T) {
+	cfg := testConfig(t.TempDir())
+	cfg.Storage.UnionName = "vault"
+	cfg.Storage.UploadsPath = "media/files"
+	ta := newTestAPI(t, cfg)
+	user := ta.newUser(t, "owner@example.com")
+
+	w := ta.upload(t, user, "a.txt", []byte("hello"), "")
+	var uploaded struct {
+		FileID     string `json:"file_id"`
+		RemotePath string `json:"remote_path"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &uploaded); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("upload: got %d: %s", w.Code, w.Body.String())
+	}
+	if want := "vault:media/files/" + uploaded.FileID + "_a.txt"; uploaded.RemotePath != want {
+		t.Errorf("got remote path %q, want %q", uploaded.RemotePath, want)
+	}
+	if w := ta.do(t, http.MethodGet, "/api/v1/download/"+uploaded.FileID, user, nil); w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Errorf("download: got %d %q", w.Code, w.Body.String())
+	}
+	if w := ta.do(t, http.MethodGet, "/api/v1/files", user, nil); w.Code != http.StatusOK || !bytes.Contains(w.Body.Bytes(), []byte(uploaded.FileID)) {
+		t.Errorf("list: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := ta.do(t, http.MethodDelete, "/api/v1/files/"+uploaded.FileID, user, nil); w.Code != http.StatusOK {
+		t.Errorf("delete: got %d: %s", w.Code, w.Body.String())
+	}
+
+	used := ta.rclone.used()
+	if len(used) == 0 {
+		t.Fatal("rclone was never run")
+	}
+	// Besides the uploads, only the root of the remote is probed
+	for _, remote := range used {
+		name, dir, _ := strings.Cut(remote, ":")
+		if name != "vault" || (dir != "" && dir != "media/files" && !strings.HasPrefix(dir, "media/files/")) {
+			t.Errorf("rclone ran on %s, outside the configured uploads path", remote)
+		}
+	}
+}
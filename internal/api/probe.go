@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/nabilulilalbab/rclonestorage/internal/logging"
+)
+
+// probeTimeout bounds an ffprobe run, which may have to read a file from the cloud
+const probeTimeout = 30 * time.Second
+
+// mediaInfo is what ffprobe reports about a media file, zero fields weren't reported
+type mediaInfo struct {
+	validator string // file version the probe was run on
+
+	Duration      float64 // seconds
+	Bitrate       int64   // bits per second
+	Width         int
+	Height        int
+	Codec         string // video codec, or the audio codec of audio files
+	AudioChannels int
+}
+
+// fields returns the reported values keyed as in the stream info response
+func (m *mediaInfo) fields() map[string]interface{} {
+	fields := make(map[string]interface{})
+	if m.Duration > 0 {
+		fields["duration"] = m.Duration
+	}
+	if m.Bitrate > 0 {
+		fields["bitrate"] = m.Bitrate
+	}
+	if m.Width > 0 && m.Height > 0 {
+		fields["width"] = m.Width
+		fields["height"] = m.Height
+	}
+	if m.Codec != "" {
+		fields["codec"] = m.Codec
+	}
+	if m.AudioChannels > 0 {
+		fields["audio_channels"] = m.AudioChannels
+	}
+	return fields
+}
+
+// ffprobeOutput is the part of ffprobe's JSON output that is read
+type ffprobeOutput struct {
+	Format struct {
+		Duration string `json:"duration"`
+		BitRate  string `json:"bit_rate"`
+	} `json:"format"`
+	Streams []struct {
+		CodecType string `json:"codec_type"`
+		CodecName string `json:"codec_name"`
+		Width     int    `json:"width"`
+		Height    int    `json:"height"`
+		Channels  int    `json:"channels"`
+	} `json:"streams"`
+}
+
+// parseProbe reads the output of ffprobe -print_format json -show_format -show_streams,
+// using the first video and the first audio stream
+func parseProbe(output []byte) (*mediaInfo, error) {
+	var probe ffprobeOutput
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, fmt.Errorf("invalid ffprobe output: %w", err)
+	}
+
+	info := &mediaInfo{}
+	info.Duration, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+	info.Bitrate, _ = strconv.ParseInt(probe.Format.BitRate, 10, 64)
+
+	var audioCodec string
+	for _, stream := range probe.Streams {
+		switch stream.CodecType {
+		case "video":
+			if info.Codec == "" {
+				info.Codec = stream.CodecName
+				info.Width = stream.Width
+				info.Height = stream.Height
+			}
+		case "audio":
+			if audioCodec == "" {
+				audioCodec = stream.CodecName
+				info.AudioChannels = stream.Channels
+			}
+		}
+	}
+	if info.Codec == "" {
+		info.Codec = audioCodec
+	}
+	return info, nil
+}
+
+// probeMedia runs ffprobe on a file, reading the cached copy when there is one and
+// piping it from the cloud otherwise. Results are kept per file until it changes,
+// failed probes included so a file ffprobe can't read isn't fetched on every request.
+// It fails without running anything when ffprobe isn't installed.
+func (a *API) probeMedia(ctx context.Context, fileInfo *FileInfo) (*mediaInfo, error) {
+	validator := fileInfo.cacheValidator()
+	if cached, ok := a.probes.Load(fileInfo.ID); ok && cached.(*mediaInfo).validator == validator {
+		return cached.(*mediaInfo), nil
+	}
+
+	if _, err := exec.LookPath(a.config.Storage.FFprobePath); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	args := []string{"-v", "error", "-print_format", "json", "-show_format", "-show_streams"}
+	var output []byte
+	var err error
+	if reader, entry, cacheErr := a.cache.GetValidated(ctx, fmt.Sprintf("stream_%s", fileInfo.ID), validator); cacheErr == nil {
+		reader.Close()
+		output, err = exec.CommandContext(ctx, a.config.Storage.FFprobePath, append(args, entry.FilePath)...).Output()
+	} else {
+		probe := exec.CommandContext(ctx, a.config.Storage.FFprobePath, append(args, "pipe:0")...)
+		source, catErr := a.catPlain(ctx, fileInfo.Filename, fileInfo.sealing)
+		if catErr != nil {
+			return nil, catErr
+		}
+		probe.Stdin = source
+		output, err = probe.Output()
+		source.Close()
+	}
+
+	info := &mediaInfo{}
+	if err == nil {
+		info, err = parseProbe(output)
+	}
+	if err != nil {
+		logging.FromContext(ctx).WithField("file_id", fileInfo.ID).Warnf("Failed to probe: %v", err)
+		info = &mediaInfo{}
+	}
+	info.validator = validator
+	a.probes.Store(fileInfo.ID, info)
+	return info, nil
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const probeVideo = `{
+	"format": {"duration": "12.500000", "bit_rate": "800000"},
+	"streams": [
+		{"codec_type": "audio", "codec_name": "aac", "channels": 2},
+		{"codec_type": "video", "codec_name": "h264", "width": 1280, "height": 720},
+		{"codec_type": "audio", "codec_name": "mp3", "channels": 1}
+	]
+}`
+
+func TestParseProbe(t *testing.T) {
+	tests := []struct {
+		name, output string
+		want         mediaInfo
+	}{
+		{"video", probeVideo, mediaInfo{Duration: 12.5, Bitrate: 800000, Width: 1280, Height: 720, Codec: "h264", AudioChannels: 2}},
+		{"audio", `{"format": {"duration": "3.0"}, "streams": [{"codec_type": "audio", "codec_name": "opus", "channels": 2}]}`, mediaInfo{Duration: 3, Codec: "opus", AudioChannels: 2}},
+		{"unreported", `{"format": {"duration": "N/A"}}`, mediaInfo{}},
+	}
+	for _, tt := range tests {
+		got, err := parseProbe([]byte(tt.output))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, *got, tt.want)
+		}
+	}
+
+	if _, err := parseProbe([]byte("not json")); err == nil {
+		t.Error("parsed invalid output")
+	}
+}
+
+func TestStreamInfoMedia(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	runs := filepath.Join(t.TempDir(), "runs")
+	ta.config.Storage.FFprobePath = fakeBin(t, "ffprobe", "cat > /dev/null\necho run >> "+runs+"\ncat <<'EOF'\n"+probeVideo+"\nEOF")
+	user := ta.newUser(t, "owner@example.com")
+	ta.addFile(t, user, "file1", "clip.mp4", []byte("not really a video"))
+
+	for i := 0; i < 2; i++ {
+		w := ta.do(t, http.MethodGet, "/api/v1/stream/file1/info", user, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("got %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Info map[string]interface{} `json:"info"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Info["duration"] != 12.5 || resp.Info["codec"] != "h264" || resp.Info["width"] != 1280.0 {
+			t.Errorf("got %v, want the probed fields", resp.Info)
+		}
+	}
+	if data, _ := os.ReadFile(runs); strings.Count(string(data), "run") != 1 {
+		t.Errorf("ffprobe ran %d times, want the result reused", strings.Count(string(data), "run"))
+	}
+
+	// Without ffprobe the media fields are left out
+	ta.config.Storage.FFprobePath = filepath.Join(t.TempDir(), "ffprobe")
+	ta.addFile(t, user, "file2", "other.mp4", []byte("video"))
+	w := ta.do(t, http.MethodGet, "/api/v1/stream/file2/info", user, nil)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "duration") {
+		t.Errorf("without ffprobe: got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+)
+
+// Upload states reported by GET /uploads/:id/progress
+const (
+	progressReceiving = "receiving" // the request body is coming in
+	progressStoring   = "storing"   // every byte arrived, the file is being copied to cloud storage
+	progressCompleted = "completed"
+	progressQueued    = "queued" // handed to a background job, see job_id
+	progressFailed    = "failed"
+)
+
+// progressRetention is how long a finished upload's final state stays visible
+const progressRetention = time.Minute
+
+// errUploadIDInUse is returned when an upload_id is already being tracked
+var errUploadIDInUse = errors.New("upload ID already in use")
+
+// uploadProgress counts the bytes of one upload while they arrive. received is
+// updated by the request reading the body and read by progress requests.
+type uploadProgress struct {
+	userID   uint
+	total    int64 // -1 when the client didn't declare a length
+	received atomic.Int64
+
+	mu     sync.Mutex
+	state  string
+	fileID string
+	jobID  string
+}
+
+func (p *uploadProgress) setState(state string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state = state
+}
+
+// progressTracker holds the uploads in flight and those finished within progressRetention
+type progressTracker struct {
+	mu      sync.Mutex
+	uploads map[string]*uploadProgress
+}
+
+func newProgressTracker() *progressTracker {
+	return &progressTracker{uploads: make(map[string]*uploadProgress)}
+}
+
+// start tracks a new upload, failing if id is taken
+func (t *progressTracker) start(id string, userID uint, total, received int64) (*uploadProgress, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, exists := t.uploads[id]; exists {
+		return nil, errUploadIDInUse
+	}
+	p := &uploadProgress{userID: userID, total: total, state: progressReceiving}
+	p.received.Store(received)
+	t.uploads[id] = p
+	return p, nil
+}
+
+func (t *progressTracker) get(id string) *uploadProgress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.uploads[id]
+}
+
+// finish records the final state of an upload and forgets it after progressRetention
+func (t *progressTracker) finish(id string, p *uploadProgress, state, fileID, jobID string) {
+	p.mu.Lock()
+	p.state, p.fileID, p.jobID = state, fileID, jobID
+	p.mu.Unlock()
+	time.AfterFunc(progressRetention, func() {
+		t.drop(id, p)
+	})
+}
+
+// drop stops tracking an upload, unless id was reused since
+func (t *progressTracker) drop(id string, p *uploadProgress) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.uploads[id] == p {
+		delete(t.uploads, id)
+	}
+}
+
+// progressReader counts the bytes read from a request body
+type progressReader struct {
+	io.ReadCloser
+	progress *uploadProgress
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	r.progress.received.Add(int64(n))
+	return n, err
+}
+
+// trackUpload starts counting the body of a POST /upload sent with an upload_id, and
+// returns a func recording how the request ended. Without an upload_id both are no-ops.
+func (a *API) trackUpload(c *gin.Context, userID uint) (*uploadProgress, func(), error) {
+	id := c.Query("upload_id")
+	if id == "" {
+		return nil, func() {}, nil
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, nil, errors.New("upload_id must be a UUID")
+	}
+
+	p, err := a.progress.start(id, userID, c.Request.ContentLength, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.Request.Body = &progressReader{ReadCloser: c.Request.Body, progress: p}
+
+	// The handler leaves the file and job IDs in the context
+	return p, func() {
+		switch c.Writer.Status() {
+		case http.StatusOK:
+			a.progress.finish(id, p, progressCompleted, c.GetString("upload_file_id"), "")
+		case http.StatusAccepted:
+			a.progress.finish(id, p, progressQueued, c.GetString("upload_file_id"), c.GetString("upload_job_id"))
+		default:
+			a.progress.finish(id, p, progressFailed, "", "")
+		}
+	}, nil
+}
+
+// handleUploadProgress reports how far an upload got
+// @Summary Get upload progress
+// @Description Report the bytes received of an upload in progress: a POST /upload sent with ?upload_id=<uuid> or a resumable upload, including the chunk being sent. received counts the whole request body of a POST /upload, total is its Content-Length (-1 if unknown). state is receiving, storing (copying to cloud storage), completed, queued (see job_id) or failed; finished uploads are kept for a minute
+// @Tags files
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Upload ID"
+// @Success 200 {object} map[string]interface{} "Upload progress"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 404 {object} map[string]interface{} "Upload not found"
+// @Router /uploads/{id}/progress [get]
+func (a *API) handleUploadProgress(c *gin.Context) {
+	id := c.Param("id")
+	userID, _ := auth.GetCurrentUserID(c)
+
+	if p := a.progress.get(id); p != nil && p.userID == userID {
+		p.mu.Lock()
+		state, fileID, jobID := p.state, p.fileID, p.jobID
+		p.mu.Unlock()
+		c.JSON(http.StatusOK, progressResponse(id, state, p.received.Load(), p.total, fileID, jobID))
+		return
+	}
+
+	// Resumable uploads between chunks are only on disk. Unknown IDs don't get a lock.
+	if _, err := uuid.Parse(id); err == nil && a.uploads.exists(id) {
+		unlock := a.uploads.lock(id)
+		upload, ok := a.ownUpload(c, id)
+		unlock()
+		if ok {
+			state := progressReceiving
+			if upload.FileID != "" {
+				state = progressCompleted
+			}
+			c.JSON(http.StatusOK, progressResponse(id, state, upload.Offset, upload.Length, upload.FileID, ""))
+			return
+		}
+	}
+
+	c.JSON(http.StatusNotFound, gin.H{
+		"error":     "Upload not found",
+		"upload_id": id,
+	})
+}
+
+// progressResponse builds the body of a progress report
+func progressResponse(id, state string, received, total int64, fileID, jobID string) gin.H {
+	response := gin.H{
+		"upload_id": id,
+		"state":     state,
+		"received":  received,
+		"total":     total,
+	}
+	if total > 0 {
+		response["percent"] = float64(min(received, total)) * 100 / float64(total)
+	}
+	if fileID != "" {
+		response["file_id"] = fileID
+	}
+	if jobID != "" {
+		response["job_id"] = jobID
+	}
+	return response
+}
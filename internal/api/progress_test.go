@@ -0,0 +1,120 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+)
+
+// uploadState is the body of GET /uploads/:id/progress
+type uploadState struct {
+	State    string `json:"state"`
+	Received int64  `json:"received"`
+	Total    int64  `json:"total"`
+	FileID   string `json:"file_id"`
+}
+
+// getProgress asks for the progress of upload id as user
+func (ta *testAPI) getProgress(t *testing.T, id string, user *auth.User) (int, uploadState) {
+	t.Helper()
+	w := ta.do(t, http.MethodGet, "/api/v1/uploads/"+id+"/progress", user, nil)
+	var state uploadState
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &state); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w.Code, state
+}
+
+func TestUploadProgress(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	user := ta.newUser(t, "owner@example.com")
+	other := ta.newUser(t, "other@example.com")
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "large.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(bytes.Repeat([]byte("x"), 64<<10))
+	form.Close()
+	payload := body.Bytes()
+
+	// The body is sent through a pipe, the first half has been read once written and is
+	// counted right after
+	id := uuid.New().String()
+	reader, writer := io.Pipe()
+	req := ta.request(t, http.MethodPost, "/api/v1/upload?upload_id="+id, user, reader)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.ContentLength = int64(len(payload))
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- serve(ta.registerRoutes, req) }()
+
+	half := len(payload) / 2
+	if _, err := writer.Write(payload[:half]); err != nil {
+		t.Fatal(err)
+	}
+	code, state := ta.getProgress(t, id, user)
+	for deadline := time.Now().Add(5 * time.Second); state.Received < int64(half) && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		code, state = ta.getProgress(t, id, user)
+	}
+	if code != http.StatusOK || state.State != progressReceiving || state.Received < int64(half) || state.Received >= int64(len(payload)) || state.Total != int64(len(payload)) {
+		t.Errorf("mid-upload: got %d %+v, want receiving with %d of %d bytes", code, state, half, len(payload))
+	}
+	if code, _ := ta.getProgress(t, id, other); code != http.StatusNotFound {
+		t.Errorf("other user: got %d, want 404", code)
+	}
+	if w := ta.do(t, http.MethodPost, "/api/v1/upload?upload_id="+id, user, nil); w.Code != http.StatusConflict {
+		t.Errorf("upload_id in use: got %d, want 409", w.Code)
+	}
+
+	writer.Write(payload[half:])
+	writer.Close()
+	w := <-done
+	var uploaded struct {
+		FileID string `json:"file_id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &uploaded); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("upload: got %d: %s", w.Code, w.Body.String())
+	}
+	code, state = ta.getProgress(t, id, user)
+	if code != http.StatusOK || state.State != progressCompleted || state.Received != int64(len(payload)) || state.FileID != uploaded.FileID {
+		t.Errorf("finished: got %d %+v, want completed as %s", code, state, uploaded.FileID)
+	}
+
+	if w := ta.do(t, http.MethodPost, "/api/v1/upload?upload_id=not-a-uuid", user, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid upload_id: got %d, want 400", w.Code)
+	}
+}
+
+func TestTusUploadProgress(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	user := ta.newUser(t, "owner@example.com")
+	location := ta.createUpload(t, user, "notes.txt", 10)
+	id := location[len(location)-36:]
+
+	if w := ta.patchUpload(t, location, user, 0, "12345"); w.Code != http.StatusNoContent {
+		t.Fatalf("first chunk: got %d: %s", w.Code, w.Body.String())
+	}
+	if code, state := ta.getProgress(t, id, user); code != http.StatusOK || state.State != progressReceiving || state.Received != 5 || state.Total != 10 {
+		t.Errorf("between chunks: got %d %+v, want 5 of 10 bytes received", code, state)
+	}
+
+	if w := ta.patchUpload(t, location, user, 5, "67890"); w.Code != http.StatusNoContent {
+		t.Fatalf("last chunk: got %d: %s", w.Code, w.Body.String())
+	}
+	if code, state := ta.getProgress(t, id, user); code != http.StatusOK || state.State != progressCompleted || state.Received != 10 || state.FileID == "" {
+		t.Errorf("finished: got %d %+v, want completed with a file ID", code, state)
+	}
+}
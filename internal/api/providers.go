@@ -0,0 +1,501 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+	"github.com/nabilulilalbab/rclonestorage/internal/logging"
+	"github.com/nabilulilalbab/rclonestorage/internal/storage"
+)
+
+// providerCheckTimeout bounds the reachability check for a new provider
+const providerCheckTimeout = 30 * time.Second
+
+// checkRclone runs the startup check of rclone against the union remote and the
+// providers' remotes. Missing remotes are only warned about: requests to them fail
+// until they are configured, and /health reports them meanwhile.
+func checkRclone(rclone storage.RcloneClient, union string, specs []storage.ProviderSpec) (storage.RcloneStatus, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), providerCheckTimeout)
+	defer cancel()
+
+	needed := []string{union}
+	for _, spec := range specs {
+		needed = append(needed, spec.Remote)
+	}
+	status, err := storage.CheckRclone(ctx, rclone, needed)
+	if err != nil {
+		return status, fmt.Errorf("rclone is not usable: %w", err)
+	}
+	if !status.OK() {
+		logging.Logger.Warnf("rclone config has no remote named %s, files on it can't be reached", strings.Join(status.MissingRemotes, ", "))
+	}
+	return status, nil
+}
+
+// AddProviderRequest represents a request to add a storage provider
+type AddProviderRequest struct {
+	Name   string `json:"name" binding:"required"`
+	Remote string `json:"remote"`
+	Type   string `json:"type"`
+}
+
+// handleListProviders lists the configured storage providers
+// @Summary List storage providers
+// @Description List the storage providers in the union with their last known health (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{} "Configured providers"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - Admin access required"
+// @Router /../admin/providers [get]
+func (a *API) handleListProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"providers": a.providers.Specs(),
+		"total":     len(a.storage.GetProviders()),
+	})
+}
+
+// providerNames returns the names of the providers in the union, sorted
+func (a *API) providerNames() []string {
+	providers := a.storage.GetProviders()
+	names := make([]string, 0, len(providers))
+	for _, provider := range providers {
+		names = append(names, provider.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// handleAddProvider adds a storage provider to the union at runtime
+// @Summary Add storage provider
+// @Description Add an rclone remote to the union after verifying it is reachable. The change is persisted across restarts (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param provider body AddProviderRequest true "Provider definition"
+// @Success 201 {object} map[string]interface{} "Provider added"
+// @Failure 400 {object} map[string]interface{} "Invalid provider"
+// @Failure 409 {object} map[string]interface{} "Provider already exists"
+// @Failure 422 {object} map[string]interface{} "Provider unreachable"
+// @Router /../admin/providers [post]
+func (a *API) handleAddProvider(c *gin.Context) {
+	var req AddProviderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request data",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	spec := storage.ProviderSpec{
+		Name:   req.Name,
+		Remote: req.Remote,
+		Type:   req.Type,
+	}
+	if spec.Remote == "" {
+		spec.Remote = spec.Name
+	}
+	if spec.Type == "" {
+		spec.Type = storage.ProviderTypeFor(spec.Remote)
+	}
+
+	if a.storage.GetProvider(spec.Name) != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":    "Provider already exists",
+			"provider": spec.Name,
+		})
+		return
+	}
+
+	provider, err := storage.NewProviderFromSpec(spec, a.rclone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid provider",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), providerCheckTimeout)
+	defer cancel()
+	if !provider.IsAvailable(ctx) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":    "Provider is not reachable",
+			"provider": spec.Name,
+			"remote":   spec.Remote,
+		})
+		return
+	}
+
+	if err := a.storage.AddProvider(provider); err != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Failed to add provider",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if err := a.providers.Put(spec); err != nil {
+		// Keep runtime and persisted state in step
+		a.storage.RemoveProvider(spec.Name)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to persist provider",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "Provider added successfully",
+		"provider": spec,
+	})
+}
+
+// handleRemoveProvider removes a storage provider from the union at runtime
+// @Summary Remove storage provider
+// @Description Remove a provider from the union. The last remaining provider cannot be removed (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param name path string true "Provider name"
+// @Success 200 {object} map[string]interface{} "Provider removed"
+// @Failure 404 {object} map[string]interface{} "Provider not found"
+// @Failure 409 {object} map[string]interface{} "Cannot remove the last provider"
+// @Router /../admin/providers/{name} [delete]
+func (a *API) handleRemoveProvider(c *gin.Context) {
+	name := c.Param("name")
+
+	if a.storage.GetProvider(name) == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":    "Provider not found",
+			"provider": name,
+		})
+		return
+	}
+
+	if len(a.storage.GetProviders()) <= 1 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":    "Cannot remove the last storage provider",
+			"provider": name,
+		})
+		return
+	}
+
+	if err := a.storage.RemoveProvider(name); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Failed to remove provider",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if err := a.providers.Remove(name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Provider removed but failed to persist change",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Provider removed successfully",
+		"provider": name,
+	})
+}
+
+// RenameProviderRequest represents a request to rename a storage provider
+type RenameProviderRequest struct {
+	NewName string `json:"new_name" binding:"required"`
+	Remote  string `json:"remote"`  // rclone remote of the renamed provider, defaults to new_name
+	DryRun  bool   `json:"dry_run"` // only report the records that would be rewritten
+}
+
+// handleRenameProvider renames a provider without moving any data
+// @Summary Rename storage provider
+// @Description Rename a provider in the union, e.g. after its rclone remote was renamed, and rewrite the provider of the files recorded on it in the same transaction. No data is moved. dry_run previews the affected records (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param name path string true "Current provider name"
+// @Param rename body RenameProviderRequest true "New provider name"
+// @Success 200 {object} map[string]interface{} "Provider renamed, or the dry-run preview"
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 404 {object} map[string]interface{} "Provider not found"
+// @Failure 409 {object} map[string]interface{} "New name already in use"
+// @Failure 422 {object} map[string]interface{} "Provider unreachable under the new remote"
+// @Router /../admin/providers/{name}/rename [post]
+func (a *API) handleRenameProvider(c *gin.Context) {
+	oldName := c.Param("name")
+
+	var req RenameProviderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request data",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	spec, ok := a.providers.Get(oldName)
+	if !ok || a.storage.GetProvider(oldName) == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":    "Provider not found",
+			"provider": oldName,
+		})
+		return
+	}
+
+	if req.NewName == oldName {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "New name must differ from the current name",
+			"provider": oldName,
+		})
+		return
+	}
+	if a.storage.GetProvider(req.NewName) != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":    "Provider already exists",
+			"provider": req.NewName,
+		})
+		return
+	}
+
+	spec.Name = req.NewName
+	spec.Remote = req.Remote
+	if spec.Remote == "" {
+		spec.Remote = spec.Name
+	}
+
+	affected, err := a.authManager.DatabaseManager.FilesByProvider(oldName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to find affected files",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if req.DryRun {
+		fileIDs := make([]string, 0, len(affected))
+		for _, file := range affected {
+			fileIDs = append(fileIDs, file.FileID)
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message":        "Dry run, nothing was changed",
+			"dry_run":        true,
+			"provider":       oldName,
+			"renamed_to":     spec,
+			"affected_files": len(affected),
+			"file_ids":       fileIDs,
+		})
+		return
+	}
+
+	provider, err := storage.NewProviderFromSpec(spec, a.rclone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid provider",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), providerCheckTimeout)
+	defer cancel()
+	if !provider.IsAvailable(ctx) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":    "Provider is not reachable",
+			"provider": spec.Name,
+			"remote":   spec.Remote,
+		})
+		return
+	}
+
+	// The records are committed first, then the union and registry switch over. If
+	// they can't, the records are renamed back.
+	renamed, err := a.authManager.DatabaseManager.RenameFileProvider(oldName, spec.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to rename provider",
+			"details": err.Error(),
+		})
+		return
+	}
+	if err := a.switchProvider(oldName, spec, provider); err != nil {
+		if _, revertErr := a.authManager.DatabaseManager.RenameFileProvider(spec.Name, oldName); revertErr != nil {
+			logging.FromContext(c.Request.Context()).WithField("provider", oldName).Warnf("Failed to restore file records: %v", revertErr)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to rename provider",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Provider renamed successfully",
+		"provider":       oldName,
+		"renamed_to":     spec,
+		"affected_files": renamed,
+	})
+}
+
+// switchProvider replaces provider oldName by provider, registered as spec, in the
+// union and the registry
+func (a *API) switchProvider(oldName string, spec storage.ProviderSpec, provider storage.StorageProvider) error {
+	if err := a.storage.AddProvider(provider); err != nil {
+		return err
+	}
+	if err := a.providers.Rename(oldName, spec); err != nil {
+		a.storage.RemoveProvider(spec.Name)
+		return err
+	}
+	a.storage.RemoveProvider(oldName)
+	return nil
+}
+
+// remoteSize reports the object count and total bytes under a remote's uploads directory
+func (a *API) remoteSize(ctx context.Context, remote string) (int64, int64, error) {
+	output, err := a.rclone.Command(ctx, "size", "--json", a.config.Storage.ObjectPath(remote, "")).Output()
+	if err != nil {
+		return 0, 0, fmt.Errorf("rclone size failed: %w", err)
+	}
+
+	var size struct {
+		Count int64 `json:"count"`
+		Bytes int64 `json:"bytes"`
+	}
+	if err := json.Unmarshal(output, &size); err != nil {
+		return 0, 0, fmt.Errorf("failed to parse rclone size output: %w", err)
+	}
+	return size.Count, size.Bytes, nil
+}
+
+// distribution merges the recorded usage with the measured size of each configured
+// provider. Records on names that are not a configured provider, e.g. files uploaded
+// through the union remote, are reported as unattributed. measure may be nil to skip
+// the cloud check.
+func distribution(specs []storage.ProviderSpec, recorded []auth.ProviderUsage, measure func(remote string) (int64, int64, error)) gin.H {
+	byName := make(map[string]auth.ProviderUsage, len(recorded))
+	for _, usage := range recorded {
+		byName[usage.Provider] = usage
+	}
+
+	providers := make([]gin.H, 0, len(specs))
+	var cloudBytes []int64
+	for _, spec := range specs {
+		usage := byName[spec.Name]
+		delete(byName, spec.Name)
+
+		entry := gin.H{
+			"name":           spec.Name,
+			"remote":         spec.Remote,
+			"recorded_files": usage.Files,
+			"recorded_bytes": usage.Bytes,
+		}
+		if measure != nil {
+			if files, bytes, err := measure(spec.Remote); err != nil {
+				entry["cloud_error"] = err.Error()
+			} else {
+				entry["cloud_files"] = files
+				entry["cloud_bytes"] = bytes
+				cloudBytes = append(cloudBytes, bytes)
+			}
+		}
+		providers = append(providers, entry)
+	}
+
+	unattributed := make([]auth.ProviderUsage, 0, len(byName))
+	var totalFiles, totalBytes int64
+	for _, usage := range recorded {
+		totalFiles += usage.Files
+		totalBytes += usage.Bytes
+		if _, ok := byName[usage.Provider]; ok {
+			unattributed = append(unattributed, usage)
+		}
+	}
+
+	return gin.H{
+		"providers":    providers,
+		"unattributed": unattributed,
+		"total_files":  totalFiles,
+		"total_bytes":  totalBytes,
+		"balance_skew": balanceSkew(cloudBytes),
+	}
+}
+
+// balanceSkew is the spread between the fullest and emptiest provider relative to
+// the mean: 0 when perfectly balanced, 2 when one of two providers holds everything
+func balanceSkew(sizes []int64) float64 {
+	if len(sizes) < 2 {
+		return 0
+	}
+
+	var total int64
+	min, max := sizes[0], sizes[0]
+	for _, size := range sizes {
+		total += size
+		if size < min {
+			min = size
+		}
+		if size > max {
+			max = size
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+
+	mean := float64(total) / float64(len(sizes))
+	return float64(max-min) / mean
+}
+
+// handleStorageDistribution reports how files are spread across providers
+// @Summary Storage distribution
+// @Description Count and total bytes of files per provider, from the ownership records and cross-checked with rclone size on each remote, plus the balance skew between providers ((max - min) / mean of the measured bytes). Set cloud=false to skip the rclone check (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param cloud query bool false "Measure each remote with rclone size (default true)"
+// @Success 200 {object} map[string]interface{} "Per-provider distribution"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - Admin access required"
+// @Failure 500 {object} map[string]interface{} "Failed to read file records"
+// @Router /../admin/storage/distribution [get]
+func (a *API) handleStorageDistribution(c *gin.Context) {
+	recorded, err := a.authManager.DatabaseManager.FileDistribution()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to read file records",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var measure func(remote string) (int64, int64, error)
+	if c.DefaultQuery("cloud", "true") != "false" {
+		measure = func(remote string) (int64, int64, error) {
+			ctx, cancel := context.WithTimeout(c.Request.Context(), providerCheckTimeout)
+			defer cancel()
+			return a.remoteSize(ctx, remote)
+		}
+	}
+
+	c.JSON(http.StatusOK, distribution(a.providers.Specs(), recorded, measure))
+}
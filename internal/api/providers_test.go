@@ -0,0 +1,230 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+	"github.com/nabilulilalbab/rclonestorage/internal/storage"
+)
+
+// admin returns the admin user of ta
+func (ta *testAPI) admin(t *testing.T) *auth.User {
+	t.Helper()
+	user, err := ta.db.GetUserByEmail("admin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// reachable makes remote reachable through the fake rclone
+func (ta *testAPI) reachable(t *testing.T, remote string) {
+	t.Helper()
+	if err := os.MkdirAll(ta.rclone.path(remote+":"), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAddAndRemoveProvider(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	admin := ta.admin(t)
+	ta.reachable(t, "backup")
+
+	w := ta.do(t, http.MethodPost, "/api/admin/providers", admin, strings.NewReader(`{"name": "backup"}`))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("add: got %d: %s", w.Code, w.Body.String())
+	}
+	if ta.storage.GetProvider("backup") == nil {
+		t.Fatal("backup is not in the union")
+	}
+	if spec, ok := ta.providers.Get("backup"); !ok || spec.Remote != "backup" || spec.Type != storage.ProviderTypeRclone {
+		t.Errorf("registry holds %+v, %v", spec, ok)
+	}
+
+	// Providers are persisted across restarts
+	reloaded, err := storage.NewProviderRegistry(ta.config.Storage.ProvidersFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reloaded.Get("backup"); !ok {
+		t.Error("added provider was not persisted")
+	}
+
+	w = ta.do(t, http.MethodPost, "/api/admin/providers", admin, strings.NewReader(`{"name": "backup"}`))
+	if w.Code != http.StatusConflict {
+		t.Errorf("duplicate add: got %d, want 409", w.Code)
+	}
+
+	w = ta.do(t, http.MethodDelete, "/api/admin/providers/backup", admin, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("remove: got %d: %s", w.Code, w.Body.String())
+	}
+	if ta.storage.GetProvider("backup") != nil {
+		t.Error("backup is still in the union")
+	}
+	if _, ok := ta.providers.Get("backup"); ok {
+		t.Error("backup is still registered")
+	}
+}
+
+func TestAddUnreachableProvider(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	w := ta.do(t, http.MethodPost, "/api/admin/providers", ta.admin(t), strings.NewReader(`{"name": "offline"}`))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("got %d, want 422: %s", w.Code, w.Body.String())
+	}
+	if ta.storage.GetProvider("offline") != nil {
+		t.Error("unreachable provider was added")
+	}
+}
+
+func TestRemoveLastProvider(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	admin := ta.admin(t)
+
+	w := ta.do(t, http.MethodDelete, "/api/admin/providers/"+testProvider, admin, nil)
+	if w.Code != http.StatusConflict {
+		t.Errorf("got %d, want 409", w.Code)
+	}
+	w = ta.do(t, http.MethodDelete, "/api/admin/providers/missing", admin, nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("missing provider: got %d, want 404", w.Code)
+	}
+}
+
+func TestProviderAdminRoutesRequireAdmin(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	user := ta.newUser(t, "user@example.com")
+	w := ta.do(t, http.MethodGet, "/api/admin/providers", user, nil)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("got %d, want 403", w.Code)
+	}
+
+	w = ta.do(t, http.MethodGet, "/api/admin/providers", ta.admin(t), nil)
+	var listed struct {
+		Providers []storage.ProviderSpec `json:"providers"`
+		Total     int                    `json:"total"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &listed); err != nil {
+		t.Fatal(err)
+	}
+	if listed.Total != 1 || len(listed.Providers) != 1 || listed.Providers[0].Name != testProvider {
+		t.Errorf("listed %+v", listed)
+	}
+}
+
+func TestRenameProvider(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	admin := ta.admin(t)
+	user := ta.newUser(t, "owner@example.com")
+	ta.reachable(t, "union")
+	if err := ta.db.CreateFileOwnership(user.ID, "file1", "a.txt", testProvider, 5, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	path := "/api/admin/providers/" + testProvider + "/rename"
+
+	w := ta.do(t, http.MethodPost, path, admin, strings.NewReader(`{"new_name": "primary", "remote": "union", "dry_run": true}`))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"affected_files":1`) {
+		t.Fatalf("dry run: got %d: %s", w.Code, w.Body.String())
+	}
+	if record, _ := ta.db.GetFileOwnership("file1"); record.Provider != testProvider {
+		t.Errorf("dry run rewrote the record to %s", record.Provider)
+	}
+
+	w = ta.do(t, http.MethodPost, path, admin, strings.NewReader(`{"new_name": "primary", "remote": "union"}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("rename: got %d: %s", w.Code, w.Body.String())
+	}
+	if ta.storage.GetProvider("primary") == nil || ta.storage.GetProvider(testProvider) != nil {
+		t.Errorf("union holds %v, want primary only", ta.providerNames())
+	}
+	if spec, ok := ta.providers.Get("primary"); !ok || spec.Remote != "union" {
+		t.Errorf("registry holds %+v, %v", spec, ok)
+	}
+	if record, _ := ta.db.GetFileOwnership("file1"); record.Provider != "primary" {
+		t.Errorf("record is on %s, want primary", record.Provider)
+	}
+
+	if w := ta.do(t, http.MethodPost, path, admin, strings.NewReader(`{"new_name": "other"}`)); w.Code != http.StatusNotFound {
+		t.Errorf("old name: got %d, want 404", w.Code)
+	}
+}
+
+func TestRenameProviderRevertsRecords(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	user := ta.newUser(t, "owner@example.com")
+	ta.reachable(t, "union")
+	if err := ta.db.CreateFileOwnership(user.ID, "file1", "a.txt", testProvider, 5, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	// A directory in place of the registry file makes saving it fail
+	os.Remove(ta.config.Storage.ProvidersFile)
+	if err := os.Mkdir(ta.config.Storage.ProvidersFile, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	w := ta.do(t, http.MethodPost, "/api/admin/providers/"+testProvider+"/rename", ta.admin(t), strings.NewReader(`{"new_name": "primary", "remote": "union"}`))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("got %d, want 500: %s", w.Code, w.Body.String())
+	}
+	if record, _ := ta.db.GetFileOwnership("file1"); record.Provider != testProvider {
+		t.Errorf("record left on %s, want it renamed back", record.Provider)
+	}
+	if ta.storage.GetProvider(testProvider) == nil || ta.storage.GetProvider("primary") != nil {
+		t.Errorf("union holds %v, want %s only", ta.providerNames(), testProvider)
+	}
+}
+
+func TestDistribution(t *testing.T) {
+	specs := []storage.ProviderSpec{{Name: "gdrive", Remote: "gdrive"}, {Name: "mega", Remote: "mega"}}
+	recorded := []auth.ProviderUsage{
+		{Provider: "gdrive", Files: 3, Bytes: 300},
+		{Provider: "union", Files: 1, Bytes: 50},
+	}
+	measure := func(remote string) (int64, int64, error) {
+		if remote == "mega" {
+			return 0, 0, errors.New("rclone size failed")
+		}
+		return 3, 310, nil
+	}
+
+	got := distribution(specs, recorded, measure)
+	providers := got["providers"].([]gin.H)
+	if len(providers) != 2 || providers[0]["recorded_bytes"] != int64(300) || providers[0]["cloud_bytes"] != int64(310) {
+		t.Errorf("gdrive %+v, want 300 recorded and 310 measured bytes", providers[0])
+	}
+	if providers[1]["recorded_files"] != int64(0) || providers[1]["cloud_error"] == nil {
+		t.Errorf("mega %+v, want no records and the rclone error", providers[1])
+	}
+	if unattributed := got["unattributed"].([]auth.ProviderUsage); len(unattributed) != 1 || unattributed[0].Provider != "union" {
+		t.Errorf("unattributed %+v, want the union records", unattributed)
+	}
+	if got["total_files"] != int64(4) || got["total_bytes"] != int64(350) {
+		t.Errorf("totals %v files, %v bytes, want 4 and 350", got["total_files"], got["total_bytes"])
+	}
+}
+
+func TestBalanceSkew(t *testing.T) {
+	tests := []struct {
+		sizes []int64
+		want  float64
+	}{
+		{nil, 0},
+		{[]int64{100}, 0},
+		{[]int64{100, 100}, 0},
+		{[]int64{100, 0}, 2},
+		{[]int64{0, 0}, 0},
+		{[]int64{150, 50, 100}, 1},
+	}
+	for _, tt := range tests {
+		if got := balanceSkew(tt.sizes); got != tt.want {
+			t.Errorf("balanceSkew(%v) = %v, want %v", tt.sizes, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseRangeHeader(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []RangeSpec
+	}{
+		{"bytes=0-3", []RangeSpec{{0, 3}}},
+		{"bytes=4-", []RangeSpec{{4, 9}}},
+		{"bytes=-3", []RangeSpec{{7, 9}}},
+		{"bytes=-50", []RangeSpec{{0, 9}}},
+		{"bytes=5-100", []RangeSpec{{5, 9}}},
+		{"bytes= 0-1 , 20-30, 8-", []RangeSpec{{0, 1}, {8, 9}}},
+	}
+	for _, tt := range tests {
+		got, err := parseRangeHeader(tt.header, 10)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %v, %v, want %v", tt.header, got, err, tt.want)
+		}
+	}
+
+	for header, want := range map[string]error{
+		"items=0-1": errMalformedRange,
+		"bytes=1":   errMalformedRange,
+		"bytes=3-1": errMalformedRange,
+		"bytes=a-b": errMalformedRange,
+		"bytes=10-": errUnsatisfiableRange,
+		"bytes=-0":  errUnsatisfiableRange,
+	} {
+		if _, err := parseRangeHeader(header, 10); !errors.Is(err, want) {
+			t.Errorf("%q: got %v, want %v", header, err, want)
+		}
+	}
+}
+
+func TestStreamUnsatisfiableRange(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	user := ta.newUser(t, "owner@example.com")
+	ta.addFile(t, user, "file1", "clip.mp4", []byte("0123456789"))
+
+	w := ta.doWithHeader(t, http.MethodGet, "/api/v1/stream/file1", user, http.Header{"Range": {"bytes=10-"}})
+	if w.Code != http.StatusRequestedRangeNotSatisfiable || w.Header().Get("Content-Range") != "bytes */10" {
+		t.Errorf("got %d with Content-Range %q, want 416 and bytes */10", w.Code, w.Header().Get("Content-Range"))
+	}
+
+	w = ta.doWithHeader(t, http.MethodGet, "/api/v1/stream/file1", user, http.Header{"Range": {"bytes=-4"}})
+	if w.Code != http.StatusPartialContent || w.Body.String() != "6789" {
+		t.Errorf("suffix range: got %d %q, want the last 4 bytes", w.Code, w.Body.String())
+	}
+}
+
+func TestStreamMultiRange(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	user := ta.newUser(t, "owner@example.com")
+	ta.addFile(t, user, "file1", "clip.mp4", []byte("0123456789"))
+
+	w := ta.doWithHeader(t, http.MethodGet, "/api/v1/stream/file1", user, http.Header{"Range": {"bytes=0-1,-2"}})
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Length"); got != strconv.Itoa(w.Body.Len()) {
+		t.Errorf("Content-Length %s, body is %d bytes", got, w.Body.Len())
+	}
+	mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if err != nil || mediaType != "multipart/byteranges" {
+		t.Fatalf("Content-Type %q", w.Header().Get("Content-Type"))
+	}
+
+	var got []string
+	parts := multipart.NewReader(w.Body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(part)
+		got = append(got, part.Header.Get("Content-Range")+" "+string(data))
+	}
+	if want := []string{"bytes 0-1/10 01", "bytes 8-9/10 89"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got parts %q, want %q", got, want)
+	}
+
+	tooMany := "bytes=" + strings.Repeat("0-0,", maxRanges) + "0-0"
+	if w := ta.doWithHeader(t, http.MethodGet, "/api/v1/stream/file1", user, http.Header{"Range": {tooMany}}); w.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("%d ranges: got %d, want 416", maxRanges+1, w.Code)
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/rclonestorage/internal/jobs"
+	"github.com/nabilulilalbab/rclonestorage/internal/logging"
+	"github.com/nabilulilalbab/rclonestorage/internal/storage"
+)
+
+// replicateUpload starts a job copying a new upload from the provider it was stored
+// on to further providers until STORAGE_REPLICAS copies are recorded. A retried job
+// skips the providers that already hold a copy.
+func (a *API) replicateUpload(userID uint, fileID, object, source string) jobs.Job {
+	sourcePath, _ := a.objectPath(source, object)
+
+	replicate := func(ctx context.Context) (interface{}, error) {
+		records, err := a.authManager.DatabaseManager.FileReplicas(fileID)
+		if err != nil {
+			return nil, err
+		}
+		held := make(map[string]bool, len(records))
+		for _, record := range records {
+			held[record.Provider] = true
+		}
+
+		want := a.config.Storage.Replicas - len(held)
+		for _, provider := range a.storage.SelectProviders(ctx, a.config.Storage.Replicas+len(held)) {
+			if want <= 0 {
+				break
+			}
+			if held[provider.Name()] {
+				continue
+			}
+			target, ok := a.objectPath(provider.Name(), object)
+			if !ok {
+				continue
+			}
+
+			if err := a.rclone.Copy(ctx, sourcePath, target); err != nil {
+				logging.Logger.WithField("file_id", fileID).Warnf("Failed to replicate to %s: %v", provider.Name(), err)
+				continue
+			}
+			if err := a.authManager.DatabaseManager.AddFileReplica(fileID, provider.Name()); err != nil {
+				return nil, err
+			}
+			held[provider.Name()] = true
+			want--
+		}
+
+		replicas := make([]string, 0, len(held))
+		for provider := range held {
+			replicas = append(replicas, provider)
+		}
+		if want > 0 {
+			return nil, fmt.Errorf("stored %d of %d copies", len(held), a.config.Storage.Replicas)
+		}
+		return gin.H{"file_id": fileID, "replicas": replicas}, nil
+	}
+
+	return a.jobs.Start(userID, jobs.TypeReplicate, sourcePath, replicate, nil)
+}
+
+// removeObject deletes object from every provider holding a copy, replicas being the
+// providers recorded as holding one. Copies already gone are ignored.
+func (a *API) removeObject(ctx context.Context, object string, replicas []string) error {
+	// The union removes the copy on every available provider holding one
+	if err := a.deleteObject(ctx, "union", object); err != nil && !storage.IsNotFound(err) {
+		return fmt.Errorf("failed to delete %s: %w", a.unionPath(object), err)
+	}
+
+	// Recorded copies on providers skipped as unavailable are removed directly
+	for _, provider := range replicas {
+		if a.storage.GetProvider(provider) == nil {
+			continue
+		}
+		if err := a.deleteObject(ctx, provider, object); err != nil && !storage.IsNotFound(err) {
+			return fmt.Errorf("failed to delete replica on %s: %w", provider, err)
+		}
+	}
+	return nil
+}
+
+// queueRemoval starts a job retrying removeObject, for objects whose file record is
+// already deleted
+func (a *API) queueRemoval(userID uint, object string, replicas []string) jobs.Job {
+	remove := func(ctx context.Context) (interface{}, error) {
+		if err := a.removeObject(ctx, object, replicas); err != nil {
+			return nil, err
+		}
+		return gin.H{"object": object}, nil
+	}
+	return a.jobs.Start(userID, jobs.TypeDelete, a.unionPath(object), remove, nil)
+}
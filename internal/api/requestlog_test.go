@@ -0,0 +1,59 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/rclonestorage/internal/logging"
+)
+
+// captureLogs sends the structured logs to a buffer for the rest of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	out := logging.Logger.Out
+	logging.Logger.SetOutput(&buf)
+	t.Cleanup(func() { logging.Logger.SetOutput(out) })
+	return &buf
+}
+
+func TestRequestLogger(t *testing.T) {
+	logs := captureLogs(t)
+	var seen string
+	routes := func(r *gin.Engine) {
+		r.Use(RequestLogger())
+		r.GET("/files", func(c *gin.Context) {
+			seen = logging.RequestID(c.Request.Context())
+			c.String(http.StatusNotFound, "gone")
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/files", nil)
+	req.Header.Set(RequestIDHeader, "client-id-1")
+	w := serve(routes, req)
+	if got := w.Header().Get(RequestIDHeader); got != "client-id-1" || seen != "client-id-1" {
+		t.Errorf("got ID %q in the response and %q in the context, want the client's", got, seen)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatalf("log line %q: %v", logs.String(), err)
+	}
+	if entry["request_id"] != "client-id-1" || entry["status"] != 404.0 || entry["level"] != "warning" || entry["bytes"] != 4.0 {
+		t.Errorf("got log entry %v", entry)
+	}
+
+	// IDs that aren't safe to echo back are replaced
+	for _, id := range []string{"", "has space", strings.Repeat("x", maxRequestIDLength+1)} {
+		req := httptest.NewRequest(http.MethodGet, "/files", nil)
+		req.Header.Set(RequestIDHeader, id)
+		if got := serve(routes, req).Header().Get(RequestIDHeader); got == id || len(got) != 32 {
+			t.Errorf("client ID %q: got %q, want a generated one", id, got)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+)
+
+// handleSearch searches file metadata
+// @Summary Search files
+// @Description Search the ownership database by filename substring, file type, size range and upload date. Users search their own files, admins every file. untracked=true adds matching objects in cloud storage that have no ownership record (admin only)
+// @Tags files
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param q query string false "Case-insensitive filename substring"
+// @Param type query string false "File type (video, audio, image, document)"
+// @Param min_size query int false "Minimum size in bytes"
+// @Param max_size query int false "Maximum size in bytes"
+// @Param modified_after query string false "Uploaded at or after, RFC3339 or YYYY-MM-DD"
+// @Param untracked query bool false "Include matching cloud objects without an ownership record (admin only)"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Param sort query string false "Sort field (name, size, date or modified, type)"
+// @Param order query string false "Sort order (asc, desc)"
+// @Success 200 {object} map[string]interface{} "Matching files"
+// @Failure 400 {object} map[string]interface{} "Invalid search parameters"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Router /search [get]
+func (a *API) handleSearch(c *gin.Context) {
+	filter, err := searchFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid search parameters",
+			"details": err.Error(),
+		})
+		return
+	}
+	sortField, sortOrder, err := a.listSort(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid sort parameters",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	// Only admins search every file, other users their own
+	admin := auth.IsAdmin(c)
+	if !admin {
+		userID, exists := auth.GetCurrentUserID(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Authentication required",
+			})
+			return
+		}
+		filter.UserID = userID
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+
+	files, total, err := a.authManager.DatabaseManager.SearchFiles(filter, (page-1)*limit, limit, sortField, sortOrder)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to search files",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	response := gin.H{
+		"files": ownedFileEntries(files),
+		"pagination": gin.H{
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+			"total_pages": (total + int64(limit) - 1) / int64(limit),
+			"sort":        sortField,
+			"order":       sortOrder,
+		},
+	}
+
+	if admin && c.Query("untracked") == "true" {
+		untracked, err := a.untrackedMatches(filter)
+		if err != nil {
+			response["untracked_error"] = err.Error()
+		} else {
+			sortFiles(untracked, sortField, sortOrder)
+			response["untracked"] = untracked
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// searchFilter reads the search query params
+func searchFilter(c *gin.Context) (auth.FileFilter, error) {
+	filter := auth.FileFilter{
+		Query:    c.Query("q"),
+		Category: strings.ToLower(c.Query("type")),
+	}
+	if _, ok := auth.FileCategories[filter.Category]; filter.Category != "" && !ok {
+		return filter, fmt.Errorf("invalid type %q, must be one of video, audio, image, document", filter.Category)
+	}
+
+	for param, bound := range map[string]*int64{"min_size": &filter.MinSize, "max_size": &filter.MaxSize} {
+		if raw := c.Query(param); raw != "" {
+			size, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || size < 0 {
+				return filter, fmt.Errorf("invalid %s %q, must be a size in bytes", param, raw)
+			}
+			*bound = size
+		}
+	}
+	if filter.MaxSize > 0 && filter.MinSize > filter.MaxSize {
+		return filter, fmt.Errorf("min_size %d is larger than max_size %d", filter.MinSize, filter.MaxSize)
+	}
+
+	if raw := c.Query("modified_after"); raw != "" {
+		after, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			if after, err = time.Parse(time.DateOnly, raw); err != nil {
+				return filter, fmt.Errorf("invalid modified_after %q, must be RFC3339 or YYYY-MM-DD", raw)
+			}
+		}
+		filter.ModifiedAfter = after
+	}
+
+	return filter, nil
+}
+
+// untrackedMatches lists the cloud objects without an ownership record that match filter
+func (a *API) untrackedMatches(filter auth.FileFilter) ([]gin.H, error) {
+	cloudFiles, err := a.cloudEntries()
+	if err != nil {
+		return nil, err
+	}
+	dbFiles, err := a.dbEntries(auth.FileFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []gin.H{}
+	for _, file := range enrichEntries(cloudFiles, dbFiles) {
+		if file["tracked"].(bool) || !entryMatches(file, filter) {
+			continue
+		}
+		matches = append(matches, file)
+	}
+	return matches, nil
+}
+
+// entryMatches applies filter to a cloud entry, the way filesQuery applies it to
+// ownership records
+func entryMatches(file gin.H, filter auth.FileFilter) bool {
+	size := file["size"].(int64)
+	modified, _ := time.Parse(time.RFC3339Nano, file["modified"].(string))
+
+	switch {
+	case filter.Query != "" && !strings.Contains(strings.ToLower(file["name"].(string)), strings.ToLower(filter.Query)):
+		return false
+	case filter.Category != "" && !auth.MatchesCategory(filter.Category, file["mime_type"].(string)):
+		return false
+	case filter.MinSize > 0 && size < filter.MinSize:
+		return false
+	case filter.MaxSize > 0 && size > filter.MaxSize:
+		return false
+	case !filter.ModifiedAfter.IsZero() && modified.Before(filter.ModifiedAfter):
+		return false
+	}
+	return true
+}
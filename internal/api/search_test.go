@@ -0,0 +1,84 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestSearch(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	user := ta.newUser(t, "owner@example.com")
+	other := ta.newUser(t, "other@example.com")
+	ta.addTypedFile(t, user, "1", "holiday.mp4", "video/mp4", make([]byte, 500))
+	ta.addTypedFile(t, user, "2", "holiday.jpg", "image/jpeg", make([]byte, 50))
+	ta.addTypedFile(t, user, "3", "report.pdf", "application/pdf", make([]byte, 100))
+	ta.addTypedFile(t, other, "4", "holiday-other.mp4", "video/mp4", make([]byte, 500))
+
+	tomorrow := time.Now().Add(24 * time.Hour).Format(time.DateOnly)
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"?q=HOLIDAY", []string{"holiday.jpg", "holiday.mp4"}},
+		{"?type=video", []string{"holiday.mp4"}},
+		{"?type=document", []string{"report.pdf"}},
+		{"?min_size=100", []string{"holiday.mp4", "report.pdf"}},
+		{"?max_size=100", []string{"holiday.jpg", "report.pdf"}},
+		{"?modified_after=2000-01-01", []string{"holiday.jpg", "holiday.mp4", "report.pdf"}},
+		{"?modified_after=" + tomorrow, []string{}},
+	}
+	for _, tt := range tests {
+		got := listedNames(t, ta, user, "/api/v1/search"+tt.query)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	// Admins search every file
+	if got := listedNames(t, ta, ta.admin(t), "/api/v1/search?q=holiday&type=video"); len(got) != 2 {
+		t.Errorf("admin: got %v, want both videos", got)
+	}
+
+	for _, query := range []string{"?type=spreadsheet", "?min_size=-1", "?min_size=10&max_size=5", "?modified_after=yesterday"} {
+		if w := ta.do(t, http.MethodGet, "/api/v1/search"+query, user, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestSearchUntracked(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	admin := ta.admin(t)
+	user := ta.newUser(t, "owner@example.com")
+	ta.addFile(t, user, "1", "notes.txt", []byte("tracked"))
+	ta.rclone.put(t, ta.unionPath("stray_notes-old.txt"), []byte("untracked"))
+	ta.rclone.put(t, ta.unionPath("stray_photo.png"), []byte("untracked"))
+
+	w := ta.do(t, http.MethodGet, "/api/v1/search?q=notes&untracked=true", admin, nil)
+	var resp struct {
+		Untracked []struct {
+			Name string `json:"name"`
+		} `json:"untracked"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Untracked) != 1 || resp.Untracked[0].Name != "notes-old.txt" {
+		t.Errorf("got untracked %+v, want notes-old.txt", resp.Untracked)
+	}
+
+	// Other users never see untracked objects
+	w = ta.do(t, http.MethodGet, "/api/v1/search?untracked=true", user, nil)
+	var userResp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &userResp); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := userResp["untracked"]; found {
+		t.Errorf("user got untracked objects: %s", w.Body.String())
+	}
+}
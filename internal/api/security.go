@@ -0,0 +1,33 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/rclonestorage/internal/config"
+)
+
+// streamPathPrefix marks responses that media players may embed, so they are not
+// sent a framing restriction
+const streamPathPrefix = "/api/v1/stream/"
+
+// SecurityHeaders sets the security response headers configured in cfg on every
+// response. Strict-Transport-Security is only sent when the request came in over
+// HTTPS, directly or through a proxy that sets X-Forwarded-Proto.
+func SecurityHeaders(cfg config.ServerConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("X-Content-Type-Options", "nosniff")
+		if cfg.ReferrerPolicy != "" {
+			c.Header("Referrer-Policy", cfg.ReferrerPolicy)
+		}
+		if cfg.FrameOptions != "" && !strings.HasPrefix(c.Request.URL.Path, streamPathPrefix) {
+			c.Header("X-Frame-Options", cfg.FrameOptions)
+		}
+		if cfg.HSTSMaxAge > 0 && (c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https") {
+			c.Header("Strict-Transport-Security", fmt.Sprintf("max-age=%d; includeSubDomains", int64(cfg.HSTSMaxAge.Seconds())))
+		}
+
+		c.Next()
+	}
+}
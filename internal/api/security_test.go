@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/rclonestorage/internal/config"
+)
+
+// secured serves path through SecurityHeaders with cfg and returns the response headers
+func secured(cfg config.ServerConfig, path string, header http.Header) http.Header {
+	r := gin.New()
+	r.Use(SecurityHeaders(cfg))
+	r.NoRoute(func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Header()
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	cfg := config.ServerConfig{HSTSMaxAge: time.Hour, FrameOptions: "DENY", ReferrerPolicy: "no-referrer"}
+
+	got := secured(cfg, "/api/v1/files", nil)
+	if got.Get("X-Content-Type-Options") != "nosniff" || got.Get("X-Frame-Options") != "DENY" || got.Get("Referrer-Policy") != "no-referrer" {
+		t.Errorf("got headers %v", got)
+	}
+	if hsts := got.Get("Strict-Transport-Security"); hsts != "" {
+		t.Errorf("got Strict-Transport-Security %q over plain HTTP, want none", hsts)
+	}
+
+	got = secured(cfg, "/api/v1/files", http.Header{"X-Forwarded-Proto": {"https"}})
+	if hsts := got.Get("Strict-Transport-Security"); hsts != "max-age=3600; includeSubDomains" {
+		t.Errorf("got Strict-Transport-Security %q behind an HTTPS proxy", hsts)
+	}
+}
+
+func TestSecurityHeadersStreamEmbeddable(t *testing.T) {
+	got := secured(config.ServerConfig{FrameOptions: "DENY"}, "/api/v1/stream/abc", nil)
+	if frame := got.Get("X-Frame-Options"); frame != "" {
+		t.Errorf("got X-Frame-Options %q on a stream, want none", frame)
+	}
+	if got.Get("X-Content-Type-Options") != "nosniff" {
+		t.Error("got no X-Content-Type-Options on a stream")
+	}
+}
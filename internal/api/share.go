@@ -0,0 +1,378 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+	"github.com/nabilulilalbab/rclonestorage/internal/config"
+	"github.com/nabilulilalbab/rclonestorage/internal/logging"
+)
+
+// shareResumeWindow is how long a download through a share link can be resumed
+// without counting as another download
+const shareResumeWindow = 24 * time.Hour
+
+// shareRequest holds the options of a new share link, both are optional
+type shareRequest struct {
+	ExpiresIn    int64 `json:"expires_in"`    // seconds, 0 = as long as SHARE_MAX_AGE allows
+	MaxDownloads int   `json:"max_downloads"` // 0 = unlimited
+}
+
+// handleCreateShare creates a share link for a file
+// @Summary Create share link
+// @Description Create a link anyone can download the file from without credentials. expires_in (seconds) is clamped to SHARE_MAX_AGE, max_downloads limits how often the link can be used (requires ownership or admin)
+// @Tags files
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "File ID"
+// @Param share body shareRequest false "Link options"
+// @Success 201 {object} map[string]interface{} "Share link created"
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 403 {object} map[string]interface{} "Sharing disabled or access denied"
+// @Failure 404 {object} map[string]interface{} "File not found"
+// @Router /files/{id}/share [post]
+func (a *API) handleCreateShare(c *gin.Context) {
+	var req shareRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request",
+				"details": err.Error(),
+			})
+			return
+		}
+	}
+	if req.ExpiresIn < 0 || req.MaxDownloads < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"details": "expires_in and max_downloads must not be negative",
+		})
+		return
+	}
+	// Larger values overflow the duration and would wrap around to a negative expiry
+	if req.ExpiresIn > math.MaxInt64/int64(time.Second) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"details": fmt.Sprintf("expires_in must not exceed %d seconds", math.MaxInt64/int64(time.Second)),
+		})
+		return
+	}
+
+	ttl, err := a.config.Share.ShareExpiry(time.Duration(req.ExpiresIn) * time.Second)
+	if errors.Is(err, config.ErrSharingDisabled) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "File sharing is disabled",
+		})
+		return
+	}
+
+	fileID := c.Param("id")
+	if a.fileRecord(fileID) == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "File not found",
+			"file_id": fileID,
+		})
+		return
+	}
+
+	userID, _ := auth.GetCurrentUserID(c)
+	link, err := a.authManager.DatabaseManager.CreateShareLink(fileID, userID, ttl, req.MaxDownloads)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to create share link",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, shareEntry(link))
+}
+
+// handleListShares lists share links
+// @Summary List share links
+// @Description List the share links you created, newest first, optionally only those of one file. Admins see every user's links
+// @Tags files
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param file_id query string false "Only links to this file"
+// @Success 200 {object} map[string]interface{} "Share links"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Router /shares [get]
+func (a *API) handleListShares(c *gin.Context) {
+	userID, exists := auth.GetCurrentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Authentication required",
+		})
+		return
+	}
+	if auth.IsAdmin(c) {
+		userID = 0
+	}
+
+	links, err := a.authManager.DatabaseManager.ShareLinks(userID, c.Query("file_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to list share links",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	entries := make([]gin.H, 0, len(links))
+	for i := range links {
+		entries = append(entries, shareEntry(&links[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"shares": entries,
+		"total":  len(entries),
+	})
+}
+
+// handleRevokeShare revokes a share link
+// @Summary Revoke share link
+// @Description Delete a share link, it stops working immediately (creator or admin only)
+// @Tags files
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int true "Share link ID"
+// @Success 200 {object} map[string]interface{} "Share link revoked"
+// @Failure 400 {object} map[string]interface{} "Invalid share link ID"
+// @Failure 404 {object} map[string]interface{} "Share link not found"
+// @Router /shares/{id} [delete]
+func (a *API) handleRevokeShare(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid share link ID",
+		})
+		return
+	}
+
+	// Links of other users are reported as missing rather than forbidden
+	userID, _ := auth.GetCurrentUserID(c)
+	link, err := a.authManager.DatabaseManager.GetShareLink(uint(id))
+	if err == nil && link.UserID != userID && !auth.IsAdmin(c) {
+		err = auth.ErrShareNotFound
+	}
+	if err == nil {
+		err = a.authManager.DatabaseManager.RevokeShareLink(uint(id))
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, auth.ErrShareNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{
+			"error":   "Failed to revoke share link",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Share link revoked",
+		"id":      id,
+	})
+}
+
+// handleSharedDownload serves a file through a share link
+// @Summary Download shared file
+// @Description Download a file through a share link without credentials while the link is valid. Every download counts towards max_downloads. The response's ETag resumes it for 24 hours: a Range request with that ETag in If-Range starting after the first byte and within the bytes already sent is not counted again, any other request is. Shared files are never redirected to provider URLs
+// @Tags files
+// @Produce octet-stream
+// @Param token path string true "Share token"
+// @Success 200 {file} binary "File content"
+// @Failure 404 {object} map[string]interface{} "Share link not found"
+// @Failure 410 {object} map[string]interface{} "Share link expired or used up"
+// @Router /shared/{token} [get]
+func (a *API) handleSharedDownload(c *gin.Context) {
+	if !a.config.Share.Enabled {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Share link not found",
+		})
+		return
+	}
+
+	// Only a Range request validated by the ETag of a download through this link and
+	// continuing within the bytes that download already sent resumes it, every other
+	// request, a range from the first byte included, is a new download
+	token := c.Param("token")
+	resume, resumeTag, offset := 0, "", int64(0)
+	if rangeHeader := c.GetHeader("Range"); rangeHeader != "" {
+		resumeTag = c.GetHeader("If-Range")
+		offset = shareRangeStart(rangeHeader)
+		if offset > 0 && offset <= a.shares.served(resumeTag) {
+			resume = a.resumedShareDownload(token, resumeTag)
+		}
+	}
+
+	link, counted, err := a.authManager.DatabaseManager.UseShareLink(token, resume)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, auth.ErrShareNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, auth.ErrShareExpired), errors.Is(err, auth.ErrShareExhausted):
+			status = http.StatusGone
+		}
+		c.JSON(status, gin.H{
+			"error":   "Share link unavailable",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	// The ETag lets the client resume this download with Range and If-Range
+	if counted {
+		resumeTag = a.shareResumeTag(token, link.Downloads, time.Now())
+	}
+	c.Header("ETag", resumeTag)
+
+	// Serve the file like an owner's download, keyed by its ID. It is always proxied,
+	// a direct URL would outlive the link and its download limit.
+	c.Params = append(c.Params, gin.Param{Key: "id", Value: link.FileID})
+	c.Set(noRedirectKey, true)
+	a.handleDownload(c)
+
+	switch status := c.Writer.Status(); {
+	case status >= http.StatusBadRequest:
+		// A failed download doesn't use up the link
+		if counted {
+			if err := a.authManager.DatabaseManager.RefundShareDownload(link.ID); err != nil {
+				logging.FromContext(c.Request.Context()).WithField("share_id", link.ID).Warnf("Failed to refund download of share link: %v", err)
+			}
+		}
+	case counted && link.Downloads == 1:
+		a.authManager.Notifier.Notify(link.UserID, auth.NotifyShareAccess, "Shared file downloaded",
+			fmt.Sprintf("Your share link to file %s was used for the first time.", link.FileID))
+	}
+
+	// Remember how far the download got so the tag can resume it from there. A cache
+	// miss ignores the range and sends the file from its first byte.
+	if status := c.Writer.Status(); status < http.StatusBadRequest && (counted || resume > 0) {
+		if status != http.StatusPartialContent {
+			offset = 0
+		}
+		a.shares.extend(resumeTag, offset, int64(max(c.Writer.Size(), 0)))
+	}
+}
+
+// shareRangeStart returns the first byte a single-range Range header asks for, -1
+// for multiple or malformed ranges. The size isn't known yet, so a suffix range
+// starts far beyond any bytes sent.
+func shareRangeStart(rangeHeader string) int64 {
+	ranges, err := parseRangeHeader(rangeHeader, math.MaxInt64)
+	if err != nil || len(ranges) != 1 {
+		return -1
+	}
+	return ranges[0].Start
+}
+
+// shareResumes remembers how many leading bytes of each resumable share download,
+// by ETag, were sent. Tags are forgotten once they can no longer resume.
+type shareResumes struct {
+	mu   sync.Mutex
+	sent map[string]int64
+}
+
+func newShareResumes() *shareResumes {
+	return &shareResumes{sent: make(map[string]int64)}
+}
+
+// served returns how many leading bytes of the download tag were sent, 0 for an
+// unknown tag
+func (r *shareResumes) served(tag string) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sent[tag]
+}
+
+// extend records that n bytes from start were sent under tag. Only bytes that
+// continue the ones already sent count, a gap leaves the tag where it was.
+func (r *shareResumes) extend(tag string, start, n int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sent, known := r.sent[tag]
+	if start < 0 || start > sent {
+		return
+	}
+	r.sent[tag] = max(sent, start+n)
+	if !known {
+		time.AfterFunc(shareResumeWindow, func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			delete(r.sent, tag)
+		})
+	}
+}
+
+// shareResumeTag returns the ETag of the nth download through the share link token,
+// started at issued. It is signed, so a client can only resume downloads it was given.
+func (a *API) shareResumeTag(token string, n int, issued time.Time) string {
+	return fmt.Sprintf(`"shr-%d-%d-%s"`, n, issued.Unix(), a.shareResumeMAC(token, n, issued.Unix()))
+}
+
+// resumedShareDownload returns the download through the share link token that an
+// If-Range ETag resumes, 0 when it isn't a valid tag of that link or is too old
+func (a *API) resumedShareDownload(token, tag string) int {
+	parts := strings.Split(strings.Trim(tag, `"`), "-")
+	if len(parts) != 4 || parts[0] != "shr" {
+		return 0
+	}
+	n, err := strconv.Atoi(parts[1])
+	if err != nil || n < 1 {
+		return 0
+	}
+	issued, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || time.Since(time.Unix(issued, 0)) > shareResumeWindow {
+		return 0
+	}
+	if !hmac.Equal([]byte(parts[3]), []byte(a.shareResumeMAC(token, n, issued))) {
+		return 0
+	}
+	return n
+}
+
+// shareResumeMAC signs a share download's ETag with the server's JWT secret
+func (a *API) shareResumeMAC(token string, n int, issued int64) string {
+	mac := hmac.New(sha256.New, []byte(a.config.Auth.JWTSecret))
+	fmt.Fprintf(mac, "%s:%d:%d", token, n, issued)
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// shareEntry converts a share link to a response entry
+func shareEntry(link *auth.ShareLink) gin.H {
+	entry := gin.H{
+		"id":            link.ID,
+		"token":         link.Token,
+		"url":           fmt.Sprintf("/api/v1/shared/%s", link.Token),
+		"file_id":       link.FileID,
+		"user_id":       link.UserID,
+		"expires_at":    link.ExpiresAt,
+		"max_downloads": link.MaxDownloads,
+		"downloads":     link.Downloads,
+		"created_at":    link.CreatedAt,
+	}
+	entry["expired"] = link.ExpiresAt != nil && !time.Now().Before(*link.ExpiresAt)
+	if link.MaxDownloads > 0 {
+		entry["remaining_downloads"] = max(link.MaxDownloads-link.Downloads, 0)
+	}
+	return entry
+}
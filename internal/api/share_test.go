@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSharedDownloadLimit(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	owner := ta.newUser(t, "owner@example.com")
+	ta.addFile(t, owner, "file1", "report.txt", []byte("shared content"))
+	link, err := ta.db.CreateShareLink("file1", owner.ID, time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	routes := func(r *gin.Engine) { r.GET("/shared/:token", ta.handleSharedDownload) }
+	get := func(rangeHeader, ifRange string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/shared/"+link.Token, nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		if ifRange != "" {
+			req.Header.Set("If-Range", ifRange)
+		}
+		return serve(routes, req)
+	}
+
+	first := get("", "")
+	if first.Code != http.StatusOK || first.Body.String() != "shared content" {
+		t.Fatalf("first download: %d %q", first.Code, first.Body.String())
+	}
+	etag := first.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("first download has no ETag to resume it with")
+	}
+
+	// Range requests without the ETag of a download are new downloads
+	for _, rangeHeader := range []string{"", "bytes=0-", "bytes=1-", "bytes=-14"} {
+		if w := get(rangeHeader, ""); w.Code != http.StatusGone {
+			t.Errorf("Range %q after the limit: got %d, want 410", rangeHeader, w.Code)
+		}
+	}
+	if w := get("bytes=1-", `"shr-1-1-forged"`); w.Code != http.StatusGone {
+		t.Errorf("forged If-Range: got %d, want 410", w.Code)
+	}
+
+	// The ETag only resumes from within the bytes its download already received
+	for _, rangeHeader := range []string{"bytes=0-", "bytes=15-", "bytes=-14"} {
+		if w := get(rangeHeader, etag); w.Code != http.StatusGone {
+			t.Errorf("Range %q with the ETag after the limit: got %d, want 410", rangeHeader, w.Code)
+		}
+	}
+
+	if w := get("bytes=6-", etag); w.Code >= http.StatusBadRequest {
+		t.Fatalf("resuming the download: got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestSharedDownloadIsProxied(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	ta.config.Storage.DirectURLs = true
+	mem := useMemProvider(t, ta)
+	mem.linkURL = "https://cdn.example.com"
+	owner := ta.newUser(t, "owner@example.com")
+	ta.addMemFile(t, mem, owner, "file1", "report.txt", []byte("shared content"))
+	link, err := ta.db.CreateShareLink("file1", owner.ID, time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A direct URL would stay usable past the download limit
+	req := httptest.NewRequest(http.MethodGet, "/shared/"+link.Token+"?redirect=true", nil)
+	w := serve(func(r *gin.Engine) { r.GET("/shared/:token", ta.handleSharedDownload) }, req)
+	if w.Code != http.StatusOK || w.Body.String() != "shared content" {
+		t.Errorf("got %d to %q, want the content proxied", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestResumedShareDownload(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	issued := time.Now()
+	tag := ta.shareResumeTag("shr_a", 3, issued)
+
+	if n := ta.resumedShareDownload("shr_a", tag); n != 3 {
+		t.Fatalf("own tag resumes download %d, want 3", n)
+	}
+	if n := ta.resumedShareDownload("shr_b", tag); n != 0 {
+		t.Fatalf("tag of another link resumes download %d, want 0", n)
+	}
+	old := ta.shareResumeTag("shr_a", 3, issued.Add(-shareResumeWindow-time.Minute))
+	if n := ta.resumedShareDownload("shr_a", old); n != 0 {
+		t.Fatalf("expired tag resumes download %d, want 0", n)
+	}
+	if n := ta.resumedShareDownload("shr_a", "Wed, 21 Oct 2015 07:28:00 GMT"); n != 0 {
+		t.Fatalf("date If-Range resumes download %d, want 0", n)
+	}
+}
+
+func TestCreateShareClampsExpiry(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	ta.config.Share.MaxAge = time.Hour
+	owner := ta.newUser(t, "owner@example.com")
+	ta.addFile(t, owner, "file1", "report.txt", []byte("shared content"))
+
+	w := ta.do(t, http.MethodPost, "/api/v1/files/file1/share", owner, strings.NewReader(`{"expires_in": 2592000}`))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	var link struct {
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &link); err != nil {
+		t.Fatal(err)
+	}
+	if remaining := time.Until(link.ExpiresAt); remaining > time.Hour || remaining < 59*time.Minute {
+		t.Errorf("link expires in %s, want it clamped to 1h", remaining)
+	}
+
+	// One second more than a time.Duration holds
+	if w := ta.do(t, http.MethodPost, "/api/v1/files/file1/share", owner, strings.NewReader(`{"expires_in": 9223372037}`)); w.Code != http.StatusBadRequest {
+		t.Errorf("overflowing expires_in: got %d, want 400", w.Code)
+	}
+
+	ta.config.Share.Enabled = false
+	if w := ta.do(t, http.MethodPost, "/api/v1/files/file1/share", owner, nil); w.Code != http.StatusForbidden {
+		t.Errorf("sharing disabled: got %d, want 403", w.Code)
+	}
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Sort fields accepted by the listing endpoints
+const (
+	sortByName = "name"
+	sortBySize = "size"
+	sortByDate = "date"
+	sortByType = "type"
+)
+
+// listSort reads the sort and order query params, falling back to the configured defaults
+func (a *API) listSort(c *gin.Context) (string, string, error) {
+	field := strings.ToLower(c.DefaultQuery("sort", a.config.Listing.DefaultSort))
+	order := strings.ToLower(c.DefaultQuery("order", a.config.Listing.DefaultOrder))
+
+	if field == "modified" {
+		field = sortByDate
+	}
+
+	switch field {
+	case sortByName, sortBySize, sortByDate, sortByType:
+	default:
+		return "", "", fmt.Errorf("invalid sort field %q, must be one of name, size, date (or modified), type", field)
+	}
+	if order != "asc" && order != "desc" {
+		return "", "", fmt.Errorf("invalid sort order %q, must be asc or desc", order)
+	}
+
+	return field, order, nil
+}
+
+// sortFiles orders file entries built by the rclone-backed listings in place
+func sortFiles(files []gin.H, field, order string) {
+	less := func(i, j int) bool {
+		switch field {
+		case sortBySize:
+			return files[i]["size"].(int64) < files[j]["size"].(int64)
+		case sortByDate:
+			ti, _ := time.Parse(time.RFC3339Nano, files[i]["modified"].(string))
+			tj, _ := time.Parse(time.RFC3339Nano, files[j]["modified"].(string))
+			return ti.Before(tj)
+		case sortByType:
+			return files[i]["mime_type"].(string) < files[j]["mime_type"].(string)
+		default:
+			return strings.ToLower(files[i]["name"].(string)) < strings.ToLower(files[j]["name"].(string))
+		}
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		if order == "desc" {
+			return less(j, i)
+		}
+		return less(i, j)
+	})
+}
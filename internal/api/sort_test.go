@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+)
+
+// listedNames lists the files user sees at path, by name in the listed order
+func listedNames(t *testing.T, ta *testAPI, user *auth.User, path string) []string {
+	t.Helper()
+	w := ta.do(t, http.MethodGet, path, user, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s: got %d: %s", path, w.Code, w.Body.String())
+	}
+	var listing struct {
+		Files []struct {
+			Name string `json:"name"`
+		} `json:"files"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &listing); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, file := range listing.Files {
+		names = append(names, file.Name)
+	}
+	return names
+}
+
+func TestListingSortDefaults(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	user := ta.newUser(t, "owner@example.com")
+	ta.addFile(t, user, "file1", "b.txt", []byte("12345"))
+	ta.addFile(t, user, "file2", "C.txt", []byte("1"))
+	ta.addFile(t, user, "file3", "a.txt", []byte("123"))
+
+	if got, want := listedNames(t, ta, user, "/api/v1/files"), []string{"a.txt", "b.txt", "C.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("default order %v, want %v", got, want)
+	}
+
+	ta.config.Listing.DefaultSort = sortBySize
+	ta.config.Listing.DefaultOrder = "desc"
+	if got, want := listedNames(t, ta, user, "/api/v1/files"), []string{"b.txt", "a.txt", "C.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("configured size desc %v, want %v", got, want)
+	}
+
+	// The query overrides the configured default
+	if got, want := listedNames(t, ta, user, "/api/v1/files?sort=name&order=desc"), []string{"C.txt", "b.txt", "a.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("name desc %v, want %v", got, want)
+	}
+	if got, want := listedNames(t, ta, user, "/api/v1/files?sort=modified&order=asc"), []string{"b.txt", "C.txt", "a.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("modified asc %v, want %v", got, want)
+	}
+}
+
+func TestListingRejectsUnknownSort(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	user := ta.newUser(t, "owner@example.com")
+	for _, query := range []string{"sort=owner", "order=sideways"} {
+		if w := ta.do(t, http.MethodGet, "/api/v1/files?"+query, user, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestListingPagesAndSearch(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	user := ta.newUser(t, "owner@example.com")
+	for i, name := range []string{"a.txt", "b-Video.mp4", "c.txt", "d-video.mkv", "e.txt"} {
+		ta.addFile(t, user, string(rune('1'+i)), name, []byte(name))
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"?sort=name&limit=2", []string{"a.txt", "b-Video.mp4"}},
+		{"?sort=name&limit=2&page=3", []string{"e.txt"}},
+		{"?sort=name&limit=2&page=9", []string{}},
+		{"?sort=name&search=VIDEO", []string{"b-Video.mp4", "d-video.mkv"}},
+		{"?sort=name&order=desc&search=.txt&limit=1&page=2", []string{"c.txt"}},
+	}
+	for _, tt := range tests {
+		if got := listedNames(t, ta, user, "/api/v1/files"+tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	w := ta.do(t, http.MethodGet, "/api/v1/files?search=txt&limit=2", user, nil)
+	var listing struct {
+		Total      int `json:"total"`
+		Pagination struct {
+			Page       int `json:"page"`
+			TotalPages int `json:"total_pages"`
+		} `json:"pagination"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &listing); err != nil {
+		t.Fatal(err)
+	}
+	if listing.Total != 3 || listing.Pagination.Page != 1 || listing.Pagination.TotalPages != 2 {
+		t.Errorf("got total %d, page %d of %d, want 3 on 2 pages", listing.Total, listing.Pagination.Page, listing.Pagination.TotalPages)
+	}
+}
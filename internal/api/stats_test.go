@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestStatsListConfiguredProviders(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	if err := ta.storage.AddProvider(newMemProvider("backup")); err != nil {
+		t.Fatal(err)
+	}
+	admin, err := ta.db.GetUserByEmail("admin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"backup", testProvider}
+
+	w := ta.do(t, http.MethodGet, "/api/v1/stats", admin, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("stats: got %d: %s", w.Code, w.Body.String())
+	}
+	var stats struct {
+		Stats struct {
+			Storage struct {
+				Providers     []string `json:"providers"`
+				ProviderCount int      `json:"provider_count"`
+			} `json:"storage"`
+		} `json:"stats"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if got := stats.Stats.Storage; !reflect.DeepEqual(got.Providers, want) || got.ProviderCount != len(want) {
+		t.Errorf("stats providers %v (%d), want %v", got.Providers, got.ProviderCount, want)
+	}
+
+	w = ta.do(t, http.MethodGet, "/api/v1/public/stats", nil, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("public stats: got %d: %s", w.Code, w.Body.String())
+	}
+	var public struct {
+		PublicStats struct {
+			Providers     []string `json:"providers"`
+			ProviderCount int      `json:"provider_count"`
+		} `json:"public_stats"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &public); err != nil {
+		t.Fatal(err)
+	}
+	if got := public.PublicStats; !reflect.DeepEqual(got.Providers, want) || got.ProviderCount != len(want) {
+		t.Errorf("public stats providers %v (%d), want %v", got.Providers, got.ProviderCount, want)
+	}
+
+	w = ta.do(t, http.MethodGet, "/api/v1/files", admin, nil)
+	var listing struct {
+		Provider string `json:"provider"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &listing); err != nil {
+		t.Fatal(err)
+	}
+	if listing.Provider != "union (backup + remote1)" {
+		t.Errorf("listing provider %q: %s", listing.Provider, w.Body.String())
+	}
+}
@@ -1,11 +1,15 @@
 package api
 
 import (
+	"bufio"
+	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"os/exec"
 	"path/filepath"
 	"strconv"
@@ -14,18 +18,27 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/nabilulilalbab/rclonestorage/internal/cache"
+	"github.com/nabilulilalbab/rclonestorage/internal/logging"
+	"github.com/nabilulilalbab/rclonestorage/internal/storage"
 )
 
 // handleStream handles video streaming with HTTP range requests
 // @Summary Stream video file
-// @Description Stream video file with range support for progressive loading
+// @Description Stream video or audio file with range support for progressive loading (requires ownership or admin). Audio is cached whole on first play and ranges are served from the cache, video is streamed progressively and ranges on an already cached video are served from the cache too, other ranges are fetched and cached in 4MB chunks, so ranges seen before are served from disk. Files over CACHE_MAX_ENTRY_SIZE are never cached (X-Cache: BYPASS). Requests for several ranges (at most 16) get a multipart/byteranges response. Formats listed in STREAM_NON_SEEKABLE_FORMATS ignore Range and advertise Accept-Ranges: none, or are remuxed to fragmented MP4 when STREAM_NON_SEEKABLE_MODE=remux. With CACHE_SERVE_PARTIAL, full-file requests arriving while another request is caching the file read its partial copy (X-Cache: PARTIAL)
 // @Tags streaming
 // @Produce video/*
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param id path string true "File ID"
 // @Param Range header string false "Range header for partial content"
+// @Param mode query string false "Streaming mode: proxy or redirect (defaults to STREAM_MODE)"
 // @Success 200 {file} file "Video stream"
 // @Success 206 {file} file "Partial content"
+// @Success 302 {string} string "Redirect to direct provider URL"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - not file owner"
 // @Failure 404 {object} map[string]interface{} "File not found"
+// @Failure 416 {object} map[string]interface{} "Range malformed or beyond the end of the file"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /stream/{id} [get]
 func (a *API) handleStream(c *gin.Context) {
@@ -52,121 +65,593 @@ func (a *API) handleStream(c *gin.Context) {
 		return
 	}
 	
-	// Initialize cache
-	cacheManager, err := cache.NewManager("./cache", 24*time.Hour, 10*1024*1024*1024)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to initialize cache",
-		})
-		return
+	// Containers without a seek index play back broken over range requests,
+	// remux them for progressive playback or serve them sequentially
+	nonSeekable := a.isNonSeekable(ext)
+	if nonSeekable && a.config.Storage.NonSeekableMode == nonSeekableRemux {
+		if _, err := exec.LookPath(a.config.Storage.FFmpegPath); err == nil {
+			a.streamRemuxed(c, fileInfo)
+			return
+		}
 	}
 	
+	// In redirect mode the provider serves the bytes with native range support,
+	// providers without direct URLs (Mega) fall back to proxying
+	if !nonSeekable && fileInfo.sealing == nil && a.streamMode(c) == streamModeRedirect {
+		if url, err := a.directURL(c.Request.Context(), fileInfo.Filename); err == nil {
+			c.Header("X-Stream-Mode", streamModeRedirect)
+			c.Redirect(http.StatusFound, url)
+			return
+		}
+	}
+	c.Header("X-Stream-Mode", streamModeProxy)
+	
+	// Initialize cache
+	cacheManager := a.cache
+	
 	cacheKey := fmt.Sprintf("stream_%s", fileID)
 	
+	// Audio is small, cache it whole on first play and serve every range from the cache
+	if getFileType(ext) == fileTypeAudio && !nonSeekable && cacheManager.CanCache(fileInfo.Size) {
+		a.streamCached(c, fileInfo, cacheManager, cacheKey)
+		return
+	}
+	c.Header("X-Stream-Type", getFileType(ext))
+	
 	// Parse range header
 	rangeHeader := c.GetHeader("Range")
+	if nonSeekable {
+		rangeHeader = ""
+	}
 	var start, end int64
 	var isRangeRequest bool
 	
 	if rangeHeader != "" {
 		isRangeRequest = true
-		ranges := parseRangeHeader(rangeHeader, fileInfo.Size)
-		if len(ranges) > 0 {
-			start = ranges[0].Start
-			end = ranges[0].End
+		ranges, err := parseRangeHeader(rangeHeader, fileInfo.Size)
+		if err != nil {
+			c.Header("Content-Range", fmt.Sprintf("bytes */%d", fileInfo.Size))
+			c.JSON(http.StatusRequestedRangeNotSatisfiable, gin.H{
+				"error": "Range not satisfiable",
+				"details": err.Error(),
+				"size": fileInfo.Size,
+			})
+			return
+		}
+		if len(ranges) > 1 {
+			a.streamMultiRange(c, fileInfo, ranges, cacheManager, cacheKey)
+			return
 		}
+		start = ranges[0].Start
+		end = ranges[0].End
 	} else {
 		start = 0
 		end = fileInfo.Size - 1
 	}
 	
-	// Try cache first for full file
-	if !isRangeRequest {
-		if reader, entry, err := cacheManager.Get(context.Background(), cacheKey); err == nil {
-			defer reader.Close()
-			
-			c.Header("Content-Type", getContentType(ext))
+	// Try cache first, ranges are served by seeking in the cached file
+	if reader, entry, err := cacheManager.GetValidated(context.Background(), cacheKey, fileInfo.cacheValidator()); err == nil {
+		defer reader.Close()
+		
+		c.Header("Content-Type", getContentType(ext))
+		c.Header("X-Cache", "HIT")
+		
+		if nonSeekable {
 			c.Header("Content-Length", strconv.FormatInt(entry.Size, 10))
-			c.Header("Accept-Ranges", "bytes")
-			c.Header("X-Cache", "HIT")
-			
+			c.Header("Accept-Ranges", a.acceptRanges(ext))
 			io.Copy(c.Writer, reader)
 			return
 		}
+		modTime, _ := time.Parse(time.RFC3339, fileInfo.ModTime)
+		http.ServeContent(c.Writer, c.Request, fileInfo.Name, modTime, reader.(io.ReadSeeker))
+		return
+	}
+	
+	if !isRangeRequest {
+		// Share a fill another request is running instead of fetching the file again
+		if a.config.Cache.ServePartial {
+			if reader, err := cacheManager.OpenPartial(cacheKey); err == nil {
+				defer reader.Close()
+				
+				c.Header("Content-Type", getContentType(ext))
+				c.Header("Content-Length", strconv.FormatInt(fileInfo.Size, 10))
+				c.Header("Accept-Ranges", a.acceptRanges(ext))
+				c.Header("X-Cache", "PARTIAL")
+				
+				io.Copy(c.Writer, reader)
+				return
+			}
+		}
 	}
 	
 	// Stream from cloud with range support
 	if isRangeRequest {
-		a.streamWithRange(c, fileInfo, start, end)
+		a.streamWithRange(c, fileInfo, start, end, cacheManager, cacheKey)
+	} else if !cacheManager.CanCache(fileInfo.Size) {
+		// Oversize files would evict most of the cache, serve them uncached
+		a.streamFullFile(c, fileInfo, nil, cacheKey)
 	} else {
 		a.streamFullFile(c, fileInfo, cacheManager, cacheKey)
 	}
 }
 
-// streamWithRange handles range requests for video streaming
-func (a *API) streamWithRange(c *gin.Context, fileInfo *FileInfo, start, end int64) {
-	// For range requests, we need to download the specific range
-	// Since rclone doesn't support range directly, we'll stream and seek
+// handleStreamHead answers the probe players send before streaming
+// @Summary Probe stream
+// @Description Return the headers of GET /stream/{id} (Content-Type, Content-Length, Accept-Ranges) without a body, with the same ownership and format checks
+// @Tags streaming
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "File ID"
+// @Success 200 "Stream headers"
+// @Failure 400 "File format not streamable"
+// @Failure 401 "Unauthorized"
+// @Failure 403 "Forbidden - not file owner"
+// @Failure 404 "File not found"
+// @Router /stream/{id} [head]
+func (a *API) handleStreamHead(c *gin.Context) {
+	fileID := c.Param("id")
 	
-	cmd := exec.Command("rclone", "cat", fmt.Sprintf("union:uploads/%s", fileInfo.Filename))
-	if a.config.Rclone.ConfigPath != "" {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("RCLONE_CONFIG=%s", a.config.Rclone.ConfigPath))
+	fileInfo, err := a.getFileInfo(fileID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "File not found",
+			"file_id": fileID,
+		})
+		return
 	}
 	
-	stdout, err := cmd.StdoutPipe()
+	ext := strings.ToLower(filepath.Ext(fileInfo.Name))
+	if !isStreamableFormat(ext) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "File format not streamable",
+			"format": ext,
+			"file_id": fileID,
+		})
+		return
+	}
+	
+	// Remuxed output has no length known up front, see streamRemuxed
+	if a.isNonSeekable(ext) && a.config.Storage.NonSeekableMode == nonSeekableRemux {
+		if _, err := exec.LookPath(a.config.Storage.FFmpegPath); err == nil {
+			c.Header("Content-Type", "video/mp4")
+			c.Header("Accept-Ranges", "none")
+			c.Status(http.StatusOK)
+			return
+		}
+	}
+	
+	c.Header("Content-Type", getContentType(ext))
+	c.Header("Content-Length", strconv.FormatInt(fileInfo.Size, 10))
+	c.Header("Accept-Ranges", a.acceptRanges(ext))
+	c.Header("X-Stream-Type", getFileType(ext))
+	c.Status(http.StatusOK)
+}
+
+// Streaming modes
+const (
+	streamModeProxy    = "proxy"
+	streamModeRedirect = "redirect"
+)
+
+// streamMode resolves the streaming mode from the configured default and, when
+// direct URLs are enabled, the per-request mode (or redirect) query parameter
+func (a *API) streamMode(c *gin.Context) string {
+	mode := a.config.Storage.StreamMode
+	if a.config.Storage.DirectURLs {
+		switch c.Query("mode") {
+		case streamModeProxy, streamModeRedirect:
+			mode = c.Query("mode")
+		default:
+			if a.wantsRedirect(c) {
+				mode = streamModeRedirect
+			}
+		}
+	}
+	return mode
+}
+
+// Handling of non-seekable formats
+const (
+	nonSeekableSequential = "sequential"
+	nonSeekableRemux      = "remux"
+)
+
+// isNonSeekable reports whether ext is configured as a non-seekable container
+func (a *API) isNonSeekable(ext string) bool {
+	for _, format := range a.config.Storage.NonSeekableFormats {
+		if format == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptRanges returns the Accept-Ranges value advertised for a format
+func (a *API) acceptRanges(ext string) string {
+	if a.isNonSeekable(ext) {
+		return "none"
+	}
+	return "bytes"
+}
+
+// streamRemuxed pipes a non-seekable file through ffmpeg into fragmented MP4,
+// which browsers can play progressively without an index
+func (a *API) streamRemuxed(c *gin.Context, fileInfo *FileInfo) {
+	ctx := c.Request.Context()
+
+	source, err := a.openObject(ctx, fileInfo.Filename, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to start stream",
+			"details": err.Error(),
+		})
+		return
+	}
+	defer source.Close()
+
+	remux := exec.CommandContext(ctx, a.config.Storage.FFmpegPath,
+		"-loglevel", "error",
+		"-i", "pipe:0",
+		"-c", "copy",
+		"-f", "mp4",
+		"-movflags", "frag_keyframe+empty_moov",
+		"pipe:1",
+	)
+
+	remux.Stdin, err = a.unseal(source, fileInfo.sealing)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to decrypt file",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	stdout, err := remux.StdoutPipe()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to create stream pipe",
 		})
 		return
 	}
+
+	if err := remux.Start(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to start remux",
+		})
+		return
+	}
+
+	// The remuxed length isn't known up front
+	c.Header("Content-Type", "video/mp4")
+	c.Header("Accept-Ranges", "none")
+	c.Header("X-Stream-Mode", nonSeekableRemux)
+	c.Header("X-Cache", "BYPASS")
+	c.Status(http.StatusOK)
+
+	io.Copy(c.Writer, stdout)
+	remux.Wait()
+}
+
+// streamCached fills the cache with the whole file if needed and serves it from
+// there, range requests included
+func (a *API) streamCached(c *gin.Context, fileInfo *FileInfo, cacheManager *cache.Manager, cacheKey string) {
+	ctx := c.Request.Context()
+
+	cacheStatus := "HIT"
+	reader, _, err := cacheManager.GetValidated(ctx, cacheKey, fileInfo.cacheValidator())
+	if err != nil {
+		cacheStatus = "MISS"
+		if err := a.fillCache(ctx, fileInfo, cacheManager, cacheKey); err != nil {
+			// A cache that can't be written must not break playback, serve it live
+			if errors.Is(err, cache.ErrWriteFailed) {
+				logging.FromContext(ctx).WithField("file_id", fileInfo.ID).Warnf("Failed to cache stream: %v", err)
+				a.streamFullFile(c, fileInfo, nil, cacheKey)
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to stream file",
+				"details": err.Error(),
+			})
+			return
+		}
+		if reader, _, err = cacheManager.GetValidated(ctx, cacheKey, fileInfo.cacheValidator()); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to read cached file",
+				"details": err.Error(),
+			})
+			return
+		}
+	}
+	defer reader.Close()
+
+	modTime, _ := time.Parse(time.RFC3339, fileInfo.ModTime)
+
+	c.Header("Content-Type", getContentType(strings.ToLower(filepath.Ext(fileInfo.Name))))
+	c.Header("Cache-Control", "private, max-age=3600")
+	c.Header("X-Stream-Type", fileTypeAudio)
+	c.Header("X-Cache", cacheStatus)
+	http.ServeContent(c.Writer, c.Request, fileInfo.Name, modTime, reader.(io.ReadSeeker))
+}
+
+// fillCache downloads the whole file into the cache, discarding incomplete copies
+func (a *API) fillCache(ctx context.Context, fileInfo *FileInfo, cacheManager *cache.Manager, cacheKey string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	body, err := a.openObject(ctx, fileInfo.Filename, nil)
+	if err != nil {
+		return err
+	}
+	content, err := a.unseal(body, fileInfo.sealing)
+	if err != nil {
+		body.Close()
+		return err
+	}
+
+	entry, putErr := cacheManager.PutValidated(ctx, cacheKey, fileInfo.cacheValidator(), content, fileInfo.Size)
+	if putErr != nil {
+		// Nothing reads the rest of the download, don't leave it blocked
+		cancel()
+	}
+	waitErr := body.Close()
+	if putErr == nil && (waitErr != nil || entry.Size != fileInfo.Size) {
+		cacheManager.Delete(ctx, cacheKey)
+	}
+
+	switch {
+	case putErr != nil:
+		return putErr
+	case waitErr != nil:
+		return fmt.Errorf("failed to download file: %w", waitErr)
+	case entry.Size != fileInfo.Size:
+		return fmt.Errorf("incomplete download: got %d of %d bytes", entry.Size, fileInfo.Size)
+	}
+
+	return nil
+}
+
+// streamWithRange serves bytes start-end of a file. Ranges whose chunks were fetched
+// before are stitched together from the cache. Otherwise the whole chunks covering the
+// range are fetched and cached on the way, so seeking back doesn't hit the provider again.
+// Files over the per-entry limit are never cached, not even in chunks.
+func (a *API) streamWithRange(c *gin.Context, fileInfo *FileInfo, start, end int64, cacheManager *cache.Manager, cacheKey string) {
+	ctx := c.Request.Context()
+	contentLength := end - start + 1
+	validator := fileInfo.cacheValidator()
+	
+	if !cacheManager.CanCache(fileInfo.Size) {
+		body, err := a.openRange(ctx, fileInfo, start, end)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to start stream",
+				"details": err.Error(),
+			})
+			return
+		}
+		defer body.Close()
+		
+		setRangeHeaders(c, fileInfo, start, end, "BYPASS")
+		io.CopyN(c.Writer, body, contentLength)
+		return
+	}
+	
+	if reader, err := cacheManager.GetRange(ctx, cacheKey, validator, start, end); err == nil {
+		defer reader.Close()
+		
+		setRangeHeaders(c, fileInfo, start, end, "HIT")
+		io.CopyN(c.Writer, reader, contentLength)
+		return
+	}
 	
-	if err := cmd.Start(); err != nil {
+	first := start / cache.ChunkSize * cache.ChunkSize
+	last := min((end/cache.ChunkSize+1)*cache.ChunkSize, fileInfo.Size) - 1
+	body, err := a.openRange(ctx, fileInfo, first, last)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to start stream",
+			"details": err.Error(),
 		})
 		return
 	}
+	defer body.Close()
+	
+	chunks := &chunkWriter{
+		ctx:       context.Background(),
+		logCtx:    ctx,
+		cache:     cacheManager,
+		key:       cacheKey,
+		validator: validator,
+		index:     first / cache.ChunkSize,
+		offset:    first,
+		size:      fileInfo.Size,
+	}
+	tee := io.TeeReader(body, chunks)
 	
 	// Skip to start position
-	if start > 0 {
-		io.CopyN(io.Discard, stdout, start)
+	if _, err := io.CopyN(io.Discard, tee, start-first); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to stream file",
+			"details": err.Error(),
+		})
+		return
 	}
 	
-	// Calculate content length for range
-	contentLength := end - start + 1
+	setRangeHeaders(c, fileInfo, start, end, "MISS")
 	
-	// Set range response headers
+	// Stream the requested range, then read the rest of the last chunk so it's cached too
+	if _, err := io.CopyN(c.Writer, tee, contentLength); err == nil {
+		io.Copy(io.Discard, tee)
+	}
+}
+
+// setRangeHeaders starts a 206 response for bytes start-end of a file
+func setRangeHeaders(c *gin.Context, fileInfo *FileInfo, start, end int64, cacheStatus string) {
 	c.Header("Content-Type", getContentType(filepath.Ext(fileInfo.Name)))
-	c.Header("Content-Length", strconv.FormatInt(contentLength, 10))
+	c.Header("Content-Length", strconv.FormatInt(end-start+1, 10))
 	c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, fileInfo.Size))
 	c.Header("Accept-Ranges", "bytes")
-	c.Header("X-Cache", "MISS")
+	c.Header("X-Cache", cacheStatus)
 	c.Status(http.StatusPartialContent)
+}
+
+// streamMultiRange serves several ranges of a file as a multipart/byteranges body
+// (RFC 7233 appendix A). Each part is read from cached chunks when it can be,
+// otherwise fetched on its own without caching.
+func (a *API) streamMultiRange(c *gin.Context, fileInfo *FileInfo, ranges []RangeSpec, cacheManager *cache.Manager, cacheKey string) {
+	ctx := c.Request.Context()
+	contentType := getContentType(filepath.Ext(fileInfo.Name))
+	validator := fileInfo.cacheValidator()
+	
+	// Parts are rendered once into a counter first, so Content-Length is exact
+	counter := &countingWriter{}
+	parts := multipart.NewWriter(counter)
+	for _, r := range ranges {
+		parts.CreatePart(byteRangeHeader(contentType, r, fileInfo.Size))
+		counter.n += r.End - r.Start + 1
+	}
+	parts.Close()
 	
-	// Stream the requested range
-	io.CopyN(c.Writer, stdout, contentLength)
-	cmd.Wait()
+	c.Header("Content-Type", "multipart/byteranges; boundary="+parts.Boundary())
+	c.Header("Content-Length", strconv.FormatInt(counter.n, 10))
+	c.Header("Accept-Ranges", "bytes")
+	c.Status(http.StatusPartialContent)
+	
+	body := multipart.NewWriter(c.Writer)
+	body.SetBoundary(parts.Boundary())
+	for _, r := range ranges {
+		part, err := body.CreatePart(byteRangeHeader(contentType, r, fileInfo.Size))
+		if err != nil {
+			return
+		}
+		reader, err := cacheManager.GetRange(ctx, cacheKey, validator, r.Start, r.End)
+		if err != nil {
+			if reader, err = a.openRange(ctx, fileInfo, r.Start, r.End); err != nil {
+				// Headers are out, a short body is all that's left to signal failure
+				logging.FromContext(ctx).WithField("file_id", fileInfo.ID).Warnf("Multi-range stream aborted: %v", err)
+				c.Abort()
+				return
+			}
+		}
+		_, err = io.CopyN(part, reader, r.End-r.Start+1)
+		reader.Close()
+		if err != nil {
+			c.Abort()
+			return
+		}
+	}
+	body.Close()
 }
 
-// streamFullFile handles full file streaming with caching
-func (a *API) streamFullFile(c *gin.Context, fileInfo *FileInfo, cacheManager *cache.Manager, cacheKey string) {
-	cmd := exec.Command("rclone", "cat", fmt.Sprintf("union:uploads/%s", fileInfo.Filename))
-	if a.config.Rclone.ConfigPath != "" {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("RCLONE_CONFIG=%s", a.config.Rclone.ConfigPath))
+// byteRangeHeader returns the headers of one part of a multipart/byteranges body
+func byteRangeHeader(contentType string, r RangeSpec, size int64) textproto.MIMEHeader {
+	return textproto.MIMEHeader{
+		"Content-Type":  {contentType},
+		"Content-Range": {fmt.Sprintf("bytes %d-%d/%d", r.Start, r.End, size)},
 	}
+}
+
+// countingWriter counts the bytes written to it
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// openRange reads bytes start-end of a file, decrypted when the object is encrypted
+func (a *API) openRange(ctx context.Context, fileInfo *FileInfo, start, end int64) (io.ReadCloser, error) {
+	if fileInfo.sealing != nil {
+		return a.openSealedRange(ctx, fileInfo, start, end)
+	}
+	return a.catRange(ctx, fileInfo, start, end-start+1)
+}
+
+// catRange reads count bytes from offset start of an object. The providers fetch only
+// that window, backends that can't read from an offset are skipped through by rclone
+// itself. When the ranged read fails before producing data, e.g. with an rclone too
+// old for the flags, the whole object is read and the bytes before start discarded.
+func (a *API) catRange(ctx context.Context, fileInfo *FileInfo, start, count int64) (io.ReadCloser, error) {
+	reader, err := a.openObject(ctx, fileInfo.Filename, &storage.RangeSpec{Start: start, End: start + count - 1})
+	if err == nil {
+		buffered := bufio.NewReader(reader)
+		if _, err = buffered.Peek(1); err == nil {
+			return &rangeBody{Reader: buffered, Closer: reader}, nil
+		}
+		reader.Close()
+	}
+	logging.FromContext(ctx).WithField("file_id", fileInfo.ID).Warnf("Ranged read failed, reading from the start: %v", err)
 	
-	stdout, err := cmd.StdoutPipe()
+	reader, err = a.openObject(ctx, fileInfo.Filename, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, reader, start); err != nil {
+		reader.Close()
+		return nil, err
+	}
+	return &rangeBody{Reader: io.LimitReader(reader, count), Closer: reader}, nil
+}
+
+// rangeBody reads a window of a downloaded object and closes the download
+type rangeBody struct {
+	io.Reader
+	io.Closer
+}
+
+// chunkWriter caches the bytes of a file written to it as chunks, see cache.ChunkSize.
+// Writing starts at a chunk boundary, a chunk left incomplete is not cached. Caching
+// never fails a write, the stream it tees off must not be held up by the cache.
+type chunkWriter struct {
+	ctx       context.Context
+	logCtx    context.Context // the request's, which ctx outlives
+	cache     *cache.Manager
+	key       string
+	validator string
+	
+	index  int64 // chunk being filled
+	offset int64 // file offset of buf[0]
+	size   int64 // file size, which ends the last chunk early
+	buf    []byte
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		take := min(int64(len(p)), cache.ChunkSize-int64(len(w.buf)))
+		w.buf = append(w.buf, p[:take]...)
+		p = p[take:]
+		
+		if filled := int64(len(w.buf)); filled == cache.ChunkSize || w.offset+filled == w.size {
+			if _, err := w.cache.PutChunk(w.ctx, w.key, w.validator, w.index, bytes.NewReader(w.buf), filled); err != nil && errors.Is(err, cache.ErrWriteFailed) {
+				logging.FromContext(w.logCtx).WithField("cache_key", w.key).Warnf("Failed to cache chunk %d: %v", w.index, err)
+			}
+			w.index++
+			w.offset += filled
+			w.buf = w.buf[:0]
+		}
+	}
+	return n, nil
+}
+
+// streamFullFile handles full file streaming with caching, a nil cacheManager bypasses the cache
+func (a *API) streamFullFile(c *gin.Context, fileInfo *FileInfo, cacheManager *cache.Manager, cacheKey string) {
+	body, err := a.openObject(c.Request.Context(), fileInfo.Filename, nil)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to create stream pipe",
+			"error": "Failed to start stream",
+			"details": err.Error(),
 		})
 		return
 	}
-	
-	if err := cmd.Start(); err != nil {
+	content, err := a.unseal(body, fileInfo.sealing)
+	if err != nil {
+		body.Close()
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to start stream",
+			"error": "Failed to decrypt file",
+			"details": err.Error(),
 		})
 		return
 	}
@@ -174,32 +659,64 @@ func (a *API) streamFullFile(c *gin.Context, fileInfo *FileInfo, cacheManager *c
 	// Set headers for full file
 	c.Header("Content-Type", getContentType(filepath.Ext(fileInfo.Name)))
 	c.Header("Content-Length", strconv.FormatInt(fileInfo.Size, 10))
-	c.Header("Accept-Ranges", "bytes")
+	c.Header("Accept-Ranges", a.acceptRanges(strings.ToLower(filepath.Ext(fileInfo.Name))))
+	
+	if cacheManager == nil {
+		c.Header("X-Cache", "BYPASS")
+		io.Copy(c.Writer, content)
+		body.Close()
+		return
+	}
 	c.Header("X-Cache", "MISS")
 	
 	// Create a tee reader to cache while streaming
 	pr, pw := io.Pipe()
-	teeReader := io.TeeReader(stdout, pw)
+	teeReader := io.TeeReader(content, pw)
 	
-	// Cache in background
+	// Cache in background, keeping the copy only if the whole file came through
+	done := make(chan struct{})
 	go func() {
-		defer pw.Close()
-		defer cmd.Wait()
-		cacheManager.Put(context.Background(), cacheKey, pr, fileInfo.Size)
+		defer close(done)
+		pending, err := cacheManager.Stage(context.Background(), cacheKey, pr, fileInfo.Size)
+		if err != nil {
+			// Keep draining so the client stream isn't held up by the cache
+			if errors.Is(err, cache.ErrWriteFailed) {
+				logging.FromContext(c.Request.Context()).WithField("file_id", fileInfo.ID).Warnf("Failed to cache stream: %v", err)
+			}
+			io.Copy(io.Discard, pr)
+			return
+		}
+		if pending.Size() != fileInfo.Size {
+			cacheManager.Discard(pending)
+			return
+		}
+		pending.SetValidator(fileInfo.cacheValidator())
+		if _, err := cacheManager.Commit(pending); err != nil {
+			logging.FromContext(c.Request.Context()).WithField("file_id", fileInfo.ID).Warnf("Failed to cache stream: %v", err)
+		}
 	}()
 	
-	// Stream to client
-	io.Copy(c.Writer, teeReader)
+	// Stream to client, the cached copy is dropped if either side fails
+	_, err = io.Copy(c.Writer, teeReader)
+	if closeErr := body.Close(); err == nil {
+		err = closeErr
+	}
+	pw.CloseWithError(err)
+	<-done
 }
 
 // handleStreamInfo handles getting real stream info
 // @Summary Get stream info
-// @Description Get video stream information including duration, bitrate, resolution
+// @Description Get stream information. Duration (seconds), bitrate, width, height, codec and audio_channels come from ffprobe (FFPROBE_BIN_PATH) and are omitted when it isn't installed or can't read the file
 // @Tags streaming
 // @Accept json
 // @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param id path string true "File ID"
 // @Success 200 {object} map[string]interface{} "Stream information"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - not file owner"
 // @Failure 404 {object} map[string]interface{} "File not found"
 // @Router /stream/{id}/info [get]
 func (a *API) handleStreamInfo(c *gin.Context) {
@@ -230,28 +747,37 @@ func (a *API) handleStreamInfo(c *gin.Context) {
 	
 	// Get real file metadata
 	fileType := getFileType(ext)
+	info := gin.H{
+		"filename":    fileInfo.Name,
+		"size":        fileInfo.Size,
+		"size_human":  formatBytes(fileInfo.Size),
+		"format":      strings.TrimPrefix(ext, "."),
+		"type":        fileType,
+		"modified":    fileInfo.ModTime,
+		"streamable":  true,
+		"provider":    "union",
+	}
+	
+	// Media fields are left out when ffprobe isn't installed or can't read the file
+	if media, err := a.probeMedia(c.Request.Context(), fileInfo); err == nil {
+		for key, value := range media.fields() {
+			info[key] = value
+		}
+	}
 	
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Stream info retrieved successfully",
 		"file_id": fileID,
-		"info": gin.H{
-			"filename":    fileInfo.Name,
-			"size":        fileInfo.Size,
-			"size_human":  formatBytes(fileInfo.Size),
-			"format":      strings.TrimPrefix(ext, "."),
-			"type":        fileType,
-			"modified":    fileInfo.ModTime,
-			"streamable":  true,
-			"provider":    "union",
-		},
+		"info":    info,
 		"streaming_urls": gin.H{
 			"direct":     fmt.Sprintf("/api/v1/stream/%s", fileID),
 			"download":   fmt.Sprintf("/api/v1/download/%s", fileID),
 		},
 		"capabilities": gin.H{
-			"range_requests": true,
+			"range_requests": !a.isNonSeekable(ext),
 			"progressive":    true,
 			"cacheable":      true,
+			"full_cache":     fileType == fileTypeAudio,
 		},
 		"source": "cloud_storage",
 	})
@@ -262,8 +788,15 @@ type FileInfo struct {
 	ID       string
 	Name     string
 	Filename string
-	Size     int64
+	Size     int64 // of the content, which may be stored encrypted
 	ModTime  string
+
+	sealing *sealing // nil unless the object is encrypted
+}
+
+// cacheValidator identifies the file's content for the cache
+func (f *FileInfo) cacheValidator() string {
+	return cacheValidator(f.Size, f.ModTime)
 }
 
 type RangeSpec struct {
@@ -273,42 +806,27 @@ type RangeSpec struct {
 
 // getFileInfo retrieves file information from cloud
 func (a *API) getFileInfo(fileID string) (*FileInfo, error) {
-	cmd := exec.Command("rclone", "lsjson", "union:uploads/")
-	if a.config.Rclone.ConfigPath != "" {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("RCLONE_CONFIG=%s", a.config.Rclone.ConfigPath))
-	}
-	
-	output, err := cmd.Output()
+	record := a.fileRecord(fileID)
+	file, err := a.findObject(context.Background(), fileID, record)
 	if err != nil {
 		return nil, err
 	}
-	
-	var files []map[string]interface{}
-	if err := json.Unmarshal(output, &files); err != nil {
-		return nil, err
+	if file == nil {
+		return nil, fmt.Errorf("file not found")
 	}
 	
-	for _, file := range files {
-		if name, ok := file["Name"].(string); ok {
-			if strings.HasPrefix(name, fileID+"_") {
-				parts := strings.SplitN(name, "_", 2)
-				originalName := name
-				if len(parts) > 1 {
-					originalName = parts[1]
-				}
-				
-				return &FileInfo{
-					ID:       fileID,
-					Name:     originalName,
-					Filename: name,
-					Size:     int64(file["Size"].(float64)),
-					ModTime:  file["ModTime"].(string),
-				}, nil
-			}
-		}
+	info := &FileInfo{
+		ID:       fileID,
+		Name:     uploadedName(file.Name, record),
+		Filename: file.Name,
+		Size:     file.Size,
+		ModTime:  file.ModTime.Format(time.RFC3339Nano),
+		sealing:  fileSealing(record),
 	}
-	
-	return nil, fmt.Errorf("file not found")
+	if info.sealing != nil {
+		info.Size = info.sealing.size
+	}
+	return info, nil
 }
 
 // isStreamableFormat checks if file format is streamable
@@ -330,15 +848,22 @@ func isStreamableFormat(ext string) bool {
 	return streamableFormats[ext]
 }
 
+// Streamable file types
+const (
+	fileTypeVideo   = "video"
+	fileTypeAudio   = "audio"
+	fileTypeUnknown = "unknown"
+)
+
 // getFileType returns file type based on extension
 func getFileType(ext string) string {
 	switch ext {
 	case ".mp4", ".mkv", ".avi", ".mov", ".wmv", ".flv", ".webm":
-		return "video"
+		return fileTypeVideo
 	case ".mp3", ".wav", ".flac", ".aac", ".ogg":
-		return "audio"
+		return fileTypeAudio
 	default:
-		return "unknown"
+		return fileTypeUnknown
 	}
 }
 
@@ -365,51 +890,69 @@ func getContentType(ext string) string {
 	return "application/octet-stream"
 }
 
-// parseRangeHeader parses HTTP Range header
-func parseRangeHeader(rangeHeader string, fileSize int64) []RangeSpec {
-	var ranges []RangeSpec
-	
-	// Remove "bytes=" prefix
-	if !strings.HasPrefix(rangeHeader, "bytes=") {
-		return ranges
+// Range header errors, all answered with 416 Range Not Satisfiable
+var (
+	errMalformedRange     = errors.New("malformed Range header")
+	errUnsatisfiableRange = errors.New("no requested range overlaps the file")
+	errTooManyRanges      = fmt.Errorf("more than %d ranges requested", maxRanges)
+)
+
+// maxRanges bounds the parts of a multipart/byteranges response, each costs a fetch
+const maxRanges = 16
+
+// parseRangeHeader parses an HTTP Range header (RFC 7233): first-last, first- and
+// suffix -length ranges. Ranges past the end of the file are clamped to it, ranges
+// starting beyond it are dropped, and an error is returned when the header is
+// malformed or no range is left.
+func parseRangeHeader(rangeHeader string, fileSize int64) ([]RangeSpec, error) {
+	rangeStr, ok := strings.CutPrefix(rangeHeader, "bytes=")
+	if !ok {
+		return nil, errMalformedRange
 	}
 	
-	rangeStr := strings.TrimPrefix(rangeHeader, "bytes=")
 	rangeParts := strings.Split(rangeStr, ",")
+	if len(rangeParts) > maxRanges {
+		return nil, errTooManyRanges
+	}
 	
+	var ranges []RangeSpec
 	for _, part := range rangeParts {
-		part = strings.TrimSpace(part)
-		if strings.Contains(part, "-") {
-			rangeBounds := strings.Split(part, "-")
-			if len(rangeBounds) == 2 {
-				var start, end int64
-				var err error
-				
-				if rangeBounds[0] != "" {
-					start, err = strconv.ParseInt(rangeBounds[0], 10, 64)
-					if err != nil {
-						continue
-					}
-				}
-				
-				if rangeBounds[1] != "" {
-					end, err = strconv.ParseInt(rangeBounds[1], 10, 64)
-					if err != nil {
-						continue
-					}
-				} else {
-					end = fileSize - 1
-				}
-				
-				if start <= end && start < fileSize {
-					if end >= fileSize {
-						end = fileSize - 1
-					}
-					ranges = append(ranges, RangeSpec{Start: start, End: end})
-				}
+		first, last, ok := strings.Cut(strings.TrimSpace(part), "-")
+		if !ok {
+			return nil, errMalformedRange
+		}
+		first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+		
+		if first == "" {
+			// Suffix range, the last n bytes
+			length, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || length < 0 {
+				return nil, errMalformedRange
+			}
+			if length > 0 && fileSize > 0 {
+				ranges = append(ranges, RangeSpec{Start: max(fileSize-length, 0), End: fileSize - 1})
+			}
+			continue
+		}
+		
+		start, err := strconv.ParseInt(first, 10, 64)
+		if err != nil || start < 0 {
+			return nil, errMalformedRange
+		}
+		end := fileSize - 1
+		if last != "" {
+			if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+				return nil, errMalformedRange
 			}
 		}
+		
+		if start < fileSize {
+			ranges = append(ranges, RangeSpec{Start: start, End: min(end, fileSize-1)})
+		}
 	}
 	
-	return ranges
-}
\ No newline at end of file
+	if len(ranges) == 0 {
+		return nil, errUnsatisfiableRange
+	}
+	return ranges, nil
+}
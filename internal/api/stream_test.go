@@ -0,0 +1,240 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nabilulilalbab/rclonestorage/internal/cache"
+	"github.com/nabilulilalbab/rclonestorage/internal/storage"
+)
+
+func TestStreamRedirectMode(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	ta.config.Storage.DirectURLs = true
+	ta.config.Storage.StreamMode = streamModeRedirect
+	mem := useMemProvider(t, ta)
+	mem.linkURL = "https://cdn.example.com"
+	user := ta.newUser(t, "owner@example.com")
+	ta.addMemFile(t, mem, user, "file1", "clip.mp4", []byte("not really a video"))
+
+	w := ta.do(t, http.MethodGet, "/api/v1/stream/file1", user, nil)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "https://cdn.example.com/uploads/file1_clip.mp4" {
+		t.Fatalf("got %d to %q, want a redirect to the direct URL", w.Code, w.Header().Get("Location"))
+	}
+	if got := w.Header().Get("X-Stream-Mode"); got != streamModeRedirect {
+		t.Errorf("X-Stream-Mode = %q", got)
+	}
+
+	// The query overrides the configured mode
+	w = ta.do(t, http.MethodGet, "/api/v1/stream/file1?mode=proxy", user, nil)
+	if w.Code != http.StatusOK || w.Body.String() != "not really a video" {
+		t.Errorf("mode=proxy: got %d %q, want the proxied content", w.Code, w.Body.String())
+	}
+
+	// Providers without direct URLs are proxied
+	mem.linkURL = ""
+	w = ta.do(t, http.MethodGet, "/api/v1/stream/file1", user, nil)
+	if w.Code != http.StatusOK || w.Header().Get("X-Stream-Mode") != streamModeProxy {
+		t.Errorf("no direct URL: got %d in mode %q, want proxied", w.Code, w.Header().Get("X-Stream-Mode"))
+	}
+}
+
+func TestStreamRedirectNeedsDirectURLs(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	mem := useMemProvider(t, ta)
+	mem.linkURL = "https://cdn.example.com"
+	user := ta.newUser(t, "owner@example.com")
+	ta.addMemFile(t, mem, user, "file1", "clip.mp4", []byte("video"))
+
+	// Without DIRECT_URLS_ENABLED the client can't ask for a redirect
+	w := ta.do(t, http.MethodGet, "/api/v1/stream/file1?mode=redirect", user, nil)
+	if w.Code != http.StatusOK || w.Header().Get("X-Stream-Mode") != streamModeProxy {
+		t.Errorf("got %d in mode %q, want proxied", w.Code, w.Header().Get("X-Stream-Mode"))
+	}
+}
+
+func TestStreamNonSeekableIgnoresRange(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	ta.config.Storage.NonSeekableFormats = []string{".avi"}
+	ta.config.Storage.NonSeekableMode = nonSeekableSequential
+	mem := useMemProvider(t, ta)
+	user := ta.newUser(t, "owner@example.com")
+	ta.addMemFile(t, mem, user, "file1", "clip.avi", []byte("avi without an index"))
+	ta.addMemFile(t, mem, user, "file2", "clip.mp4", []byte("seekable mp4"))
+	rangeHeader := http.Header{"Range": {"bytes=0-3"}}
+
+	w := ta.doWithHeader(t, http.MethodGet, "/api/v1/stream/file1", user, rangeHeader)
+	if w.Code != http.StatusOK || w.Body.String() != "avi without an index" {
+		t.Errorf("non-seekable: got %d %q, want the whole file", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Accept-Ranges"); got != "none" {
+		t.Errorf("non-seekable: Accept-Ranges = %q, want none", got)
+	}
+	if w := ta.doWithHeader(t, http.MethodHead, "/api/v1/stream/file1", user, nil); w.Header().Get("Accept-Ranges") != "none" {
+		t.Errorf("non-seekable HEAD: Accept-Ranges = %q, want none", w.Header().Get("Accept-Ranges"))
+	}
+
+	w = ta.doWithHeader(t, http.MethodGet, "/api/v1/stream/file2", user, rangeHeader)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "seek" {
+		t.Errorf("seekable: got %d %q, want bytes 0-3", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Accept-Ranges"); got != "bytes" {
+		t.Errorf("seekable: Accept-Ranges = %q, want bytes", got)
+	}
+}
+
+func TestStreamCachesWholeAudio(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	mem := useMemProvider(t, ta)
+	user := ta.newUser(t, "owner@example.com")
+	ta.addMemFile(t, mem, user, "file1", "song.mp3", []byte("not really audio"))
+
+	w := ta.do(t, http.MethodGet, "/api/v1/stream/file1", user, nil)
+	if w.Code != http.StatusOK || w.Body.String() != "not really audio" {
+		t.Fatalf("first play: got %d %q", w.Code, w.Body.String())
+	}
+	if w.Header().Get("X-Stream-Type") != fileTypeAudio || w.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("first play: stream type %q, cache %q, want audio and MISS", w.Header().Get("X-Stream-Type"), w.Header().Get("X-Cache"))
+	}
+
+	// Seeking is served from the cached copy
+	w = ta.doWithHeader(t, http.MethodGet, "/api/v1/stream/file1", user, http.Header{"Range": {"bytes=4-9"}})
+	if w.Code != http.StatusPartialContent || w.Body.String() != "really" {
+		t.Errorf("seek: got %d %q, want bytes 4-9", w.Code, w.Body.String())
+	}
+	if w.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("seek: X-Cache = %q, want HIT", w.Header().Get("X-Cache"))
+	}
+}
+
+func TestStreamVideoByRange(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	mem := useMemProvider(t, ta)
+	user := ta.newUser(t, "owner@example.com")
+	ta.addMemFile(t, mem, user, "file1", "clip.mp4", []byte("a long video, streamed in ranges"))
+
+	w := ta.doWithHeader(t, http.MethodGet, "/api/v1/stream/file1", user, http.Header{"Range": {"bytes=7-11"}})
+	if w.Code != http.StatusPartialContent || w.Body.String() != "video" {
+		t.Fatalf("got %d %q, want bytes 7-11", w.Code, w.Body.String())
+	}
+	if w.Header().Get("X-Stream-Type") != fileTypeVideo || w.Header().Get("Content-Range") != "bytes 7-11/32" {
+		t.Errorf("stream type %q, Content-Range %q", w.Header().Get("X-Stream-Type"), w.Header().Get("Content-Range"))
+	}
+	if w.Header().Get("X-Cache") == "HIT" {
+		t.Error("video range served from a whole cached copy")
+	}
+}
+
+func TestStreamServesLiveWhenCacheWritesFail(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	temp := filepath.Join(ta.config.Cache.Dir, "temp")
+	if err := os.RemoveAll(temp); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(temp, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mem := useMemProvider(t, ta)
+	user := ta.newUser(t, "owner@example.com")
+	ta.addMemFile(t, mem, user, "file1", "song.mp3", []byte("not really audio"))
+
+	w := ta.do(t, http.MethodGet, "/api/v1/stream/file1", user, nil)
+	if w.Code != http.StatusOK || w.Body.String() != "not really audio" {
+		t.Errorf("got %d %q, want the file served live", w.Code, w.Body.String())
+	}
+}
+
+func TestStreamVideoRangeFromCache(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	mem := useMemProvider(t, ta)
+	user := ta.newUser(t, "owner@example.com")
+	ta.addMemFile(t, mem, user, "file1", "clip.mp4", []byte("a cached video"))
+	if _, err := ta.cache.Put(context.Background(), "stream_file1", strings.NewReader("a cached video"), 14); err != nil {
+		t.Fatal(err)
+	}
+	// Served from the cache, not the provider
+	mem.put(ta.objectKey("file1_clip.mp4"), []byte("a remote video"))
+
+	w := ta.doWithHeader(t, http.MethodGet, "/api/v1/stream/file1", user, http.Header{"Range": {"bytes=2-7"}})
+	if w.Code != http.StatusPartialContent || w.Body.String() != "cached" || w.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("got %d %q from cache %q, want the cached bytes 2-7", w.Code, w.Body.String(), w.Header().Get("X-Cache"))
+	}
+}
+
+func TestStreamRangeFetchesOnlyItsChunks(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	mem := useMemProvider(t, ta)
+	user := ta.newUser(t, "owner@example.com")
+	data := bytes.Repeat([]byte("0123456789"), int(3*cache.ChunkSize/10))
+	ta.addMemFile(t, mem, user, "file1", "clip.mp4", data)
+
+	start := cache.ChunkSize + 10
+	w := ta.doWithHeader(t, http.MethodGet, "/api/v1/stream/file1", user, http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", start, start+9)}})
+	if w.Code != http.StatusPartialContent || w.Body.String() != string(data[start:start+10]) {
+		t.Fatalf("got %d %q", w.Code, w.Body.String())
+	}
+	want := storage.RangeSpec{Start: cache.ChunkSize, End: 2*cache.ChunkSize - 1}
+	if got := mem.requested(); len(got) != 1 || got[0] != want {
+		t.Errorf("fetched %v, want only %v", got, want)
+	}
+}
+
+func TestStreamRangeServedFromCachedChunks(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	mem := useMemProvider(t, ta)
+	user := ta.newUser(t, "owner@example.com")
+	ta.addMemFile(t, mem, user, "file1", "clip.mp4", []byte("0123456789"))
+	rangeHeader := http.Header{"Range": {"bytes=2-5"}}
+
+	for _, want := range []string{"MISS", "HIT"} {
+		w := ta.doWithHeader(t, http.MethodGet, "/api/v1/stream/file1", user, rangeHeader)
+		if w.Code != http.StatusPartialContent || w.Body.String() != "2345" {
+			t.Fatalf("got %d %q", w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("X-Cache"); got != want {
+			t.Errorf("X-Cache %q, want %s", got, want)
+		}
+	}
+	if got := mem.requested(); len(got) != 1 {
+		t.Errorf("fetched %v, want the chunk fetched once", got)
+	}
+}
+
+func TestStreamRangeOfOversizeFileBypassesCache(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	ta.cache.SetMaxEntrySize(5)
+	mem := useMemProvider(t, ta)
+	user := ta.newUser(t, "owner@example.com")
+	ta.addMemFile(t, mem, user, "file1", "clip.mp4", []byte("0123456789"))
+
+	w := ta.doWithHeader(t, http.MethodGet, "/api/v1/stream/file1", user, http.Header{"Range": {"bytes=2-5"}})
+	if w.Code != http.StatusPartialContent || w.Body.String() != "2345" || w.Header().Get("X-Cache") != "BYPASS" {
+		t.Fatalf("got %d %q, X-Cache %q, want bytes 2-5 uncached", w.Code, w.Body.String(), w.Header().Get("X-Cache"))
+	}
+	if used := ta.cache.Stats()["current_size"]; used != int64(0) {
+		t.Errorf("cache holds %v bytes, want it left empty", used)
+	}
+}
+
+func TestStreamRangeFallsBackToFullRead(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	mem := useMemProvider(t, ta)
+	mem.failRanges(errors.New("unknown flag: --offset"))
+	user := ta.newUser(t, "owner@example.com")
+	ta.addMemFile(t, mem, user, "file1", "clip.mp4", []byte("0123456789"))
+
+	w := ta.doWithHeader(t, http.MethodGet, "/api/v1/stream/file1", user, http.Header{"Range": {"bytes=4-6"}})
+	if w.Code != http.StatusPartialContent || w.Body.String() != "456" {
+		t.Errorf("got %d %q, want bytes 4-6 read from the start", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Range"); got != "bytes 4-6/10" {
+		t.Errorf("Content-Range %q", got)
+	}
+}
@@ -0,0 +1,267 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // registers the GIF decoder
+	"image/jpeg"
+	_ "image/png" // registers the PNG decoder
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Thumbnail bounds, w and h default to defaultThumbnailSize and are capped at maxThumbnailSize
+const (
+	defaultThumbnailSize = 320
+	maxThumbnailSize     = 1024
+
+	// maxThumbnailPixels refuses to decode larger images, which would take hundreds of MB
+	maxThumbnailPixels = 64 << 20
+
+	thumbnailTimeout = 60 * time.Second
+)
+
+// errNotPreviewable is returned for files no thumbnail can be made of
+var errNotPreviewable = errors.New("file type has no preview")
+
+// handleThumbnail serves a JPEG thumbnail of an image or video
+// @Summary Get thumbnail
+// @Description Get a JPEG preview fitting in w x h pixels (default 320, at most 1024), keeping the aspect ratio. JPEG, PNG and GIF images are scaled directly, videos and other images need ffmpeg, which grabs a video frame at THUMBNAIL_VIDEO_OFFSET. Thumbnails are cached until the file changes or the cache TTL passes
+// @Tags files
+// @Produce image/jpeg
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "File ID"
+// @Param w query int false "Maximum width" default(320)
+// @Param h query int false "Maximum height" default(320)
+// @Success 200 {file} binary "JPEG thumbnail"
+// @Failure 400 {object} map[string]interface{} "Invalid dimensions"
+// @Failure 404 {object} map[string]interface{} "File not found"
+// @Failure 415 {object} map[string]interface{} "File type has no preview"
+// @Router /files/{id}/thumbnail [get]
+func (a *API) handleThumbnail(c *gin.Context) {
+	width, widthErr := thumbnailDimension(c.Query("w"))
+	height, heightErr := thumbnailDimension(c.Query("h"))
+	if err := errors.Join(widthErr, heightErr); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid thumbnail dimensions",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	fileID := c.Param("id")
+	fileInfo, err := a.getFileInfo(fileID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "File not found",
+			"file_id": fileID,
+		})
+		return
+	}
+
+	path := a.cache.ThumbnailPath(fileID, fileInfo.cacheValidator(), width, height)
+	if _, err := os.Stat(path); err != nil {
+		err = a.generateThumbnail(c.Request.Context(), fileInfo, path, width, height)
+		if errors.Is(err, errNotPreviewable) {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{
+				"error":   "File type has no preview",
+				"details": err.Error(),
+				"file_id": fileID,
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to generate thumbnail",
+				"details": err.Error(),
+			})
+			return
+		}
+	}
+
+	c.Header("Content-Type", "image/jpeg")
+	c.Header("Cache-Control", "private, max-age=3600")
+	c.File(path)
+}
+
+// thumbnailDimension parses a w or h param
+func thumbnailDimension(raw string) (int, error) {
+	if raw == "" {
+		return defaultThumbnailSize, nil
+	}
+	size, err := strconv.Atoi(raw)
+	if err != nil || size < 1 || size > maxThumbnailSize {
+		return 0, fmt.Errorf("%q is not a size between 1 and %d", raw, maxThumbnailSize)
+	}
+	return size, nil
+}
+
+// generateThumbnail writes a thumbnail of a file to path, via a temporary file so a
+// failed or concurrent generation never leaves a partial image behind
+func (a *API) generateThumbnail(ctx context.Context, fileInfo *FileInfo, path string, width, height int) error {
+	ctx, cancel := context.WithTimeout(ctx, thumbnailTimeout)
+	defer cancel()
+
+	var thumbnail []byte
+	var err error
+	switch ext := strings.ToLower(filepath.Ext(fileInfo.Name)); ext {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		thumbnail, err = a.imageThumbnail(ctx, fileInfo, width, height)
+	case ".webp", ".bmp", ".tif", ".tiff":
+		thumbnail, err = a.ffmpegThumbnail(ctx, fileInfo, 0, width, height)
+	default:
+		if getFileType(ext) != fileTypeVideo {
+			return fmt.Errorf("%w: %s", errNotPreviewable, ext)
+		}
+		// Videos shorter than the offset have no frame there, use the first one
+		thumbnail, err = a.ffmpegThumbnail(ctx, fileInfo, a.config.Storage.ThumbnailOffset, width, height)
+		if err == nil && len(thumbnail) == 0 {
+			thumbnail, err = a.ffmpegThumbnail(ctx, fileInfo, 0, width, height)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if len(thumbnail) == 0 {
+		return errors.New("no frame could be decoded")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(path), ".thumbnail-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(thumbnail); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+// thumbnailSource opens a file for reading, from the download cache when it holds
+// the current version and from the cloud otherwise
+func (a *API) thumbnailSource(ctx context.Context, fileInfo *FileInfo) (io.ReadCloser, error) {
+	if reader, _, err := a.cache.GetValidated(ctx, fmt.Sprintf("download_%s", fileInfo.ID), fileInfo.cacheValidator()); err == nil {
+		return reader, nil
+	}
+	return a.catPlain(ctx, fileInfo.Filename, fileInfo.sealing)
+}
+
+// imageThumbnail decodes an image with the standard library and scales it down
+func (a *API) imageThumbnail(ctx context.Context, fileInfo *FileInfo, width, height int) ([]byte, error) {
+	source, err := a.thumbnailSource(ctx, fileInfo)
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	// The header tells the size before the pixels are decoded
+	var header bytes.Buffer
+	config, _, err := image.DecodeConfig(io.TeeReader(source, &header))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errNotPreviewable, err)
+	}
+	if config.Width*config.Height > maxThumbnailPixels {
+		return nil, fmt.Errorf("%w: %dx%d image is too large", errNotPreviewable, config.Width, config.Height)
+	}
+
+	img, _, err := image.Decode(io.MultiReader(&header, source))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, scaleDown(img, width, height), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// ffmpegThumbnail pipes a file through ffmpeg and returns the frame at offset as a
+// JPEG fitting in width x height, empty when the file has no frame there
+func (a *API) ffmpegThumbnail(ctx context.Context, fileInfo *FileInfo, offset time.Duration, width, height int) ([]byte, error) {
+	if _, err := exec.LookPath(a.config.Storage.FFmpegPath); err != nil {
+		return nil, fmt.Errorf("%w: ffmpeg not found at %s", errNotPreviewable, a.config.Storage.FFmpegPath)
+	}
+
+	source, err := a.thumbnailSource(ctx, fileInfo)
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	cmd := exec.CommandContext(ctx, a.config.Storage.FFmpegPath,
+		"-loglevel", "error",
+		"-ss", strconv.FormatFloat(offset.Seconds(), 'f', 3, 64),
+		"-i", "pipe:0",
+		"-frames:v", "1",
+		"-vf", fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease", width, height),
+		"-f", "image2",
+		"-c:v", "mjpeg",
+		"pipe:1",
+	)
+	cmd.Stdin = source
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return output, nil
+}
+
+// scaleDown fits img in width x height keeping its aspect ratio, averaging the source
+// pixels each target pixel covers. Images that already fit are returned as they are.
+func scaleDown(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	if srcW <= width && srcH <= height {
+		return img
+	}
+
+	scale := min(float64(width)/float64(srcW), float64(height)/float64(srcH))
+	dstW, dstH := max(int(float64(srcW)*scale), 1), max(int(float64(srcH)*scale), 1)
+
+	src := image.NewRGBA(bounds)
+	draw.Draw(src, bounds, img, bounds.Min, draw.Src)
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		y0, y1 := y*srcH/dstH, max((y+1)*srcH/dstH, y*srcH/dstH+1)
+		for x := 0; x < dstW; x++ {
+			x0, x1 := x*srcW/dstW, max((x+1)*srcW/dstW, x*srcW/dstW+1)
+
+			var r, g, b, alpha, n uint32
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r, g, b, alpha = r+uint32(p[0]), g+uint32(p[1]), b+uint32(p[2]), alpha+uint32(p[3])
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{uint8(r / n), uint8(g / n), uint8(b / n), uint8(alpha / n)})
+		}
+	}
+	return dst
+}
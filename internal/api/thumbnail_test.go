@@ -0,0 +1,74 @@
+package api
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImageThumbnail(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	user := ta.newUser(t, "owner@example.com")
+	img := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		t.Fatal(err)
+	}
+	ta.addTypedFile(t, user, "1", "wide.png", "image/png", encoded.Bytes())
+
+	w := ta.do(t, http.MethodGet, "/api/v1/files/1/thumbnail?w=100&h=100", user, nil)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("got %d as %q: %s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+	thumbnail, err := jpeg.Decode(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := thumbnail.Bounds().Size(); got != image.Pt(100, 50) {
+		t.Errorf("got %v, want 100x50 keeping the aspect ratio", got)
+	}
+
+	cached, _ := filepath.Glob(filepath.Join(ta.config.Cache.Dir, "thumbnails", "1_100x100_*.jpg"))
+	if len(cached) != 1 {
+		t.Fatalf("got cached thumbnails %v, want one", cached)
+	}
+	// A cached thumbnail is served without reading the file again
+	if err := os.WriteFile(cached[0], []byte("cached"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if w := ta.do(t, http.MethodGet, "/api/v1/files/1/thumbnail?w=100&h=100", user, nil); w.Body.String() != "cached" {
+		t.Error("thumbnail generated again instead of served from the cache")
+	}
+}
+
+func TestThumbnailRejects(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	ta.config.Storage.FFmpegPath = filepath.Join(t.TempDir(), "ffmpeg")
+	user := ta.newUser(t, "owner@example.com")
+	ta.addFile(t, user, "text", "notes.txt", []byte("text"))
+	ta.addFile(t, user, "video", "clip.mp4", []byte("video"))
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/api/v1/files/text/thumbnail?w=0", http.StatusBadRequest},
+		{"/api/v1/files/text/thumbnail?h=5000", http.StatusBadRequest},
+		{"/api/v1/files/text/thumbnail", http.StatusUnsupportedMediaType},
+		// Videos need ffmpeg
+		{"/api/v1/files/video/thumbnail", http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		if w := ta.do(t, http.MethodGet, tt.path, user, nil); w.Code != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.path, w.Code, tt.want)
+		}
+	}
+}
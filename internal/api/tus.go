@@ -0,0 +1,559 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+	"github.com/nabilulilalbab/rclonestorage/internal/logging"
+)
+
+// tusVersion is the tus protocol version implemented by the resumable upload endpoints
+const tusVersion = "1.0.0"
+
+// tusUpload is the state of a resumable upload. It is saved next to the partial
+// file so an upload can be resumed after a restart.
+type tusUpload struct {
+	ID        string    `json:"id"`
+	UserID    uint      `json:"user_id"`
+	Filename  string    `json:"filename"`
+	Length    int64     `json:"length"`
+	Offset    int64     `json:"offset"`
+	FileID    string    `json:"file_id,omitempty"` // set once the upload reached cloud storage
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// tusStore keeps resumable uploads in dir, <id>.part holding the bytes received
+// so far and <id>.json the upload state
+type tusStore struct {
+	dir   string
+	mu    sync.Mutex
+	locks map[string]*tusLock
+}
+
+// tusLock is the lock of one upload, dropped once nobody holds or waits for it
+type tusLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newTusStore(dir string) *tusStore {
+	return &tusStore{dir: dir, locks: make(map[string]*tusLock)}
+}
+
+func (s *tusStore) partPath(id string) string {
+	return filepath.Join(s.dir, id+".part")
+}
+
+func (s *tusStore) infoPath(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// lock serializes requests for one upload, returning the unlock func. id must
+// be a valid upload ID.
+func (s *tusStore) lock(id string) func() {
+	s.mu.Lock()
+	l, ok := s.locks[id]
+	if !ok {
+		l = &tusLock{}
+		s.locks[id] = l
+	}
+	l.refs++
+	s.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		s.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(s.locks, id)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// create starts an empty upload
+func (s *tusStore) create(upload *tusUpload) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.partPath(upload.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	file.Close()
+	return s.save(upload)
+}
+
+// get loads an upload, callers must hold its lock
+func (s *tusStore) get(id string) (*tusUpload, error) {
+	data, err := os.ReadFile(s.infoPath(id))
+	if err != nil {
+		return nil, err
+	}
+	var upload tusUpload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// exists reports whether an upload is stored, without taking its lock
+func (s *tusStore) exists(id string) bool {
+	_, err := os.Stat(s.infoPath(id))
+	return err == nil
+}
+
+func (s *tusStore) save(upload *tusUpload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.infoPath(upload.ID), data, 0644)
+}
+
+// pending returns the bytes reserved by the unfinished uploads of a user
+func (s *tusStore) pending(userID uint) int64 {
+	infos, _ := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	var total int64
+	for _, info := range infos {
+		upload, err := s.get(strings.TrimSuffix(filepath.Base(info), ".json"))
+		if err == nil && upload.UserID == userID && upload.FileID == "" {
+			total += upload.Length
+		}
+	}
+	return total
+}
+
+// purgeStale removes the uploads, finished or not, whose state was last saved
+// more than maxAge ago. Run it before serving requests.
+func (s *tusStore) purgeStale(maxAge time.Duration) {
+	infos, _ := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	for _, info := range infos {
+		stat, err := os.Stat(info)
+		if err == nil && time.Since(stat.ModTime()) > maxAge {
+			s.remove(strings.TrimSuffix(filepath.Base(info), ".json"))
+		}
+	}
+}
+
+// remove deletes an upload and its partial file, callers must hold its lock
+func (s *tusStore) remove(id string) {
+	os.Remove(s.partPath(id))
+	os.Remove(s.infoPath(id))
+}
+
+// setTusHeaders sets the headers every tus response carries
+func setTusHeaders(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Cache-Control", "no-store")
+}
+
+// tusMetadata decodes an Upload-Metadata header ("key base64value,key base64value")
+func tusMetadata(header string) map[string]string {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			continue
+		}
+		metadata[key] = string(decoded)
+	}
+	return metadata
+}
+
+// handleCreateUpload creates a resumable upload
+// @Summary Create resumable upload
+// @Description Start a tus 1.0.0 resumable upload of Upload-Length bytes. The filename is taken from the filename (or name) key of Upload-Metadata. Quota and UPLOAD_MAX_SIZE are checked against Upload-Length up front, the quota counting the user's unfinished uploads as well
+// @Tags files
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param Tus-Resumable header string true "Protocol version, 1.0.0"
+// @Param Upload-Length header int true "Total size in bytes"
+// @Param Upload-Metadata header string false "Comma separated key and base64 value pairs, e.g. filename ZmlsZS5tcDQ="
+// @Success 201 {string} string "Upload created, Location holds its URL"
+// @Failure 400 {object} map[string]interface{} "Missing or invalid Upload-Length"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - upload permission denied or quota exceeded"
+// @Failure 412 {object} map[string]interface{} "Unsupported Tus-Resumable version"
+// @Failure 413 {object} map[string]interface{} "Upload larger than UPLOAD_MAX_SIZE"
+// @Failure 415 {object} map[string]interface{} "Extension in BLOCKED_EXTENSIONS"
+// @Router /uploads [post]
+func (a *API) handleCreateUpload(c *gin.Context) {
+	setTusHeaders(c)
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		c.JSON(http.StatusPreconditionFailed, gin.H{
+			"error": "Unsupported tus version",
+		})
+		return
+	}
+
+	user, exists := auth.GetCurrentUser(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Authentication required",
+		})
+		return
+	}
+	if !a.authManager.Permissions.Can(user, auth.ActionUpload) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Upload permission denied",
+		})
+		return
+	}
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid Upload-Length",
+		})
+		return
+	}
+	if maxSize := a.config.Storage.UploadMaxSize; maxSize > 0 && length > maxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":    "Upload too large",
+			"max_size": maxSize,
+			"size":     length,
+		})
+		return
+	}
+	// Unfinished uploads count against the quota, so several can't overrun it together
+	pending := a.uploads.pending(user.ID)
+	if !user.HasStorageSpace(pending + length) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":    "Storage quota exceeded",
+			"quota":    user.StorageQuota,
+			"used":     user.StorageUsed,
+			"pending":  pending,
+			"required": length,
+		})
+		return
+	}
+
+	metadata := tusMetadata(c.GetHeader("Upload-Metadata"))
+	filename := metadata["filename"]
+	if filename == "" {
+		filename = metadata["name"]
+	}
+	filename = filepath.Base(filename)
+	if filename == "" || filename == "." || filename == string(filepath.Separator) {
+		filename = "upload"
+	}
+	if err := a.checkUploadName(filename); err != nil {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"error":   "File type not allowed",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	upload := &tusUpload{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		Filename:  filename,
+		Length:    length,
+		CreatedAt: time.Now(),
+	}
+	if err := a.uploads.create(upload); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to create upload",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.Header("Location", "/api/v1/uploads/"+upload.ID)
+	c.Header("Upload-Offset", "0")
+	c.Status(http.StatusCreated)
+}
+
+// handleUploadOffset reports how much of a resumable upload was received
+// @Summary Get resumable upload offset
+// @Description Return the number of bytes received so far in Upload-Offset, and X-File-ID once the upload has reached cloud storage
+// @Tags files
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Upload ID"
+// @Success 200 {string} string "Upload-Offset and Upload-Length headers"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 404 {object} map[string]interface{} "Upload not found"
+// @Router /uploads/{id} [head]
+func (a *API) handleUploadOffset(c *gin.Context) {
+	setTusHeaders(c)
+
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Upload not found",
+		})
+		return
+	}
+	defer a.uploads.lock(id)()
+
+	upload, ok := a.ownUpload(c, id)
+	if !ok {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if upload.FileID != "" {
+		c.Header("X-File-ID", upload.FileID)
+	}
+	c.Status(http.StatusOK)
+}
+
+// handleUploadChunk appends a chunk to a resumable upload
+// @Summary Append to resumable upload
+// @Description Append the request body at Upload-Offset, which must match the bytes received so far. Once Upload-Length bytes are in, the file is copied to cloud storage and X-File-ID holds its ID. If that copy fails, repeat the request with an empty body to retry it
+// @Tags files
+// @Accept application/offset+octet-stream
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Upload ID"
+// @Param Tus-Resumable header string true "Protocol version, 1.0.0"
+// @Param Upload-Offset header int true "Offset the chunk starts at"
+// @Success 204 {string} string "Chunk stored, Upload-Offset holds the new offset"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Quota exceeded since the upload was created, the upload is discarded"
+// @Failure 404 {object} map[string]interface{} "Upload not found"
+// @Failure 409 {object} map[string]interface{} "Upload-Offset doesn't match"
+// @Failure 412 {object} map[string]interface{} "Unsupported Tus-Resumable version"
+// @Failure 415 {object} map[string]interface{} "Content-Type must be application/offset+octet-stream"
+// @Failure 500 {object} map[string]interface{} "Copy to cloud storage failed"
+// @Router /uploads/{id} [patch]
+func (a *API) handleUploadChunk(c *gin.Context) {
+	setTusHeaders(c)
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		c.JSON(http.StatusPreconditionFailed, gin.H{
+			"error": "Unsupported tus version",
+		})
+		return
+	}
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"error": "Content-Type must be application/offset+octet-stream",
+		})
+		return
+	}
+
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Upload not found",
+		})
+		return
+	}
+	defer a.uploads.lock(id)()
+
+	upload, ok := a.ownUpload(c, id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Upload not found",
+		})
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset != upload.Offset {
+		c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "Upload-Offset doesn't match the bytes received",
+			"offset": upload.Offset,
+		})
+		return
+	}
+
+	// Progress requests see the chunk arrive, between chunks they read the saved offset
+	progress, err := a.progress.start(id, upload.UserID, upload.Length, upload.Offset)
+	if err == nil {
+		c.Request.Body = &progressReader{ReadCloser: c.Request.Body, progress: progress}
+		defer func() {
+			if upload.FileID != "" {
+				a.progress.finish(id, progress, progressCompleted, upload.FileID, "")
+			} else {
+				a.progress.drop(id, progress)
+			}
+		}()
+	}
+
+	if upload.Offset < upload.Length {
+		written, err := a.appendChunk(upload, c.Request.Body)
+		upload.Offset += written
+		if saveErr := a.uploads.save(upload); err == nil {
+			err = saveErr
+		}
+		if err != nil {
+			c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to store chunk",
+				"details": err.Error(),
+			})
+			return
+		}
+	}
+
+	if upload.Offset == upload.Length {
+		if progress != nil {
+			progress.setState(progressStoring)
+		}
+		// The content type is only known once every byte arrived
+		if upload.FileID == "" {
+			if err := a.checkUploadType(detectMimeType(a.uploads.partPath(upload.ID), upload.Filename)); err != nil {
+				a.uploads.remove(upload.ID)
+				c.JSON(http.StatusUnsupportedMediaType, gin.H{
+					"error":   "File type not allowed",
+					"details": err.Error(),
+				})
+				return
+			}
+		}
+		if err := a.finishUpload(c, upload); errors.Is(err, errQuotaExceeded) {
+			a.uploads.remove(upload.ID)
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Storage quota exceeded",
+			})
+			return
+		} else if err != nil {
+			c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to upload to cloud storage",
+				"details": err.Error(),
+			})
+			return
+		}
+		c.Header("X-File-ID", upload.FileID)
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Status(http.StatusNoContent)
+}
+
+// ownUpload loads an upload of the current user
+func (a *API) ownUpload(c *gin.Context, id string) (*tusUpload, bool) {
+	userID, exists := auth.GetCurrentUserID(c)
+	if !exists {
+		return nil, false
+	}
+	upload, err := a.uploads.get(id)
+	if err != nil || upload.UserID != userID {
+		return nil, false
+	}
+	return upload, true
+}
+
+// appendChunk writes body to the end of the partial file, never past Upload-Length.
+// A dropped connection still keeps what arrived.
+func (a *API) appendChunk(upload *tusUpload, body io.Reader) (int64, error) {
+	file, err := os.OpenFile(a.uploads.partPath(upload.ID), os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	// Discard anything a failed earlier request wrote past the recorded offset
+	if err := file.Truncate(upload.Offset); err != nil {
+		return 0, err
+	}
+	if _, err := file.Seek(upload.Offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	written, err := io.Copy(file, io.LimitReader(body, upload.Length-upload.Offset))
+	if err != nil && written > 0 {
+		// Keep the bytes that made it, the client resumes from the new offset
+		err = nil
+	}
+	if syncErr := file.Sync(); err == nil {
+		err = syncErr
+	}
+	return written, err
+}
+
+// findPartDuplicate looks for a stored file with the content of a complete upload
+func (a *API) findPartDuplicate(c *gin.Context, user *auth.User, partPath string, size int64) *auth.FileOwnership {
+	if a.config.Storage.Deduplicate == dedupeOff {
+		return nil
+	}
+	part, err := os.Open(partPath)
+	if err != nil {
+		return nil
+	}
+	defer part.Close()
+	return a.findDuplicate(c.Request.Context(), user, part, size)
+}
+
+// errQuotaExceeded is returned by finishUpload when the upload no longer fits the quota
+var errQuotaExceeded = errors.New("storage quota exceeded")
+
+// finishUpload copies a complete upload to cloud storage and records its ownership
+func (a *API) finishUpload(c *gin.Context, upload *tusUpload) error {
+	if upload.FileID != "" {
+		return nil
+	}
+
+	// The quota may have been used up since the upload was created
+	user, err := a.authManager.DatabaseManager.GetUserByID(upload.UserID)
+	if err != nil {
+		return fmt.Errorf("user not found")
+	}
+	if !user.HasStorageSpace(upload.Length) {
+		return errQuotaExceeded
+	}
+
+	fileID := uuid.New().String()
+	object := fmt.Sprintf("%s_%s", fileID, upload.Filename)
+	provider, _ := a.uploadTarget(context.Background(), object)
+	partPath := a.uploads.partPath(upload.ID)
+
+	log := logging.FromContext(c.Request.Context()).WithField("upload_id", upload.ID)
+
+	// Content already stored is referenced instead of uploaded again
+	if original := a.findPartDuplicate(c, user, partPath, upload.Length); original != nil {
+		err := a.recordDuplicate(user, fileID, upload.Filename, original)
+		if err == nil {
+			upload.FileID = fileID
+			if err := a.uploads.save(upload); err != nil {
+				log.Warnf("Failed to save upload state: %v", err)
+			}
+			os.Remove(partPath)
+			return nil
+		}
+		log.WithField("file_id", fileID).Warnf("Failed to share stored copy, uploading it: %v", err)
+	}
+
+	sealed, err := a.storeObject(context.Background(), partPath, provider, object)
+	if err != nil {
+		return err
+	}
+
+	a.recordUpload(c.Request.Context(), user, fileID, upload.Filename, partPath, upload.Length, provider, sealed)
+
+	// Keep only the state, so a late HEAD still learns the file ID
+	upload.FileID = fileID
+	if err := a.uploads.save(upload); err != nil {
+		log.Warnf("Failed to save upload state: %v", err)
+	}
+	os.Remove(partPath)
+	return nil
+}
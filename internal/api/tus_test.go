@@ -0,0 +1,249 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+)
+
+// tus sends a tus request with the protocol header and header added to it
+func (ta *testAPI) tus(t *testing.T, method, path string, user *auth.User, header http.Header, body io.Reader) *httptest.ResponseRecorder {
+	t.Helper()
+	req := ta.request(t, method, path, user, body)
+	req.Header.Set("Tus-Resumable", tusVersion)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	return serve(ta.registerRoutes, req)
+}
+
+// createUpload starts a tus upload of length bytes named filename and returns its URL
+func (ta *testAPI) createUpload(t *testing.T, user *auth.User, filename string, length int) string {
+	t.Helper()
+	w := ta.tus(t, http.MethodPost, "/api/v1/uploads", user, http.Header{
+		"Upload-Length":   {strconv.Itoa(length)},
+		"Upload-Metadata": {"filename " + base64.StdEncoding.EncodeToString([]byte(filename))},
+	}, nil)
+	if w.Code != http.StatusCreated || w.Header().Get("Upload-Offset") != "0" {
+		t.Fatalf("create: got %d: %s", w.Code, w.Body.String())
+	}
+	return w.Header().Get("Location")
+}
+
+// patchUpload sends chunk at offset
+func (ta *testAPI) patchUpload(t *testing.T, location string, user *auth.User, offset int, chunk string) *httptest.ResponseRecorder {
+	t.Helper()
+	return ta.tus(t, http.MethodPatch, location, user, http.Header{
+		"Upload-Offset": {strconv.Itoa(offset)},
+		"Content-Type":  {"application/offset+octet-stream"},
+	}, strings.NewReader(chunk))
+}
+
+func TestTusUploadInChunks(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	mem := useMemProvider(t, ta)
+	user := ta.newUser(t, "owner@example.com")
+	location := ta.createUpload(t, user, "notes.txt", 11)
+
+	w := ta.patchUpload(t, location, user, 0, "hello")
+	if w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != "5" || w.Header().Get("X-File-ID") != "" {
+		t.Fatalf("first chunk: got %d, offset %q: %s", w.Code, w.Header().Get("Upload-Offset"), w.Body.String())
+	}
+
+	// Resuming starts from the offset the server reports
+	w = ta.tus(t, http.MethodHead, location, user, nil, nil)
+	if w.Code != http.StatusOK || w.Header().Get("Upload-Offset") != "5" || w.Header().Get("Upload-Length") != "11" {
+		t.Fatalf("head: got %d, offset %q of %q", w.Code, w.Header().Get("Upload-Offset"), w.Header().Get("Upload-Length"))
+	}
+
+	w = ta.patchUpload(t, location, user, 5, " world")
+	fileID := w.Header().Get("X-File-ID")
+	if w.Code != http.StatusNoContent || fileID == "" {
+		t.Fatalf("last chunk: got %d: %s", w.Code, w.Body.String())
+	}
+	if stored, ok := mem.object(ta.objectKey(fileID + "_notes.txt")); !ok || !bytes.Equal(stored, []byte("hello world")) {
+		t.Errorf("provider holds %q, want the whole upload", stored)
+	}
+	if _, err := ta.db.CheckFileOwnership(fileID, user.ID); err != nil {
+		t.Errorf("no ownership recorded: %v", err)
+	}
+
+	// A late HEAD still learns the file ID
+	if w := ta.tus(t, http.MethodHead, location, user, nil, nil); w.Header().Get("X-File-ID") != fileID {
+		t.Errorf("head after completion: X-File-ID = %q, want %q", w.Header().Get("X-File-ID"), fileID)
+	}
+}
+
+func TestTusUploadOffsetMismatch(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	useMemProvider(t, ta)
+	user := ta.newUser(t, "owner@example.com")
+	location := ta.createUpload(t, user, "notes.txt", 11)
+	ta.patchUpload(t, location, user, 0, "hello")
+
+	w := ta.patchUpload(t, location, user, 0, "hello")
+	if w.Code != http.StatusConflict || w.Header().Get("Upload-Offset") != "5" {
+		t.Errorf("got %d with offset %q, want 409 with offset 5", w.Code, w.Header().Get("Upload-Offset"))
+	}
+}
+
+func TestTusUploadsArePrivate(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	useMemProvider(t, ta)
+	owner := ta.newUser(t, "owner@example.com")
+	other := ta.newUser(t, "other@example.com")
+	location := ta.createUpload(t, owner, "notes.txt", 5)
+
+	if w := ta.tus(t, http.MethodHead, location, other, nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("head by another user: got %d, want 404", w.Code)
+	}
+	if w := ta.patchUpload(t, location, other, 0, "hello"); w.Code != http.StatusNotFound {
+		t.Errorf("patch by another user: got %d, want 404", w.Code)
+	}
+}
+
+func TestTusCreateChecks(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	ta.config.Storage.UploadMaxSize = 10
+	user := ta.newUser(t, "owner@example.com")
+
+	req := ta.request(t, http.MethodPost, "/api/v1/uploads", user, nil)
+	req.Header.Set("Upload-Length", "5")
+	if w := serve(ta.registerRoutes, req); w.Code != http.StatusPreconditionFailed || w.Header().Get("Tus-Version") != tusVersion {
+		t.Errorf("no Tus-Resumable: got %d, want 412 with Tus-Version", w.Code)
+	}
+	if w := ta.tus(t, http.MethodPost, "/api/v1/uploads", user, http.Header{"Upload-Length": {"11"}}, nil); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("over UPLOAD_MAX_SIZE: got %d, want 413", w.Code)
+	}
+	if w := ta.tus(t, http.MethodPost, "/api/v1/uploads", user, http.Header{"Upload-Length": {"-1"}}, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("negative length: got %d, want 400", w.Code)
+	}
+}
+
+func TestTusMetadata(t *testing.T) {
+	got := tusMetadata("filename Zm9vLm1wNA==, filetype dmlkZW8vbXA0,broken !!!,empty")
+	if got["filename"] != "foo.mp4" || got["filetype"] != "video/mp4" || got["empty"] != "" {
+		t.Errorf("got %v", got)
+	}
+	if _, ok := got["broken"]; ok {
+		t.Error("kept a value that isn't base64")
+	}
+}
+
+func TestTusUploadRestrictions(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	ta.config.Storage.BlockedExtensions = []string{".exe"}
+	ta.config.Storage.AllowedMimeTypes = []string{"text/*"}
+	user := ta.newUser(t, "owner@example.com")
+
+	w := ta.tus(t, http.MethodPost, "/api/v1/uploads", user, http.Header{
+		"Upload-Length":   {"5"},
+		"Upload-Metadata": {"filename " + base64.StdEncoding.EncodeToString([]byte("setup.exe"))},
+	}, nil)
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("blocked extension: got %d, want 415", w.Code)
+	}
+
+	// The content is only checked once the last chunk arrives
+	content := "%PDF-1.7\n"
+	location := ta.createUpload(t, user, "renamed.txt", len(content))
+	if w := ta.patchUpload(t, location, user, 0, content[:4]); w.Code != http.StatusNoContent {
+		t.Fatalf("first chunk: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := ta.patchUpload(t, location, user, 4, content[4:]); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("last chunk: got %d, want 415", w.Code)
+	}
+	if w := ta.tus(t, http.MethodHead, location, user, nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("rejected upload: got %d, want it removed", w.Code)
+	}
+}
+
+func TestTusUploadQuota(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	useMemProvider(t, ta)
+	user := ta.newUser(t, "owner@example.com")
+	user.StorageQuota = 10
+	if err := ta.db.UpdateUser(user); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unfinished uploads reserve their length
+	first := ta.createUpload(t, user, "first.txt", 6)
+	if w := ta.tus(t, http.MethodPost, "/api/v1/uploads", user, http.Header{"Upload-Length": {"6"}}, nil); w.Code != http.StatusForbidden {
+		t.Errorf("second upload over the reserved quota: got %d, want 403", w.Code)
+	}
+	second := ta.createUpload(t, user, "second.txt", 4)
+
+	// Quota used up by other files since the upload was created
+	user.StorageUsed = 8
+	if err := ta.db.UpdateUser(user); err != nil {
+		t.Fatal(err)
+	}
+	if w := ta.patchUpload(t, first, user, 0, "abcdef"); w.Code != http.StatusForbidden || w.Header().Get("X-File-ID") != "" {
+		t.Errorf("finishing over quota: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := ta.tus(t, http.MethodHead, first, user, nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("upload over quota: got %d, want it removed", w.Code)
+	}
+	if w := ta.patchUpload(t, second, user, 0, "ab"); w.Code != http.StatusNoContent {
+		t.Errorf("upload within quota: got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestTusLocksAreDropped(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	useMemProvider(t, ta)
+	user := ta.newUser(t, "owner@example.com")
+	location := ta.createUpload(t, user, "notes.txt", 5)
+
+	ta.patchUpload(t, location, user, 0, "hello")
+	ta.tus(t, http.MethodHead, location, user, nil, nil)
+	ta.getProgress(t, uuid.New().String(), user)
+
+	ta.uploads.mu.Lock()
+	defer ta.uploads.mu.Unlock()
+	if len(ta.uploads.locks) != 0 {
+		t.Errorf("%d upload locks left", len(ta.uploads.locks))
+	}
+}
+
+func TestTusPurgeStale(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	user := ta.newUser(t, "owner@example.com")
+	idle := ta.createUpload(t, user, "idle.txt", 5)
+	recent := ta.createUpload(t, user, "recent.txt", 5)
+
+	idleID := path.Base(idle)
+	modTime := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(ta.uploads.infoPath(idleID), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stale temp files go, resumable uploads are kept in their own directory
+	ta.cache.PurgeStaleTemp(time.Hour)
+	if w := ta.tus(t, http.MethodHead, idle, user, nil, nil); w.Code != http.StatusOK {
+		t.Errorf("temp sweep: idle upload got %d, want it kept", w.Code)
+	}
+
+	ta.uploads.purgeStale(24 * time.Hour)
+	if w := ta.tus(t, http.MethodHead, idle, user, nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("idle upload: got %d, want it removed", w.Code)
+	}
+	if _, err := os.Stat(ta.uploads.partPath(idleID)); !os.IsNotExist(err) {
+		t.Error("partial file of the idle upload was kept")
+	}
+	if w := ta.tus(t, http.MethodHead, recent, user, nil, nil); w.Code != http.StatusOK {
+		t.Errorf("recent upload: got %d, want it kept", w.Code)
+	}
+}
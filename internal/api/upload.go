@@ -1,10 +1,13 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
@@ -12,11 +15,15 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+	"github.com/nabilulilalbab/rclonestorage/internal/cache"
+	"github.com/nabilulilalbab/rclonestorage/internal/jobs"
+	"github.com/nabilulilalbab/rclonestorage/internal/logging"
+	"github.com/nabilulilalbab/rclonestorage/internal/storage"
 )
 
 // handleUpload handles file upload with authentication and ownership tracking
 // @Summary Upload file
-// @Description Upload a file to cloud storage with authentication and ownership tracking
+// @Description Upload a file to cloud storage with authentication and ownership tracking. The stored copy is checked against the bytes sent (by the provider's md5 or sha1, or the size when it keeps neither) and removed, failing the upload, when it differs. With CACHE_UPLOAD_TEE streamable files are cached on the way so the first playback is a cache hit
 // @Tags files
 // @Accept multipart/form-data
 // @Produce json
@@ -24,10 +31,16 @@ import (
 // @Security ApiKeyAuth
 // @Param file formData file true "File to upload"
 // @Param description formData string false "File description"
+// @Param async query bool false "Upload in the background and return a job ID"
+// @Param upload_id query string false "Client-chosen UUID to follow the upload at /uploads/{upload_id}/progress"
 // @Success 200 {object} map[string]interface{} "File uploaded successfully"
-// @Failure 400 {object} map[string]interface{} "Bad request - no file uploaded"
+// @Success 202 {object} map[string]interface{} "Upload job started, or a failed upload is being retried in the background"
+// @Failure 400 {object} map[string]interface{} "Bad request - no file uploaded or invalid upload_id"
 // @Failure 401 {object} map[string]interface{} "Unauthorized"
 // @Failure 403 {object} map[string]interface{} "Forbidden - upload permission denied or quota exceeded"
+// @Failure 409 {object} map[string]interface{} "upload_id already in use"
+// @Failure 413 {object} map[string]interface{} "Upload larger than UPLOAD_MAX_SIZE or its declared size"
+// @Failure 415 {object} map[string]interface{} "Extension in BLOCKED_EXTENSIONS or content type not in ALLOWED_MIME_TYPES"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /upload [post]
 func (a *API) handleUpload(c *gin.Context) {
@@ -41,21 +54,74 @@ func (a *API) handleUpload(c *gin.Context) {
 	}
 
 	// Check if user can upload
-	if !user.CanUpload() {
+	if !a.authManager.Permissions.Can(user, auth.ActionUpload) {
 		c.JSON(http.StatusForbidden, gin.H{
 			"error": "Upload permission denied",
 		})
 		return
 	}
 
+	// Count the body as it arrives when the client wants to follow the progress
+	progress, finishProgress, err := a.trackUpload(c, user.ID)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errUploadIDInUse) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"error":   "Invalid upload_id",
+			"details": err.Error(),
+		})
+		return
+	}
+	defer finishProgress()
+
+	// Bound the request body, leaving room for the multipart framing and form fields
+	maxSize := a.config.Storage.UploadMaxSize
+	if maxSize > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+multipartOverhead)
+	}
+
 	// Get uploaded file
 	file, err := c.FormFile("file")
 	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error":    "Upload too large",
+				"max_size": maxSize,
+			})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "No file uploaded",
 		})
 		return
 	}
+	if maxSize > 0 && file.Size > maxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":    "Upload too large",
+			"max_size": maxSize,
+			"size":     file.Size,
+		})
+		return
+	}
+	if progress != nil {
+		progress.setState(progressStoring)
+	}
+
+	// Check the type by name and content before anything is stored
+	if err := a.checkUploadFile(file); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errUploadTypeRejected) {
+			status = http.StatusUnsupportedMediaType
+		}
+		c.JSON(status, gin.H{
+			"error":   "File type not allowed",
+			"details": err.Error(),
+		})
+		return
+	}
 
 	// Check storage quota
 	if !user.HasStorageSpace(file.Size) {
@@ -70,10 +136,32 @@ func (a *API) handleUpload(c *gin.Context) {
 
 	// Generate unique filename
 	fileID := uuid.New().String()
+	c.Set("upload_file_id", fileID)
+
+	// Content already stored is referenced instead of uploaded again
+	if original := a.findUploadDuplicate(c, user, file); original != nil {
+		err := a.recordDuplicate(user, fileID, file.Filename, original)
+		if err == nil {
+			response := uploadResponse(user, fileID, file.Filename, original.Size, original.MimeType, original.Provider, a.unionPath(original.Object()))
+			response["deduplicated"] = true
+			c.JSON(http.StatusOK, response)
+			return
+		}
+		logging.FromContext(c.Request.Context()).WithField("file_id", fileID).Warnf("Failed to share stored copy, uploading it: %v", err)
+	}
+
 	filename := fmt.Sprintf("%s_%s", fileID, file.Filename)
+	provider, remotePath := a.uploadTarget(c.Request.Context(), filename)
+	
+	// Streamable files are likely played right away, send them to the cache and the
+	// cloud at once so the first playback is a cache hit
+	if a.teeToCache(file) && c.Query("async") != "true" {
+		a.uploadWithCache(c, user, fileID, file, provider, remotePath)
+		return
+	}
 	
 	// Create temp directory if not exists
-	tempDir := "./cache/temp"
+	tempDir := filepath.Join(a.config.Cache.Dir, "temp")
 	if err := os.MkdirAll(tempDir, 0755); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to create temp directory",
@@ -81,8 +169,15 @@ func (a *API) handleUpload(c *gin.Context) {
 		return
 	}
 
-	// Save file temporarily
+	// Save file temporarily. It is removed however the request ends, unless a
+	// background job took it over.
 	tempPath := filepath.Join(tempDir, filename)
+	handedOff := false
+	defer func() {
+		if !handedOff {
+			os.Remove(tempPath)
+		}
+	}()
 	if err := c.SaveUploadedFile(file, tempPath); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to save uploaded file",
@@ -90,18 +185,16 @@ func (a *API) handleUpload(c *gin.Context) {
 		return
 	}
 
-	// Upload to union storage using rclone
-	remotePath := fmt.Sprintf("union:uploads/%s", filename)
-	
-	// Execute rclone copy to upload file to cloud
-	cmd := exec.Command("rclone", "copy", tempPath, "union:uploads/")
-	if a.config.Rclone.ConfigPath != "" {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("RCLONE_CONFIG=%s", a.config.Rclone.ConfigPath))
+	// Upload to cloud storage in the background when asked to
+	if c.Query("async") == "true" {
+		handedOff = true
+		a.startUploadJob(c, user, fileID, file.Filename, file.Size, tempPath, provider, remotePath)
+		return
 	}
 	
-	if err := cmd.Run(); err != nil {
-		// Clean up temp file
-		os.Remove(tempPath)
+	// Upload the file to its provider
+	sealed, err := a.storeObject(context.Background(), tempPath, provider, filename)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to upload to cloud storage",
 			"details": err.Error(),
@@ -109,52 +202,396 @@ func (a *API) handleUpload(c *gin.Context) {
 		return
 	}
 	
-	// Determine MIME type
-	mimeType := "application/octet-stream"
-	ext := strings.ToLower(filepath.Ext(file.Filename))
-	switch ext {
-	case ".mp4":
-		mimeType = "video/mp4"
-	case ".mkv":
-		mimeType = "video/x-matroska"
-	case ".avi":
-		mimeType = "video/x-msvideo"
-	case ".jpg", ".jpeg":
-		mimeType = "image/jpeg"
-	case ".png":
-		mimeType = "image/png"
-	case ".txt":
-		mimeType = "text/plain"
-	case ".pdf":
-		mimeType = "application/pdf"
+	mimeType := a.recordUpload(c.Request.Context(), user, fileID, file.Filename, tempPath, file.Size, provider, sealed)
+	
+	c.JSON(http.StatusOK, uploadResponse(user, fileID, file.Filename, file.Size, mimeType, provider, remotePath))
+}
+
+// checkUploadFile applies BLOCKED_EXTENSIONS and ALLOWED_MIME_TYPES to a form upload
+func (a *API) checkUploadFile(file *multipart.FileHeader) error {
+	if err := a.checkUploadName(file.Filename); err != nil {
+		return err
+	}
+	if len(a.config.Storage.AllowedMimeTypes) == 0 {
+		return nil
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	return a.checkUploadType(sniffMimeType(readHead(src), file.Filename))
+}
+
+// findUploadDuplicate looks for a stored file with the content of a form upload
+func (a *API) findUploadDuplicate(c *gin.Context, user *auth.User, file *multipart.FileHeader) *auth.FileOwnership {
+	if a.config.Storage.Deduplicate == dedupeOff {
+		return nil
+	}
+	src, err := file.Open()
+	if err != nil {
+		return nil
+	}
+	defer src.Close()
+	return a.findDuplicate(c.Request.Context(), user, src, file.Size)
+}
+
+// multipartOverhead is the allowance for multipart framing on top of UPLOAD_MAX_SIZE
+const multipartOverhead = 1 << 20
+
+// errUploadTooLarge is returned when an upload carries more bytes than it declared
+var errUploadTooLarge = errors.New("upload exceeds its declared size")
+
+// uploadLimitReader passes through at most limit bytes of an upload. If the source
+// has more it calls abort and fails instead of silently truncating, so the provider,
+// which reads until EOF, can never store more than was declared and accounted for.
+type uploadLimitReader struct {
+	r         io.Reader
+	remaining int64
+	abort     func()
+	exceeded  bool
+}
+
+func (l *uploadLimitReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// Anything past the limit means the upload was larger than declared
+		var probe [1]byte
+		if n, _ := l.r.Read(probe[:]); n > 0 {
+			l.exceeded = true
+			l.abort()
+			return 0, errUploadTooLarge
+		}
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// uploadLimit returns how many bytes an upload may stream: its declared size, capped
+// by the user's remaining quota and UPLOAD_MAX_SIZE
+func (a *API) uploadLimit(user *auth.User, declared int64) int64 {
+	limit := declared
+	if user.StorageQuota > 0 {
+		if remaining := user.StorageQuota - user.StorageUsed; remaining < limit {
+			limit = remaining
+		}
+	}
+	if maxSize := a.config.Storage.UploadMaxSize; maxSize > 0 && maxSize < limit {
+		limit = maxSize
+	}
+	if limit < 0 {
+		limit = 0
+	}
+	return limit
+}
+
+// uploadTarget picks the provider a new upload is stored on, see
+// UnionStorageImpl.SelectProvider, and returns its name and the object's remote path.
+// Without a usable provider the union places the object.
+func (a *API) uploadTarget(ctx context.Context, filename string) (string, string) {
+	if selected := a.storage.SelectProvider(ctx); selected != nil {
+		if remotePath, ok := a.objectPath(selected.Name(), filename); ok {
+			return selected.Name(), remotePath
+		}
+		return selected.Name(), a.config.Storage.ObjectPath(selected.Name(), filename)
+	}
+	return "union", a.unionPath(filename)
+}
+
+// unionPath returns the remote path of an uploaded object on the union remote, of the
+// uploads directory when object is empty
+func (a *API) unionPath(object string) string {
+	return a.config.Storage.ObjectPath(a.config.Storage.UnionName, object)
+}
+
+// objectPath returns the remote path of an uploaded object on a provider, false when
+// the provider is unknown or not backed by an rclone remote
+func (a *API) objectPath(provider, object string) (string, bool) {
+	if provider == "union" {
+		return a.unionPath(object), true
+	}
+	if remote, ok := a.storage.GetProvider(provider).(storage.RemoteProvider); ok {
+		return a.config.Storage.ObjectPath(remote.Remote(), object), true
+	}
+	return "", false
+}
+
+// uploadResponse builds the response for a completed upload
+func uploadResponse(user *auth.User, fileID, filename string, size int64, mimeType, provider, remotePath string) gin.H {
+	return gin.H{
+		"message":     "File uploaded successfully to cloud",
+		"file_id":     fileID,
+		"filename":    filename,
+		"size":        size,
+		"mime_type":   mimeType,
+		"provider":    provider,
+		"remote_path": remotePath,
+		"status":      "uploaded_to_cloud",
+		"uploaded_at": time.Now(),
+		"owner":       user.Email,
+	}
+}
+
+// teeToCache reports whether an upload should be cached on its way to cloud storage
+func (a *API) teeToCache(file *multipart.FileHeader) bool {
+	if !a.config.Cache.UploadTee || !isStreamableFormat(strings.ToLower(filepath.Ext(file.Filename))) {
+		return false
+	}
+	return a.config.Cache.MaxEntrySize <= 0 || file.Size <= a.config.Cache.MaxEntrySize
+}
+
+// uploadWithCache streams an upload to cloud storage and into a staged cache entry at
+// the same time. The cache entry is only committed once the cloud upload succeeded,
+// and doubles as the local copy the checksum is computed from.
+func (a *API) uploadWithCache(c *gin.Context, user *auth.User, fileID string, file *multipart.FileHeader, provider, remotePath string) {
+	cacheManager := a.cache
+
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to read uploaded file",
+		})
+		return
+	}
+	defer src.Close()
+
+	// Stop the upload as soon as the client sends more than it declared so it can't
+	// finish storing the oversized object
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	limited := &uploadLimitReader{r: src, remaining: a.uploadLimit(user, file.Size), abort: cancel}
+
+	// The cache keeps the plaintext, only what goes to the cloud is encrypted
+	encryption, err := a.newSealing(file.Size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to encrypt upload",
+			"details": err.Error(),
+		})
+		return
+	}
+	pr, pw := io.Pipe()
+	sealed, err := a.seal(io.TeeReader(limited, pw), encryption)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to encrypt upload",
+			"details": err.Error(),
+		})
+		return
+	}
+	sent := newUploadDigest()
+	filename := fmt.Sprintf("%s_%s", fileID, file.Filename)
+
+	type stageResult struct {
+		pending *cache.PendingEntry
+		err     error
+	}
+	staged := make(chan stageResult, 1)
+	go func() {
+		pending, err := cacheManager.Stage(context.Background(), fmt.Sprintf("stream_%s", fileID), pr, file.Size)
+		if err != nil {
+			// Keep the upload flowing even though it won't be cached
+			io.Copy(io.Discard, pr)
+		}
+		staged <- stageResult{pending: pending, err: err}
+	}()
+
+	_, err = a.putObject(ctx, provider, filename, io.TeeReader(sealed, sent))
+	if err == nil && limited.exceeded {
+		err = errUploadTooLarge
+	}
+	pw.CloseWithError(err)
+	result := <-staged
+	
+	// A stored copy that doesn't match is removed and retried like a failed upload
+	if err == nil {
+		if err = a.verifyStored(c.Request.Context(), provider, filename, sent); err != nil {
+			a.deleteRemote(provider, filename)
+		}
+	}
+
+	if err != nil {
+		// The whole file reached the staging copy, so a transient cloud failure can be
+		// retried in the background from there instead of failing the upload
+		retryable := !limited.exceeded && c.Request.Context().Err() == nil &&
+			result.err == nil && result.pending.Size() == file.Size && a.config.Storage.UploadRetryAttempts > 1
+		if retryable {
+			logging.FromContext(c.Request.Context()).WithField("file_id", fileID).Warnf("Upload failed, retrying in the background: %v", err)
+			job := a.queueUpload(user, fileID, file.Filename, file.Size, result.pending.Path(), provider, remotePath)
+			c.Set("upload_job_id", job.ID)
+			c.JSON(http.StatusAccepted, gin.H{
+				"message":  "Upload to cloud storage failed, retrying in the background",
+				"job":      job,
+				"file_id":  fileID,
+				"filename": file.Filename,
+				"size":     file.Size,
+			})
+			return
+		}
+
+		if result.err == nil {
+			cacheManager.Discard(result.pending)
+		}
+		if limited.exceeded {
+			// Remove whatever part of the object already reached the remote
+			a.deleteRemote(provider, filename)
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error":    "Upload exceeds its declared size",
+				"declared": file.Size,
+				"limit":    a.uploadLimit(user, file.Size),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to upload to cloud storage",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	localPath := ""
+	if result.err != nil {
+		logging.FromContext(c.Request.Context()).WithField("file_id", fileID).Warnf("Failed to cache upload: %v", result.err)
+	} else if result.pending.Size() != file.Size {
+		cacheManager.Discard(result.pending)
+		result.err = fmt.Errorf("cached %d of %d bytes", result.pending.Size(), file.Size)
+	} else {
+		localPath = result.pending.Path()
 	}
 
+	mimeType := a.recordUpload(c.Request.Context(), user, fileID, file.Filename, localPath, file.Size, provider, encryption)
+
+	if result.err == nil {
+		if _, err := cacheManager.Commit(result.pending); err != nil {
+			logging.FromContext(c.Request.Context()).WithField("file_id", fileID).Warnf("Failed to cache upload: %v", err)
+		}
+	}
+
+	response := uploadResponse(user, fileID, file.Filename, file.Size, mimeType, provider, remotePath)
+	response["cached"] = result.err == nil
+	c.JSON(http.StatusOK, response)
+}
+
+// recordUpload creates the ownership record for a file uploaded to provider, stores the checksum
+// and content hash of the staged copy at localPath and sends any quota warning, returning the
+// detected MIME type. Warnings are logged with the request ID of ctx, if any.
+func (a *API) recordUpload(ctx context.Context, user *auth.User, fileID, filename, localPath string, size int64, provider string, sealed *sealing) string {
+	mimeType := detectMimeType(localPath, filename)
+	log := logging.FromContext(ctx).WithField("file_id", fileID)
+
 	// Create file ownership record
 	if err := a.authManager.DatabaseManager.CreateFileOwnership(
 		user.ID,
 		fileID,
-		file.Filename,
-		"union",
-		file.Size,
+		filename,
+		provider,
+		size,
 		mimeType,
 	); err != nil {
 		// File uploaded but ownership tracking failed
 		// Log error but don't fail the request
-		fmt.Printf("Warning: Failed to create file ownership record: %v\n", err)
+		log.Warnf("Failed to create file ownership record: %v", err)
+	} else {
+		a.recordSealing(ctx, fileID, sealed)
+		if provider != "union" {
+			if err := a.authManager.DatabaseManager.AddFileReplica(fileID, provider); err != nil {
+				log.Warnf("Failed to record replica on %s: %v", provider, err)
+			}
+			if a.config.Storage.Replicas > 1 {
+				a.replicateUpload(user.ID, fileID, fmt.Sprintf("%s_%s", fileID, filename), provider)
+			}
+		}
 	}
-	
-	// Clean up temp file after successful upload
-	os.Remove(tempPath)
-	
-	c.JSON(http.StatusOK, gin.H{
-		"message":     "File uploaded successfully to cloud",
-		"file_id":     fileID,
-		"filename":    file.Filename,
-		"size":        file.Size,
-		"mime_type":   mimeType,
-		"remote_path": remotePath,
-		"status":      "uploaded_to_cloud",
-		"uploaded_at": time.Now(),
-		"owner":       user.Email,
+
+	// Hash the staged copy while it is still local rather than re-reading it from the provider.
+	// The SHA-256 identifies the content for deduplication, the checksum is in CHECKSUM_ALGORITHM.
+	contentHash, err := storage.HashFile(localPath, "sha256")
+	checksum := contentHash
+	if err == nil && a.config.Storage.ChecksumAlgo != "sha256" {
+		checksum, err = storage.HashFile(localPath, a.config.Storage.ChecksumAlgo)
+	}
+	if err != nil {
+		log.Warnf("Failed to compute checksum: %v", err)
+	} else {
+		if err := a.authManager.DatabaseManager.SetFileChecksum(fileID, a.config.Storage.ChecksumAlgo, checksum); err != nil {
+			log.Warnf("Failed to store checksum: %v", err)
+		}
+		if err := a.authManager.DatabaseManager.SetFileContentHash(fileID, contentHash); err != nil {
+			log.Warnf("Failed to store content hash: %v", err)
+		}
+	}
+
+	a.uploadRecorded(user, fileID, size)
+	return mimeType
+}
+
+// uploadRecorded sends any quota warning for a new file and announces it
+func (a *API) uploadRecorded(user *auth.User, fileID string, size int64) {
+	// Warn the user once their usage crosses 90% of the quota
+	if user.StorageQuota > 0 {
+		threshold := user.StorageQuota * 9 / 10
+		if user.StorageUsed < threshold && user.StorageUsed+size >= threshold {
+			a.authManager.Notifier.Notify(user.ID, auth.NotifyQuotaWarning, "Storage almost full",
+				fmt.Sprintf("You are using %s of your %s storage quota.", formatBytes(user.StorageUsed+size), formatBytes(user.StorageQuota)))
+		}
+	}
+
+	a.fileChanged(FileUploaded, fileID, user.ID)
+}
+
+// deleteRemote removes an object from provider, ignoring errors
+func (a *API) deleteRemote(provider, object string) {
+	a.deleteObject(context.Background(), provider, object)
+}
+
+// startUploadJob copies a staged upload to cloud storage in the background
+func (a *API) startUploadJob(c *gin.Context, user *auth.User, fileID, originalName string, size int64, tempPath, provider, remotePath string) {
+	job := a.queueUpload(user, fileID, originalName, size, tempPath, provider, remotePath)
+	c.Set("upload_job_id", job.ID)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":  "Upload started",
+		"job":      job,
+		"file_id":  fileID,
+		"filename": originalName,
+		"size":     size,
+		"provider": provider,
 	})
-}
\ No newline at end of file
+}
+
+// queueUpload starts a job copying the staged file at tempPath to remotePath on provider. Failed
+// copies are retried per UPLOAD_RETRY_* and the staged file is kept until the job
+// succeeds or finally fails.
+func (a *API) queueUpload(user *auth.User, fileID, originalName string, size int64, tempPath, provider, remotePath string) jobs.Job {
+	object := fmt.Sprintf("%s_%s", fileID, originalName)
+	upload := func(ctx context.Context) (interface{}, error) {
+		// Cancelling the job stops the upload through ctx
+		sealed, err := a.storeObject(ctx, tempPath, provider, object)
+		if err != nil {
+			return nil, err
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		mimeType := a.recordUpload(ctx, user, fileID, originalName, tempPath, size, provider, sealed)
+		os.Remove(tempPath)
+		return gin.H{"file_id": fileID, "mime_type": mimeType, "provider": provider}, nil
+	}
+
+	cleanup := func() {
+		os.Remove(tempPath)
+		// Refund the quota if the ownership record was already created
+		a.authManager.DatabaseManager.DeleteFileOwnership(fileID, user.ID)
+		// Remove whatever part of the object already reached the remote
+		a.deleteRemote(provider, object)
+	}
+
+	return a.jobs.Start(user.ID, jobs.TypeUpload, remotePath, upload, cleanup)
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+)
+
+func TestUploadTeesToCache(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	ta.config.Cache.UploadTee = true
+	mem := useMemProvider(t, ta)
+	user := ta.newUser(t, "owner@example.com")
+	content := []byte("a freshly uploaded video")
+
+	w := ta.upload(t, user, "clip.mp4", content, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload: got %d: %s", w.Code, w.Body.String())
+	}
+	var uploaded struct {
+		FileID string `json:"file_id"`
+		Cached bool   `json:"cached"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &uploaded); err != nil {
+		t.Fatal(err)
+	}
+	if !uploaded.Cached {
+		t.Error("upload was not cached")
+	}
+	if stored, ok := mem.object(ta.objectKey(uploaded.FileID + "_clip.mp4")); !ok || string(stored) != string(content) {
+		t.Errorf("provider holds %q, want the upload", stored)
+	}
+	reader, _, err := ta.cache.Get(context.Background(), "stream_"+uploaded.FileID)
+	if err != nil {
+		t.Fatalf("cache has no copy: %v", err)
+	}
+	cached, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(cached) != string(content) {
+		t.Errorf("cache holds %q, want the upload", cached)
+	}
+
+	// The first playback is served from the cache
+	w = ta.do(t, http.MethodGet, "/api/v1/stream/"+uploaded.FileID, user, nil)
+	if w.Code != http.StatusOK || w.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("stream: got %d with X-Cache %q, want a hit", w.Code, w.Header().Get("X-Cache"))
+	}
+}
+
+func TestUploadTeeDiscardsFailedUpload(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	ta.config.Cache.UploadTee = true
+	ta.rclone.truncate = true
+	user := ta.newUser(t, "owner@example.com")
+
+	if w := ta.upload(t, user, "clip.mp4", []byte("cut short on the remote"), ""); w.Code != http.StatusInternalServerError {
+		t.Fatalf("upload: got %d, want 500: %s", w.Code, w.Body.String())
+	}
+	if entries := ta.cache.Entries(); len(entries) != 0 {
+		t.Errorf("cache kept %d entries of a failed upload", len(entries))
+	}
+}
+
+func TestUploadLimitReader(t *testing.T) {
+	aborted := false
+	within := &uploadLimitReader{r: strings.NewReader("12345"), remaining: 5, abort: func() { aborted = true }}
+	if data, err := io.ReadAll(within); err != nil || string(data) != "12345" || within.exceeded || aborted {
+		t.Errorf("declared size: got %q, %v, exceeded %v", data, err, within.exceeded)
+	}
+
+	over := &uploadLimitReader{r: strings.NewReader("123456"), remaining: 5, abort: func() { aborted = true }}
+	data, err := io.ReadAll(over)
+	if !errors.Is(err, errUploadTooLarge) || !over.exceeded || !aborted {
+		t.Errorf("oversized: got %v, exceeded %v, aborted %v, want errUploadTooLarge", err, over.exceeded, aborted)
+	}
+	if string(data) != "12345" {
+		t.Errorf("oversized: read %q, want only the declared 5 bytes", data)
+	}
+}
+
+func TestUploadLimit(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	user := &auth.User{StorageQuota: 100, StorageUsed: 70}
+	if got := ta.uploadLimit(user, 50); got != 30 {
+		t.Errorf("limit %d, want the 30 bytes of quota left", got)
+	}
+	if got := ta.uploadLimit(&auth.User{}, 50); got != 50 {
+		t.Errorf("limit %d without a quota, want the declared 50", got)
+	}
+	ta.config.Storage.UploadMaxSize = 20
+	if got := ta.uploadLimit(user, 50); got != 20 {
+		t.Errorf("limit %d, want UPLOAD_MAX_SIZE", got)
+	}
+	if got := ta.uploadLimit(&auth.User{StorageQuota: 10, StorageUsed: 15}, 5); got != 0 {
+		t.Errorf("limit %d over quota, want 0", got)
+	}
+}
+
+func TestUploadRestrictions(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	ta.config.Storage.BlockedExtensions = []string{".exe"}
+	ta.config.Storage.AllowedMimeTypes = []string{"text/*"}
+	ta.config.Storage.UploadMaxSize = 16
+	user := ta.newUser(t, "owner@example.com")
+
+	for _, tt := range []struct {
+		filename string
+		content  string
+		want     int
+	}{
+		{"notes.txt", "plain notes", http.StatusOK},
+		{"setup.EXE", "plain notes", http.StatusUnsupportedMediaType},
+		{"renamed.txt", "%PDF-1.7\n", http.StatusUnsupportedMediaType},
+		{"notes.txt", "more than sixteen bytes of notes", http.StatusRequestEntityTooLarge},
+	} {
+		if w := ta.upload(t, user, tt.filename, []byte(tt.content), ""); w.Code != tt.want {
+			t.Errorf("%s %q: got %d, want %d: %s", tt.filename, tt.content, w.Code, tt.want, w.Body.String())
+		}
+	}
+	if _, total, err := ta.db.ListUserFiles(user.ID, 0, 10, "name", "asc"); err != nil || total != 1 {
+		t.Errorf("recorded %d files (%v), want only the accepted one", total, err)
+	}
+}
+
+func TestUploadRemovesTempFile(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	user := ta.newUser(t, "owner@example.com")
+	tempDir := filepath.Join(ta.config.Cache.Dir, "temp")
+
+	if w := ta.upload(t, user, "stored.txt", []byte("kept on the remote"), ""); w.Code != http.StatusOK {
+		t.Fatalf("upload: got %d: %s", w.Code, w.Body.String())
+	}
+	ta.rclone.truncate = true
+	if w := ta.upload(t, user, "failed.txt", []byte("cut short on the remote"), ""); w.Code != http.StatusInternalServerError {
+		t.Fatalf("failed upload: got %d, want 500: %s", w.Code, w.Body.String())
+	}
+
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		t.Errorf("temp file %s left behind", entry.Name())
+	}
+}
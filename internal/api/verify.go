@@ -0,0 +1,182 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+	"github.com/nabilulilalbab/rclonestorage/internal/crypt"
+	"github.com/nabilulilalbab/rclonestorage/internal/jobs"
+	"github.com/nabilulilalbab/rclonestorage/internal/storage"
+)
+
+// Verification outcomes
+const (
+	verifyOK        = "ok"
+	verifyCorrupted = "corrupted"
+	verifyMissing   = "missing"
+	verifySkipped   = "skipped" // no stored checksum to compare against
+	verifyError     = "error"
+)
+
+// VerifyResult is the outcome of verifying a single file
+type VerifyResult struct {
+	FileID   string `json:"file_id"`
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// VerifyReport summarises an integrity check of a user's files
+type VerifyReport struct {
+	Total     int            `json:"total"`
+	OK        int            `json:"ok"`
+	Corrupted int            `json:"corrupted"`
+	Missing   int            `json:"missing"`
+	Skipped   int            `json:"skipped"`
+	Errors    int            `json:"errors"`
+	Files     []VerifyResult `json:"files"`
+}
+
+// handleVerifyAll starts a background integrity check of all the user's files
+// @Summary Verify all my files
+// @Description Queue a background job that re-hashes every file the user owns and compares it to the stored checksum. The report (ok, corrupted, missing) is available from the job status endpoint
+// @Tags files
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Success 202 {object} map[string]interface{} "Verification job started"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Router /files/verify-all [post]
+func (a *API) handleVerifyAll(c *gin.Context) {
+	userID, exists := auth.GetCurrentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Authentication required",
+		})
+		return
+	}
+
+	verify := func(ctx context.Context) (interface{}, error) {
+		return a.verifyUserFiles(ctx, userID)
+	}
+	job := a.jobs.Start(userID, jobs.TypeVerify, "", verify, nil)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Verification started",
+		"job":     job,
+		"status":  "/api/v1/jobs/" + job.ID,
+	})
+}
+
+// verifyUserFiles re-hashes each of the user's files, running at most
+// Rclone.MaxConcurrency rclone processes at once
+func (a *API) verifyUserFiles(ctx context.Context, userID uint) (*VerifyReport, error) {
+	var files []auth.FileOwnership
+	cursor := ""
+	for {
+		page, next, err := a.authManager.DatabaseManager.SearchFilesAfter(auth.FileFilter{UserID: userID}, cursor, maxPageLimit)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, page...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	concurrency := a.config.Rclone.MaxConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	results := make([]VerifyResult, len(files))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, file := range files {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return nil, ctx.Err()
+		}
+
+		wg.Add(1)
+		go func(i int, file auth.FileOwnership) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = a.verifyFile(ctx, file)
+		}(i, file)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	report := &VerifyReport{Total: len(results), Files: results}
+	for _, result := range results {
+		switch result.Status {
+		case verifyOK:
+			report.OK++
+		case verifyCorrupted:
+			report.Corrupted++
+		case verifyMissing:
+			report.Missing++
+		case verifySkipped:
+			report.Skipped++
+		default:
+			report.Errors++
+		}
+	}
+
+	return report, nil
+}
+
+// verifyFile downloads and hashes one file with the algorithm its checksum was stored in
+func (a *API) verifyFile(ctx context.Context, file auth.FileOwnership) VerifyResult {
+	result := VerifyResult{
+		FileID:   file.FileID,
+		Name:     file.Filename,
+		Expected: file.Checksum,
+	}
+
+	if file.Checksum == "" {
+		result.Status = verifySkipped
+		return result
+	}
+
+	remotePath := a.unionPath(file.Object())
+	var actual string
+	var err error
+	if sealed := fileSealing(&file); sealed != nil {
+		actual, err = a.hashSealed(ctx, file.Object(), file.ChecksumAlgorithm, sealed)
+	} else {
+		actual, err = storage.RemoteHash(ctx, a.rclone, remotePath, file.ChecksumAlgorithm, true)
+	}
+	switch {
+	case errors.Is(err, storage.ErrObjectNotFound):
+		result.Status = verifyMissing
+	case errors.Is(err, crypt.ErrCorrupt):
+		result.Status = verifyCorrupted
+		result.Error = err.Error()
+	case err != nil:
+		result.Status = verifyError
+		result.Error = err.Error()
+	case actual == file.Checksum:
+		result.Status = verifyOK
+		result.Actual = actual
+	default:
+		result.Status = verifyCorrupted
+		result.Actual = actual
+	}
+
+	return result
+}
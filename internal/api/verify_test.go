@@ -0,0 +1,60 @@
+package api
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"testing"
+)
+
+func TestVerifyUserFilesClassifiesFiles(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	ta.rclone.hashes = true
+	user := ta.newUser(t, "owner@example.com")
+	other := ta.newUser(t, "other@example.com")
+
+	sum := func(data string) string {
+		h := md5.Sum([]byte(data))
+		return hex.EncodeToString(h[:])
+	}
+	ta.addFile(t, user, "intact", "a.txt", []byte("intact"))
+	ta.addFile(t, user, "corrupted", "b.txt", []byte("bit rot"))
+	ta.addFile(t, user, "missing", "c.txt", []byte("gone"))
+	ta.addFile(t, user, "unhashed", "d.txt", []byte("no checksum"))
+	ta.addFile(t, other, "foreign", "e.txt", []byte("not mine"))
+	for fileID, data := range map[string]string{"intact": "intact", "corrupted": "original", "missing": "gone", "foreign": "not mine"} {
+		if err := ta.db.SetFileChecksum(fileID, "md5", sum(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ta.rclone.Delete(context.Background(), ta.unionPath("missing_c.txt"))
+
+	report, err := ta.verifyUserFiles(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Total != 4 || report.OK != 1 || report.Corrupted != 1 || report.Missing != 1 || report.Skipped != 1 || report.Errors != 0 {
+		t.Errorf("got %+v, want 4 files: 1 ok, 1 corrupted, 1 missing, 1 skipped", report)
+	}
+	want := map[string]string{"intact": verifyOK, "corrupted": verifyCorrupted, "missing": verifyMissing, "unhashed": verifySkipped}
+	for _, result := range report.Files {
+		if result.Status != want[result.FileID] {
+			t.Errorf("%s: got %s, want %s", result.FileID, result.Status, want[result.FileID])
+		}
+	}
+}
+
+func TestVerifyUserFilesCancelled(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	user := ta.newUser(t, "owner@example.com")
+	ta.addFile(t, user, "intact", "a.txt", []byte("intact"))
+	if err := ta.db.SetFileChecksum("intact", "md5", "00000000000000000000000000000000"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ta.verifyUserFiles(ctx, user.ID); err == nil {
+		t.Error("got a report for a cancelled check, want an error")
+	}
+}
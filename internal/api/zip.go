@@ -0,0 +1,177 @@
+package api
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+	"github.com/nabilulilalbab/rclonestorage/internal/logging"
+)
+
+// maxZipFiles caps the number of files in one archive
+const maxZipFiles = 100
+
+// zipRequest lists the files to put in an archive
+type zipRequest struct {
+	FileIDs []string `json:"file_ids" binding:"required,min=1"`
+	Name    string   `json:"name"` // archive name without .zip, defaults to files-<date>
+}
+
+// handleDownloadZip streams several files as one ZIP archive
+// @Summary Download files as ZIP
+// @Description Stream a ZIP archive of up to 100 files, built while it is sent so nothing is staged on the server. Media and archives are stored as is, other files are deflated. Every file must be owned by the caller (admins may include any file); an error after streaming started truncates the archive
+// @Tags files
+// @Accept json
+// @Produce application/zip
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param request body zipRequest true "File IDs and optional archive name"
+// @Success 200 {file} binary "ZIP archive"
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "File not found or access denied"
+// @Router /download/zip [post]
+func (a *API) handleDownloadZip(c *gin.Context) {
+	var req zipRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"details": err.Error(),
+		})
+		return
+	}
+	if len(req.FileIDs) > maxZipFiles {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Too many files",
+			"details": fmt.Sprintf("at most %d files fit in one archive", maxZipFiles),
+		})
+		return
+	}
+
+	userID, exists := auth.GetCurrentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Authentication required",
+		})
+		return
+	}
+	admin := auth.IsAdmin(c)
+
+	// Check every file before anything is written, afterwards errors can't be reported
+	records := make([]*auth.FileOwnership, 0, len(req.FileIDs))
+	for _, fileID := range req.FileIDs {
+		record := a.fileRecord(fileID)
+		if record == nil || (!admin && record.UserID != userID) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "File not found or access denied",
+				"code":    "FILE_ACCESS_DENIED",
+				"file_id": fileID,
+			})
+			return
+		}
+		records = append(records, record)
+	}
+
+	name := strings.TrimSuffix(path.Base(req.Name), ".zip")
+	if name == "" || name == "." || name == "/" {
+		name = "files-" + time.Now().UTC().Format("20060102-150405")
+	}
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".zip"}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Status(http.StatusOK)
+
+	archive := zip.NewWriter(c.Writer)
+	used := make(map[string]int)
+	for _, record := range records {
+		if err := a.writeZipMember(c.Request.Context(), archive, record, zipMemberName(record.Filename, used)); err != nil {
+			// The archive is left without its central directory, so clients see it as broken
+			logging.FromContext(c.Request.Context()).WithField("file_id", record.FileID).Warnf("ZIP download aborted: %v", err)
+			c.Abort()
+			return
+		}
+	}
+	if err := archive.Close(); err != nil {
+		logging.FromContext(c.Request.Context()).Warnf("Failed to finish ZIP download: %v", err)
+	}
+}
+
+// writeZipMember copies one file from cloud storage into the archive
+func (a *API) writeZipMember(ctx context.Context, archive *zip.Writer, record *auth.FileOwnership, name string) error {
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: record.CreatedAt,
+	}
+	if storedAsIs(record.Filename, record.MimeType) {
+		header.Method = zip.Store
+	}
+	member, err := archive.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	reader, err := a.catPlain(ctx, record.Object(), fileSealing(record))
+	if err != nil {
+		return err
+	}
+	written, err := io.Copy(member, reader)
+	if closeErr := reader.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && written != record.Size {
+		err = fmt.Errorf("read %d of %d bytes", written, record.Size)
+	}
+	return err
+}
+
+// zipMemberName returns a safe, unique path inside the archive for a file. Folders
+// are kept, names taken before get the first free " (2)", " (3)"... suffix. used
+// holds the last suffix tried for every name.
+func zipMemberName(filename string, used map[string]int) string {
+	name := strings.TrimPrefix(path.Clean("/"+filename), "/")
+	if name == "" {
+		name = "file"
+	}
+
+	if used[name] == 0 {
+		used[name] = 1
+		return name
+	}
+	ext := path.Ext(name)
+	for n := used[name] + 1; ; n++ {
+		// A file may already have been added under the suffixed name itself
+		candidate := fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext)
+		if used[candidate] == 0 {
+			used[name] = n
+			used[candidate] = 1
+			return candidate
+		}
+	}
+}
+
+// storedAsIs reports whether a file is already compressed, so deflating it again
+// would only cost CPU
+func storedAsIs(filename, mimeType string) bool {
+	for _, prefix := range []string{"video/", "audio/", "image/"} {
+		if strings.HasPrefix(mimeType, prefix) && mimeType != "image/svg+xml" && mimeType != "image/bmp" {
+			return true
+		}
+	}
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".zip", ".gz", ".tgz", ".bz2", ".xz", ".7z", ".rar", ".zst",
+		".mp4", ".mkv", ".webm", ".mov", ".avi", ".mp3", ".aac", ".ogg", ".flac",
+		".jpg", ".jpeg", ".png", ".gif", ".webp",
+		".docx", ".xlsx", ".pptx", ".odt", ".ods", ".odp", ".epub", ".jar", ".apk":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDownloadZip(t *testing.T) {
+	ta := newTestAPI(t, nil)
+	user := ta.newUser(t, "owner@example.com")
+	ta.addTypedFile(t, user, "1", "notes.txt", "text/plain", []byte("first notes"))
+	ta.addTypedFile(t, user, "2", "notes.txt", "text/plain", []byte("second notes"))
+	ta.addTypedFile(t, user, "3", "photo.jpg", "image/jpeg", []byte("jpeg bytes"))
+
+	w := ta.do(t, http.MethodPost, "/api/v1/download/zip", user, strings.NewReader(`{"file_ids": ["1", "2", "3"], "name": "../trip.zip"}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename=trip.zip` {
+		t.Errorf("Content-Disposition %q", got)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	methods := make(map[string]uint16)
+	for _, member := range archive.File {
+		reader, err := member.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(reader)
+		reader.Close()
+		got[member.Name] = string(data)
+		methods[member.Name] = member.Method
+	}
+	want := map[string]string{"notes.txt": "first notes", "notes (2).txt": "second notes", "photo.jpg": "jpeg bytes"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if methods["notes.txt"] != zip.Deflate || methods["photo.jpg"] != zip.Store {
+		t.Errorf("got methods %v, want text deflated and the photo stored", methods)
+	}
+
+	other := ta.newUser(t, "other@example.com")
+	if w := ta.do(t, http.MethodPost, "/api/v1/download/zip", other, strings.NewReader(`{"file_ids": ["1"]}`)); w.Code != http.StatusForbidden {
+		t.Errorf("another user's file: got %d, want 403", w.Code)
+	}
+	if w := ta.do(t, http.MethodPost, "/api/v1/download/zip", user, strings.NewReader(`{"file_ids": []}`)); w.Code != http.StatusBadRequest {
+		t.Errorf("no files: got %d, want 400", w.Code)
+	}
+}
+
+func TestZipMemberName(t *testing.T) {
+	used := make(map[string]int)
+	tests := []struct{ filename, want string }{
+		{"a.txt", "a.txt"},
+		{"a.txt", "a (2).txt"},
+		{"a (2).txt", "a (2) (2).txt"},
+		{"../../etc/passwd", "etc/passwd"},
+		{"dir/b.txt", "dir/b.txt"},
+		{"", "file"},
+	}
+	for _, tt := range tests {
+		if got := zipMemberName(tt.filename, used); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.filename, got, tt.want)
+		}
+	}
+
+	// A suffixed name added first isn't handed out again
+	used = make(map[string]int)
+	tests = []struct{ filename, want string }{
+		{"a (2).txt", "a (2).txt"},
+		{"a.txt", "a.txt"},
+		{"a.txt", "a (3).txt"},
+		{"a.txt", "a (4).txt"},
+	}
+	for _, tt := range tests {
+		if got := zipMemberName(tt.filename, used); got != tt.want {
+			t.Errorf("%q after a (2).txt: got %q, want %q", tt.filename, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestListAuditLogsEndpoint(t *testing.T) {
+	am := newTestAuth(t)
+	dm := am.DatabaseManager
+	admin, err := dm.GetUserByEmail("admin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := newTestUser(t, dm, "owner@example.com")
+	events := []struct {
+		userID  uint
+		action  string
+		success bool
+	}{
+		{user.ID, "upload", true},
+		{user.ID, "upload", false},
+		{user.ID, "delete", true},
+		{admin.ID, "upload", true},
+	}
+	for _, event := range events {
+		if err := dm.LogAudit(event.userID, event.action, "/files", "127.0.0.1", "test", event.success, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  []string // actions, newest first
+		total int64
+	}{
+		{"", []string{"upload", "delete", "upload", "upload"}, 4},
+		{fmt.Sprintf("?user_id=%d", user.ID), []string{"delete", "upload", "upload"}, 3},
+		{fmt.Sprintf("?user_id=%d&action=upload&success=false", user.ID), []string{"upload"}, 1},
+		{"?action=delete", []string{"delete"}, 1},
+		{"?page=2&limit=3", []string{"upload"}, 4},
+		{"?since=2000-01-01T00:00:00Z&until=2001-01-01T00:00:00Z", []string{}, 0},
+	}
+	for _, tt := range tests {
+		w := do(t, am, http.MethodGet, "/api/admin/audit-logs"+tt.query, admin, "")
+		wantStatus(t, w, http.StatusOK)
+		var resp struct {
+			AuditLogs  []AuditLog `json:"audit_logs"`
+			Pagination struct {
+				Total int64 `json:"total"`
+			} `json:"pagination"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, log := range resp.AuditLogs {
+			got = append(got, log.Action)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) || resp.Pagination.Total != tt.total {
+			t.Errorf("%q: got %v of %d, want %v of %d", tt.query, got, resp.Pagination.Total, tt.want, tt.total)
+		}
+	}
+
+	for _, query := range []string{"?user_id=abc", "?success=maybe", "?since=yesterday"} {
+		wantStatus(t, do(t, am, http.MethodGet, "/api/admin/audit-logs"+query, admin, ""), http.StatusBadRequest)
+	}
+	wantStatus(t, do(t, am, http.MethodGet, "/api/admin/audit-logs", user, ""), http.StatusForbidden)
+}
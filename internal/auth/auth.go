@@ -12,12 +12,14 @@ type AuthManager struct {
 	JWTManager      *JWTManager
 	Middleware      *AuthMiddleware
 	Handlers        *AuthHandlers
+	Notifier        *Notifier
+	Permissions     *Permissions
 }
 
 // NewAuthManager creates a new authentication manager
-func NewAuthManager(dbPath, jwtSecret string) (*AuthManager, error) {
+func NewAuthManager(dbPath, jwtSecret, adminEmail, adminPassword string) (*AuthManager, error) {
 	// Initialize database manager
-	dbManager, err := NewDatabaseManager(dbPath)
+	dbManager, err := NewDatabaseManager(dbPath, adminEmail, adminPassword)
 	if err != nil {
 		return nil, err
 	}
@@ -25,20 +27,37 @@ func NewAuthManager(dbPath, jwtSecret string) (*AuthManager, error) {
 	// Initialize JWT manager (1 hour token duration)
 	jwtManager := NewJWTManager(jwtSecret, time.Hour)
 
+	// Built-in role permissions until SetPermissions is called
+	permissions, err := NewPermissions(nil)
+	if err != nil {
+		return nil, err
+	}
+
 	// Initialize middleware
-	middleware := NewAuthMiddleware(jwtManager, dbManager)
+	middleware := NewAuthMiddleware(jwtManager, dbManager, permissions)
+
+	// Initialize notifier
+	notifier := NewNotifier(dbManager)
 
 	// Initialize handlers
-	handlers := NewAuthHandlers(jwtManager, dbManager)
+	handlers := NewAuthHandlers(jwtManager, dbManager, notifier)
 
 	return &AuthManager{
 		DatabaseManager: dbManager,
 		JWTManager:      jwtManager,
 		Middleware:      middleware,
 		Handlers:        handlers,
+		Notifier:        notifier,
+		Permissions:     permissions,
 	}, nil
 }
 
+// SetPermissions replaces the role permission matrix
+func (am *AuthManager) SetPermissions(permissions *Permissions) {
+	am.Permissions = permissions
+	am.Middleware.permissions = permissions
+}
+
 // SetupAuthRoutes sets up authentication routes
 func (am *AuthManager) SetupAuthRoutes(r *gin.Engine) {
 	// Public authentication routes
@@ -47,6 +66,7 @@ func (am *AuthManager) SetupAuthRoutes(r *gin.Engine) {
 		auth.POST("/register", am.Handlers.Register)
 		auth.POST("/login", am.Handlers.Login)
 		auth.POST("/refresh", am.Handlers.RefreshToken)
+		auth.POST("/logout", am.Middleware.JWTAuth(), am.Handlers.Logout)
 	}
 
 	// Protected user routes - Support both JWT and API key
@@ -56,9 +76,11 @@ func (am *AuthManager) SetupAuthRoutes(r *gin.Engine) {
 	{
 		user.GET("/profile", am.Handlers.GetProfile)
 		user.POST("/change-password", am.Handlers.ChangePassword)
-		user.POST("/api-keys", am.Handlers.CreateAPIKey)
+		user.POST("/api-keys", am.Middleware.RequirePermission(ActionCreateAPIKey), am.Handlers.CreateAPIKey)
 		user.GET("/api-keys", am.Handlers.ListAPIKeys)
 		user.DELETE("/api-keys/:id", am.Handlers.DeleteAPIKey)
+		user.GET("/notifications", am.Handlers.GetNotificationPrefs)
+		user.PUT("/notifications", am.Handlers.UpdateNotificationPrefs)
 	}
 
 	// Admin-only routes - Support both JWT and API key
@@ -70,6 +92,11 @@ func (am *AuthManager) SetupAuthRoutes(r *gin.Engine) {
 		admin.GET("/users", am.Handlers.ListUsers)
 		admin.GET("/users/:id", am.Handlers.GetUser)
 		admin.POST("/users", am.Handlers.Register) // Admin can create users
+		admin.PATCH("/users/:id", am.Middleware.AuditLog("user_update"), am.Handlers.UpdateUser)
+		admin.POST("/users/:id/revoke-tokens", am.Middleware.AuditLog("revoke_tokens"), am.Handlers.RevokeUserTokens)
+		admin.POST("/users/:id/recalculate-quota", am.Middleware.AuditLog("recalculate_quota"), am.Handlers.RecalculateUserQuota)
+		admin.GET("/audit-logs", am.Handlers.ListAuditLogs)
+		admin.POST("/recalculate-quotas", am.Middleware.AuditLog("recalculate_quota"), am.Handlers.RecalculateQuotas)
 	}
 }
 
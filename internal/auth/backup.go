@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// BackupFormat identifies backup bundles written by ExportBackup
+const BackupFormat = "rclonestorage-backup"
+
+// BackupVersion is the bundle layout version. Bump it when the layout changes in a
+// way older releases can't read.
+const BackupVersion = 1
+
+// ErrNotFresh is returned by ImportBackup when the database already holds data
+var ErrNotFresh = errors.New("database is not fresh")
+
+// Backup is the database state needed to rebuild an instance. The media itself
+// lives in cloud storage and is not included, nor are API key values.
+type Backup struct {
+	Format        string    `json:"format"`
+	Version       int       `json:"version"`
+	SchemaVersion int       `json:"schema_version"`
+	CreatedAt     time.Time `json:"created_at"`
+
+	Users             []BackupUser        `json:"users"`
+	Files             []FileOwnership     `json:"files"`
+	Replicas          []FileReplica       `json:"replicas"`
+	ShareLinks        []ShareLink         `json:"share_links"`
+	APIKeys           []BackupAPIKey      `json:"api_keys"`
+	NotificationPrefs []NotificationPrefs `json:"notification_prefs"`
+}
+
+// BackupUser is a user with its bcrypt password hash, so users can still log in
+// after a restore. The plaintext password is never stored.
+type BackupUser struct {
+	ID           uint      `json:"id"`
+	Email        string    `json:"email"`
+	PasswordHash string    `json:"password_hash"`
+	Role         string    `json:"role"`
+	StorageUsed  int64     `json:"storage_used"`
+	StorageQuota int64     `json:"storage_quota"`
+	IsActive     bool      `json:"is_active"`
+	TokenVersion int       `json:"token_version"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// BackupAPIKey describes an API key without its value. Keys can't be restored and
+// have to be reissued.
+type BackupAPIKey struct {
+	ID        uint       `json:"id"`
+	UserID    uint       `json:"user_id"`
+	Name      string     `json:"name"`
+	LastUsed  *time.Time `json:"last_used"`
+	IsActive  bool       `json:"is_active"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// RestoreSummary counts what ImportBackup restored
+type RestoreSummary struct {
+	Users             int `json:"users"`
+	Files             int `json:"files"`
+	Replicas          int `json:"replicas"`
+	ShareLinks        int `json:"share_links"`
+	NotificationPrefs int `json:"notification_prefs"`
+	APIKeysToReissue  int `json:"api_keys_to_reissue"`
+}
+
+// ExportBackup snapshots users, file ownership, replicas, share links, API key
+// metadata and notification preferences in a single read transaction
+func (dm *DatabaseManager) ExportBackup() (*Backup, error) {
+	schemaVersion, err := dm.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	backup := &Backup{
+		Format:        BackupFormat,
+		Version:       BackupVersion,
+		SchemaVersion: schemaVersion,
+		CreatedAt:     time.Now(),
+	}
+
+	err = dm.db.Transaction(func(tx *gorm.DB) error {
+		var users []User
+		if err := tx.Order("id").Find(&users).Error; err != nil {
+			return err
+		}
+		for _, user := range users {
+			backup.Users = append(backup.Users, BackupUser{
+				ID:           user.ID,
+				Email:        user.Email,
+				PasswordHash: user.Password,
+				Role:         user.Role,
+				StorageUsed:  user.StorageUsed,
+				StorageQuota: user.StorageQuota,
+				IsActive:     user.IsActive,
+				TokenVersion: user.TokenVersion,
+				CreatedAt:    user.CreatedAt,
+				UpdatedAt:    user.UpdatedAt,
+			})
+		}
+
+		if err := tx.Order("id").Find(&backup.Files).Error; err != nil {
+			return err
+		}
+		if err := tx.Order("id").Find(&backup.Replicas).Error; err != nil {
+			return err
+		}
+		if err := tx.Order("id").Find(&backup.ShareLinks).Error; err != nil {
+			return err
+		}
+
+		var keys []APIKey
+		if err := tx.Order("id").Find(&keys).Error; err != nil {
+			return err
+		}
+		for _, key := range keys {
+			backup.APIKeys = append(backup.APIKeys, BackupAPIKey{
+				ID:        key.ID,
+				UserID:    key.UserID,
+				Name:      key.Name,
+				LastUsed:  key.LastUsed,
+				IsActive:  key.IsActive,
+				CreatedAt: key.CreatedAt,
+			})
+		}
+
+		return tx.Order("id").Find(&backup.NotificationPrefs).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export backup: %w", err)
+	}
+
+	return backup, nil
+}
+
+// CheckBackup reports whether a bundle can be restored into this database
+func (dm *DatabaseManager) CheckBackup(backup *Backup) error {
+	if backup.Format != BackupFormat {
+		return fmt.Errorf("not a backup bundle (format %q)", backup.Format)
+	}
+	if backup.Version != BackupVersion {
+		return fmt.Errorf("unsupported backup version %d, this release reads version %d", backup.Version, BackupVersion)
+	}
+
+	schemaVersion, err := dm.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if backup.SchemaVersion > schemaVersion {
+		return fmt.Errorf("backup is from a newer schema (version %d, this release is at %d)", backup.SchemaVersion, schemaVersion)
+	}
+
+	// The import replaces the bootstrap admin, so the bundle has to bring its own
+	for _, user := range backup.Users {
+		if user.Role == RoleAdmin && user.IsActive {
+			return nil
+		}
+	}
+	return fmt.Errorf("backup has no active admin, restoring it would lock every admin out")
+}
+
+// ImportBackup restores a bundle into a fresh database, one with no file ownership
+// records and no users besides the admin created on first start, which the
+// bundle's users replace. IDs are kept so ownership records still match their owners.
+func (dm *DatabaseManager) ImportBackup(backup *Backup) (*RestoreSummary, error) {
+	if err := dm.CheckBackup(backup); err != nil {
+		return nil, err
+	}
+
+	err := dm.db.Transaction(func(tx *gorm.DB) error {
+		var files, users int64
+		tx.Model(&FileOwnership{}).Count(&files)
+		tx.Model(&User{}).Where("role <> ?", RoleAdmin).Count(&users)
+		if files > 0 || users > 0 {
+			return fmt.Errorf("%w: it already has %d users and %d files", ErrNotFresh, users, files)
+		}
+
+		// The bootstrap admin and anything hanging off it
+		for _, model := range []interface{}{&APIKey{}, &Session{}, &NotificationPrefs{}, &User{}} {
+			if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, user := range backup.Users {
+			record := &User{
+				ID:           user.ID,
+				Email:        user.Email,
+				Password:     user.PasswordHash,
+				Role:         user.Role,
+				StorageUsed:  user.StorageUsed,
+				StorageQuota: user.StorageQuota,
+				IsActive:     user.IsActive,
+				// Revokes tokens issued by either instance for this user ID
+				TokenVersion: user.TokenVersion + 1,
+				CreatedAt:    user.CreatedAt,
+				UpdatedAt:    user.UpdatedAt,
+			}
+			// Zero values would otherwise be replaced by column defaults
+			if err := tx.Select("*").Create(record).Error; err != nil {
+				return fmt.Errorf("failed to restore user %s: %w", user.Email, err)
+			}
+		}
+
+		for _, file := range backup.Files {
+			file.User = User{}
+			// Bundles from before deduplication don't name the objects
+			file.ObjectName = file.Object()
+			if err := tx.Omit("User").Create(&file).Error; err != nil {
+				return fmt.Errorf("failed to restore file %s: %w", file.FileID, err)
+			}
+		}
+
+		// Replica IDs aren't exported, deleting a file only needs its providers
+		for _, replica := range backup.Replicas {
+			replica.ID = 0
+			if err := tx.Create(&replica).Error; err != nil {
+				return fmt.Errorf("failed to restore replica of %s on %s: %w", replica.FileID, replica.Provider, err)
+			}
+		}
+
+		for _, link := range backup.ShareLinks {
+			if err := tx.Select("*").Create(&link).Error; err != nil {
+				return fmt.Errorf("failed to restore share link %d: %w", link.ID, err)
+			}
+		}
+
+		for _, prefs := range backup.NotificationPrefs {
+			if err := tx.Select("*").Create(&prefs).Error; err != nil {
+				return fmt.Errorf("failed to restore notification preferences of user %d: %w", prefs.UserID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	dm.tokenVersions.Range(func(userID, _ interface{}) bool {
+		dm.tokenVersions.Delete(userID)
+		return true
+	})
+
+	return &RestoreSummary{
+		Users:             len(backup.Users),
+		Files:             len(backup.Files),
+		Replicas:          len(backup.Replicas),
+		ShareLinks:        len(backup.ShareLinks),
+		NotificationPrefs: len(backup.NotificationPrefs),
+		APIKeysToReissue:  len(backup.APIKeys),
+	}, nil
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackupRoundTrip(t *testing.T) {
+	source := newTestDatabase(t)
+	user := newTestUser(t, source, "owner@example.com")
+	if err := source.CreateFileOwnership(user.ID, "file1", "a.txt", "union", 5, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.CreateAPIKey(user.ID, "ci"); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.AddFileReplica("file1", "remote1"); err != nil {
+		t.Fatal(err)
+	}
+	link, err := source.CreateShareLink("file1", user.ID, time.Hour, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backup, err := source.ExportBackup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Bundles travel as JSON
+	data, err := json.Marshal(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "User-Passw0rd!") {
+		t.Error("the bundle holds a plaintext password")
+	}
+	var restored Backup
+	if err := json.Unmarshal(data, &restored); err != nil {
+		t.Fatal(err)
+	}
+
+	target := newTestDatabase(t)
+	summary, err := target.ImportBackup(&restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Users != 2 || summary.Files != 1 || summary.Replicas != 1 || summary.ShareLinks != 1 || summary.APIKeysToReissue != 1 {
+		t.Errorf("got %+v, want 2 users, 1 file, 1 replica, 1 share link and 1 key to reissue", summary)
+	}
+
+	restoredUser, err := target.AuthenticateUser("owner@example.com", "User-Passw0rd!")
+	if err != nil || restoredUser.ID != user.ID {
+		t.Fatalf("got %+v, %v, want the user to log in with the same ID", restoredUser, err)
+	}
+	if version, _ := target.TokenVersion(user.ID); version <= user.TokenVersion {
+		t.Errorf("token version %d not bumped past %d, old tokens stay valid", version, user.TokenVersion)
+	}
+	if file, err := target.CheckFileOwnership("file1", user.ID); err != nil || file.Size != 5 {
+		t.Errorf("got %+v, %v, want the file owned by the restored user", file, err)
+	}
+	// Deleting the file after the restore has to reach the copy on remote1 too
+	if replicas, err := target.FileReplicas("file1"); err != nil || len(replicas) != 1 || replicas[0].Provider != "remote1" {
+		t.Errorf("got %+v, %v, want the replica on remote1", replicas, err)
+	}
+	if got, err := target.GetShareLink(link.ID); err != nil || got.Token != link.Token || got.MaxDownloads != 3 {
+		t.Errorf("got %+v, %v, want share link %s restored", got, err, link.Token)
+	}
+	if keys, _ := target.ListAPIKeys(user.ID); len(keys) != 0 {
+		t.Errorf("got %d API keys, want them left to reissue", len(keys))
+	}
+}
+
+func TestImportBackupNeedsFreshDatabase(t *testing.T) {
+	source := newTestDatabase(t)
+	backup, err := source.ExportBackup()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := newTestDatabase(t)
+	newTestUser(t, target, "someone@example.com")
+	if _, err := target.ImportBackup(backup); !errors.Is(err, ErrNotFresh) {
+		t.Errorf("got %v, want ErrNotFresh", err)
+	}
+}
+
+func TestCheckBackup(t *testing.T) {
+	dm := newTestDatabase(t)
+	backup, err := dm.ExportBackup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dm.CheckBackup(backup); err != nil {
+		t.Errorf("got %v for a fresh export", err)
+	}
+
+	for name, change := range map[string]func(*Backup){
+		"format":   func(b *Backup) { b.Format = "tarball" },
+		"version":  func(b *Backup) { b.Version = BackupVersion + 1 },
+		"schema":   func(b *Backup) { b.SchemaVersion++ },
+		"no users": func(b *Backup) { b.Users = nil },
+		"inactive admin": func(b *Backup) {
+			b.Users = append([]BackupUser(nil), b.Users...)
+			for i := range b.Users {
+				b.Users[i].IsActive = false
+			}
+		},
+	} {
+		bad := *backup
+		change(&bad)
+		if err := dm.CheckBackup(&bad); err == nil {
+			t.Errorf("%s: got no error", name)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileCursor marks the last file of a keyset page
+type FileCursor struct {
+	CreatedAt time.Time
+	ID        uint
+}
+
+// EncodeFileCursor returns an opaque cursor positioned after file
+func EncodeFileCursor(file FileOwnership) string {
+	raw := fmt.Sprintf("%d:%d", file.CreatedAt.UnixNano(), file.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeFileCursor parses a cursor produced by EncodeFileCursor
+func DecodeFileCursor(cursor string) (*FileCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	id, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	return &FileCursor{
+		CreatedAt: time.Unix(0, nanos),
+		ID:        uint(id),
+	}, nil
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSearchFilesAfterStableIteration(t *testing.T) {
+	dm := newTestDatabase(t)
+	user := newTestUser(t, dm, "owner@example.com")
+	const existing = 120
+	for i := 0; i < existing; i++ {
+		if err := dm.CreateFileOwnership(user.ID, fmt.Sprintf("file%d", i), fmt.Sprintf("f%03d.txt", i), "remote1", 1, "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	seen := make(map[string]int)
+	cursor, pages := "", 0
+	for {
+		files, next, err := dm.SearchFilesAfter(FileFilter{UserID: user.ID}, cursor, 25)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range files {
+			seen[file.FileID]++
+		}
+		// Rows added between pages must not shift the ones still to come
+		if err := dm.CreateFileOwnership(user.ID, fmt.Sprintf("new%d", pages), "new.txt", "remote1", 1, "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+		pages++
+		if next == "" {
+			break
+		}
+		if pages > existing {
+			t.Fatal("pagination never ended")
+		}
+		cursor = next
+	}
+
+	for i := 0; i < existing; i++ {
+		if id := fmt.Sprintf("file%d", i); seen[id] != 1 {
+			t.Errorf("%s seen %d times, want once", id, seen[id])
+		}
+	}
+	for id, count := range seen {
+		if count != 1 {
+			t.Errorf("%s seen %d times, want once", id, count)
+		}
+	}
+}
+
+func TestDecodeFileCursorRejectsGarbage(t *testing.T) {
+	for _, cursor := range []string{"!!!", "bm90LWEtY3Vyc29y", "MTIzOmFiYw"} {
+		if _, err := DecodeFileCursor(cursor); err == nil {
+			t.Errorf("cursor %q decoded, want an error", cursor)
+		}
+	}
+
+	file := FileOwnership{ID: 7}
+	decoded, err := DecodeFileCursor(EncodeFileCursor(file))
+	if err != nil || decoded.ID != 7 {
+		t.Errorf("got %+v, %v, want id 7", decoded, err)
+	}
+}
@@ -3,7 +3,10 @@ package auth
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"gorm.io/driver/sqlite"
@@ -15,10 +18,21 @@ import (
 type DatabaseManager struct {
 	db              *gorm.DB
 	passwordManager *PasswordManager
+	adminCreated    bool
+	tokenVersions   sync.Map // user ID -> token version, see TokenVersion
+	revokedTokens   sync.Map // jti -> expiry, see IsTokenRevoked
+
+	// Login lockout, see SetLoginLockout
+	maxLoginAttempts int
+	lockoutBase      time.Duration
+
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
-// NewDatabaseManager creates a new database manager
-func NewDatabaseManager(dbPath string) (*DatabaseManager, error) {
+// NewDatabaseManager creates a new database manager, creating the admin account with
+// the given credentials if no admin exists yet
+func NewDatabaseManager(dbPath, adminEmail, adminPassword string) (*DatabaseManager, error) {
 	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Silent),
 	})
@@ -29,6 +43,7 @@ func NewDatabaseManager(dbPath string) (*DatabaseManager, error) {
 	dm := &DatabaseManager{
 		db:              db,
 		passwordManager: NewPasswordManager(),
+		done:            make(chan struct{}),
 	}
 
 	// Auto-migrate the schema
@@ -37,26 +52,41 @@ func NewDatabaseManager(dbPath string) (*DatabaseManager, error) {
 	}
 
 	// Create default admin user if not exists
-	if err := dm.createDefaultAdmin(); err != nil {
+	if err := dm.createDefaultAdmin(adminEmail, adminPassword); err != nil {
 		return nil, fmt.Errorf("failed to create default admin: %w", err)
 	}
 
+	if err := dm.loadRevokedTokens(); err != nil {
+		return nil, fmt.Errorf("failed to load revoked tokens: %w", err)
+	}
+	go dm.startRevocationCleanup()
+
 	return dm, nil
 }
 
-// migrate runs database migrations
+// migrate brings the tables up to the models with AutoMigrate, then applies the
+// versioned migrations in migrations.go
 func (dm *DatabaseManager) migrate() error {
-	return dm.db.AutoMigrate(
+	err := dm.db.AutoMigrate(
 		&User{},
 		&APIKey{},
 		&FileOwnership{},
 		&Session{},
+		&RevokedToken{},
 		&AuditLog{},
+		&NotificationPrefs{},
+		&FileAccessStat{},
+		&FileReplica{},
+		&ShareLink{},
 	)
+	if err != nil {
+		return err
+	}
+	return dm.migrateSchema()
 }
 
 // createDefaultAdmin creates a default admin user
-func (dm *DatabaseManager) createDefaultAdmin() error {
+func (dm *DatabaseManager) createDefaultAdmin(email, password string) error {
 	var count int64
 	dm.db.Model(&User{}).Where("role = ?", RoleAdmin).Count(&count)
 	
@@ -64,20 +94,40 @@ func (dm *DatabaseManager) createDefaultAdmin() error {
 		return nil // Admin already exists
 	}
 
-	hashedPassword, err := dm.passwordManager.HashPassword("Admin123!")
+	hashedPassword, err := dm.passwordManager.HashPassword(password)
 	if err != nil {
 		return err
 	}
 
 	admin := &User{
-		Email:        "admin@rclonestorage.local",
+		Email:        email,
 		Password:     hashedPassword,
 		Role:         RoleAdmin,
 		StorageQuota: DefaultAdminQuota,
 		IsActive:     true,
 	}
 
-	return dm.db.Create(admin).Error
+	if err := dm.db.Create(admin).Error; err != nil {
+		return err
+	}
+	dm.adminCreated = true
+	return nil
+}
+
+// AdminCreated reports whether the admin account was created on this startup
+func (dm *DatabaseManager) AdminCreated() bool {
+	return dm.adminCreated
+}
+
+// SetPasswordPolicy replaces the policy new and changed passwords are checked against
+func (dm *DatabaseManager) SetPasswordPolicy(policy PasswordPolicy) {
+	dm.passwordManager.SetPolicy(policy)
+}
+
+// SetPasswordHashing selects how new passwords are hashed, see PasswordManager.SetHashing.
+// Stored hashes made differently are upgraded as their users log in.
+func (dm *DatabaseManager) SetPasswordHashing(algorithm string, bcryptCost int) error {
+	return dm.passwordManager.SetHashing(algorithm, bcryptCost)
 }
 
 // CreateUser creates a new user
@@ -105,20 +155,60 @@ func (dm *DatabaseManager) CreateUser(email, password, role string) (*User, erro
 	return user, nil
 }
 
-// AuthenticateUser authenticates a user with email and password
+// AuthenticateUser authenticates a user with email and password. Failed attempts are
+// counted towards the lockout, see SetLoginLockout, and a locked account is refused
+// with a LockoutError even when the password is right.
 func (dm *DatabaseManager) AuthenticateUser(email, password string) (*User, error) {
 	var user User
 	if err := dm.db.Where("email = ? AND is_active = ?", email, true).First(&user).Error; err != nil {
 		return nil, fmt.Errorf("invalid credentials")
 	}
+	if err := dm.checkLocked(&user); err != nil {
+		return nil, err
+	}
 
 	if err := dm.passwordManager.CheckPassword(password, user.Password); err != nil {
+		if lockErr := dm.recordLoginFailure(&user); errors.Is(lockErr, ErrAccountLocked) {
+			return nil, lockErr
+		} else if lockErr != nil {
+			fmt.Printf("Warning: Failed to record failed login for %s: %v\n", email, lockErr)
+		}
 		return nil, fmt.Errorf("invalid credentials")
 	}
 
+	if err := dm.resetLoginFailures(&user); err != nil {
+		fmt.Printf("Warning: Failed to reset failed logins for %s: %v\n", email, err)
+	}
+	if dm.passwordManager.NeedsRehash(user.Password) {
+		dm.rehashPassword(&user, password)
+	}
 	return &user, nil
 }
 
+// rehashPassword replaces the stored hash of a user who just logged in with one made
+// the current way. The policy isn't checked, the password was accepted when it was set.
+func (dm *DatabaseManager) rehashPassword(user *User, password string) {
+	hashed, err := dm.passwordManager.hash(password)
+	if err == nil {
+		err = dm.db.Model(&User{}).Where("id = ? AND password = ?", user.ID, user.Password).Update("password", hashed).Error
+	}
+	if err != nil {
+		fmt.Printf("Warning: Failed to upgrade the password hash of %s: %v\n", user.Email, err)
+		return
+	}
+	user.Password = hashed
+}
+
+// PasswordMatches reports whether password is the password of the active user with
+// the given email, without counting towards the login lockout
+func (dm *DatabaseManager) PasswordMatches(email, password string) bool {
+	var user User
+	if err := dm.db.Where("email = ? AND is_active = ?", email, true).First(&user).Error; err != nil {
+		return false
+	}
+	return dm.passwordManager.CheckPassword(password, user.Password) == nil
+}
+
 // GetUserByID retrieves a user by ID
 func (dm *DatabaseManager) GetUserByID(id uint) (*User, error) {
 	var user User
@@ -139,12 +229,102 @@ func (dm *DatabaseManager) GetUserByEmail(email string) (*User, error) {
 
 // UpdateUser updates user information
 func (dm *DatabaseManager) UpdateUser(user *User) error {
+	defer dm.tokenVersions.Delete(user.ID)
 	return dm.db.Save(user).Error
 }
 
-// DeleteUser soft deletes a user
+// DeleteUser soft deletes a user, revoking their tokens
 func (dm *DatabaseManager) DeleteUser(id uint) error {
-	return dm.db.Model(&User{}).Where("id = ?", id).Update("is_active", false).Error
+	defer dm.tokenVersions.Delete(id)
+	return dm.db.Model(&User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"is_active":     false,
+		"token_version": gorm.Expr("token_version + 1"),
+	}).Error
+}
+
+// ErrLastAdmin is returned when an update would leave no active admin
+var ErrLastAdmin = errors.New("cannot demote or deactivate the last active admin")
+
+// UpdateUserAccount changes only the role, storage quota and active status given in
+// req, leaving every other column, storage_used included, as it is in the database.
+// Deactivating a user or changing their role revokes their tokens. The update and
+// the check that an active admin is left run in one transaction, so two admins
+// demoting each other can't both succeed.
+func (dm *DatabaseManager) UpdateUserAccount(id uint, req UpdateUserRequest) (*User, error) {
+	defer dm.tokenVersions.Delete(id)
+
+	var user User
+	err := dm.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&user, id).Error; err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{}
+		if req.Role != nil {
+			updates["role"] = *req.Role
+		}
+		if req.StorageQuota != nil {
+			updates["storage_quota"] = *req.StorageQuota
+		}
+		if req.IsActive != nil {
+			updates["is_active"] = *req.IsActive
+		}
+		deactivated := req.IsActive != nil && !*req.IsActive && user.IsActive
+		if deactivated || (req.Role != nil && *req.Role != user.Role) {
+			updates["token_version"] = gorm.Expr("token_version + 1")
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		if err := tx.Model(&User{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		// Counted after the update, which holds the write lock until the transaction ends
+		if user.Role == RoleAdmin && user.IsActive {
+			var admins int64
+			if err := tx.Model(&User{}).Where("role = ? AND is_active = ?", RoleAdmin, true).Count(&admins).Error; err != nil {
+				return err
+			}
+			if admins == 0 {
+				return ErrLastAdmin
+			}
+		}
+		return tx.First(&user, id).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// CountActiveAdmins returns the number of active admin accounts
+func (dm *DatabaseManager) CountActiveAdmins() (int64, error) {
+	var count int64
+	err := dm.db.Model(&User{}).Where("role = ? AND is_active = ?", RoleAdmin, true).Count(&count).Error
+	return count, err
+}
+
+// TokenVersion returns the token version JWTs of a user must carry to be accepted.
+// Versions are cached in memory, so checking them costs no query per request.
+func (dm *DatabaseManager) TokenVersion(userID uint) (int, error) {
+	if version, ok := dm.tokenVersions.Load(userID); ok {
+		return version.(int), nil
+	}
+
+	var user User
+	if err := dm.db.Select("token_version").First(&user, userID).Error; err != nil {
+		return 0, err
+	}
+	dm.tokenVersions.Store(userID, user.TokenVersion)
+	return user.TokenVersion, nil
+}
+
+// BumpTokenVersion revokes every JWT issued to a user so far. Call it whenever a
+// user's role or status changes so trusted claims can't outlive the change.
+func (dm *DatabaseManager) BumpTokenVersion(userID uint) error {
+	defer dm.tokenVersions.Delete(userID)
+	return dm.db.Model(&User{}).Where("id = ?", userID).Update("token_version", gorm.Expr("token_version + 1")).Error
 }
 
 // ListUsers lists all users with pagination
@@ -158,6 +338,33 @@ func (dm *DatabaseManager) ListUsers(offset, limit int) ([]User, int64, error) {
 	return users, total, err
 }
 
+// UserTotals summarises the user table. Quota only adds up limited quotas, users
+// with an unlimited quota (-1) are counted in Unlimited instead.
+type UserTotals struct {
+	Users     int64 `json:"users"`
+	Active    int64 `json:"active"`
+	Admins    int64 `json:"admins"`
+	Unlimited int64 `json:"unlimited"`
+	Quota     int64 `json:"quota"`
+	Used      int64 `json:"used"`
+}
+
+// CountUsers aggregates the user table in one query
+func (dm *DatabaseManager) CountUsers() (*UserTotals, error) {
+	var totals UserTotals
+	err := dm.db.Model(&User{}).Select(`COUNT(*) AS users,
+		COALESCE(SUM(CASE WHEN is_active THEN 1 ELSE 0 END), 0) AS active,
+		COALESCE(SUM(CASE WHEN role = ? THEN 1 ELSE 0 END), 0) AS admins,
+		COALESCE(SUM(CASE WHEN storage_quota < 0 THEN 1 ELSE 0 END), 0) AS unlimited,
+		COALESCE(SUM(CASE WHEN storage_quota > 0 THEN storage_quota ELSE 0 END), 0) AS quota,
+		COALESCE(SUM(storage_used), 0) AS used`, RoleAdmin).
+		Scan(&totals).Error
+	if err != nil {
+		return nil, err
+	}
+	return &totals, nil
+}
+
 // CreateAPIKey creates a new API key for a user
 func (dm *DatabaseManager) CreateAPIKey(userID uint, name string) (*APIKey, error) {
 	// Generate random API key
@@ -215,36 +422,207 @@ func (dm *DatabaseManager) DeleteAPIKey(id uint, userID uint) error {
 // CreateFileOwnership creates a file ownership record
 func (dm *DatabaseManager) CreateFileOwnership(userID uint, fileID, filename, provider string, size int64, mimeType string) error {
 	ownership := &FileOwnership{
-		UserID:   userID,
-		FileID:   fileID,
-		Filename: filename,
-		Size:     size,
-		Provider: provider,
-		MimeType: mimeType,
+		UserID:     userID,
+		FileID:     fileID,
+		Filename:   filename,
+		Size:       size,
+		Provider:   provider,
+		MimeType:   mimeType,
+		ObjectName: fileID + "_" + filename,
 	}
 
-	if err := dm.db.Create(ownership).Error; err != nil {
+	// Record and usage change together so quota never drifts from ownership
+	return dm.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(ownership).Error; err != nil {
+			return err
+		}
+		return tx.Model(&User{}).Where("id = ?", userID).Update("storage_used", gorm.Expr("storage_used + ?", size)).Error
+	})
+}
+
+// DeleteFileOwnership deletes a file ownership record and refunds its size to the owner's quota
+func (dm *DatabaseManager) DeleteFileOwnership(fileID string, userID uint) error {
+	return dm.db.Transaction(func(tx *gorm.DB) error {
+		var ownership FileOwnership
+		if err := tx.Where("file_id = ? AND user_id = ?", fileID, userID).First(&ownership).Error; err != nil {
+			return err
+		}
+		_, err := deleteOwnership(tx, &ownership)
 		return err
+	})
+}
+
+// deleteOwnership deletes a file ownership record with its stats, replicas and share
+// links, and refunds its size unless the owner keeps another file with the same
+// object. It reports whether other records still share the object.
+func deleteOwnership(tx *gorm.DB, ownership *FileOwnership) (bool, error) {
+	if err := tx.Delete(ownership).Error; err != nil {
+		return false, err
+	}
+	for _, model := range []interface{}{&FileAccessStat{}, &FileReplica{}, &ShareLink{}} {
+		if err := tx.Where("file_id = ?", ownership.FileID).Delete(model).Error; err != nil {
+			return false, err
+		}
 	}
 
-	// Update user storage usage
-	return dm.db.Model(&User{}).Where("id = ?", userID).Update("storage_used", gorm.Expr("storage_used + ?", size)).Error
+	var ownerRefs, refs int64
+	if err := tx.Model(&FileOwnership{}).Where("object_name = ? AND user_id = ?", ownership.Object(), ownership.UserID).Count(&ownerRefs).Error; err != nil {
+		return false, err
+	}
+	if err := tx.Model(&FileOwnership{}).Where("object_name = ?", ownership.Object()).Count(&refs).Error; err != nil {
+		return false, err
+	}
+	if ownerRefs == 0 {
+		if err := releaseStorage(tx, ownership.UserID, ownership.Size); err != nil {
+			return false, err
+		}
+	}
+	return refs > 0, nil
 }
 
-// DeleteFileOwnership deletes a file ownership record
-func (dm *DatabaseManager) DeleteFileOwnership(fileID string, userID uint) error {
-	var ownership FileOwnership
-	if err := dm.db.Where("file_id = ? AND user_id = ?", fileID, userID).First(&ownership).Error; err != nil {
-		return err
+// releaseStorage subtracts size from a user's storage usage, never going below zero
+func releaseStorage(tx *gorm.DB, userID uint, size int64) error {
+	return tx.Model(&User{}).Where("id = ?", userID).
+		Update("storage_used", gorm.Expr("CASE WHEN storage_used > ? THEN storage_used - ? ELSE 0 END", size, size)).Error
+}
+
+// QuotaCorrection is a user whose recorded storage usage was rewritten
+type QuotaCorrection struct {
+	UserID uint   `json:"user_id"`
+	Email  string `json:"email"`
+	Before int64  `json:"before"`
+	After  int64  `json:"after"`
+}
+
+// RecalculateStorageUsed rewrites the storage usage of a user, or of every user when
+// userID is 0, to the total size of their file records. It returns how many users
+// were checked and those whose usage had drifted.
+func (dm *DatabaseManager) RecalculateStorageUsed(userID uint) (int, []QuotaCorrection, error) {
+	var users []User
+	corrections := make([]QuotaCorrection, 0)
+	err := dm.db.Transaction(func(tx *gorm.DB) error {
+		usersQuery := tx.Model(&User{})
+		filesQuery := tx.Model(&FileOwnership{})
+		if userID != 0 {
+			usersQuery = usersQuery.Where("id = ?", userID)
+			filesQuery = filesQuery.Where("user_id = ?", userID)
+		}
+		if err := usersQuery.Find(&users).Error; err != nil {
+			return err
+		}
+
+		var totals []struct {
+			UserID uint
+			Total  int64
+		}
+		// Files sharing an object are charged once per owner
+		objects := filesQuery.Select("user_id, object_name, MAX(size) AS size").Group("user_id, object_name")
+		if err := tx.Table("(?) AS objects", objects).Select("user_id, COALESCE(SUM(size), 0) AS total").Group("user_id").Scan(&totals).Error; err != nil {
+			return err
+		}
+		actual := make(map[uint]int64, len(totals))
+		for _, total := range totals {
+			actual[total.UserID] = total.Total
+		}
+
+		for _, user := range users {
+			if user.StorageUsed == actual[user.ID] {
+				continue
+			}
+			if err := tx.Model(&User{}).Where("id = ?", user.ID).Update("storage_used", actual[user.ID]).Error; err != nil {
+				return err
+			}
+			corrections = append(corrections, QuotaCorrection{
+				UserID: user.ID,
+				Email:  user.Email,
+				Before: user.StorageUsed,
+				After:  actual[user.ID],
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
 	}
+	return len(users), corrections, nil
+}
 
-	// Delete ownership record
-	if err := dm.db.Delete(&ownership).Error; err != nil {
+// DeletedFile is a file record removed by DeleteFileRecord, with what is left to
+// remove from storage
+type DeletedFile struct {
+	Ownership FileOwnership
+	Replicas  []string // providers holding a recorded copy of the object
+	Shared    bool     // other records still use the object, it must be kept
+}
+
+// DeleteFileRecord deletes a file's ownership record and releases its quota. The
+// stored object is removed by the caller once this has committed, so no transaction
+// is held open across a remote call.
+func (dm *DatabaseManager) DeleteFileRecord(fileID string) (*DeletedFile, error) {
+	var deleted DeletedFile
+	err := dm.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("file_id = ?", fileID).First(&deleted.Ownership).Error; err != nil {
+			return err
+		}
+		var replicas []FileReplica
+		if err := tx.Where("file_id = ?", fileID).Order("created_at asc").Find(&replicas).Error; err != nil {
+			return err
+		}
+		for _, replica := range replicas {
+			deleted.Replicas = append(deleted.Replicas, replica.Provider)
+		}
+
+		shared, err := deleteOwnership(tx, &deleted.Ownership)
+		deleted.Shared = shared
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
+	return &deleted, nil
+}
+
+// FilesByProvider returns the ownership records of files stored on provider
+func (dm *DatabaseManager) FilesByProvider(provider string) ([]FileOwnership, error) {
+	var files []FileOwnership
+	err := dm.db.Where("provider = ?", provider).Order("created_at asc").Find(&files).Error
+	return files, err
+}
+
+// RenameFileProvider rewrites the provider of every file and replica recorded on
+// oldName to newName in one transaction. It returns the number of file records
+// rewritten.
+func (dm *DatabaseManager) RenameFileProvider(oldName, newName string) (int64, error) {
+	var renamed int64
+	err := dm.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&FileOwnership{}).Where("provider = ?", oldName).Update("provider", newName)
+		if result.Error != nil {
+			return result.Error
+		}
+		renamed = result.RowsAffected
+		return tx.Model(&FileReplica{}).Where("provider = ?", oldName).Update("provider", newName).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return renamed, nil
+}
+
+// ProviderUsage is the number and total size of the files recorded on a provider
+type ProviderUsage struct {
+	Provider string `json:"provider"`
+	Files    int64  `json:"files"`
+	Bytes    int64  `json:"bytes"`
+}
 
-	// Update user storage usage
-	return dm.db.Model(&User{}).Where("id = ?", userID).Update("storage_used", gorm.Expr("storage_used - ?", ownership.Size)).Error
+// FileDistribution aggregates the file records by provider
+func (dm *DatabaseManager) FileDistribution() ([]ProviderUsage, error) {
+	var usage []ProviderUsage
+	err := dm.db.Model(&FileOwnership{}).
+		Select("provider, COUNT(*) AS files, COALESCE(SUM(size), 0) AS bytes").
+		Group("provider").Order("provider").
+		Scan(&usage).Error
+	return usage, err
 }
 
 // CheckFileOwnership checks if a user owns a file
@@ -257,17 +635,201 @@ func (dm *DatabaseManager) CheckFileOwnership(fileID string, userID uint) (*File
 	return &ownership, nil
 }
 
-// ListUserFiles lists files owned by a user
-func (dm *DatabaseManager) ListUserFiles(userID uint, offset, limit int) ([]FileOwnership, int64, error) {
+// GetFileOwnership retrieves the ownership record for a file
+func (dm *DatabaseManager) GetFileOwnership(fileID string) (*FileOwnership, error) {
+	var ownership FileOwnership
+	if err := dm.db.Where("file_id = ?", fileID).First(&ownership).Error; err != nil {
+		return nil, err
+	}
+	return &ownership, nil
+}
+
+// FilesByName returns a user's files stored under filename, oldest first. Uploads
+// never replace each other, so the same name may match several files.
+func (dm *DatabaseManager) FilesByName(userID uint, filename string) ([]FileOwnership, error) {
+	var files []FileOwnership
+	err := dm.db.Where("user_id = ? AND filename = ?", userID, filename).
+		Order("created_at asc, id asc").Find(&files).Error
+	return files, err
+}
+
+// SetFileChecksum records a file's checksum and the algorithm that produced it
+func (dm *DatabaseManager) SetFileChecksum(fileID, algorithm, checksum string) error {
+	return dm.db.Model(&FileOwnership{}).Where("file_id = ?", fileID).Updates(map[string]interface{}{
+		"checksum":           checksum,
+		"checksum_algorithm": algorithm,
+	}).Error
+}
+
+// SetFileEncryption records the key and nonce a file's object is encrypted with
+func (dm *DatabaseManager) SetFileEncryption(fileID, keyID, nonce string) error {
+	return dm.db.Model(&FileOwnership{}).Where("file_id = ?", fileID).Updates(map[string]interface{}{
+		"encryption_key_id": keyID,
+		"encryption_nonce":  nonce,
+	}).Error
+}
+
+// ErrFileNotFound is returned when no ownership record exists for a file ID
+var ErrFileNotFound = errors.New("file not found")
+
+// SetFilePublic sets whether a file can be downloaded and streamed by anyone
+func (dm *DatabaseManager) SetFilePublic(fileID string, public bool) error {
+	result := dm.db.Model(&FileOwnership{}).Where("file_id = ?", fileID).Update("is_public", public)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrFileNotFound
+	}
+	return nil
+}
+
+// fileSortColumns maps listing sort fields to file_ownerships columns
+var fileSortColumns = map[string]string{
+	"name": "filename",
+	"size": "size",
+	"date": "created_at",
+	"type": "mime_type",
+}
+
+// FileFilter narrows file ownership queries
+type FileFilter struct {
+	UserID uint   // 0 matches all users
+	Query  string // case-insensitive filename substring
+
+	Category      string    // one of FileCategories, empty matches all
+	MinSize       int64     // 0 = no lower bound
+	MaxSize       int64     // 0 = no upper bound
+	ModifiedAfter time.Time // uploaded at or after, zero matches all
+}
+
+// FileCategories maps the file type categories searches accept to MIME type
+// patterns, a trailing % matches any subtype
+var FileCategories = map[string][]string{
+	"video":    {"video/%"},
+	"audio":    {"audio/%"},
+	"image":    {"image/%"},
+	"document": {"application/pdf", "text/%", "application/rtf", "application/msword", "application/vnd.ms-%", "application/vnd.openxmlformats-officedocument.%", "application/vnd.oasis.opendocument.%"},
+}
+
+// MatchesCategory reports whether mimeType belongs to a category of FileCategories
+func MatchesCategory(category, mimeType string) bool {
+	mimeType = strings.ToLower(mimeType)
+	for _, pattern := range FileCategories[category] {
+		if prefix, ok := strings.CutSuffix(pattern, "%"); ok {
+			if strings.HasPrefix(mimeType, prefix) {
+				return true
+			}
+		} else if mimeType == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// likeEscaper makes search text match literally in a LIKE pattern escaped with \
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// filesQuery builds the base query for a filter
+func (dm *DatabaseManager) filesQuery(filter FileFilter) *gorm.DB {
+	query := dm.db.Model(&FileOwnership{})
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Query != "" {
+		query = query.Where(`LOWER(filename) LIKE ? ESCAPE '\'`, "%"+likeEscaper.Replace(strings.ToLower(filter.Query))+"%")
+	}
+	if patterns, ok := FileCategories[filter.Category]; ok {
+		conditions := dm.db
+		for _, pattern := range patterns {
+			conditions = conditions.Or(`LOWER(mime_type) LIKE ? ESCAPE '\'`, pattern)
+		}
+		query = query.Where(conditions)
+	}
+	if filter.MinSize > 0 {
+		query = query.Where("size >= ?", filter.MinSize)
+	}
+	if filter.MaxSize > 0 {
+		query = query.Where("size <= ?", filter.MaxSize)
+	}
+	if !filter.ModifiedAfter.IsZero() {
+		query = query.Where("created_at >= ?", filter.ModifiedAfter)
+	}
+	return query
+}
+
+// ListUserFiles lists files owned by a user, ordered by sortField (name, size, date or type) and order (asc or desc)
+func (dm *DatabaseManager) ListUserFiles(userID uint, offset, limit int, sortField, order string) ([]FileOwnership, int64, error) {
+	return dm.SearchFiles(FileFilter{UserID: userID}, offset, limit, sortField, order)
+}
+
+// SearchFiles lists files matching filter using offset pagination
+func (dm *DatabaseManager) SearchFiles(filter FileFilter, offset, limit int, sortField, order string) ([]FileOwnership, int64, error) {
+	column, ok := fileSortColumns[sortField]
+	if !ok {
+		return nil, 0, fmt.Errorf("invalid sort field: %s", sortField)
+	}
+	if order != "asc" && order != "desc" {
+		return nil, 0, fmt.Errorf("invalid sort order: %s", order)
+	}
+
 	var files []FileOwnership
 	var total int64
 
-	dm.db.Model(&FileOwnership{}).Where("user_id = ?", userID).Count(&total)
-	err := dm.db.Where("user_id = ?", userID).Offset(offset).Limit(limit).Find(&files).Error
+	dm.filesQuery(filter).Count(&total)
+	err := dm.filesQuery(filter).
+		Order(fmt.Sprintf("%s %s, id %s", column, order, order)).
+		Offset(offset).Limit(limit).Find(&files).Error
 
 	return files, total, err
 }
 
+// SearchFilesAfter lists files matching filter using keyset pagination on (created_at, id).
+// Pass an empty cursor for the first page; the returned cursor is empty on the last page.
+// Rows inserted during iteration sort after existing ones, so pages never skip or repeat rows.
+func (dm *DatabaseManager) SearchFilesAfter(filter FileFilter, cursor string, limit int) ([]FileOwnership, string, error) {
+	query := dm.filesQuery(filter)
+	if cursor != "" {
+		after, err := DecodeFileCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		query = query.Where("(created_at > ? OR (created_at = ? AND id > ?))", after.CreatedAt, after.CreatedAt, after.ID)
+	}
+
+	// Fetch one extra row to learn whether another page exists
+	var files []FileOwnership
+	if err := query.Order("created_at asc, id asc").Limit(limit + 1).Find(&files).Error; err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if len(files) > limit {
+		files = files[:limit]
+		next = EncodeFileCursor(files[len(files)-1])
+	}
+
+	return files, next, nil
+}
+
+// GetNotificationPrefs returns a user's notification preferences, falling back to defaults
+func (dm *DatabaseManager) GetNotificationPrefs(userID uint) (*NotificationPrefs, error) {
+	var prefs NotificationPrefs
+	err := dm.db.Where("user_id = ?", userID).First(&prefs).Error
+	if err == gorm.ErrRecordNotFound {
+		return DefaultNotificationPrefs(userID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &prefs, nil
+}
+
+// SaveNotificationPrefs creates or updates a user's notification preferences
+func (dm *DatabaseManager) SaveNotificationPrefs(prefs *NotificationPrefs) error {
+	return dm.db.Save(prefs).Error
+}
+
 // LogAudit logs an audit event
 func (dm *DatabaseManager) LogAudit(userID uint, action, resource, ipAddress, userAgent string, success bool, details string) error {
 	audit := &AuditLog{
@@ -283,6 +845,49 @@ func (dm *DatabaseManager) LogAudit(userID uint, action, resource, ipAddress, us
 	return dm.db.Create(audit).Error
 }
 
+// AuditFilter narrows audit log queries, zero fields match everything
+type AuditFilter struct {
+	UserID  uint
+	Action  string
+	Actions []string // any of these actions
+	Success *bool
+	Since   time.Time // inclusive
+	Until   time.Time // exclusive
+}
+
+// ListAuditLogs returns the audit events matching filter, newest first, with the
+// user each was recorded for
+func (dm *DatabaseManager) ListAuditLogs(filter AuditFilter, offset, limit int) ([]AuditLog, int64, error) {
+	query := dm.db.Model(&AuditLog{})
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if len(filter.Actions) > 0 {
+		query = query.Where("action IN ?", filter.Actions)
+	}
+	if filter.Success != nil {
+		query = query.Where("success = ?", *filter.Success)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var logs []AuditLog
+	err := query.Preload("User").Order("created_at desc, id desc").Offset(offset).Limit(limit).Find(&logs).Error
+	return logs, total, err
+}
+
 // GetDatabase returns the underlying database connection
 func (dm *DatabaseManager) GetDatabase() *gorm.DB {
 	return dm.db
@@ -290,6 +895,8 @@ func (dm *DatabaseManager) GetDatabase() *gorm.DB {
 
 // Close closes the database connection
 func (dm *DatabaseManager) Close() error {
+	dm.closeOnce.Do(func() { close(dm.done) })
+
 	sqlDB, err := dm.db.DB()
 	if err != nil {
 		return err
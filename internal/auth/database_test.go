@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestAdminCreatedOnlyOnFirstStart checks that the admin account is created on the
+// first start and reported as such, and left alone on the next ones
+func TestAdminCreatedOnlyOnFirstStart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth.db")
+	dm, err := NewDatabaseManager(path, "admin@example.com", "Admin-Passw0rd!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dm.AdminCreated() {
+		t.Error("got AdminCreated false on the first start, want true")
+	}
+	dm.Close()
+
+	dm, err = NewDatabaseManager(path, "admin@example.com", "Other-Passw0rd!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dm.Close()
+	if dm.AdminCreated() {
+		t.Error("got AdminCreated true on restart, want false")
+	}
+	if _, err := dm.AuthenticateUser("admin@example.com", "Admin-Passw0rd!"); err != nil {
+		t.Errorf("got %v logging in with the first password, want it kept", err)
+	}
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FindDuplicate returns the oldest file with the given SHA-256 and size, only among
+// userID's files unless userID is 0
+func (dm *DatabaseManager) FindDuplicate(contentHash string, size int64, userID uint) (*FileOwnership, error) {
+	query := dm.db.Where("content_hash = ? AND size = ?", contentHash, size)
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var ownership FileOwnership
+	if err := query.Order("created_at asc, id asc").First(&ownership).Error; err != nil {
+		return nil, err
+	}
+	return &ownership, nil
+}
+
+// CreateSharedFileOwnership records fileID as a new file of userID sharing the stored
+// object of original, which holds the same content. The file inherits the providers
+// and replicas of the object. Its size is charged unless userID already owns a file
+// with that object. It fails with ErrFileNotFound once no file references the
+// object any more, since it may be deleted by then.
+func (dm *DatabaseManager) CreateSharedFileOwnership(userID uint, fileID, filename string, original *FileOwnership) error {
+	object := original.Object()
+	ownership := &FileOwnership{
+		UserID:            userID,
+		FileID:            fileID,
+		Filename:          filename,
+		Size:              original.Size,
+		Provider:          original.Provider,
+		MimeType:          original.MimeType,
+		Checksum:          original.Checksum,
+		ChecksumAlgorithm: original.ChecksumAlgorithm,
+		ContentHash:       original.ContentHash,
+		ObjectName:        object,
+		EncryptionKeyID:   original.EncryptionKeyID,
+		EncryptionNonce:   original.EncryptionNonce,
+	}
+
+	return dm.db.Transaction(func(tx *gorm.DB) error {
+		var refs, ownerRefs int64
+		if err := tx.Model(&FileOwnership{}).Where("object_name = ?", object).Count(&refs).Error; err != nil {
+			return err
+		}
+		if refs == 0 {
+			return ErrFileNotFound
+		}
+		if err := tx.Model(&FileOwnership{}).Where("object_name = ? AND user_id = ?", object, userID).Count(&ownerRefs).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Create(ownership).Error; err != nil {
+			return err
+		}
+
+		// Any remaining file sharing the object has its replicas recorded
+		var sharer FileOwnership
+		if err := tx.Where("object_name = ? AND file_id <> ?", object, fileID).Order("created_at asc, id asc").First(&sharer).Error; err != nil {
+			return err
+		}
+		var replicas []FileReplica
+		if err := tx.Where("file_id = ?", sharer.FileID).Find(&replicas).Error; err != nil {
+			return err
+		}
+		for _, replica := range replicas {
+			copied := FileReplica{FileID: fileID, Provider: replica.Provider}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&copied).Error; err != nil {
+				return err
+			}
+		}
+
+		if ownerRefs > 0 {
+			return nil
+		}
+		return tx.Model(&User{}).Where("id = ?", userID).Update("storage_used", gorm.Expr("storage_used + ?", ownership.Size)).Error
+	})
+}
+
+// SetFileContentHash records the SHA-256 of a file's content
+func (dm *DatabaseManager) SetFileContentHash(fileID, contentHash string) error {
+	return dm.db.Model(&FileOwnership{}).Where("file_id = ?", fileID).Update("content_hash", contentHash).Error
+}
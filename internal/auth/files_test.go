@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestDeleteFileRecord(t *testing.T) {
+	dm := newTestDatabase(t)
+	user := newTestUser(t, dm, "owner@example.com")
+	if err := dm.CreateFileOwnership(user.ID, "file1", "a.txt", "remote1", 100, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	for _, provider := range []string{"remote2", "remote3"} {
+		if err := dm.AddFileReplica("file1", provider); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deleted, err := dm.DeleteFileRecord("file1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted.Ownership.FileID != "file1" || deleted.Shared {
+		t.Errorf("deleted %+v, want file1 not shared", deleted)
+	}
+	if want := []string{"remote2", "remote3"}; !reflect.DeepEqual(deleted.Replicas, want) {
+		t.Errorf("replicas %v, want %v", deleted.Replicas, want)
+	}
+
+	if _, err := dm.GetFileOwnership("file1"); err == nil {
+		t.Error("ownership record still exists")
+	}
+	if replicas, _ := dm.FileReplicas("file1"); len(replicas) != 0 {
+		t.Errorf("replica records still exist: %v", replicas)
+	}
+	if user, _ := dm.GetUserByID(user.ID); user.StorageUsed != 0 {
+		t.Errorf("storage used %d after the delete, want 0", user.StorageUsed)
+	}
+	if _, err := dm.DeleteFileRecord("file1"); err == nil {
+		t.Error("deleting a missing record succeeded")
+	}
+}
+
+func TestDeleteFileRecordSharedObject(t *testing.T) {
+	dm := newTestDatabase(t)
+	owner := newTestUser(t, dm, "owner@example.com")
+	other := newTestUser(t, dm, "other@example.com")
+	if err := dm.CreateFileOwnership(owner.ID, "file1", "a.txt", "remote1", 100, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	original, _ := dm.GetFileOwnership("file1")
+	if err := dm.CreateSharedFileOwnership(other.ID, "file2", "b.txt", original); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := dm.DeleteFileRecord("file1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !deleted.Shared {
+		t.Error("object still used by file2 was not reported shared")
+	}
+	if owner, _ := dm.GetUserByID(owner.ID); owner.StorageUsed != 0 {
+		t.Errorf("owner storage used %d, want 0", owner.StorageUsed)
+	}
+
+	if deleted, err := dm.DeleteFileRecord("file2"); err != nil || deleted.Shared {
+		t.Errorf("last record: %+v, %v, want not shared", deleted, err)
+	}
+}
+
+func TestRenameFileProvider(t *testing.T) {
+	dm := newTestDatabase(t)
+	user := newTestUser(t, dm, "owner@example.com")
+	dm.CreateFileOwnership(user.ID, "file1", "a.txt", "old", 1, "text/plain")
+	dm.CreateFileOwnership(user.ID, "file2", "b.txt", "kept", 1, "text/plain")
+	dm.AddFileReplica("file2", "old")
+
+	renamed, err := dm.RenameFileProvider("old", "new")
+	if err != nil || renamed != 1 {
+		t.Fatalf("renamed %d, %v, want 1", renamed, err)
+	}
+	if file, _ := dm.GetFileOwnership("file1"); file.Provider != "new" {
+		t.Errorf("file1 on %q, want new", file.Provider)
+	}
+	if file, _ := dm.GetFileOwnership("file2"); file.Provider != "kept" {
+		t.Errorf("file2 on %q, want kept", file.Provider)
+	}
+	if replicas, _ := dm.FileReplicas("file2"); len(replicas) != 1 || replicas[0].Provider != "new" {
+		t.Errorf("replicas of file2 %v, want one on new", replicas)
+	}
+}
+
+func TestDeleteFileOwnershipRefundsQuota(t *testing.T) {
+	dm := newTestDatabase(t)
+	user := newTestUser(t, dm, "owner@example.com")
+	for _, id := range []string{"file1", "file2"} {
+		if err := dm.CreateFileOwnership(user.ID, id, id+".txt", "remote1", 100, "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if user, _ := dm.GetUserByID(user.ID); user.StorageUsed != 200 {
+		t.Fatalf("storage used %d after two uploads, want 200", user.StorageUsed)
+	}
+
+	if err := dm.DeleteFileOwnership("file1", user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := dm.GetUserByID(user.ID); user.StorageUsed != 100 {
+		t.Errorf("storage used %d after a delete, want 100", user.StorageUsed)
+	}
+	if err := dm.DeleteFileOwnership("file1", user.ID); err == nil {
+		t.Error("deleting the record twice succeeded")
+	}
+	if user, _ := dm.GetUserByID(user.ID); user.StorageUsed != 100 {
+		t.Errorf("storage used %d after a repeated delete, want 100", user.StorageUsed)
+	}
+}
+
+func TestReleaseStorageNeverGoesNegative(t *testing.T) {
+	dm := newTestDatabase(t)
+	user := newTestUser(t, dm, "owner@example.com")
+	if err := dm.CreateFileOwnership(user.ID, "file1", "a.txt", "remote1", 100, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	// Usage that drifted below the size of the file
+	if err := dm.db.Model(&User{}).Where("id = ?", user.ID).Update("storage_used", 40).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dm.DeleteFileOwnership("file1", user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := dm.GetUserByID(user.ID); user.StorageUsed != 0 {
+		t.Errorf("storage used %d, want it clamped to 0", user.StorageUsed)
+	}
+}
+
+func TestFileDistribution(t *testing.T) {
+	dm := newTestDatabase(t)
+	user := newTestUser(t, dm, "owner@example.com")
+	for i, provider := range []string{"remote2", "remote1", "remote2"} {
+		if err := dm.CreateFileOwnership(user.ID, fmt.Sprintf("file%d", i), "a.txt", provider, int64(100*(i+1)), "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	usage, err := dm.FileDistribution()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ProviderUsage{{Provider: "remote1", Files: 1, Bytes: 200}, {Provider: "remote2", Files: 2, Bytes: 400}}
+	if !reflect.DeepEqual(usage, want) {
+		t.Errorf("got %+v, want %+v", usage, want)
+	}
+}
+
+func TestSearchFilesLiteralWildcards(t *testing.T) {
+	dm := newTestDatabase(t)
+	user := newTestUser(t, dm, "owner@example.com")
+	for i, name := range []string{"50% off.txt", "500 offers.txt", "my_notes.txt", "mynotes.txt", `back\slash.txt`} {
+		if err := dm.CreateFileOwnership(user.ID, fmt.Sprintf("file%d", i), name, "union", 1, "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for query, want := range map[string][]string{
+		"50%":   {"50% off.txt"},
+		"_":     {"my_notes.txt"},
+		"y_n":   {"my_notes.txt"},
+		`k\s`:   {`back\slash.txt`},
+		"notes": {"my_notes.txt", "mynotes.txt"},
+	} {
+		files, _, err := dm.SearchFiles(FileFilter{UserID: user.ID, Query: query}, 0, 10, "name", "asc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, file := range files {
+			got = append(got, file.Filename)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: got %v, want %v", query, got, want)
+		}
+	}
+}
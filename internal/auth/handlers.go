@@ -1,31 +1,38 @@
 package auth
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // AuthHandlers handles authentication-related HTTP requests
 type AuthHandlers struct {
 	jwtManager *JWTManager
 	dbManager  *DatabaseManager
+	notifier   *Notifier
 }
 
 // NewAuthHandlers creates new authentication handlers
-func NewAuthHandlers(jwtManager *JWTManager, dbManager *DatabaseManager) *AuthHandlers {
+func NewAuthHandlers(jwtManager *JWTManager, dbManager *DatabaseManager, notifier *Notifier) *AuthHandlers {
 	return &AuthHandlers{
 		jwtManager: jwtManager,
 		dbManager:  dbManager,
+		notifier:   notifier,
 	}
 }
 
 // RegisterRequest represents a user registration request
 type RegisterRequest struct {
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=8"`
+	Password string `json:"password" binding:"required"`
 	Role     string `json:"role,omitempty"`
 }
 
@@ -66,6 +73,14 @@ type APIKeyResponse struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// NotificationPrefsRequest represents a notification preferences update, omitted fields are unchanged
+type NotificationPrefsRequest struct {
+	QuotaWarnings  *bool   `json:"quota_warnings,omitempty"`
+	ShareAccess    *bool   `json:"share_access,omitempty"`
+	SecurityAlerts *bool   `json:"security_alerts,omitempty"`
+	Channel        *string `json:"channel,omitempty"`
+}
+
 // Register handles user registration
 // @Summary User registration
 // @Description Register a new user account
@@ -103,6 +118,14 @@ func (ah *AuthHandlers) Register(c *gin.Context) {
 
 	// Create user
 	user, err := ah.dbManager.CreateUser(req.Email, req.Password, req.Role)
+	var policyErr *PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Password does not meet the policy",
+			"problems": policyErr.Problems,
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusConflict, gin.H{
 			"error": "Failed to create user",
@@ -147,6 +170,22 @@ func (ah *AuthHandlers) Login(c *gin.Context) {
 
 	// Authenticate user
 	user, err := ah.dbManager.AuthenticateUser(req.Email, req.Password)
+	var lockout *LockoutError
+	if errors.As(err, &lockout) {
+		if lockout.JustLocked {
+			ah.dbManager.LogAudit(lockout.UserID, "account_locked", c.Request.URL.Path, c.ClientIP(), c.GetHeader("User-Agent"), false,
+				fmt.Sprintf("locked until %s after repeated failed logins", lockout.Until.Format(time.RFC3339)))
+		}
+		retryAfter := int(math.Ceil(time.Until(lockout.Until).Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":        "Account temporarily locked after repeated failed logins",
+			"code":         "ACCOUNT_LOCKED",
+			"locked_until": lockout.Until.Format(time.RFC3339),
+			"retry_after":  retryAfter,
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"error": "Invalid credentials",
@@ -162,6 +201,7 @@ func (ah *AuthHandlers) Login(c *gin.Context) {
 		})
 		return
 	}
+	ah.dbManager.LogAudit(user.ID, "login", c.Request.URL.Path, c.ClientIP(), c.GetHeader("User-Agent"), true, "")
 
 	c.JSON(http.StatusOK, LoginResponse{
 		Token:     token,
@@ -189,6 +229,19 @@ func (ah *AuthHandlers) RefreshToken(c *gin.Context) {
 	}
 
 	token := authHeader[7:] // Remove "Bearer " prefix
+
+	// Revoked tokens must not be renewed
+	if claims, err := ah.jwtManager.ValidateToken(token); err == nil {
+		version, err := ah.dbManager.TokenVersion(claims.UserID)
+		if err != nil || version != claims.TokenVersion || ah.dbManager.IsTokenRevoked(claims.ID) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Cannot refresh token",
+				"details": "token has been revoked",
+			})
+			return
+		}
+	}
+
 	newToken, err := ah.jwtManager.RefreshToken(token)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{
@@ -204,6 +257,49 @@ func (ah *AuthHandlers) RefreshToken(c *gin.Context) {
 	})
 }
 
+// Logout revokes the token the request was made with
+// @Summary Log out
+// @Description Revoke the presented JWT so it is rejected even though it hasn't expired. Other tokens of the user stay valid
+// @Tags authentication
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "Logged out"
+// @Failure 400 {object} map[string]interface{} "Token can't be revoked individually"
+// @Failure 401 {object} map[string]interface{} "Invalid or expired token"
+// @Router /../auth/logout [post]
+func (ah *AuthHandlers) Logout(c *gin.Context) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	claims, err := ah.jwtManager.ValidateToken(token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Invalid or expired token",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	// Tokens issued before jti claims were added can only expire
+	if claims.ID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Token can't be revoked",
+			"details": "token has no ID, it expires at " + claims.ExpiresAt.Format(time.RFC3339),
+		})
+		return
+	}
+
+	if err := ah.dbManager.RevokeToken(claims.ID, claims.UserID, claims.ExpiresAt.Time); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to log out",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Logged out",
+	})
+}
+
 // GetProfile returns current user profile
 // @Summary Get user profile
 // @Description Get current user's profile information
@@ -357,8 +453,7 @@ func (ah *AuthHandlers) ChangePassword(c *gin.Context) {
 		return
 	}
 
-	// Create password manager
-	pm := NewPasswordManager()
+	pm := ah.dbManager.passwordManager
 
 	// Verify current password
 	if err := pm.CheckPassword(request.CurrentPassword, user.Password); err != nil {
@@ -368,6 +463,14 @@ func (ah *AuthHandlers) ChangePassword(c *gin.Context) {
 
 	// Hash new password (validation is done inside HashPassword)
 	hashedPassword, err := pm.HashPassword(request.NewPassword)
+	var policyErr *PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Password does not meet the policy",
+			"problems": policyErr.Problems,
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
 		return
@@ -379,6 +482,8 @@ func (ah *AuthHandlers) ChangePassword(c *gin.Context) {
 		return
 	}
 
+	ah.notifier.Notify(user.ID, NotifySecurityAlert, "Password changed", "The password for your account was changed. If this wasn't you, contact an administrator.")
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Password changed successfully",
 	})
@@ -499,4 +604,388 @@ func (ah *AuthHandlers) GetUser(c *gin.Context) {
 		UsagePercent: user.GetStorageUsagePercent(),
 		CreatedAt:    user.CreatedAt.Format(time.RFC3339),
 	})
-}
\ No newline at end of file
+}
+
+// UpdateUserRequest represents an admin update of a user, omitted fields are unchanged
+type UpdateUserRequest struct {
+	Role         *string `json:"role,omitempty"`
+	StorageQuota *int64  `json:"storage_quota,omitempty"`
+	IsActive     *bool   `json:"is_active,omitempty"`
+}
+
+// UpdateUser changes a user's role, quota or status (admin only)
+// @Summary Update user
+// @Description Change a user's role (admin, user or readonly), storage quota (-1 = unlimited) or active status. Deactivating a user or changing their role revokes their tokens. The last active admin can't be demoted or deactivated (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Param request body UpdateUserRequest true "Fields to change"
+// @Success 200 {object} map[string]interface{} "User updated"
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 404 {object} map[string]interface{} "User not found"
+// @Failure 409 {object} map[string]interface{} "Last active admin"
+// @Router /../admin/users/{id} [patch]
+func (ah *AuthHandlers) UpdateUser(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid user ID",
+		})
+		return
+	}
+
+	var req UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request data",
+			"details": err.Error(),
+		})
+		return
+	}
+	if req.Role != nil && *req.Role != RoleAdmin && *req.Role != RoleUser && *req.Role != RoleReadOnly {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid role",
+			"details": fmt.Sprintf("role must be one of %s, %s, %s", RoleAdmin, RoleUser, RoleReadOnly),
+		})
+		return
+	}
+	if req.StorageQuota != nil && *req.StorageQuota < -1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid storage quota",
+			"details": "storage_quota must be -1 (unlimited) or more",
+		})
+		return
+	}
+
+	user, err := ah.dbManager.UpdateUserAccount(uint(userID), req)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "User not found",
+			})
+		case errors.Is(err, ErrLastAdmin):
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "Cannot demote or deactivate the last active admin",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to update user",
+				"details": err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User updated",
+		"user": UserInfo{
+			ID:           user.ID,
+			Email:        user.Email,
+			Role:         user.Role,
+			StorageUsed:  user.StorageUsed,
+			StorageQuota: user.StorageQuota,
+			UsagePercent: user.GetStorageUsagePercent(),
+			CreatedAt:    user.CreatedAt.Format(time.RFC3339),
+		},
+		"is_active": user.IsActive,
+	})
+}
+
+// RevokeUserTokens invalidates every token issued to a user
+// @Summary Revoke user tokens
+// @Description Invalidate all JWTs issued to a user, e.g. after changing their role or status. API keys are not affected (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]interface{} "Tokens revoked"
+// @Failure 400 {object} map[string]interface{} "Invalid user ID"
+// @Failure 404 {object} map[string]interface{} "User not found"
+// @Router /../admin/users/{id}/revoke-tokens [post]
+func (ah *AuthHandlers) RevokeUserTokens(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid user ID",
+		})
+		return
+	}
+
+	if _, err := ah.dbManager.GetUserByID(uint(userID)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	if err := ah.dbManager.BumpTokenVersion(uint(userID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to revoke tokens",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Tokens revoked",
+		"user_id": userID,
+	})
+}
+
+// RecalculateUserQuota repairs a user's storage usage
+// @Summary Recalculate user quota
+// @Description Rewrite a user's storage usage to the total size of the files they own, repairing drift left by failed uploads or crashes (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]interface{} "Storage usage recalculated"
+// @Failure 400 {object} map[string]interface{} "Invalid user ID"
+// @Failure 404 {object} map[string]interface{} "User not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /../admin/users/{id}/recalculate-quota [post]
+func (ah *AuthHandlers) RecalculateUserQuota(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid user ID",
+		})
+		return
+	}
+
+	user, err := ah.dbManager.GetUserByID(uint(userID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	_, corrections, err := ah.dbManager.RecalculateStorageUsed(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to recalculate storage usage",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	response := gin.H{
+		"message":   "Storage usage is correct",
+		"user_id":   user.ID,
+		"corrected": len(corrections) > 0,
+		"before":    user.StorageUsed,
+		"after":     user.StorageUsed,
+	}
+	if len(corrections) > 0 {
+		response["message"] = "Storage usage corrected"
+		response["after"] = corrections[0].After
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RecalculateQuotas repairs the storage usage of every user
+// @Summary Recalculate all quotas
+// @Description Rewrite every user's storage usage to the total size of the files they own and list the users that were corrected (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "Storage usage recalculated"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /../admin/recalculate-quotas [post]
+func (ah *AuthHandlers) RecalculateQuotas(c *gin.Context) {
+	checked, corrections, err := ah.dbManager.RecalculateStorageUsed(0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to recalculate storage usage",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Storage usage recalculated",
+		"checked":     checked,
+		"corrected":   len(corrections),
+		"corrections": corrections,
+	})
+}
+
+// ListAuditLogs queries the audit log (admin only)
+// @Summary List audit logs
+// @Description List recorded actions newest first, optionally filtered by user, action, outcome and time range (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param user_id query int false "Only events of this user"
+// @Param action query string false "Only this action, e.g. login or upload"
+// @Param success query bool false "Only successful (true) or failed (false) events"
+// @Param since query string false "Events at or after this RFC3339 time"
+// @Param until query string false "Events before this RFC3339 time"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page (max 200)" default(50)
+// @Success 200 {object} map[string]interface{} "Audit events"
+// @Failure 400 {object} map[string]interface{} "Invalid filter"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Router /../admin/audit-logs [get]
+func (ah *AuthHandlers) ListAuditLogs(c *gin.Context) {
+	filter := AuditFilter{Action: c.Query("action")}
+	invalid := func(param string, err error) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid " + param,
+			"details": err.Error(),
+		})
+	}
+
+	if raw := c.Query("user_id"); raw != "" {
+		userID, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			invalid("user_id", err)
+			return
+		}
+		filter.UserID = uint(userID)
+	}
+	if raw := c.Query("success"); raw != "" {
+		success, err := strconv.ParseBool(raw)
+		if err != nil {
+			invalid("success", err)
+			return
+		}
+		filter.Success = &success
+	}
+	for param, target := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if raw := c.Query(param); raw != "" {
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				invalid(param, err)
+				return
+			}
+			*target = t
+		}
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	page = max(page, 1)
+	limit = min(max(limit, 1), 200)
+
+	logs, total, err := ah.dbManager.ListAuditLogs(filter, (page-1)*limit, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to list audit logs",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"audit_logs": logs,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// GetNotificationPrefs returns the current user's notification preferences
+// @Summary Get notification preferences
+// @Description Get the current user's notification categories and delivery channel
+// @Tags user
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} NotificationPrefs "Notification preferences"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Router /../user/notifications [get]
+func (ah *AuthHandlers) GetNotificationPrefs(c *gin.Context) {
+	userID, exists := GetCurrentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Authentication required",
+		})
+		return
+	}
+
+	prefs, err := ah.dbManager.GetNotificationPrefs(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to load notification preferences",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, prefs)
+}
+
+// UpdateNotificationPrefs updates the current user's notification preferences
+// @Summary Update notification preferences
+// @Description Toggle notification categories and choose the delivery channel (email or none)
+// @Tags user
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param prefs body NotificationPrefsRequest true "Notification preferences"
+// @Success 200 {object} NotificationPrefs "Updated notification preferences"
+// @Failure 400 {object} map[string]interface{} "Invalid input"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Router /../user/notifications [put]
+func (ah *AuthHandlers) UpdateNotificationPrefs(c *gin.Context) {
+	var req NotificationPrefsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request data",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if req.Channel != nil && *req.Channel != ChannelEmail && *req.Channel != ChannelNone {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid notification channel",
+			"allowed": []string{ChannelEmail, ChannelNone},
+		})
+		return
+	}
+
+	userID, exists := GetCurrentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Authentication required",
+		})
+		return
+	}
+
+	prefs, err := ah.dbManager.GetNotificationPrefs(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to load notification preferences",
+		})
+		return
+	}
+
+	if req.QuotaWarnings != nil {
+		prefs.QuotaWarnings = *req.QuotaWarnings
+	}
+	if req.ShareAccess != nil {
+		prefs.ShareAccess = *req.ShareAccess
+	}
+	if req.SecurityAlerts != nil {
+		prefs.SecurityAlerts = *req.SecurityAlerts
+	}
+	if req.Channel != nil {
+		prefs.Channel = *req.Channel
+	}
+
+	if err := ah.dbManager.SaveNotificationPrefs(prefs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to save notification preferences",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, prefs)
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordHashing(t *testing.T) {
+	pm := NewPasswordManager()
+	bcryptHash, err := pm.HashPassword("Str0ng-Pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.SetHashing(HashArgon2id, 0); err != nil {
+		t.Fatal(err)
+	}
+	argonHash, err := pm.HashPassword("Str0ng-Pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(argonHash, "$argon2id$v=19$m=65536,t=3,p=4$") {
+		t.Errorf("got %q, want an encoded argon2id hash", argonHash)
+	}
+
+	// Both kinds keep verifying whichever algorithm is selected
+	for _, hash := range []string{bcryptHash, argonHash} {
+		if err := pm.CheckPassword("Str0ng-Pass", hash); err != nil {
+			t.Errorf("%s: right password refused: %v", hash[:8], err)
+		}
+		if err := pm.CheckPassword("wrong", hash); err == nil {
+			t.Errorf("%s: wrong password accepted", hash[:8])
+		}
+	}
+	if !pm.NeedsRehash(bcryptHash) || pm.NeedsRehash(argonHash) {
+		t.Error("with argon2id selected only the bcrypt hash needs a rehash")
+	}
+
+	if err := pm.SetHashing(HashBcrypt, bcrypt.MinCost); err != nil {
+		t.Fatal(err)
+	}
+	if !pm.NeedsRehash(bcryptHash) || !pm.NeedsRehash(argonHash) {
+		t.Error("hashes made at another cost or with argon2id don't need a rehash")
+	}
+
+	if err := pm.SetHashing(HashBcrypt, 100); err == nil {
+		t.Error("bcrypt cost 100 accepted")
+	}
+	if err := pm.SetHashing("md5", 0); err == nil {
+		t.Error("unknown algorithm accepted")
+	}
+	if err := pm.CheckPassword("Str0ng-Pass", "$argon2id$v=19$garbage"); err == nil {
+		t.Error("malformed argon2id hash accepted")
+	}
+}
+
+func TestLoginUpgradesHash(t *testing.T) {
+	dm := newTestDatabase(t)
+	user := newTestUser(t, dm, "owner@example.com")
+	if err := dm.SetPasswordHashing(HashArgon2id, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := dm.AuthenticateUser("owner@example.com", "User-Passw0rd!"); err != nil {
+		t.Fatal(err)
+	}
+	upgraded, err := dm.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(upgraded.Password, "$argon2id$") {
+		t.Errorf("stored hash %q, want it upgraded to argon2id", upgraded.Password[:10])
+	}
+	if _, err := dm.AuthenticateUser("owner@example.com", "User-Passw0rd!"); err != nil {
+		t.Errorf("login with the upgraded hash: %v", err)
+	}
+}
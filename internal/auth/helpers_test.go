@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"io"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newTestDatabase opens a fresh database in a temporary directory
+func newTestDatabase(t *testing.T) *DatabaseManager {
+	t.Helper()
+	dm, err := NewDatabaseManager(filepath.Join(t.TempDir(), "auth.db"), "admin@example.com", "Admin-Passw0rd!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dm.Close() })
+	return dm
+}
+
+// newTestUser creates a user with the user role
+func newTestUser(t *testing.T, dm *DatabaseManager, email string) *User {
+	t.Helper()
+	user, err := dm.CreateUser(email, "User-Passw0rd!", RoleUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// newTestAuth builds an AuthManager over a fresh database
+func newTestAuth(t *testing.T) *AuthManager {
+	t.Helper()
+	am, err := NewAuthManager(filepath.Join(t.TempDir(), "auth.db"), "test-secret", "admin@example.com", "Admin-Passw0rd!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	am.Notifier.logger.SetOutput(io.Discard)
+	t.Cleanup(func() { am.Close() })
+	return am
+}
+
+// do sends a request through the auth routes, authenticated as user when not nil
+func do(t *testing.T, am *AuthManager, method, path string, user *User, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if user != nil {
+		token, err := am.JWTManager.GenerateToken(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	r := gin.New()
+	am.SetupAuthRoutes(r)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// wantStatus fails the test unless w has status code want
+func wantStatus(t *testing.T, w *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if w.Code != want {
+		t.Fatalf("got %d, want %d: %s", w.Code, want, w.Body.String())
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 // JWTClaims represents the claims in a JWT token
@@ -12,6 +13,8 @@ type JWTClaims struct {
 	UserID uint   `json:"user_id"`
 	Email  string `json:"email"`
 	Role   string `json:"role"`
+	// TokenVersion must match the user's current version, bumping it revokes the token
+	TokenVersion int `json:"token_version"`
 	jwt.RegisteredClaims
 }
 
@@ -32,15 +35,18 @@ func NewJWTManager(secretKey string, tokenDuration time.Duration) *JWTManager {
 // GenerateToken generates a new JWT token for a user
 func (j *JWTManager) GenerateToken(user *User) (string, error) {
 	claims := &JWTClaims{
-		UserID: user.ID,
-		Email:  user.Email,
-		Role:   user.Role,
+		UserID:       user.ID,
+		Email:        user.Email,
+		Role:         user.Role,
+		TokenVersion: user.TokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(j.tokenDuration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 			Issuer:    "rclonestorage",
 			Subject:   user.Email,
+			// The jti lets a single token be revoked, see RevokeToken
+			ID: uuid.New().String(),
 		},
 	}
 
@@ -83,15 +89,17 @@ func (j *JWTManager) RefreshToken(tokenString string) (string, error) {
 
 	// Create new token with same claims but new expiry
 	newClaims := &JWTClaims{
-		UserID: claims.UserID,
-		Email:  claims.Email,
-		Role:   claims.Role,
+		UserID:       claims.UserID,
+		Email:        claims.Email,
+		Role:         claims.Role,
+		TokenVersion: claims.TokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(j.tokenDuration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 			Issuer:    "rclonestorage",
 			Subject:   claims.Email,
+			ID:        uuid.New().String(),
 		},
 	}
 
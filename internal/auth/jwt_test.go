@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTokenCarriesClaims(t *testing.T) {
+	jm := NewJWTManager("test-secret", time.Hour)
+	user := &User{ID: 7, Email: "owner@example.com", Role: RoleUser, TokenVersion: 3}
+	token, err := jm.GenerateToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := jm.ValidateToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != 7 || claims.Role != RoleUser || claims.TokenVersion != 3 || claims.ID == "" {
+		t.Errorf("claims %+v, want user 7 with role user, version 3 and a jti", claims)
+	}
+
+	if _, err := NewJWTManager("other-secret", time.Hour).ValidateToken(token); err == nil {
+		t.Error("token signed with another secret validated")
+	}
+	expired, _ := NewJWTManager("test-secret", -time.Minute).GenerateToken(user)
+	if _, err := jm.ValidateToken(expired); err == nil {
+		t.Error("expired token validated")
+	}
+}
+
+// whoAmI serves GET /me behind JWTAuth, answering with what the context holds
+func whoAmI(am *AuthManager) *gin.Engine {
+	r := gin.New()
+	r.GET("/me", am.Middleware.JWTAuth(), func(c *gin.Context) {
+		_, loaded := c.Get("user")
+		userID, _ := GetCurrentUserID(c)
+		c.JSON(http.StatusOK, gin.H{"user_id": userID, "role": c.GetString("user_role"), "loaded": loaded})
+	})
+	return r
+}
+
+func TestTrustClaimsSkipsUserLookup(t *testing.T) {
+	am := newTestAuth(t)
+	am.Middleware.SetTrustClaims(true)
+	user := newTestUser(t, am.DatabaseManager, "owner@example.com")
+	token, err := am.JWTManager.GenerateToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	me := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		whoAmI(am).ServeHTTP(w, req)
+		return w
+	}
+
+	w := me()
+	wantStatus(t, w, http.StatusOK)
+	var got struct {
+		UserID uint   `json:"user_id"`
+		Role   string `json:"role"`
+		Loaded bool   `json:"loaded"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.UserID != user.ID || got.Role != RoleUser || got.Loaded {
+		t.Errorf("got %+v, want the claims without loading the user", got)
+	}
+
+	// Bumping the token version still revokes trusted tokens
+	if err := am.DatabaseManager.BumpTokenVersion(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	wantStatus(t, me(), http.StatusUnauthorized)
+}
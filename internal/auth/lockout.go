@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// maxLockoutDoublings caps the lockout at 64 times the base duration
+const maxLockoutDoublings = 6
+
+// ErrAccountLocked is matched by the error AuthenticateUser returns for a locked account
+var ErrAccountLocked = errors.New("account temporarily locked")
+
+// LockoutError reports a login refused because of repeated failed attempts
+type LockoutError struct {
+	UserID uint
+	Until  time.Time
+	// JustLocked is set when this attempt was the one that locked the account
+	JustLocked bool
+}
+
+func (e *LockoutError) Error() string {
+	return fmt.Sprintf("account temporarily locked until %s", e.Until.Format(time.RFC3339))
+}
+
+func (e *LockoutError) Is(target error) bool {
+	return target == ErrAccountLocked
+}
+
+// SetLoginLockout locks an account for base after maxAttempts consecutive failed
+// logins, doubling the lock with every further failure. 0 attempts disables lockout.
+func (dm *DatabaseManager) SetLoginLockout(maxAttempts int, base time.Duration) {
+	dm.maxLoginAttempts = maxAttempts
+	dm.lockoutBase = base
+}
+
+// lockoutFor returns how long an account with the given number of consecutive
+// failures is locked, 0 while it is below the threshold
+func (dm *DatabaseManager) lockoutFor(failures int) time.Duration {
+	if dm.maxLoginAttempts <= 0 || failures < dm.maxLoginAttempts {
+		return 0
+	}
+	return dm.lockoutBase << min(failures-dm.maxLoginAttempts, maxLockoutDoublings)
+}
+
+// checkLocked returns a LockoutError while the user's lock is in effect
+func (dm *DatabaseManager) checkLocked(user *User) error {
+	if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
+		return &LockoutError{UserID: user.ID, Until: *user.LockedUntil}
+	}
+	return nil
+}
+
+// recordLoginFailure counts a failed login, locking the account once the threshold
+// is reached. It returns a LockoutError when this failure locked the account.
+func (dm *DatabaseManager) recordLoginFailure(user *User) error {
+	var lockout error
+	err := dm.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Where("id = ?", user.ID).
+			Update("failed_attempts", gorm.Expr("failed_attempts + 1")).Error; err != nil {
+			return err
+		}
+		var failures int
+		if err := tx.Model(&User{}).Where("id = ?", user.ID).Select("failed_attempts").Scan(&failures).Error; err != nil {
+			return err
+		}
+
+		duration := dm.lockoutFor(failures)
+		if duration == 0 {
+			return nil
+		}
+		until := time.Now().Add(duration)
+		lockout = &LockoutError{UserID: user.ID, Until: until, JustLocked: true}
+		return tx.Model(&User{}).Where("id = ?", user.ID).Update("locked_until", until).Error
+	})
+	if err != nil {
+		return err
+	}
+	return lockout
+}
+
+// resetLoginFailures clears the failure count after a successful login
+func (dm *DatabaseManager) resetLoginFailures(user *User) error {
+	if user.FailedAttempts == 0 && user.LockedUntil == nil {
+		return nil
+	}
+	return dm.db.Model(&User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"failed_attempts": 0,
+		"locked_until":    nil,
+	}).Error
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLockoutBackoff(t *testing.T) {
+	dm := &DatabaseManager{}
+	dm.SetLoginLockout(3, time.Minute)
+	tests := map[int]time.Duration{
+		2:   0,
+		3:   time.Minute,
+		4:   2 * time.Minute,
+		5:   4 * time.Minute,
+		100: 64 * time.Minute,
+	}
+	for failures, want := range tests {
+		if got := dm.lockoutFor(failures); got != want {
+			t.Errorf("%d failures: got %v, want %v", failures, got, want)
+		}
+	}
+
+	dm.SetLoginLockout(0, time.Minute)
+	if got := dm.lockoutFor(100); got != 0 {
+		t.Errorf("lockout disabled: got %v, want 0", got)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	dm := newTestDatabase(t)
+	dm.SetLoginLockout(2, time.Hour)
+	newTestUser(t, dm, "owner@example.com")
+
+	if _, err := dm.AuthenticateUser("owner@example.com", "wrong"); err == nil || errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("first failure: got %v, want a plain failure", err)
+	}
+	_, err := dm.AuthenticateUser("owner@example.com", "wrong")
+	var lockout *LockoutError
+	if !errors.As(err, &lockout) || !lockout.JustLocked {
+		t.Fatalf("second failure: got %v, want it to lock the account", err)
+	}
+
+	// The right password doesn't get through the lock, nor does it count
+	_, err = dm.AuthenticateUser("owner@example.com", "User-Passw0rd!")
+	if !errors.As(err, &lockout) || lockout.JustLocked {
+		t.Errorf("while locked: got %v, want the existing lock", err)
+	}
+	if !dm.PasswordMatches("owner@example.com", "User-Passw0rd!") {
+		t.Error("PasswordMatches refused the right password")
+	}
+
+	// Once the lock expires a successful login clears the count
+	if err := dm.GetDatabase().Model(&User{}).Where("email = ?", "owner@example.com").Update("locked_until", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dm.AuthenticateUser("owner@example.com", "User-Passw0rd!"); err != nil {
+		t.Fatalf("after the lock expired: %v", err)
+	}
+	if _, err := dm.AuthenticateUser("owner@example.com", "wrong"); errors.Is(err, ErrAccountLocked) {
+		t.Error("failure count wasn't reset by the successful login")
+	}
+}
+
+func TestLoginLockedResponse(t *testing.T) {
+	am := newTestAuth(t)
+	am.DatabaseManager.SetLoginLockout(1, time.Minute)
+	newTestUser(t, am.DatabaseManager, "owner@example.com")
+
+	w := do(t, am, http.MethodPost, "/api/auth/login", nil, `{"email": "owner@example.com", "password": "wrong"}`)
+	wantStatus(t, w, http.StatusTooManyRequests)
+	if got := w.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Retry-After %q, want 60", got)
+	}
+	logs, _, err := am.DatabaseManager.ListAuditLogs(AuditFilter{Action: "account_locked"}, 0, 10)
+	if err != nil || len(logs) != 1 {
+		t.Errorf("got %d account_locked events (%v), want 1", len(logs), err)
+	}
+}
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
@@ -10,18 +11,96 @@ import (
 
 // AuthMiddleware provides authentication middleware
 type AuthMiddleware struct {
-	jwtManager *JWTManager
-	dbManager  *DatabaseManager
+	jwtManager  *JWTManager
+	dbManager   *DatabaseManager
+	permissions *Permissions
+	trustClaims bool
+
+	// strictOptional makes OptionalAuth reject credentials that are present but invalid
+	strictOptional bool
+
+	// rateLimits are requests per minute by role, see SetRateLimits
+	rateLimits map[string]int
 }
 
+var (
+	errAccountDisabled = errors.New("user account is disabled")
+	errTokenRevoked    = errors.New("token has been revoked")
+)
+
 // NewAuthMiddleware creates a new authentication middleware
-func NewAuthMiddleware(jwtManager *JWTManager, dbManager *DatabaseManager) *AuthMiddleware {
+func NewAuthMiddleware(jwtManager *JWTManager, dbManager *DatabaseManager, permissions *Permissions) *AuthMiddleware {
 	return &AuthMiddleware{
-		jwtManager: jwtManager,
-		dbManager:  dbManager,
+		jwtManager:  jwtManager,
+		dbManager:   dbManager,
+		permissions: permissions,
 	}
 }
 
+// SetTrustClaims makes JWT authentication take the user ID and role from the token
+// claims instead of loading the user on every request. The user is still loaded from
+// the database by GetCurrentUser and RequireRole, and revoked tokens are rejected.
+func (am *AuthMiddleware) SetTrustClaims(trust bool) {
+	am.trustClaims = trust
+}
+
+// SetStrictOptionalAuth makes OptionalAuth answer 401 when a request carries a token or
+// API key that doesn't authenticate, instead of serving it anonymously. Requests
+// without credentials are still served anonymously.
+func (am *AuthMiddleware) SetStrictOptionalAuth(strict bool) {
+	am.strictOptional = strict
+}
+
+// authenticateJWT validates a token and sets its user in the context
+func (am *AuthMiddleware) authenticateJWT(c *gin.Context, token string) error {
+	claims, err := am.jwtManager.ValidateToken(token)
+	if err != nil {
+		return err
+	}
+	if claims.ID != "" && am.dbManager.IsTokenRevoked(claims.ID) {
+		return errTokenRevoked
+	}
+
+	if am.trustClaims {
+		version, err := am.dbManager.TokenVersion(claims.UserID)
+		if err != nil {
+			return errAccountDisabled
+		}
+		if version != claims.TokenVersion {
+			return errTokenRevoked
+		}
+
+		c.Set("user_id", claims.UserID)
+		c.Set("user_role", claims.Role)
+		c.Set("user_loader", func() (*User, error) {
+			return am.loadUser(claims)
+		})
+		return nil
+	}
+
+	user, err := am.loadUser(claims)
+	if err != nil {
+		return err
+	}
+
+	c.Set("user", user)
+	c.Set("user_id", user.ID)
+	c.Set("user_role", user.Role)
+	return nil
+}
+
+// loadUser gets the user a token was issued to, rejecting disabled accounts and revoked tokens
+func (am *AuthMiddleware) loadUser(claims *JWTClaims) (*User, error) {
+	user, err := am.dbManager.GetUserByID(claims.UserID)
+	if err != nil || !user.IsActive {
+		return nil, errAccountDisabled
+	}
+	if user.TokenVersion != claims.TokenVersion {
+		return nil, errTokenRevoked
+	}
+	return user, nil
+}
+
 // JWTAuth middleware for JWT token authentication
 func (am *AuthMiddleware) JWTAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -35,36 +114,38 @@ func (am *AuthMiddleware) JWTAuth() gin.HandlerFunc {
 			return
 		}
 
-		claims, err := am.jwtManager.ValidateToken(token)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid or expired token",
-				"code":  "INVALID_TOKEN",
-			})
-			c.Abort()
-			return
-		}
-
-		// Get user from database to ensure they're still active
-		user, err := am.dbManager.GetUserByID(claims.UserID)
-		if err != nil || !user.IsActive {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "User account is disabled",
-				"code":  "ACCOUNT_DISABLED",
-			})
-			c.Abort()
+		// Ensures the user is still active and the token wasn't revoked
+		if err := am.authenticateJWT(c, token); err != nil {
+			abortInvalidToken(c, err)
 			return
 		}
 
-		// Set user in context
-		c.Set("user", user)
-		c.Set("user_id", user.ID)
-		c.Set("user_role", user.Role)
-
 		c.Next()
 	}
 }
 
+// abortInvalidToken rejects a request whose JWT failed authentication
+func abortInvalidToken(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errAccountDisabled):
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User account is disabled",
+			"code":  "ACCOUNT_DISABLED",
+		})
+	case errors.Is(err, errTokenRevoked):
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Token has been revoked",
+			"code":  "TOKEN_REVOKED",
+		})
+	default:
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Invalid or expired token",
+			"code":  "INVALID_TOKEN",
+		})
+	}
+	c.Abort()
+}
+
 // APIKeyAuth middleware for API key authentication
 func (am *AuthMiddleware) APIKeyAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -101,32 +182,47 @@ func (am *AuthMiddleware) APIKeyAuth() gin.HandlerFunc {
 func (am *AuthMiddleware) OptionalAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Try JWT first
+		var tokenErr error
 		token := am.extractTokenFromHeader(c)
 		if token != "" {
-			if claims, err := am.jwtManager.ValidateToken(token); err == nil {
-				if user, err := am.dbManager.GetUserByID(claims.UserID); err == nil && user.IsActive {
-					c.Set("user", user)
-					c.Set("user_id", user.ID)
-					c.Set("user_role", user.Role)
-					c.Next()
-					return
-				}
+			if tokenErr = am.authenticateJWT(c, token); tokenErr == nil {
+				c.Next()
+				return
 			}
 		}
 
 		// Try API key
+		var apiKeyErr error
 		apiKey := c.GetHeader("X-API-Key")
 		if apiKey != "" {
-			if user, err := am.dbManager.ValidateAPIKey(apiKey); err == nil {
+			user, err := am.dbManager.ValidateAPIKey(apiKey)
+			if err == nil {
 				c.Set("user", user)
 				c.Set("user_id", user.ID)
 				c.Set("user_role", user.Role)
 				c.Next()
 				return
 			}
+			apiKeyErr = err
 		}
 
-		// No authentication provided, continue as anonymous
+		// In strict mode credentials that were sent but failed are rejected
+		if am.strictOptional {
+			if tokenErr != nil {
+				abortInvalidToken(c, tokenErr)
+				return
+			}
+			if apiKeyErr != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"error": "Invalid API key",
+					"code":  "INVALID_API_KEY",
+				})
+				c.Abort()
+				return
+			}
+		}
+
+		// No valid authentication provided, continue as anonymous
 		c.Next()
 	}
 }
@@ -134,6 +230,19 @@ func (am *AuthMiddleware) OptionalAuth() gin.HandlerFunc {
 // RequireRole middleware that requires a specific role
 func (am *AuthMiddleware) RequireRole(roles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// Role checks guard sensitive operations, so callers authenticated from
+		// trusted claims are confirmed against the database
+		if _, trusted := c.Get("user_loader"); trusted {
+			if _, ok := GetCurrentUser(c); !ok {
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"error": "User account is disabled or token has been revoked",
+					"code":  "TOKEN_REVOKED",
+				})
+				c.Abort()
+				return
+			}
+		}
+
 		userRole, exists := c.Get("user_role")
 		if !exists {
 			c.JSON(http.StatusUnauthorized, gin.H{
@@ -205,6 +314,19 @@ func (am *AuthMiddleware) RequireFileOwnership() gin.HandlerFunc {
 	}
 }
 
+// RequireFileReadAccess lets anyone read a file its owner made public and otherwise
+// behaves like RequireFileOwnership
+func (am *AuthMiddleware) RequireFileReadAccess() gin.HandlerFunc {
+	ownership := am.RequireFileOwnership()
+	return func(c *gin.Context) {
+		if record, err := am.dbManager.GetFileOwnership(c.Param("id")); err == nil && record.IsPublic {
+			c.Next()
+			return
+		}
+		ownership(c)
+	}
+}
+
 // AuditLog middleware that logs user actions
 func (am *AuthMiddleware) AuditLog(action string) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -254,13 +376,24 @@ func (am *AuthMiddleware) extractTokenFromHeader(c *gin.Context) string {
 	return ""
 }
 
-// GetCurrentUser helper function to get current user from context
+// GetCurrentUser helper function to get current user from context. Users authenticated
+// from trusted claims are loaded from the database on first use.
 func GetCurrentUser(c *gin.Context) (*User, bool) {
-	user, exists := c.Get("user")
+	if user, exists := c.Get("user"); exists {
+		return user.(*User), true
+	}
+
+	loader, exists := c.Get("user_loader")
 	if !exists {
 		return nil, false
 	}
-	return user.(*User), true
+	user, err := loader.(func() (*User, error))()
+	if err != nil {
+		return nil, false
+	}
+	c.Set("user", user)
+	c.Set("user_role", user.Role)
+	return user, true
 }
 
 // GetCurrentUserID helper function to get current user ID from context
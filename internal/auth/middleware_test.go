@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// optional serves a request through OptionalAuth with header set, answering with the
+// ID of the authenticated user
+func optional(am *AuthManager, header http.Header) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.GET("/files", am.Middleware.OptionalAuth(), func(c *gin.Context) {
+		userID, _ := GetCurrentUserID(c)
+		c.JSON(http.StatusOK, gin.H{"user_id": userID})
+	})
+	req := httptest.NewRequest(http.MethodGet, "/files", nil)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestOptionalAuthStrict(t *testing.T) {
+	am := newTestAuth(t)
+	user := newTestUser(t, am.DatabaseManager, "owner@example.com")
+	token, err := am.JWTManager.GenerateToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad := []http.Header{
+		{"Authorization": {"Bearer not-a-token"}},
+		{"X-Api-Key": {"not-a-key"}},
+	}
+
+	// Lenient mode serves bad credentials anonymously
+	for _, header := range bad {
+		wantStatus(t, optional(am, header), http.StatusOK)
+	}
+
+	am.Middleware.SetStrictOptionalAuth(true)
+	for _, header := range bad {
+		if w := optional(am, header); w.Code != http.StatusUnauthorized {
+			t.Errorf("%v: got %d, want 401", header, w.Code)
+		}
+	}
+	wantStatus(t, optional(am, nil), http.StatusOK)
+	wantStatus(t, optional(am, http.Header{"Authorization": {"Bearer " + token}}), http.StatusOK)
+
+	// A revoked token is rejected with its own code
+	if err := am.DatabaseManager.BumpTokenVersion(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	w := optional(am, http.Header{"Authorization": {"Bearer " + token}})
+	wantStatus(t, w, http.StatusUnauthorized)
+	if !strings.Contains(w.Body.String(), "TOKEN_REVOKED") {
+		t.Errorf("got %s, want TOKEN_REVOKED", w.Body.String())
+	}
+}
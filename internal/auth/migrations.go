@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migration is a versioned schema change for what AutoMigrate can't do on its own,
+// such as dropping or renaming columns, adding indexes and moving data
+type migration struct {
+	version int
+	name    string
+	up      func(tx *gorm.DB) error
+	down    func(tx *gorm.DB) error
+}
+
+// migrations are applied in order after AutoMigrate has brought the tables up to
+// the models. Never change or reorder a released migration, append a new one.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "index file ownerships by owner and filename",
+		up: func(tx *gorm.DB) error {
+			return tx.Exec("CREATE INDEX IF NOT EXISTS idx_file_ownerships_user_filename ON file_ownerships (user_id, filename)").Error
+		},
+		down: func(tx *gorm.DB) error {
+			return tx.Exec("DROP INDEX IF EXISTS idx_file_ownerships_user_filename").Error
+		},
+	},
+	{
+		version: 2,
+		name:    "index audit logs by user and time",
+		up: func(tx *gorm.DB) error {
+			return tx.Exec("CREATE INDEX IF NOT EXISTS idx_audit_logs_user_created ON audit_logs (user_id, created_at)").Error
+		},
+		down: func(tx *gorm.DB) error {
+			return tx.Exec("DROP INDEX IF EXISTS idx_audit_logs_user_created").Error
+		},
+	},
+	{
+		version: 3,
+		name:    "index file ownerships for search filters",
+		up: func(tx *gorm.DB) error {
+			for _, stmt := range []string{
+				"CREATE INDEX IF NOT EXISTS idx_file_ownerships_user_created ON file_ownerships (user_id, created_at)",
+				"CREATE INDEX IF NOT EXISTS idx_file_ownerships_user_size ON file_ownerships (user_id, size)",
+				"CREATE INDEX IF NOT EXISTS idx_file_ownerships_user_mime ON file_ownerships (user_id, mime_type)",
+			} {
+				if err := tx.Exec(stmt).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		down: func(tx *gorm.DB) error {
+			for _, index := range []string{"idx_file_ownerships_user_created", "idx_file_ownerships_user_size", "idx_file_ownerships_user_mime"} {
+				if err := tx.Exec("DROP INDEX IF EXISTS " + index).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		version: 4,
+		name:    "record the object of every file and index content hashes",
+		up: func(tx *gorm.DB) error {
+			for _, stmt := range []string{
+				"UPDATE file_ownerships SET object_name = file_id || '_' || filename WHERE object_name IS NULL OR object_name = ''",
+				"CREATE INDEX IF NOT EXISTS idx_file_ownerships_object ON file_ownerships (object_name, user_id)",
+				"CREATE INDEX IF NOT EXISTS idx_file_ownerships_content ON file_ownerships (content_hash, size)",
+			} {
+				if err := tx.Exec(stmt).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		down: func(tx *gorm.DB) error {
+			for _, index := range []string{"idx_file_ownerships_object", "idx_file_ownerships_content"} {
+				if err := tx.Exec("DROP INDEX IF EXISTS " + index).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+}
+
+// SchemaMigration records an applied migration
+type SchemaMigration struct {
+	Version   int       `json:"version" gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `json:"name"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// TableName keeps the conventional name for the migrations table
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// migrateSchema applies the pending migrations in order, each in its own transaction
+func (dm *DatabaseManager) migrateSchema() error {
+	if err := dm.db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return err
+	}
+
+	applied, err := dm.appliedMigrations()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+		err := dm.db.Transaction(func(tx *gorm.DB) error {
+			if err := m.up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: m.version, Name: m.name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+// MigrateDown reverts the applied migrations newer than version, newest first
+func (dm *DatabaseManager) MigrateDown(version int) error {
+	applied, err := dm.appliedMigrations()
+	if err != nil {
+		return err
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.version <= version || !applied[m.version] {
+			continue
+		}
+		err := dm.db.Transaction(func(tx *gorm.DB) error {
+			if err := m.down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, m.version).Error
+		})
+		if err != nil {
+			return fmt.Errorf("reverting migration %d (%s) failed: %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+// SchemaVersion returns the version of the newest applied migration, 0 when none is
+func (dm *DatabaseManager) SchemaVersion() (int, error) {
+	var version int
+	err := dm.db.Model(&SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	return version, err
+}
+
+// appliedMigrations returns the versions recorded in schema_migrations
+func (dm *DatabaseManager) appliedMigrations() (map[int]bool, error) {
+	var records []SchemaMigration
+	if err := dm.db.Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+
+	applied := make(map[int]bool, len(records))
+	for _, record := range records {
+		applied[record.Version] = true
+	}
+	return applied, nil
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// hasIndex reports whether the database has an index named name
+func hasIndex(t *testing.T, dm *DatabaseManager, name string) bool {
+	t.Helper()
+	var count int64
+	if err := dm.db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = ?", name).Scan(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count > 0
+}
+
+func TestMigrationsApplyOnOpen(t *testing.T) {
+	dm := newTestDatabase(t)
+	version, err := dm.SchemaVersion()
+	if err != nil || version != migrations[len(migrations)-1].version {
+		t.Errorf("got version %d, %v, want %d", version, err, migrations[len(migrations)-1].version)
+	}
+	if !hasIndex(t, dm, "idx_file_ownerships_user_filename") || !hasIndex(t, dm, "idx_file_ownerships_content") {
+		t.Error("migration indexes are missing")
+	}
+}
+
+func TestMigrateDownAndUp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth.db")
+	dm, err := NewDatabaseManager(path, "admin@example.com", "Admin-Passw0rd!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := newTestUser(t, dm, "owner@example.com")
+	if err := dm.CreateFileOwnership(user.ID, "file1", "a.txt", "union", 1, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dm.MigrateDown(3); err != nil {
+		t.Fatal(err)
+	}
+	if version, _ := dm.SchemaVersion(); version != 3 {
+		t.Errorf("got version %d after reverting to 3", version)
+	}
+	if hasIndex(t, dm, "idx_file_ownerships_object") || !hasIndex(t, dm, "idx_file_ownerships_user_filename") {
+		t.Error("reverting to 3 dropped the wrong indexes")
+	}
+	// Rows written before migration 4 had no object name
+	if err := dm.db.Exec("UPDATE file_ownerships SET object_name = ''").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := dm.MigrateDown(0); err != nil {
+		t.Fatal(err)
+	}
+	if version, _ := dm.SchemaVersion(); version != 0 || hasIndex(t, dm, "idx_file_ownerships_user_filename") {
+		t.Errorf("got version %d with indexes left after reverting everything", version)
+	}
+	dm.Close()
+
+	// Reopening applies them again
+	dm, err = NewDatabaseManager(path, "admin@example.com", "Admin-Passw0rd!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dm.Close()
+	if version, _ := dm.SchemaVersion(); version != migrations[len(migrations)-1].version {
+		t.Errorf("got version %d after reopening", version)
+	}
+	file, err := dm.GetFileOwnership("file1")
+	if err != nil || file.ObjectName != "file1_a.txt" {
+		t.Errorf("got %+v, %v, want the object name backfilled", file, err)
+	}
+}
@@ -15,6 +15,11 @@ type User struct {
 	StorageUsed  int64     `json:"storage_used" gorm:"default:0"`
 	StorageQuota int64     `json:"storage_quota" gorm:"default:1073741824"` // 1GB default
 	IsActive     bool      `json:"is_active" gorm:"default:true"`
+	TokenVersion int       `json:"-" gorm:"default:0"` // bumped to revoke every issued JWT
+
+	// Consecutive failed logins and the lock they caused, see SetLoginLockout
+	FailedAttempts int        `json:"-" gorm:"default:0"`
+	LockedUntil    *time.Time `json:"-"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
@@ -44,6 +49,64 @@ type FileOwnership struct {
 	MimeType  string    `json:"mime_type"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	Checksum          string `json:"checksum,omitempty"`
+	ChecksumAlgorithm string `json:"checksum_algorithm,omitempty"`
+
+	// IsPublic lets anyone download and stream the file, not only its owner
+	IsPublic bool `json:"is_public" gorm:"default:false"`
+
+	// ContentHash is the SHA-256 of the content, identical uploads are matched by it
+	ContentHash string `json:"content_hash,omitempty"`
+
+	// ObjectName is the object under uploads/ holding the content, "<FileID>_<Filename>"
+	// unless the file shares the object of an earlier upload of the same bytes
+	ObjectName string `json:"object_name,omitempty"`
+
+	// EncryptionKeyID is the key the object is encrypted with and EncryptionNonce
+	// (base64) its nonce, both empty when the object is stored in the clear
+	EncryptionKeyID string `json:"encryption_key_id,omitempty"`
+	EncryptionNonce string `json:"encryption_nonce,omitempty"`
+}
+
+// Object returns the name of the object under uploads/ holding the file's content
+func (f *FileOwnership) Object() string {
+	if f.ObjectName != "" {
+		return f.ObjectName
+	}
+	return f.FileID + "_" + f.Filename
+}
+
+// FileReplica records a provider holding a copy of a file under uploads/. Every upload
+// records the provider it was stored on, STORAGE_REPLICAS above 1 adds the extra copies.
+type FileReplica struct {
+	ID        uint      `json:"-" gorm:"primaryKey"`
+	FileID    string    `json:"file_id" gorm:"uniqueIndex:idx_file_replica;not null"`
+	Provider  string    `json:"provider" gorm:"uniqueIndex:idx_file_replica;not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ShareLink lets anyone holding Token download a file without credentials until it
+// expires or has been downloaded MaxDownloads times
+type ShareLink struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	Token        string     `json:"token" gorm:"unique;not null"`
+	FileID       string     `json:"file_id" gorm:"index;not null"`
+	UserID       uint       `json:"user_id" gorm:"index"` // creator
+	ExpiresAt    *time.Time `json:"expires_at"`           // nil = never
+	MaxDownloads int        `json:"max_downloads"`        // 0 = unlimited
+	Downloads    int        `json:"downloads"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// FileAccessStat counts the downloads, streams and bytes served of a file on one day (UTC)
+type FileAccessStat struct {
+	ID        uint   `json:"-" gorm:"primaryKey"`
+	FileID    string `json:"file_id" gorm:"uniqueIndex:idx_file_access_day;not null"`
+	Day       string `json:"day" gorm:"uniqueIndex:idx_file_access_day;size:10;not null"` // YYYY-MM-DD
+	Downloads int64  `json:"downloads"`
+	Streams   int64  `json:"streams"`
+	Bytes     int64  `json:"bytes"`
 }
 
 // Session represents user sessions for web interface
@@ -56,6 +119,15 @@ type Session struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// RevokedToken is a JWT invalidated before its expiry, e.g. on logout. Records are
+// purged once the token would have expired anyway.
+type RevokedToken struct {
+	JTI       string    `json:"jti" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 // AuditLog tracks user actions for security
 type AuditLog struct {
 	ID        uint      `json:"id" gorm:"primaryKey"`
@@ -70,6 +142,61 @@ type AuditLog struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// NotificationPrefs stores which notifications a user wants and how to deliver them
+type NotificationPrefs struct {
+	ID             uint      `json:"-" gorm:"primaryKey"`
+	UserID         uint      `json:"user_id" gorm:"uniqueIndex;not null"`
+	QuotaWarnings  bool      `json:"quota_warnings"`
+	ShareAccess    bool      `json:"share_access"`
+	SecurityAlerts bool      `json:"security_alerts"`
+	Channel        string    `json:"channel"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Notification category constants
+const (
+	NotifyQuotaWarning  = "quota_warning"
+	NotifyShareAccess   = "share_access"
+	NotifySecurityAlert = "security_alert"
+	NotifyUploadFailed  = "upload_failed"
+)
+
+// Notification channel constants
+const (
+	ChannelEmail = "email"
+	ChannelNone  = "none"
+)
+
+// DefaultNotificationPrefs returns the preferences applied to users who never changed them
+func DefaultNotificationPrefs(userID uint) *NotificationPrefs {
+	return &NotificationPrefs{
+		UserID:         userID,
+		QuotaWarnings:  true,
+		ShareAccess:    true,
+		SecurityAlerts: true,
+		Channel:        ChannelEmail,
+	}
+}
+
+// Allows reports whether the preferences permit a notification of the given category
+func (p *NotificationPrefs) Allows(category string) bool {
+	if p.Channel == ChannelNone {
+		return false
+	}
+
+	switch category {
+	case NotifyQuotaWarning:
+		return p.QuotaWarnings
+	case NotifyShareAccess:
+		return p.ShareAccess
+	case NotifySecurityAlert:
+		return p.SecurityAlerts
+	default:
+		return true
+	}
+}
+
 // UserRole constants
 const (
 	RoleAdmin    = "admin"
@@ -100,16 +227,6 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
-// CanUpload checks if user can upload files
-func (u *User) CanUpload() bool {
-	return u.Role != RoleReadOnly && u.IsActive
-}
-
-// CanDelete checks if user can delete files
-func (u *User) CanDelete() bool {
-	return u.Role != RoleReadOnly && u.IsActive
-}
-
 // IsAdmin checks if user has admin privileges
 func (u *User) IsAdmin() bool {
 	return u.Role == RoleAdmin && u.IsActive
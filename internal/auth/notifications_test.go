@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestNotificationPrefs(t *testing.T) {
+	am := newTestAuth(t)
+	user := newTestUser(t, am.DatabaseManager, "user@example.com")
+
+	// Users who never changed them get the defaults
+	w := do(t, am, http.MethodGet, "/api/user/notifications", user, "")
+	wantStatus(t, w, http.StatusOK)
+	var prefs NotificationPrefs
+	if err := json.Unmarshal(w.Body.Bytes(), &prefs); err != nil {
+		t.Fatal(err)
+	}
+	if want := *DefaultNotificationPrefs(user.ID); prefs.QuotaWarnings != want.QuotaWarnings || prefs.ShareAccess != want.ShareAccess ||
+		prefs.SecurityAlerts != want.SecurityAlerts || prefs.Channel != want.Channel {
+		t.Errorf("got %+v, want the defaults", prefs)
+	}
+
+	// Omitted fields are left unchanged
+	w = do(t, am, http.MethodPut, "/api/user/notifications", user, `{"share_access": false}`)
+	wantStatus(t, w, http.StatusOK)
+	stored, err := am.DatabaseManager.GetNotificationPrefs(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.ShareAccess || !stored.QuotaWarnings || !stored.SecurityAlerts || stored.Channel != ChannelEmail {
+		t.Errorf("stored %+v, want only share access off", stored)
+	}
+	if am.Notifier.Notify(user.ID, NotifyShareAccess, "Shared", "accessed") {
+		t.Error("share access notification delivered after being turned off")
+	}
+	if !am.Notifier.Notify(user.ID, NotifySecurityAlert, "Alert", "login") {
+		t.Error("security alert not delivered")
+	}
+
+	w = do(t, am, http.MethodPut, "/api/user/notifications", user, `{"channel": "pigeon"}`)
+	wantStatus(t, w, http.StatusBadRequest)
+
+	w = do(t, am, http.MethodPut, "/api/user/notifications", user, `{"channel": "none"}`)
+	wantStatus(t, w, http.StatusOK)
+	if am.Notifier.Notify(user.ID, NotifySecurityAlert, "Alert", "login") {
+		t.Error("notification delivered on the none channel")
+	}
+
+	w = do(t, am, http.MethodGet, "/api/user/notifications", nil, "")
+	wantStatus(t, w, http.StatusUnauthorized)
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// Notifier delivers user notifications, honoring each user's preferences
+type Notifier struct {
+	dbManager *DatabaseManager
+	logger    *logrus.Logger
+}
+
+// NewNotifier creates a new notifier
+func NewNotifier(dbManager *DatabaseManager) *Notifier {
+	return &Notifier{
+		dbManager: dbManager,
+		logger:    logrus.New(),
+	}
+}
+
+// Notify sends a notification to a user unless their preferences suppress the category.
+// It reports whether the notification was delivered.
+func (n *Notifier) Notify(userID uint, category, subject, message string) bool {
+	prefs, err := n.dbManager.GetNotificationPrefs(userID)
+	if err != nil {
+		n.logger.Warnf("Failed to load notification preferences for user %d: %v", userID, err)
+		return false
+	}
+
+	if !prefs.Allows(category) {
+		n.logger.Debugf("Suppressed %s notification for user %d", category, userID)
+		return false
+	}
+
+	user, err := n.dbManager.GetUserByID(userID)
+	if err != nil {
+		n.logger.Warnf("Failed to load user %d for notification: %v", userID, err)
+		return false
+	}
+
+	// No mail transport is configured yet, so email notifications are written to the log
+	n.logger.WithFields(logrus.Fields{
+		"user_id":  userID,
+		"email":    user.Email,
+		"channel":  prefs.Channel,
+		"category": category,
+	}).Infof("Notification: %s - %s", subject, message)
+
+	return true
+}
@@ -1,29 +1,244 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
 	"errors"
+	"fmt"
+	"math"
 	"regexp"
+	"strings"
 
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// Character classes a PasswordPolicy can require
+const (
+	ClassUpper   = "upper"
+	ClassLower   = "lower"
+	ClassDigit   = "digit"
+	ClassSpecial = "special"
+)
+
+// passwordClasses matches each character class and the size of its alphabet, used
+// for the entropy estimate
+var passwordClasses = []struct {
+	name    string
+	pattern *regexp.Regexp
+	size    int
+}{
+	{ClassUpper, regexp.MustCompile(`[A-Z]`), 26},
+	{ClassLower, regexp.MustCompile(`[a-z]`), 26},
+	{ClassDigit, regexp.MustCompile(`[0-9]`), 10},
+	{ClassSpecial, regexp.MustCompile(`[!@#$%^&*()_+\-=\[\]{};':"\\|,.<>\/?]`), 32},
+}
+
+// MaxPasswordBytes is the longest password accepted, bcrypt only hashes the first
+// 72 bytes and refuses longer ones
+const MaxPasswordBytes = 72
+
+// PasswordPolicy is the strength new passwords must have
+type PasswordPolicy struct {
+	MinLength int // in characters
+	MaxLength int // in bytes, 0 or more than MaxPasswordBytes = MaxPasswordBytes
+
+	// Require lists the character classes (ClassUpper, ClassLower, ClassDigit,
+	// ClassSpecial) a password must contain at least one of
+	Require []string
+
+	// MinEntropy is the minimum estimated strength in bits (0 = not checked), see
+	// EstimateEntropy
+	MinEntropy float64
+}
+
+// DefaultPasswordPolicy returns the policy used unless one is configured: at least 8
+// characters and at most 72 bytes, with an upper and lower case letter, a digit and
+// a special character
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength: 8,
+		MaxLength: MaxPasswordBytes,
+		Require:   []string{ClassUpper, ClassLower, ClassDigit, ClassSpecial},
+	}
+}
+
+// ErrWeakPassword is matched by the PasswordPolicyError ValidatePassword returns
+var ErrWeakPassword = errors.New("password does not meet the policy")
+
+// PasswordPolicyError lists every rule a password failed
+type PasswordPolicyError struct {
+	Problems []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password does not meet the policy: " + strings.Join(e.Problems, "; ")
+}
+
+func (e *PasswordPolicyError) Is(target error) bool {
+	return target == ErrWeakPassword
+}
+
+// Check returns a PasswordPolicyError listing every rule the password fails
+func (p PasswordPolicy) Check(password string) error {
+	var problems []string
+
+	if len([]rune(password)) < p.MinLength {
+		problems = append(problems, fmt.Sprintf("password must be at least %d characters long", p.MinLength))
+	}
+	// The upper bound is in bytes, multi-byte characters fill bcrypt's 72 sooner
+	maxLength := p.MaxLength
+	if maxLength <= 0 || maxLength > MaxPasswordBytes {
+		maxLength = MaxPasswordBytes
+	}
+	if len(password) > maxLength {
+		problems = append(problems, fmt.Sprintf("password must be at most %d bytes long", maxLength))
+	}
+
+	for _, required := range p.Require {
+		for _, class := range passwordClasses {
+			if class.name == required && !class.pattern.MatchString(password) {
+				problems = append(problems, classProblem(required))
+			}
+		}
+	}
+
+	if p.MinEntropy > 0 {
+		if bits := EstimateEntropy(password); bits < p.MinEntropy {
+			problems = append(problems, fmt.Sprintf("password is too predictable (%.0f bits, at least %.0f required)", bits, p.MinEntropy))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &PasswordPolicyError{Problems: problems}
+	}
+	return nil
+}
+
+func classProblem(class string) string {
+	switch class {
+	case ClassUpper:
+		return "password must contain at least one uppercase letter"
+	case ClassLower:
+		return "password must contain at least one lowercase letter"
+	case ClassDigit:
+		return "password must contain at least one digit"
+	default:
+		return "password must contain at least one special character"
+	}
+}
+
+// EstimateEntropy estimates the strength of a password in bits. Each character adds
+// log2 of the alphabet formed by the classes used, but a character repeating or
+// continuing a run (aaaa, 1234, abcd) of the one before only adds a single bit, so
+// padding a password with sequences barely helps.
+func EstimateEntropy(password string) float64 {
+	runes := []rune(password)
+
+	alphabet := 0
+	for _, class := range passwordClasses {
+		if class.pattern.MatchString(password) {
+			alphabet += class.size
+		}
+	}
+	for _, r := range runes {
+		if r > 127 {
+			alphabet += 100 // anything outside ASCII widens the search considerably
+			break
+		}
+	}
+	if alphabet == 0 {
+		return 0
+	}
+
+	perChar := math.Log2(float64(alphabet))
+	bits := 0.0
+	for i, r := range runes {
+		if i > 0 {
+			if step := r - runes[i-1]; step >= -1 && step <= 1 {
+				bits++
+				continue
+			}
+		}
+		bits += perChar
+	}
+	return bits
+}
+
+// Password hashing algorithms
+const (
+	HashBcrypt   = "bcrypt"
+	HashArgon2id = "argon2id"
+)
+
+// argon2id parameters, the RFC 9106 second recommended option
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024 // KiB
+	argon2Threads = 4
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+)
+
 // PasswordManager handles password operations
 type PasswordManager struct {
-	cost int
+	algorithm string
+	cost      int // bcrypt cost
+	policy    PasswordPolicy
 }
 
-// NewPasswordManager creates a new password manager
+// NewPasswordManager creates a new password manager hashing with bcrypt at its
+// default cost and enforcing DefaultPasswordPolicy
 func NewPasswordManager() *PasswordManager {
 	return &PasswordManager{
-		cost: bcrypt.DefaultCost,
+		algorithm: HashBcrypt,
+		cost:      bcrypt.DefaultCost,
+		policy:    DefaultPasswordPolicy(),
 	}
 }
 
-// HashPassword hashes a password using bcrypt
+// SetPolicy replaces the policy new passwords are checked against
+func (p *PasswordManager) SetPolicy(policy PasswordPolicy) {
+	p.policy = policy
+}
+
+// SetHashing selects the algorithm new hashes are made with, HashBcrypt at the given
+// cost or HashArgon2id. Existing hashes of either kind keep verifying.
+func (p *PasswordManager) SetHashing(algorithm string, bcryptCost int) error {
+	switch algorithm {
+	case HashBcrypt:
+		if bcryptCost < bcrypt.MinCost || bcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost must be between %d and %d, got %d", bcrypt.MinCost, bcrypt.MaxCost, bcryptCost)
+		}
+	case HashArgon2id:
+	default:
+		return fmt.Errorf("unknown password hashing algorithm: %s", algorithm)
+	}
+	p.algorithm = algorithm
+	p.cost = bcryptCost
+	return nil
+}
+
+// HashPassword checks a password against the policy and hashes it
 func (p *PasswordManager) HashPassword(password string) (string, error) {
 	if err := p.ValidatePassword(password); err != nil {
 		return "", err
 	}
+	return p.hash(password)
+}
+
+// hash hashes a password with the current algorithm, without checking the policy
+func (p *PasswordManager) hash(password string) (string, error) {
+	if p.algorithm == HashArgon2id {
+		salt := make([]byte, argon2SaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argon2Memory, argon2Time, argon2Threads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	}
 
 	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), p.cost)
 	if err != nil {
@@ -33,46 +248,74 @@ func (p *PasswordManager) HashPassword(password string) (string, error) {
 	return string(hashedBytes), nil
 }
 
-// CheckPassword compares a password with its hash
+// CheckPassword compares a password with its hash, telling bcrypt and argon2id
+// hashes apart by their prefix
 func (p *PasswordManager) CheckPassword(password, hash string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-}
-
-// ValidatePassword validates password strength
-func (p *PasswordManager) ValidatePassword(password string) error {
-	if len(password) < 8 {
-		return errors.New("password must be at least 8 characters long")
+	if !strings.HasPrefix(hash, "$argon2id$") {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	}
 
-	if len(password) > 128 {
-		return errors.New("password must be less than 128 characters long")
+	params, salt, key, err := parseArgon2(hash)
+	if err != nil {
+		return err
+	}
+	computed := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(computed, key) != 1 {
+		return errors.New("password does not match")
 	}
+	return nil
+}
 
-	// Check for at least one uppercase letter
-	hasUpper := regexp.MustCompile(`[A-Z]`).MatchString(password)
-	if !hasUpper {
-		return errors.New("password must contain at least one uppercase letter")
+// NeedsRehash reports whether a hash was made with another algorithm or other
+// parameters than new hashes are
+func (p *PasswordManager) NeedsRehash(hash string) bool {
+	if p.algorithm == HashArgon2id {
+		params, _, _, err := parseArgon2(hash)
+		return err != nil || params != argon2Params{argon2Time, argon2Memory, argon2Threads}
 	}
 
-	// Check for at least one lowercase letter
-	hasLower := regexp.MustCompile(`[a-z]`).MatchString(password)
-	if !hasLower {
-		return errors.New("password must contain at least one lowercase letter")
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != p.cost
+}
+
+type argon2Params struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+// parseArgon2 splits an encoded argon2id hash
+// ($argon2id$v=19$m=65536,t=3,p=4$salt$key) into its parameters, salt and key
+func parseArgon2(hash string) (argon2Params, []byte, []byte, error) {
+	var params argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != HashArgon2id {
+		return params, nil, nil, errors.New("invalid argon2id hash")
 	}
 
-	// Check for at least one digit
-	hasDigit := regexp.MustCompile(`[0-9]`).MatchString(password)
-	if !hasDigit {
-		return errors.New("password must contain at least one digit")
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version: %s", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters: %w", err)
 	}
 
-	// Check for at least one special character
-	hasSpecial := regexp.MustCompile(`[!@#$%^&*()_+\-=\[\]{};':"\\|,.<>\/?]`).MatchString(password)
-	if !hasSpecial {
-		return errors.New("password must contain at least one special character")
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, errors.New("invalid argon2id key")
 	}
+	return params, salt, key, nil
+}
 
-	return nil
+// ValidatePassword validates password strength against the policy, the error is a
+// PasswordPolicyError listing every failed rule
+func (p *PasswordManager) ValidatePassword(password string) error {
+	return p.policy.Check(password)
 }
 
 // ValidateEmail validates email format
@@ -91,4 +334,4 @@ func ValidateEmail(email string) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicyListsEveryProblem(t *testing.T) {
+	err := DefaultPasswordPolicy().Check("abc")
+	var policyErr *PasswordPolicyError
+	if !errors.As(err, &policyErr) || !errors.Is(err, ErrWeakPassword) {
+		t.Fatalf("got %v, want a PasswordPolicyError", err)
+	}
+	want := []string{
+		"password must be at least 8 characters long",
+		"password must contain at least one uppercase letter",
+		"password must contain at least one digit",
+		"password must contain at least one special character",
+	}
+	if !reflect.DeepEqual(policyErr.Problems, want) {
+		t.Errorf("got %q, want %q", policyErr.Problems, want)
+	}
+
+	if err := DefaultPasswordPolicy().Check("Str0ng-Pass"); err != nil {
+		t.Errorf("strong password refused: %v", err)
+	}
+
+	// A policy relying on entropy alone
+	policy := PasswordPolicy{MinLength: 8, MinEntropy: 60}
+	for password, ok := range map[string]bool{
+		"aaaaaaaaaaaaaaaaaaaa":  false,
+		"abcdefghijklmnopqrst":  false,
+		"correct horse battery": true,
+	} {
+		if err := policy.Check(password); (err == nil) != ok {
+			t.Errorf("%q: got %v, want accepted %v", password, err, ok)
+		}
+	}
+}
+
+func TestPasswordMaxLengthInBytes(t *testing.T) {
+	prefix := "Str0ng-"
+	for _, tt := range []struct {
+		policy   PasswordPolicy
+		password string
+		ok       bool
+	}{
+		{DefaultPasswordPolicy(), prefix + strings.Repeat("x", 65), true},
+		{DefaultPasswordPolicy(), prefix + strings.Repeat("x", 66), false},
+		// 37 characters, but 2 bytes each past the prefix
+		{DefaultPasswordPolicy(), prefix + strings.Repeat("é", 33), false},
+		// bcrypt's limit holds whatever the policy allows
+		{PasswordPolicy{MinLength: 8, MaxLength: 200}, strings.Repeat("x", 73), false},
+		{PasswordPolicy{MinLength: 8}, strings.Repeat("x", 73), false},
+	} {
+		if err := tt.policy.Check(tt.password); (err == nil) != tt.ok {
+			t.Errorf("%d bytes with max %d: got %v, want accepted %v", len(tt.password), tt.policy.MaxLength, err, tt.ok)
+		}
+	}
+}
+
+func TestEstimateEntropy(t *testing.T) {
+	if got := EstimateEntropy(""); got != 0 {
+		t.Errorf("empty: got %v", got)
+	}
+	// Runs add a bit per character after the first
+	if got, want := EstimateEntropy("1234"), EstimateEntropy("1")+3; got != want {
+		t.Errorf("1234: got %v, want %v", got, want)
+	}
+	if EstimateEntropy("x7#Q") <= EstimateEntropy("xxxx") {
+		t.Error("mixed classes don't score above a repeated letter")
+	}
+}
+
+func TestChangePasswordReportsPolicyProblems(t *testing.T) {
+	am := newTestAuth(t)
+	am.DatabaseManager.SetPasswordPolicy(PasswordPolicy{MinLength: 12, Require: []string{ClassDigit}})
+	user := newTestUser(t, am.DatabaseManager, "owner@example.com")
+
+	w := do(t, am, http.MethodPost, "/api/user/change-password", user, `{"current_password": "User-Passw0rd!", "new_password": "short"}`)
+	wantStatus(t, w, http.StatusBadRequest)
+	var resp struct {
+		Problems []string `json:"problems"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Problems) != 2 {
+		t.Errorf("got problems %q, want the length and the digit", resp.Problems)
+	}
+
+	// The configured policy replaces the default one
+	w = do(t, am, http.MethodPost, "/api/user/change-password", user, `{"current_password": "User-Passw0rd!", "new_password": "lowercase only 1"}`)
+	wantStatus(t, w, http.StatusOK)
+}
+
+func TestRegisterFollowsPolicyMinLength(t *testing.T) {
+	am := newTestAuth(t)
+	am.DatabaseManager.SetPasswordPolicy(PasswordPolicy{MinLength: 6})
+
+	w := do(t, am, http.MethodPost, "/api/auth/register", nil, `{"email": "short@example.com", "password": "x7#Qa!"}`)
+	wantStatus(t, w, http.StatusCreated)
+
+	// Too short for the policy, every failed rule is reported
+	am.DatabaseManager.SetPasswordPolicy(PasswordPolicy{MinLength: 8, Require: []string{ClassDigit}})
+	w = do(t, am, http.MethodPost, "/api/auth/register", nil, `{"email": "shorter@example.com", "password": "abc"}`)
+	wantStatus(t, w, http.StatusBadRequest)
+	var resp struct {
+		Problems []string `json:"problems"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Problems) != 2 {
+		t.Errorf("got problems %q, want the length and the digit", resp.Problems)
+	}
+}
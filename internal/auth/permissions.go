@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Actions governed by the permission matrix
+const (
+	ActionUpload       = "upload"
+	ActionDelete       = "delete"
+	ActionShare        = "share"
+	ActionCreateAPIKey = "create-api-key"
+)
+
+var knownActions = map[string]bool{
+	ActionUpload:       true,
+	ActionDelete:       true,
+	ActionShare:        true,
+	ActionCreateAPIKey: true,
+}
+
+// defaultPermissions mirrors the built-in role behavior
+var defaultPermissions = map[string][]string{
+	RoleAdmin:    {ActionUpload, ActionDelete, ActionShare, ActionCreateAPIKey},
+	RoleUser:     {ActionUpload, ActionDelete, ActionShare, ActionCreateAPIKey},
+	RoleReadOnly: {ActionCreateAPIKey},
+}
+
+// Permissions is the role to allowed actions matrix consulted by every capability check
+type Permissions struct {
+	roles map[string]map[string]bool
+}
+
+// NewPermissions builds the matrix from the defaults, replacing the actions of every
+// role present in overrides. Unknown actions are rejected.
+func NewPermissions(overrides map[string][]string) (*Permissions, error) {
+	p := &Permissions{roles: make(map[string]map[string]bool)}
+	for role, actions := range defaultPermissions {
+		p.set(role, actions)
+	}
+
+	for role, actions := range overrides {
+		for _, action := range actions {
+			if !knownActions[action] {
+				return nil, fmt.Errorf("unknown action %q for role %s", action, role)
+			}
+		}
+		p.set(role, actions)
+	}
+
+	return p, nil
+}
+
+func (p *Permissions) set(role string, actions []string) {
+	allowed := make(map[string]bool, len(actions))
+	for _, action := range actions {
+		allowed[action] = true
+	}
+	p.roles[role] = allowed
+}
+
+// Allows reports whether a role may perform an action
+func (p *Permissions) Allows(role, action string) bool {
+	return p.roles[role][action]
+}
+
+// Can reports whether an active user may perform an action
+func (p *Permissions) Can(user *User, action string) bool {
+	return user != nil && user.IsActive && p.Allows(user.Role, action)
+}
+
+// Matrix returns the allowed actions of every role
+func (p *Permissions) Matrix() map[string][]string {
+	matrix := make(map[string][]string, len(p.roles))
+	for role, allowed := range p.roles {
+		actions := make([]string, 0, len(allowed))
+		for action := range allowed {
+			actions = append(actions, action)
+		}
+		sort.Strings(actions)
+		matrix[role] = actions
+	}
+	return matrix
+}
+
+// RequirePermission middleware that requires the current user's role to allow an action
+func (am *AuthMiddleware) RequirePermission(action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := GetCurrentUser(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Authentication required",
+				"code":  "AUTH_REQUIRED",
+			})
+			c.Abort()
+			return
+		}
+
+		if !am.permissions.Can(user, action) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":  "Insufficient permissions",
+				"code":   "PERMISSION_DENIED",
+				"action": action,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
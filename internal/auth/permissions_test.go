@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPermissionOverrides(t *testing.T) {
+	p, err := NewPermissions(map[string][]string{RoleUser: {ActionUpload}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Allows(RoleUser, ActionUpload) || p.Allows(RoleUser, ActionDelete) || p.Allows(RoleUser, ActionShare) {
+		t.Errorf("user may %v, want upload only", p.Matrix()[RoleUser])
+	}
+	// Roles without an override keep the built-in actions
+	if got, want := p.Matrix()[RoleReadOnly], []string{ActionCreateAPIKey}; !reflect.DeepEqual(got, want) {
+		t.Errorf("readonly may %v, want %v", got, want)
+	}
+	if !p.Allows(RoleAdmin, ActionDelete) {
+		t.Error("admin lost a built-in action")
+	}
+
+	if _, err := NewPermissions(map[string][]string{RoleUser: {"launch-rockets"}}); err == nil {
+		t.Error("unknown action accepted")
+	}
+}
+
+func TestPermissionsNeedActiveUser(t *testing.T) {
+	p, _ := NewPermissions(nil)
+	if !p.Can(&User{Role: RoleUser, IsActive: true}, ActionUpload) {
+		t.Error("active user can't upload")
+	}
+	if p.Can(&User{Role: RoleUser}, ActionUpload) {
+		t.Error("inactive user can upload")
+	}
+	if p.Can(nil, ActionUpload) {
+		t.Error("missing user can upload")
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	am := newTestAuth(t)
+	permissions, err := NewPermissions(map[string][]string{RoleUser: {ActionUpload}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	am.SetPermissions(permissions)
+	user := newTestUser(t, am.DatabaseManager, "owner@example.com")
+
+	r := gin.New()
+	for _, action := range []string{ActionUpload, ActionDelete} {
+		r.POST("/"+action, am.Middleware.JWTAuth(), am.Middleware.RequirePermission(action), func(c *gin.Context) {
+			c.Status(http.StatusNoContent)
+		})
+	}
+	token, err := am.JWTManager.GenerateToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for action, want := range map[string]int{ActionUpload: http.StatusNoContent, ActionDelete: http.StatusForbidden} {
+		req := httptest.NewRequest(http.MethodPost, "/"+action, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("%s: got %d, want %d", action, w.Code, want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// driftUsage records usage for user that no file accounts for
+func driftUsage(t *testing.T, dm *DatabaseManager, user *User, used int64) {
+	t.Helper()
+	if err := dm.GetDatabase().Model(&User{}).Where("id = ?", user.ID).Update("storage_used", used).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecalculateStorageUsed(t *testing.T) {
+	dm := newTestDatabase(t)
+	drifted := newTestUser(t, dm, "drifted@example.com")
+	correct := newTestUser(t, dm, "correct@example.com")
+	for i, size := range []int64{100, 50} {
+		if err := dm.CreateFileOwnership(drifted.ID, fmt.Sprintf("file%d", i), "a.txt", "remote1", size, "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dm.CreateFileOwnership(correct.ID, "file2", "b.txt", "remote1", 10, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	driftUsage(t, dm, drifted, 999)
+
+	checked, corrections, err := dm.RecalculateStorageUsed(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := QuotaCorrection{UserID: drifted.ID, Email: "drifted@example.com", Before: 999, After: 150}
+	if checked != 3 || len(corrections) != 1 || corrections[0] != want {
+		t.Errorf("checked %d, corrected %+v, want 3 checked and %+v", checked, corrections, want)
+	}
+	if user, _ := dm.GetUserByID(drifted.ID); user.StorageUsed != 150 {
+		t.Errorf("storage used %d, want 150", user.StorageUsed)
+	}
+
+	if _, corrections, _ := dm.RecalculateStorageUsed(0); len(corrections) != 0 {
+		t.Errorf("second run corrected %+v, want nothing", corrections)
+	}
+}
+
+func TestRecalculateUserQuotaEndpoint(t *testing.T) {
+	am := newTestAuth(t)
+	dm := am.DatabaseManager
+	admin, err := dm.GetUserByEmail("admin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := newTestUser(t, dm, "owner@example.com")
+	driftUsage(t, dm, user, 42)
+
+	path := fmt.Sprintf("/api/admin/users/%d/recalculate-quota", user.ID)
+	wantStatus(t, do(t, am, http.MethodPost, path, user, ""), http.StatusForbidden)
+
+	w := do(t, am, http.MethodPost, path, admin, "")
+	wantStatus(t, w, http.StatusOK)
+	var resp struct {
+		Corrected bool  `json:"corrected"`
+		Before    int64 `json:"before"`
+		After     int64 `json:"after"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Corrected || resp.Before != 42 || resp.After != 0 {
+		t.Errorf("got %s, want 42 corrected to 0", w.Body.String())
+	}
+	if user, _ := dm.GetUserByID(user.ID); user.StorageUsed != 0 {
+		t.Errorf("storage used %d, want 0", user.StorageUsed)
+	}
+
+	wantStatus(t, do(t, am, http.MethodPost, "/api/admin/users/999/recalculate-quota", admin, ""), http.StatusNotFound)
+	wantStatus(t, do(t, am, http.MethodPost, "/api/admin/users/abc/recalculate-quota", admin, ""), http.StatusBadRequest)
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// roleAnonymous is the rate limit key for requests without credentials
+const roleAnonymous = "anonymous"
+
+// tokenBucket holds up to a minute's worth of requests, refilled continuously
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter tracks a token bucket per caller
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// take removes a token from the caller's bucket, which holds perMinute tokens when
+// full. When the bucket is empty it returns how long until the next token.
+func (l *rateLimiter) take(key string, perMinute int, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	capacity := float64(perMinute)
+	rate := capacity / time.Minute.Seconds()
+
+	// Buckets idle long enough to be full again are the same as new ones
+	if now.Sub(l.lastSweep) > time.Minute {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > time.Minute {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: capacity, last: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(capacity, bucket.tokens+now.Sub(bucket.last).Seconds()*rate)
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / rate * float64(time.Second))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// SetRateLimits sets requests per minute by role, overriding the default passed to
+// RateLimit. The role "anonymous" applies to requests without credentials and 0
+// leaves a role unlimited.
+func (am *AuthMiddleware) SetRateLimits(limits map[string]int) {
+	am.rateLimits = make(map[string]int, len(limits))
+	for role, limit := range limits {
+		am.rateLimits[role] = limit
+	}
+}
+
+// RateLimit throttles each user, whether authenticated by JWT or API key, to
+// perMinute requests a minute unless SetRateLimits sets a limit for their role.
+// Anonymous requests are limited per client IP. Requests over the limit get 429 with
+// a Retry-After header. It must run after the authentication middleware.
+func (am *AuthMiddleware) RateLimit(perMinute int) gin.HandlerFunc {
+	limiter := &rateLimiter{buckets: make(map[string]*tokenBucket)}
+
+	return func(c *gin.Context) {
+		role := roleAnonymous
+		key := "ip:" + c.ClientIP()
+		if userID, ok := GetCurrentUserID(c); ok {
+			role = c.GetString("user_role")
+			key = fmt.Sprintf("user:%d", userID)
+		}
+
+		limit, ok := am.rateLimits[role]
+		if !ok {
+			limit = perMinute
+		}
+		if limit <= 0 {
+			c.Next()
+			return
+		}
+
+		allowed, wait := limiter.take(key, limit, time.Now())
+		if !allowed {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":       "Rate limit exceeded",
+				"code":        "RATE_LIMITED",
+				"limit":       limit,
+				"retry_after": retryAfter,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
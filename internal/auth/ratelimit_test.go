@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTokenBucket(t *testing.T) {
+	limiter := &rateLimiter{buckets: make(map[string]*tokenBucket)}
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if ok, _ := limiter.take("a", 2, now); !ok {
+			t.Fatalf("request %d refused within the limit", i+1)
+		}
+	}
+	ok, wait := limiter.take("a", 2, now)
+	if ok || wait != 30*time.Second {
+		t.Errorf("over the limit: got %v, wait %v, want refused for 30s", ok, wait)
+	}
+	if ok, _ := limiter.take("b", 2, now); !ok {
+		t.Error("another caller shares the bucket")
+	}
+	if ok, _ := limiter.take("a", 2, now.Add(30*time.Second)); !ok {
+		t.Error("bucket not refilled after 30s")
+	}
+}
+
+func TestRateLimitByRole(t *testing.T) {
+	am := newTestAuth(t)
+	am.Middleware.SetRateLimits(map[string]int{RoleAdmin: 0})
+	admin, err := am.DatabaseManager.GetUserByEmail("admin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := newTestUser(t, am.DatabaseManager, "owner@example.com")
+
+	r := gin.New()
+	r.Use(am.Middleware.OptionalAuth(), am.Middleware.RateLimit(2))
+	r.GET("/files", func(c *gin.Context) { c.Status(http.StatusOK) })
+	send := func(user *User, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/files", nil)
+		req.RemoteAddr = ip + ":1234"
+		if user != nil {
+			token, err := am.JWTManager.GenerateToken(user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// Users are limited across IPs, anonymous requests per IP
+	wantStatus(t, send(user, "10.0.0.1"), http.StatusOK)
+	wantStatus(t, send(user, "10.0.0.2"), http.StatusOK)
+	w := send(user, "10.0.0.3")
+	wantStatus(t, w, http.StatusTooManyRequests)
+	if got := w.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Retry-After %q, want 30", got)
+	}
+	wantStatus(t, send(nil, "10.0.0.1"), http.StatusOK)
+	wantStatus(t, send(nil, "10.0.0.1"), http.StatusOK)
+	wantStatus(t, send(nil, "10.0.0.1"), http.StatusTooManyRequests)
+	wantStatus(t, send(nil, "10.0.0.2"), http.StatusOK)
+
+	// A limit of 0 leaves the role unlimited
+	for i := 0; i < 5; i++ {
+		wantStatus(t, send(admin, "10.0.0.1"), http.StatusOK)
+	}
+}
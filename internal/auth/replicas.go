@@ -0,0 +1,19 @@
+package auth
+
+import (
+	"gorm.io/gorm/clause"
+)
+
+// AddFileReplica records that provider holds a copy of a file, recording the same
+// copy twice is a no-op
+func (dm *DatabaseManager) AddFileReplica(fileID, provider string) error {
+	replica := FileReplica{FileID: fileID, Provider: provider}
+	return dm.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&replica).Error
+}
+
+// FileReplicas returns the providers recorded as holding a copy of a file, oldest first
+func (dm *DatabaseManager) FileReplicas(fileID string) ([]FileReplica, error) {
+	var replicas []FileReplica
+	err := dm.db.Where("file_id = ?", fileID).Order("created_at asc, id asc").Find(&replicas).Error
+	return replicas, err
+}
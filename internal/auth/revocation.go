@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+)
+
+// revocationCleanupInterval is how often revoked tokens past their expiry are purged
+const revocationCleanupInterval = time.Hour
+
+// RevokeToken invalidates the token with the given ID until it expires
+func (dm *DatabaseManager) RevokeToken(jti string, userID uint, expiresAt time.Time) error {
+	record := &RevokedToken{
+		JTI:       jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+	}
+	if err := dm.db.Save(record).Error; err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	dm.revokedTokens.Store(jti, expiresAt)
+	return nil
+}
+
+// IsTokenRevoked reports whether the token with the given ID was revoked. Revocations
+// are kept in memory, so checking doesn't touch the database.
+func (dm *DatabaseManager) IsTokenRevoked(jti string) bool {
+	_, revoked := dm.revokedTokens.Load(jti)
+	return revoked
+}
+
+// PurgeRevokedTokens removes revocations of tokens that have expired, which are
+// rejected anyway, and returns how many were removed
+func (dm *DatabaseManager) PurgeRevokedTokens() (int64, error) {
+	now := time.Now()
+	result := dm.db.Where("expires_at < ?", now).Delete(&RevokedToken{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	dm.revokedTokens.Range(func(jti, expiresAt interface{}) bool {
+		if expiresAt.(time.Time).Before(now) {
+			dm.revokedTokens.Delete(jti)
+		}
+		return true
+	})
+	return result.RowsAffected, nil
+}
+
+// loadRevokedTokens reads the revocations that are still in effect into memory
+func (dm *DatabaseManager) loadRevokedTokens() error {
+	var records []RevokedToken
+	if err := dm.db.Where("expires_at >= ?", time.Now()).Find(&records).Error; err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		dm.revokedTokens.Store(record.JTI, record.ExpiresAt)
+	}
+	return nil
+}
+
+// startRevocationCleanup purges expired revocations until Close is called
+func (dm *DatabaseManager) startRevocationCleanup() {
+	ticker := time.NewTicker(revocationCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := dm.PurgeRevokedTokens(); err != nil {
+				fmt.Printf("Warning: Failed to purge revoked tokens: %v\n", err)
+			}
+		case <-dm.done:
+			return
+		}
+	}
+}
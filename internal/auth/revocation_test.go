@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// withToken sends a request through the auth routes with token as bearer
+func withToken(am *AuthManager, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	r := gin.New()
+	am.SetupAuthRoutes(r)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestLogoutRevokesOnlyThatToken(t *testing.T) {
+	am := newTestAuth(t)
+	user := newTestUser(t, am.DatabaseManager, "owner@example.com")
+	first, err := am.JWTManager.GenerateToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := am.JWTManager.GenerateToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantStatus(t, withToken(am, http.MethodPost, "/api/auth/logout", first), http.StatusOK)
+	for _, route := range [][2]string{{http.MethodGet, "/api/user/profile"}, {http.MethodPost, "/api/auth/refresh"}} {
+		if w := withToken(am, route[0], route[1], first); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s with the revoked token: got %d, want 401", route[1], w.Code)
+		}
+	}
+	wantStatus(t, withToken(am, http.MethodGet, "/api/user/profile", second), http.StatusOK)
+}
+
+func TestRevocationsSurviveRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth.db")
+	dm, err := NewDatabaseManager(path, "admin@example.com", "Admin-Passw0rd!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := newTestUser(t, dm, "owner@example.com")
+	if err := dm.RevokeToken("live", user.ID, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := dm.RevokeToken("expired", user.ID, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	dm.Close()
+
+	dm, err = NewDatabaseManager(path, "admin@example.com", "Admin-Passw0rd!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dm.Close()
+	if !dm.IsTokenRevoked("live") {
+		t.Error("revocation lost on restart")
+	}
+	if dm.IsTokenRevoked("expired") {
+		t.Error("revocation of an expired token loaded on restart")
+	}
+
+	purged, err := dm.PurgeRevokedTokens()
+	if err != nil || purged != 1 {
+		t.Errorf("purged %d (%v), want 1", purged, err)
+	}
+	if !dm.IsTokenRevoked("live") {
+		t.Error("purge removed a revocation still in effect")
+	}
+}
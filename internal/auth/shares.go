@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Share link errors
+var (
+	ErrShareNotFound  = errors.New("share link not found")
+	ErrShareExpired   = errors.New("share link has expired")
+	ErrShareExhausted = errors.New("share link download limit reached")
+)
+
+// CreateShareLink creates a link to fileID on behalf of userID, valid for ttl
+// (0 = no expiry) and maxDownloads downloads (0 = unlimited)
+func (dm *DatabaseManager) CreateShareLink(fileID string, userID uint, ttl time.Duration, maxDownloads int) (*ShareLink, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return nil, err
+	}
+
+	link := &ShareLink{
+		Token:        "shr_" + hex.EncodeToString(bytes),
+		FileID:       fileID,
+		UserID:       userID,
+		MaxDownloads: maxDownloads,
+	}
+	if ttl > 0 {
+		expires := time.Now().Add(ttl)
+		link.ExpiresAt = &expires
+	}
+
+	if err := dm.db.Create(link).Error; err != nil {
+		return nil, err
+	}
+	return link, nil
+}
+
+// ShareLinks lists the links created by userID, newest first. A non-empty fileID
+// only lists the links to that file, userID 0 lists every user's links.
+func (dm *DatabaseManager) ShareLinks(userID uint, fileID string) ([]ShareLink, error) {
+	query := dm.db.Model(&ShareLink{})
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if fileID != "" {
+		query = query.Where("file_id = ?", fileID)
+	}
+
+	var links []ShareLink
+	err := query.Order("created_at desc, id desc").Find(&links).Error
+	return links, err
+}
+
+// GetShareLink returns the link with the given ID
+func (dm *DatabaseManager) GetShareLink(id uint) (*ShareLink, error) {
+	var link ShareLink
+	if err := dm.db.First(&link, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrShareNotFound
+		}
+		return nil, err
+	}
+	return &link, nil
+}
+
+// RevokeShareLink deletes a link, it stops working immediately
+func (dm *DatabaseManager) RevokeShareLink(id uint) error {
+	result := dm.db.Delete(&ShareLink{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrShareNotFound
+	}
+	return nil
+}
+
+// UseShareLink returns the link for token if it is still valid and whether this use
+// was counted as a download. resume is the number of an earlier download through the
+// link that is being resumed, 0 for a new download. A resumed download is not counted
+// again, provided it was counted in the first place; anything else is counted
+// atomically, so concurrent requests can't exceed MaxDownloads. The error is
+// ErrShareNotFound, ErrShareExpired or ErrShareExhausted for links that can't be used.
+func (dm *DatabaseManager) UseShareLink(token string, resume int) (*ShareLink, bool, error) {
+	var link ShareLink
+	if err := dm.db.Where("token = ?", token).First(&link).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, false, ErrShareNotFound
+		}
+		return nil, false, err
+	}
+	if link.ExpiresAt != nil && !time.Now().Before(*link.ExpiresAt) {
+		return nil, false, ErrShareExpired
+	}
+	if resume > 0 && resume <= link.Downloads {
+		return &link, false, nil
+	}
+
+	result := dm.db.Model(&ShareLink{}).
+		Where("id = ? AND (max_downloads = 0 OR downloads < max_downloads)", link.ID).
+		Update("downloads", gorm.Expr("downloads + 1"))
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, false, ErrShareExhausted
+	}
+	link.Downloads++
+	return &link, true, nil
+}
+
+// RefundShareDownload takes back a download counted by UseShareLink that failed
+func (dm *DatabaseManager) RefundShareDownload(id uint) error {
+	return dm.db.Model(&ShareLink{}).Where("id = ? AND downloads > 0", id).
+		Update("downloads", gorm.Expr("downloads - 1")).Error
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUseShareLinkEnforcesMaxDownloads(t *testing.T) {
+	dm := newTestDatabase(t)
+	user := newTestUser(t, dm, "owner@example.com")
+	link, err := dm.CreateShareLink("file1", user.ID, time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, counted, err := dm.UseShareLink(link.Token, 0); err != nil || !counted {
+		t.Fatalf("first download: counted=%v err=%v", counted, err)
+	}
+	if _, _, err := dm.UseShareLink(link.Token, 0); !errors.Is(err, ErrShareExhausted) {
+		t.Fatalf("second download: err=%v, want ErrShareExhausted", err)
+	}
+}
+
+func TestUseShareLinkResumesOnlyCountedDownloads(t *testing.T) {
+	dm := newTestDatabase(t)
+	user := newTestUser(t, dm, "owner@example.com")
+	link, _ := dm.CreateShareLink("file1", user.ID, 0, 1)
+
+	// Nothing was downloaded yet, so there is nothing to resume
+	if _, counted, err := dm.UseShareLink(link.Token, 1); err != nil || !counted {
+		t.Fatalf("resume before any download: counted=%v err=%v, want counted", counted, err)
+	}
+	if _, counted, err := dm.UseShareLink(link.Token, 1); err != nil || counted {
+		t.Fatalf("resume of download 1: counted=%v err=%v, want uncounted", counted, err)
+	}
+	if _, _, err := dm.UseShareLink(link.Token, 2); !errors.Is(err, ErrShareExhausted) {
+		t.Fatalf("resume of a download never made: err=%v, want ErrShareExhausted", err)
+	}
+}
+
+func TestUseShareLinkRefund(t *testing.T) {
+	dm := newTestDatabase(t)
+	user := newTestUser(t, dm, "owner@example.com")
+	link, _ := dm.CreateShareLink("file1", user.ID, 0, 1)
+
+	used, _, err := dm.UseShareLink(link.Token, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dm.RefundShareDownload(used.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, counted, err := dm.UseShareLink(link.Token, 0); err != nil || !counted {
+		t.Fatalf("download after refund: counted=%v err=%v", counted, err)
+	}
+}
+
+func TestUseShareLinkExpired(t *testing.T) {
+	dm := newTestDatabase(t)
+	user := newTestUser(t, dm, "owner@example.com")
+	link, _ := dm.CreateShareLink("file1", user.ID, time.Millisecond, 0)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, _, err := dm.UseShareLink(link.Token, 0); !errors.Is(err, ErrShareExpired) {
+		t.Fatalf("err=%v, want ErrShareExpired", err)
+	}
+	if _, _, err := dm.UseShareLink("shr_missing", 0); !errors.Is(err, ErrShareNotFound) {
+		t.Fatalf("err=%v, want ErrShareNotFound", err)
+	}
+}
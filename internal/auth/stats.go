@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// File access kinds recorded by RecordFileAccess
+const (
+	AccessDownload = "download"
+	AccessStream   = "stream"
+)
+
+// Metrics files can be ranked by in TopFiles
+const (
+	MetricDownloads = "downloads"
+	MetricStreams   = "streams"
+	MetricBytes     = "bytes"
+)
+
+// statDay is the day bucket an access at t is counted in
+func statDay(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// RecordFileAccess adds bytes served to today's counters of a file. started counts
+// the request as a new download or stream, resumed and seeking requests only add
+// their bytes.
+func (dm *DatabaseManager) RecordFileAccess(fileID, kind string, started bool, bytes int64) error {
+	stat := FileAccessStat{FileID: fileID, Day: statDay(time.Now()), Bytes: bytes}
+	updates := map[string]interface{}{
+		"bytes": gorm.Expr("bytes + ?", bytes),
+	}
+	if started {
+		switch kind {
+		case AccessDownload:
+			stat.Downloads = 1
+			updates["downloads"] = gorm.Expr("downloads + 1")
+		case AccessStream:
+			stat.Streams = 1
+			updates["streams"] = gorm.Expr("streams + 1")
+		default:
+			return fmt.Errorf("unknown access kind: %s", kind)
+		}
+	}
+
+	return dm.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "file_id"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(updates),
+	}).Create(&stat).Error
+}
+
+// TopFile is a file with its access counters summed over a period
+type TopFile struct {
+	FileID    string `json:"file_id"`
+	Filename  string `json:"filename"`
+	UserID    uint   `json:"owner_id"`
+	Downloads int64  `json:"downloads"`
+	Streams   int64  `json:"streams"`
+	Bytes     int64  `json:"bytes"`
+}
+
+// TopFiles ranks files by metric over the days since the given time, most accessed
+// first. A non-zero userID limits the ranking to that user's files.
+func (dm *DatabaseManager) TopFiles(metric string, since time.Time, userID uint, limit int) ([]TopFile, error) {
+	switch metric {
+	case MetricDownloads, MetricStreams, MetricBytes:
+	default:
+		return nil, fmt.Errorf("unknown metric: %s", metric)
+	}
+
+	query := dm.db.Table("file_access_stats AS s").
+		Select("s.file_id, f.filename, f.user_id, SUM(s.downloads) AS downloads, SUM(s.streams) AS streams, SUM(s.bytes) AS bytes").
+		Joins("LEFT JOIN file_ownerships AS f ON f.file_id = s.file_id").
+		Where("s.day >= ?", statDay(since))
+	if userID != 0 {
+		query = query.Where("f.user_id = ?", userID)
+	}
+
+	var files []TopFile
+	err := query.Group("s.file_id, f.filename, f.user_id").
+		Having(fmt.Sprintf("SUM(s.%s) > 0", metric)).
+		Order(fmt.Sprintf("%s DESC, s.file_id", metric)).
+		Limit(limit).
+		Scan(&files).Error
+	return files, err
+}
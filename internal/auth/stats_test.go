@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTopFiles(t *testing.T) {
+	dm := newTestDatabase(t)
+	owner := newTestUser(t, dm, "owner@example.com")
+	other := newTestUser(t, dm, "other@example.com")
+	for _, f := range []struct {
+		user *User
+		id   string
+	}{{owner, "file1"}, {owner, "file2"}, {other, "file3"}} {
+		if err := dm.CreateFileOwnership(f.user.ID, f.id, f.id+".mp4", "union", 100, "video/mp4"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	record := func(fileID, kind string, started bool, bytes int64) {
+		t.Helper()
+		if err := dm.RecordFileAccess(fileID, kind, started, bytes); err != nil {
+			t.Fatal(err)
+		}
+	}
+	record("file1", AccessDownload, true, 100)
+	record("file1", AccessDownload, false, 50) // a resumed download only adds bytes
+	record("file2", AccessDownload, true, 10)
+	record("file2", AccessDownload, true, 10)
+	record("file3", AccessStream, true, 500)
+
+	since := time.Now().Add(-24 * time.Hour)
+	files, err := dm.TopFiles(MetricDownloads, since, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].FileID != "file2" || files[0].Downloads != 2 || files[1].FileID != "file1" || files[1].Bytes != 150 {
+		t.Errorf("by downloads: got %+v", files)
+	}
+
+	files, _ = dm.TopFiles(MetricBytes, since, 0, 1)
+	if len(files) != 1 || files[0].FileID != "file3" || files[0].Filename != "file3.mp4" || files[0].UserID != other.ID {
+		t.Errorf("by bytes: got %+v, want file3 alone", files)
+	}
+
+	files, _ = dm.TopFiles(MetricStreams, since, owner.ID, 10)
+	if len(files) != 0 {
+		t.Errorf("owner's streams: got %+v, want none", files)
+	}
+
+	if files, _ := dm.TopFiles(MetricDownloads, time.Now().Add(48*time.Hour), 0, 10); len(files) != 0 {
+		t.Errorf("future period: got %+v, want none", files)
+	}
+	if _, err := dm.TopFiles("likes", since, 0, 10); err == nil {
+		t.Error("got no error for an unknown metric")
+	}
+	if err := dm.RecordFileAccess("file1", "print", true, 1); err == nil {
+		t.Error("got no error for an unknown access kind")
+	}
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestUpdateUser(t *testing.T) {
+	am := newTestAuth(t)
+	dm := am.DatabaseManager
+	admin, err := dm.GetUserByEmail("admin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := newTestUser(t, dm, "owner@example.com")
+	path := fmt.Sprintf("/api/admin/users/%d", user.ID)
+
+	wantStatus(t, do(t, am, http.MethodPatch, path, admin, `{"role": "readonly", "storage_quota": 500}`), http.StatusOK)
+	updated, _ := dm.GetUserByID(user.ID)
+	if updated.Role != RoleReadOnly || updated.StorageQuota != 500 || !updated.IsActive {
+		t.Errorf("got role %s, quota %d, active %v, want readonly, 500, active", updated.Role, updated.StorageQuota, updated.IsActive)
+	}
+	if updated.TokenVersion == user.TokenVersion {
+		t.Error("role change didn't revoke the user's tokens")
+	}
+
+	wantStatus(t, do(t, am, http.MethodPatch, path, admin, `{"is_active": false}`), http.StatusOK)
+	if updated, _ := dm.GetUserByID(user.ID); updated.IsActive {
+		t.Error("user still active")
+	}
+	wantStatus(t, do(t, am, http.MethodPatch, path, admin, `{"is_active": true}`), http.StatusOK)
+	if updated, _ := dm.GetUserByID(user.ID); !updated.IsActive {
+		t.Error("user not reactivated")
+	}
+
+	for _, body := range []string{`{"role": "owner"}`, `{"storage_quota": -2}`} {
+		wantStatus(t, do(t, am, http.MethodPatch, path, admin, body), http.StatusBadRequest)
+	}
+	wantStatus(t, do(t, am, http.MethodPatch, "/api/admin/users/999", admin, `{}`), http.StatusNotFound)
+	updated, _ = dm.GetUserByID(user.ID)
+	wantStatus(t, do(t, am, http.MethodPatch, path, updated, `{"role": "admin"}`), http.StatusForbidden)
+}
+
+func TestUpdateUserKeepsLastAdmin(t *testing.T) {
+	am := newTestAuth(t)
+	dm := am.DatabaseManager
+	admin, err := dm.GetUserByEmail("admin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := fmt.Sprintf("/api/admin/users/%d", admin.ID)
+
+	for _, body := range []string{`{"role": "user"}`, `{"is_active": false}`} {
+		wantStatus(t, do(t, am, http.MethodPatch, path, admin, body), http.StatusConflict)
+	}
+
+	// With a second admin the first can step down
+	second, err := dm.CreateUser("second@example.com", "Admin-Passw0rd!", RoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantStatus(t, do(t, am, http.MethodPatch, path, second, `{"role": "user"}`), http.StatusOK)
+}
+
+func TestUpdateUserAccountKeepsOtherColumns(t *testing.T) {
+	dm := newTestAuth(t).DatabaseManager
+	user := newTestUser(t, dm, "owner@example.com")
+	// Usage changed by an upload after the user was loaded
+	if err := dm.db.Model(&User{}).Where("id = ?", user.ID).Update("storage_used", 40).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	quota := int64(500)
+	updated, err := dm.UpdateUserAccount(user.ID, UpdateUserRequest{StorageQuota: &quota})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.StorageQuota != 500 || updated.StorageUsed != 40 || updated.Role != RoleUser {
+		t.Errorf("got quota %d, used %d, role %s, want 500, 40, user", updated.StorageQuota, updated.StorageUsed, updated.Role)
+	}
+	if updated.TokenVersion != user.TokenVersion {
+		t.Error("a quota change revoked the user's tokens")
+	}
+
+	if _, err := dm.UpdateUserAccount(999, UpdateUserRequest{StorageQuota: &quota}); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("unknown user: got %v, want record not found", err)
+	}
+}
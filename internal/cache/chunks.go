@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// ChunkSize is the block size byte ranges are cached in. Chunk i holds bytes
+// i*ChunkSize up to (i+1)*ChunkSize-1, the last chunk of a file may be shorter.
+const ChunkSize int64 = 4 << 20
+
+// chunkKey returns the cache key of a chunk of the file cached under key. Chunks are
+// ordinary entries, so expiry, validators and eviction apply to them as to whole files.
+func chunkKey(key string, index int64) string {
+	return fmt.Sprintf("%s#chunk-%d", key, index)
+}
+
+// PutChunk stores chunk index of the file cached under key, see ChunkSize
+func (m *Manager) PutChunk(ctx context.Context, key, validator string, index int64, reader io.Reader, size int64) (*CacheEntry, error) {
+	return m.PutValidated(ctx, chunkKey(key, index), validator, reader, size)
+}
+
+// GetRange returns bytes start-end of the file cached under key when every chunk
+// covering them is cached for validator, see GetValidated. A chunk evicted while the
+// range is read fails the read.
+func (m *Manager) GetRange(ctx context.Context, key, validator string, start, end int64) (io.ReadCloser, error) {
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("invalid range %d-%d", start, end)
+	}
+
+	for index := start / ChunkSize; index <= end/ChunkSize; index++ {
+		if !m.Has(chunkKey(key, index), validator) {
+			m.misses.Add(1)
+			return nil, fmt.Errorf("cache miss for range %d-%d of key: %s", start, end, key)
+		}
+	}
+
+	return &rangeReader{
+		ctx:       ctx,
+		m:         m,
+		key:       key,
+		validator: validator,
+		index:     start / ChunkSize,
+		skip:      start % ChunkSize,
+		remaining: end - start + 1,
+	}, nil
+}
+
+// DeleteChunks removes every cached chunk of the file cached under key
+func (m *Manager) DeleteChunks(ctx context.Context, key string) {
+	m.mu.RLock()
+	entries := m.entries()
+	m.mu.RUnlock()
+
+	prefix := key + "#chunk-"
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.OriginalKey, prefix) {
+			if err := m.Delete(ctx, entry.OriginalKey); err != nil {
+				m.logger.Warnf("Failed to remove cached chunk %s: %v", entry.OriginalKey, err)
+			}
+		}
+	}
+}
+
+// Has reports whether an unexpired entry stored for validator is cached under key,
+// without counting a lookup
+func (m *Manager) Has(key, validator string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	cacheKey := m.generateCacheKey(key)
+	entry, found := (*CacheEntry)(nil), false
+	if item, ok := m.metadata.Get(cacheKey); ok {
+		entry, found = item.(*CacheEntry), true
+		if _, err := os.Stat(entry.FilePath); err != nil {
+			return false
+		}
+	} else if entry, found = m.diskEntry(cacheKey); found && time.Since(entry.CreatedAt) > m.ttl {
+		return false
+	}
+
+	return found && (validator == "" || entry.Validator == "" || entry.Validator == validator)
+}
+
+// rangeReader reads a byte range across consecutive chunks, opening each as it is reached
+type rangeReader struct {
+	ctx       context.Context
+	m         *Manager
+	key       string
+	validator string
+
+	index     int64 // chunk read next
+	skip      int64 // bytes to skip at the start of that chunk
+	remaining int64
+	current   io.ReadCloser
+}
+
+func (r *rangeReader) Read(p []byte) (int, error) {
+	for r.remaining > 0 {
+		if r.current == nil {
+			reader, _, err := r.m.GetValidated(r.ctx, chunkKey(r.key, r.index), r.validator)
+			if err != nil {
+				return 0, fmt.Errorf("chunk %d of %s is no longer cached: %w", r.index, r.key, err)
+			}
+			if r.skip > 0 {
+				if _, err := reader.(io.Seeker).Seek(r.skip, io.SeekStart); err != nil {
+					reader.Close()
+					return 0, err
+				}
+				r.skip = 0
+			}
+			r.current = reader
+		}
+
+		if int64(len(p)) > r.remaining {
+			p = p[:r.remaining]
+		}
+		n, err := r.current.Read(p)
+		r.remaining -= int64(n)
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+			r.index++
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+	return 0, io.EOF
+}
+
+func (r *rangeReader) Close() error {
+	if r.current != nil {
+		return r.current.Close()
+	}
+	return nil
+}
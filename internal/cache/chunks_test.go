@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+)
+
+func TestGetRangeAcrossChunks(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t, 1<<30)
+	data := bytes.Repeat([]byte("abcdefgh"), int(ChunkSize/8)+2)
+	for index, chunk := range [][]byte{data[:ChunkSize], data[ChunkSize:]} {
+		if _, err := m.PutChunk(ctx, "file", "v1", int64(index), bytes.NewReader(chunk), int64(len(chunk))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start, end := ChunkSize-5, ChunkSize+9
+	reader, err := m.GetRange(ctx, "file", "v1", start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil || !bytes.Equal(got, data[start:end+1]) {
+		t.Errorf("got %q (%v), want %q", got, err, data[start:end+1])
+	}
+
+	if _, err := m.GetRange(ctx, "file", "v2", start, end); err == nil {
+		t.Error("range served for another validator")
+	}
+	if _, err := m.GetRange(ctx, "file", "v1", start, 2*ChunkSize); err == nil {
+		t.Error("range served with a chunk missing")
+	}
+
+	m.DeleteChunks(ctx, "file")
+	if m.Has(chunkKey("file", 0), "") || m.Has(chunkKey("file", 1), "") {
+		t.Error("chunks left after DeleteChunks")
+	}
+}
@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// cachedFiles counts the files in the cache directory of m
+func cachedFiles(t *testing.T, m *Manager) int {
+	t.Helper()
+	files, err := os.ReadDir(filepath.Join(m.cacheDir, "files"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(files)
+}
+
+func TestCleanupSweepsExpiredEntries(t *testing.T) {
+	m, err := NewManager(t.TempDir(), 50*time.Millisecond, 1<<20, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.logger.SetOutput(io.Discard)
+	defer m.Close()
+
+	put(t, m, "key", "hello")
+	deadline := time.Now().Add(2 * time.Second)
+	for cachedFiles(t, m) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expired entry was never swept")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCloseStopsCleanup(t *testing.T) {
+	m, err := NewManager(t.TempDir(), 30*time.Millisecond, 1<<20, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.logger.SetOutput(io.Discard)
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal("second Close:", err)
+	}
+
+	put(t, m, "key", "hello")
+	time.Sleep(150 * time.Millisecond)
+	if cachedFiles(t, m) != 1 {
+		t.Error("entry swept after Close")
+	}
+}
+
+func TestCleanupIntervalDefaultsToHalfTTL(t *testing.T) {
+	m := newTestManager(t, 1<<20)
+	if m.cleanupInterval != 30*time.Minute {
+		t.Errorf("cleanup interval %v, want 30m for a 1h TTL", m.cleanupInterval)
+	}
+}
+
+func TestPurgeExpired(t *testing.T) {
+	m, err := NewManager(t.TempDir(), 50*time.Millisecond, 1<<20, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.logger.SetOutput(io.Discard)
+	defer m.Close()
+
+	put(t, m, "old", "hello")
+	time.Sleep(80 * time.Millisecond)
+	put(t, m, "new", "world!")
+
+	purged, freed := m.PurgeExpired()
+	if purged != 1 || freed != 5 {
+		t.Errorf("purged %d entries of %d bytes, want 1 of 5", purged, freed)
+	}
+	entries := m.Entries()
+	if len(entries) != 1 || entries[0].OriginalKey != "new" {
+		t.Errorf("entries %+v, want only new", entries)
+	}
+	if cachedFiles(t, m) != 1 {
+		t.Errorf("%d cached files left, want 1", cachedFiles(t, m))
+	}
+}
+
+func TestPurgeStaleTemp(t *testing.T) {
+	m := newTestManager(t, 0)
+	dir := filepath.Join(m.cacheDir, "temp")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, age := range map[string]time.Duration{"abandoned": 48 * time.Hour, "in-flight": time.Minute} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("partial"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		modTime := time.Now().Add(-age)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if purged, freed := m.PurgeStaleTemp(24 * time.Hour); purged != 1 || freed != int64(len("partial")) {
+		t.Errorf("purged %d files, %d bytes, want 1 file of 7 bytes", purged, freed)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "abandoned")); !os.IsNotExist(err) {
+		t.Error("stale temp file was kept")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "in-flight")); err != nil {
+		t.Errorf("recent temp file was removed: %v", err)
+	}
+}
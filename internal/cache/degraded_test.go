@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// breakWrites replaces the temp directory of m with a file, so staging fails even as root
+func breakWrites(t *testing.T, m *Manager) (restore func()) {
+	t.Helper()
+	temp := filepath.Join(m.cacheDir, "temp")
+	if err := os.RemoveAll(temp); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(temp, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		os.Remove(temp)
+		if err := os.MkdirAll(temp, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDegradedAfterConsecutiveWriteFailures(t *testing.T) {
+	m := newTestManager(t, 1<<20)
+	m.SetDegradedThreshold(2)
+	restore := breakWrites(t, m)
+
+	_, err := m.Put(context.Background(), "a", strings.NewReader("data"), 4)
+	if !errors.Is(err, ErrWriteFailed) {
+		t.Fatalf("got %v, want ErrWriteFailed", err)
+	}
+	if m.Degraded() {
+		t.Error("degraded after one failure, want two")
+	}
+	m.Put(context.Background(), "a", strings.NewReader("data"), 4)
+	if !m.Degraded() {
+		t.Error("not degraded after two failures")
+	}
+	if stats := m.GetStats(); stats["degraded"] != true || stats["write_failures"] != 2 {
+		t.Errorf("got stats degraded %v after %v failures", stats["degraded"], stats["write_failures"])
+	}
+
+	restore()
+	put(t, m, "a", "data")
+	if m.Degraded() {
+		t.Error("still degraded after a successful write")
+	}
+}
+
+func TestReaderErrorsDontDegrade(t *testing.T) {
+	m := newTestManager(t, 1<<20)
+	m.SetDegradedThreshold(1)
+
+	reader := &failingReader{err: errors.New("provider went away")}
+	_, err := m.Put(context.Background(), "a", reader, 4)
+	if err == nil || errors.Is(err, ErrWriteFailed) {
+		t.Errorf("got %v, want the reader's error", err)
+	}
+	if m.Degraded() {
+		t.Error("a failing source degraded the cache")
+	}
+}
+
+type failingReader struct{ err error }
+
+func (r *failingReader) Read([]byte) (int, error) { return 0, r.err }
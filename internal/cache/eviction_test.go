@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// cached reports whether key is in the cache, without counting as an access
+func cached(m *Manager, key string) bool {
+	_, ok := m.metadata.Get(m.generateCacheKey(key))
+	return ok
+}
+
+func TestEvictionPolicies(t *testing.T) {
+	tests := []struct {
+		policy string
+		reads  []string
+		victim string
+	}{
+		{EvictLRU, []string{"a", "a", "b", "c"}, "a"},
+		{EvictLRU, []string{"b", "c", "a"}, "b"},
+		{EvictLFU, []string{"a", "a", "b", "c"}, "b"},
+		{EvictFIFO, []string{"b", "c", "a"}, "a"},
+	}
+	for _, tt := range tests {
+		m := newTestManager(t, 12)
+		if err := m.SetEvictionPolicy(tt.policy); err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range []string{"a", "b", "c"} {
+			put(t, m, key, "four")
+			time.Sleep(time.Millisecond)
+		}
+		for _, key := range tt.reads {
+			read(t, m, key)
+			time.Sleep(time.Millisecond)
+		}
+
+		put(t, m, "d", "four")
+		for _, key := range []string{"a", "b", "c", "d"} {
+			if want := key != tt.victim; cached(m, key) != want {
+				t.Errorf("%s after reading %v: %s cached %v, want %v", tt.policy, tt.reads, key, !want, want)
+			}
+		}
+	}
+}
+
+func TestEvictionRejectsOversizedEntry(t *testing.T) {
+	m := newTestManager(t, 8)
+	put(t, m, "a", "four")
+	if _, err := m.Put(context.Background(), "big", strings.NewReader("larger than the cache"), 21); err == nil {
+		t.Error("cached an entry larger than the whole cache")
+	}
+	if !cached(m, "a") {
+		t.Error("evicted entries for an entry that can never fit")
+	}
+}
+
+func TestSetEvictionPolicy(t *testing.T) {
+	m := newTestManager(t, 8)
+	if err := m.SetEvictionPolicy("LFU"); err != nil || m.Stats()["eviction_policy"] != EvictLFU {
+		t.Errorf("got %v with policy %v, want lfu", err, m.Stats()["eviction_policy"])
+	}
+	if err := m.SetEvictionPolicy("random"); err == nil {
+		t.Error("got no error for an unknown policy")
+	}
+}
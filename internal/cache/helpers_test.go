@@ -0,0 +1,44 @@
+package cache
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestManager opens a cache of maxSize bytes in a temporary directory
+func newTestManager(t *testing.T, maxSize int64) *Manager {
+	t.Helper()
+	m, err := NewManager(t.TempDir(), time.Hour, maxSize, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.logger.SetOutput(io.Discard)
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+// put caches data under key
+func put(t *testing.T, m *Manager, key, data string) {
+	t.Helper()
+	if _, err := m.Put(context.Background(), key, strings.NewReader(data), int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// read returns the cached content of key
+func read(t *testing.T, m *Manager, key string) string {
+	t.Helper()
+	reader, _, err := m.Get(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
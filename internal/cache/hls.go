@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// HLSDir returns the directory HLS output of a file is kept in. It isn't an entry,
+// PurgeExpiredHLS removes it once it hasn't been written to for the TTL.
+func (m *Manager) HLSDir(fileID string) string {
+	return filepath.Join(m.cacheDir, "hls", fileID)
+}
+
+// PurgeExpiredHLS removes the HLS output directories older than the TTL and returns
+// how many were removed
+func (m *Manager) PurgeExpiredHLS() int {
+	dirs, err := os.ReadDir(filepath.Join(m.cacheDir, "hls"))
+	if err != nil {
+		return 0
+	}
+
+	var purged int
+	for _, dir := range dirs {
+		info, err := dir.Info()
+		if err != nil || !dir.IsDir() || time.Since(info.ModTime()) <= m.ttl {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(m.cacheDir, "hls", dir.Name())); err != nil {
+			m.logger.Warnf("Failed to remove expired HLS output %s: %v", dir.Name(), err)
+			continue
+		}
+		purged++
+		m.logger.Infof("Removed expired HLS output: %s", dir.Name())
+	}
+	return purged
+}
+
+// clearHLS removes all HLS output
+func (m *Manager) clearHLS() error {
+	if err := os.RemoveAll(filepath.Join(m.cacheDir, "hls")); err != nil {
+		return fmt.Errorf("failed to remove HLS output: %w", err)
+	}
+	return nil
+}
@@ -3,11 +3,16 @@ package cache
 import (
 	"context"
 	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/patrickmn/go-cache"
@@ -19,12 +24,51 @@ type Manager struct {
 	cacheDir    string
 	ttl         time.Duration
 	maxSize     int64
+	maxEntry    int64 // 0 means no per-entry limit
 	currentSize int64
 	metadata    *cache.Cache
 	mu          sync.RWMutex
 	logger      *logrus.Logger
+
+	// Which entries ensureSpace evicts first when the cache is full
+	evictionPolicy string
+
+	cleanupInterval time.Duration
+	done            chan struct{}
+	closeOnce       sync.Once
+
+	// Consecutive failed writes, e.g. on a read-only or full filesystem. The cache
+	// reports itself degraded once they reach degradedThreshold.
+	writeFailures     int
+	degradedThreshold int
+
+	// Lookups served from the cache and lookups that missed it
+	hits   atomic.Int64
+	misses atomic.Int64
+
+	// Fills being staged, by cache key, so readers can tail them with OpenPartial
+	fills   map[string]*fill
+	fillsMu sync.Mutex
 }
 
+// errStale is returned by get for an entry stored for other content
+var errStale = errors.New("stale cache entry")
+
+// ErrWriteFailed is wrapped by the errors Stage and Commit return when the cache
+// directory could not be written
+var ErrWriteFailed = errors.New("cache write failed")
+
+// Eviction policies
+const (
+	EvictLRU  = "lru"  // least recently accessed first
+	EvictLFU  = "lfu"  // least accessed first, ties broken by access time
+	EvictFIFO = "fifo" // oldest cached first
+)
+
+// DefaultDegradedThreshold is the number of consecutive write failures after which
+// the cache reports itself degraded
+const DefaultDegradedThreshold = 3
+
 // CacheEntry represents a cached file entry
 type CacheEntry struct {
 	FilePath    string    `json:"file_path"`
@@ -33,10 +77,15 @@ type CacheEntry struct {
 	CreatedAt   time.Time `json:"created_at"`
 	AccessedAt  time.Time `json:"accessed_at"`
 	AccessCount int64     `json:"access_count"`
+
+	// Validator identifies the content the entry was stored for, e.g. the size and
+	// modification time of the cloud object, so a replaced file doesn't hit it
+	Validator string `json:"validator,omitempty"`
 }
 
-// NewManager creates a new cache manager
-func NewManager(cacheDir string, ttl time.Duration, maxSize int64) (*Manager, error) {
+// NewManager creates a new cache manager. Expired entries are swept every
+// cleanupInterval, or every TTL/2 when cleanupInterval is zero.
+func NewManager(cacheDir string, ttl time.Duration, maxSize int64, cleanupInterval time.Duration) (*Manager, error) {
 	// Create cache directory if it doesn't exist
 	if err := os.MkdirAll(cacheDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create cache directory: %w", err)
@@ -49,17 +98,27 @@ func NewManager(cacheDir string, ttl time.Duration, maxSize int64) (*Manager, er
 		}
 	}
 
+	if cleanupInterval <= 0 {
+		cleanupInterval = ttl / 2
+	}
+
 	manager := &Manager{
-		cacheDir: cacheDir,
-		ttl:      ttl,
-		maxSize:  maxSize,
-		metadata: cache.New(ttl, ttl/2), // Cleanup every TTL/2
-		logger:   logrus.New(),
+		cacheDir:        cacheDir,
+		ttl:             ttl,
+		maxSize:         maxSize,
+		metadata:        cache.New(ttl, cleanupInterval),
+		logger:          logrus.New(),
+		cleanupInterval: cleanupInterval,
+		done:            make(chan struct{}),
+		evictionPolicy:  EvictLRU,
+
+		degradedThreshold: DefaultDegradedThreshold,
+		fills:             make(map[string]*fill),
 	}
 
-	// Calculate current cache size
-	if err := manager.calculateCurrentSize(); err != nil {
-		manager.logger.Warnf("Failed to calculate current cache size: %v", err)
+	// Pick up what previous runs cached, so stats are served from memory from the start
+	if err := manager.loadEntries(); err != nil {
+		manager.logger.Warnf("Failed to load cache entries: %v", err)
 	}
 
 	// Start cleanup goroutine
@@ -68,11 +127,101 @@ func NewManager(cacheDir string, ttl time.Duration, maxSize int64) (*Manager, er
 	return manager, nil
 }
 
-// Get retrieves a file from cache
-func (m *Manager) Get(ctx context.Context, key string) (io.ReadCloser, *CacheEntry, error) {
+// SetMaxEntrySize sets the largest file size accepted into the cache (0 = no limit)
+func (m *Manager) SetMaxEntrySize(size int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.maxEntry = size
+}
+
+// SetEvictionPolicy sets which entries are evicted first when the cache is full
+func (m *Manager) SetEvictionPolicy(policy string) error {
+	policy = strings.ToLower(policy)
+	switch policy {
+	case EvictLRU, EvictLFU, EvictFIFO:
+	default:
+		return fmt.Errorf("unknown eviction policy: %s", policy)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.evictionPolicy = policy
+	return nil
+}
+
+// SetDegradedThreshold sets how many consecutive write failures mark the cache degraded
+func (m *Manager) SetDegradedThreshold(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if n <= 0 {
+		n = DefaultDegradedThreshold
+	}
+	m.degradedThreshold = n
+}
+
+// Degraded reports whether recent writes to the cache directory keep failing.
+// Reads still work, but new files are served without being cached.
+func (m *Manager) Degraded() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.writeFailures >= m.degradedThreshold
+}
+
+// recordWrite tracks the outcome of a write to the cache directory
+func (m *Manager) recordWrite(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err == nil {
+		m.writeFailures = 0
+		return
+	}
+	m.writeFailures++
+	if m.writeFailures == m.degradedThreshold {
+		m.logger.Warnf("Cache degraded after %d consecutive write failures: %v", m.writeFailures, err)
+	}
+}
+
+// CanCache reports whether a file of the given size may be stored in the cache
+func (m *Manager) CanCache(size int64) bool {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
+	return m.maxEntry <= 0 || size <= m.maxEntry
+}
+
+// Get retrieves a file from cache
+func (m *Manager) Get(ctx context.Context, key string) (io.ReadCloser, *CacheEntry, error) {
+	return m.GetValidated(ctx, key, "")
+}
+
+// GetValidated retrieves a file from cache if the entry was stored for the content
+// validator identifies. An entry stored for other content means the file was
+// replaced, it is evicted and the lookup is a miss. Entries stored without a
+// validator adopt this one, and an empty validator accepts any entry.
+func (m *Manager) GetValidated(ctx context.Context, key, validator string) (io.ReadCloser, *CacheEntry, error) {
+	reader, entry, err := m.get(key, validator)
+	if errors.Is(err, errStale) {
+		m.logger.Infof("Evicting stale cache entry: %s", key)
+		if err := m.Delete(ctx, key); err != nil {
+			m.logger.Warnf("Failed to evict stale cache entry %s: %v", key, err)
+		}
+		return nil, nil, fmt.Errorf("cache miss for key: %s", key)
+	}
+	return reader, entry, err
+}
+
+// get does the lookup of GetValidated. It holds the write lock, as a hit updates the
+// entry's access time and count and validate may store a validator, and returns a
+// copy of the entry so callers never read it while another lookup updates it.
+func (m *Manager) get(key, validator string) (io.ReadCloser, *CacheEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	cacheKey := m.generateCacheKey(key)
 	
 	// Check if entry exists in metadata
@@ -81,6 +230,11 @@ func (m *Manager) Get(ctx context.Context, key string) (io.ReadCloser, *CacheEnt
 		
 		// Check if file still exists on disk
 		if _, err := os.Stat(entry.FilePath); err == nil {
+			if !m.validate(cacheKey, entry, validator) {
+				m.misses.Add(1)
+				return nil, nil, errStale
+			}
+
 			// Update access time and count
 			entry.AccessedAt = time.Now()
 			entry.AccessCount++
@@ -89,72 +243,219 @@ func (m *Manager) Get(ctx context.Context, key string) (io.ReadCloser, *CacheEnt
 			// Open file for reading
 			file, err := os.Open(entry.FilePath)
 			if err != nil {
+				m.misses.Add(1)
 				return nil, nil, fmt.Errorf("failed to open cached file: %w", err)
 			}
 			
-			return file, entry, nil
+			m.hits.Add(1)
+			snapshot := *entry
+			return file, &snapshot, nil
 		} else {
 			// File doesn't exist, remove from metadata
 			m.metadata.Delete(cacheKey)
 		}
 	}
+
+	// Entries written by another manager over the same directory are only known on disk
+	if entry, ok := m.diskEntry(cacheKey); ok && time.Since(entry.CreatedAt) <= m.ttl {
+		if !m.validate(cacheKey, entry, validator) {
+			m.misses.Add(1)
+			return nil, nil, errStale
+		}
+
+		file, err := os.Open(entry.FilePath)
+		if err != nil {
+			m.misses.Add(1)
+			return nil, nil, fmt.Errorf("failed to open cached file: %w", err)
+		}
+
+		m.hits.Add(1)
+		entry.OriginalKey = key
+		entry.AccessedAt = time.Now()
+		entry.AccessCount++
+		m.metadata.Set(cacheKey, entry, m.ttl-time.Since(entry.CreatedAt))
+
+		snapshot := *entry
+		return file, &snapshot, nil
+	}
 	
+	m.misses.Add(1)
 	return nil, nil, fmt.Errorf("cache miss for key: %s", key)
 }
 
+// validate reports whether an entry holds the content validator identifies. An
+// entry stored without a validator adopts it. Callers must hold the write lock.
+func (m *Manager) validate(cacheKey string, entry *CacheEntry, validator string) bool {
+	if validator == "" || entry.Validator == validator {
+		return true
+	}
+	if entry.Validator != "" {
+		return false
+	}
+	entry.Validator = validator
+	m.saveMetadata(cacheKey, entry)
+	return true
+}
+
 // Put stores a file in cache
 func (m *Manager) Put(ctx context.Context, key string, reader io.Reader, size int64) (*CacheEntry, error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	return m.PutValidated(ctx, key, "", reader, size)
+}
 
-	// Check if we need to free up space
-	if err := m.ensureSpace(size); err != nil {
-		return nil, fmt.Errorf("failed to ensure cache space: %w", err)
+// PutValidated stores a file in cache for the content validator identifies, see GetValidated
+func (m *Manager) PutValidated(ctx context.Context, key, validator string, reader io.Reader, size int64) (*CacheEntry, error) {
+	pending, err := m.Stage(ctx, key, reader, size)
+	if err != nil {
+		return nil, err
 	}
+	pending.SetValidator(validator)
+	return m.Commit(pending)
+}
 
-	cacheKey := m.generateCacheKey(key)
-	filePath := filepath.Join(m.cacheDir, "files", cacheKey)
-	
-	// Create temporary file first
-	tempPath := filepath.Join(m.cacheDir, "temp", cacheKey+".tmp")
-	tempFile, err := os.Create(tempPath)
+// PendingEntry is a file written to the cache that Get doesn't return until it is committed
+type PendingEntry struct {
+	key       string
+	tempPath  string
+	size      int64
+	validator string
+}
+
+// SetValidator sets the validator the entry is committed with
+func (p *PendingEntry) SetValidator(validator string) {
+	p.validator = validator
+}
+
+// Path returns the location of the staged file
+func (p *PendingEntry) Path() string {
+	return p.tempPath
+}
+
+// Size returns the number of bytes staged
+func (p *PendingEntry) Size() int64 {
+	return p.size
+}
+
+// Stage copies reader into a temporary cache file without making it visible, so it
+// can be discarded if whatever produced the data turns out to have failed
+func (m *Manager) Stage(ctx context.Context, key string, reader io.Reader, size int64) (*PendingEntry, error) {
+	m.mu.RLock()
+	maxEntry := m.maxEntry
+	m.mu.RUnlock()
+	if maxEntry > 0 && size > maxEntry {
+		return nil, fmt.Errorf("entry size %d exceeds max cache entry size %d", size, maxEntry)
+	}
+
+	tempFile, err := os.CreateTemp(filepath.Join(m.cacheDir, "temp"), m.generateCacheKey(key)+"-*.tmp")
 	if err != nil {
-		return nil, fmt.Errorf("failed to create temp file: %w", err)
+		err = fmt.Errorf("%w: failed to create temp file: %v", ErrWriteFailed, err)
+		m.recordWrite(err)
+		return nil, err
 	}
 	defer tempFile.Close()
 
-	// Copy data to temp file
-	written, err := io.Copy(tempFile, reader)
+	f := m.startFill(key, tempFile.Name())
+	defer m.endFill(key, f)
+
+	// Only failures writing the temp file count against the cache, not the reader's
+	dst := &fileWriter{file: tempFile, fill: f}
+	written, err := io.Copy(dst, reader)
+	if err == nil {
+		err = tempFile.Close()
+		dst.err = err
+	}
+	if err == nil && size > 0 && written != size {
+		f.finish(fmt.Errorf("incomplete fill: got %d of %d bytes", written, size))
+	} else {
+		f.finish(err)
+	}
 	if err != nil {
-		os.Remove(tempPath)
+		os.Remove(tempFile.Name())
+		if dst.err != nil {
+			err = fmt.Errorf("%w: failed to write to temp file: %v", ErrWriteFailed, err)
+			m.recordWrite(err)
+			return nil, err
+		}
 		return nil, fmt.Errorf("failed to write to temp file: %w", err)
 	}
 
+	return &PendingEntry{key: key, tempPath: tempFile.Name(), size: written}, nil
+}
+
+// fileWriter remembers the error of the last failed write to a cache file and
+// publishes the written bytes to readers tailing the fill
+type fileWriter struct {
+	file *os.File
+	fill *fill
+	err  error
+}
+
+func (w *fileWriter) Write(p []byte) (int, error) {
+	n, err := w.file.Write(p)
+	if err != nil {
+		w.err = err
+	}
+	w.fill.advance(int64(n))
+	return n, err
+}
+
+// Commit moves a staged file into the cache
+func (m *Manager) Commit(pending *PendingEntry) (*CacheEntry, error) {
+	entry, err := m.commit(pending)
+	if err == nil || errors.Is(err, ErrWriteFailed) {
+		m.recordWrite(err)
+	}
+	return entry, err
+}
+
+// commit does the work of Commit under the lock
+func (m *Manager) commit(pending *PendingEntry) (*CacheEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Check if we need to free up space
+	if err := m.ensureSpace(pending.size); err != nil {
+		os.Remove(pending.tempPath)
+		return nil, fmt.Errorf("failed to ensure cache space: %w", err)
+	}
+
+	cacheKey := m.generateCacheKey(pending.key)
+	filePath := filepath.Join(m.cacheDir, "files", cacheKey)
+
 	// Move temp file to final location
-	if err := os.Rename(tempPath, filePath); err != nil {
-		os.Remove(tempPath)
-		return nil, fmt.Errorf("failed to move temp file to cache: %w", err)
+	if err := os.Rename(pending.tempPath, filePath); err != nil {
+		os.Remove(pending.tempPath)
+		return nil, fmt.Errorf("%w: failed to move temp file to cache: %v", ErrWriteFailed, err)
 	}
 
 	// Create cache entry
 	entry := &CacheEntry{
 		FilePath:    filePath,
-		OriginalKey: key,
-		Size:        written,
+		OriginalKey: pending.key,
+		Size:        pending.size,
 		CreatedAt:   time.Now(),
 		AccessedAt:  time.Now(),
 		AccessCount: 1,
+		Validator:   pending.validator,
 	}
 
-	// Store in metadata
+	// Store in metadata, a replaced entry no longer takes up space
+	if item, found := m.metadata.Get(cacheKey); found {
+		m.currentSize -= item.(*CacheEntry).Size
+	}
 	m.metadata.Set(cacheKey, entry, m.ttl)
-	m.currentSize += written
+	m.currentSize += pending.size
+	m.saveMetadata(cacheKey, entry)
+
+	m.logger.Infof("Cached file: %s (size: %d bytes)", pending.key, pending.size)
 
-	m.logger.Infof("Cached file: %s (size: %d bytes)", key, written)
-	
 	return entry, nil
 }
 
+// Discard removes a staged file
+func (m *Manager) Discard(pending *PendingEntry) {
+	os.Remove(pending.tempPath)
+}
+
 // Delete removes a file from cache
 func (m *Manager) Delete(ctx context.Context, key string) error {
 	m.mu.Lock()
@@ -172,9 +473,22 @@ func (m *Manager) Delete(ctx context.Context, key string) error {
 		
 		// Remove from metadata
 		m.metadata.Delete(cacheKey)
+		os.Remove(m.metadataPath(cacheKey))
 		m.currentSize -= entry.Size
 		
 		m.logger.Infof("Removed cached file: %s", key)
+		return nil
+	}
+
+	// The entry may have been written by another manager
+	filePath := filepath.Join(m.cacheDir, "files", cacheKey)
+	if info, err := os.Stat(filePath); err == nil {
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove cached file: %w", err)
+		}
+		os.Remove(m.metadataPath(cacheKey))
+		m.currentSize -= info.Size()
+		m.logger.Infof("Removed cached file: %s", key)
 	}
 	
 	return nil
@@ -196,6 +510,22 @@ func (m *Manager) Clear(ctx context.Context) error {
 		return fmt.Errorf("failed to recreate cache files directory: %w", err)
 	}
 
+	// Metadata of the removed files
+	metadataDir := filepath.Join(m.cacheDir, "metadata")
+	if err := os.RemoveAll(metadataDir); err != nil {
+		return fmt.Errorf("failed to remove cache metadata: %w", err)
+	}
+	if err := os.MkdirAll(metadataDir, 0755); err != nil {
+		return fmt.Errorf("failed to recreate cache metadata directory: %w", err)
+	}
+
+	if err := m.clearHLS(); err != nil {
+		return err
+	}
+	if err := m.clearThumbnails(); err != nil {
+		return err
+	}
+
 	// Clear metadata
 	m.metadata.Flush()
 	m.currentSize = 0
@@ -211,10 +541,14 @@ func (m *Manager) Stats() map[string]interface{} {
 	defer m.mu.RUnlock()
 
 	return map[string]interface{}{
-		"current_size": m.currentSize,
-		"max_size":     m.maxSize,
-		"item_count":   m.metadata.ItemCount(),
-		"hit_rate":     m.calculateHitRate(),
+		"current_size":    m.currentSize,
+		"max_size":        m.maxSize,
+		"item_count":      m.metadata.ItemCount(),
+		"hit_rate":        m.HitRate(),
+		"hits":            m.hits.Load(),
+		"misses":          m.misses.Load(),
+		"degraded":        m.writeFailures >= m.degradedThreshold,
+		"eviction_policy": m.evictionPolicy,
 	}
 }
 
@@ -224,71 +558,169 @@ func (m *Manager) generateCacheKey(key string) string {
 	return fmt.Sprintf("%x", hash)
 }
 
-// ensureSpace ensures there's enough space for a new file
+// ensureSpace ensures there's enough space for a new file. Callers must hold the lock.
 func (m *Manager) ensureSpace(requiredSize int64) error {
 	if m.currentSize+requiredSize <= m.maxSize {
 		return nil
 	}
+	if requiredSize > m.maxSize {
+		return fmt.Errorf("file of %d bytes is larger than the cache", requiredSize)
+	}
 
-	// Need to free up space - implement LRU eviction
-	return m.evictLRU(requiredSize)
+	// Need to free up space
+	return m.evict(requiredSize)
 }
 
-// evictLRU evicts least recently used files
-func (m *Manager) evictLRU(requiredSize int64) error {
-	// This is a simplified LRU implementation
-	// In production, you'd want a more sophisticated approach
-	
-	items := m.metadata.Items()
-	if len(items) == 0 {
+// evict removes entries in the order of the eviction policy until requiredSize fits
+func (m *Manager) evict(requiredSize int64) error {
+	entries := m.entries()
+	if len(entries) == 0 {
 		return fmt.Errorf("cache is full and no items to evict")
 	}
 
-	// Sort by access time and evict oldest
-	// TODO: Implement proper LRU sorting
-	
+	keys := make([]string, 0, len(entries))
+	for cacheKey := range entries {
+		keys = append(keys, cacheKey)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return m.evictsBefore(entries[keys[i]], entries[keys[j]])
+	})
+
+	for _, cacheKey := range keys {
+		if m.currentSize+requiredSize <= m.maxSize {
+			return nil
+		}
+
+		entry := entries[cacheKey]
+		if err := os.Remove(entry.FilePath); err != nil && !os.IsNotExist(err) {
+			m.logger.Warnf("Failed to evict cache file %s: %v", entry.FilePath, err)
+			continue
+		}
+		os.Remove(m.metadataPath(cacheKey))
+
+		m.metadata.Delete(cacheKey)
+		m.currentSize -= entry.Size
+
+		m.logger.Infof("Evicted cached file (%s): %s", m.evictionPolicy, entry.OriginalKey)
+	}
+
+	if m.currentSize+requiredSize > m.maxSize {
+		return fmt.Errorf("cache is full and no items to evict")
+	}
 	return nil
 }
 
-// calculateCurrentSize calculates the current cache size
-func (m *Manager) calculateCurrentSize() error {
-	var totalSize int64
-	
-	filesDir := filepath.Join(m.cacheDir, "files")
-	err := filepath.Walk(filesDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() {
-			totalSize += info.Size()
+// evictsBefore reports whether a should be evicted before b under the eviction policy
+func (m *Manager) evictsBefore(a, b *CacheEntry) bool {
+	switch m.evictionPolicy {
+	case EvictLFU:
+		if a.AccessCount != b.AccessCount {
+			return a.AccessCount < b.AccessCount
 		}
-		return nil
-	})
-	
+		return a.AccessedAt.Before(b.AccessedAt)
+	case EvictFIFO:
+		return a.CreatedAt.Before(b.CreatedAt)
+	default:
+		return a.AccessedAt.Before(b.AccessedAt)
+	}
+}
+
+// loadEntries calculates the current cache size and loads the unexpired entries on
+// disk into the in-memory metadata. Expired ones are left for PurgeExpired.
+func (m *Manager) loadEntries() error {
+	files, err := os.ReadDir(filepath.Join(m.cacheDir, "files"))
 	if err != nil {
 		return err
 	}
-	
+
+	var totalSize int64
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		entry, ok := m.diskEntry(file.Name())
+		if !ok {
+			continue
+		}
+		totalSize += entry.Size
+		if remaining := m.ttl - time.Since(entry.CreatedAt); remaining > 0 {
+			m.metadata.Set(file.Name(), entry, remaining)
+		}
+	}
+
 	m.currentSize = totalSize
 	return nil
 }
 
-// calculateHitRate calculates cache hit rate
-func (m *Manager) calculateHitRate() float64 {
-	// This is a placeholder - implement proper hit rate calculation
-	return 0.0
+// Recalculate resets the tracked cache size to the total size of the cached files on
+// disk, correcting drift after crashes or changes made outside the manager. It
+// returns the size tracked before and after.
+func (m *Manager) Recalculate() (int64, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	files, err := os.ReadDir(filepath.Join(m.cacheDir, "files"))
+	if err != nil {
+		return m.currentSize, m.currentSize, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+
+	var totalSize int64
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			// Removed since the directory was read
+			continue
+		}
+		totalSize += info.Size()
+	}
+
+	previous := m.currentSize
+	m.currentSize = totalSize
+	if previous != totalSize {
+		m.logger.Infof("Cache size recalculated: %d -> %d bytes", previous, totalSize)
+	}
+	return previous, totalSize, nil
+}
+
+// HitRate returns the share of Get calls served from the cache
+func (m *Manager) HitRate() float64 {
+	hits, misses := m.hits.Load(), m.misses.Load()
+	if hits+misses == 0 {
+		return 0.0
+	}
+	return float64(hits) / float64(hits+misses)
 }
 
-// startCleanupRoutine starts the background cleanup routine
+// startCleanupRoutine runs the background cleanup routine until Close is called
 func (m *Manager) startCleanupRoutine() {
-	ticker := time.NewTicker(m.ttl / 2)
+	if m.cleanupInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(m.cleanupInterval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		m.cleanupExpired()
+	for {
+		select {
+		case <-ticker.C:
+			m.cleanupExpired()
+		case <-m.done:
+			return
+		}
 	}
 }
 
+// Close stops the background cleanup routine. It is safe to call more than once.
+func (m *Manager) Close() error {
+	m.closeOnce.Do(func() {
+		close(m.done)
+	})
+	return nil
+}
+
 // GetStats returns detailed cache statistics
 func (m *Manager) GetStats() map[string]interface{} {
 	m.mu.RLock()
@@ -297,7 +729,7 @@ func (m *Manager) GetStats() map[string]interface{} {
 	items := m.metadata.Items()
 	var totalAccess int64
 	var oldestEntry, newestEntry time.Time
-	var hitCount, totalCount int64
+	var totalCount int64
 
 	for _, item := range items {
 		entry := item.Object.(*CacheEntry)
@@ -310,52 +742,326 @@ func (m *Manager) GetStats() map[string]interface{} {
 		if newestEntry.IsZero() || entry.CreatedAt.After(newestEntry) {
 			newestEntry = entry.CreatedAt
 		}
-		
-		if entry.AccessCount > 1 {
-			hitCount++
-		}
 	}
 
-	hitRate := 0.0
-	if totalCount > 0 {
-		hitRate = float64(hitCount) / float64(totalCount)
+	usagePercent := 0.0
+	if m.maxSize > 0 {
+		usagePercent = float64(m.currentSize) / float64(m.maxSize) * 100
 	}
 
 	return map[string]interface{}{
 		"current_size":    m.currentSize,
 		"max_size":        m.maxSize,
-		"usage_percent":   float64(m.currentSize) / float64(m.maxSize) * 100,
+		"usage_percent":   usagePercent,
 		"item_count":      totalCount,
 		"total_access":    totalAccess,
-		"hit_rate":        hitRate,
+		"hit_rate":        m.HitRate(),
+		"hits":            m.hits.Load(),
+		"misses":          m.misses.Load(),
 		"oldest_entry":    oldestEntry,
 		"newest_entry":    newestEntry,
 		"ttl_hours":       m.ttl.Hours(),
 		"cache_dir":       m.cacheDir,
+		"degraded":        m.writeFailures >= m.degradedThreshold,
+		"eviction_policy": m.evictionPolicy,
+		"write_failures":  m.writeFailures,
 	}
 }
 
 // cleanupExpired removes expired cache entries
 func (m *Manager) cleanupExpired() {
+	m.PurgeExpired()
+	m.PurgeExpiredHLS()
+	m.PurgeExpiredThumbnails()
+}
+
+// PurgeStaleTemp removes the files in the temp directory last written more than
+// maxAge ago: staged cache fills and uploads an earlier run left behind when it
+// crashed or the client never came back. It returns how many files and bytes
+// were removed. Run it before serving requests.
+func (m *Manager) PurgeStaleTemp(maxAge time.Duration) (int, int64) {
+	dir := filepath.Join(m.cacheDir, "temp")
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, 0
+	}
+
+	var purged int
+	var freed int64
+	for _, file := range files {
+		info, err := file.Info()
+		if err != nil || file.IsDir() || time.Since(info.ModTime()) <= maxAge {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, file.Name())); err != nil {
+			m.logger.Warnf("Failed to remove stale temp file %s: %v", file.Name(), err)
+			continue
+		}
+		purged++
+		freed += info.Size()
+	}
+	if purged > 0 {
+		m.logger.Infof("Removed %d stale temp files (%d bytes)", purged, freed)
+	}
+	return purged, freed
+}
+
+// PurgeExpired removes every expired entry in the cache directory, including those
+// written by other managers, and returns how many entries and bytes were freed
+func (m *Manager) PurgeExpired() (int, int64) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	items := m.metadata.Items()
-	for key, item := range items {
-		entry := item.Object.(*CacheEntry)
-		
+	var purged int
+	var freed int64
+	for cacheKey, entry := range m.entries() {
 		// Check if file is expired
-		if time.Since(entry.CreatedAt) > m.ttl {
-			// Remove file
-			if err := os.Remove(entry.FilePath); err != nil && !os.IsNotExist(err) {
-				m.logger.Warnf("Failed to remove expired cache file %s: %v", entry.FilePath, err)
-			}
-			
-			// Remove from metadata
-			m.metadata.Delete(key)
-			m.currentSize -= entry.Size
-			
-			m.logger.Infof("Removed expired cache file: %s", entry.OriginalKey)
+		if time.Since(entry.CreatedAt) <= m.ttl {
+			continue
+		}
+
+		// Remove file
+		if err := os.Remove(entry.FilePath); err != nil && !os.IsNotExist(err) {
+			m.logger.Warnf("Failed to remove expired cache file %s: %v", entry.FilePath, err)
+			continue
 		}
+		os.Remove(m.metadataPath(cacheKey))
+
+		// Remove from metadata
+		m.metadata.Delete(cacheKey)
+		m.currentSize -= entry.Size
+		purged++
+		freed += entry.Size
+
+		m.logger.Infof("Removed expired cache file: %s", entry.OriginalKey)
+	}
+
+	return purged, freed
+}
+
+// Entries returns the entries in the cache directory, most recently accessed first
+func (m *Manager) Entries() []CacheEntry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries := make([]CacheEntry, 0)
+	for _, entry := range m.entries() {
+		entries = append(entries, *entry)
 	}
-}
\ No newline at end of file
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].AccessedAt.After(entries[j].AccessedAt)
+	})
+
+	return entries
+}
+
+// Recent returns up to n of the entries held in memory, most recently cached first.
+// Unlike Entries it never reads the cache directory.
+func (m *Manager) Recent(n int) []CacheEntry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries := make([]CacheEntry, 0, m.metadata.ItemCount())
+	for _, item := range m.metadata.Items() {
+		entries = append(entries, *item.Object.(*CacheEntry))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.After(entries[j].CreatedAt)
+	})
+
+	if len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries
+}
+
+// entries collects the cached files on disk keyed by cache key, preferring the
+// in-memory metadata. Callers must hold the lock.
+func (m *Manager) entries() map[string]*CacheEntry {
+	entries := make(map[string]*CacheEntry)
+
+	files, err := os.ReadDir(filepath.Join(m.cacheDir, "files"))
+	if err != nil {
+		m.logger.Warnf("Failed to read cache directory: %v", err)
+		return entries
+	}
+
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		cacheKey := file.Name()
+		if item, found := m.metadata.Get(cacheKey); found {
+			entries[cacheKey] = item.(*CacheEntry)
+		} else if entry, ok := m.diskEntry(cacheKey); ok {
+			entries[cacheKey] = entry
+		}
+	}
+
+	return entries
+}
+
+// diskEntry rebuilds an entry from the cached file and its metadata file, falling
+// back to the file's modification time when no metadata was written
+func (m *Manager) diskEntry(cacheKey string) (*CacheEntry, bool) {
+	filePath := filepath.Join(m.cacheDir, "files", cacheKey)
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, false
+	}
+
+	entry := &CacheEntry{
+		CreatedAt:  info.ModTime(),
+		AccessedAt: info.ModTime(),
+	}
+	if data, err := os.ReadFile(m.metadataPath(cacheKey)); err == nil {
+		json.Unmarshal(data, entry)
+	}
+	entry.FilePath = filePath
+	entry.Size = info.Size()
+
+	return entry, true
+}
+
+// metadataPath returns where an entry's metadata is persisted
+func (m *Manager) metadataPath(cacheKey string) string {
+	return filepath.Join(m.cacheDir, "metadata", cacheKey+".json")
+}
+
+// saveMetadata persists an entry's metadata so other managers over the same directory
+// can list and expire it
+func (m *Manager) saveMetadata(cacheKey string, entry *CacheEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(m.metadataPath(cacheKey), data, 0644); err != nil {
+		m.logger.Warnf("Failed to write cache metadata for %s: %v", entry.OriginalKey, err)
+	}
+}
+
+// fill tracks how much of a staged file has been written, so readers never read
+// past it. A nil fill ignores updates.
+type fill struct {
+	path    string
+	mu      sync.Mutex
+	cond    *sync.Cond
+	written int64
+	done    bool
+	err     error
+}
+
+func (f *fill) advance(n int64) {
+	if f == nil || n == 0 {
+		return
+	}
+	f.mu.Lock()
+	f.written += n
+	f.mu.Unlock()
+	f.cond.Broadcast()
+}
+
+// finish marks the fill complete, err makes readers fail once they reach the end
+// of what was written
+func (f *fill) finish(err error) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	f.done = true
+	f.err = err
+	f.mu.Unlock()
+	f.cond.Broadcast()
+}
+
+// startFill registers the fill of key unless another one is already running
+func (m *Manager) startFill(key, path string) *fill {
+	m.fillsMu.Lock()
+	defer m.fillsMu.Unlock()
+
+	cacheKey := m.generateCacheKey(key)
+	if _, running := m.fills[cacheKey]; running {
+		return nil
+	}
+	f := &fill{path: path}
+	f.cond = sync.NewCond(&f.mu)
+	m.fills[cacheKey] = f
+	return f
+}
+
+// endFill unregisters a fill started by startFill
+func (m *Manager) endFill(key string, f *fill) {
+	if f == nil {
+		return
+	}
+	m.fillsMu.Lock()
+	defer m.fillsMu.Unlock()
+
+	cacheKey := m.generateCacheKey(key)
+	if m.fills[cacheKey] == f {
+		delete(m.fills, cacheKey)
+	}
+}
+
+// ErrNoFill is returned by OpenPartial when no fill of the key is in progress
+var ErrNoFill = errors.New("no cache fill in progress")
+
+// OpenPartial opens the file currently being staged for key. Reads return what has
+// been written so far and block for more until the fill completes, so concurrent
+// requests can share a single fetch. A fill that fails or comes up short makes the
+// reader return its error instead of io.EOF.
+func (m *Manager) OpenPartial(key string) (io.ReadCloser, error) {
+	m.fillsMu.Lock()
+	f, ok := m.fills[m.generateCacheKey(key)]
+	m.fillsMu.Unlock()
+	if !ok {
+		return nil, ErrNoFill
+	}
+
+	file, err := os.Open(f.path)
+	if err != nil {
+		// The fill finished and its temp file was moved or removed in the meantime
+		return nil, ErrNoFill
+	}
+
+	return &partialReader{file: file, fill: f}, nil
+}
+
+// partialReader tails a staged file up to the fill's written offset
+type partialReader struct {
+	file   *os.File
+	fill   *fill
+	offset int64
+}
+
+func (r *partialReader) Read(p []byte) (int, error) {
+	f := r.fill
+	f.mu.Lock()
+	for r.offset >= f.written && !f.done {
+		f.cond.Wait()
+	}
+	available := f.written - r.offset
+	fillErr := f.err
+	f.mu.Unlock()
+
+	if available <= 0 {
+		if fillErr != nil {
+			return 0, fillErr
+		}
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > available {
+		p = p[:available]
+	}
+	n, err := r.file.Read(p)
+	r.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (r *partialReader) Close() error {
+	return r.file.Close()
+}
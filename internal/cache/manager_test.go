@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMaxEntrySize(t *testing.T) {
+	m := newTestManager(t, 1<<20)
+	m.SetMaxEntrySize(4)
+
+	if !m.CanCache(4) || m.CanCache(5) {
+		t.Errorf("CanCache(4) = %v, CanCache(5) = %v, want true, false", m.CanCache(4), m.CanCache(5))
+	}
+	if _, err := m.Put(context.Background(), "big", strings.NewReader("hello"), 5); err == nil {
+		t.Error("entry over the max size was cached")
+	}
+	if _, _, err := m.Get(context.Background(), "big"); err == nil {
+		t.Error("entry over the max size is served")
+	}
+	put(t, m, "small", "hey!")
+	if got := read(t, m, "small"); got != "hey!" {
+		t.Errorf("got %q", got)
+	}
+
+	m.SetMaxEntrySize(0)
+	if !m.CanCache(1 << 30) {
+		t.Error("no limit still refuses large entries")
+	}
+}
+
+func TestUsagePercentWithoutMaxSize(t *testing.T) {
+	m := newTestManager(t, 0)
+	if got := m.GetStats()["usage_percent"]; got != 0.0 {
+		t.Errorf("usage_percent = %v, want 0 without a max size", got)
+	}
+}
+
+func TestHitRate(t *testing.T) {
+	m := newTestManager(t, 1<<20)
+	if m.HitRate() != 0 {
+		t.Errorf("got %v before any lookup, want 0", m.HitRate())
+	}
+
+	put(t, m, "a", "data")
+	read(t, m, "a")
+	read(t, m, "a")
+	read(t, m, "a")
+	if _, _, err := m.Get(context.Background(), "missing"); err == nil {
+		t.Fatal("got a missing key")
+	}
+
+	stats := m.GetStats()
+	if stats["hits"] != int64(3) || stats["misses"] != int64(1) || m.HitRate() != 0.75 {
+		t.Errorf("got %v hits, %v misses, rate %v, want 3, 1, 0.75", stats["hits"], stats["misses"], m.HitRate())
+	}
+}
+
+func TestRecalculate(t *testing.T) {
+	m := newTestManager(t, 1<<20)
+	put(t, m, "a", "hello")
+	put(t, m, "b", "world!")
+
+	// A cached file removed behind the manager's back
+	entry, ok := m.metadata.Get(m.generateCacheKey("a"))
+	if !ok {
+		t.Fatal("entry a is missing")
+	}
+	if err := os.Remove(entry.(*CacheEntry).FilePath); err != nil {
+		t.Fatal(err)
+	}
+
+	previous, current, err := m.Recalculate()
+	if err != nil || previous != 11 || current != 6 {
+		t.Errorf("got %d -> %d, %v, want 11 -> 6", previous, current, err)
+	}
+	if got := m.GetStats()["current_size"]; got != int64(6) {
+		t.Errorf("current_size = %v, want 6", got)
+	}
+}
@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// stageAsync stages key from a pipe in the background and returns the pipe's writer
+// and the outcome of Stage
+func stageAsync(t *testing.T, m *Manager, key string, size int64) (*io.PipeWriter, <-chan error) {
+	t.Helper()
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		pending, err := m.Stage(context.Background(), key, pr, size)
+		if err == nil {
+			m.Discard(pending)
+		}
+		done <- err
+	}()
+	return pw, done
+}
+
+// openPartial waits for the fill of key to start and opens it
+func openPartial(t *testing.T, m *Manager, key string) io.ReadCloser {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		reader, err := m.OpenPartial(key)
+		if err == nil {
+			return reader
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("fill of %s never started: %v", key, err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestOpenPartialTailsFill(t *testing.T) {
+	m := newTestManager(t, 1<<20)
+	writer, done := stageAsync(t, m, "a", 11)
+	writer.Write([]byte("hello"))
+	reader := openPartial(t, m, "a")
+	defer reader.Close()
+
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(reader, buf); err != nil || string(buf) != "hello" {
+		t.Fatalf("got %q, %v, want what was written so far", buf, err)
+	}
+
+	writer.Write([]byte(" world"))
+	writer.Close()
+	rest, err := io.ReadAll(reader)
+	if err != nil || string(rest) != " world" {
+		t.Errorf("got %q, %v, want the rest of the fill", rest, err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenPartialShortFill(t *testing.T) {
+	m := newTestManager(t, 1<<20)
+	writer, done := stageAsync(t, m, "a", 100)
+	writer.Write([]byte("short"))
+	reader := openPartial(t, m, "a")
+	defer reader.Close()
+
+	writer.Close()
+	data, err := io.ReadAll(reader)
+	if err == nil || string(data) != "short" {
+		t.Errorf("got %q, %v, want the written bytes then an error", data, err)
+	}
+	<-done
+}
+
+func TestOpenPartialWithoutFill(t *testing.T) {
+	m := newTestManager(t, 1<<20)
+	if _, err := m.OpenPartial("a"); !errors.Is(err, ErrNoFill) {
+		t.Errorf("got %v, want ErrNoFill", err)
+	}
+
+	put(t, m, "a", "cached")
+	if _, err := m.OpenPartial("a"); !errors.Is(err, ErrNoFill) {
+		t.Errorf("after the fill: got %v, want ErrNoFill", err)
+	}
+}
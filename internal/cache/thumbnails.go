@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ThumbnailPath returns the file a width x height thumbnail of a file's version
+// validator is kept in. Thumbnails aren't entries, PurgeExpiredThumbnails removes
+// them once they are older than the TTL.
+func (m *Manager) ThumbnailPath(fileID, validator string, width, height int) string {
+	version := sha256.Sum256([]byte(validator))
+	name := fmt.Sprintf("%s_%dx%d_%s.jpg", fileID, width, height, hex.EncodeToString(version[:4]))
+	return filepath.Join(m.cacheDir, "thumbnails", name)
+}
+
+// PurgeExpiredThumbnails removes the thumbnails older than the TTL and returns how
+// many were removed
+func (m *Manager) PurgeExpiredThumbnails() int {
+	dir := filepath.Join(m.cacheDir, "thumbnails")
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+
+	var purged int
+	for _, file := range files {
+		info, err := file.Info()
+		if err != nil || file.IsDir() || time.Since(info.ModTime()) <= m.ttl {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, file.Name())); err != nil {
+			m.logger.Warnf("Failed to remove expired thumbnail %s: %v", file.Name(), err)
+			continue
+		}
+		purged++
+	}
+	if purged > 0 {
+		m.logger.Infof("Removed %d expired thumbnails", purged)
+	}
+	return purged
+}
+
+// clearThumbnails removes all thumbnails
+func (m *Manager) clearThumbnails() error {
+	if err := os.RemoveAll(filepath.Join(m.cacheDir, "thumbnails")); err != nil {
+		return fmt.Errorf("failed to remove thumbnails: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestGetValidated(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t, 1<<20)
+	if _, err := m.PutValidated(ctx, "file", "5@t1", strings.NewReader("hello"), 5); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, validator := range []string{"5@t1", ""} {
+		reader, entry, err := m.GetValidated(ctx, "file", validator)
+		if err != nil {
+			t.Fatalf("validator %q: %v", validator, err)
+		}
+		reader.Close()
+		if entry.Validator != "5@t1" {
+			t.Errorf("got validator %q, want 5@t1", entry.Validator)
+		}
+	}
+
+	if _, _, err := m.GetValidated(ctx, "file", "6@t2"); err == nil {
+		t.Fatal("entry stored for other content was served")
+	}
+	if _, _, err := m.Get(ctx, "file"); err == nil {
+		t.Error("stale entry wasn't evicted")
+	}
+}
+
+func TestGetValidatedAdoptsValidator(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t, 1<<20)
+	put(t, m, "file", "hello")
+
+	reader, _, err := m.GetValidated(ctx, "file", "5@t1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader.Close()
+	if _, _, err := m.GetValidated(ctx, "file", "6@t2"); err == nil {
+		t.Error("entry didn't adopt the first validator it was read with")
+	}
+}
+
+func TestConcurrentGetsCountEveryAccess(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t, 1<<20)
+	put(t, m, "file", "hello")
+
+	// Run with -race: lookups update the entry's access count and validator
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reader, _, err := m.GetValidated(ctx, "file", "5@t1")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			reader.Close()
+		}()
+	}
+	wg.Wait()
+
+	if entries := m.Entries(); len(entries) != 1 || entries[0].AccessCount != 101 {
+		t.Errorf("got entries %+v, want one accessed 101 times", entries)
+	}
+}
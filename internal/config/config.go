@@ -1,67 +1,474 @@
 package config
 
 import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// EnvProduction is the APP_ENV value that enables production safety checks
+const EnvProduction = "production"
+
+// Insecure defaults that must not be used in production
+const (
+	DefaultJWTSecret     = "your-super-secret-jwt-key-change-in-production"
+	DefaultAdminEmail    = "admin@rclonestorage.local"
+	DefaultAdminPassword = "Admin123!"
+)
+
 type Config struct {
-	Server  ServerConfig
-	Cache   CacheConfig
-	Rclone  RcloneConfig
-	Storage StorageConfig
+	Env        string // APP_ENV, "production" refuses insecure defaults
+	Server     ServerConfig
+	Auth       AuthConfig
+	Cache      CacheConfig
+	Rclone     RcloneConfig
+	Storage    StorageConfig
+	Encryption EncryptionConfig
+	Listing    ListingConfig
+	Share      ShareConfig
+	Monitor    MonitorConfig
 }
 
 type ServerConfig struct {
 	Port string
 	Host string
+
+	// TLS is served when both files are set
+	TLSCertFile   string
+	TLSKeyFile    string
+	TLSMinVersion uint16 // a crypto/tls version constant
+
+	// Security response headers, Strict-Transport-Security is only sent over HTTPS
+	SecurityHeaders bool
+	HSTSMaxAge      time.Duration
+	FrameOptions    string
+	ReferrerPolicy  string
+
+	// CORS: origins allowed to call the API from a browser ("*" for any, which rules
+	// out credentials), and what a preflight answers for them
+	CORSAllowedOrigins   []string
+	CORSAllowCredentials bool
+	CORSAllowedMethods   []string
+	CORSAllowedHeaders   []string
+	CORSMaxAge           time.Duration
+}
+
+// TLSEnabled reports whether the server should serve HTTPS
+func (s ServerConfig) TLSEnabled() bool {
+	return s.TLSCertFile != "" && s.TLSKeyFile != ""
+}
+
+type AuthConfig struct {
+	JWTSecret     string
+	AdminEmail    string
+	AdminPassword string // only used when the admin account is first created
+
+	// TrustClaims takes the user ID and role from JWT claims instead of loading the
+	// user on every request; sensitive operations still check the database
+	TrustClaims bool
+
+	// StrictOptionalAuth rejects invalid credentials on routes that allow anonymous
+	// access instead of serving the request anonymously
+	StrictOptionalAuth bool
+
+	// RolePermissions replaces the allowed actions of the listed roles
+	RolePermissions map[string][]string
+
+	// RateLimit is the requests per minute allowed to each user, or client IP for
+	// anonymous requests, RateLimitRoles overrides it by role (0 = unlimited)
+	RateLimit      int
+	RateLimitRoles map[string]int
+
+	// An account is locked for LoginLockout after LoginMaxAttempts consecutive
+	// failed logins, doubled with every further failure (0 attempts = never)
+	LoginMaxAttempts int
+	LoginLockout     time.Duration
+
+	// Password policy for new and changed passwords: the minimum length in
+	// characters, the maximum in bytes (0 = bcrypt's limit of 72), required character
+	// classes (upper, lower, digit, special) and the minimum estimated strength in
+	// bits (0 = not checked)
+	PasswordMinLength  int
+	PasswordMaxLength  int
+	PasswordRequire    []string
+	PasswordMinEntropy int
+
+	// PasswordHash is the algorithm new password hashes are made with (bcrypt or
+	// argon2id) and BcryptCost the bcrypt work factor, older hashes are upgraded on login
+	PasswordHash string
+	BcryptCost   int
+
+	// GeneratedSecret is set when no JWT secret was configured and a random one is
+	// used, GeneratedAdminPassword likewise for the admin password
+	GeneratedSecret        bool
+	GeneratedAdminPassword bool
 }
 
 type CacheConfig struct {
-	Dir     string
-	TTL     time.Duration
-	MaxSize int64 // in bytes
+	Dir             string
+	TTL             time.Duration
+	MaxSize         int64         // in bytes
+	MaxEntrySize    int64         // in bytes, larger files bypass the cache (0 = no limit)
+	CleanupInterval time.Duration // expiry sweep interval (0 = TTL/2)
+	UploadTee       bool          // cache streamable uploads while sending them to cloud
+	ServePartial    bool          // let concurrent streams read a cache entry while it is being filled
+	EvictionPolicy  string        // "lru", "lfu" or "fifo", which entries make room when the cache is full
+	TempMaxAge      time.Duration // temp files older than this are left over from an earlier run and removed on startup
+
+	// DegradedThreshold is how many consecutive cache write failures (read-only or
+	// full filesystem) mark the cache degraded in the dashboard and health check
+	DegradedThreshold int
 }
 
 type RcloneConfig struct {
-	ConfigPath string
-	BinPath    string
+	ConfigPath     string
+	BinPath        string
+	MaxConcurrency int // rclone processes a single background job may run at once
+
+	// AllowedRemotes restricts the remotes rclone may be run against, the union
+	// remote is always allowed. Empty allows any well-formed remote name.
+	AllowedRemotes []string
 }
 
 type StorageConfig struct {
-	Providers []string
-	UnionName string
+	Providers              []string
+	ProviderWeights        map[string]float64 // scales each provider's free space when placing uploads
+	Replicas               int                // providers each upload is stored on
+	ProvidersFile          string             // persisted provider set, overrides Providers once written
+	UnionName              string             // rclone remote combining the providers
+	UploadsPath            string             // directory holding the uploaded objects on every remote
+	DirectURLs             bool               // allow redirecting clients to provider URLs
+	DirectURLExpiry        time.Duration      // lifetime of generated direct URLs
+	StreamMode             string             // "proxy" or "redirect" for handleStream
+	DownloadDisposition    string             // default Content-Disposition of downloads, "attachment" or "inline"
+	ChecksumAlgo           string             // "md5" or "sha256"
+	DeleteRequireOwnership bool               // refuse deleting objects without an ownership record
+	UploadMaxSize          int64              // largest accepted upload in bytes (0 = no limit)
+	UploadResumeMaxAge     time.Duration      // resumable uploads idle longer than this are removed on startup
+
+	// Uploads must have one of AllowedMimeTypes (type/subtype or type/*, empty = any)
+	// as detected from their content, and none of BlockedExtensions
+	AllowedMimeTypes  []string
+	BlockedExtensions []string
+
+	// Deduplicate stores an upload whose SHA-256 matches an earlier file's as a
+	// reference to that object: "user" matches the uploader's own files, "all"
+	// every user's and "off" never
+	Deduplicate string
+
+	// Background uploads that fail are retried up to UploadRetryAttempts times in
+	// total, waiting UploadRetryBackoff (doubled after each failure) in between
+	UploadRetryAttempts   int
+	UploadRetryBackoff    time.Duration
+	UploadRetryMaxBackoff time.Duration
+
+	// Containers that can't be seeked without an index, served either
+	// sequentially without range support or remuxed through ffmpeg
+	NonSeekableFormats []string
+	NonSeekableMode    string // "sequential" or "remux"
+	FFmpegPath         string
+	FFprobePath        string        // media metadata in stream info, omitted when missing
+	ThumbnailOffset    time.Duration // position of the frame video thumbnails show
+
+	// Reads: per-provider timeout and optionally racing all providers
+	ReadTimeout time.Duration // 0 = no limit
+	HedgedReads bool
+
+	// Circuit breaker: skip a provider after CircuitThreshold consecutive failures
+	CircuitThreshold   int
+	CircuitCooldown    time.Duration // first cooldown, doubled after each failed trial
+	CircuitMaxCooldown time.Duration
+
+	// Providers are probed in the background every HealthInterval, status queries
+	// read the last result
+	HealthInterval time.Duration
+}
+
+// ObjectPath returns the remote path of an uploaded object on remote, of the uploads
+// directory itself when object is empty
+func (s StorageConfig) ObjectPath(remote, object string) string {
+	return remote + ":" + s.UploadsPath + "/" + object
+}
+
+// EncryptionConfig holds the keys files are encrypted at rest with, base64-encoded
+// 32-byte AES keys. New uploads are encrypted with Key, which is recorded with each
+// file as KeyID; files encrypted with an earlier key stay readable while it is
+// listed in OldKeys under its ID. Without Key uploads are stored in the clear.
+type EncryptionConfig struct {
+	Key     string
+	KeyID   string
+	OldKeys map[string]string
 }
 
+// Enabled reports whether new uploads are encrypted
+func (e EncryptionConfig) Enabled() bool {
+	return e.Key != ""
+}
+
+// Keys decodes every configured key by ID
+func (e EncryptionConfig) Keys() (map[string][]byte, error) {
+	keys := make(map[string][]byte, len(e.OldKeys)+1)
+	for id, encoded := range e.OldKeys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		keys[id] = key
+	}
+	if e.Enabled() {
+		key, err := base64.StdEncoding.DecodeString(e.Key)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", e.KeyID, err)
+		}
+		keys[e.KeyID] = key
+	}
+	return keys, nil
+}
+
+type ListingConfig struct {
+	DefaultSort  string // name, size, date or type
+	DefaultOrder string // asc or desc
+
+	// Source is where GET /files reads from: db (ownership records) or cloud (rclone).
+	// Either falls back to the other when it is unavailable.
+	Source            string
+	ReconcileInterval time.Duration // how often to compare db and cloud, 0 disables
+}
+
+type ShareConfig struct {
+	Enabled bool          // global switch for anonymous share links
+	MaxAge  time.Duration // longest lifetime a share link may have (0 = no limit)
+}
+
+type MonitorConfig struct {
+	// StreamInterval is how often GET /monitoring/stream pushes a snapshot, uploads
+	// and deletes push one in between
+	StreamInterval       time.Duration
+	MaxStreamSubscribers int
+	MaxStreamsPerUser    int // live connections one user may hold, so nobody takes every slot
+}
+
+// ErrSharingDisabled is returned by ShareExpiry when sharing is turned off
+var ErrSharingDisabled = errors.New("file sharing is disabled")
+
+// ShareExpiry returns the lifetime to give a share link for which the creator
+// requested the given lifetime (0 = as long as allowed), clamped to MaxAge
+func (s ShareConfig) ShareExpiry(requested time.Duration) (time.Duration, error) {
+	if !s.Enabled {
+		return 0, ErrSharingDisabled
+	}
+	if s.MaxAge > 0 && (requested <= 0 || requested > s.MaxAge) {
+		return s.MaxAge, nil
+	}
+
+	return requested, nil
+}
+
+// Load builds the configuration from environment variables and, when CONFIG_FILE
+// names a YAML or JSON file, the settings in it. Environment variables take precedence.
 func Load() (*Config, error) {
+	var src source
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		values, err := loadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		src.file = values
+	}
+
+	tlsMinVersion, err := parseTLSVersion(src.get("TLS_MIN_VERSION", "1.2"))
+	if err != nil {
+		return nil, err
+	}
+
 	cfg := &Config{
+		Env: src.get("APP_ENV", "development"),
 		Server: ServerConfig{
-			Port: getEnv("API_PORT", "5601"),
-			Host: getEnv("API_HOST", "0.0.0.0"),
+			Port: src.get("API_PORT", "5601"),
+			Host: src.get("API_HOST", "0.0.0.0"),
+
+			TLSCertFile:   src.get("TLS_CERT_FILE", ""),
+			TLSKeyFile:    src.get("TLS_KEY_FILE", ""),
+			TLSMinVersion: tlsMinVersion,
+
+			SecurityHeaders: parseBool(src.get("SECURITY_HEADERS", "true")),
+			HSTSMaxAge:      parseDurationOr(src.get("HSTS_MAX_AGE", ""), 365*24*time.Hour),
+			FrameOptions:    src.get("X_FRAME_OPTIONS", "DENY"),
+			ReferrerPolicy:  src.get("REFERRER_POLICY", "strict-origin-when-cross-origin"),
+
+			CORSAllowedOrigins:   parseList(src.get("CORS_ALLOWED_ORIGINS", "*")),
+			CORSAllowCredentials: parseBool(src.get("CORS_ALLOW_CREDENTIALS", "false")),
+			CORSAllowedMethods:   parseList(strings.ToUpper(src.get("CORS_ALLOWED_METHODS", "GET,HEAD,POST,PUT,PATCH,DELETE,OPTIONS"))),
+			CORSAllowedHeaders:   parseList(src.get("CORS_ALLOWED_HEADERS", "Content-Type,Authorization,X-API-Key,X-Request-ID,Tus-Resumable,Upload-Length,Upload-Offset,Upload-Metadata")),
+			CORSMaxAge:           parseDurationOr(src.get("CORS_MAX_AGE", ""), 12*time.Hour),
+		},
+		Auth: AuthConfig{
+			JWTSecret:       src.get("JWT_SECRET", ""),
+			AdminEmail:      src.get("ADMIN_EMAIL", DefaultAdminEmail),
+			AdminPassword:   src.get("ADMIN_PASSWORD", ""),
+			TrustClaims:     parseBool(src.get("JWT_TRUST_CLAIMS", "false")),
+			RolePermissions: parseRolePermissions(src.get("ROLE_PERMISSIONS", "")),
+
+			StrictOptionalAuth: parseBool(src.get("AUTH_STRICT_OPTIONAL", "false")),
+
+			RateLimit:      parseInt(src.get("RATE_LIMIT_PER_MINUTE", ""), 300),
+			RateLimitRoles: parseRoleLimits(src.get("RATE_LIMIT_ROLES", "admin:1200")),
+
+			LoginMaxAttempts: parseInt(src.get("LOGIN_MAX_ATTEMPTS", ""), 5),
+			LoginLockout:     parseDurationOr(src.get("LOGIN_LOCKOUT", ""), time.Minute),
+
+			PasswordMinLength:  parseInt(src.get("PASSWORD_MIN_LENGTH", ""), 8),
+			PasswordMaxLength:  parseInt(src.get("PASSWORD_MAX_LENGTH", ""), 72),
+			PasswordRequire:    parseList(strings.ToLower(src.get("PASSWORD_REQUIRE", "upper,lower,digit,special"))),
+			PasswordMinEntropy: parseInt(src.get("PASSWORD_MIN_ENTROPY", ""), 0),
+
+			PasswordHash: strings.ToLower(src.get("PASSWORD_HASH", "bcrypt")),
+			BcryptCost:   parseInt(src.get("BCRYPT_COST", ""), 10),
 		},
 		Cache: CacheConfig{
-			Dir:     getEnv("CACHE_DIR", "./cache"),
-			TTL:     parseDuration(getEnv("CACHE_TTL", "24h")),
-			MaxSize: parseInt64(getEnv("CACHE_MAX_SIZE", "10737418240")), // 10GB default
+			Dir:             src.get("CACHE_DIR", "./cache"),
+			TTL:             parseDuration(src.get("CACHE_TTL", "24h")),
+			MaxSize:         parseInt64(src.get("CACHE_MAX_SIZE", ""), 10737418240),      // 10GB default
+			MaxEntrySize:    parseInt64(src.get("CACHE_MAX_ENTRY_SIZE", ""), 1073741824), // 1GB default
+			CleanupInterval: parseDurationOr(src.get("CACHE_CLEANUP_INTERVAL", ""), 0),
+			UploadTee:       parseBool(src.get("CACHE_UPLOAD_TEE", "false")),
+			ServePartial:    parseBool(src.get("CACHE_SERVE_PARTIAL", "false")),
+			EvictionPolicy:  src.get("CACHE_EVICTION_POLICY", "lru"),
+			TempMaxAge:      parseDuration(src.get("CACHE_TEMP_MAX_AGE", "24h")),
+
+			DegradedThreshold: parseInt(src.get("CACHE_DEGRADED_THRESHOLD", ""), 3),
 		},
 		Rclone: RcloneConfig{
-			ConfigPath: getEnv("RCLONE_CONFIG_PATH", "./configs/rclone.conf"), // Use project config
-			BinPath:    getEnv("RCLONE_BIN_PATH", "rclone"),
+			ConfigPath:     src.get("RCLONE_CONFIG_PATH", "./configs/rclone.conf"), // Use project config
+			BinPath:        src.get("RCLONE_BIN_PATH", "rclone"),
+			MaxConcurrency: parseInt(src.get("RCLONE_MAX_CONCURRENCY", ""), 4),
+			AllowedRemotes: parseList(src.get("RCLONE_ALLOWED_REMOTES", "")),
 		},
 		Storage: StorageConfig{
-			Providers: []string{"mega1", "mega2", "mega3", "gdrive"}, // Three mega + Google Drive
-			UnionName: "union",                                       // Use union for load balancing
+			Providers:              parseList(src.get("STORAGE_PROVIDERS", "mega1,mega2,mega3,gdrive")), // Three mega + Google Drive
+			ProviderWeights:        parseWeights(src.get("STORAGE_PROVIDER_WEIGHTS", "")),
+			Replicas:               parseInt(src.get("STORAGE_REPLICAS", ""), 1),
+			ProvidersFile:          src.get("STORAGE_PROVIDERS_FILE", "./data/providers.json"),
+			UnionName:              src.get("STORAGE_UNION_NAME", "union"), // Use union for load balancing
+			UploadsPath:            strings.Trim(src.get("STORAGE_UPLOADS_PATH", "uploads"), "/"),
+			DirectURLs:             parseBool(src.get("DIRECT_URLS_ENABLED", "false")),
+			DirectURLExpiry:        parseDuration(src.get("DIRECT_URL_EXPIRY", "1h")),
+			StreamMode:             src.get("STREAM_MODE", "proxy"),
+			DownloadDisposition:    strings.ToLower(src.get("DOWNLOAD_DISPOSITION", "attachment")),
+			ChecksumAlgo:           strings.ToLower(src.get("CHECKSUM_ALGORITHM", "sha256")),
+			DeleteRequireOwnership: parseBool(src.get("DELETE_REQUIRE_OWNERSHIP", "true")),
+			UploadMaxSize:          parseInt64(src.get("UPLOAD_MAX_SIZE", ""), 0),
+			UploadResumeMaxAge:     parseDuration(src.get("UPLOAD_RESUME_MAX_AGE", "168h")),
+
+			AllowedMimeTypes:  parseList(strings.ToLower(src.get("ALLOWED_MIME_TYPES", ""))),
+			BlockedExtensions: parseList(strings.ToLower(src.get("BLOCKED_EXTENSIONS", ""))),
+			Deduplicate:       strings.ToLower(src.get("UPLOAD_DEDUPLICATE", "user")),
+
+			UploadRetryAttempts:   parseInt(src.get("UPLOAD_RETRY_ATTEMPTS", ""), 3),
+			UploadRetryBackoff:    parseDurationOr(src.get("UPLOAD_RETRY_BACKOFF", ""), 10*time.Second),
+			UploadRetryMaxBackoff: parseDurationOr(src.get("UPLOAD_RETRY_MAX_BACKOFF", ""), 5*time.Minute),
+
+			NonSeekableFormats: parseList(strings.ToLower(src.get("STREAM_NON_SEEKABLE_FORMATS", ".avi,.wmv,.flv"))),
+			NonSeekableMode:    src.get("STREAM_NON_SEEKABLE_MODE", "sequential"),
+			FFmpegPath:         src.get("FFMPEG_BIN_PATH", "ffmpeg"),
+			FFprobePath:        src.get("FFPROBE_BIN_PATH", "ffprobe"),
+			ThumbnailOffset:    parseDurationOr(src.get("THUMBNAIL_VIDEO_OFFSET", ""), 5*time.Second),
+
+			ReadTimeout: parseDurationOr(src.get("STORAGE_READ_TIMEOUT", ""), 30*time.Second),
+			HedgedReads: parseBool(src.get("STORAGE_HEDGED_READS", "false")),
+
+			CircuitThreshold:   parseInt(src.get("CIRCUIT_FAILURE_THRESHOLD", ""), 5),
+			CircuitCooldown:    parseDurationOr(src.get("CIRCUIT_COOLDOWN", ""), 30*time.Second),
+			CircuitMaxCooldown: parseDurationOr(src.get("CIRCUIT_MAX_COOLDOWN", ""), 10*time.Minute),
+
+			HealthInterval: parseDurationOr(src.get("PROVIDER_HEALTH_INTERVAL", ""), time.Minute),
+		},
+		Encryption: EncryptionConfig{
+			Key:     src.get("ENCRYPTION_KEY", ""),
+			KeyID:   src.get("ENCRYPTION_KEY_ID", "1"),
+			OldKeys: parseKeys(src.get("ENCRYPTION_OLD_KEYS", "")),
+		},
+		Listing: ListingConfig{
+			DefaultSort:       src.get("LIST_DEFAULT_SORT", "name"),
+			DefaultOrder:      src.get("LIST_DEFAULT_ORDER", "asc"),
+			Source:            src.get("LIST_SOURCE", "db"),
+			ReconcileInterval: parseDurationOr(src.get("LIST_RECONCILE_INTERVAL", ""), 0),
 		},
+		Share: ShareConfig{
+			Enabled: parseBool(src.get("SHARING_ENABLED", "true")),
+			MaxAge:  parseDurationOr(src.get("SHARE_MAX_AGE", ""), 7*24*time.Hour),
+		},
+		Monitor: MonitorConfig{
+			StreamInterval:       parseDurationOr(src.get("MONITORING_STREAM_INTERVAL", ""), 5*time.Second),
+			MaxStreamSubscribers: parseInt(src.get("MONITORING_STREAM_MAX_SUBSCRIBERS", ""), 20),
+			MaxStreamsPerUser:    parseInt(src.get("MONITORING_STREAM_MAX_PER_USER", ""), 3),
+		},
+	}
+
+	// Values that don't parse would silently fall back to defaults, report them
+	// together with the values that parse but aren't usable
+	problems := append(src.checkValues(), cfg.problems()...)
+	if err := validationError(problems); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.applyAuthDefaults(); err != nil {
+		return nil, err
 	}
 
 	return cfg, nil
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// IsProduction reports whether APP_ENV is production
+func (c *Config) IsProduction() bool {
+	return c.Env == EnvProduction
+}
+
+// applyAuthDefaults rejects insecure secrets in production and generates random ones in development
+func (c *Config) applyAuthDefaults() error {
+	if c.IsProduction() {
+		if c.Auth.JWTSecret == "" || strings.HasPrefix(c.Auth.JWTSecret, DefaultJWTSecret) {
+			return fmt.Errorf("JWT_SECRET must be set to a non-default value when APP_ENV=production")
+		}
+		if c.Auth.AdminPassword == "" || c.Auth.AdminPassword == DefaultAdminPassword {
+			return fmt.Errorf("ADMIN_PASSWORD must be set to a non-default value when APP_ENV=production")
+		}
+		return nil
+	}
+
+	if c.Auth.JWTSecret == "" {
+		secret, err := randomString(32)
+		if err != nil {
+			return err
+		}
+		c.Auth.JWTSecret = secret
+		c.Auth.GeneratedSecret = true
+	}
+	if c.Auth.AdminPassword == "" {
+		password, err := randomString(12)
+		if err != nil {
+			return err
+		}
+		// Suffix guarantees every character class the password policy requires
+		c.Auth.AdminPassword = password + "Aa1!"
+		c.Auth.GeneratedAdminPassword = true
 	}
-	return defaultValue
+	return nil
+}
+
+func randomString(n int) (string, error) {
+	bytes := make([]byte, n)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate random value: %w", err)
+	}
+	return hex.EncodeToString(bytes), nil
 }
 
 func parseDuration(s string) time.Duration {
@@ -72,7 +479,112 @@ func parseDuration(s string) time.Duration {
 	return d
 }
 
-func parseInt64(s string) int64 {
-	// Simple implementation, in production use strconv.ParseInt
-	return 10737418240 // 10GB default
+func parseDurationOr(s string, defaultValue time.Duration) time.Duration {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return defaultValue
+	}
+	return d
+}
+
+// parseTLSVersion parses a TLS version such as "1.2" into its crypto/tls constant
+func parseTLSVersion(s string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToLower(s), "tls") {
+	case "1.0", "10":
+		return tls.VersionTLS10, nil
+	case "1.1", "11":
+		return tls.VersionTLS11, nil
+	case "1.2", "12":
+		return tls.VersionTLS12, nil
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("invalid TLS_MIN_VERSION %q, expected 1.0, 1.1, 1.2 or 1.3", s)
+	}
+}
+
+func parseInt(s string, defaultValue int) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return defaultValue
+	}
+	return n
+}
+
+func parseInt64(s string, defaultValue int64) int64 {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return defaultValue
+	}
+	return n
+}
+
+// parseRolePermissions parses "role:action,action;role:action". A role with
+// nothing after the colon is allowed no actions.
+func parseRolePermissions(s string) map[string][]string {
+	permissions := make(map[string][]string)
+	for _, entry := range strings.Split(s, ";") {
+		role, actions, found := strings.Cut(strings.TrimSpace(entry), ":")
+		role = strings.TrimSpace(role)
+		if !found || role == "" {
+			continue
+		}
+		permissions[role] = parseList(actions)
+	}
+	return permissions
+}
+
+// parseWeights parses "name:weight,name:weight". A weight that isn't a number is
+// kept as 0 for Validate to reject.
+func parseWeights(s string) map[string]float64 {
+	weights := make(map[string]float64)
+	for _, entry := range parseList(s) {
+		name, value, _ := strings.Cut(entry, ":")
+		weight, _ := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		weights[strings.TrimSpace(name)] = weight
+	}
+	return weights
+}
+
+// parseRoleLimits parses "role:limit,role:limit". A limit that isn't a whole number
+// is kept as -1 for Validate to reject.
+func parseRoleLimits(s string) map[string]int {
+	limits := make(map[string]int)
+	for _, entry := range parseList(s) {
+		role, value, _ := strings.Cut(entry, ":")
+		limit, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			limit = -1
+		}
+		limits[strings.TrimSpace(role)] = limit
+	}
+	return limits
+}
+
+// parseKeys parses "id:key,id:key", Validate rejects keys that don't decode
+func parseKeys(s string) map[string]string {
+	keys := make(map[string]string)
+	for _, entry := range parseList(s) {
+		id, key, _ := strings.Cut(entry, ":")
+		keys[strings.TrimSpace(id)] = strings.TrimSpace(key)
+	}
+	return keys
+}
+
+func parseBool(s string) bool {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return false
+	}
+	return b
+}
+
+func parseList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
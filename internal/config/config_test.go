@@ -0,0 +1,135 @@
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestProductionRejectsDefaultSecrets checks that production refuses to start with a
+// missing or default JWT secret or admin password
+func TestProductionRejectsDefaultSecrets(t *testing.T) {
+	tests := []struct {
+		name     string
+		secret   string
+		password string
+		want     string
+	}{
+		{"missing secret", "", "S3cure-admin!", "JWT_SECRET"},
+		{"default secret", DefaultJWTSecret, "S3cure-admin!", "JWT_SECRET"},
+		{"missing password", "a-long-random-secret", "", "ADMIN_PASSWORD"},
+		{"default password", "a-long-random-secret", DefaultAdminPassword, "ADMIN_PASSWORD"},
+	}
+	for _, tt := range tests {
+		cfg := &Config{Env: EnvProduction, Auth: AuthConfig{JWTSecret: tt.secret, AdminPassword: tt.password}}
+		err := cfg.applyAuthDefaults()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want an error about %s", tt.name, err, tt.want)
+		}
+	}
+
+	cfg := &Config{Env: EnvProduction, Auth: AuthConfig{JWTSecret: "a-long-random-secret", AdminPassword: "S3cure-admin!"}}
+	if err := cfg.applyAuthDefaults(); err != nil {
+		t.Errorf("got %v for explicit secrets, want no error", err)
+	}
+}
+
+// TestDevelopmentGeneratesSecrets checks that outside production missing secrets are
+// replaced by random ones and explicit ones are kept
+func TestDevelopmentGeneratesSecrets(t *testing.T) {
+	first := &Config{Env: "development"}
+	second := &Config{Env: "development"}
+	for _, cfg := range []*Config{first, second} {
+		if err := cfg.applyAuthDefaults(); err != nil {
+			t.Fatalf("applyAuthDefaults: %v", err)
+		}
+		if cfg.Auth.JWTSecret == "" || !cfg.Auth.GeneratedSecret {
+			t.Errorf("got secret %q, generated %v, want a generated secret", cfg.Auth.JWTSecret, cfg.Auth.GeneratedSecret)
+		}
+		if cfg.Auth.AdminPassword == "" || cfg.Auth.AdminPassword == DefaultAdminPassword || !cfg.Auth.GeneratedAdminPassword {
+			t.Errorf("got admin password %q, generated %v, want a random one", cfg.Auth.AdminPassword, cfg.Auth.GeneratedAdminPassword)
+		}
+	}
+	if first.Auth.JWTSecret == second.Auth.JWTSecret || first.Auth.AdminPassword == second.Auth.AdminPassword {
+		t.Error("got the same generated secrets twice, want random ones")
+	}
+
+	cfg := &Config{Env: "development", Auth: AuthConfig{JWTSecret: "mine", AdminPassword: "Mine-123!"}}
+	if err := cfg.applyAuthDefaults(); err != nil {
+		t.Fatalf("applyAuthDefaults: %v", err)
+	}
+	if cfg.Auth.JWTSecret != "mine" || cfg.Auth.AdminPassword != "Mine-123!" || cfg.Auth.GeneratedSecret || cfg.Auth.GeneratedAdminPassword {
+		t.Errorf("got %+v, want the explicit secrets kept", cfg.Auth)
+	}
+}
+
+func TestShareExpiry(t *testing.T) {
+	share := ShareConfig{Enabled: true, MaxAge: 24 * time.Hour}
+	tests := []struct {
+		requested, want time.Duration
+	}{
+		{0, 24 * time.Hour},
+		{time.Hour, time.Hour},
+		{24 * time.Hour, 24 * time.Hour},
+		{30 * 24 * time.Hour, 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got, err := share.ShareExpiry(tt.requested); err != nil || got != tt.want {
+			t.Errorf("ShareExpiry(%s) = %s, %v, want %s", tt.requested, got, err, tt.want)
+		}
+	}
+
+	// Without a max age links live as long as requested, forever when not
+	unlimited := ShareConfig{Enabled: true}
+	if got, _ := unlimited.ShareExpiry(0); got != 0 {
+		t.Errorf("unlimited ShareExpiry(0) = %s, want 0", got)
+	}
+
+	disabled := ShareConfig{MaxAge: time.Hour}
+	if _, err := disabled.ShareExpiry(time.Minute); !errors.Is(err, ErrSharingDisabled) {
+		t.Errorf("got %v with sharing disabled, want ErrSharingDisabled", err)
+	}
+}
+
+func TestParseRolePermissions(t *testing.T) {
+	got := parseRolePermissions("user: upload, share ; readonly: ;bogus")
+	want := map[string][]string{"user": {"upload", "share"}, "readonly": nil}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestParseRoleLimits(t *testing.T) {
+	got := parseRoleLimits("admin:1200, user: 60,bogus:many")
+	want := map[string]int{"admin": 1200, "user": 60, "bogus": -1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	tests := map[string]uint16{
+		"1.2":    tls.VersionTLS12,
+		"TLS1.3": tls.VersionTLS13,
+		"10":     tls.VersionTLS10,
+	}
+	for input, want := range tests {
+		if got, err := parseTLSVersion(input); err != nil || got != want {
+			t.Errorf("%q: got %#x, %v, want %#x", input, got, err, want)
+		}
+	}
+	if _, err := parseTLSVersion("1.4"); err == nil {
+		t.Error("got no error for 1.4, want one")
+	}
+}
+
+func TestParseInt64(t *testing.T) {
+	for input, want := range map[string]int64{"10737418240": 10737418240, "-1": -1, "": 7, "10GB": 7} {
+		if got := parseInt64(input, 7); got != want {
+			t.Errorf("%q: got %d, want %d", input, got, want)
+		}
+	}
+}
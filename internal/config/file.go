@@ -0,0 +1,278 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Kinds of config values, used to reject bad values in the config file
+const (
+	kindString = iota
+	kindBool
+	kindInt
+	kindDuration
+	kindList
+	kindRolePermissions
+)
+
+// fileKey is a config file setting and the environment variable that overrides it
+type fileKey struct {
+	env  string
+	kind int
+}
+
+// fileKeys maps the dotted keys of the config file to their environment variables
+var fileKeys = map[string]fileKey{
+	"env": {"APP_ENV", kindString},
+
+	"server.port":             {"API_PORT", kindString},
+	"server.host":             {"API_HOST", kindString},
+	"server.tls_cert_file":    {"TLS_CERT_FILE", kindString},
+	"server.tls_key_file":     {"TLS_KEY_FILE", kindString},
+	"server.tls_min_version":  {"TLS_MIN_VERSION", kindString},
+	"server.security_headers": {"SECURITY_HEADERS", kindBool},
+	"server.hsts_max_age":     {"HSTS_MAX_AGE", kindDuration},
+	"server.frame_options":    {"X_FRAME_OPTIONS", kindString},
+	"server.referrer_policy":  {"REFERRER_POLICY", kindString},
+
+	"server.cors_allowed_origins":   {"CORS_ALLOWED_ORIGINS", kindList},
+	"server.cors_allow_credentials": {"CORS_ALLOW_CREDENTIALS", kindBool},
+	"server.cors_allowed_methods":   {"CORS_ALLOWED_METHODS", kindList},
+	"server.cors_allowed_headers":   {"CORS_ALLOWED_HEADERS", kindList},
+	"server.cors_max_age":           {"CORS_MAX_AGE", kindDuration},
+
+	"auth.jwt_secret":           {"JWT_SECRET", kindString},
+	"auth.admin_email":          {"ADMIN_EMAIL", kindString},
+	"auth.admin_password":       {"ADMIN_PASSWORD", kindString},
+	"auth.trust_claims":         {"JWT_TRUST_CLAIMS", kindBool},
+	"auth.strict_optional":      {"AUTH_STRICT_OPTIONAL", kindBool},
+	"auth.role_permissions":     {"ROLE_PERMISSIONS", kindRolePermissions},
+	"auth.rate_limit":           {"RATE_LIMIT_PER_MINUTE", kindInt},
+	"auth.rate_limit_roles":     {"RATE_LIMIT_ROLES", kindList},
+	"auth.login_max_attempts":   {"LOGIN_MAX_ATTEMPTS", kindInt},
+	"auth.login_lockout":        {"LOGIN_LOCKOUT", kindDuration},
+	"auth.password_min_length":  {"PASSWORD_MIN_LENGTH", kindInt},
+	"auth.password_max_length":  {"PASSWORD_MAX_LENGTH", kindInt},
+	"auth.password_require":     {"PASSWORD_REQUIRE", kindList},
+	"auth.password_min_entropy": {"PASSWORD_MIN_ENTROPY", kindInt},
+	"auth.password_hash":        {"PASSWORD_HASH", kindString},
+	"auth.bcrypt_cost":          {"BCRYPT_COST", kindInt},
+
+	"cache.dir":                {"CACHE_DIR", kindString},
+	"cache.ttl":                {"CACHE_TTL", kindDuration},
+	"cache.max_size":           {"CACHE_MAX_SIZE", kindInt},
+	"cache.max_entry_size":     {"CACHE_MAX_ENTRY_SIZE", kindInt},
+	"cache.cleanup_interval":   {"CACHE_CLEANUP_INTERVAL", kindDuration},
+	"cache.upload_tee":         {"CACHE_UPLOAD_TEE", kindBool},
+	"cache.serve_partial":      {"CACHE_SERVE_PARTIAL", kindBool},
+	"cache.degraded_threshold": {"CACHE_DEGRADED_THRESHOLD", kindInt},
+	"cache.eviction_policy":    {"CACHE_EVICTION_POLICY", kindString},
+	"cache.temp_max_age":       {"CACHE_TEMP_MAX_AGE", kindDuration},
+
+	"rclone.config_path":     {"RCLONE_CONFIG_PATH", kindString},
+	"rclone.bin_path":        {"RCLONE_BIN_PATH", kindString},
+	"rclone.max_concurrency": {"RCLONE_MAX_CONCURRENCY", kindInt},
+	"rclone.allowed_remotes": {"RCLONE_ALLOWED_REMOTES", kindList},
+
+	"storage.providers":                 {"STORAGE_PROVIDERS", kindList},
+	"storage.provider_weights":          {"STORAGE_PROVIDER_WEIGHTS", kindList},
+	"storage.replicas":                  {"STORAGE_REPLICAS", kindInt},
+	"storage.providers_file":            {"STORAGE_PROVIDERS_FILE", kindString},
+	"storage.union_name":                {"STORAGE_UNION_NAME", kindString},
+	"storage.uploads_path":              {"STORAGE_UPLOADS_PATH", kindString},
+	"storage.direct_urls":               {"DIRECT_URLS_ENABLED", kindBool},
+	"storage.direct_url_expiry":         {"DIRECT_URL_EXPIRY", kindDuration},
+	"storage.stream_mode":               {"STREAM_MODE", kindString},
+	"storage.download_disposition":      {"DOWNLOAD_DISPOSITION", kindString},
+	"storage.checksum_algorithm":        {"CHECKSUM_ALGORITHM", kindString},
+	"storage.delete_require_ownership":  {"DELETE_REQUIRE_OWNERSHIP", kindBool},
+	"storage.upload_max_size":           {"UPLOAD_MAX_SIZE", kindInt},
+	"storage.upload_resume_max_age":     {"UPLOAD_RESUME_MAX_AGE", kindDuration},
+	"storage.allowed_mime_types":        {"ALLOWED_MIME_TYPES", kindList},
+	"storage.blocked_extensions":        {"BLOCKED_EXTENSIONS", kindList},
+	"storage.deduplicate":               {"UPLOAD_DEDUPLICATE", kindString},
+	"storage.upload_retry_attempts":     {"UPLOAD_RETRY_ATTEMPTS", kindInt},
+	"storage.upload_retry_backoff":      {"UPLOAD_RETRY_BACKOFF", kindDuration},
+	"storage.upload_retry_max_backoff":  {"UPLOAD_RETRY_MAX_BACKOFF", kindDuration},
+	"storage.non_seekable_formats":      {"STREAM_NON_SEEKABLE_FORMATS", kindList},
+	"storage.non_seekable_mode":         {"STREAM_NON_SEEKABLE_MODE", kindString},
+	"storage.ffmpeg_path":               {"FFMPEG_BIN_PATH", kindString},
+	"storage.ffprobe_path":              {"FFPROBE_BIN_PATH", kindString},
+	"storage.thumbnail_video_offset":    {"THUMBNAIL_VIDEO_OFFSET", kindDuration},
+	"storage.read_timeout":              {"STORAGE_READ_TIMEOUT", kindDuration},
+	"storage.hedged_reads":              {"STORAGE_HEDGED_READS", kindBool},
+	"storage.circuit_failure_threshold": {"CIRCUIT_FAILURE_THRESHOLD", kindInt},
+	"storage.circuit_cooldown":          {"CIRCUIT_COOLDOWN", kindDuration},
+	"storage.circuit_max_cooldown":      {"CIRCUIT_MAX_COOLDOWN", kindDuration},
+	"storage.health_interval":           {"PROVIDER_HEALTH_INTERVAL", kindDuration},
+
+	"encryption.key":      {"ENCRYPTION_KEY", kindString},
+	"encryption.key_id":   {"ENCRYPTION_KEY_ID", kindString},
+	"encryption.old_keys": {"ENCRYPTION_OLD_KEYS", kindList},
+
+	"listing.default_sort":       {"LIST_DEFAULT_SORT", kindString},
+	"listing.default_order":      {"LIST_DEFAULT_ORDER", kindString},
+	"listing.source":             {"LIST_SOURCE", kindString},
+	"listing.reconcile_interval": {"LIST_RECONCILE_INTERVAL", kindDuration},
+
+	"share.enabled": {"SHARING_ENABLED", kindBool},
+	"share.max_age": {"SHARE_MAX_AGE", kindDuration},
+
+	"monitoring.stream_interval":        {"MONITORING_STREAM_INTERVAL", kindDuration},
+	"monitoring.stream_max_subscribers": {"MONITORING_STREAM_MAX_SUBSCRIBERS", kindInt},
+	"monitoring.stream_max_per_user":    {"MONITORING_STREAM_MAX_PER_USER", kindInt},
+}
+
+// source looks settings up by environment variable, falling back to the config file
+type source struct {
+	file map[string]string // values from the config file by environment variable
+}
+
+// get returns the environment variable key if set, else the config file's value, else defaultValue
+func (s source) get(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	if value := s.file[key]; value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// loadFile reads a YAML or, for a .json path, JSON config file into values keyed by
+// the environment variable each setting corresponds to. Unknown keys and values of
+// the wrong type are errors.
+func loadFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var doc map[string]interface{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber() // sizes in bytes would lose digits as float64
+		err = decoder.Decode(&doc)
+	} else {
+		err = yaml.Unmarshal(data, &doc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	var problems []string
+	flattenFile("", doc, func(key string, value interface{}) {
+		setting, ok := fileKeys[key]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: unknown setting", key))
+			return
+		}
+		text, err := fileValue(setting.kind, value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", key, err))
+			return
+		}
+		values[setting.env] = text
+	})
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("invalid config file %s:\n  %s", path, strings.Join(problems, "\n  "))
+	}
+	return values, nil
+}
+
+// flattenFile calls set for every leaf of a config document with its dotted key.
+// Role permissions are a map themselves and are passed whole.
+func flattenFile(prefix string, doc map[string]interface{}, set func(string, interface{})) {
+	for name, value := range doc {
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+		if section, ok := value.(map[string]interface{}); ok && fileKeys[key].kind != kindRolePermissions {
+			flattenFile(key, section, set)
+			continue
+		}
+		set(key, value)
+	}
+}
+
+// fileValue converts a config file value to its environment variable form
+func fileValue(kind int, value interface{}) (string, error) {
+	switch kind {
+	case kindList:
+		if items, ok := value.([]interface{}); ok {
+			parts := make([]string, 0, len(items))
+			for _, item := range items {
+				parts = append(parts, fmt.Sprint(item))
+			}
+			return strings.Join(parts, ","), nil
+		}
+	case kindRolePermissions:
+		if roles, ok := value.(map[string]interface{}); ok {
+			return rolePermissionsValue(roles)
+		}
+	}
+
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		return "", fmt.Errorf("expected a single value")
+	case nil:
+		return "", nil
+	}
+	text := fmt.Sprint(value)
+
+	if err := checkValue(kind, text); err != nil {
+		return "", err
+	}
+	return text, nil
+}
+
+// checkValue reports whether text parses as a value of the given kind
+func checkValue(kind int, text string) error {
+	switch kind {
+	case kindBool:
+		if _, err := strconv.ParseBool(text); err != nil {
+			return fmt.Errorf("expected true or false, got %q", text)
+		}
+	case kindInt:
+		if _, err := strconv.ParseInt(text, 10, 64); err != nil {
+			return fmt.Errorf("expected a whole number, got %q", text)
+		}
+	case kindDuration:
+		if _, err := time.ParseDuration(text); err != nil {
+			return fmt.Errorf("expected a duration such as 30s or 24h, got %q", text)
+		}
+	}
+	return nil
+}
+
+// rolePermissionsValue converts a role: [actions] map to the ROLE_PERMISSIONS format
+func rolePermissionsValue(roles map[string]interface{}) (string, error) {
+	names := make([]string, 0, len(roles))
+	for role := range roles {
+		names = append(names, role)
+	}
+	sort.Strings(names)
+
+	entries := make([]string, 0, len(names))
+	for _, role := range names {
+		actions, err := fileValue(kindList, roles[role])
+		if err != nil {
+			return "", fmt.Errorf("role %s: %v", role, err)
+		}
+		entries = append(entries, role+":"+actions)
+	}
+	return strings.Join(entries, ";"), nil
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile writes a config file named name and returns its path
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFileYAML(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+server:
+  port: 8080
+  cors_allowed_origins: [https://a.example.com, https://b.example.com]
+cache:
+  ttl: 6h
+  upload_tee: true
+auth:
+  role_permissions:
+    user: [upload, share]
+    readonly: []
+`)
+	got, err := loadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"API_PORT":             "8080",
+		"CORS_ALLOWED_ORIGINS": "https://a.example.com,https://b.example.com",
+		"CACHE_TTL":            "6h",
+		"CACHE_UPLOAD_TEE":     "true",
+		"ROLE_PERMISSIONS":     "readonly:;user:upload,share",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestLoadFileJSONKeepsLargeNumbers(t *testing.T) {
+	path := writeFile(t, "config.json", `{"cache": {"max_size": 10737418240123}}`)
+	got, err := loadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["CACHE_MAX_SIZE"] != "10737418240123" {
+		t.Errorf("got %q, want every digit", got["CACHE_MAX_SIZE"])
+	}
+}
+
+func TestLoadFileReportsEveryProblem(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+server:
+  prot: 8080
+cache:
+  ttl: soon
+  upload_tee: maybe
+  max_size: [1]
+`)
+	_, err := loadFile(path)
+	if err == nil {
+		t.Fatal("got no error")
+	}
+	for _, key := range []string{"server.prot", "cache.ttl", "cache.upload_tee", "cache.max_size"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("error doesn't mention %s: %v", key, err)
+		}
+	}
+}
+
+func TestEnvOverridesConfigFile(t *testing.T) {
+	rcloneConfig := writeFile(t, "rclone.conf", "")
+	t.Setenv("CONFIG_FILE", writeFile(t, "config.yaml", `
+server:
+  port: 8080
+  host: 127.0.0.1
+cache:
+  dir: `+t.TempDir()+`
+  ttl: 6h
+rclone:
+  config_path: `+rcloneConfig+`
+`))
+	t.Setenv("API_PORT", "9090")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != "9090" || cfg.Server.Host != "127.0.0.1" || cfg.Cache.TTL != 6*time.Hour {
+		t.Errorf("got port %s, host %s, TTL %v, want 9090 from the env and the rest from the file", cfg.Server.Port, cfg.Server.Host, cfg.Cache.TTL)
+	}
+}
+
+func TestLoadJSONConfigFile(t *testing.T) {
+	t.Setenv("CONFIG_FILE", writeFile(t, "config.json", `{
+  "server": {"port": 8081},
+  "cache": {"dir": "`+t.TempDir()+`", "max_size": 21474836480},
+  "rclone": {"config_path": "`+writeFile(t, "rclone.conf", "")+`"}
+}`))
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != "8081" || cfg.Cache.MaxSize != 21474836480 {
+		t.Errorf("got port %s, max size %d, want the file's", cfg.Server.Port, cfg.Cache.MaxSize)
+	}
+}
+
+func TestRcloneConfigPathMustExist(t *testing.T) {
+	t.Setenv("CACHE_DIR", t.TempDir())
+	for name, path := range map[string]string{
+		"missing":   filepath.Join(t.TempDir(), "rclone.conf"),
+		"directory": t.TempDir(),
+	} {
+		t.Setenv("RCLONE_CONFIG_PATH", path)
+		if _, err := Load(); err == nil || !strings.Contains(err.Error(), "RCLONE_CONFIG_PATH") {
+			t.Errorf("%s: got %v, want RCLONE_CONFIG_PATH rejected", name, err)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// checkValues rejects settings whose value doesn't parse, which the parse helpers
+// would otherwise silently replace with their defaults
+func (s source) checkValues() []string {
+	var problems []string
+	for _, setting := range fileKeys {
+		value := s.get(setting.env, "")
+		if value == "" {
+			continue
+		}
+		if err := checkValue(setting.kind, value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", setting.env, err))
+		}
+	}
+	return problems
+}
+
+// problems lists what is wrong with the configuration by environment variable, so
+// they can all be fixed at once
+func (c *Config) problems() []string {
+	var problems []string
+	check := func(ok bool, setting, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, setting+": "+fmt.Sprintf(format, args...))
+		}
+	}
+	oneOf := func(value, setting string, allowed ...string) {
+		for _, a := range allowed {
+			if strings.EqualFold(value, a) {
+				return
+			}
+		}
+		check(false, setting, "got %q, expected one of %s", value, strings.Join(allowed, ", "))
+	}
+
+	check(c.Server.Port != "", "API_PORT", "is required")
+	check((c.Server.TLSCertFile == "") == (c.Server.TLSKeyFile == ""), "TLS_CERT_FILE", "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	for _, origin := range c.Server.CORSAllowedOrigins {
+		if origin == "*" {
+			check(!c.Server.CORSAllowCredentials, "CORS_ALLOW_CREDENTIALS", "can't be used with CORS_ALLOWED_ORIGINS=*, list the origins instead")
+			continue
+		}
+		check(validOrigin(origin), "CORS_ALLOWED_ORIGINS", "expected * or http(s)://host[:port], got %q", origin)
+	}
+	check(c.Server.CORSMaxAge >= 0, "CORS_MAX_AGE", "must not be negative, got %s", c.Server.CORSMaxAge)
+
+	check(c.Auth.RateLimit >= 0, "RATE_LIMIT_PER_MINUTE", "must not be negative, got %d", c.Auth.RateLimit)
+	for role, limit := range c.Auth.RateLimitRoles {
+		check(role != "" && limit >= 0, "RATE_LIMIT_ROLES", "expected role:limit with a limit of 0 or more, got %s:%d", role, limit)
+	}
+
+	check(c.Auth.LoginMaxAttempts >= 0, "LOGIN_MAX_ATTEMPTS", "must not be negative, got %d", c.Auth.LoginMaxAttempts)
+	check(c.Auth.LoginLockout > 0, "LOGIN_LOCKOUT", "must be positive, got %s", c.Auth.LoginLockout)
+
+	check(c.Auth.PasswordMinLength >= 1, "PASSWORD_MIN_LENGTH", "must be at least 1, got %d", c.Auth.PasswordMinLength)
+	check(c.Auth.PasswordMaxLength == 0 || c.Auth.PasswordMaxLength >= c.Auth.PasswordMinLength, "PASSWORD_MAX_LENGTH", "must be 0 or at least PASSWORD_MIN_LENGTH, got %d", c.Auth.PasswordMaxLength)
+	check(c.Auth.PasswordMaxLength <= 72, "PASSWORD_MAX_LENGTH", "must be at most 72 bytes, bcrypt ignores the rest, got %d", c.Auth.PasswordMaxLength)
+	for _, class := range c.Auth.PasswordRequire {
+		oneOf(class, "PASSWORD_REQUIRE", "upper", "lower", "digit", "special")
+	}
+	check(c.Auth.PasswordMinEntropy >= 0, "PASSWORD_MIN_ENTROPY", "must not be negative, got %d", c.Auth.PasswordMinEntropy)
+	oneOf(c.Auth.PasswordHash, "PASSWORD_HASH", "bcrypt", "argon2id")
+	check(c.Auth.BcryptCost >= 4 && c.Auth.BcryptCost <= 31, "BCRYPT_COST", "must be between 4 and 31, got %d", c.Auth.BcryptCost)
+
+	check(c.Cache.Dir != "", "CACHE_DIR", "is required")
+	check(c.Cache.TTL > 0, "CACHE_TTL", "must be positive, got %s", c.Cache.TTL)
+	check(c.Cache.MaxSize > 0, "CACHE_MAX_SIZE", "must be positive, got %d", c.Cache.MaxSize)
+	check(c.Cache.MaxEntrySize >= 0, "CACHE_MAX_ENTRY_SIZE", "must not be negative, got %d", c.Cache.MaxEntrySize)
+	check(c.Cache.CleanupInterval >= 0, "CACHE_CLEANUP_INTERVAL", "must not be negative, got %s", c.Cache.CleanupInterval)
+	check(c.Cache.DegradedThreshold > 0, "CACHE_DEGRADED_THRESHOLD", "must be positive, got %d", c.Cache.DegradedThreshold)
+	oneOf(c.Cache.EvictionPolicy, "CACHE_EVICTION_POLICY", "lru", "lfu", "fifo")
+	check(c.Cache.TempMaxAge > 0, "CACHE_TEMP_MAX_AGE", "must be positive, got %s", c.Cache.TempMaxAge)
+	if c.Cache.Dir != "" {
+		if err := checkWritable(c.Cache.Dir); err != nil {
+			check(false, "CACHE_DIR", "%s is not writable: %v", c.Cache.Dir, err)
+		}
+	}
+
+	check(c.Rclone.BinPath != "", "RCLONE_BIN_PATH", "is required")
+	if c.Rclone.ConfigPath != "" {
+		info, err := os.Stat(c.Rclone.ConfigPath)
+		switch {
+		case err != nil:
+			check(false, "RCLONE_CONFIG_PATH", "%v", err)
+		case info.IsDir():
+			check(false, "RCLONE_CONFIG_PATH", "%s is a directory, expected rclone.conf", c.Rclone.ConfigPath)
+		}
+	}
+	check(c.Rclone.MaxConcurrency > 0, "RCLONE_MAX_CONCURRENCY", "must be positive, got %d", c.Rclone.MaxConcurrency)
+
+	check(len(c.Storage.Providers) > 0, "STORAGE_PROVIDERS", "at least one provider is required")
+	check(remoteName.MatchString(c.Storage.UnionName), "STORAGE_UNION_NAME", "expected an rclone remote name of letters, digits, '_' and '-', got %q", c.Storage.UnionName)
+	check(validUploadsPath(c.Storage.UploadsPath), "STORAGE_UPLOADS_PATH", "expected a relative directory such as uploads, got %q", c.Storage.UploadsPath)
+	for name, weight := range c.Storage.ProviderWeights {
+		check(name != "" && weight > 0, "STORAGE_PROVIDER_WEIGHTS", "expected name:weight with a positive weight, got %s:%v", name, weight)
+	}
+	check(c.Storage.Replicas > 0, "STORAGE_REPLICAS", "must be at least 1, got %d", c.Storage.Replicas)
+	check(c.Storage.DirectURLExpiry > 0, "DIRECT_URL_EXPIRY", "must be positive, got %s", c.Storage.DirectURLExpiry)
+	oneOf(c.Storage.StreamMode, "STREAM_MODE", "proxy", "redirect")
+	oneOf(c.Storage.DownloadDisposition, "DOWNLOAD_DISPOSITION", "attachment", "inline")
+	oneOf(c.Storage.ChecksumAlgo, "CHECKSUM_ALGORITHM", "md5", "sha256")
+	oneOf(c.Storage.NonSeekableMode, "STREAM_NON_SEEKABLE_MODE", "sequential", "remux")
+	check(c.Storage.ThumbnailOffset >= 0, "THUMBNAIL_VIDEO_OFFSET", "must not be negative, got %s", c.Storage.ThumbnailOffset)
+	check(c.Storage.UploadMaxSize >= 0, "UPLOAD_MAX_SIZE", "must not be negative, got %d", c.Storage.UploadMaxSize)
+	check(c.Storage.UploadResumeMaxAge > 0, "UPLOAD_RESUME_MAX_AGE", "must be positive, got %s", c.Storage.UploadResumeMaxAge)
+	for _, mimeType := range c.Storage.AllowedMimeTypes {
+		major, minor, ok := strings.Cut(mimeType, "/")
+		check(ok && major != "" && minor != "" && major != "*", "ALLOWED_MIME_TYPES", "expected type/subtype or type/*, got %s", mimeType)
+	}
+	for _, ext := range c.Storage.BlockedExtensions {
+		check(strings.HasPrefix(ext, ".") && len(ext) > 1, "BLOCKED_EXTENSIONS", "expected extensions such as .exe, got %s", ext)
+	}
+	oneOf(c.Storage.Deduplicate, "UPLOAD_DEDUPLICATE", "off", "user", "all")
+	check(c.Storage.UploadRetryAttempts > 0, "UPLOAD_RETRY_ATTEMPTS", "must be at least 1, got %d", c.Storage.UploadRetryAttempts)
+	check(c.Storage.UploadRetryBackoff >= 0, "UPLOAD_RETRY_BACKOFF", "must not be negative, got %s", c.Storage.UploadRetryBackoff)
+	check(c.Storage.ReadTimeout >= 0, "STORAGE_READ_TIMEOUT", "must not be negative, got %s", c.Storage.ReadTimeout)
+	check(c.Storage.HealthInterval > 0, "PROVIDER_HEALTH_INTERVAL", "must be positive, got %s", c.Storage.HealthInterval)
+	check(c.Storage.CircuitThreshold >= 0, "CIRCUIT_FAILURE_THRESHOLD", "must not be negative, got %d", c.Storage.CircuitThreshold)
+
+	if c.Encryption.Enabled() {
+		check(validKey(c.Encryption.Key), "ENCRYPTION_KEY", "expected a base64-encoded 32-byte key")
+		check(c.Encryption.KeyID != "", "ENCRYPTION_KEY_ID", "is required")
+	}
+	for id, key := range c.Encryption.OldKeys {
+		check(id != "" && validKey(key), "ENCRYPTION_OLD_KEYS", "expected id:key with a base64-encoded 32-byte key, got key %q", id)
+		check(!c.Encryption.Enabled() || id != c.Encryption.KeyID, "ENCRYPTION_OLD_KEYS", "key %q is already used by ENCRYPTION_KEY_ID", id)
+	}
+
+	oneOf(c.Listing.DefaultSort, "LIST_DEFAULT_SORT", "name", "size", "date", "type")
+	oneOf(c.Listing.DefaultOrder, "LIST_DEFAULT_ORDER", "asc", "desc")
+	oneOf(c.Listing.Source, "LIST_SOURCE", "db", "cloud")
+	check(c.Listing.ReconcileInterval >= 0, "LIST_RECONCILE_INTERVAL", "must not be negative, got %s", c.Listing.ReconcileInterval)
+
+	check(c.Share.MaxAge >= 0, "SHARE_MAX_AGE", "must not be negative, got %s", c.Share.MaxAge)
+
+	check(c.Monitor.StreamInterval >= time.Second, "MONITORING_STREAM_INTERVAL", "must be at least 1s, got %s", c.Monitor.StreamInterval)
+	check(c.Monitor.MaxStreamSubscribers > 0, "MONITORING_STREAM_MAX_SUBSCRIBERS", "must be positive, got %d", c.Monitor.MaxStreamSubscribers)
+	check(c.Monitor.MaxStreamsPerUser > 0, "MONITORING_STREAM_MAX_PER_USER", "must be positive, got %d", c.Monitor.MaxStreamsPerUser)
+
+	return problems
+}
+
+// validKey reports whether s is a base64-encoded AES-256 key
+func validKey(s string) bool {
+	key, err := base64.StdEncoding.DecodeString(s)
+	return err == nil && len(key) == 32
+}
+
+// validationError combines problems into a single error, nil when there are none
+func validationError(problems []string) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf("invalid configuration:\n  %s", strings.Join(problems, "\n  "))
+}
+
+// checkWritable creates dir if needed and makes sure files can be written in it
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return err
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+// validOrigin reports whether s is an origin as browsers send it: a scheme and host
+// with an optional port, nothing else
+func validOrigin(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		u.Path == "" && u.RawQuery == "" && u.Fragment == "" && u.User == nil
+}
+
+// remoteName matches the rclone remote names the storage package accepts
+var remoteName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// validUploadsPath reports whether p names a directory below a remote's root
+func validUploadsPath(p string) bool {
+	if p == "" || strings.Contains(p, ":") {
+		return false
+	}
+	for _, part := range strings.Split(p, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// loadValid loads the defaults with the rclone config and cache in a temporary
+// directory, failing the test if they don't validate
+func loadValid(t *testing.T) *Config {
+	t.Helper()
+	t.Setenv("RCLONE_CONFIG_PATH", writeFile(t, "rclone.conf", ""))
+	t.Setenv("CACHE_DIR", t.TempDir())
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("defaults don't validate: %v", err)
+	}
+	return cfg
+}
+
+func TestProblemsListsEverySetting(t *testing.T) {
+	cfg := loadValid(t)
+	cfg.Cache.TTL = 0
+	cfg.Storage.StreamMode = "teleport"
+	cfg.Storage.UploadsPath = "../uploads"
+	cfg.Server.CORSAllowedOrigins = []string{"https://app.example.com/path"}
+	cfg.Auth.PasswordMaxLength = 128
+
+	problems := cfg.problems()
+	want := []string{"CACHE_TTL", "STREAM_MODE", "STORAGE_UPLOADS_PATH", "CORS_ALLOWED_ORIGINS", "PASSWORD_MAX_LENGTH"}
+	if len(problems) != len(want) {
+		t.Fatalf("got %d problems, want %d: %v", len(problems), len(want), problems)
+	}
+	for _, setting := range want {
+		if !strings.Contains(strings.Join(problems, "\n"), setting+":") {
+			t.Errorf("no problem reported for %s: %v", setting, problems)
+		}
+	}
+}
+
+func TestLoadRejectsUnparsableValues(t *testing.T) {
+	t.Setenv("CACHE_TTL", "soon")
+	t.Setenv("STORAGE_REPLICAS", "two")
+	t.Setenv("RCLONE_CONFIG_PATH", writeFile(t, "rclone.conf", ""))
+	t.Setenv("CACHE_DIR", t.TempDir())
+
+	_, err := Load()
+	if err == nil {
+		t.Fatal("got no error")
+	}
+	for _, setting := range []string{"CACHE_TTL", "STORAGE_REPLICAS"} {
+		if !strings.Contains(err.Error(), setting) {
+			t.Errorf("error doesn't mention %s: %v", setting, err)
+		}
+	}
+}
+
+func TestValidOrigin(t *testing.T) {
+	for origin, want := range map[string]bool{
+		"https://app.example.com":      true,
+		"http://localhost:3000":        true,
+		"app.example.com":              false,
+		"https://app.example.com/":     false,
+		"ftp://app.example.com":        false,
+		"https://user@app.example.com": false,
+	} {
+		if got := validOrigin(origin); got != want {
+			t.Errorf("validOrigin(%q) = %v, want %v", origin, got, want)
+		}
+	}
+}
+
+func TestValidUploadsPath(t *testing.T) {
+	for path, want := range map[string]bool{
+		"uploads":       true,
+		"data/uploads":  true,
+		"":              false,
+		"/uploads":      false,
+		"uploads/":      false,
+		"a/../b":        false,
+		"remote:upload": false,
+	} {
+		if got := validUploadsPath(path); got != want {
+			t.Errorf("validUploadsPath(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestUploadRestrictions(t *testing.T) {
+	t.Setenv("ALLOWED_MIME_TYPES", "Image/*, application/pdf")
+	t.Setenv("BLOCKED_EXTENSIONS", ".EXE,.bat")
+	cfg := loadValid(t)
+	if want := []string{"image/*", "application/pdf"}; !reflect.DeepEqual(cfg.Storage.AllowedMimeTypes, want) {
+		t.Errorf("got allowed types %v, want %v", cfg.Storage.AllowedMimeTypes, want)
+	}
+	if want := []string{".exe", ".bat"}; !reflect.DeepEqual(cfg.Storage.BlockedExtensions, want) {
+		t.Errorf("got blocked extensions %v, want %v", cfg.Storage.BlockedExtensions, want)
+	}
+
+	cfg.Storage.AllowedMimeTypes = []string{"*/*"}
+	cfg.Storage.BlockedExtensions = []string{"exe"}
+	problems := strings.Join(cfg.problems(), "\n")
+	for _, setting := range []string{"ALLOWED_MIME_TYPES", "BLOCKED_EXTENSIONS"} {
+		if !strings.Contains(problems, setting+":") {
+			t.Errorf("no problem reported for %s: %v", setting, problems)
+		}
+	}
+}
+
+func TestEncryptionKeys(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	t.Setenv("ENCRYPTION_KEY", key)
+	t.Setenv("ENCRYPTION_KEY_ID", "2")
+	t.Setenv("ENCRYPTION_OLD_KEYS", "1:"+key)
+	cfg := loadValid(t)
+	if keys, err := cfg.Encryption.Keys(); err != nil || len(keys) != 2 || len(keys["1"]) != 32 || len(keys["2"]) != 32 {
+		t.Errorf("got %d keys, %v, want keys 1 and 2", len(keys), err)
+	}
+
+	cfg.Encryption.Key = base64.StdEncoding.EncodeToString(make([]byte, 16))
+	cfg.Encryption.OldKeys = map[string]string{"2": key}
+	problems := strings.Join(cfg.problems(), "\n")
+	if !strings.Contains(problems, "ENCRYPTION_KEY:") || !strings.Contains(problems, "ENCRYPTION_OLD_KEYS:") {
+		t.Errorf("got problems %v, want the short key and the reused ID reported", problems)
+	}
+}
+
+func TestCORSCredentialsNeedListedOrigins(t *testing.T) {
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	t.Setenv("RCLONE_CONFIG_PATH", writeFile(t, "rclone.conf", ""))
+	t.Setenv("CACHE_DIR", t.TempDir())
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "CORS_ALLOW_CREDENTIALS") {
+		t.Errorf("got %v, want credentials with CORS_ALLOWED_ORIGINS=* rejected", err)
+	}
+
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example.com")
+	cfg := loadValid(t)
+	if !cfg.Server.CORSAllowCredentials || cfg.Server.CORSMaxAge != 12*time.Hour {
+		t.Errorf("got credentials %v, max age %s, want credentials with the 12h default", cfg.Server.CORSAllowCredentials, cfg.Server.CORSMaxAge)
+	}
+}
+
+func TestUnionName(t *testing.T) {
+	t.Setenv("STORAGE_UNION_NAME", "vault")
+	t.Setenv("STORAGE_UPLOADS_PATH", "/media/files/")
+	cfg := loadValid(t)
+	if got := cfg.Storage.ObjectPath(cfg.Storage.UnionName, "a.txt"); got != "vault:media/files/a.txt" {
+		t.Errorf("got object path %q, want vault:media/files/a.txt", got)
+	}
+
+	cfg.Storage.UnionName = "vault:"
+	if problems := strings.Join(cfg.problems(), "\n"); !strings.Contains(problems, "STORAGE_UNION_NAME:") {
+		t.Errorf("no problem reported for a remote name with a colon: %v", problems)
+	}
+}
@@ -0,0 +1,261 @@
+// Package crypt encrypts files at rest with AES-256-GCM.
+//
+// A file is sealed in chunks of ChunkSize bytes, each with its own GCM tag, so any
+// part of it can be decrypted without reading what comes before. Every file gets a
+// random nonce and chunk i is sealed with that nonce with i XORed into its last 8
+// bytes. The last chunk is sealed with different additional data than the others,
+// so a truncated object fails to decrypt instead of looking like a shorter file.
+package crypt
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	KeySize   = 32       // AES-256
+	NonceSize = 12       // standard GCM nonce
+	ChunkSize = 64 << 10 // plaintext bytes per chunk
+
+	// Overhead is the GCM tag every chunk carries
+	Overhead = 16
+)
+
+// ErrUnknownKey is returned for a file sealed with a key that isn't configured
+var ErrUnknownKey = errors.New("encryption key not configured")
+
+// ErrCorrupt is returned when a chunk fails authentication or is cut short
+var ErrCorrupt = errors.New("encrypted file is corrupt or truncated")
+
+// Keyring holds the keys files can be decrypted with by ID, and the ID of the one
+// new files are encrypted with
+type Keyring struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// NewKeyring builds a keyring from raw keys. current names the key new files are
+// encrypted with, empty to only decrypt existing files.
+func NewKeyring(current string, keys map[string][]byte) (*Keyring, error) {
+	k := &Keyring{current: current, keys: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("key %s is %d bytes, expected %d", id, len(key), KeySize)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		k.keys[id] = aead
+	}
+	if _, ok := k.keys[current]; current != "" && !ok {
+		return nil, fmt.Errorf("key %s: %w", current, ErrUnknownKey)
+	}
+	return k, nil
+}
+
+// Current returns the ID of the key new files are encrypted with, empty when new
+// files are stored in the clear
+func (k *Keyring) Current() string {
+	return k.current
+}
+
+func (k *Keyring) aead(keyID string) (cipher.AEAD, error) {
+	aead, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("key %s: %w", keyID, ErrUnknownKey)
+	}
+	return aead, nil
+}
+
+// NewNonce returns a random nonce for a new file
+func NewNonce() ([]byte, error) {
+	nonce := make([]byte, NonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return nonce, nil
+}
+
+// SealedSize returns the size of a file of size bytes once encrypted. An empty file
+// is one empty chunk.
+func SealedSize(size int64) int64 {
+	return size + max((size+ChunkSize-1)/ChunkSize, 1)*Overhead
+}
+
+// Range returns the part of an encrypted file of size bytes that holds plaintext
+// bytes start to end (inclusive): the first chunk it spans, the byte offset and
+// length of the chunks in the encrypted file, and how many bytes of the first chunk
+// come before start. Reads are always whole chunks.
+func Range(start, end, size int64) (first, offset, length, skip int64) {
+	first = start / ChunkSize
+	last := end / ChunkSize
+	offset = first * (ChunkSize + Overhead)
+	length = min((last+1)*(ChunkSize+Overhead), SealedSize(size)) - offset
+	return first, offset, length, start - first*ChunkSize
+}
+
+// chunkNonce derives the nonce of chunk index from the file's nonce
+func chunkNonce(dst, nonce []byte, index int64) []byte {
+	dst = append(dst[:0], nonce...)
+	counter := binary.BigEndian.Uint64(dst[NonceSize-8:]) ^ uint64(index)
+	binary.BigEndian.PutUint64(dst[NonceSize-8:], counter)
+	return dst
+}
+
+// chunkData is the additional data marking the last chunk of a file
+func chunkData(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// Encrypt returns a reader yielding r encrypted with key keyID under nonce
+func (k *Keyring) Encrypt(r io.Reader, keyID string, nonce []byte) (io.Reader, error) {
+	aead, err := k.aead(keyID)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != NonceSize {
+		return nil, fmt.Errorf("nonce is %d bytes, expected %d", len(nonce), NonceSize)
+	}
+	return &sealer{
+		aead:  aead,
+		nonce: nonce,
+		src:   bufio.NewReaderSize(r, ChunkSize),
+		plain: make([]byte, ChunkSize),
+	}, nil
+}
+
+// sealer encrypts a stream one chunk at a time
+type sealer struct {
+	aead  cipher.AEAD
+	nonce []byte
+	src   *bufio.Reader
+	index int64
+	done  bool
+
+	plain  []byte
+	iv     []byte
+	sealed []byte // encrypted chunk not read yet
+}
+
+func (s *sealer) Read(p []byte) (int, error) {
+	for len(s.sealed) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		if err := s.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, s.sealed)
+	s.sealed = s.sealed[n:]
+	return n, nil
+}
+
+// next seals the following chunk, peeking ahead to tell whether it is the last one
+func (s *sealer) next() error {
+	n, err := io.ReadFull(s.src, s.plain)
+	switch err {
+	case nil:
+		if _, err := s.src.Peek(1); err == io.EOF {
+			s.done = true
+		} else if err != nil {
+			return err
+		}
+	case io.EOF, io.ErrUnexpectedEOF:
+		s.done = true
+	default:
+		return err
+	}
+
+	s.iv = chunkNonce(s.iv, s.nonce, s.index)
+	s.sealed = s.aead.Seal(s.sealed[:0], s.iv, s.plain[:n], chunkData(s.done))
+	s.index++
+	return nil
+}
+
+// Decrypt returns a reader yielding the plaintext of a file of size bytes sealed with
+// key keyID under nonce, from r positioned at the start of chunk first (see Range).
+// A chunk that fails authentication is reported as an error, never returned.
+func (k *Keyring) Decrypt(r io.Reader, keyID string, nonce []byte, first, size int64) (io.Reader, error) {
+	aead, err := k.aead(keyID)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != NonceSize {
+		return nil, fmt.Errorf("nonce is %d bytes, expected %d", len(nonce), NonceSize)
+	}
+	return &opener{
+		aead:   aead,
+		nonce:  nonce,
+		src:    r,
+		index:  first,
+		last:   max(size-1, 0) / ChunkSize,
+		size:   size,
+		sealed: make([]byte, ChunkSize+Overhead),
+	}, nil
+}
+
+// opener decrypts a stream one chunk at a time
+type opener struct {
+	aead  cipher.AEAD
+	nonce []byte
+	src   io.Reader
+	index int64
+	last  int64 // index of the file's last chunk
+	size  int64
+
+	iv     []byte
+	sealed []byte
+	plain  []byte // decrypted chunk not read yet
+}
+
+func (o *opener) Read(p []byte) (int, error) {
+	for len(o.plain) == 0 {
+		if o.index > o.last {
+			return 0, io.EOF
+		}
+		if err := o.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, o.plain)
+	o.plain = o.plain[n:]
+	return n, nil
+}
+
+func (o *opener) next() error {
+	length := int64(ChunkSize + Overhead)
+	if o.index == o.last {
+		length = o.size - o.last*ChunkSize + Overhead
+	}
+	sealed := o.sealed[:length]
+	if _, err := io.ReadFull(o.src, sealed); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrCorrupt
+		}
+		return err
+	}
+
+	o.iv = chunkNonce(o.iv, o.nonce, o.index)
+	plain, err := o.aead.Open(sealed[:0], o.iv, sealed, chunkData(o.index == o.last))
+	if err != nil {
+		return ErrCorrupt
+	}
+	o.plain = plain
+	o.index++
+	return nil
+}
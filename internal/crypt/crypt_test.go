@@ -0,0 +1,154 @@
+package crypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+// newTestKeyring returns a keyring with random keys "old" and "new", encrypting with "new"
+func newTestKeyring(t *testing.T) *Keyring {
+	t.Helper()
+	keys := make(map[string][]byte)
+	for _, id := range []string{"old", "new"} {
+		keys[id] = make([]byte, KeySize)
+		rand.Read(keys[id])
+	}
+	k, err := NewKeyring("new", keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+// seal encrypts plain with keyID under a fresh nonce
+func seal(t *testing.T, k *Keyring, keyID string, plain []byte) ([]byte, []byte) {
+	t.Helper()
+	nonce, err := NewNonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := k.Encrypt(bytes.NewReader(plain), keyID, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sealed, nonce
+}
+
+// open decrypts sealed from chunk first on, for a file of size bytes
+func open(k *Keyring, keyID string, nonce, sealed []byte, first, size int64) ([]byte, error) {
+	r, err := k.Decrypt(bytes.NewReader(sealed), keyID, nonce, first, size)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestRoundTrip(t *testing.T) {
+	k := newTestKeyring(t)
+	for _, size := range []int{0, 1, ChunkSize - 1, ChunkSize, ChunkSize + 1, 3*ChunkSize + 100} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+		for _, keyID := range []string{"old", "new"} {
+			sealed, nonce := seal(t, k, keyID, plain)
+			if int64(len(sealed)) != SealedSize(int64(size)) {
+				t.Errorf("%d bytes: sealed to %d, SealedSize says %d", size, len(sealed), SealedSize(int64(size)))
+			}
+			if size >= ChunkSize && bytes.Contains(sealed, plain[:64]) {
+				t.Errorf("%d bytes: plaintext visible in the sealed file", size)
+			}
+			got, err := open(k, keyID, nonce, sealed, 0, int64(size))
+			if err != nil || !bytes.Equal(got, plain) {
+				t.Errorf("%d bytes with key %s: got %d bytes back, %v", size, keyID, len(got), err)
+			}
+		}
+	}
+}
+
+func TestRange(t *testing.T) {
+	k := newTestKeyring(t)
+	size := int64(3*ChunkSize + 100)
+	plain := make([]byte, size)
+	rand.Read(plain)
+	sealed, nonce := seal(t, k, "new", plain)
+
+	for _, rng := range [][2]int64{
+		{0, 0},
+		{ChunkSize - 1, ChunkSize},
+		{ChunkSize + 10, 2*ChunkSize + 10},
+		{3 * ChunkSize, size - 1},
+		{0, size - 1},
+	} {
+		start, end := rng[0], rng[1]
+		first, offset, length, skip := Range(start, end, size)
+		if offset+length > int64(len(sealed)) {
+			t.Errorf("%d-%d: range %d+%d past the sealed file", start, end, offset, length)
+			continue
+		}
+		// Only the chunks of the range are there, reading on would fail
+		r, err := k.Decrypt(bytes.NewReader(sealed[offset:offset+length]), "new", nonce, first, size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, skip+end-start+1)
+		if _, err := io.ReadFull(r, got); err != nil {
+			t.Errorf("%d-%d: %v", start, end, err)
+			continue
+		}
+		if !bytes.Equal(got[skip:], plain[start:end+1]) {
+			t.Errorf("%d-%d: decrypted the wrong bytes", start, end)
+		}
+	}
+}
+
+func TestTamperingDetected(t *testing.T) {
+	k := newTestKeyring(t)
+	size := int64(2*ChunkSize + 10)
+	plain := make([]byte, size)
+	sealed, nonce := seal(t, k, "new", plain)
+
+	flipped := bytes.Clone(sealed)
+	flipped[ChunkSize+Overhead+5] ^= 1
+	swapped := append(bytes.Clone(sealed[ChunkSize+Overhead:2*(ChunkSize+Overhead)]), sealed[:ChunkSize+Overhead]...)
+	swapped = append(swapped, sealed[2*(ChunkSize+Overhead):]...)
+
+	for name, tt := range map[string]struct {
+		sealed []byte
+		size   int64
+	}{
+		"flipped bit":      {flipped, size},
+		"truncated":        {sealed[:len(sealed)-1], size},
+		"last chunk cut":   {sealed[:2*(ChunkSize+Overhead)], 2 * ChunkSize},
+		"chunks reordered": {swapped, size},
+	} {
+		if _, err := open(k, "new", nonce, tt.sealed, 0, tt.size); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%s: got %v, want ErrCorrupt", name, err)
+		}
+	}
+
+	if _, err := open(k, "old", nonce, sealed, 0, size); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("wrong key: got %v, want ErrCorrupt", err)
+	}
+	if _, err := open(k, "gone", nonce, sealed, 0, size); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("unknown key: got %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestNewKeyring(t *testing.T) {
+	if _, err := NewKeyring("1", map[string][]byte{"1": make([]byte, 16)}); err == nil {
+		t.Error("accepted a 16-byte key")
+	}
+	if _, err := NewKeyring("2", map[string][]byte{"1": make([]byte, KeySize)}); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("current key missing: got %v, want ErrUnknownKey", err)
+	}
+	k, err := NewKeyring("", map[string][]byte{"1": make([]byte, KeySize)})
+	if err != nil || k.Current() != "" {
+		t.Errorf("decrypt-only keyring: got current %q, %v", k.Current(), err)
+	}
+}
@@ -0,0 +1,274 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Job types
+const (
+	TypeUpload    = "upload"
+	TypeVerify    = "verify"
+	TypeReplicate = "replicate"
+	TypeDelete    = "delete" // removal of an object whose file record is gone
+)
+
+// Job statuses
+const (
+	StatusRunning   = "running"
+	StatusRetrying  = "retrying" // waiting to run again after a failed attempt
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// retention is how long finished jobs are kept for status queries
+const retention = time.Hour
+
+// ErrNotFound is returned for unknown job IDs
+var ErrNotFound = errors.New("job not found")
+
+// ErrFinished is returned when cancelling a job that has already finished
+var ErrFinished = errors.New("job already finished")
+
+// Job is a long-running background operation owned by a user
+type Job struct {
+	ID        string      `json:"id"`
+	UserID    uint        `json:"user_id"`
+	Type      string      `json:"type"`
+	Status    string      `json:"status"`
+	Target    string      `json:"target,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Result    interface{} `json:"result,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+
+	// Retry state, Error holds the last failure while the job is retrying
+	Attempts    int        `json:"attempts"`
+	MaxAttempts int        `json:"max_attempts"`
+	NextRetryAt *time.Time `json:"next_retry_at,omitempty"`
+
+	cancel  context.CancelFunc
+	cleanup func()
+	done    chan struct{}
+}
+
+// Func is the work performed by a job, it must stop when ctx is cancelled.
+// The returned result is exposed on the job once it completes.
+type Func func(ctx context.Context) (interface{}, error)
+
+// RetryPolicy controls how failed jobs of a type are run again
+type RetryPolicy struct {
+	MaxAttempts int           // attempts including the first, 1 or less disables retries
+	Backoff     time.Duration // delay before the first retry, doubled after each failure
+	MaxBackoff  time.Duration // upper bound on the delay, 0 = unbounded
+}
+
+// delay returns how long to wait after the given failed attempt
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if p.MaxBackoff > 0 && delay >= p.MaxBackoff {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	return delay
+}
+
+// Manager runs and tracks background jobs
+type Manager struct {
+	jobs      map[string]*Job
+	policies  map[string]RetryPolicy
+	onFailure func(Job)
+	mu        sync.Mutex
+}
+
+// NewManager creates a new job manager
+func NewManager() *Manager {
+	return &Manager{
+		jobs:     make(map[string]*Job),
+		policies: make(map[string]RetryPolicy),
+	}
+}
+
+// SetRetryPolicy configures retries for jobs of jobType started afterwards
+func (m *Manager) SetRetryPolicy(jobType string, policy RetryPolicy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.policies[jobType] = policy
+}
+
+// OnFailure registers fn to be called with the final state of every job that fails
+// after exhausting its attempts. Cancelled jobs are not reported.
+func (m *Manager) OnFailure(fn func(Job)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.onFailure = fn
+}
+
+// active reports whether the job has not finished yet
+func (j *Job) active() bool {
+	return j.Status == StatusRunning || j.Status == StatusRetrying
+}
+
+// Start runs fn in the background as a new job. A failed fn is run again according
+// to the retry policy of jobType, so it must be safe to repeat. cleanup, if set, is
+// called once the job has finally failed or is cancelled to remove staging and
+// partial state.
+func (m *Manager) Start(userID uint, jobType, target string, fn Func, cleanup func()) Job {
+	ctx, cancel := context.WithCancel(context.Background())
+	now := time.Now()
+	job := &Job{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Type:      jobType,
+		Status:    StatusRunning,
+		Target:    target,
+		CreatedAt: now,
+		UpdatedAt: now,
+		cancel:    cancel,
+		cleanup:   cleanup,
+		done:      make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	m.prune()
+	policy := m.policies[jobType]
+	job.MaxAttempts = policy.MaxAttempts
+	if job.MaxAttempts < 1 {
+		job.MaxAttempts = 1
+	}
+	m.jobs[job.ID] = job
+	snapshot := *job
+	m.mu.Unlock()
+
+	go m.run(ctx, job, fn, policy)
+
+	return snapshot
+}
+
+func (m *Manager) run(ctx context.Context, job *Job, fn Func, policy RetryPolicy) {
+	defer close(job.done)
+
+	for attempt := 1; ; attempt++ {
+		m.mu.Lock()
+		if job.Status == StatusCancelled {
+			m.mu.Unlock()
+			return
+		}
+		job.Status = StatusRunning
+		job.Attempts = attempt
+		job.NextRetryAt = nil
+		job.UpdatedAt = time.Now()
+		m.mu.Unlock()
+
+		result, err := fn(ctx)
+
+		m.mu.Lock()
+		if job.Status == StatusCancelled {
+			// Cancel handles cleanup
+			m.mu.Unlock()
+			return
+		}
+		job.UpdatedAt = time.Now()
+
+		if err == nil {
+			job.cancel()
+			job.Status = StatusCompleted
+			job.Error = ""
+			job.Result = result
+			m.mu.Unlock()
+			return
+		}
+
+		job.Error = err.Error()
+		if attempt >= job.MaxAttempts {
+			job.cancel()
+			job.Status = StatusFailed
+			if job.cleanup != nil {
+				job.cleanup()
+			}
+			snapshot, onFailure := *job, m.onFailure
+			m.mu.Unlock()
+			if onFailure != nil {
+				onFailure(snapshot)
+			}
+			return
+		}
+
+		delay := policy.delay(attempt)
+		next := job.UpdatedAt.Add(delay)
+		job.Status = StatusRetrying
+		job.NextRetryAt = &next
+		m.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Get returns a snapshot of a job
+func (m *Manager) Get(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, exists := m.jobs[id]
+	if !exists {
+		return Job{}, ErrNotFound
+	}
+	return *job, nil
+}
+
+// Cancel stops a running job, waits for its work to return and cleans up partial state
+func (m *Manager) Cancel(id string) (Job, error) {
+	m.mu.Lock()
+	job, exists := m.jobs[id]
+	if !exists {
+		m.mu.Unlock()
+		return Job{}, ErrNotFound
+	}
+	if !job.active() {
+		snapshot := *job
+		m.mu.Unlock()
+		return snapshot, fmt.Errorf("%w: %s", ErrFinished, job.Status)
+	}
+	job.Status = StatusCancelled
+	job.UpdatedAt = time.Now()
+	job.cancel()
+	m.mu.Unlock()
+
+	// Wait for the process to exit before removing what it left behind
+	<-job.done
+	if job.cleanup != nil {
+		job.cleanup()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return *job, nil
+}
+
+// prune drops finished jobs older than retention, callers must hold the lock
+func (m *Manager) prune() {
+	for id, job := range m.jobs {
+		if !job.active() && time.Since(job.UpdatedAt) > retention {
+			delete(m.jobs, id)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor polls job id until it reaches status
+func waitFor(t *testing.T, m *Manager, id, status string) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := m.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status == status {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job is %s (%s), want %s", job.Status, job.Error, status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCancelStopsJob(t *testing.T) {
+	m := NewManager()
+	started := make(chan struct{})
+	var stopped, cleaned atomic.Bool
+	job := m.Start(1, TypeUpload, "union:uploads/f1", func(ctx context.Context) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		stopped.Store(true)
+		return nil, ctx.Err()
+	}, func() {
+		// Cleanup runs only once the work has returned
+		cleaned.Store(stopped.Load())
+	})
+	<-started
+
+	cancelled, err := m.Cancel(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled.Status != StatusCancelled {
+		t.Errorf("status %s, want cancelled", cancelled.Status)
+	}
+	if !cleaned.Load() {
+		t.Error("cleanup did not run after the work stopped")
+	}
+
+	if _, err := m.Cancel(job.ID); !errors.Is(err, ErrFinished) {
+		t.Errorf("second cancel: %v, want ErrFinished", err)
+	}
+}
+
+func TestCancelFinishedJob(t *testing.T) {
+	m := NewManager()
+	job := m.Start(1, TypeVerify, "", func(ctx context.Context) (interface{}, error) {
+		return "done", nil
+	}, nil)
+	finished := waitFor(t, m, job.ID, StatusCompleted)
+	if finished.Result != "done" {
+		t.Errorf("result %v", finished.Result)
+	}
+
+	if _, err := m.Cancel(job.ID); !errors.Is(err, ErrFinished) {
+		t.Errorf("got %v, want ErrFinished", err)
+	}
+	if _, err := m.Cancel("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown job: %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,80 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		if got := policy.delay(attempt); got != want {
+			t.Errorf("delay after attempt %d = %s, want %s", attempt, got, want)
+		}
+	}
+	unbounded := RetryPolicy{Backoff: time.Second}
+	if got := unbounded.delay(5); got != 16*time.Second {
+		t.Errorf("unbounded delay after attempt 5 = %s, want 16s", got)
+	}
+}
+
+func TestJobRetriesUntilSuccess(t *testing.T) {
+	m := NewManager()
+	m.SetRetryPolicy(TypeUpload, RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond})
+	var calls atomic.Int32
+	job := m.Start(1, TypeUpload, "", func(ctx context.Context) (interface{}, error) {
+		if calls.Add(1) < 3 {
+			return nil, errors.New("remote unreachable")
+		}
+		return "stored", nil
+	}, nil)
+
+	done := waitFor(t, m, job.ID, StatusCompleted)
+	if done.Attempts != 3 || done.Result != "stored" || done.Error != "" {
+		t.Errorf("job %+v, want completed on the third attempt", done)
+	}
+}
+
+func TestJobFailsAfterMaxAttempts(t *testing.T) {
+	m := NewManager()
+	m.SetRetryPolicy(TypeUpload, RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond})
+	var cleaned atomic.Bool
+	failed := make(chan Job, 1)
+	m.OnFailure(func(job Job) { failed <- job })
+	job := m.Start(1, TypeUpload, "", func(ctx context.Context) (interface{}, error) {
+		return nil, errors.New("remote unreachable")
+	}, func() { cleaned.Store(true) })
+
+	done := waitFor(t, m, job.ID, StatusFailed)
+	if done.Attempts != 2 || done.Error != "remote unreachable" {
+		t.Errorf("job %+v, want failed after 2 attempts", done)
+	}
+	if !cleaned.Load() {
+		t.Error("cleanup did not run")
+	}
+	select {
+	case reported := <-failed:
+		if reported.ID != job.ID {
+			t.Errorf("reported job %s, want %s", reported.ID, job.ID)
+		}
+	case <-time.After(time.Second):
+		t.Error("failure was not reported")
+	}
+}
+
+func TestJobWithoutPolicyRunsOnce(t *testing.T) {
+	m := NewManager()
+	var calls atomic.Int32
+	job := m.Start(1, TypeVerify, "", func(ctx context.Context) (interface{}, error) {
+		calls.Add(1)
+		return nil, errors.New("failed")
+	}, nil)
+
+	waitFor(t, m, job.ID, StatusFailed)
+	if calls.Load() != 1 {
+		t.Errorf("ran %d times, want once", calls.Load())
+	}
+}
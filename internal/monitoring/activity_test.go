@@ -0,0 +1,86 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+)
+
+func TestRecentActivity(t *testing.T) {
+	md := newTestDashboard(t)
+	db := md.authManager.DatabaseManager.GetDatabase()
+	owner := newUser(t, md, "owner@example.com")
+	other := newUser(t, md, "other@example.com")
+	admin, err := md.authManager.DatabaseManager.GetUserByEmail("admin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Recorded out of order, and with an action that isn't activity
+	start := time.Now().Add(-time.Hour)
+	for _, log := range []auth.AuditLog{
+		{UserID: owner.ID, Action: "download", Resource: "file1", Success: true, CreatedAt: start.Add(2 * time.Minute)},
+		{UserID: owner.ID, Action: "upload", Resource: "file1", Success: true, CreatedAt: start},
+		{UserID: other.ID, Action: "login", Success: true, CreatedAt: start.Add(3 * time.Minute)},
+		{UserID: owner.ID, Action: "delete", Resource: "file1", Success: false, Details: "not found", CreatedAt: start.Add(4 * time.Minute)},
+		{UserID: owner.ID, Action: "change_password", Success: true, CreatedAt: start.Add(5 * time.Minute)},
+	} {
+		if err := db.Create(&log).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		user  *auth.User
+		query string
+		want  []string
+	}{
+		{admin, "", []string{"delete", "login", "download", "upload"}},
+		{admin, "?limit=2", []string{"delete", "login"}},
+		{owner, "", []string{"delete", "download", "upload"}},
+	} {
+		w := get(t, md, "/api/v1/monitoring/activity"+tt.query, tt.user)
+		var body struct {
+			Data []struct {
+				Type        string    `json:"type"`
+				User        string    `json:"user"`
+				Description string    `json:"description"`
+				Timestamp   time.Time `json:"timestamp"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("got %d: %s", w.Code, w.Body.String())
+		}
+		var got []string
+		for i, activity := range body.Data {
+			got = append(got, activity.Type)
+			if i > 0 && activity.Timestamp.After(body.Data[i-1].Timestamp) {
+				t.Errorf("%s%s: %s listed after an older entry", tt.user.Email, tt.query, activity.Type)
+			}
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s%s: got %v, want %v", tt.user.Email, tt.query, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s%s: got %v, want %v", tt.user.Email, tt.query, got, tt.want)
+				break
+			}
+		}
+		if tt.query == "" && tt.user == owner {
+			if want := "File deleted by owner@example.com, failed (not found)"; body.Data[0].Description != want {
+				t.Errorf("got description %q, want %q", body.Data[0].Description, want)
+			}
+		}
+	}
+
+	for _, query := range []string{"limit=0", "limit=101", "limit=ten"} {
+		if w := get(t, md, "/api/v1/monitoring/activity?"+query, admin); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", query, w.Code)
+		}
+	}
+}
@@ -1,17 +1,21 @@
 package monitoring
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"net/http"
-	"os"
-	"os/exec"
 	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+	"github.com/nabilulilalbab/rclonestorage/internal/cache"
 	"github.com/nabilulilalbab/rclonestorage/internal/config"
+	"github.com/nabilulilalbab/rclonestorage/internal/storage"
 	"github.com/sirupsen/logrus"
 )
 
@@ -19,8 +23,12 @@ import (
 type MonitoringDashboard struct {
 	config      *config.Config
 	authManager *auth.AuthManager
+	storage     storage.UnionStorage
+	rclone      storage.RcloneClient
+	cache       *cache.Manager
 	logger      *logrus.Logger
 	startTime   time.Time
+	stream      *statsStream
 }
 
 // SystemStats represents overall system statistics
@@ -51,22 +59,41 @@ type StorageStats struct {
 	TotalSizeHuman  string   `json:"total_size_human"`
 	Providers       []string `json:"providers"`
 	ProviderCount   int      `json:"provider_count"`
+
+	// Usage breaks the uploads down by provider. Replicated files count on every
+	// provider holding a copy, so the sums may exceed the totals.
+	Usage map[string]ProviderUsage `json:"usage"`
+}
+
+// ProviderUsage is what a provider's uploads directory holds
+type ProviderUsage struct {
+	Files     int64  `json:"files"`
+	Size      int64  `json:"size"`
+	SizeHuman string `json:"size_human"`
+	Error     string `json:"error,omitempty"` // the listing failed, counts are zero
 }
 
-// UserStats represents user statistics
+// UserStats represents user statistics. TotalQuota sums the limited quotas only,
+// UnlimitedUsers have no quota.
 type UserStats struct {
-	TotalUsers   int64 `json:"total_users"`
-	ActiveUsers  int64 `json:"active_users"`
-	AdminUsers   int64 `json:"admin_users"`
-	TotalQuota   int64 `json:"total_quota"`
-	UsedQuota    int64 `json:"used_quota"`
+	TotalUsers     int64 `json:"total_users"`
+	ActiveUsers    int64 `json:"active_users"`
+	AdminUsers     int64 `json:"admin_users"`
+	UnlimitedUsers int64 `json:"unlimited_users"`
+	TotalQuota     int64 `json:"total_quota"`
+	UsedQuota      int64 `json:"used_quota"`
 }
 
-// ProviderStatus represents storage provider status
+// ProviderStatus represents storage provider status, as of the last background
+// health check. Status is "unknown" until the first check finished.
 type ProviderStatus struct {
-	Name   string `json:"name"`
-	Type   string `json:"type"`
-	Status string `json:"status"`
+	Name        string                 `json:"name"`
+	Type        string                 `json:"type"`
+	Status      string                 `json:"status"`
+	LastChecked *time.Time             `json:"last_checked,omitempty"`
+	LatencyMs   int64                  `json:"latency_ms"`
+	Error       string                 `json:"error,omitempty"`
+	Circuit     *storage.CircuitStatus `json:"circuit,omitempty"`
 }
 
 // PerformanceStats represents performance metrics
@@ -86,13 +113,18 @@ type UptimeInfo struct {
 }
 
 // NewMonitoringDashboard creates a new monitoring dashboard
-func NewMonitoringDashboard(cfg *config.Config, authManager *auth.AuthManager) *MonitoringDashboard {
-	return &MonitoringDashboard{
+func NewMonitoringDashboard(cfg *config.Config, authManager *auth.AuthManager, unionStorage storage.UnionStorage, rclone storage.RcloneClient, cacheManager *cache.Manager) *MonitoringDashboard {
+	md := &MonitoringDashboard{
 		config:      cfg,
 		authManager: authManager,
+		storage:     unionStorage,
+		rclone:      rclone,
+		cache:       cacheManager,
 		logger:      logrus.New(),
 		startTime:   time.Now(),
 	}
+	md.stream = newStatsStream(md, cfg.Monitor.StreamInterval, cfg.Monitor.MaxStreamSubscribers, cfg.Monitor.MaxStreamsPerUser)
+	return md
 }
 
 // SetupRoutes sets up monitoring dashboard routes
@@ -109,7 +141,9 @@ func (md *MonitoringDashboard) SetupRoutes(r *gin.Engine) {
 		monitoring.GET("/providers", md.GetProviderStatus)
 		monitoring.GET("/performance", md.GetPerformanceStats)
 		monitoring.GET("/realtime", md.GetRealtimeStats)
+		monitoring.GET("/stream", md.StreamStats)
 	monitoring.GET("/activity", md.GetRecentActivity)
+		monitoring.GET("/top-files", md.GetTopFiles)
 	}
 	
 	// Public monitoring endpoint (limited data)
@@ -128,15 +162,7 @@ func (md *MonitoringDashboard) SetupRoutes(r *gin.Engine) {
 // @Failure 401 {object} map[string]interface{} "Unauthorized"
 // @Router /monitoring/system [get]
 func (md *MonitoringDashboard) GetSystemStats(c *gin.Context) {
-	stats := &SystemStats{
-		System:      md.getSystemInfo(),
-		Storage:     md.getStorageStats(),
-		Users:       md.getUserStats(),
-		Cache:       md.getCacheStats(),
-		Providers:   md.getProviderStatus(),
-		Performance: md.getPerformanceStats(),
-		Uptime:      md.getUptimeInfo(),
-	}
+	stats := md.collectStats()
 
 	c.JSON(http.StatusOK, gin.H{
 		"status":    "success",
@@ -202,15 +228,7 @@ func (md *MonitoringDashboard) GetPerformanceStats(c *gin.Context) {
 // @Failure 401 {object} map[string]interface{} "Unauthorized"
 // @Router /monitoring/realtime [get]
 func (md *MonitoringDashboard) GetRealtimeStats(c *gin.Context) {
-	stats := SystemStats{
-		System:      md.getSystemInfo(),
-		Storage:     md.getStorageStats(),
-		Users:       md.getUserStats(),
-		Cache:       md.getCacheStats(),
-		Providers:   md.getProviderStatus(),
-		Performance: md.getPerformanceStats(),
-		Uptime:      md.getUptimeInfo(),
-	}
+	stats := md.collectStats()
 	
 	c.JSON(http.StatusOK, gin.H{
 		"status":    "success",
@@ -219,6 +237,110 @@ func (md *MonitoringDashboard) GetRealtimeStats(c *gin.Context) {
 	})
 }
 
+// GetTopFiles ranks the most accessed files
+// @Summary Get top files
+// @Description Rank files by downloads, streams or bytes served over a recent period. Admins see every file, other users only their own. Requests resuming a download or seeking in a stream add bytes but are not counted as new downloads or streams. Counters are kept per day (UTC), so the period starts at the beginning of its first day
+// @Tags monitoring
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param metric query string false "Ranking metric (downloads, streams, bytes)" default(downloads)
+// @Param range query string false "Period to rank over, in days (7d) or as a duration (12h)" default(7d)
+// @Param limit query int false "Number of files (1-100)" default(10)
+// @Success 200 {object} map[string]interface{} "Ranked files"
+// @Failure 400 {object} map[string]interface{} "Invalid metric, range or limit"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Router /monitoring/top-files [get]
+func (md *MonitoringDashboard) GetTopFiles(c *gin.Context) {
+	metric := c.DefaultQuery("metric", auth.MetricDownloads)
+	switch metric {
+	case auth.MetricDownloads, auth.MetricStreams, auth.MetricBytes:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "metric must be downloads, streams or bytes",
+		})
+		return
+	}
+
+	period, err := parsePeriod(c.DefaultQuery("range", "7d"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid range",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit < 1 || limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "limit must be between 1 and 100",
+		})
+		return
+	}
+
+	// Users other than admins only see their own files
+	var ownerID uint
+	scope := "all"
+	if !auth.IsAdmin(c) {
+		userID, exists := auth.GetCurrentUserID(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Authentication required",
+			})
+			return
+		}
+		ownerID = userID
+		scope = "own"
+	}
+
+	files, err := md.authManager.DatabaseManager.TopFiles(metric, time.Now().Add(-period), ownerID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to rank files",
+			"details": err.Error(),
+		})
+		return
+	}
+	if files == nil {
+		files = []auth.TopFile{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"metric": metric,
+			"range":  c.DefaultQuery("range", "7d"),
+			"scope":  scope,
+			"files":  files,
+		},
+		"timestamp": time.Now(),
+	})
+}
+
+// parsePeriod parses a period given in days ("7d") or as a Go duration ("12h")
+func parsePeriod(value string) (time.Duration, error) {
+	var period time.Duration
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number of days: %s", value)
+		}
+		period = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, err
+		}
+		period = d
+	}
+
+	if period <= 0 {
+		return 0, fmt.Errorf("range must be positive: %s", value)
+	}
+	return period, nil
+}
+
 // GetPublicMonitoring provides limited public monitoring data
 // @Summary Get public monitoring data
 // @Description Get limited public monitoring data (no authentication required)
@@ -255,6 +377,19 @@ func (md *MonitoringDashboard) GetPublicMonitoring(c *gin.Context) {
 	})
 }
 
+// collectStats gathers every statistic the dashboard shows
+func (md *MonitoringDashboard) collectStats() SystemStats {
+	return SystemStats{
+		System:      md.getSystemInfo(),
+		Storage:     md.getStorageStats(),
+		Users:       md.getUserStats(),
+		Cache:       md.getCacheStats(),
+		Providers:   md.getProviderStatus(),
+		Performance: md.getPerformanceStats(),
+		Uptime:      md.getUptimeInfo(),
+	}
+}
+
 // Helper methods
 func (md *MonitoringDashboard) getSystemInfo() SystemInfo {
 	return SystemInfo{
@@ -269,119 +404,175 @@ func (md *MonitoringDashboard) getSystemInfo() SystemInfo {
 
 func (md *MonitoringDashboard) getStorageStats() StorageStats {
 	// Get real file count and size from cloud
-	cmd := exec.Command("rclone", "lsjson", "union:uploads/")
-	if md.config.Rclone.ConfigPath != "" {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("RCLONE_CONFIG=%s", md.config.Rclone.ConfigPath))
-	}
-	
 	var totalFiles int64
 	var totalSize int64
 	
-	if output, err := cmd.Output(); err == nil {
-		var files []map[string]interface{}
-		if json.Unmarshal(output, &files) == nil {
-			totalFiles = int64(len(files))
-			for _, file := range files {
-				if size, ok := file["Size"].(float64); ok {
-					totalSize += int64(size)
-				}
-			}
+	if files, err := md.rclone.LsJSON(context.Background(), md.config.Storage.ObjectPath(md.config.Storage.UnionName, "")); err == nil {
+		totalFiles = int64(len(files))
+		for _, file := range files {
+			totalSize += file.Size
 		}
 	}
 	
+	providers := md.providerRemotes()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	
 	return StorageStats{
 		TotalFiles:     totalFiles,
 		TotalSize:      totalSize,
 		TotalSizeHuman: formatBytes(totalSize),
-		Providers:      []string{"mega1", "mega2", "mega3", "gdrive"},
-		ProviderCount:  4,
+		Providers:      names,
+		ProviderCount:  len(names),
+		Usage:          md.providerUsage(providers),
 	}
 }
 
-func (md *MonitoringDashboard) getUserStats() UserStats {
-	// Simple implementation - in real app, query database
-	return UserStats{
-		TotalUsers:  1,
-		ActiveUsers: 1,
-		AdminUsers:  1,
-		TotalQuota:  0,
-		UsedQuota:   0,
+// providerRemotes maps the configured providers to their rclone remotes, preferring
+// the union's current provider set over STORAGE_PROVIDERS
+func (md *MonitoringDashboard) providerRemotes() map[string]string {
+	remotes := make(map[string]string)
+	if md.storage != nil {
+		for _, provider := range md.storage.GetProviders() {
+			remotes[provider.Name()] = provider.Name()
+			if remote, ok := provider.(storage.RemoteProvider); ok {
+				remotes[provider.Name()] = remote.Remote()
+			}
+		}
+	}
+	if len(remotes) == 0 {
+		for _, name := range md.config.Storage.Providers {
+			remotes[name] = name
+		}
 	}
+	return remotes
 }
 
-func (md *MonitoringDashboard) getCacheStats() map[string]interface{} {
-	// Get real cache statistics from filesystem
-	cacheDir := "./cache/files"
-	
-	var totalFiles int64 = 0
-	var totalSize int64 = 0
+// providerUsage lists the uploads directory of every provider at once
+func (md *MonitoringDashboard) providerUsage(remotes map[string]string) map[string]ProviderUsage {
+	usage := make(map[string]ProviderUsage, len(remotes))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, remote := range remotes {
+		wg.Add(1)
+		go func(name, remote string) {
+			defer wg.Done()
 	
-	// Read directory and calculate stats
-	if entries, err := os.ReadDir(cacheDir); err == nil {
-		for _, entry := range entries {
-			if !entry.IsDir() {
-				totalFiles++
-				if info, err := entry.Info(); err == nil {
-					totalSize += info.Size()
+			var entry ProviderUsage
+			if files, err := md.rclone.LsJSON(context.Background(), md.config.Storage.ObjectPath(remote, "")); err != nil {
+				entry.Error = err.Error()
+			} else {
+				for _, file := range files {
+					if !file.IsDir {
+						entry.Files++
+						entry.Size += file.Size
+					}
 				}
 			}
-		}
+			entry.SizeHuman = formatBytes(entry.Size)
+	
+			mu.Lock()
+			usage[name] = entry
+			mu.Unlock()
+		}(name, remote)
+	}
+	wg.Wait()
+	return usage
+}
+
+func (md *MonitoringDashboard) getUserStats() UserStats {
+	totals, err := md.authManager.DatabaseManager.CountUsers()
+	if err != nil {
+		md.logger.Warnf("Failed to count users: %v", err)
+		return UserStats{}
 	}
 	
-	// If no real files with content, show at least the count
-	if totalFiles == 0 {
-		// Fallback: count files even if empty
-		if entries, err := os.ReadDir(cacheDir); err == nil {
-			totalFiles = int64(len(entries))
-		}
+	return UserStats{
+		TotalUsers:     totals.Users,
+		ActiveUsers:    totals.Active,
+		AdminUsers:     totals.Admins,
+		UnlimitedUsers: totals.Unlimited,
+		TotalQuota:     totals.Quota,
+		UsedQuota:      totals.Used,
 	}
+}
+
+func (md *MonitoringDashboard) getCacheStats() map[string]interface{} {
+	// Read from the shared cache manager's in-memory metadata instead of walking
+	// the cache directory on every poll
+	stats := md.cache.GetStats()
+	totalSize := stats["current_size"].(int64)
+	maxSize := stats["max_size"].(int64)
 	
-	maxSize := int64(10 * 1024 * 1024 * 1024) // 10GB
-	var usagePercent float64 = 0
-	if maxSize > 0 {
-		usagePercent = float64(totalSize) / float64(maxSize) * 100
+	// Files are still served while writes fail, they just aren't cached
+	status := "active"
+	if stats["degraded"].(bool) {
+		status = "degraded"
 	}
 	
 	return map[string]interface{}{
-		"total_files":      totalFiles,
+		"total_files":      stats["item_count"],
 		"total_size":       totalSize,
 		"total_size_human": formatBytes(totalSize),
-		"hit_rate":         0.85, // Mock hit rate
+		"hit_rate":         stats["hit_rate"],
+		"hits":             stats["hits"],
+		"misses":           stats["misses"],
 		"max_size":         maxSize,
 		"max_size_human":   formatBytes(maxSize),
-		"usage_percent":    usagePercent,
-		"cache_dir":        cacheDir,
-		"status":           "active",
-		"ttl":              "24h",
+		"usage_percent":    stats["usage_percent"],
+		"cache_dir":        stats["cache_dir"],
+		"status":           status,
+		"write_failures":   stats["write_failures"],
+		"ttl":              fmt.Sprintf("%gh", stats["ttl_hours"]),
 	}
 }
 
 func (md *MonitoringDashboard) getProviderStatus() []ProviderStatus {
-	providers := []string{"mega1", "mega2", "mega3", "gdrive"}
 	var status []ProviderStatus
 	
-	for _, provider := range providers {
-		// Test provider connection
-		cmd := exec.Command("rclone", "lsd", provider+":")
-		if md.config.Rclone.ConfigPath != "" {
-			cmd.Env = append(cmd.Env, fmt.Sprintf("RCLONE_CONFIG=%s", md.config.Rclone.ConfigPath))
-		}
-		
-		providerStatus := "offline"
-		if err := cmd.Run(); err == nil {
-			providerStatus = "online"
+	var circuits map[string]storage.CircuitStatus
+	var health map[string]storage.ProviderHealth
+	if md.storage != nil {
+		circuits = md.storage.CircuitStates()
+		health = md.storage.Health()
+	}
+	
+	for _, provider := range md.config.Storage.Providers {
+		// Probing happens in the background, see UnionStorageImpl.StartHealthChecks
+		providerStatus := "unknown"
+		checked, found := health[provider]
+		if found {
+			providerStatus = "offline"
+			if checked.Available {
+				providerStatus = "online"
+			}
 		}
 		
 		providerType := "mega"
 		if provider == "gdrive" {
 			providerType = "google_drive"
+		} else if strings.HasPrefix(provider, "b2") {
+			providerType = "backblaze_b2"
 		}
 		
-		status = append(status, ProviderStatus{
+		providerInfo := ProviderStatus{
 			Name:   provider,
 			Type:   providerType,
 			Status: providerStatus,
-		})
+		}
+		if found {
+			providerInfo.LastChecked = &checked.CheckedAt
+			providerInfo.LatencyMs = checked.LatencyMs
+			providerInfo.Error = checked.Error
+		}
+		if circuit, ok := circuits[provider]; ok {
+			providerInfo.Circuit = &circuit
+		}
+		
+		status = append(status, providerInfo)
 	}
 	
 	return status
@@ -394,7 +585,7 @@ func (md *MonitoringDashboard) getPerformanceStats() PerformanceStats {
 	return PerformanceStats{
 		MemoryUsage:       int64(m.Alloc),
 		MemoryUsageHuman:  formatBytes(int64(m.Alloc)),
-		CacheHitRate:      0.85, // Mock data
+		CacheHitRate:      md.cache.HitRate(),
 		RequestsPerSecond: 10,   // Mock data
 		AvgResponseTime:   150,  // Mock data in ms
 	}
@@ -409,9 +600,49 @@ func (md *MonitoringDashboard) getUptimeInfo() UptimeInfo {
 	}
 }
 
-// GetRecentActivity returns recent system activity
+// GetRecentActivity returns the latest uploads, downloads, deletes and logins
+// @Summary Get recent activity
+// @Description List the newest upload, download, delete, login and account lockout events from the audit log, newest first. Admins see every user's activity, other users only their own
+// @Tags monitoring
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param limit query int false "Number of entries (1-100)" default(10)
+// @Success 200 {object} map[string]interface{} "Recent activity"
+// @Failure 400 {object} map[string]interface{} "Invalid limit"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Router /monitoring/activity [get]
 func (md *MonitoringDashboard) GetRecentActivity(c *gin.Context) {
-	activities := md.getRecentActivity()
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit < 1 || limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "limit must be between 1 and 100",
+		})
+		return
+	}
+
+	// Users other than admins only see their own activity
+	var userID uint
+	if !auth.IsAdmin(c) {
+		id, exists := auth.GetCurrentUserID(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Authentication required",
+			})
+			return
+		}
+		userID = id
+	}
+
+	activities, err := md.getRecentActivity(userID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to load recent activity",
+			"details": err.Error(),
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"status":    "success",
 		"data":      activities,
@@ -419,115 +650,55 @@ func (md *MonitoringDashboard) GetRecentActivity(c *gin.Context) {
 	})
 }
 
-func (md *MonitoringDashboard) getRecentActivity() []map[string]interface{} {
-	activities := []map[string]interface{}{}
-	
-	// Get recent cache files
-	cacheDir := "./cache/files"
-	if entries, err := os.ReadDir(cacheDir); err == nil {
-		count := 0
-		for _, entry := range entries {
-			if !entry.IsDir() && count < 5 {
-				info, _ := entry.Info()
-				filename := entry.Name()
-				if len(filename) > 10 {
-					filename = filename[:10] + "..."
-				}
-				activities = append(activities, map[string]interface{}{
-					"type":        "cache",
-					"action":      "File cached",
-					"resource":    filename,
-					"timestamp":   info.ModTime(),
-					"description": "File added to cache storage",
-					"icon":        "fas fa-file",
-				})
-				count++
-			}
-		}
-	}
-	
-	// Get recent uploads from rclone
-	cmd := exec.Command("rclone", "lsjson", "union:uploads/", "--max-age", "24h")
-	if md.config.Rclone.ConfigPath != "" {
-		cmd.Env = append(os.Environ(), fmt.Sprintf("RCLONE_CONFIG=%s", md.config.Rclone.ConfigPath))
+// activityKinds are the audited actions shown as recent activity, with their label
+// and icon
+var activityKinds = map[string]struct{ label, icon string }{
+	"upload":         {"File uploaded", "fas fa-cloud-upload-alt"},
+	"download":       {"File downloaded", "fas fa-download"},
+	"download_zip":   {"Files downloaded as ZIP", "fas fa-file-archive"},
+	"delete":         {"File deleted", "fas fa-trash"},
+	"login":          {"User logged in", "fas fa-sign-in-alt"},
+	"account_locked": {"Account locked", "fas fa-lock"},
+}
+
+// getRecentActivity returns the newest audit records of activityKinds, those of one
+// user when userID is set
+func (md *MonitoringDashboard) getRecentActivity(userID uint, limit int) ([]map[string]interface{}, error) {
+	actions := make([]string, 0, len(activityKinds))
+	for action := range activityKinds {
+		actions = append(actions, action)
 	}
-	
-	if output, err := cmd.Output(); err == nil {
-		var files []map[string]interface{}
-		if json.Unmarshal(output, &files) == nil {
-			count := 0
-			for _, file := range files {
-				if count >= 3 {
-					break
-				}
-				if name, ok := file["Name"].(string); ok {
-					if modTime, ok := file["ModTime"].(string); ok {
-						if parsedTime, err := time.Parse(time.RFC3339, modTime); err == nil {
-							displayName := name
-							if len(displayName) > 15 {
-								displayName = displayName[:15] + "..."
-							}
-							activities = append(activities, map[string]interface{}{
-								"type":        "upload",
-								"action":      "File uploaded",
-								"resource":    displayName,
-								"timestamp":   parsedTime,
-								"description": "File uploaded to cloud storage",
-								"icon":        "fas fa-cloud-upload-alt",
-							})
-							count++
-						}
-					}
-				}
-			}
-		}
+
+	logs, _, err := md.authManager.DatabaseManager.ListAuditLogs(auth.AuditFilter{UserID: userID, Actions: actions}, 0, limit)
+	if err != nil {
+		return nil, err
 	}
-	
-	// Add system activities
-	activities = append(activities, map[string]interface{}{
-		"type":        "system",
-		"action":      "Server started",
-		"resource":    "RcloneStorage v1.0.0",
-		"timestamp":   md.startTime,
-		"description": "System initialization completed successfully",
-		"icon":        "fas fa-server",
-	})
-	
-	// Add monitoring access
-	activities = append(activities, map[string]interface{}{
-		"type":        "monitoring",
-		"action":      "Dashboard accessed",
-		"resource":    "Admin Panel",
-		"timestamp":   time.Now().Add(-time.Duration(len(activities)+1) * time.Minute),
-		"description": "Monitoring dashboard viewed by admin",
-		"icon":        "fas fa-chart-line",
-	})
-	
-	// Add authentication activity
-	activities = append(activities, map[string]interface{}{
-		"type":        "auth",
-		"action":      "User login",
-		"resource":    "admin@rclonestorage.local",
-		"timestamp":   time.Now().Add(-time.Duration(len(activities)+2) * time.Minute),
-		"description": "Administrator logged in successfully",
-		"icon":        "fas fa-sign-in-alt",
-	})
-	
-	// Sort by timestamp (newest first)
-	for i := 0; i < len(activities)-1; i++ {
-		for j := i + 1; j < len(activities); j++ {
-			if activities[i]["timestamp"].(time.Time).Before(activities[j]["timestamp"].(time.Time)) {
-				activities[i], activities[j] = activities[j], activities[i]
+
+	activities := make([]map[string]interface{}, 0, len(logs))
+	for _, log := range logs {
+		kind := activityKinds[log.Action]
+		description := fmt.Sprintf("%s by %s", kind.label, log.User.Email)
+		if !log.Success {
+			description += ", failed"
+			if log.Details != "" {
+				description += " (" + log.Details + ")"
 			}
 		}
+		activities = append(activities, map[string]interface{}{
+			"id":          log.ID,
+			"type":        log.Action,
+			"action":      kind.label,
+			"resource":    log.Resource,
+			"user_id":     log.UserID,
+			"user":        log.User.Email,
+			"success":     log.Success,
+			"timestamp":   log.CreatedAt,
+			"description": description,
+			"icon":        kind.icon,
+		})
 	}
-	
-	// Limit to 10 most recent activities
-	if len(activities) > 10 {
-		activities = activities[:10]
-	}
-	
-	return activities
+
+	return activities, nil
 }
 
 // formatBytes converts bytes to human readable format
@@ -0,0 +1,150 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+)
+
+func TestCacheStatsFromMemory(t *testing.T) {
+	md := newTestDashboard(t)
+	cachePut(t, md, "stream_a", "hello")
+	cachePut(t, md, "download_b", "world!")
+
+	// Files the manager doesn't know about aren't walked into the totals
+	stray := filepath.Join(md.config.Cache.Dir, "files", "stray")
+	if err := os.WriteFile(stray, make([]byte, 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := md.getCacheStats()
+	if stats["total_files"] != int64(2) || stats["total_size"] != int64(11) {
+		t.Errorf("got %v files of %v bytes, want 2 of 11", stats["total_files"], stats["total_size"])
+	}
+	if stats["status"] != "active" || stats["max_size"] != int64(1<<20) {
+		t.Errorf("status %v, max size %v", stats["status"], stats["max_size"])
+	}
+}
+
+func TestCacheEndpoint(t *testing.T) {
+	md := newTestDashboard(t)
+	cachePut(t, md, "stream_a", "hello")
+
+	if w := get(t, md, "/api/v1/monitoring/cache", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous: got %d, want 401", w.Code)
+	}
+
+	w := get(t, md, "/api/v1/monitoring/cache", newUser(t, md, "user@example.com"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Data struct {
+			TotalFiles int64 `json:"total_files"`
+			TotalSize  int64 `json:"total_size"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Data.TotalFiles != 1 || body.Data.TotalSize != 5 {
+		t.Errorf("got %d files of %d bytes, want 1 of 5", body.Data.TotalFiles, body.Data.TotalSize)
+	}
+}
+
+func TestTopFilesScope(t *testing.T) {
+	md := newTestDashboard(t)
+	db := md.authManager.DatabaseManager
+	owner := newUser(t, md, "owner@example.com")
+	other := newUser(t, md, "other@example.com")
+	for id, user := range map[string]*auth.User{"file1": owner, "file2": other} {
+		if err := db.CreateFileOwnership(user.ID, id, id+".txt", "union", 1, "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.RecordFileAccess(id, auth.AccessDownload, true, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	admin, err := db.GetUserByEmail("admin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		user  *auth.User
+		scope string
+		files int
+	}{{owner, "own", 1}, {admin, "all", 2}} {
+		w := get(t, md, "/api/v1/monitoring/top-files?range=1d", tt.user)
+		var body struct {
+			Data struct {
+				Scope string         `json:"scope"`
+				Files []auth.TopFile `json:"files"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("got %d: %s", w.Code, w.Body.String())
+		}
+		if body.Data.Scope != tt.scope || len(body.Data.Files) != tt.files {
+			t.Errorf("%s: got scope %s with %d files, want %s with %d", tt.user.Email, body.Data.Scope, len(body.Data.Files), tt.scope, tt.files)
+		}
+	}
+
+	for _, query := range []string{"metric=likes", "range=0d", "limit=101"} {
+		if w := get(t, md, "/api/v1/monitoring/top-files?"+query, owner); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestParsePeriod(t *testing.T) {
+	for value, want := range map[string]time.Duration{"7d": 7 * 24 * time.Hour, "12h": 12 * time.Hour} {
+		if got, err := parsePeriod(value); err != nil || got != want {
+			t.Errorf("%s: got %v, %v, want %v", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"d", "-1h", "soon"} {
+		if _, err := parsePeriod(value); err == nil {
+			t.Errorf("%s: got no error", value)
+		}
+	}
+}
+
+func TestUserStats(t *testing.T) {
+	md := newTestDashboard(t)
+	dm := md.authManager.DatabaseManager
+	newUser(t, md, "a@example.com")
+	inactive := newUser(t, md, "b@example.com")
+	inactive.IsActive = false
+	inactive.StorageUsed = 300
+	if err := dm.UpdateUser(inactive); err != nil {
+		t.Fatal(err)
+	}
+
+	w := get(t, md, "/api/v1/monitoring/users", newUser(t, md, "c@example.com"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data UserStats `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	want := UserStats{
+		TotalUsers:     4,
+		ActiveUsers:    3,
+		AdminUsers:     1,
+		UnlimitedUsers: 1,
+		TotalQuota:     3 * auth.DefaultUserQuota,
+		UsedQuota:      300,
+	}
+	if resp.Data != want {
+		t.Errorf("got %+v, want %+v", resp.Data, want)
+	}
+}
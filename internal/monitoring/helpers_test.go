@@ -0,0 +1,96 @@
+package monitoring
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+	"github.com/nabilulilalbab/rclonestorage/internal/cache"
+	"github.com/nabilulilalbab/rclonestorage/internal/config"
+	"github.com/nabilulilalbab/rclonestorage/internal/storage"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// emptyRclone is an rclone whose remotes hold no files, only listing is supported
+type emptyRclone struct {
+	storage.RcloneClient
+}
+
+func (emptyRclone) LsJSON(ctx context.Context, remote string, args ...string) ([]*storage.FileInfo, error) {
+	return nil, nil
+}
+
+// newTestDashboard builds a dashboard over a fresh database and cache, with an empty
+// union and remotes
+func newTestDashboard(t *testing.T) *MonitoringDashboard {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := &config.Config{
+		Cache:   config.CacheConfig{Dir: filepath.Join(dir, "cache"), TTL: time.Hour, MaxSize: 1 << 20},
+		Storage: config.StorageConfig{UnionName: "union", UploadsPath: "uploads"},
+		Monitor: config.MonitorConfig{StreamInterval: time.Hour, MaxStreamSubscribers: 3, MaxStreamsPerUser: 2},
+	}
+
+	authManager, err := auth.NewAuthManager(filepath.Join(dir, "auth.db"), "test-secret", "admin@example.com", "Admin-Passw0rd!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cacheManager, err := cache.NewManager(cfg.Cache.Dir, cfg.Cache.TTL, cfg.Cache.MaxSize, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cacheManager.Close()
+		authManager.Close()
+	})
+
+	md := NewMonitoringDashboard(cfg, authManager, storage.NewUnionStorage(), emptyRclone{}, cacheManager)
+	md.logger.SetOutput(io.Discard)
+	return md
+}
+
+// newUser creates a user with the user role
+func newUser(t *testing.T, md *MonitoringDashboard, email string) *auth.User {
+	t.Helper()
+	user, err := md.authManager.DatabaseManager.CreateUser(email, "User-Passw0rd!", auth.RoleUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// cachePut caches data under key
+func cachePut(t *testing.T, md *MonitoringDashboard, key, data string) {
+	t.Helper()
+	if _, err := md.cache.Put(context.Background(), key, strings.NewReader(data), int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// get sends a GET request through the dashboard's routes as user
+func get(t *testing.T, md *MonitoringDashboard, path string, user *auth.User) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if user != nil {
+		token, err := md.authManager.JWTManager.GenerateToken(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	r := gin.New()
+	md.SetupRoutes(r)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
@@ -0,0 +1,199 @@
+package monitoring
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/rclonestorage/internal/auth"
+)
+
+// errTooManySubscribers is returned when MONITORING_STREAM_MAX_SUBSCRIBERS clients
+// are already connected
+var errTooManySubscribers = errors.New("too many live monitoring connections")
+
+// errTooManyUserStreams is returned when the user already holds
+// MONITORING_STREAM_MAX_PER_USER connections
+var errTooManyUserStreams = errors.New("too many live monitoring connections for this user")
+
+// streamEvent is one Server-Sent Event
+type streamEvent struct {
+	name string
+	data interface{}
+
+	ownerID uint // when set, only the owner and admins get the event
+	private bool
+}
+
+// streamSubscriber is who a client of the stream is connected as
+type streamSubscriber struct {
+	userID uint
+	admin  bool
+}
+
+// statsStream fans SystemStats snapshots out to the clients of GET /monitoring/stream.
+// One goroutine gathers the stats while anyone is subscribed, so the cost doesn't
+// grow with the number of dashboards open.
+type statsStream struct {
+	md       *MonitoringDashboard
+	interval time.Duration
+	max      int
+	perUser  int
+
+	mu          sync.Mutex
+	subscribers map[chan streamEvent]streamSubscriber
+	stop        chan struct{} // closed when the last subscriber leaves
+	refresh     chan struct{} // asks for a snapshot before the next tick
+}
+
+func newStatsStream(md *MonitoringDashboard, interval time.Duration, max, perUser int) *statsStream {
+	return &statsStream{
+		md:          md,
+		interval:    interval,
+		max:         max,
+		perUser:     perUser,
+		subscribers: make(map[chan streamEvent]streamSubscriber),
+		refresh:     make(chan struct{}, 1),
+	}
+}
+
+// subscribe registers a client, starting the stats loop for the first one. Each new
+// client gets a snapshot right away.
+func (s *statsStream) subscribe(subscriber streamSubscriber) (chan streamEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	held := 0
+	for _, other := range s.subscribers {
+		if other.userID == subscriber.userID {
+			held++
+		}
+	}
+	if held >= s.perUser {
+		return nil, errTooManyUserStreams
+	}
+	if len(s.subscribers) >= s.max {
+		return nil, errTooManySubscribers
+	}
+	events := make(chan streamEvent, 4)
+	s.subscribers[events] = subscriber
+	if len(s.subscribers) == 1 {
+		s.stop = make(chan struct{})
+		go s.run(s.stop)
+	}
+	s.requestRefresh()
+	return events, nil
+}
+
+// unsubscribe removes a client, stopping the stats loop after the last one
+func (s *statsStream) unsubscribe(events chan streamEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.subscribers, events)
+	if len(s.subscribers) == 0 && s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// run pushes a snapshot every interval and on request until stop is closed
+func (s *statsStream) run(stop chan struct{}) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-s.refresh:
+		}
+		s.broadcast(streamEvent{name: "stats", data: s.md.collectStats()})
+	}
+}
+
+// broadcast sends an event to every client allowed to see it. A client still busy
+// with earlier events misses it rather than holding up the others.
+func (s *statsStream) broadcast(event streamEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for events, subscriber := range s.subscribers {
+		if event.private && !subscriber.admin && subscriber.userID != event.ownerID {
+			continue
+		}
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+func (s *statsStream) requestRefresh() {
+	select {
+	case s.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// FileChanged pushes a file event to the live dashboards of the owner and admins and
+// a fresh snapshot to all of them, it is registered with api.API.OnFileChange
+func (md *MonitoringDashboard) FileChanged(event, fileID string, ownerID uint) {
+	md.stream.broadcast(streamEvent{name: "file", ownerID: ownerID, private: true, data: gin.H{
+		"event":     event,
+		"file_id":   fileID,
+		"timestamp": time.Now(),
+	}})
+	md.stream.requestRefresh()
+}
+
+// StreamStats pushes live statistics as Server-Sent Events
+// @Summary Stream live statistics
+// @Description Server-Sent Events stream for the monitoring dashboard. A "stats" event carrying the same data as /monitoring/realtime is sent on connect, every MONITORING_STREAM_INTERVAL and after each upload or delete, which is also announced by a "file" event to the file's owner and admins. At most MONITORING_STREAM_MAX_SUBSCRIBERS clients can be connected at once, MONITORING_STREAM_MAX_PER_USER of them by the same user
+// @Tags monitoring
+// @Produce text/event-stream
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Success 200 {string} string "Event stream"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 429 {object} map[string]interface{} "Too many live connections of this user"
+// @Failure 503 {object} map[string]interface{} "Too many live connections"
+// @Router /monitoring/stream [get]
+func (md *MonitoringDashboard) StreamStats(c *gin.Context) {
+	userID, _ := auth.GetCurrentUserID(c)
+	events, err := md.stream.subscribe(streamSubscriber{userID: userID, admin: auth.IsAdmin(c)})
+	if errors.Is(err, errTooManyUserStreams) {
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":   "Live monitoring unavailable",
+			"details": err.Error(),
+		})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":   "Live monitoring unavailable",
+			"details": err.Error(),
+		})
+		return
+	}
+	defer md.stream.unsubscribe(events)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // stop nginx from buffering the stream
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event := <-events:
+			c.SSEvent(event.name, event.data)
+			c.Writer.Flush()
+		}
+	}
+}
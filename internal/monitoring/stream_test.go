@@ -0,0 +1,114 @@
+package monitoring
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// nextEvent waits for the next event on events
+func nextEvent(t *testing.T, events chan streamEvent) streamEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+		return streamEvent{}
+	}
+}
+
+func TestStatsStream(t *testing.T) {
+	md := newTestDashboard(t)
+	s := md.stream
+
+	events, err := s.subscribe(streamSubscriber{userID: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event := nextEvent(t, events); event.name != "stats" {
+		t.Errorf("got %q on subscribe, want a stats snapshot", event.name)
+	}
+
+	md.FileChanged("upload", "file1", 2)
+	event := nextEvent(t, events)
+	if data, _ := event.data.(gin.H); event.name != "file" || data["file_id"] != "file1" {
+		t.Errorf("got %q %v, want the file event", event.name, event.data)
+	}
+	if event := nextEvent(t, events); event.name != "stats" {
+		t.Errorf("got %q after the file event, want a fresh snapshot", event.name)
+	}
+
+	// Other users only get the snapshot, admins the file event too
+	admin, err := s.subscribe(streamSubscriber{userID: 1, admin: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nextEvent(t, admin)
+	nextEvent(t, events)
+	md.FileChanged("delete", "file2", 3)
+	if event := nextEvent(t, events); event.name != "stats" {
+		t.Errorf("got %q for another user's file, want only the snapshot", event.name)
+	}
+	if event := nextEvent(t, admin); event.name != "file" {
+		t.Errorf("admin got %q, want the file event", event.name)
+	}
+
+	second, err := s.subscribe(streamSubscriber{userID: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.subscribe(streamSubscriber{userID: 2}); !errors.Is(err, errTooManyUserStreams) {
+		t.Errorf("third stream of one user: got %v, want errTooManyUserStreams", err)
+	}
+	if _, err := s.subscribe(streamSubscriber{userID: 4}); !errors.Is(err, errTooManySubscribers) {
+		t.Errorf("fourth subscriber: got %v, want errTooManySubscribers", err)
+	}
+
+	s.unsubscribe(events)
+	s.unsubscribe(admin)
+	s.unsubscribe(second)
+	s.mu.Lock()
+	stopped := s.stop == nil
+	s.mu.Unlock()
+	if !stopped {
+		t.Error("stats loop still running without subscribers")
+	}
+}
+
+func TestStreamStatsEndpoint(t *testing.T) {
+	md := newTestDashboard(t)
+	r := gin.New()
+	md.SetupRoutes(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	token, err := md.authManager.JWTManager.GenerateToken(newUser(t, md, "viewer@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/v1/monitoring/stream", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("got %d as %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || strings.TrimSpace(line) != "event:stats" {
+		t.Errorf("got first line %q (%v), want a stats event", line, err)
+	}
+}
@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// Checksum algorithms
+const (
+	HashMD5    = "md5"
+	HashSHA1   = "sha1"
+	HashSHA256 = "sha256"
+)
+
+// ErrObjectNotFound is returned when the remote object doesn't exist
+var ErrObjectNotFound = errors.New("object not found")
+
+// ValidHashAlgorithm reports whether algorithm is a supported checksum algorithm
+func ValidHashAlgorithm(algorithm string) bool {
+	return algorithm == HashMD5 || algorithm == HashSHA1 || algorithm == HashSHA256
+}
+
+func newHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case HashMD5:
+		return md5.New(), nil
+	case HashSHA1:
+		return sha1.New(), nil
+	case HashSHA256:
+		return sha256.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported checksum algorithm: %s", algorithm)
+	}
+}
+
+// HashReader computes the checksum of everything read from r
+func HashReader(r io.Reader, algorithm string) (string, error) {
+	h, err := newHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Digest hashes everything written to it with several algorithms at once and counts
+// the bytes, for checking a stored copy against what was sent
+type Digest struct {
+	Size   int64
+	hashes map[string]hash.Hash
+}
+
+// NewDigest returns a Digest computing the given algorithms
+func NewDigest(algorithms ...string) (*Digest, error) {
+	d := &Digest{hashes: make(map[string]hash.Hash, len(algorithms))}
+	for _, algorithm := range algorithms {
+		h, err := newHash(algorithm)
+		if err != nil {
+			return nil, err
+		}
+		d.hashes[algorithm] = h
+	}
+	return d, nil
+}
+
+func (d *Digest) Write(p []byte) (int, error) {
+	for _, h := range d.hashes {
+		h.Write(p)
+	}
+	d.Size += int64(len(p))
+	return len(p), nil
+}
+
+// Sum returns the checksum in algorithm of what was written so far
+func (d *Digest) Sum(algorithm string) string {
+	h, ok := d.hashes[algorithm]
+	if !ok {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// HashFile computes the checksum of a local file
+func HashFile(path, algorithm string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	return HashReader(file, algorithm)
+}
+
+// RemoteHash asks rclone for the checksum the provider already stores for remotePath.
+// With download set the object is read and hashed instead, which verifies the stored
+// content. It returns an empty string when the provider doesn't support the algorithm
+// and ErrObjectNotFound when the object is missing.
+func RemoteHash(ctx context.Context, client RcloneClient, remotePath, algorithm string, download bool) (string, error) {
+	if !ValidHashAlgorithm(algorithm) {
+		return "", fmt.Errorf("unsupported checksum algorithm: %s", algorithm)
+	}
+
+	args := []string{algorithm, remotePath}
+	if download {
+		args = append(args, "--download")
+	}
+	output, err := client.Command(ctx, "hashsum", args...).Output()
+	if err != nil {
+		if IsNotFound(err) {
+			return "", ErrObjectNotFound
+		}
+		return "", fmt.Errorf("rclone hashsum failed: %w", err)
+	}
+
+	return parseHashsum(string(output), algorithm), nil
+}
+
+// parseHashsum returns the checksum of the first line of rclone hashsum output,
+// "<hash>  <name>" with the hash padded to the width of the algorithm. The hash
+// column is blank or holds a word such as UNSUPPORTED when the provider has no
+// checksum, that and anything not hex gives an empty string. The name is ignored, it
+// may contain spaces.
+func parseHashsum(output, algorithm string) string {
+	h, err := newHash(algorithm)
+	if err != nil {
+		return ""
+	}
+	width := hex.EncodedLen(h.Size())
+
+	line, _, _ := strings.Cut(output, "\n")
+	if len(line) < width+2 || line[width:width+2] != "  " {
+		return ""
+	}
+	sum := strings.ToLower(line[:width])
+	if _, err := hex.DecodeString(sum); err != nil {
+		return ""
+	}
+	return sum
+}
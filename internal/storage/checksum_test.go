@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestParseHashsum(t *testing.T) {
+	md5sum := "5d41402abc4b2a76b9719d911017c592"
+	blank := strings.Repeat(" ", len(md5sum))
+	tests := []struct {
+		name, output, want string
+	}{
+		{"hash", md5sum + "  f1\n", md5sum},
+		{"upper case", strings.ToUpper(md5sum) + "  f1\n", md5sum},
+		{"name with spaces", md5sum + "  my holiday video.mp4\n", md5sum},
+		{"no hash", blank + "  f1\n", ""},
+		{"no hash, name with spaces", blank + "  0123456789abcdef0123456789abcdef file.txt\n", ""},
+		{"unsupported", "                     UNSUPPORTED  f1\n", ""},
+		{"not hex", "zz41402abc4b2a76b9719d911017c592  f1\n", ""},
+		{"wrong width", "5d41402abc4b2a76  f1\n", ""},
+		{"no separator", md5sum + " f1\n", ""},
+		{"empty", "", ""},
+	}
+	for _, test := range tests {
+		if got := parseHashsum(test.output, HashMD5); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	sha256sum := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	if got := parseHashsum(sha256sum+"  f1\n", HashSHA256); got != sha256sum {
+		t.Errorf("sha256: got %q", got)
+	}
+	if got := parseHashsum(sha256sum+"  f1\n", HashMD5); got != "" {
+		t.Errorf("sha256 output parsed as md5: got %q", got)
+	}
+}
+
+func TestRemoteHash(t *testing.T) {
+	client := NewRcloneClient(fakeRcloneBin(t, `case "$3" in
+remote:found) echo "5d41402abc4b2a76b9719d911017c592  found" ;;
+remote:nohash) echo "                                  nohash" ;;
+*) echo "object not found" >&2; exit 3 ;;
+esac`), "")
+	ctx := context.Background()
+
+	if sum, err := RemoteHash(ctx, client, "remote:found", HashMD5, false); err != nil || sum != "5d41402abc4b2a76b9719d911017c592" {
+		t.Errorf("found: %q, %v", sum, err)
+	}
+	if sum, err := RemoteHash(ctx, client, "remote:nohash", HashMD5, false); err != nil || sum != "" {
+		t.Errorf("no hash: %q, %v, want no hash", sum, err)
+	}
+	if _, err := RemoteHash(ctx, client, "remote:missing", HashMD5, false); err != ErrObjectNotFound {
+		t.Errorf("missing: %v, want ErrObjectNotFound", err)
+	}
+	if _, err := RemoteHash(ctx, client, "remote:found", "crc32", false); err == nil {
+		t.Error("unsupported algorithm accepted")
+	}
+}
+
+func TestDigest(t *testing.T) {
+	digest, err := NewDigest(HashMD5, HashSHA1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest.Write([]byte("hel"))
+	digest.Write([]byte("lo"))
+	if digest.Size != 5 {
+		t.Errorf("got size %d, want 5", digest.Size)
+	}
+	for algorithm, want := range map[string]string{
+		HashMD5:  "5d41402abc4b2a76b9719d911017c592",
+		HashSHA1: "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d",
+	} {
+		if got := digest.Sum(algorithm); got != want {
+			t.Errorf("%s: got %q, want %q", algorithm, got, want)
+		}
+	}
+	if got := digest.Sum(HashSHA256); got != "" {
+		t.Errorf("algorithm not computed: got %q, want none", got)
+	}
+	if _, err := NewDigest("crc32"); err == nil {
+		t.Error("unsupported algorithm accepted")
+	}
+}
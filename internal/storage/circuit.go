@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"errors"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of a provider's circuit breaker
+type CircuitState string
+
+// Circuit breaker states
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+// CircuitStatus is a snapshot of a provider's circuit breaker
+type CircuitStatus struct {
+	State               CircuitState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	OpenedAt            time.Time    `json:"opened_at,omitempty"`
+	Cooldown            string       `json:"cooldown,omitempty"`
+}
+
+// circuitBreaker skips a failing provider for an exponentially growing cooldown.
+// After threshold consecutive failures the circuit opens; once the cooldown has
+// elapsed a single trial request is let through, closing the circuit on success
+// or reopening it with a doubled cooldown on failure.
+type circuitBreaker struct {
+	threshold    int
+	baseCooldown time.Duration
+	maxCooldown  time.Duration
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	cooldown time.Duration
+	openedAt time.Time
+	trial    bool
+}
+
+func newCircuitBreaker(threshold int, baseCooldown, maxCooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold:    threshold,
+		baseCooldown: baseCooldown,
+		maxCooldown:  maxCooldown,
+		state:        CircuitClosed,
+	}
+}
+
+// Allow reports whether a request may be sent to the provider
+func (b *circuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = CircuitHalfOpen
+		b.trial = true
+		return true
+	case CircuitHalfOpen:
+		// Only one trial request at a time
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	default:
+		return true
+	}
+}
+
+// Success records a successful request, closing the circuit
+func (b *circuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = CircuitClosed
+	b.failures = 0
+	b.cooldown = 0
+	b.trial = false
+}
+
+// Failure records a failed request, opening the circuit when the threshold is reached
+func (b *circuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.trial = false
+
+	switch {
+	case b.state == CircuitHalfOpen:
+		// Trial failed, back off further
+		b.cooldown *= 2
+		if b.maxCooldown > 0 && b.cooldown > b.maxCooldown {
+			b.cooldown = b.maxCooldown
+		}
+		b.state = CircuitOpen
+		b.openedAt = time.Now()
+	case b.threshold > 0 && b.failures >= b.threshold:
+		b.cooldown = b.baseCooldown
+		b.state = CircuitOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// Abort ends a trial request that was cancelled before producing an outcome
+func (b *circuitBreaker) Abort() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+}
+
+// Status returns a snapshot of the breaker
+func (b *circuitBreaker) Status() CircuitStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := CircuitStatus{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+	}
+	if b.state != CircuitClosed {
+		status.OpenedAt = b.openedAt
+		status.Cooldown = b.cooldown.String()
+	}
+	return status
+}
+
+// IsNotFound reports whether err is rclone signalling a missing file or directory,
+// or ErrObjectNotFound, which says nothing about the provider's health
+func IsNotFound(err error) bool {
+	if errors.Is(err, ErrObjectNotFound) {
+		return true
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		// rclone exit codes: 3 = directory not found, 4 = file not found
+		return exitErr.ExitCode() == 3 || exitErr.ExitCode() == 4
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// expire ends the cooldown of an open breaker
+func expire(b *circuitBreaker) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.openedAt = time.Now().Add(-b.cooldown)
+}
+
+func TestCircuitBreakerOpensAtThreshold(t *testing.T) {
+	b := newCircuitBreaker(3, time.Minute, time.Hour)
+	for i := 0; i < 2; i++ {
+		b.Failure()
+	}
+	if !b.Allow() || b.Status().State != CircuitClosed {
+		t.Fatalf("opened below the threshold: %+v", b.Status())
+	}
+
+	b.Failure()
+	if b.Allow() {
+		t.Error("open circuit let a request through")
+	}
+	if status := b.Status(); status.State != CircuitOpen || status.ConsecutiveFailures != 3 || status.Cooldown != "1m0s" {
+		t.Errorf("status = %+v", status)
+	}
+}
+
+func TestCircuitBreakerBacksOff(t *testing.T) {
+	b := newCircuitBreaker(1, time.Minute, 3*time.Minute)
+	b.Failure()
+
+	// Each failed trial doubles the cooldown, up to the max
+	for _, want := range []string{"2m0s", "3m0s", "3m0s"} {
+		expire(b)
+		if !b.Allow() {
+			t.Fatal("no trial after the cooldown")
+		}
+		if b.Allow() {
+			t.Fatal("second request let through during the trial")
+		}
+		b.Failure()
+		if status := b.Status(); status.State != CircuitOpen || status.Cooldown != want {
+			t.Fatalf("status = %+v, want open for %s", status, want)
+		}
+	}
+
+	// A successful trial closes the circuit
+	expire(b)
+	b.Allow()
+	b.Success()
+	if status := b.Status(); status.State != CircuitClosed || status.ConsecutiveFailures != 0 {
+		t.Errorf("status = %+v, want closed", status)
+	}
+}
+
+func TestCircuitBreakerAbortFreesTrial(t *testing.T) {
+	b := newCircuitBreaker(1, time.Minute, time.Hour)
+	b.Failure()
+	expire(b)
+	b.Allow()
+	b.Abort()
+	if !b.Allow() {
+		t.Error("aborted trial blocked the next one")
+	}
+}
+
+func TestUnionSkipsProviderWithOpenCircuit(t *testing.T) {
+	ctx := context.Background()
+	u := NewUnionStorage()
+	u.SetCircuitBreaker(2, time.Minute, time.Hour)
+	a := newMockProvider("a", 100)
+	a.err = errors.New("backend unreachable")
+	u.AddProvider(a)
+
+	for i := 0; i < 3; i++ {
+		if _, err := u.Download(ctx, "uploads/f1", DownloadOptions{}); err == nil {
+			t.Fatal("download from a failing provider succeeded")
+		}
+	}
+	if a.downloads != 2 {
+		t.Errorf("%d downloads reached the provider, want 2 before the circuit opened", a.downloads)
+	}
+	if state := u.CircuitStates()["a"].State; state != CircuitOpen {
+		t.Errorf("circuit %s, want open", state)
+	}
+}
+
+func TestNotFoundKeepsCircuitClosed(t *testing.T) {
+	ctx := context.Background()
+	u := NewUnionStorage()
+	u.SetCircuitBreaker(1, time.Minute, time.Hour)
+	a := newMockProvider("a", 100)
+	a.err = fmt.Errorf("%w: uploads/f1", ErrObjectNotFound)
+	u.AddProvider(a)
+
+	for i := 0; i < 3; i++ {
+		if _, err := u.Download(ctx, "uploads/f1", DownloadOptions{}); !errors.Is(err, ErrObjectNotFound) {
+			t.Fatalf("err = %v, want ErrObjectNotFound", err)
+		}
+	}
+	if state := u.CircuitStates()["a"].State; state != CircuitClosed {
+		t.Errorf("circuit %s after missing objects, want closed", state)
+	}
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/nabilulilalbab/rclonestorage/internal/logging"
+	"github.com/sirupsen/logrus"
+)
+
+// RcloneClient runs rclone on behalf of the providers and the API. Going through it
+// instead of building commands inline keeps the config handling in one place and
+// lets tests supply a fake.
+type RcloneClient interface {
+	// Command returns an unstarted command, for callers that need pipes or stdin
+	Command(ctx context.Context, operation string, args ...string) *exec.Cmd
+	// LsJSON lists a remote path ("remote:path"), extra args such as --max-age are passed on
+	LsJSON(ctx context.Context, remote string, args ...string) ([]*FileInfo, error)
+	// Cat streams an object, closing the reader waits for rclone to exit
+	Cat(ctx context.Context, remote string, args ...string) (io.ReadCloser, error)
+	// Copy copies src to the object dst
+	Copy(ctx context.Context, src, dst string) error
+	// Delete removes a single object
+	Delete(ctx context.Context, remote string) error
+}
+
+// execRcloneClient runs the rclone binary
+type execRcloneClient struct {
+	rcloneBin  string
+	configPath string
+}
+
+// NewRcloneClient returns a client running rcloneBin with configPath as its config
+// file, an empty configPath leaves rclone to find its default config
+func NewRcloneClient(rcloneBin, configPath string) RcloneClient {
+	return &execRcloneClient{
+		rcloneBin:  rcloneBin,
+		configPath: configPath,
+	}
+}
+
+// Command builds an rclone command on top of the parent environment. An Env holding
+// only RCLONE_CONFIG would drop PATH, HOME and the rest.
+func (e *execRcloneClient) Command(ctx context.Context, operation string, args ...string) *exec.Cmd {
+	cmd := RcloneCommand(ctx, e.rcloneBin, operation, args...)
+	cmd.Env = os.Environ()
+	if e.configPath != "" {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("RCLONE_CONFIG=%s", e.configPath))
+	}
+	return cmd
+}
+
+// LsJSON runs rclone lsjson and parses its output
+func (e *execRcloneClient) LsJSON(ctx context.Context, remote string, args ...string) ([]*FileInfo, error) {
+	output, err := e.Command(ctx, "lsjson", append([]string{remote}, args...)...).Output()
+	if err != nil {
+		logFailure(ctx, "lsjson", remote, err)
+		return nil, err
+	}
+
+	provider, _, _ := strings.Cut(remote, ":")
+	return parseLsJSON(output, "", provider)
+}
+
+// Cat starts rclone cat, returning its output
+func (e *execRcloneClient) Cat(ctx context.Context, remote string, args ...string) (io.ReadCloser, error) {
+	cmd := e.Command(ctx, "cat", append([]string{remote}, args...)...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		logFailure(ctx, "cat", remote, err)
+		return nil, fmt.Errorf("failed to start rclone cat: %w", err)
+	}
+
+	return &cmdReadCloser{
+		ReadCloser: stdout,
+		cmd:        cmd,
+	}, nil
+}
+
+// Copy runs rclone copyto
+func (e *execRcloneClient) Copy(ctx context.Context, src, dst string) error {
+	if output, err := e.Command(ctx, "copyto", src, dst).CombinedOutput(); err != nil {
+		err = fmt.Errorf("rclone copy failed: %w, output: %s", err, string(output))
+		logFailure(ctx, "copyto", dst, err)
+		return err
+	}
+	return nil
+}
+
+// Delete runs rclone deletefile, the error satisfies IsNotFound when the object is missing
+func (e *execRcloneClient) Delete(ctx context.Context, remote string) error {
+	err := e.Command(ctx, "deletefile", remote).Run()
+	if err != nil && !IsNotFound(err) {
+		logFailure(ctx, "deletefile", remote, err)
+	}
+	return err
+}
+
+// logFailure logs a failed rclone command with the ID of the request it ran for.
+// Commands cancelled along with their request aren't failures worth logging.
+func logFailure(ctx context.Context, operation, remote string, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+	logging.FromContext(ctx).WithFields(logrus.Fields{
+		"operation": operation,
+		"remote":    remote,
+		"error":     err.Error(),
+	}).Warn("rclone command failed")
+}
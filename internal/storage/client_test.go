@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nabilulilalbab/rclonestorage/internal/logging"
+)
+
+// clientTestBin fakes rclone over the objects in dir, logging every invocation
+func clientTestBin(t *testing.T, dir string) string {
+	return fakeRcloneBin(t, `echo "$@" >> `+dir+`/log
+case "$1" in
+lsjson) echo '[{"Path":"a.txt","Name":"a.txt","Size":5,"IsDir":false}]' ;;
+cat) printf hello ;;
+copyto) cp "$2" `+dir+`/copied ;;
+deletefile) echo "object not found" >&2; exit 3 ;;
+*) exit 1 ;;
+esac`)
+}
+
+func TestRcloneClient(t *testing.T) {
+	dir := t.TempDir()
+	client := NewRcloneClient(clientTestBin(t, dir), "")
+	ctx := context.Background()
+
+	files, err := client.LsJSON(ctx, "gdrive:uploads", "--files-only")
+	if err != nil || len(files) != 1 || files[0].Name != "a.txt" || files[0].Provider != "gdrive" {
+		t.Fatalf("lsjson: got %v, %v", files, err)
+	}
+
+	reader, err := client.Cat(ctx, "gdrive:uploads/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil || string(data) != "hello" {
+		t.Errorf("cat: got %q, %v", data, err)
+	}
+	if err := reader.Close(); err != nil {
+		t.Errorf("closing cat: %v", err)
+	}
+
+	src := filepath.Join(dir, "src")
+	if err := os.WriteFile(src, []byte("copy me"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Copy(ctx, src, "gdrive:uploads/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if copied, _ := os.ReadFile(filepath.Join(dir, "copied")); string(copied) != "copy me" {
+		t.Errorf("copy: got %q", copied)
+	}
+
+	if err := client.Delete(ctx, "gdrive:uploads/missing"); !IsNotFound(err) {
+		t.Errorf("delete: got %v, want a not found error", err)
+	}
+
+	log, _ := os.ReadFile(filepath.Join(dir, "log"))
+	want := "lsjson gdrive:uploads --files-only\ncat gdrive:uploads/a.txt\ncopyto " + src + " gdrive:uploads/b.txt\ndeletefile gdrive:uploads/missing\n"
+	if string(log) != want {
+		t.Errorf("rclone calls:\n%s\nwant:\n%s", log, want)
+	}
+}
+
+func TestRcloneClientRejectsBadRemote(t *testing.T) {
+	dir := t.TempDir()
+	client := NewRcloneClient(clientTestBin(t, dir), "")
+	if _, err := client.LsJSON(context.Background(), "g drive:uploads"); err == nil {
+		t.Error("got no error for an invalid remote name")
+	}
+	if log, _ := os.ReadFile(filepath.Join(dir, "log")); strings.TrimSpace(string(log)) != "" {
+		t.Errorf("rclone ran: %s", log)
+	}
+}
+
+func TestRcloneClientKeepsEnvironment(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	bin := fakeRcloneBin(t, `echo "$HOME|$RCLONE_CONFIG|$PATH" > `+dir+`/env`)
+	if err := NewRcloneClient(bin, "/etc/rclone.conf").Command(context.Background(), "version").Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	env, _ := os.ReadFile(filepath.Join(dir, "env"))
+	parts := strings.Split(strings.TrimSpace(string(env)), "|")
+	if len(parts) != 3 || parts[0] != dir || parts[1] != "/etc/rclone.conf" || parts[2] != os.Getenv("PATH") {
+		t.Errorf("rclone ran with HOME|RCLONE_CONFIG|PATH = %s", env)
+	}
+}
+
+func TestRcloneFailuresLoggedWithRequestID(t *testing.T) {
+	var logs bytes.Buffer
+	out := logging.Logger.Out
+	logging.Logger.SetOutput(&logs)
+	defer logging.Logger.SetOutput(out)
+
+	client := NewRcloneClient(clientTestBin(t, t.TempDir()), "")
+	ctx := logging.WithRequestID(context.Background(), "req-1")
+
+	// A missing object isn't a failure worth logging
+	client.Delete(ctx, "gdrive:uploads/missing")
+	if logs.Len() != 0 {
+		t.Errorf("not found logged: %s", logs.String())
+	}
+
+	if err := client.Copy(ctx, "/nonexistent", "other:uploads/x"); err == nil {
+		t.Fatal("copy of a missing file succeeded")
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatalf("log line %q: %v", logs.String(), err)
+	}
+	if entry["request_id"] != "req-1" || entry["operation"] != "copyto" || entry["remote"] != "other:uploads/x" {
+		t.Errorf("got log entry %v", entry)
+	}
+}
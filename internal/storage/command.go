@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// rcloneOperations are the rclone subcommands the application runs. Anything else
+// is rejected before a process is spawned.
+var rcloneOperations = map[string]bool{
+	"about":       true,
+	"cat":         true,
+	"copy":        true,
+	"copyto":      true,
+	"delete":      true,
+	"deletefile":  true,
+	"hashsum":     true,
+	"link":        true,
+	"listremotes": true,
+	"lsd":         true,
+	"lsjson":      true,
+	"rcat":        true,
+	"size":        true,
+	"version":     true,
+}
+
+var remoteNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+var (
+	allowedRemotes   map[string]bool
+	allowedRemotesMu sync.RWMutex
+)
+
+// SetAllowedRemotes restricts rclone commands to the named remotes. An empty list
+// allows any well-formed remote name.
+func SetAllowedRemotes(names []string) {
+	allowedRemotesMu.Lock()
+	defer allowedRemotesMu.Unlock()
+
+	if len(names) == 0 {
+		allowedRemotes = nil
+		return
+	}
+	allowedRemotes = make(map[string]bool, len(names))
+	for _, name := range names {
+		allowedRemotes[name] = true
+	}
+}
+
+// ValidateRemoteName checks that name is a well-formed remote name and, when an
+// allowlist is set, that it is on it
+func ValidateRemoteName(name string) error {
+	if !remoteNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid remote name %q: only letters, digits, '_' and '-' are allowed", name)
+	}
+
+	allowedRemotesMu.RLock()
+	defer allowedRemotesMu.RUnlock()
+	if allowedRemotes != nil && !allowedRemotes[name] {
+		return fmt.Errorf("remote %q is not in the allowed remotes", name)
+	}
+	return nil
+}
+
+// ValidateRcloneCommand checks that operation is allowed and that every argument
+// addressing a remote ("remote:path") names a valid remote. As in rclone, an
+// argument is a remote path when a colon comes before any slash; flags and local
+// paths are not checked.
+func ValidateRcloneCommand(operation string, args ...string) error {
+	if !rcloneOperations[operation] {
+		return fmt.Errorf("rclone operation %q is not allowed", operation)
+	}
+
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			continue
+		}
+		remote, _, found := strings.Cut(arg, ":")
+		if !found || strings.Contains(remote, "/") {
+			continue
+		}
+		if err := ValidateRemoteName(remote); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RcloneCommand returns a command running the rclone operation with args. When the
+// operation or a remote fails validation the command is returned unstarted with the
+// validation error, which Run, Output and Start report instead of spawning rclone.
+func RcloneCommand(ctx context.Context, rcloneBin, operation string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, rcloneBin, append([]string{operation}, args...)...)
+	if err := ValidateRcloneCommand(operation, args...); err != nil {
+		cmd.Err = err
+	}
+	return cmd
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+	"testing"
+)
+
+func TestValidateRcloneCommand(t *testing.T) {
+	tests := []struct {
+		operation string
+		args      []string
+		ok        bool
+	}{
+		{"lsjson", []string{"gdrive:uploads/", "--files-only"}, true},
+		{"copyto", []string{"/tmp/upload:1", "mega2:uploads/a"}, true},
+		{"purge", []string{"gdrive:"}, false},
+		{"config", []string{"show"}, false},
+		{"cat", []string{"bad;name:uploads/a"}, false},
+		{"cat", []string{"../x:uploads/a"}, true}, // a local path, the slash comes first
+	}
+	for _, tt := range tests {
+		err := ValidateRcloneCommand(tt.operation, tt.args...)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s %v: got %v, want ok %v", tt.operation, tt.args, err, tt.ok)
+		}
+	}
+}
+
+func TestAllowedRemotes(t *testing.T) {
+	SetAllowedRemotes([]string{"gdrive", "union"})
+	t.Cleanup(func() { SetAllowedRemotes(nil) })
+
+	if err := ValidateRcloneCommand("cat", "gdrive:uploads/a"); err != nil {
+		t.Errorf("got %v for an allowed remote", err)
+	}
+	if err := ValidateRcloneCommand("cat", "mega2:uploads/a"); err == nil {
+		t.Error("got no error for a remote off the allowlist")
+	}
+
+	SetAllowedRemotes(nil)
+	if err := ValidateRemoteName("mega2"); err != nil {
+		t.Errorf("got %v once the allowlist is cleared", err)
+	}
+}
+
+func TestRcloneCommandRejectedWithoutSpawning(t *testing.T) {
+	client := NewRcloneClient(fakeRcloneBin(t, `exit 0`), "")
+	cmd := client.Command(context.Background(), "purge", "gdrive:")
+	if err := cmd.Run(); err == nil {
+		t.Fatal("got no error running a disallowed operation")
+	}
+	if cmd.Process != nil {
+		t.Error("rclone was spawned for a disallowed operation")
+	}
+}
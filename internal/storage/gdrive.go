@@ -6,9 +6,9 @@ import (
 	"io"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
@@ -16,18 +16,16 @@ import (
 type GDriveProvider struct {
 	name       string
 	remoteName string
-	rcloneBin  string
-	configPath string
+	client     RcloneClient
 	logger     *logrus.Logger
 }
 
 // NewGDriveProvider creates a new Google Drive storage provider
-func NewGDriveProvider(name, remoteName, rcloneBin, configPath string) *GDriveProvider {
+func NewGDriveProvider(name, remoteName string, client RcloneClient) *GDriveProvider {
 	return &GDriveProvider{
 		name:       name,
 		remoteName: remoteName,
-		rcloneBin:  rcloneBin,
-		configPath: configPath,
+		client:     client,
 		logger:     logrus.New(),
 	}
 }
@@ -39,15 +37,13 @@ func (g *GDriveProvider) Name() string {
 
 // Upload uploads a file to Google Drive
 func (g *GDriveProvider) Upload(ctx context.Context, reader io.Reader, path string, opts UploadOptions) (*FileInfo, error) {
-	// Create temporary file for upload
-	tempFile := filepath.Join("/tmp", fmt.Sprintf("gdrive_upload_%s_%s", uuid.New().String(), opts.Filename))
-	
 	remotePath := fmt.Sprintf("%s:%s", g.remoteName, path)
 	
-	// Execute rclone copy command
-	cmd := g.buildRcloneCmd("copy", tempFile, remotePath)
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("failed to upload to Google Drive: %w", err)
+	// Stream the content straight to the remote with rclone rcat
+	cmd := g.buildRcloneCmd(ctx, "rcat", remotePath)
+	cmd.Stdin = reader
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("failed to upload to Google Drive: %w: %s", err, strings.TrimSpace(string(output)))
 	}
 	
 	// Get file info after upload
@@ -64,7 +60,7 @@ func (g *GDriveProvider) Download(ctx context.Context, path string, opts Downloa
 	}
 	
 	// Execute rclone cat command to stream file content
-	cmd := g.buildRcloneCmd("cat", remotePath)
+	cmd := g.buildRcloneCmd(ctx, "cat", remotePath)
 	
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
@@ -86,25 +82,19 @@ func (g *GDriveProvider) List(ctx context.Context, path string) ([]*FileInfo, er
 	remotePath := fmt.Sprintf("%s:%s", g.remoteName, path)
 	
 	// Execute rclone lsjson command
-	cmd := g.buildRcloneCmd("lsjson", remotePath)
-	
-	_, err := cmd.Output()
+	output, err := g.buildRcloneCmd(ctx, "lsjson", remotePath).Output()
 	if err != nil {
 		return nil, fmt.Errorf("failed to list files from Google Drive: %w", err)
 	}
 	
-	// Parse JSON output and convert to FileInfo
-	var files []*FileInfo
-	// TODO: Parse JSON output properly
-	
-	return files, nil
+	return parseLsJSON(output, path, g.name)
 }
 
 // Delete deletes a file from Google Drive
 func (g *GDriveProvider) Delete(ctx context.Context, path string) error {
 	remotePath := fmt.Sprintf("%s:%s", g.remoteName, path)
 	
-	cmd := g.buildRcloneCmd("delete", remotePath)
+	cmd := g.buildRcloneCmd(ctx, "deletefile", remotePath)
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("failed to delete file from Google Drive: %w", err)
 	}
@@ -117,21 +107,24 @@ func (g *GDriveProvider) Stat(ctx context.Context, path string) (*FileInfo, erro
 	remotePath := fmt.Sprintf("%s:%s", g.remoteName, path)
 	
 	// Execute rclone lsjson for single file
-	cmd := g.buildRcloneCmd("lsjson", remotePath)
-	
-	_, err := cmd.Output()
+	output, err := g.buildRcloneCmd(ctx, "lsjson", remotePath).Output()
 	if err != nil {
 		return nil, fmt.Errorf("failed to stat file: %w", err)
 	}
 	
-	// Parse output and return FileInfo
-	return &FileInfo{
-		ID:       uuid.New().String(),
-		Name:     filepath.Base(path),
-		Path:     path,
-		Provider: g.name,
-		ModTime:  time.Now(),
-	}, nil
+	// lsjson on a file lists just that file, match it by name all the same
+	files, err := parseLsJSON(output, filepath.Dir(path), g.name)
+	if err != nil {
+		return nil, err
+	}
+	
+	for _, file := range files {
+		if file.Name == filepath.Base(path) {
+			return file, nil
+		}
+	}
+	
+	return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, path)
 }
 
 // GetURL gets a direct download URL from Google Drive
@@ -139,7 +132,7 @@ func (g *GDriveProvider) GetURL(ctx context.Context, path string, expires time.D
 	// Google Drive supports direct links via rclone link command
 	remotePath := fmt.Sprintf("%s:%s", g.remoteName, path)
 	
-	cmd := g.buildRcloneCmd("link", remotePath)
+	cmd := g.buildRcloneCmd(ctx, "link", remotePath)
 	output, err := cmd.Output()
 	if err != nil {
 		return "", fmt.Errorf("failed to get Google Drive link: %w", err)
@@ -150,31 +143,22 @@ func (g *GDriveProvider) GetURL(ctx context.Context, path string, expires time.D
 
 // IsAvailable checks if Google Drive provider is available
 func (g *GDriveProvider) IsAvailable(ctx context.Context) bool {
-	// Test connection by listing root directory
-	cmd := g.buildRcloneCmd("lsd", fmt.Sprintf("%s:", g.remoteName))
+	// Test connection by listing root directory, ctx bounds how long the check may take
+	cmd := g.buildRcloneCmd(ctx, "lsd", fmt.Sprintf("%s:", g.remoteName))
 	err := cmd.Run()
 	return err == nil
 }
 
-// buildRcloneCmd builds an rclone command with proper configuration
-func (g *GDriveProvider) buildRcloneCmd(operation string, args ...string) *exec.Cmd {
-	cmdArgs := []string{operation}
-	cmdArgs = append(cmdArgs, args...)
-	
-	cmd := exec.Command(g.rcloneBin, cmdArgs...)
-	
-	// Set config path if provided
-	if g.configPath != "" {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("RCLONE_CONFIG=%s", g.configPath))
-	}
-	
-	return cmd
+// buildRcloneCmd builds an rclone command through the provider's client
+func (g *GDriveProvider) buildRcloneCmd(ctx context.Context, operation string, args ...string) *exec.Cmd {
+	return g.client.Command(ctx, operation, args...)
 }
 
 // downloadWithRange handles HTTP range requests for Google Drive
 func (g *GDriveProvider) downloadWithRange(ctx context.Context, remotePath string, rangeSpec *RangeSpec) (io.ReadCloser, error) {
-	// Google Drive supports range requests better than Mega
-	cmd := g.buildRcloneCmd("cat", remotePath)
+	// rclone fetches just the window, seeking through the object on backends that
+	// can't start reading at an offset
+	cmd := g.buildRcloneCmd(ctx, "cat", append([]string{remotePath}, rangeArgs(rangeSpec)...)...)
 	
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
@@ -185,8 +169,6 @@ func (g *GDriveProvider) downloadWithRange(ctx context.Context, remotePath strin
 		return nil, fmt.Errorf("failed to start rclone cat: %w", err)
 	}
 	
-	// TODO: Implement proper range handling for Google Drive
-	
 	return &cmdReadCloser{
 		ReadCloser: stdout,
 		cmd:        cmd,
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// probeHealth checks whether a provider is reachable and how long that took
+func probeHealth(ctx context.Context, provider StorageProvider) ProviderHealth {
+	started := time.Now()
+	health := ProviderHealth{Available: provider.IsAvailable(ctx)}
+	health.CheckedAt = time.Now()
+	health.LatencyMs = health.CheckedAt.Sub(started).Milliseconds()
+	if !health.Available {
+		health.Error = "provider unavailable"
+		if ctx.Err() != nil {
+			health.Error = "check timed out"
+		}
+	}
+	return health
+}
+
+// CheckHealth probes every provider at once, each for at most timeout, and records
+// the results returned by Health. A provider replaced or removed while it was being
+// probed keeps the record of its replacement.
+func (u *UnionStorageImpl) CheckHealth(ctx context.Context, timeout time.Duration) {
+	providers := u.GetProviders()
+
+	var wg sync.WaitGroup
+	for _, provider := range providers {
+		wg.Add(1)
+		go func(provider StorageProvider) {
+			defer wg.Done()
+
+			probeCtx, cancel := context.WithTimeout(ctx, timeout)
+			health := probeHealth(probeCtx, provider)
+			cancel()
+
+			u.mu.Lock()
+			if u.providers[provider.Name()] == provider {
+				u.health[provider.Name()] = health
+			}
+			u.mu.Unlock()
+		}(provider)
+	}
+	wg.Wait()
+}
+
+// StartHealthChecks runs CheckHealth right away and then every interval until done is
+// closed, so status queries can read Health instead of probing providers themselves
+func (u *UnionStorageImpl) StartHealthChecks(interval, timeout time.Duration, done <-chan struct{}) {
+	go func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			<-done
+			cancel()
+		}()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			u.CheckHealth(ctx, timeout)
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// healthTestTimeout bounds each probe of a mock provider
+const healthTestTimeout = time.Second
+
+func TestCheckHealthRecordsProbes(t *testing.T) {
+	u := NewUnionStorage()
+	up, down := newMockProvider("up", 100), newMockProvider("down", 100)
+	down.available = false
+	u.AddProvider(up)
+	u.AddProvider(down)
+
+	before := time.Now()
+	u.CheckHealth(context.Background(), healthTestTimeout)
+
+	health := u.Health()
+	if !health["up"].Available || health["up"].Error != "" {
+		t.Errorf("up = %+v, want available", health["up"])
+	}
+	if health["down"].Available || health["down"].Error == "" {
+		t.Errorf("down = %+v, want unavailable with an error", health["down"])
+	}
+	for name, h := range health {
+		if h.CheckedAt.Before(before) {
+			t.Errorf("%s checked at %v, before the check started", name, h.CheckedAt)
+		}
+	}
+}
+
+func TestSelectProvidersSkipsUnavailable(t *testing.T) {
+	u := NewUnionStorage()
+	a, b := newMockProvider("a", 100), newMockProvider("b", 10)
+	u.AddProvider(a)
+	u.AddProvider(b)
+
+	a.available = false
+	u.CheckHealth(context.Background(), healthTestTimeout)
+
+	if got := names(u.SelectProviders(context.Background(), 2)); len(got) != 1 || got[0] != "b" {
+		t.Fatalf("selected %v, want only b", got)
+	}
+}
+
+func TestRequestsReadCachedHealth(t *testing.T) {
+	u := NewUnionStorage()
+	a := newMockProvider("a", 100)
+	u.AddProvider(a)
+	u.CheckHealth(context.Background(), healthTestTimeout)
+	a.probes = 0
+
+	ctx := context.Background()
+	if _, err := u.Upload(ctx, strings.NewReader("hello"), "uploads/f1", UploadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Stat(ctx, "uploads/f1"); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := u.Download(ctx, "uploads/f1", DownloadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader.Close()
+	u.List(ctx, "uploads")
+	u.IsAvailable(ctx)
+	if err := u.Delete(ctx, "uploads/f1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if a.probes != 0 {
+		t.Fatalf("provider probed %d times while serving requests, want 0", a.probes)
+	}
+}
+
+func TestStartHealthChecks(t *testing.T) {
+	u := NewUnionStorage()
+	a := newMockProvider("a", 100)
+	u.AddProvider(a)
+
+	done := make(chan struct{})
+	u.StartHealthChecks(10*time.Millisecond, healthTestTimeout, done)
+	defer close(done)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		a.mu.Lock()
+		probes := a.probes
+		a.mu.Unlock()
+		if probes >= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("provider probed %d times, want the loop to keep probing", probes)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, checked := u.Health()["a"]; !checked {
+		t.Fatal("no health recorded for a")
+	}
+}
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockProvider is an in-memory StorageProvider that reports a fixed free space
+type mockProvider struct {
+	name      string
+	free      int64
+	aboutErr  error
+	available bool
+
+	mu        sync.Mutex
+	objects   map[string][]byte
+	probes    int           // IsAvailable calls
+	downloads int           // Download calls
+	err       error         // returned by Download when set
+	delay     time.Duration // Download waits this long, or until cancelled
+}
+
+func newMockProvider(name string, free int64) *mockProvider {
+	return &mockProvider{name: name, free: free, available: true, objects: make(map[string][]byte)}
+}
+
+func (m *mockProvider) Upload(ctx context.Context, reader io.Reader, path string, opts UploadOptions) (*FileInfo, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[path] = data
+	return &FileInfo{Name: filepath.Base(path), Size: int64(len(data)), Provider: m.name, Path: path}, nil
+}
+
+func (m *mockProvider) Download(ctx context.Context, path string, opts DownloadOptions) (io.ReadCloser, error) {
+	if m.delay > 0 {
+		select {
+		case <-time.After(m.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.downloads++
+	if m.err != nil {
+		return nil, m.err
+	}
+	data, ok := m.objects[path]
+	if !ok {
+		return nil, ErrObjectNotFound
+	}
+	return io.NopCloser(strings.NewReader(string(data))), nil
+}
+
+func (m *mockProvider) List(ctx context.Context, path string) ([]*FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var files []*FileInfo
+	for name, data := range m.objects {
+		if strings.HasPrefix(name, path) {
+			files = append(files, &FileInfo{Name: filepath.Base(name), Size: int64(len(data)), Provider: m.name, Path: name})
+		}
+	}
+	return files, nil
+}
+
+func (m *mockProvider) Delete(ctx context.Context, path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.objects[path]; !ok {
+		return ErrObjectNotFound
+	}
+	delete(m.objects, path)
+	return nil
+}
+
+func (m *mockProvider) Stat(ctx context.Context, path string) (*FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[path]
+	if !ok {
+		return nil, ErrObjectNotFound
+	}
+	return &FileInfo{Name: filepath.Base(path), Size: int64(len(data)), Provider: m.name, Path: path}, nil
+}
+
+func (m *mockProvider) GetURL(ctx context.Context, path string, expires time.Duration) (string, error) {
+	return "", errors.New("not supported")
+}
+
+func (m *mockProvider) Name() string {
+	return m.name
+}
+
+func (m *mockProvider) IsAvailable(ctx context.Context) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.probes++
+	return m.available
+}
+
+func (m *mockProvider) About(ctx context.Context) (*SpaceInfo, error) {
+	if m.aboutErr != nil {
+		return nil, m.aboutErr
+	}
+	return &SpaceInfo{Free: m.free}, nil
+}
+
+// fakeRcloneBin writes a shell script standing in for the rclone binary and returns
+// its path. $1 is the operation, as with rclone.
+func fakeRcloneBin(t *testing.T, script string) string {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), "rclone")
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return bin
+}
@@ -16,6 +16,9 @@ type FileInfo struct {
 	MimeType string    `json:"mime_type"`
 	Provider string    `json:"provider"`
 	Path     string    `json:"path"`
+
+	// Replicas lists the providers an upload was stored on, see UnionStorageImpl.SetReplicas
+	Replicas []string `json:"replicas,omitempty"`
 }
 
 // UploadOptions contains options for uploading files
@@ -72,10 +75,25 @@ type UnionStorage interface {
 	
 	// RemoveProvider removes a storage provider from the union
 	RemoveProvider(name string) error
+
+	// UpsertProvider adds a provider or replaces the existing one with the same name
+	UpsertProvider(ctx context.Context, provider StorageProvider) error
 	
 	// GetProviders returns all providers
 	GetProviders() []StorageProvider
 	
 	// GetProvider gets a specific provider by name
 	GetProvider(name string) StorageProvider
+
+	// Health returns the last recorded health of each provider
+	Health() map[string]ProviderHealth
+
+	// CircuitStates returns the circuit breaker state of each provider
+	CircuitStates() map[string]CircuitStatus
+
+	// SelectProvider returns the provider the next upload should go to, see UnionStorageImpl
+	SelectProvider(ctx context.Context) StorageProvider
+
+	// SelectProviders returns up to n providers in the order uploads should go to them
+	SelectProviders(ctx context.Context, n int) []StorageProvider
 }
\ No newline at end of file
@@ -6,9 +6,9 @@ import (
 	"io"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
@@ -16,18 +16,16 @@ import (
 type MegaProvider struct {
 	name       string
 	remoteName string
-	rcloneBin  string
-	configPath string
+	client     RcloneClient
 	logger     *logrus.Logger
 }
 
 // NewMegaProvider creates a new Mega storage provider
-func NewMegaProvider(name, remoteName, rcloneBin, configPath string) *MegaProvider {
+func NewMegaProvider(name, remoteName string, client RcloneClient) *MegaProvider {
 	return &MegaProvider{
 		name:       name,
 		remoteName: remoteName,
-		rcloneBin:  rcloneBin,
-		configPath: configPath,
+		client:     client,
 		logger:     logrus.New(),
 	}
 }
@@ -39,19 +37,13 @@ func (m *MegaProvider) Name() string {
 
 // Upload uploads a file to Mega
 func (m *MegaProvider) Upload(ctx context.Context, reader io.Reader, path string, opts UploadOptions) (*FileInfo, error) {
-	// Create temporary file for upload
-	tempFile := filepath.Join("/tmp", fmt.Sprintf("rclone_upload_%s_%s", uuid.New().String(), opts.Filename))
-	
-	// Save reader content to temp file
-	// In production, you might want to stream directly to rclone
-	// For now, we'll use a simple approach
-	
 	remotePath := fmt.Sprintf("%s:%s", m.remoteName, path)
 	
-	// Execute rclone copy command
-	cmd := m.buildRcloneCmd("copy", tempFile, remotePath)
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("failed to upload to mega: %w", err)
+	// Stream the content straight to the remote with rclone rcat
+	cmd := m.buildRcloneCmd(ctx, "rcat", remotePath)
+	cmd.Stdin = reader
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("failed to upload to mega: %w: %s", err, strings.TrimSpace(string(output)))
 	}
 	
 	// Get file info after upload
@@ -68,7 +60,7 @@ func (m *MegaProvider) Download(ctx context.Context, path string, opts DownloadO
 	}
 	
 	// Execute rclone cat command to stream file content
-	cmd := m.buildRcloneCmd("cat", remotePath)
+	cmd := m.buildRcloneCmd(ctx, "cat", remotePath)
 	
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
@@ -91,28 +83,21 @@ func (m *MegaProvider) List(ctx context.Context, path string) ([]*FileInfo, erro
 	remotePath := fmt.Sprintf("%s:%s", m.remoteName, path)
 	
 	// Execute rclone lsjson command
-	cmd := m.buildRcloneCmd("lsjson", remotePath)
+	cmd := m.buildRcloneCmd(ctx, "lsjson", remotePath)
 	
-	_, err := cmd.Output()
+	output, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("failed to list files: %w", err)
 	}
 	
-	// Parse JSON output and convert to FileInfo
-	// This is a simplified implementation
-	// In production, you'd want proper JSON parsing
-	
-	var files []*FileInfo
-	// TODO: Parse JSON output properly
-	
-	return files, nil
+	return parseLsJSON(output, path, m.name)
 }
 
 // Delete deletes a file from Mega
 func (m *MegaProvider) Delete(ctx context.Context, path string) error {
 	remotePath := fmt.Sprintf("%s:%s", m.remoteName, path)
 	
-	cmd := m.buildRcloneCmd("delete", remotePath)
+	cmd := m.buildRcloneCmd(ctx, "deletefile", remotePath)
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("failed to delete file: %w", err)
 	}
@@ -125,23 +110,26 @@ func (m *MegaProvider) Stat(ctx context.Context, path string) (*FileInfo, error)
 	remotePath := fmt.Sprintf("%s:%s", m.remoteName, path)
 	
 	// Execute rclone lsjson for single file
-	cmd := m.buildRcloneCmd("lsjson", remotePath)
+	cmd := m.buildRcloneCmd(ctx, "lsjson", remotePath)
 	
-	_, err := cmd.Output()
+	output, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("failed to stat file: %w", err)
 	}
 	
-	// Parse output and return FileInfo
-	// TODO: Implement proper JSON parsing
+	// lsjson on a file lists just that file, match it by name all the same
+	files, err := parseLsJSON(output, filepath.Dir(path), m.name)
+	if err != nil {
+		return nil, err
+	}
 	
-	return &FileInfo{
-		ID:       uuid.New().String(),
-		Name:     filepath.Base(path),
-		Path:     path,
-		Provider: m.name,
-		ModTime:  time.Now(),
-	}, nil
+	for _, file := range files {
+		if file.Name == filepath.Base(path) {
+			return file, nil
+		}
+	}
+	
+	return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, path)
 }
 
 // GetURL gets a direct download URL (Mega doesn't support this easily)
@@ -151,33 +139,22 @@ func (m *MegaProvider) GetURL(ctx context.Context, path string, expires time.Dur
 
 // IsAvailable checks if the provider is available
 func (m *MegaProvider) IsAvailable(ctx context.Context) bool {
-	// Test connection by listing root directory
-	cmd := m.buildRcloneCmd("lsd", fmt.Sprintf("%s:", m.remoteName))
+	// Test connection by listing root directory, ctx bounds how long the check may take
+	cmd := m.buildRcloneCmd(ctx, "lsd", fmt.Sprintf("%s:", m.remoteName))
 	err := cmd.Run()
 	return err == nil
 }
 
-// buildRcloneCmd builds an rclone command with proper configuration
-func (m *MegaProvider) buildRcloneCmd(operation string, args ...string) *exec.Cmd {
-	cmdArgs := []string{operation}
-	cmdArgs = append(cmdArgs, args...)
-	
-	cmd := exec.Command(m.rcloneBin, cmdArgs...)
-	
-	// Set config path if provided
-	if m.configPath != "" {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("RCLONE_CONFIG=%s", m.configPath))
-	}
-	
-	return cmd
+// buildRcloneCmd builds an rclone command through the provider's client
+func (m *MegaProvider) buildRcloneCmd(ctx context.Context, operation string, args ...string) *exec.Cmd {
+	return m.client.Command(ctx, operation, args...)
 }
 
 // downloadWithRange handles HTTP range requests
 func (m *MegaProvider) downloadWithRange(ctx context.Context, remotePath string, rangeSpec *RangeSpec) (io.ReadCloser, error) {
-	// For range requests, we might need to download the entire file and seek
-	// This is not optimal but Mega doesn't support range requests directly
-	
-	cmd := m.buildRcloneCmd("cat", remotePath)
+	// rclone fetches just the window, seeking through the object on backends that
+	// can't start reading at an offset
+	cmd := m.buildRcloneCmd(ctx, "cat", append([]string{remotePath}, rangeArgs(rangeSpec)...)...)
 	
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
@@ -188,9 +165,6 @@ func (m *MegaProvider) downloadWithRange(ctx context.Context, remotePath string,
 		return nil, fmt.Errorf("failed to start rclone cat: %w", err)
 	}
 	
-	// TODO: Implement proper range handling
-	// For now, return the full stream
-	
 	return &cmdReadCloser{
 		ReadCloser: stdout,
 		cmd:        cmd,
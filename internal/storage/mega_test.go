@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// megaTestBin fakes rclone for a single object kept in dir, logging every invocation
+func megaTestBin(t *testing.T, dir string) string {
+	return fakeRcloneBin(t, `echo "$@" >> `+dir+`/log
+case "$1" in
+rcat) cat > `+dir+`/object ;;
+lsjson) echo '[{"Path":"f1","Name":"f1","Size":'$(wc -c < `+dir+`/object)',"IsDir":false}]' ;;
+deletefile) rm `+dir+`/object ;;
+*) exit 1 ;;
+esac`)
+}
+
+func TestMegaUploadStreamsReader(t *testing.T) {
+	dir := t.TempDir()
+	provider := NewMegaProvider("mega", "mega", NewRcloneClient(megaTestBin(t, dir), ""))
+
+	info, err := provider.Upload(context.Background(), strings.NewReader("hello"), "uploads/f1", UploadOptions{Filename: "f1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != 5 {
+		t.Errorf("size = %d, want 5", info.Size)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "object"))
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("remote object = %q, %v; want the uploaded content", data, err)
+	}
+	if log, _ := os.ReadFile(filepath.Join(dir, "log")); !strings.HasPrefix(string(log), "rcat mega:uploads/f1\n") {
+		t.Fatalf("rclone calls:\n%s", log)
+	}
+}
+
+func TestMegaDeleteRemovesOneObject(t *testing.T) {
+	dir := t.TempDir()
+	provider := NewMegaProvider("mega", "mega", NewRcloneClient(megaTestBin(t, dir), ""))
+	if err := os.WriteFile(filepath.Join(dir, "object"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := provider.Delete(context.Background(), "uploads/f1"); err != nil {
+		t.Fatal(err)
+	}
+	if log, _ := os.ReadFile(filepath.Join(dir, "log")); string(log) != "deletefile mega:uploads/f1\n" {
+		t.Fatalf("rclone calls:\n%s", log)
+	}
+}
+
+func TestMegaListAndStat(t *testing.T) {
+	provider := NewMegaProvider("mega", "mega", NewRcloneClient(fakeRcloneBin(t, `echo '[
+{"Path":"f1_a.mp4","Name":"f1_a.mp4","Size":5,"MimeType":"video/mp4","ModTime":"2026-01-02T03:04:05.123Z","IsDir":false},
+{"Path":"thumbs","Name":"thumbs","Size":-1,"ModTime":"2026-01-02T03:04:05Z","IsDir":true}
+]'`), ""))
+
+	files, err := provider.List(context.Background(), "uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("got %d files, want 2", len(files))
+	}
+	f := files[0]
+	want := time.Date(2026, 1, 2, 3, 4, 5, 123000000, time.UTC)
+	if f.Name != "f1_a.mp4" || f.Size != 5 || f.MimeType != "video/mp4" || !f.ModTime.Equal(want) || f.Path != "uploads/f1_a.mp4" || f.Provider != "mega" {
+		t.Errorf("got %+v", f)
+	}
+	if !files[1].IsDir {
+		t.Errorf("got %+v, want a directory", files[1])
+	}
+
+	info, err := provider.Stat(context.Background(), "uploads/f1_a.mp4")
+	if err != nil || info.Size != 5 {
+		t.Errorf("stat: got %+v, %v", info, err)
+	}
+	if _, err := provider.Stat(context.Background(), "uploads/missing"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("stat of a missing object: got %v, want ErrObjectNotFound", err)
+	}
+}
+
+func TestMegaListRejectsGarbage(t *testing.T) {
+	provider := NewMegaProvider("mega", "mega", NewRcloneClient(fakeRcloneBin(t, `echo 'f1_a.mp4 5'`), ""))
+	if _, err := provider.List(context.Background(), "uploads"); err == nil {
+		t.Error("got no error for output that isn't lsjson")
+	}
+}
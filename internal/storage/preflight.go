@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// RcloneStatus is what CheckRclone found out about the rclone installation
+type RcloneStatus struct {
+	Version        string   `json:"version,omitempty"`
+	Remotes        []string `json:"remotes,omitempty"`         // configured in the rclone config
+	MissingRemotes []string `json:"missing_remotes,omitempty"` // needed but not configured
+}
+
+// OK reports whether every remote the service needs is configured
+func (s RcloneStatus) OK() bool {
+	return len(s.MissingRemotes) == 0
+}
+
+// CheckRclone makes sure the rclone binary runs and its config can be read, and lists
+// which of the needed remotes are missing from the config. An error means rclone
+// can't be used at all.
+func CheckRclone(ctx context.Context, client RcloneClient, needed []string) (RcloneStatus, error) {
+	var status RcloneStatus
+
+	output, err := client.Command(ctx, "version").Output()
+	if err != nil {
+		return status, fmt.Errorf("rclone version failed: %w", commandError(err))
+	}
+	status.Version, _, _ = strings.Cut(strings.TrimSpace(string(output)), "\n")
+
+	output, err = client.Command(ctx, "listremotes").Output()
+	if err != nil {
+		return status, fmt.Errorf("rclone listremotes failed, check RCLONE_CONFIG_PATH: %w", commandError(err))
+	}
+	configured := make(map[string]bool)
+	for _, line := range strings.Split(string(output), "\n") {
+		if name := strings.TrimSuffix(strings.TrimSpace(line), ":"); name != "" {
+			configured[name] = true
+			status.Remotes = append(status.Remotes, name)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, remote := range needed {
+		name, _, _ := strings.Cut(remote, ":")
+		if !configured[name] && !seen[name] {
+			status.MissingRemotes = append(status.MissingRemotes, name)
+		}
+		seen[name] = true
+	}
+	sort.Strings(status.Remotes)
+	sort.Strings(status.MissingRemotes)
+	return status, nil
+}
+
+// commandError adds what rclone wrote to stderr to the error of a failed command
+func commandError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return err
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckRclone(t *testing.T) {
+	client := NewRcloneClient(fakeRcloneBin(t, `case "$1" in
+version) printf 'rclone v1.66.0\n- os/version: debian\n' ;;
+listremotes) printf 'gdrive:\nunion:\n\nmega:\n' ;;
+*) exit 1 ;;
+esac`), "")
+
+	status, err := CheckRclone(context.Background(), client, []string{"union", "gdrive:", "onedrive", "onedrive:", "box"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Version != "rclone v1.66.0" {
+		t.Errorf("got version %q, want the first line of rclone version", status.Version)
+	}
+	if want := []string{"gdrive", "mega", "union"}; !reflect.DeepEqual(status.Remotes, want) {
+		t.Errorf("got remotes %v, want %v", status.Remotes, want)
+	}
+	if want := []string{"box", "onedrive"}; !reflect.DeepEqual(status.MissingRemotes, want) || status.OK() {
+		t.Errorf("got missing remotes %v, want %v", status.MissingRemotes, want)
+	}
+
+	if status, err := CheckRclone(context.Background(), client, []string{"union"}); err != nil || !status.OK() {
+		t.Errorf("all configured: got %+v, %v", status, err)
+	}
+}
+
+func TestCheckRcloneFailures(t *testing.T) {
+	for _, tt := range []struct {
+		name, script, want string
+	}{
+		{"no binary", "exit 127", "rclone version failed"},
+		{"bad config", `case "$1" in
+version) echo "rclone v1.66.0" ;;
+*) echo "Failed to load config file: permission denied" >&2; exit 1 ;;
+esac`, "Failed to load config file: permission denied"},
+	} {
+		client := NewRcloneClient(fakeRcloneBin(t, tt.script), "")
+		if _, err := CheckRclone(context.Background(), client, []string{"union"}); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want an error with %q", tt.name, err, tt.want)
+		}
+	}
+}
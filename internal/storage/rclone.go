@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RcloneProvider implements StorageProvider for any rclone backend.
+// Backends that support `rclone link` (B2, S3, Drive, ...) can hand out direct URLs.
+type RcloneProvider struct {
+	name       string
+	remoteName string
+	backend    string
+	client     RcloneClient
+	logger     *logrus.Logger
+}
+
+// NewRcloneProvider creates a storage provider for a generic rclone remote
+func NewRcloneProvider(name, remoteName, backend string, client RcloneClient) *RcloneProvider {
+	return &RcloneProvider{
+		name:       name,
+		remoteName: remoteName,
+		backend:    backend,
+		client:     client,
+		logger:     logrus.New(),
+	}
+}
+
+// NewB2Provider creates a storage provider for a Backblaze B2 remote
+func NewB2Provider(name, remoteName string, client RcloneClient) *RcloneProvider {
+	return NewRcloneProvider(name, remoteName, "b2", client)
+}
+
+// Name returns the provider name
+func (r *RcloneProvider) Name() string {
+	return r.name
+}
+
+// Backend returns the rclone backend type of the remote (e.g. "b2")
+func (r *RcloneProvider) Backend() string {
+	return r.backend
+}
+
+// Upload streams a file to the remote using rclone rcat
+func (r *RcloneProvider) Upload(ctx context.Context, reader io.Reader, path string, opts UploadOptions) (*FileInfo, error) {
+	cmd := r.buildRcloneCmd(ctx, "rcat", r.remotePath(path))
+	cmd.Stdin = reader
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("failed to upload to %s: %w: %s", r.name, err, strings.TrimSpace(string(output)))
+	}
+
+	return r.Stat(ctx, path)
+}
+
+// Download downloads a file, fetching only the requested window for range requests
+func (r *RcloneProvider) Download(ctx context.Context, path string, opts DownloadOptions) (io.ReadCloser, error) {
+	cmd := r.buildRcloneCmd(ctx, "cat", append([]string{r.remotePath(path)}, rangeArgs(opts.Range)...)...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start rclone cat: %w", err)
+	}
+
+	return &cmdReadCloser{
+		ReadCloser: stdout,
+		cmd:        cmd,
+	}, nil
+}
+
+// List lists files in the given directory
+func (r *RcloneProvider) List(ctx context.Context, path string) ([]*FileInfo, error) {
+	output, err := r.buildRcloneCmd(ctx, "lsjson", r.remotePath(path)).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files from %s: %w", r.name, err)
+	}
+
+	return parseLsJSON(output, path, r.name)
+}
+
+// Delete deletes a file from the remote
+func (r *RcloneProvider) Delete(ctx context.Context, path string) error {
+	if err := r.buildRcloneCmd(ctx, "deletefile", r.remotePath(path)).Run(); err != nil {
+		return fmt.Errorf("failed to delete file from %s: %w", r.name, err)
+	}
+
+	return nil
+}
+
+// Stat gets file information
+func (r *RcloneProvider) Stat(ctx context.Context, filePath string) (*FileInfo, error) {
+	output, err := r.buildRcloneCmd(ctx, "lsjson", r.remotePath(filePath)).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	files, err := parseLsJSON(output, path.Dir(filePath), r.name)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		if file.Name == path.Base(filePath) {
+			return file, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, filePath)
+}
+
+// GetURL gets a time-limited direct download URL via rclone link
+func (r *RcloneProvider) GetURL(ctx context.Context, path string, expires time.Duration) (string, error) {
+	args := []string{r.remotePath(path)}
+	if expires > 0 {
+		args = append(args, "--expire", expires.String())
+	}
+
+	output, err := r.buildRcloneCmd(ctx, "link", args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s link: %w", r.backend, err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// IsAvailable checks if the remote is reachable
+func (r *RcloneProvider) IsAvailable(ctx context.Context) bool {
+	return r.buildRcloneCmd(ctx, "lsd", r.remoteName+":").Run() == nil
+}
+
+// rangeArgs returns the rclone cat flags fetching only rng, none for the whole object
+func rangeArgs(rng *RangeSpec) []string {
+	if rng == nil {
+		return nil
+	}
+	return []string{
+		"--offset", strconv.FormatInt(rng.Start, 10),
+		"--count", strconv.FormatInt(rng.End-rng.Start+1, 10),
+	}
+}
+
+// remotePath builds the rclone remote path for a file
+func (r *RcloneProvider) remotePath(path string) string {
+	return fmt.Sprintf("%s:%s", r.remoteName, path)
+}
+
+// buildRcloneCmd builds an rclone command through the provider's client
+func (r *RcloneProvider) buildRcloneCmd(ctx context.Context, operation string, args ...string) *exec.Cmd {
+	return r.client.Command(ctx, operation, args...)
+}
+
+// lsJSONEntry mirrors a single object in `rclone lsjson` output
+type lsJSONEntry struct {
+	ID       string `json:"ID"`
+	Name     string `json:"Name"`
+	Path     string `json:"Path"`
+	Size     int64  `json:"Size"`
+	MimeType string `json:"MimeType"`
+	ModTime  string `json:"ModTime"`
+	IsDir    bool   `json:"IsDir"`
+}
+
+// parseLsJSON converts `rclone lsjson` output for dir into FileInfo entries
+func parseLsJSON(output []byte, dir, provider string) ([]*FileInfo, error) {
+	var entries []lsJSONEntry
+	if err := json.Unmarshal(output, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse lsjson output: %w", err)
+	}
+
+	files := make([]*FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		modTime, err := time.Parse(time.RFC3339Nano, entry.ModTime)
+		if err != nil {
+			modTime = time.Time{}
+		}
+
+		id := entry.ID
+		if id == "" {
+			id = entry.Name
+		}
+
+		files = append(files, &FileInfo{
+			ID:       id,
+			Name:     entry.Name,
+			Size:     entry.Size,
+			ModTime:  modTime,
+			IsDir:    entry.IsDir,
+			MimeType: entry.MimeType,
+			Provider: provider,
+			Path:     path.Join(dir, entry.Path),
+		})
+	}
+
+	return files, nil
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestB2ProviderDirectURL(t *testing.T) {
+	dir := t.TempDir()
+	client := NewRcloneClient(fakeRcloneBin(t, `echo "$@" >> `+dir+`/log
+case "$1" in
+link) echo "https://f000.backblazeb2.com/file/bucket/uploads/f1?Authorization=token" ;;
+*) exit 1 ;;
+esac`), "")
+
+	provider, err := NewProviderFromSpec(ProviderSpec{Name: "backup", Remote: "b2main", Type: ProviderTypeFor("b2main")}, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2, ok := provider.(*RcloneProvider)
+	if !ok || b2.Backend() != ProviderTypeB2 || b2.Remote() != "b2main" {
+		t.Fatalf("got %#v, want a b2 provider on b2main", provider)
+	}
+
+	url, err := b2.GetURL(context.Background(), "uploads/f1", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "https://f000.backblazeb2.com/file/bucket/uploads/f1?Authorization=token" {
+		t.Errorf("url = %q", url)
+	}
+	if log, _ := os.ReadFile(filepath.Join(dir, "log")); strings.TrimSpace(string(log)) != "link b2main:uploads/f1 --expire 1h0m0s" {
+		t.Errorf("rclone calls:\n%s", log)
+	}
+}
+
+func TestB2ProviderURLFailure(t *testing.T) {
+	client := NewRcloneClient(fakeRcloneBin(t, `exit 1`), "")
+	if _, err := NewB2Provider("backup", "b2main", client).GetURL(context.Background(), "uploads/f1", 0); err == nil {
+		t.Error("failed rclone link returned a URL")
+	}
+}
+
+func TestProviderTypeFor(t *testing.T) {
+	for name, want := range map[string]string{
+		"mega2":   ProviderTypeMega,
+		"gdrive":  ProviderTypeGDrive,
+		"b2main":  ProviderTypeB2,
+		"s3cold":  ProviderTypeRclone,
+		"dropbox": ProviderTypeRclone,
+	} {
+		if got := ProviderTypeFor(name); got != want {
+			t.Errorf("ProviderTypeFor(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// SetReadPolicy configures Download and Stat. timeout bounds how long a single
+// provider may take to respond before it is abandoned (0 = no limit). With hedged
+// set, all usable providers are asked at once, the first success wins and the
+// others are cancelled; otherwise providers are tried one after another.
+func (u *UnionStorageImpl) SetReadPolicy(timeout time.Duration, hedged bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.readTimeout = timeout
+	u.hedgedReads = hedged
+}
+
+// readOp performs a read against a single provider
+type readOp func(ctx context.Context, provider StorageProvider) (interface{}, error)
+
+type readCandidate struct {
+	provider StorageProvider
+	breaker  *circuitBreaker
+}
+
+type readOutcome struct {
+	provider string
+	value    interface{}
+	cancel   context.CancelFunc
+	err      error
+}
+
+// readCandidates returns the providers a read may be sent to along with the read policy
+func (u *UnionStorageImpl) readCandidates() ([]readCandidate, time.Duration, bool) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	var candidates []readCandidate
+	for name, provider := range u.providers {
+		if u.usable(provider) {
+			candidates = append(candidates, readCandidate{provider: provider, breaker: u.breakers[name]})
+		}
+	}
+
+	return candidates, u.readTimeout, u.hedgedReads
+}
+
+// read runs op against the usable providers according to the read policy and returns
+// the first successful result with the name of the provider that produced it. The
+// returned cancel func must be called once the result is no longer in use. release,
+// if set, frees results that arrive after the read has been decided.
+func (u *UnionStorageImpl) read(ctx context.Context, op readOp, release func(interface{})) (interface{}, string, context.CancelFunc, error) {
+	candidates, timeout, hedged := u.readCandidates()
+	if len(candidates) == 0 {
+		return nil, "", nil, fmt.Errorf("no available providers")
+	}
+
+	if !hedged || len(candidates) == 1 {
+		var failed readFailures
+		for _, candidate := range candidates {
+			out := u.attempt(ctx, candidate, timeout, op, release, nil)
+			if out.err == nil {
+				return out.value, out.provider, out.cancel, nil
+			}
+			failed.add(out)
+			u.logger.Debugf("Read from provider %s failed: %v", out.provider, out.err)
+		}
+		return nil, "", nil, failed.err()
+	}
+
+	// Hedged: race every candidate, closing stop cancels the ones still running
+	stop := make(chan struct{})
+	outcomes := make(chan readOutcome, len(candidates))
+	for _, candidate := range candidates {
+		go func(candidate readCandidate) {
+			outcomes <- u.attempt(ctx, candidate, timeout, op, release, stop)
+		}(candidate)
+	}
+
+	var failed readFailures
+	for i := 0; i < len(candidates); i++ {
+		out := <-outcomes
+		if out.err != nil {
+			failed.add(out)
+			continue
+		}
+
+		close(stop)
+		remaining := len(candidates) - i - 1
+		go func() {
+			// A loser may still have finished before seeing stop
+			for j := 0; j < remaining; j++ {
+				if loser := <-outcomes; loser.err == nil {
+					if release != nil {
+						release(loser.value)
+					}
+					loser.cancel()
+				}
+			}
+		}()
+
+		u.logger.Debugf("Hedged read won by provider %s", out.provider)
+		return out.value, out.provider, out.cancel, nil
+	}
+
+	return nil, "", nil, failed.err()
+}
+
+// readFailures collects why each provider failed a read
+type readFailures struct {
+	errs    []string
+	missing int // providers that don't have the object
+}
+
+func (f *readFailures) add(out readOutcome) {
+	f.errs = append(f.errs, fmt.Sprintf("%s: %v", out.provider, out.err))
+	if IsNotFound(out.err) {
+		f.missing++
+	}
+}
+
+// err reports a read every provider failed, as ErrObjectNotFound when none of them
+// has the object
+func (f *readFailures) err() error {
+	if f.missing == len(f.errs) {
+		return fmt.Errorf("%w: %s", ErrObjectNotFound, strings.Join(f.errs, "; "))
+	}
+	return fmt.Errorf("all providers failed: %s", strings.Join(f.errs, "; "))
+}
+
+// attempt runs op against one provider, abandoning it after timeout or when stop
+// is closed. Results that arrive after the attempt was abandoned are released.
+func (u *UnionStorageImpl) attempt(ctx context.Context, candidate readCandidate, timeout time.Duration, op readOp, release func(interface{}), stop <-chan struct{}) readOutcome {
+	name := candidate.provider.Name()
+	attemptCtx, cancel := context.WithCancel(ctx)
+
+	done := make(chan readOutcome, 1)
+	go func() {
+		value, err := op(attemptCtx, candidate.provider)
+		done <- readOutcome{provider: name, value: value, cancel: cancel, err: err}
+	}()
+
+	abandon := func(err error) readOutcome {
+		cancel()
+		go func() {
+			if late := <-done; late.err == nil && release != nil {
+				release(late.value)
+			}
+		}()
+		return readOutcome{provider: name, err: err}
+	}
+
+	var timer <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timer = t.C
+	}
+
+	select {
+	case out := <-done:
+		u.recordResult(name, candidate.breaker, out.err)
+		if out.err != nil {
+			cancel()
+		}
+		return out
+	case <-timer:
+		err := fmt.Errorf("timed out after %s", timeout)
+		u.recordResult(name, candidate.breaker, err)
+		return abandon(err)
+	case <-stop:
+		if candidate.breaker != nil {
+			candidate.breaker.Abort()
+		}
+		return abandon(fmt.Errorf("cancelled, another provider responded first"))
+	case <-ctx.Done():
+		if candidate.breaker != nil {
+			candidate.breaker.Abort()
+		}
+		return abandon(ctx.Err())
+	}
+}
+
+// waitFirstByte blocks until reader has data, so a provider only counts as having
+// responded once bytes are flowing. Errors surfaced when an empty stream is closed
+// (e.g. rclone reporting a missing file) are returned instead of an empty reader.
+func waitFirstByte(reader io.ReadCloser) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(reader)
+	if _, err := buffered.Peek(1); err != nil {
+		if closeErr := reader.Close(); closeErr != nil {
+			return nil, closeErr
+		}
+		if err != io.EOF {
+			return nil, err
+		}
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+
+	return &bufferedReadCloser{Reader: buffered, closer: reader}, nil
+}
+
+type bufferedReadCloser struct {
+	*bufio.Reader
+	closer io.Closer
+}
+
+func (b *bufferedReadCloser) Close() error {
+	return b.closer.Close()
+}
+
+// cancelReadCloser releases a read's context when the reader is closed
+type cancelReadCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelReadCloser) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+// newSlowUnion returns a union of a provider that hangs and one that answers at once,
+// both holding path
+func newSlowUnion(t *testing.T, path string) *UnionStorageImpl {
+	t.Helper()
+	slow := newMockProvider("slow", 0)
+	slow.delay = time.Minute
+	fast := newMockProvider("fast", 0)
+	for _, provider := range []*mockProvider{slow, fast} {
+		provider.objects[path] = []byte("content")
+	}
+
+	u := NewUnionStorage()
+	u.logger.SetOutput(io.Discard)
+	for _, provider := range []*mockProvider{slow, fast} {
+		if err := u.AddProvider(provider); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return u
+}
+
+// readWithin downloads path from u, failing the test when it takes longer than limit
+func readWithin(t *testing.T, u *UnionStorageImpl, path string, limit time.Duration) string {
+	t.Helper()
+	start := time.Now()
+	reader, err := u.Download(context.Background(), path, DownloadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > limit {
+		t.Errorf("download took %s, want under %s", elapsed, limit)
+	}
+	return string(data)
+}
+
+func TestReadTimeoutSkipsSlowProvider(t *testing.T) {
+	u := newSlowUnion(t, "a.txt")
+	u.SetReadPolicy(50*time.Millisecond, false)
+
+	// Whichever provider is tried first, the slow one is abandoned after the timeout
+	for i := 0; i < 3; i++ {
+		if got := readWithin(t, u, "a.txt", 5*time.Second); got != "content" {
+			t.Errorf("got %q, want content", got)
+		}
+	}
+}
+
+func TestHedgedReadTakesFirstResponse(t *testing.T) {
+	u := newSlowUnion(t, "a.txt")
+	u.SetReadPolicy(0, true)
+
+	if got := readWithin(t, u, "a.txt", 5*time.Second); got != "content" {
+		t.Errorf("got %q, want content", got)
+	}
+	// The losing attempt was cancelled, not counted as a provider failure
+	if status := u.CircuitStates()["slow"]; status.ConsecutiveFailures != 0 {
+		t.Errorf("slow provider has %d failures, want 0", status.ConsecutiveFailures)
+	}
+}
+
+func TestReadTimeoutAllProvidersSlow(t *testing.T) {
+	u := newSlowUnion(t, "a.txt")
+	u.SetReadPolicy(20*time.Millisecond, false)
+	u.RemoveProvider("fast")
+
+	if _, err := u.Download(context.Background(), "a.txt", DownloadOptions{}); err == nil {
+		t.Error("got a download from a provider that never answered, want a timeout")
+	}
+}
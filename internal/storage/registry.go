@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Provider types understood by NewProviderFromSpec
+const (
+	ProviderTypeMega   = "mega"
+	ProviderTypeGDrive = "gdrive"
+	ProviderTypeB2     = "b2"
+	ProviderTypeRclone = "rclone"
+)
+
+// ProviderSpec describes how to construct a storage provider
+type ProviderSpec struct {
+	Name   string `json:"name"`
+	Remote string `json:"remote"`
+	Type   string `json:"type"`
+}
+
+// ProviderTypeFor infers a provider type from a remote name (e.g. "mega2" -> mega)
+func ProviderTypeFor(name string) string {
+	switch {
+	case strings.HasPrefix(name, "mega"):
+		return ProviderTypeMega
+	case strings.HasPrefix(name, "gdrive"):
+		return ProviderTypeGDrive
+	case strings.HasPrefix(name, "b2"):
+		return ProviderTypeB2
+	default:
+		return ProviderTypeRclone
+	}
+}
+
+// NewProviderFromSpec builds the storage provider described by spec
+func NewProviderFromSpec(spec ProviderSpec, client RcloneClient) (StorageProvider, error) {
+	if spec.Name == "" {
+		return nil, fmt.Errorf("provider name is required")
+	}
+
+	remote := spec.Remote
+	if remote == "" {
+		remote = spec.Name
+	}
+	if err := ValidateRemoteName(remote); err != nil {
+		return nil, err
+	}
+
+	switch spec.Type {
+	case ProviderTypeMega:
+		return NewMegaProvider(spec.Name, remote, client), nil
+	case ProviderTypeGDrive:
+		return NewGDriveProvider(spec.Name, remote, client), nil
+	case ProviderTypeB2:
+		return NewB2Provider(spec.Name, remote, client), nil
+	case ProviderTypeRclone, "":
+		return NewRcloneProvider(spec.Name, remote, ProviderTypeRclone, client), nil
+	default:
+		return nil, fmt.Errorf("unknown provider type: %s", spec.Type)
+	}
+}
+
+// ProviderRegistry persists the set of configured providers so runtime changes survive restarts
+type ProviderRegistry struct {
+	path  string
+	specs map[string]ProviderSpec
+	mu    sync.RWMutex
+}
+
+// NewProviderRegistry loads the registry from path, seeding it with defaults when the file doesn't exist
+func NewProviderRegistry(path string, defaults []ProviderSpec) (*ProviderRegistry, error) {
+	registry := &ProviderRegistry{
+		path:  path,
+		specs: make(map[string]ProviderSpec),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		for _, spec := range defaults {
+			registry.specs[spec.Name] = spec
+		}
+		return registry, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read provider registry: %w", err)
+	}
+
+	var specs []ProviderSpec
+	if err := json.Unmarshal(data, &specs); err != nil {
+		return nil, fmt.Errorf("failed to parse provider registry %s: %w", path, err)
+	}
+	for _, spec := range specs {
+		registry.specs[spec.Name] = spec
+	}
+
+	return registry, nil
+}
+
+// Specs returns all provider specs sorted by name
+func (r *ProviderRegistry) Specs() []ProviderSpec {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	specs := make([]ProviderSpec, 0, len(r.specs))
+	for _, spec := range r.specs {
+		specs = append(specs, spec)
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Name < specs[j].Name })
+
+	return specs
+}
+
+// Get returns the spec of the named provider
+func (r *ProviderRegistry) Get(name string) (ProviderSpec, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	spec, ok := r.specs[name]
+	return spec, ok
+}
+
+// Put adds or replaces a provider spec and persists the registry
+func (r *ProviderRegistry) Put(spec ProviderSpec) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.specs[spec.Name] = spec
+	return r.save()
+}
+
+// Remove deletes a provider spec and persists the registry
+func (r *ProviderRegistry) Remove(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.specs, name)
+	return r.save()
+}
+
+// Rename replaces the spec of oldName with spec in a single write
+func (r *ProviderRegistry) Rename(oldName string, spec ProviderSpec) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous, existed := r.specs[oldName]
+	delete(r.specs, oldName)
+	r.specs[spec.Name] = spec
+	if err := r.save(); err != nil {
+		delete(r.specs, spec.Name)
+		if existed {
+			r.specs[oldName] = previous
+		}
+		return err
+	}
+	return nil
+}
+
+// save writes the registry to disk, callers must hold the lock
+func (r *ProviderRegistry) save() error {
+	specs := make([]ProviderSpec, 0, len(r.specs))
+	for _, spec := range r.specs {
+		specs = append(specs, spec)
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Name < specs[j].Name })
+
+	data, err := json.MarshalIndent(specs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+
+	// Write atomically so a crash never leaves a truncated registry
+	tempPath := r.path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, r.path)
+}
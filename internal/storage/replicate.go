@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// SetReplicas sets how many providers Upload stores each file on. Values below 1
+// store a single copy.
+func (u *UnionStorageImpl) SetReplicas(n int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.replicas = max(n, 1)
+}
+
+// Replicas returns how many providers Upload stores each file on
+func (u *UnionStorageImpl) Replicas() int {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	return max(u.replicas, 1)
+}
+
+// uploadReplicas streams reader to every provider at once. A provider failing midway
+// stops receiving data without holding up the others. The upload succeeds when at
+// least one copy was stored, the FileInfo returned is that of the first provider that
+// succeeded and Replicas on it lists every provider holding a copy.
+func (u *UnionStorageImpl) uploadReplicas(ctx context.Context, providers []StorageProvider, reader io.Reader, path string, opts UploadOptions) (*FileInfo, error) {
+	type result struct {
+		info *FileInfo
+		err  error
+	}
+
+	writers := make([]*io.PipeWriter, len(providers))
+	results := make([]result, len(providers))
+	var wg sync.WaitGroup
+	for i, provider := range providers {
+		pr, pw := io.Pipe()
+		writers[i] = pw
+
+		wg.Add(1)
+		go func(i int, provider StorageProvider) {
+			defer wg.Done()
+			info, err := provider.Upload(ctx, pr, path, opts)
+			// Unblock the writer if the provider returned without reading everything
+			pr.CloseWithError(fmt.Errorf("provider %s stopped reading", provider.Name()))
+			results[i] = result{info, err}
+		}(i, provider)
+	}
+
+	_, copyErr := io.Copy(&fanoutWriter{writers: writers}, reader)
+	for _, pw := range writers {
+		pw.CloseWithError(copyErr)
+	}
+	wg.Wait()
+
+	var first *FileInfo
+	var stored []string
+	var errs []error
+	for i, provider := range providers {
+		err := results[i].err
+		u.mu.RLock()
+		breaker := u.breakers[provider.Name()]
+		u.mu.RUnlock()
+		u.recordResult(provider.Name(), breaker, err)
+
+		if err != nil {
+			u.logger.Warnf("Failed to store replica of %s on provider %s: %v", path, provider.Name(), err)
+			errs = append(errs, fmt.Errorf("provider %s: %w", provider.Name(), err))
+			continue
+		}
+		if first == nil {
+			first = results[i].info
+		}
+		stored = append(stored, provider.Name())
+	}
+
+	if first == nil {
+		return nil, fmt.Errorf("failed to upload to any provider: %v", errs)
+	}
+	first.Replicas = stored
+	return first, nil
+}
+
+// fanoutWriter writes to every pipe that is still open, a write only fails once
+// every pipe has failed
+type fanoutWriter struct {
+	writers []*io.PipeWriter
+	failed  []bool
+}
+
+func (f *fanoutWriter) Write(p []byte) (int, error) {
+	if f.failed == nil {
+		f.failed = make([]bool, len(f.writers))
+	}
+
+	open := 0
+	var lastErr error
+	for i, w := range f.writers {
+		if f.failed[i] {
+			continue
+		}
+		if _, err := w.Write(p); err != nil {
+			f.failed[i] = true
+			lastErr = err
+			continue
+		}
+		open++
+	}
+	if open == 0 {
+		return 0, lastErr
+	}
+	return len(p), nil
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUploadReplicas(t *testing.T) {
+	u := NewUnionStorage()
+	providers := map[string]*mockProvider{
+		"a": newMockProvider("a", 300),
+		"b": newMockProvider("b", 200),
+		"c": newMockProvider("c", 100),
+	}
+	for _, p := range providers {
+		u.AddProvider(p)
+	}
+	u.SetReplicas(2)
+
+	info, err := u.Upload(context.Background(), strings.NewReader("hello"), "uploads/f1", UploadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replicas := append([]string(nil), info.Replicas...)
+	sort.Strings(replicas)
+	if strings.Join(replicas, ",") != "a,b" {
+		t.Fatalf("replicas = %v, want [a b]", info.Replicas)
+	}
+	if _, err := providers["c"].Stat(context.Background(), "uploads/f1"); err == nil {
+		t.Fatal("c holds a copy, want only the two providers with the most free space")
+	}
+
+	// Either copy serves the download when the other provider goes down
+	for _, down := range []string{"a", "b"} {
+		for name, p := range providers {
+			p.mu.Lock()
+			p.available = name != down
+			p.mu.Unlock()
+		}
+		u.CheckHealth(context.Background(), time.Second)
+
+		reader, err := u.Download(context.Background(), "uploads/f1", DownloadOptions{})
+		if err != nil {
+			t.Fatalf("with %s down: %v", down, err)
+		}
+		data, _ := io.ReadAll(reader)
+		reader.Close()
+		if string(data) != "hello" {
+			t.Fatalf("with %s down: got %q", down, data)
+		}
+	}
+}
+
+func TestDeleteRemovesEveryReplica(t *testing.T) {
+	u := NewUnionStorage()
+	a, b := newMockProvider("a", 200), newMockProvider("b", 100)
+	u.AddProvider(a)
+	u.AddProvider(b)
+	u.SetReplicas(2)
+
+	if _, err := u.Upload(context.Background(), strings.NewReader("hello"), "uploads/f1", UploadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Delete(context.Background(), "uploads/f1"); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []*mockProvider{a, b} {
+		if _, err := p.Stat(context.Background(), "uploads/f1"); err == nil {
+			t.Errorf("%s still holds a copy", p.name)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// spaceTTL is how long a provider's reported free space is trusted before asking again
+const spaceTTL = time.Minute
+
+// SpaceInfo is the capacity of a provider in bytes
+type SpaceInfo struct {
+	Total int64 `json:"total"`
+	Used  int64 `json:"used"`
+	Free  int64 `json:"free"`
+}
+
+// SpaceReporter is implemented by providers that can report their free space
+type SpaceReporter interface {
+	About(ctx context.Context) (*SpaceInfo, error)
+}
+
+// RemoteProvider is implemented by providers backed by an rclone remote
+type RemoteProvider interface {
+	// Remote returns the rclone remote name, without the colon
+	Remote() string
+}
+
+// remoteAbout runs rclone about on a remote. It fails for backends without quota
+// support, which leave out the free space.
+func remoteAbout(ctx context.Context, client RcloneClient, remote string) (*SpaceInfo, error) {
+	output, err := client.Command(ctx, "about", remote+":", "--json").Output()
+	if err != nil {
+		return nil, fmt.Errorf("rclone about %s failed: %w", remote, err)
+	}
+
+	var about struct {
+		Total *int64 `json:"total"`
+		Used  *int64 `json:"used"`
+		Free  *int64 `json:"free"`
+	}
+	if err := json.Unmarshal(output, &about); err != nil {
+		return nil, fmt.Errorf("invalid rclone about output: %w", err)
+	}
+	if about.Free == nil {
+		return nil, fmt.Errorf("%s doesn't report free space", remote)
+	}
+
+	info := &SpaceInfo{Free: *about.Free}
+	if about.Total != nil {
+		info.Total = *about.Total
+	}
+	if about.Used != nil {
+		info.Used = *about.Used
+	}
+	return info, nil
+}
+
+// About reports the remote's capacity
+func (r *RcloneProvider) About(ctx context.Context) (*SpaceInfo, error) {
+	return remoteAbout(ctx, r.client, r.remoteName)
+}
+
+// Remote returns the rclone remote name
+func (r *RcloneProvider) Remote() string {
+	return r.remoteName
+}
+
+// About reports the account's capacity
+func (m *MegaProvider) About(ctx context.Context) (*SpaceInfo, error) {
+	return remoteAbout(ctx, m.client, m.remoteName)
+}
+
+// Remote returns the rclone remote name
+func (m *MegaProvider) Remote() string {
+	return m.remoteName
+}
+
+// About reports the drive's capacity
+func (g *GDriveProvider) About(ctx context.Context) (*SpaceInfo, error) {
+	return remoteAbout(ctx, g.client, g.remoteName)
+}
+
+// Remote returns the rclone remote name
+func (g *GDriveProvider) Remote() string {
+	return g.remoteName
+}
+
+// spaceSample is a provider's free space as last reported
+type spaceSample struct {
+	free      int64
+	ok        bool // false when the provider couldn't report it
+	checkedAt time.Time
+}
+
+// SetProviderWeights scales the free space of the named providers when choosing
+// where to upload, e.g. 2 makes a provider count as having twice its free space.
+// Providers not listed weigh 1.
+func (u *UnionStorageImpl) SetProviderWeights(weights map[string]float64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.weights = make(map[string]float64, len(weights))
+	for name, weight := range weights {
+		u.weights[name] = weight
+	}
+}
+
+// SelectProvider returns the provider the next upload should go to, nil when none is
+// usable. See SelectProviders.
+func (u *UnionStorageImpl) SelectProvider(ctx context.Context) StorageProvider {
+	if providers := u.SelectProviders(ctx, 1); len(providers) > 0 {
+		return providers[0]
+	}
+	return nil
+}
+
+// SelectProviders returns up to n usable providers in the order uploads should go to
+// them. Providers are ranked by weighted free space. When a usable provider can't
+// report its free space, e.g. a backend without quota support, they take turns instead.
+func (u *UnionStorageImpl) SelectProviders(ctx context.Context, n int) []StorageProvider {
+	u.mu.RLock()
+	var candidates []StorageProvider
+	for _, provider := range u.providers {
+		if u.usable(provider) {
+			candidates = append(candidates, provider)
+		}
+	}
+	u.mu.RUnlock()
+
+	if len(candidates) == 0 {
+		return nil
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Name() < candidates[j].Name()
+	})
+	n = min(n, len(candidates))
+
+	scores := make(map[string]float64, len(candidates))
+	for _, provider := range candidates {
+		free, ok := u.freeSpace(ctx, provider)
+		if !ok {
+			return u.nextInTurn(candidates)[:n]
+		}
+		scores[provider.Name()] = float64(free) * u.weight(provider.Name())
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return scores[candidates[i].Name()] > scores[candidates[j].Name()]
+	})
+	return candidates[:n]
+}
+
+// freeSpace returns a provider's free space, asking it at most once per spaceTTL
+func (u *UnionStorageImpl) freeSpace(ctx context.Context, provider StorageProvider) (int64, bool) {
+	name := provider.Name()
+
+	u.spaceMu.Lock()
+	sample, found := u.space[name]
+	u.spaceMu.Unlock()
+	if found && time.Since(sample.checkedAt) < spaceTTL {
+		return sample.free, sample.ok
+	}
+
+	sample = spaceSample{checkedAt: time.Now()}
+	if reporter, ok := provider.(SpaceReporter); ok {
+		if info, err := reporter.About(ctx); err == nil {
+			sample.free, sample.ok = info.Free, true
+		} else {
+			u.logger.Debugf("Free space of %s unknown: %v", name, err)
+		}
+	}
+
+	u.spaceMu.Lock()
+	u.space[name] = sample
+	u.spaceMu.Unlock()
+	return sample.free, sample.ok
+}
+
+// weight returns the configured weight of a provider
+func (u *UnionStorageImpl) weight(name string) float64 {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	if weight, ok := u.weights[name]; ok {
+		return weight
+	}
+	return 1
+}
+
+// nextInTurn rotates candidates round-robin, each call starting one provider later
+func (u *UnionStorageImpl) nextInTurn(candidates []StorageProvider) []StorageProvider {
+	u.spaceMu.Lock()
+	start := u.turn % len(candidates)
+	u.turn++
+	u.spaceMu.Unlock()
+
+	rotated := make([]StorageProvider, 0, len(candidates))
+	return append(append(rotated, candidates[start:]...), candidates[:start]...)
+}
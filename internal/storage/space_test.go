@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSelectProvidersWeighsFreeSpace(t *testing.T) {
+	u := NewUnionStorage()
+	for _, p := range []*mockProvider{
+		newMockProvider("a", 100),
+		newMockProvider("b", 80),
+		newMockProvider("c", 10),
+	} {
+		if err := u.AddProvider(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := u.SelectProvider(context.Background()).Name(); got != "a" {
+		t.Fatalf("unweighted choice = %s, want a (most free space)", got)
+	}
+
+	// b counts as 160 bytes free, more than a's 100
+	u.SetProviderWeights(map[string]float64{"b": 2})
+	got := u.SelectProviders(context.Background(), 3)
+	if len(got) != 3 || got[0].Name() != "b" || got[1].Name() != "a" || got[2].Name() != "c" {
+		t.Fatalf("weighted order = %v, want [b a c]", names(got))
+	}
+}
+
+func TestSelectProvidersTakesTurnsWithoutFreeSpace(t *testing.T) {
+	u := NewUnionStorage()
+	a, b := newMockProvider("a", 100), newMockProvider("b", 0)
+	b.aboutErr = errors.New("no quota support")
+	u.AddProvider(a)
+	u.AddProvider(b)
+
+	first := u.SelectProvider(context.Background()).Name()
+	second := u.SelectProvider(context.Background()).Name()
+	if first == second {
+		t.Fatalf("got %s twice, want providers to take turns", first)
+	}
+}
+
+func TestRemoteAbout(t *testing.T) {
+	bin := fakeRcloneBin(t, `[ "$1" = about ] && echo '{"total":300,"used":100,"free":200}'`)
+	provider := NewRcloneProvider("r", "r", "s3", NewRcloneClient(bin, ""))
+
+	info, err := provider.About(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Free != 200 || info.Total != 300 || info.Used != 100 {
+		t.Fatalf("got %+v", info)
+	}
+}
+
+func TestRemoteAboutWithoutFreeSpace(t *testing.T) {
+	bin := fakeRcloneBin(t, `echo '{"used":100}'`)
+	if _, err := remoteAbout(context.Background(), NewRcloneClient(bin, ""), "r"); err == nil {
+		t.Fatal("expected an error for a backend that doesn't report free space")
+	}
+}
+
+func names(providers []StorageProvider) []string {
+	var out []string
+	for _, p := range providers {
+		out = append(out, p.Name())
+	}
+	return out
+}
@@ -13,18 +13,64 @@ import (
 // UnionStorageImpl implements UnionStorage interface
 type UnionStorageImpl struct {
 	providers map[string]StorageProvider
+	health    map[string]ProviderHealth
+	breakers  map[string]*circuitBreaker
 	mu        sync.RWMutex
 	logger    *logrus.Logger
+
+	// Circuit breaker settings
+	failureThreshold int
+	baseCooldown     time.Duration
+	maxCooldown      time.Duration
+
+	// Read policy, see SetReadPolicy
+	readTimeout time.Duration
+	hedgedReads bool
+
+	// Upload placement, see SelectProvider
+	weights map[string]float64
+	space   map[string]spaceSample
+	turn    int
+	spaceMu sync.Mutex
+
+	// Copies stored by Upload, see SetReplicas
+	replicas int
+}
+
+// ProviderHealth records the last known availability of a provider
+type ProviderHealth struct {
+	Available bool      `json:"available"`
+	CheckedAt time.Time `json:"checked_at"`
+	LatencyMs int64     `json:"latency_ms"` // duration of the check
+	Error     string    `json:"error,omitempty"`
 }
 
 // NewUnionStorage creates a new union storage
 func NewUnionStorage() *UnionStorageImpl {
 	return &UnionStorageImpl{
-		providers: make(map[string]StorageProvider),
-		logger:    logrus.New(),
+		providers:        make(map[string]StorageProvider),
+		health:           make(map[string]ProviderHealth),
+		breakers:         make(map[string]*circuitBreaker),
+		space:            make(map[string]spaceSample),
+		logger:           logrus.New(),
+		replicas:         1,
+		failureThreshold: 5,
+		baseCooldown:     30 * time.Second,
+		maxCooldown:      10 * time.Minute,
 	}
 }
 
+// SetCircuitBreaker configures when a failing provider is skipped and for how long.
+// It applies to providers added afterwards.
+func (u *UnionStorageImpl) SetCircuitBreaker(threshold int, baseCooldown, maxCooldown time.Duration) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.failureThreshold = threshold
+	u.baseCooldown = baseCooldown
+	u.maxCooldown = maxCooldown
+}
+
 // AddProvider adds a storage provider to the union
 func (u *UnionStorageImpl) AddProvider(provider StorageProvider) error {
 	u.mu.Lock()
@@ -36,6 +82,7 @@ func (u *UnionStorageImpl) AddProvider(provider StorageProvider) error {
 	}
 
 	u.providers[name] = provider
+	u.breakers[name] = newCircuitBreaker(u.failureThreshold, u.baseCooldown, u.maxCooldown)
 	u.logger.Infof("Added storage provider: %s", name)
 	
 	return nil
@@ -51,11 +98,108 @@ func (u *UnionStorageImpl) RemoveProvider(name string) error {
 	}
 
 	delete(u.providers, name)
+	delete(u.health, name)
+	delete(u.breakers, name)
+	u.spaceMu.Lock()
+	delete(u.space, name)
+	u.spaceMu.Unlock()
 	u.logger.Infof("Removed storage provider: %s", name)
 	
 	return nil
 }
 
+// UpsertProvider adds a provider or replaces an existing one with the same name.
+// The new provider's health is probed before it is swapped in under the lock,
+// so subsequent operations immediately use the new configuration.
+func (u *UnionStorageImpl) UpsertProvider(ctx context.Context, provider StorageProvider) error {
+	if provider == nil {
+		return fmt.Errorf("provider is nil")
+	}
+
+	name := provider.Name()
+	health := probeHealth(ctx, provider)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	_, replaced := u.providers[name]
+	u.providers[name] = provider
+	u.health[name] = health
+	u.breakers[name] = newCircuitBreaker(u.failureThreshold, u.baseCooldown, u.maxCooldown)
+
+	if replaced {
+		u.logger.Infof("Replaced storage provider: %s (available: %t)", name, health.Available)
+	} else {
+		u.logger.Infof("Added storage provider: %s (available: %t)", name, health.Available)
+	}
+
+	return nil
+}
+
+// Health returns the last recorded health of each provider
+func (u *UnionStorageImpl) Health() map[string]ProviderHealth {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	health := make(map[string]ProviderHealth, len(u.health))
+	for name, h := range u.health {
+		health[name] = h
+	}
+
+	return health
+}
+
+// CircuitStates returns the circuit breaker state of each provider
+func (u *UnionStorageImpl) CircuitStates() map[string]CircuitStatus {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	states := make(map[string]CircuitStatus, len(u.breakers))
+	for name, breaker := range u.breakers {
+		states[name] = breaker.Status()
+	}
+
+	return states
+}
+
+// usable reports whether a provider should be tried: its circuit must not be
+// open and its last health check must have found it available. Providers are
+// only probed by CheckHealth, never on the request path. Callers must hold at
+// least the read lock.
+func (u *UnionStorageImpl) usable(provider StorageProvider) bool {
+	name := provider.Name()
+	if breaker := u.breakers[name]; breaker != nil && !breaker.Allow() {
+		return false
+	}
+
+	return u.available(name)
+}
+
+// available reports what the last health check found, a provider not checked yet
+// is assumed available. Callers must hold at least the read lock.
+func (u *UnionStorageImpl) available(name string) bool {
+	health, checked := u.health[name]
+	return !checked || health.Available
+}
+
+// recordResult feeds an operation outcome into the provider's circuit breaker.
+// Not-found errors don't count against the provider.
+func (u *UnionStorageImpl) recordResult(name string, breaker *circuitBreaker, err error) {
+	if breaker == nil {
+		return
+	}
+
+	if err != nil && !IsNotFound(err) {
+		breaker.Failure()
+		if breaker.Status().State == CircuitOpen {
+			u.logger.Warnf("Circuit opened for provider %s: %v", name, err)
+		}
+		return
+	}
+
+	breaker.Success()
+}
+
 // GetProviders returns all providers
 func (u *UnionStorageImpl) GetProviders() []StorageProvider {
 	u.mu.RLock()
@@ -82,65 +226,73 @@ func (u *UnionStorageImpl) Name() string {
 	return "union"
 }
 
-// Upload uploads a file to the best available provider
+// Upload uploads a file to the best available provider, or to as many as configured
+// with SetReplicas
 func (u *UnionStorageImpl) Upload(ctx context.Context, reader io.Reader, path string, opts UploadOptions) (*FileInfo, error) {
-	provider := u.selectBestProvider(ctx)
-	if provider == nil {
+	providers := u.SelectProviders(ctx, u.Replicas())
+	if len(providers) == 0 {
 		return nil, fmt.Errorf("no available providers for upload")
 	}
+	if len(providers) > 1 {
+		return u.uploadReplicas(ctx, providers, reader, path, opts)
+	}
+	provider := providers[0]
 
 	u.logger.Infof("Uploading %s to provider %s", path, provider.Name())
-	return provider.Upload(ctx, reader, path, opts)
-}
+	info, err := provider.Upload(ctx, reader, path, opts)
 
-// Download downloads a file from any available provider
-func (u *UnionStorageImpl) Download(ctx context.Context, path string, opts DownloadOptions) (io.ReadCloser, error) {
 	u.mu.RLock()
-	defer u.mu.RUnlock()
+	breaker := u.breakers[provider.Name()]
+	u.mu.RUnlock()
+	u.recordResult(provider.Name(), breaker, err)
 
-	var lastErr error
-	
-	// Try each provider until we find the file
-	for _, provider := range u.providers {
-		if !provider.IsAvailable(ctx) {
-			continue
-		}
+	return info, err
+}
 
+// Download downloads a file from any available provider. Each provider gets the
+// configured read timeout to deliver its first byte; with hedged reads enabled all
+// usable providers are asked at once and the first to respond wins.
+func (u *UnionStorageImpl) Download(ctx context.Context, path string, opts DownloadOptions) (io.ReadCloser, error) {
+	result, provider, cancel, err := u.read(ctx, func(ctx context.Context, provider StorageProvider) (interface{}, error) {
 		reader, err := provider.Download(ctx, path, opts)
-		if err == nil {
-			u.logger.Infof("Downloaded %s from provider %s", path, provider.Name())
-			return reader, nil
+		if err != nil {
+			return nil, err
 		}
-		
-		lastErr = err
-		u.logger.Debugf("Failed to download %s from provider %s: %v", path, provider.Name(), err)
+		return waitFirstByte(reader)
+	}, func(result interface{}) {
+		result.(io.ReadCloser).Close()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", path, err)
 	}
 
-	if lastErr != nil {
-		return nil, fmt.Errorf("failed to download from all providers: %w", lastErr)
-	}
-	
-	return nil, fmt.Errorf("no available providers for download")
+	u.logger.Infof("Downloaded %s from provider %s", path, provider)
+	return &cancelReadCloser{ReadCloser: result.(io.ReadCloser), cancel: cancel}, nil
 }
 
-// List lists files from all providers
+// List lists files from all providers. It fails only when no provider could be
+// listed, a partial listing is returned as is.
 func (u *UnionStorageImpl) List(ctx context.Context, path string) ([]*FileInfo, error) {
 	u.mu.RLock()
 	defer u.mu.RUnlock()
 
 	var allFiles []*FileInfo
 	fileMap := make(map[string]*FileInfo) // Deduplicate by path
+	var errs []error
+	listed := false
 
 	for _, provider := range u.providers {
-		if !provider.IsAvailable(ctx) {
+		if !u.available(provider.Name()) {
 			continue
 		}
 
 		files, err := provider.List(ctx, path)
 		if err != nil {
 			u.logger.Warnf("Failed to list files from provider %s: %v", provider.Name(), err)
+			errs = append(errs, fmt.Errorf("provider %s: %w", provider.Name(), err))
 			continue
 		}
+		listed = true
 
 		for _, file := range files {
 			// Use the first occurrence of each file path
@@ -151,6 +303,12 @@ func (u *UnionStorageImpl) List(ctx context.Context, path string) ([]*FileInfo,
 		}
 	}
 
+	if !listed {
+		if len(errs) == 0 {
+			return nil, fmt.Errorf("no available providers")
+		}
+		return nil, fmt.Errorf("failed to list from any provider: %v", errs)
+	}
 	return allFiles, nil
 }
 
@@ -161,9 +319,10 @@ func (u *UnionStorageImpl) Delete(ctx context.Context, path string) error {
 
 	var errors []error
 	deleted := false
+	missing := 0
 
 	for _, provider := range u.providers {
-		if !provider.IsAvailable(ctx) {
+		if !u.available(provider.Name()) {
 			continue
 		}
 
@@ -173,41 +332,34 @@ func (u *UnionStorageImpl) Delete(ctx context.Context, path string) error {
 			u.logger.Infof("Deleted %s from provider %s", path, provider.Name())
 		} else {
 			errors = append(errors, fmt.Errorf("provider %s: %w", provider.Name(), err))
+			if IsNotFound(err) {
+				missing++
+			}
 		}
 	}
 
 	if !deleted && len(errors) > 0 {
+		if missing == len(errors) {
+			return fmt.Errorf("%w: %s", ErrObjectNotFound, path)
+		}
 		return fmt.Errorf("failed to delete from any provider: %v", errors)
 	}
 
 	return nil
 }
 
-// Stat gets file information from the first provider that has it
+// Stat gets file information from the first provider that has it, using the same
+// timeout and hedging policy as Download
 func (u *UnionStorageImpl) Stat(ctx context.Context, path string) (*FileInfo, error) {
-	u.mu.RLock()
-	defer u.mu.RUnlock()
-
-	var lastErr error
-
-	for _, provider := range u.providers {
-		if !provider.IsAvailable(ctx) {
-			continue
-		}
-
-		info, err := provider.Stat(ctx, path)
-		if err == nil {
-			return info, nil
-		}
-		
-		lastErr = err
+	result, _, cancel, err := u.read(ctx, func(ctx context.Context, provider StorageProvider) (interface{}, error) {
+		return provider.Stat(ctx, path)
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", path, err)
 	}
+	cancel()
 
-	if lastErr != nil {
-		return nil, fmt.Errorf("failed to stat from all providers: %w", lastErr)
-	}
-	
-	return nil, fmt.Errorf("no available providers for stat")
+	return result.(*FileInfo), nil
 }
 
 // GetURL gets a direct download URL from the first provider that supports it
@@ -218,7 +370,7 @@ func (u *UnionStorageImpl) GetURL(ctx context.Context, path string, expires time
 	var lastErr error
 
 	for _, provider := range u.providers {
-		if !provider.IsAvailable(ctx) {
+		if !u.available(provider.Name()) {
 			continue
 		}
 
@@ -237,37 +389,16 @@ func (u *UnionStorageImpl) GetURL(ctx context.Context, path string, expires time
 	return "", fmt.Errorf("no available providers support direct URLs")
 }
 
-// IsAvailable checks if any provider is available
+// IsAvailable reports whether the last health check found any provider available
 func (u *UnionStorageImpl) IsAvailable(ctx context.Context) bool {
 	u.mu.RLock()
 	defer u.mu.RUnlock()
 
-	for _, provider := range u.providers {
-		if provider.IsAvailable(ctx) {
+	for name := range u.providers {
+		if u.available(name) {
 			return true
 		}
 	}
 	
 	return false
 }
-
-// selectBestProvider selects the best provider for upload based on availability and load
-func (u *UnionStorageImpl) selectBestProvider(ctx context.Context) StorageProvider {
-	u.mu.RLock()
-	defer u.mu.RUnlock()
-
-	// Simple round-robin selection for now
-	// In production, you might want to consider:
-	// - Provider availability
-	// - Current load/usage
-	// - Storage quotas
-	// - Geographic location
-	
-	for _, provider := range u.providers {
-		if provider.IsAvailable(ctx) {
-			return provider
-		}
-	}
-	
-	return nil
-}
\ No newline at end of file
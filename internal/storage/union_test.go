@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestAddProviderRejectsDuplicateNames(t *testing.T) {
+	u := NewUnionStorage()
+	if err := u.AddProvider(newMockProvider("a", 100)); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.AddProvider(newMockProvider("a", 100)); err == nil {
+		t.Error("second provider named a was added")
+	}
+	if got := len(u.GetProviders()); got != 1 {
+		t.Errorf("%d providers, want 1", got)
+	}
+}
+
+func TestUpsertProviderReplacesByName(t *testing.T) {
+	ctx := context.Background()
+	u := NewUnionStorage()
+	old := newMockProvider("a", 100)
+	u.AddProvider(old)
+	old.objects["uploads/f1"] = []byte("old")
+
+	replacement := newMockProvider("a", 100)
+	replacement.available = false
+	replacement.objects["uploads/f1"] = []byte("new")
+	if err := u.UpsertProvider(ctx, replacement); err != nil {
+		t.Fatal(err)
+	}
+	if u.GetProvider("a") != replacement || len(u.GetProviders()) != 1 {
+		t.Fatal("provider a was not replaced")
+	}
+
+	// The replacement is probed before it is swapped in
+	if replacement.probes != 1 || u.Health()["a"].Available {
+		t.Errorf("probes = %d, health = %+v, want one failed probe recorded", replacement.probes, u.Health()["a"])
+	}
+
+	replacement.available = true
+	u.CheckHealth(ctx, healthTestTimeout)
+	reader, err := u.Download(ctx, "uploads/f1", DownloadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if data, _ := io.ReadAll(reader); string(data) != "new" {
+		t.Errorf("downloaded %q, want the replacement's copy", data)
+	}
+}
+
+func TestUpsertProviderAddsNewName(t *testing.T) {
+	u := NewUnionStorage()
+	if err := u.UpsertProvider(context.Background(), newMockProvider("a", 100)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Upload(context.Background(), strings.NewReader("hello"), "uploads/f1", UploadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.UpsertProvider(context.Background(), nil); err == nil {
+		t.Error("nil provider accepted")
+	}
+}
@@ -54,19 +54,29 @@ class FileManager {
         });
     }
 
-    // Get list of files
+    // Get list of files, following the pages until every file is loaded
     async getFiles() {
         try {
-            const response = await fetch(`${this.apiBaseUrl}/files`, {
-                headers: this.auth.getAuthHeaders()
-            });
+            let result = null;
+            for (let page = 1; !result || page <= result.pagination.total_pages; page++) {
+                const response = await fetch(`${this.apiBaseUrl}/files?page=${page}&limit=100`, {
+                    headers: this.auth.getAuthHeaders()
+                });
 
-            if (response.ok) {
-                return await response.json();
-            } else {
-                this.auth.handleApiError(response);
-                throw new Error('Failed to get files');
+                if (!response.ok) {
+                    this.auth.handleApiError(response);
+                    throw new Error('Failed to get files');
+                }
+
+                const data = await response.json();
+                if (result) {
+                    result.files = result.files.concat(data.files || []);
+                } else {
+                    result = data;
+                    result.files = data.files || [];
+                }
             }
+            return result;
         } catch (error) {
             throw error;
         }